@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// retentionOffsets are the months after discovery analyze retention looks
+// at.
+var retentionOffsets = []int{3, 6, 12}
+
+// retentionOut is analyze retention's JSON output.
+type retentionOut struct {
+	Timezone string `json:"timezone"`
+	// Curve pools every cohort that has reached each point.
+	Curve   []retentionPoint  `json:"curve"`
+	Cohorts []retentionCohort `json:"cohorts"`
+}
+
+type retentionCohort struct {
+	Month   string `json:"month"`
+	Artists int64  `json:"artists"`
+	// Retained leaves out the points whose month hasn't ended yet.
+	Retained []retentionPoint `json:"retained"`
+}
+
+// retentionPoint is how many of a cohort's artists (Artists, a Share of
+// them) were played AfterMonths months after the month they were first
+// played in. In the curve, Cohorts is how many cohorts are pooled.
+type retentionPoint struct {
+	AfterMonths int     `json:"after_months"`
+	Cohorts     int     `json:"cohorts,omitempty"`
+	Artists     int64   `json:"artists"`
+	Share       float64 `json:"share"`
+}
+
+// cmdAnalyze runs an analysis of the local archive: analyze retention,
+// binges or completion.
+func cmdAnalyze(ctx context.Context, c config.Config, s *store.Store) int {
+	if len(c.Args) != 1 || (c.Args[0] != "retention" && c.Args[0] != "binges" && c.Args[0] != "completion") {
+		fmt.Fprintln(os.Stderr, "error: usage: analyze retention|binges|completion [--format text|json]")
+		return 2
+	}
+	if c.Format != "" && c.Format != "text" && c.Format != "json" {
+		fmt.Fprintln(os.Stderr, "error: invalid --format (expected text|json)")
+		return 2
+	}
+	switch c.Args[0] {
+	case "binges":
+		return analyzeBinges(ctx, c, s)
+	case "completion":
+		return analyzeCompletion(ctx, c, s)
+	}
+	cohorts, err := s.ArtistRetention(ctx, c.Filter, retentionOffsets)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	loc := s.Location()
+	out := retention(cohorts, time.Now().In(loc))
+	out.Timezone = loc.String()
+
+	if c.Format == "json" {
+		err = writeJSON(os.Stdout, out, c.Pretty)
+	} else {
+		err = writeRetentionText(os.Stdout, out)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// retention turns cohorts into shares, keeping the points that ended
+// before now's month, and pools them into the overall curve.
+func retention(cohorts []store.Cohort, now time.Time) retentionOut {
+	current := now.Format("2006-01")
+	out := retentionOut{Curve: []retentionPoint{}, Cohorts: []retentionCohort{}}
+	pooled := make([]retentionPoint, len(retentionOffsets))
+	pooledArtists := make([]int64, len(retentionOffsets))
+	for i, n := range retentionOffsets {
+		pooled[i].AfterMonths = n
+	}
+	for _, c := range cohorts {
+		month, err := time.Parse("2006-01", c.Month)
+		if err != nil {
+			continue
+		}
+		rc := retentionCohort{Month: c.Month, Artists: c.Artists, Retained: []retentionPoint{}}
+		for i, n := range retentionOffsets {
+			if month.AddDate(0, n, 0).Format("2006-01") >= current {
+				continue
+			}
+			rc.Retained = append(rc.Retained, retentionPoint{AfterMonths: n, Artists: c.Retained[i], Share: share(c.Retained[i], c.Artists)})
+			pooled[i].Cohorts++
+			pooled[i].Artists += c.Retained[i]
+			pooledArtists[i] += c.Artists
+		}
+		out.Cohorts = append(out.Cohorts, rc)
+	}
+	for i, p := range pooled {
+		if p.Cohorts == 0 {
+			continue
+		}
+		p.Share = share(p.Artists, pooledArtists[i])
+		out.Curve = append(out.Curve, p)
+	}
+	return out
+}
+
+// share is n of total, rounded to three places.
+func share(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)/float64(total)*1000) / 1000
+}
+
+// writeRetentionText prints a row per cohort, with the share retained
+// after each offset ("-" until it has passed), then the pooled curve.
+func writeRetentionText(w io.Writer, out retentionOut) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "cohort\tartists\t")
+	for _, n := range retentionOffsets {
+		fmt.Fprintf(tw, "%dm\t", n)
+	}
+	fmt.Fprintln(tw)
+	row := func(label string, artists int64, points []retentionPoint) {
+		fmt.Fprintf(tw, "%s\t%d\t", label, artists)
+		for _, n := range retentionOffsets {
+			cell := "-"
+			for _, p := range points {
+				if p.AfterMonths == n {
+					cell = fmt.Sprintf("%.0f%%", p.Share*100)
+				}
+			}
+			fmt.Fprintf(tw, "%s\t", cell)
+		}
+		fmt.Fprintln(tw)
+	}
+	var total int64
+	for _, c := range out.Cohorts {
+		row(c.Month, c.Artists, c.Retained)
+		total += c.Artists
+	}
+	row("all", total, out.Curve)
+	return tw.Flush()
+}
+
+// bingesOut is analyze binges' JSON output.
+type bingesOut struct {
+	Timezone string  `json:"timezone"`
+	Per      string  `json:"per"`
+	Unit     string  `json:"unit"`
+	MinShare float64 `json:"min_share"`
+	Binges   []binge `json:"binges"`
+}
+
+type binge struct {
+	// Period is the day (YYYY-MM-DD) or ISO week (YYYY-Www).
+	Period string  `json:"period"`
+	Artist string  `json:"artist"`
+	Album  string  `json:"album,omitempty"`
+	Plays  int64   `json:"plays"`
+	Total  int64   `json:"total"`
+	Share  float64 `json:"share"`
+}
+
+// analyzeBinges lists the --limit biggest days (or --per week weeks) that
+// one artist (or --unit album album) had more than --min-share of.
+func analyzeBinges(ctx context.Context, c config.Config, s *store.Store) int {
+	if c.Per != "day" && c.Per != "week" {
+		fmt.Fprintln(os.Stderr, "error: invalid --per (expected day|week)")
+		return 2
+	}
+	unit := c.Unit
+	if unit == "" {
+		unit = "artist"
+	}
+	if unit != "artist" && unit != "album" {
+		fmt.Fprintln(os.Stderr, "error: invalid --unit (expected artist|album)")
+		return 2
+	}
+	if c.MinShare <= 0 || c.MinShare >= 1 {
+		fmt.Fprintln(os.Stderr, "error: --min-share must be between 0 and 1")
+		return 2
+	}
+	found, err := s.Binges(ctx, c.Filter, c.Per == "week", unit == "album", c.MinShare, c.Limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	out := bingesOut{Timezone: s.Location().String(), Per: c.Per, Unit: unit, MinShare: c.MinShare, Binges: []binge{}}
+	for _, b := range found {
+		period := b.Start
+		if c.Per == "week" {
+			if t, err := time.Parse("2006-01-02", b.Start); err == nil {
+				y, w := t.ISOWeek()
+				period = fmt.Sprintf("%d-W%02d", y, w)
+			}
+		}
+		out.Binges = append(out.Binges, binge{Period: period, Artist: b.Artist, Album: b.Album, Plays: b.Plays, Total: b.Total, Share: share(b.Plays, b.Total)})
+	}
+
+	if c.Format == "json" {
+		err = writeJSON(os.Stdout, out, c.Pretty)
+	} else {
+		err = writeBingesText(os.Stdout, out)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// writeBingesText prints a line per binge: period, plays of the total,
+// share and what was played.
+func writeBingesText(w io.Writer, out bingesOut) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, b := range out.Binges {
+		name := b.Artist
+		if b.Album != "" {
+			name += " - " + b.Album
+		}
+		fmt.Fprintf(tw, "%s\t%d of %d\t%.0f%%\t%s\n", b.Period, b.Plays, b.Total, b.Share*100, name)
+	}
+	if len(out.Binges) == 0 {
+		fmt.Fprintf(tw, "No %s had more than %.0f%% of a %s's plays.\n", out.Unit+"s", out.MinShare*100, out.Per)
+	}
+	return tw.Flush()
+}
+
+// completionOut is analyze completion's JSON output.
+type completionOut struct {
+	Unit string `json:"unit"`
+	// Plays, Full, Partial and Rate sum up every track (or album), not
+	// just the ones listed.
+	Plays   int64            `json:"plays"`
+	Full    int64            `json:"full"`
+	Partial int64            `json:"partial"`
+	Rate    float64          `json:"rate"`
+	Items   []completionItem `json:"items"`
+}
+
+type completionItem struct {
+	Artist    string  `json:"artist"`
+	Album     string  `json:"album,omitempty"`
+	Track     string  `json:"track,omitempty"`
+	DurationS int64   `json:"duration_s,omitempty"`
+	Plays     int64   `json:"plays"`
+	Full      int64   `json:"full"`
+	Partial   int64   `json:"partial"`
+	Rate      float64 `json:"rate"`
+}
+
+// analyzeCompletion lists the --limit tracks (or --unit album albums) with
+// the most plays judged full listens, with their completion rates.
+func analyzeCompletion(ctx context.Context, c config.Config, s *store.Store) int {
+	unit := c.Unit
+	if unit == "" {
+		unit = "track"
+	}
+	if unit != "track" && unit != "album" {
+		fmt.Fprintln(os.Stderr, "error: invalid --unit (expected track|album)")
+		return 2
+	}
+	rates, err := s.CompletionRates(ctx, c.Filter, store.TimeRange{}, unit == "album", -1)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	out := completionOut{Unit: unit, Items: []completionItem{}}
+	for i, r := range rates {
+		out.Plays += r.Plays
+		out.Full += r.Full
+		out.Partial += r.Partial
+		if i < c.Limit {
+			out.Items = append(out.Items, completionItem{
+				Artist:    r.Artist,
+				Album:     r.Album,
+				Track:     r.Track,
+				DurationS: int64(r.Duration.Seconds()),
+				Plays:     r.Plays,
+				Full:      r.Full,
+				Partial:   r.Partial,
+				Rate:      r.Rate,
+			})
+		}
+	}
+	out.Rate = share(out.Full, out.Full+out.Partial)
+
+	if c.Format == "json" {
+		err = writeJSON(os.Stdout, out, c.Pretty)
+	} else {
+		err = writeCompletionText(os.Stdout, out)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// writeCompletionText prints a line per track or album: full listens of
+// plays, completion rate and name, then the overall rate.
+func writeCompletionText(w io.Writer, out completionOut) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, it := range out.Items {
+		name := it.Artist + " - " + it.Track
+		if it.Track == "" {
+			name = it.Artist + " - " + it.Album
+		}
+		fmt.Fprintf(tw, "%d of %d\t%s\t%s\n", it.Full, it.Plays, completionRate(it.Full, it.Partial, it.Rate), name)
+	}
+	fmt.Fprintf(tw, "%d of %d\t%s\tall %ss (%d partial)\n", out.Full, out.Plays, completionRate(out.Full, out.Partial, out.Rate), out.Unit, out.Partial)
+	return tw.Flush()
+}
+
+// completionRate shows rate as a percentage, or "?" if no play was judged.
+func completionRate(full, partial int64, rate float64) string {
+	if full+partial == 0 {
+		return "?"
+	}
+	return fmt.Sprintf("%.0f%%", rate*100)
+}
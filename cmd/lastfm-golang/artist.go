@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// cmdArtist summarizes how an artist has been played: artist <name>. With
+// --trajectory it prints their plays per month since the first listen as a
+// JSON array instead, for sparklines or commentary. Ignored plays are left
+// out, like in the digest.
+func cmdArtist(ctx context.Context, c config.Config, s *store.Store) int {
+	if len(c.Args) != 1 || strings.TrimSpace(c.Args[0]) == "" {
+		fmt.Fprintln(os.Stderr, "error: usage: artist <name> [--trajectory]")
+		return 2
+	}
+	name, months, err := s.ArtistMonthlyPlays(ctx, c.Filter, c.Args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	if name == "" {
+		fmt.Fprintf(os.Stderr, "error: no plays of %q\n", c.Args[0])
+		return 1
+	}
+	months = fillMonths(months, time.Now().In(s.Location()))
+
+	if c.Trajectory {
+		err = writeJSON(os.Stdout, months, c.Pretty)
+	} else {
+		err = writeArtistSummary(os.Stdout, name, months)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// fillMonths adds the months without plays between the first of months and
+// now's, so the series has one entry per month.
+func fillMonths(months []store.MonthPlays, now time.Time) []store.MonthPlays {
+	if len(months) == 0 {
+		return months
+	}
+	first, err := time.Parse("2006-01", months[0].Month)
+	if err != nil {
+		return months
+	}
+	plays := map[string]int64{}
+	last := months[0].Month
+	for _, m := range months {
+		plays[m.Month] = m.Plays
+		last = max(last, m.Month)
+	}
+	end := max(now.Format("2006-01"), last)
+	out := []store.MonthPlays{}
+	for t := first; t.Format("2006-01") <= end; t = t.AddDate(0, 1, 0) {
+		month := t.Format("2006-01")
+		out = append(out, store.MonthPlays{Month: month, Plays: plays[month]})
+	}
+	return out
+}
+
+// writeArtistSummary prints the artist's total plays, first and peak month
+// and a sparkline of the months since.
+func writeArtistSummary(w io.Writer, name string, months []store.MonthPlays) error {
+	var total int64
+	peak := months[0]
+	for _, m := range months {
+		total += m.Plays
+		if m.Plays > peak.Plays {
+			peak = m
+		}
+	}
+	_, err := fmt.Fprintf(w, "%s: %d %s since %s, most in %s (%d)\n%s\n",
+		name, total, plural(int(total), "play", "plays"), months[0].Month, peak.Month, peak.Plays, sparkline(months))
+	return err
+}
+
+// sparkline draws plays per month as block characters, one per month,
+// scaled to the busiest.
+func sparkline(months []store.MonthPlays) string {
+	blocks := []rune("▁▂▃▄▅▆▇█")
+	var peak int64
+	for _, m := range months {
+		peak = max(peak, m.Plays)
+	}
+	var b strings.Builder
+	for _, m := range months {
+		if m.Plays == 0 {
+			b.WriteByte(' ')
+			continue
+		}
+		b.WriteRune(blocks[(m.Plays*int64(len(blocks))-1)/peak])
+	}
+	return b.String()
+}
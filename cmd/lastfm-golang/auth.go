@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+// cmdAuth runs Last.fm desktop authentication and prints a session key for
+// LASTFM_SESSION_KEY. Needs the API key and shared secret.
+func cmdAuth(ctx context.Context, log logx.Logger, client *lastfm.Client) int {
+	token, err := client.GetToken(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	log.Infof("Open this page and allow access:\n\n  %s\n\nthen press Enter.", client.AuthURL(token))
+	if _, err := bufio.NewReader(os.Stdin).ReadString('\n'); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	sess, err := client.GetSession(ctx, token)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	log.Infof("authorized as %s; add this to your env file:", sess.Name)
+	fmt.Fprintf(os.Stdout, "LASTFM_SESSION_KEY=%s\n", sess.Key)
+	return 0
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// recommendBlockCmds are the recommend subcommands that only touch the block
+// list, so they don't need an API key.
+var recommendBlockCmds = map[string]bool{"block-artist": true, "unblock-artist": true, "blocked": true}
+
+// recommendIsLocal reports whether recommend can run without an API key:
+// block list commands, --offline runs from the cache and --algo resurface.
+func recommendIsLocal(args []string) bool {
+	if len(args) > 0 && recommendBlockCmds[args[0]] {
+		return true
+	}
+	for i, a := range args {
+		if a == "--offline" || a == "-offline" || a == "--offline=true" || a == "-offline=true" {
+			return true
+		}
+		if a == "--algo=resurface" || a == "-algo=resurface" ||
+			((a == "--algo" || a == "-algo") && i+1 < len(args) && args[i+1] == "resurface") {
+			return true
+		}
+	}
+	return false
+}
+
+// cmdRecommendBlock manages artists recommend never suggests:
+// recommend block-artist <name>, recommend unblock-artist <name>, recommend blocked.
+func cmdRecommendBlock(ctx context.Context, log logx.Logger, c config.Config, s *store.Store) int {
+	args := c.Args
+	switch {
+	case len(args) == 1 && args[0] == "blocked":
+		artists, err := s.BlockedArtists(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		for _, a := range artists {
+			fmt.Fprintln(os.Stdout, a)
+		}
+		return 0
+	case len(args) == 2 && args[1] != "" && args[0] == "block-artist":
+		added, err := s.BlockArtist(ctx, args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		if added {
+			log.Infof("recommend: blocked %s", args[1])
+		} else {
+			log.Infof("recommend: %s is already blocked", args[1])
+		}
+		return 0
+	case len(args) == 2 && args[1] != "" && args[0] == "unblock-artist":
+		removed, err := s.UnblockArtist(ctx, args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		if removed {
+			log.Infof("recommend: unblocked %s", args[1])
+		} else {
+			log.Infof("recommend: %s was not blocked", args[1])
+		}
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, "error: usage: recommend [block-artist <name> | unblock-artist <name> | blocked]")
+		return 2
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+const chartsUsage = `error: usage: charts [artists|tracks] [--country <name>] [--limit <n>]`
+
+type chartsOut struct {
+	Meta    chartsMeta   `json:"meta"`
+	Entries []chartEntry `json:"entries"`
+}
+
+type chartsMeta struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Chart       string    `json:"chart"`
+	// Country is empty for the global chart; Tag is set for explore-tag.
+	Country string `json:"country,omitempty"`
+	Tag     string `json:"tag,omitempty"`
+}
+
+// chartEntry is a chart position with my own plays of it.
+type chartEntry struct {
+	Rank      int    `json:"rank"`
+	Artist    string `json:"artist"`
+	Track     string `json:"track,omitempty"`
+	Listeners int64  `json:"listeners,omitempty"`
+	// PlayCount is global; country and tag charts don't have it.
+	PlayCount          int64 `json:"playcount,omitempty"`
+	LocalPlays         int64 `json:"local_plays"`
+	LocalLastPlayedUTS int64 `json:"local_last_played_uts"`
+}
+
+// cmdCharts prints the global or a country's top artists or tracks,
+// annotated with local play counts: what's trending that I've never played.
+func cmdCharts(ctx context.Context, log logx.Logger, c config.Config, client *lastfm.Client, s *store.Store) int {
+	kind, ok := chartKind(c.Args)
+	if !ok {
+		fmt.Fprintln(os.Stderr, chartsUsage)
+		return 2
+	}
+	if code := checkChartFlags(c); code != 0 {
+		return code
+	}
+
+	out := chartsOut{Meta: chartsMeta{GeneratedAt: time.Now().UTC(), Chart: kind, Country: c.Country}}
+	var err error
+	if kind == "artists" {
+		var artists []lastfm.ChartArtist
+		if c.Country == "" {
+			artists, err = client.GetChartTopArtists(ctx, c.Limit)
+		} else {
+			artists, err = client.GetGeoTopArtists(ctx, c.Country, c.Limit)
+		}
+		out.Entries = artistEntries(artists)
+	} else {
+		var tracks []lastfm.ChartTrack
+		if c.Country == "" {
+			tracks, err = client.GetChartTopTracks(ctx, c.Limit)
+		} else {
+			tracks, err = client.GetGeoTopTracks(ctx, c.Country, c.Limit)
+		}
+		out.Entries = trackEntries(tracks)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return writeChart(ctx, log, c, s, out)
+}
+
+// chartKind reads an optional artists|tracks argument.
+func chartKind(args []string) (string, bool) {
+	switch {
+	case len(args) == 0:
+		return "artists", true
+	case len(args) == 1 && (args[0] == "artists" || args[0] == "tracks"):
+		return args[0], true
+	}
+	return "", false
+}
+
+func checkChartFlags(c config.Config) int {
+	if c.Limit <= 0 {
+		fmt.Fprintln(os.Stderr, "error: --limit must be positive")
+		return 2
+	}
+	if c.Format != "" && c.Format != "json" && c.Format != "tsv" {
+		fmt.Fprintln(os.Stderr, "error: invalid --format (expected json|tsv)")
+		return 2
+	}
+	return 0
+}
+
+func artistEntries(artists []lastfm.ChartArtist) []chartEntry {
+	out := make([]chartEntry, 0, len(artists))
+	for _, a := range artists {
+		out = append(out, chartEntry{Artist: a.Name, Listeners: chartCount(a.Listeners), PlayCount: chartCount(a.PlayCount)})
+	}
+	return out
+}
+
+func trackEntries(tracks []lastfm.ChartTrack) []chartEntry {
+	out := make([]chartEntry, 0, len(tracks))
+	for _, t := range tracks {
+		out = append(out, chartEntry{Artist: t.Artist.Name, Track: t.Name, Listeners: chartCount(t.Listeners), PlayCount: chartCount(t.PlayCount)})
+	}
+	return out
+}
+
+// writeChart numbers the entries, adds local plays and prints them as JSON
+// or TSV (rank, artist[, track], local plays).
+func writeChart(ctx context.Context, log logx.Logger, c config.Config, s *store.Store, out chartsOut) int {
+	// Last.fm sometimes pads a page past the limit.
+	if len(out.Entries) > c.Limit {
+		out.Entries = out.Entries[:c.Limit]
+	}
+	for i := range out.Entries {
+		e := &out.Entries[i]
+		e.Rank = i + 1
+		var err error
+		if e.LocalPlays, e.LocalLastPlayedUTS, err = s.LocalPlays(ctx, e.Artist, e.Track); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+	}
+	log.Debugf("chart: %d %s", len(out.Entries), out.Meta.Chart)
+
+	if c.Format == "tsv" {
+		for _, e := range out.Entries {
+			name := e.Artist
+			if e.Track != "" {
+				name += "\t" + e.Track
+			}
+			fmt.Fprintf(os.Stdout, "%d\t%s\t%d\n", e.Rank, name, e.LocalPlays)
+		}
+		return 0
+	}
+	var b []byte
+	var err error
+	if c.Pretty {
+		b, err = json.MarshalIndent(out, "", "  ")
+	} else {
+		b, err = json.Marshal(out)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	if _, err := os.Stdout.Write(append(b, '\n')); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// chartCount reads one of Last.fm's string counts; missing is 0.
+func chartCount(s string) int64 {
+	n, _ := parseI64(s)
+	return n
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+const compatUsage = `error: usage: compat --other-user <name> [--limit <n>] [--format json|markdown]`
+
+// compatOut is compat's report: how my all-time artists line up with
+// another Last.fm user's.
+type compatOut struct {
+	Meta compatMeta `json:"meta"`
+	// Score is the cosine similarity of both top --limit artists' play
+	// counts, 0-100: 100 is the same artists in the same proportions.
+	Score float64 `json:"score"`
+	// OverlapPct is the share of their top artists I have played at all.
+	OverlapPct float64        `json:"overlap_pct"`
+	Shared     []compatArtist `json:"shared_artists"`
+	// Unplayed are their top artists I have never played, their best first.
+	Unplayed []compatArtist `json:"unplayed_artists"`
+}
+
+type compatMeta struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	User        string    `json:"user,omitempty"`
+	OtherUser   string    `json:"other_user"`
+	Limit       int       `json:"limit"`
+}
+
+// compatArtist is one of their top artists with both play counts.
+type compatArtist struct {
+	TheirRank  int    `json:"their_rank"`
+	Artist     string `json:"artist"`
+	TheirPlays int64  `json:"their_plays"`
+	MyPlays    int64  `json:"my_plays"`
+}
+
+// cmdCompat compares my local history with another user's Last.fm top
+// artists: a taste-compatibility report.
+func cmdCompat(ctx context.Context, log logx.Logger, c config.Config, client *lastfm.Client, s *store.Store) int {
+	if c.OtherUser == "" || len(c.Args) > 0 {
+		fmt.Fprintln(os.Stderr, compatUsage)
+		return 2
+	}
+	if c.Limit <= 0 {
+		fmt.Fprintln(os.Stderr, "error: --limit must be positive")
+		return 2
+	}
+	if c.Format != "" && c.Format != "json" && c.Format != "markdown" {
+		fmt.Fprintln(os.Stderr, "error: invalid --format (expected json|markdown)")
+		return 2
+	}
+
+	theirs, err := client.GetUserTopArtists(ctx, c.OtherUser, lastfm.PeriodOverall, c.Limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	// Last.fm sometimes pads a page past the limit.
+	if len(theirs) > c.Limit {
+		theirs = theirs[:c.Limit]
+	}
+	// A negative limit is no limit to SQLite.
+	mine, err := s.TopArtists(ctx, store.Filter{HideIgnored: true}, store.TimeRange{}, -1)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	log.Debugf("compat: %d of %s's artists, %d local", len(theirs), c.OtherUser, len(mine))
+
+	out := compatReport(mine, theirs, c.Limit)
+	out.Meta = compatMeta{GeneratedAt: time.Now().UTC(), User: s.User(), OtherUser: c.OtherUser, Limit: c.Limit}
+	if c.Format == "markdown" {
+		err = out.writeMarkdown(os.Stdout)
+	} else {
+		err = writeJSON(os.Stdout, out, c.Pretty)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// compatReport scores mine, most played first, against their top artists.
+// Names match by store.NormalizeArtist; the score only counts my top limit, as
+// theirs is cut there too.
+func compatReport(mine []store.ArtistCount, theirs []lastfm.UserTopArtist, limit int) compatOut {
+	out := compatOut{Shared: []compatArtist{}, Unplayed: []compatArtist{}}
+	my := make(map[string]int64, len(mine))
+	for _, a := range mine {
+		my[store.NormalizeArtist(a.Artist)] += a.Plays
+	}
+
+	var dot, myNorm, theirNorm float64
+	top := make(map[string]bool, limit)
+	for _, a := range mine[:min(limit, len(mine))] {
+		myNorm += float64(a.Plays) * float64(a.Plays)
+		top[store.NormalizeArtist(a.Artist)] = true
+	}
+	for i, t := range theirs {
+		e := compatArtist{TheirRank: i + 1, Artist: t.Name, TheirPlays: chartCount(t.PlayCount), MyPlays: my[store.NormalizeArtist(t.Name)]}
+		theirNorm += float64(e.TheirPlays) * float64(e.TheirPlays)
+		if top[store.NormalizeArtist(t.Name)] {
+			dot += float64(e.TheirPlays) * float64(e.MyPlays)
+		}
+		if e.MyPlays > 0 {
+			out.Shared = append(out.Shared, e)
+		} else {
+			out.Unplayed = append(out.Unplayed, e)
+		}
+	}
+	if myNorm > 0 && theirNorm > 0 {
+		out.Score = math.Round(dot/math.Sqrt(myNorm*theirNorm)*1000) / 10
+	}
+	if len(theirs) > 0 {
+		out.OverlapPct = math.Round(float64(len(out.Shared))*1000/float64(len(theirs))) / 10
+	}
+	return out
+}
+
+// writeMarkdown prints the report as a short Markdown document.
+func (o compatOut) writeMarkdown(w io.Writer) error {
+	me := o.Meta.User
+	if me == "" {
+		me = "me"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s and %s\n\n", me, o.Meta.OtherUser)
+	fmt.Fprintf(&b, "- Compatibility: **%.1f/100**\n", o.Score)
+	fmt.Fprintf(&b, "- Overlap: %.1f%% of %s's top %d artists\n", o.OverlapPct, o.Meta.OtherUser, o.Meta.Limit)
+	table := func(title string, as []compatArtist) {
+		if len(as) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n| # | Artist | %s | %s |\n|---:|---|---:|---:|\n", title, o.Meta.OtherUser, me)
+		for _, a := range as {
+			fmt.Fprintf(&b, "| %d | %s | %d | %d |\n", a.TheirRank, strings.ReplaceAll(a.Artist, "|", `\|`), a.TheirPlays, a.MyPlays)
+		}
+	}
+	table("Shared artists", o.Shared)
+	table("Artists only "+o.Meta.OtherUser+" listens to", o.Unplayed)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// cmdDelete tombstones stored scrobbles (delete --uts N, or --artist/--track/
+// --album), or as "delete list" prints the tombstones. Nothing is removed:
+// undelete brings them back.
+func cmdDelete(ctx context.Context, log logx.Logger, c config.Config, s *store.Store) int {
+	if len(c.Args) == 1 && c.Args[0] == "list" {
+		tombs, err := s.Tombstones(ctx, 1000)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		for _, t := range tombs {
+			fmt.Fprintf(os.Stdout, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				time.Unix(t.DeletedAtUTS, 0).UTC().Format(time.RFC3339), t.Reason,
+				time.Unix(t.PlayedAtUTS, 0).UTC().Format(time.RFC3339), t.Artist, t.Track, t.Album)
+		}
+		return 0
+	}
+	m := playMatch(c)
+	if len(c.Args) > 0 || m == (store.EditMatch{Glob: c.Play.Glob}) {
+		fmt.Fprintln(os.Stderr, "error: usage: delete --uts N | [--artist A] [--track T] [--album B] [--glob], or delete list")
+		return 2
+	}
+
+	res, err := s.TombstoneScrobbles(ctx, m, store.TombstoneManual)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return finishTombstones(ctx, log, c, s, "delete", "tombstone", res)
+}
+
+// cmdUndelete restores tombstoned scrobbles matching the same flags as
+// delete, or all of them with "undelete all".
+func cmdUndelete(ctx context.Context, log logx.Logger, c config.Config, s *store.Store) int {
+	m := playMatch(c)
+	all := len(c.Args) == 1 && c.Args[0] == "all"
+	empty := m == store.EditMatch{Glob: c.Play.Glob}
+	if (len(c.Args) > 0 && !all) || all != empty {
+		fmt.Fprintln(os.Stderr, "error: usage: undelete --uts N | [--artist A] [--track T] [--album B] [--glob], or undelete all")
+		return 2
+	}
+
+	res, err := s.UndeleteScrobbles(ctx, m)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return finishTombstones(ctx, log, c, s, "undelete", "restore", res)
+}
+
+// playMatch selects scrobbles by --uts, --artist, --track, --album and --glob.
+func playMatch(c config.Config) store.EditMatch {
+	p := c.Play
+	return store.EditMatch{PlayedAtUTS: p.UTS, Artist: p.Artist, Track: p.Track, Album: p.Album, Glob: p.Glob}
+}
+
+// finishTombstones reports what delete or undelete (cmd) changed and
+// recharts from the earliest play touched; a dry run lists the changes
+// led by action instead.
+func finishTombstones(ctx context.Context, log logx.Logger, c config.Config, s *store.Store, cmd, action string, res store.TombstoneResult) int {
+	if c.DryRun {
+		printTombstones(os.Stdout, action, res.Scrobbles)
+		log.Infof("%s dry run: would change %d scrobbles", cmd, len(res.Scrobbles))
+		return 0
+	}
+	log.Infof("%s: changed %d scrobbles", cmd, len(res.Scrobbles))
+	if len(res.Scrobbles) > 0 {
+		if err := rechartFrom(ctx, log, s, res.MinPlayed); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// diaryOut is diary's JSON output: the last --days local days, newest
+// first, each with its scrobbles oldest first.
+type diaryOut struct {
+	Timezone string     `json:"timezone"`
+	Days     []diaryDay `json:"days"`
+}
+
+type diaryDay struct {
+	Date  string `json:"date"`
+	Plays int    `json:"plays"`
+	// TopArtist is the day's most played artist; a tie goes to the one
+	// played first.
+	TopArtist      string           `json:"top_artist,omitempty"`
+	TopArtistPlays int              `json:"top_artist_plays,omitempty"`
+	Scrobbles      []store.Scrobble `json:"scrobbles"`
+}
+
+// cmdDiary prints the last --days local days of scrobbles, grouped by day,
+// as text, Markdown or JSON. Ignored plays are left out, like in the
+// digest.
+func cmdDiary(ctx context.Context, c config.Config, s *store.Store) int {
+	if len(c.Args) > 0 {
+		fmt.Fprintln(os.Stderr, "error: usage: diary [--days <n>] [--format text|markdown|json]")
+		return 2
+	}
+	if c.Format != "" && c.Format != "text" && c.Format != "markdown" && c.Format != "json" {
+		fmt.Fprintln(os.Stderr, "error: invalid --format (expected text|markdown|json)")
+		return 2
+	}
+	if c.Days <= 0 {
+		fmt.Fprintln(os.Stderr, "error: --days must be positive")
+		return 2
+	}
+	loc := c.Location
+	if loc == nil {
+		loc = s.Location()
+	}
+
+	out, err := diary(ctx, s, c.Filter, c.Days, time.Now().In(loc))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	switch c.Format {
+	case "json":
+		err = writeJSON(os.Stdout, out, c.Pretty)
+	case "markdown":
+		err = writeDiaryMarkdown(os.Stdout, out, loc)
+	default:
+		err = writeDiaryText(os.Stdout, out, loc)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// diary collects the scrobbles of the days local days up to and including
+// now's, as seen through f with ignored plays hidden.
+func diary(ctx context.Context, s *store.Store, f store.Filter, days int, now time.Time) (diaryOut, error) {
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	out := diaryOut{Timezone: loc.String()}
+	index := map[string]int{}
+	for i := range days {
+		date := today.AddDate(0, 0, -i).Format("2006-01-02")
+		index[date] = i
+		out.Days = append(out.Days, diaryDay{Date: date, Scrobbles: []store.Scrobble{}})
+	}
+
+	f.HideIgnored = true
+	plays, err := s.ScrobblesIn(ctx, f, store.TimeRange{From: today.AddDate(0, 0, 1-days).Unix()})
+	if err != nil {
+		return diaryOut{}, err
+	}
+	for _, sc := range plays {
+		i, ok := index[time.Unix(sc.PlayedAtUTS, 0).In(loc).Format("2006-01-02")]
+		if !ok {
+			continue // played after today by this clock
+		}
+		out.Days[i].Scrobbles = append(out.Days[i].Scrobbles, sc)
+	}
+	for i := range out.Days {
+		d := &out.Days[i]
+		d.Plays = len(d.Scrobbles)
+		counts := map[string]int{}
+		for _, sc := range d.Scrobbles {
+			counts[sc.Artist]++
+			if n := counts[sc.Artist]; n > d.TopArtistPlays {
+				d.TopArtist, d.TopArtistPlays = sc.Artist, n
+			}
+		}
+	}
+	return out, nil
+}
+
+// writeDiaryText prints a line per day (date, plays, top artist) with its
+// scrobbles indented below it.
+func writeDiaryText(w io.Writer, d diaryOut, loc *time.Location) error {
+	var b strings.Builder
+	for _, day := range d.Days {
+		date, _ := time.ParseInLocation("2006-01-02", day.Date, loc)
+		fmt.Fprintf(&b, "%s  %d %s", date.Format("Mon 2006-01-02"), day.Plays, plural(day.Plays, "play", "plays"))
+		if day.TopArtist != "" {
+			fmt.Fprintf(&b, "  top: %s (%d)", day.TopArtist, day.TopArtistPlays)
+		}
+		b.WriteByte('\n')
+		for _, sc := range day.Scrobbles {
+			fmt.Fprintf(&b, "  %s  %s - %s\n", time.Unix(sc.PlayedAtUTS, 0).In(loc).Format("15:04"), sc.Artist, sc.Track)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeDiaryMarkdown prints a section per day with its scrobbles as a
+// list.
+func writeDiaryMarkdown(w io.Writer, d diaryOut, loc *time.Location) error {
+	var b strings.Builder
+	for i, day := range d.Days {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		date, _ := time.ParseInLocation("2006-01-02", day.Date, loc)
+		fmt.Fprintf(&b, "## %s\n\n", date.Format("Monday 2 January 2006"))
+		if day.Plays == 0 {
+			b.WriteString("No plays.\n")
+			continue
+		}
+		fmt.Fprintf(&b, "%d %s, top artist %s (%d).\n\n", day.Plays, plural(day.Plays, "play", "plays"), day.TopArtist, day.TopArtistPlays)
+		for _, sc := range day.Scrobbles {
+			fmt.Fprintf(&b, "- %s %s - %s", time.Unix(sc.PlayedAtUTS, 0).In(loc).Format("15:04"), sc.Artist, sc.Track)
+			if sc.Album != "" {
+				fmt.Fprintf(&b, " (*%s*)", sc.Album)
+			}
+			b.WriteByte('\n')
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
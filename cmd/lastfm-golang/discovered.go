@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// discoveredOut is discovered's JSON output: what was first played in a
+// period, oldest first.
+type discoveredOut struct {
+	Kind     string            `json:"kind"`
+	Period   string            `json:"period"`
+	Timezone string            `json:"timezone"`
+	Items    []discoveredEntry `json:"items"`
+}
+
+type discoveredEntry struct {
+	Artist string `json:"artist"`
+	Album  string `json:"album,omitempty"`
+	// Track is the first track played.
+	Track          string `json:"track"`
+	FirstPlayedUTS int64  `json:"first_played_uts"`
+	FirstPlayedAt  string `json:"first_played_at"`
+}
+
+// cmdDiscovered lists the artists (or albums) first played in a year, month
+// or day of the home time zone (or --tz): discovered [artists|albums]
+// <YYYY|YYYY-MM|YYYY-MM-DD>. Ignored plays are left out, like in the digest.
+func cmdDiscovered(ctx context.Context, c config.Config, s *store.Store) int {
+	args := c.Args
+	kind := "artists"
+	if len(args) == 2 && (args[0] == "artists" || args[0] == "albums") {
+		kind, args = args[0], args[1:]
+	}
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "error: usage: discovered [artists|albums] <YYYY|YYYY-MM|YYYY-MM-DD> [--format text|json]")
+		return 2
+	}
+	if c.Format != "" && c.Format != "text" && c.Format != "json" {
+		fmt.Fprintln(os.Stderr, "error: invalid --format (expected text|json)")
+		return 2
+	}
+	loc := c.Location
+	if loc == nil {
+		loc = s.Location()
+	}
+	r, err := parsePeriod(args[0], loc)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 2
+	}
+
+	plays, err := s.FirstPlays(ctx, c.Filter, r, kind == "albums", c.Limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	out := discoveredOut{Kind: kind, Period: args[0], Timezone: loc.String(), Items: []discoveredEntry{}}
+	for _, p := range plays {
+		out.Items = append(out.Items, discoveredEntry{
+			Artist:         p.Artist,
+			Album:          p.Album,
+			Track:          p.Track,
+			FirstPlayedUTS: p.FirstPlayedUTS,
+			FirstPlayedAt:  time.Unix(p.FirstPlayedUTS, 0).In(loc).Format(time.RFC3339),
+		})
+	}
+	if c.Format == "json" {
+		err = writeJSON(os.Stdout, out, c.Pretty)
+	} else {
+		err = writeDiscoveredText(os.Stdout, out, loc)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// parsePeriod turns a year, month or day into the time range it covers in
+// loc.
+func parsePeriod(p string, loc *time.Location) (store.TimeRange, error) {
+	for _, l := range []struct {
+		layout     string
+		y, m, days int
+	}{
+		{"2006", 1, 0, 0},
+		{"2006-01", 0, 1, 0},
+		{"2006-01-02", 0, 0, 1},
+	} {
+		if t, err := time.ParseInLocation(l.layout, p, loc); err == nil {
+			return store.TimeRange{From: t.Unix(), To: t.AddDate(l.y, l.m, l.days).Unix()}, nil
+		}
+	}
+	return store.TimeRange{}, fmt.Errorf("invalid period %q (expected YYYY, YYYY-MM or YYYY-MM-DD)", p)
+}
+
+// writeDiscoveredText prints a line per first play: date, name and the
+// track it started with.
+func writeDiscoveredText(w io.Writer, d discoveredOut, loc *time.Location) error {
+	var b strings.Builder
+	for _, e := range d.Items {
+		name := e.Artist
+		if e.Album != "" {
+			name += " - " + e.Album
+		}
+		fmt.Fprintf(&b, "%s  %s  (first: %s)\n", time.Unix(e.FirstPlayedUTS, 0).In(loc).Format("2006-01-02 15:04"), name, e.Track)
+	}
+	if len(d.Items) == 0 {
+		fmt.Fprintf(&b, "No %s first played in %s.\n", d.Kind, d.Period)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
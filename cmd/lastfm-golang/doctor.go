@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+type checkStatus string
+
+const (
+	checkOK   checkStatus = "ok"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "FAIL"
+	checkSkip checkStatus = "skip"
+	checkInfo checkStatus = "info"
+)
+
+type check struct {
+	Status checkStatus
+	Name   string
+	Detail string
+}
+
+// Thresholds for warnings.
+const (
+	minFreeDiskBytes = 500 << 20 // 500 MiB
+	maxClockSkew     = 30 * time.Second
+)
+
+func cmdDoctor(ctx context.Context, log logx.Logger, client *lastfm.Client, s *store.Store) int {
+	_ = log // reserved for future diagnostics
+
+	var checks []check
+	var serverTime time.Time
+
+	if client == nil {
+		checks = append(checks, check{checkSkip, "api key", "no api key configured; set LASTFM_API_KEY or use --env-file"})
+	} else {
+		t, err := client.Ping(ctx)
+		var ae lastfm.APIError
+		switch {
+		case errors.As(err, &ae) && errors.Is(err, lastfm.ErrAuth):
+			checks = append(checks, check{checkFail, "api key", fmt.Sprintf("rejected by Last.fm (%s); create a key at https://www.last.fm/api/account/create", ae.Message)})
+		case err != nil:
+			checks = append(checks, check{checkFail, "api key", fmt.Sprintf("could not reach Last.fm: %v; check network/proxy settings or --api-base-url", err)})
+		default:
+			checks = append(checks, check{checkOK, "api key", "accepted by Last.fm"})
+			serverTime = t
+		}
+	}
+
+	var integrity string
+	if err := s.DB.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&integrity); err != nil {
+		checks = append(checks, check{checkFail, "database", fmt.Sprintf("integrity_check failed to run: %v", err)})
+	} else if integrity != "ok" {
+		checks = append(checks, check{checkFail, "database", fmt.Sprintf("integrity_check: %s; restore from backup or rebuild from %s", integrity, store.RawJSONLFile)})
+	} else {
+		checks = append(checks, check{checkOK, "database", "integrity_check ok"})
+	}
+
+	if v, err := s.Version(ctx); err != nil {
+		checks = append(checks, check{checkFail, "schema", err.Error()})
+	} else if v > store.SchemaVersion {
+		checks = append(checks, check{checkWarn, "schema", fmt.Sprintf("version %d is newer than this binary supports (%d); upgrade lastfm-golang", v, store.SchemaVersion)})
+	} else if v < store.SchemaVersion {
+		checks = append(checks, check{checkWarn, "schema", fmt.Sprintf("version %d is older than expected (%d); rerun any command to migrate", v, store.SchemaVersion)})
+	} else {
+		checks = append(checks, check{checkOK, "schema", fmt.Sprintf("version %d", v)})
+	}
+
+	checks = append(checks, checkRawConsistency(ctx, s))
+
+	if free, err := diskFree(s.DataDir); err != nil {
+		checks = append(checks, check{checkSkip, "disk", fmt.Sprintf("free space unknown: %v", err)})
+	} else if free < minFreeDiskBytes {
+		checks = append(checks, check{checkWarn, "disk", fmt.Sprintf("only %s free in %s; backfills and SQLite WAL need headroom", formatBytes(free), s.DataDir)})
+	} else {
+		checks = append(checks, check{checkOK, "disk", fmt.Sprintf("%s free in %s", formatBytes(free), s.DataDir)})
+	}
+
+	if serverTime.IsZero() {
+		checks = append(checks, check{checkSkip, "clock", "no server time available (needs a successful api call)"})
+	} else {
+		skew := time.Since(serverTime).Round(time.Second)
+		if skew.Abs() > maxClockSkew {
+			checks = append(checks, check{checkWarn, "clock", fmt.Sprintf("local clock is off by %s vs Last.fm; enable NTP so sync windows line up", skew)})
+		} else {
+			checks = append(checks, check{checkOK, "clock", fmt.Sprintf("skew %s vs Last.fm", skew)})
+		}
+	}
+
+	failed := false
+	for _, c := range checks {
+		fmt.Fprintf(os.Stdout, "%-4s  %-10s %s\n", c.Status, c.Name, c.Detail)
+		if c.Status == checkFail {
+			failed = true
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// checkRawConsistency compares the raw JSONL log with the scrobbles table;
+// every inserted scrobble gets exactly one raw line. The log is shared by
+// all users and never rewritten, so it is checked against every Last.fm
+// API row, tombstones included, and may outlive pruned ones.
+func checkRawConsistency(ctx context.Context, s *store.Store) check {
+	if err := s.RawJSONLBuf.Flush(); err != nil {
+		return check{checkFail, "raw jsonl", err.Error()}
+	}
+	// The raw log mirrors API responses only; imports and manual entries
+	// have no raw record.
+	rows, pruned, err := s.RawRowCount(ctx)
+	if err != nil {
+		return check{checkFail, "raw jsonl", err.Error()}
+	}
+	lines, err := countLines(filepath.Join(s.DataDir, store.RawJSONLFile))
+	if err != nil {
+		return check{checkFail, "raw jsonl", err.Error()}
+	}
+	_, pagesErr := os.Stat(filepath.Join(s.DataDir, store.RawPagesFile))
+	switch {
+	case lines == rows:
+		return check{checkOK, "raw jsonl", fmt.Sprintf("%d lines match %d rows", lines, rows)}
+	case lines < rows && pagesErr == nil:
+		return check{checkOK, "raw jsonl", fmt.Sprintf("%d lines for %d rows; the rest are in %s (--raw pages)", lines, rows, store.RawPagesFile)}
+	case lines < rows:
+		return check{checkWarn, "raw jsonl", fmt.Sprintf("%d lines for %d rows; some scrobbles have no raw record (interrupted run or older version)", lines, rows)}
+	case pruned:
+		return check{checkInfo, "raw jsonl", fmt.Sprintf("%d lines for %d rows; the raw log keeps pruned scrobbles", lines, rows)}
+	default:
+		return check{checkInfo, "raw jsonl", fmt.Sprintf("%d lines for %d rows; the raw log keeps records since removed from the DB", lines, rows)}
+	}
+}
+
+func countLines(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var n int64
+	r := bufio.NewReaderSize(f, 1024*1024)
+	for {
+		_, err := r.ReadSlice('\n')
+		if err == nil {
+			n++
+			continue
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// A --dry-run lists every change it would have made on stdout, one TSV
+// line each, led by the action: insert, upsert, edit, tombstone, restore,
+// prune or enrich.
+
+// printInserts lists scrobbles a dry run would store: played at (UTC),
+// artist, track, album.
+func printInserts(w io.Writer, tracks []lastfm.Track) {
+	for _, t := range tracks {
+		at := ""
+		if t.Date != nil {
+			if uts, err := strconv.ParseInt(t.Date.UTS, 10, 64); err == nil {
+				at = time.Unix(uts, 0).UTC().Format(time.RFC3339)
+			}
+		}
+		fmt.Fprintf(w, "insert\t%s\t%s\t%s\t%s\n", at, t.Artist.Text, t.Name, t.Album.Text)
+	}
+}
+
+// printUpserts lists external play counts a dry run would store.
+func printUpserts(w io.Writer, plays []store.ExternalPlay) {
+	for _, p := range plays {
+		fmt.Fprintf(w, "upsert\t%s\t%s\t%s\t%s\t%d\n", p.Source, p.Artist, p.Track, p.Album, p.Plays)
+	}
+}
+
+// printEdits lists field changes a dry run would make: played at (UTC),
+// field, old value, new value.
+func printEdits(w io.Writer, edits []store.Edit) {
+	for _, e := range edits {
+		fmt.Fprintf(w, "edit\t%s\t%s\t%s\t%s\n",
+			time.Unix(e.PlayedAtUTS, 0).UTC().Format(time.RFC3339), e.Field, e.OldValue, e.NewValue)
+	}
+}
+
+// printTombstones lists scrobbles a dry run would tombstone, restore or
+// prune (action): played at (UTC), artist, track, album.
+func printTombstones(w io.Writer, action string, scrobbles []store.Scrobble) {
+	for _, sc := range scrobbles {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", action,
+			time.Unix(sc.PlayedAtUTS, 0).UTC().Format(time.RFC3339), sc.Artist, sc.Track, sc.Album)
+	}
+}
+
+// printLookups lists what a dry run of enrich would store: "artist", MBID,
+// country; or "album", MBID, first release year, version kind.
+func printLookups(w io.Writer, artists []store.MBArtist, releases []store.MBRelease) {
+	for _, a := range artists {
+		fmt.Fprintf(w, "enrich\tartist\t%s\t%s\n", a.MBID, a.Country)
+	}
+	for _, r := range releases {
+		fmt.Fprintf(w, "enrich\talbum\t%s\t%d\t%s\n", r.MBID, r.Year, r.Kind)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// cmdEdit corrects metadata on stored scrobbles (edit --artist X --set-artist Y)
+// or, as "edit log", prints the audit trail of earlier edits.
+func cmdEdit(ctx context.Context, log logx.Logger, c config.Config, s *store.Store) int {
+	if len(c.Args) == 1 && c.Args[0] == "log" {
+		edits, err := s.Edits(ctx, 1000)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		for _, e := range edits {
+			fmt.Fprintf(os.Stdout, "%s\t%d\t%s\t%s\t%s\n",
+				time.Unix(e.EditedAtUTS, 0).UTC().Format(time.RFC3339), e.PlayedAtUTS, e.Field, e.OldValue, e.NewValue)
+		}
+		return 0
+	}
+	if len(c.Args) > 0 {
+		fmt.Fprintln(os.Stderr, "error: usage: edit [--uts N] [--artist A] [--track T] [--album B] [--glob] --set-artist|--set-track|--set-album V, or edit log")
+		return 2
+	}
+
+	p := c.Play
+	m := playMatch(c)
+	set := store.EditSet{Artist: p.SetArtist, Track: p.SetTrack, Album: p.SetAlbum}
+	if m == (store.EditMatch{Glob: p.Glob}) {
+		fmt.Fprintln(os.Stderr, "error: edit needs --uts, --artist, --track or --album to select scrobbles")
+		return 2
+	}
+	if set == (store.EditSet{}) {
+		fmt.Fprintln(os.Stderr, "error: edit needs --set-artist, --set-track or --set-album")
+		return 2
+	}
+
+	res, err := s.EditScrobbles(ctx, m, set)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	if c.DryRun {
+		printEdits(os.Stdout, res.Changes)
+		log.Infof("edit dry run: would update %d scrobbles (%d field changes)", res.Rows, res.Fields)
+		return 0
+	}
+	log.Infof("edit: updated %d scrobbles (%d field changes recorded in edits)", res.Rows, res.Fields)
+
+	// Artist charts count by name, so recharting from the earliest edited day.
+	if res.Rows > 0 && set.Artist != "" {
+		if err := rechartFrom(ctx, log, s, res.MinPlayed); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// rechartFrom refreshes artist rank history after scrobbles from fromUTS on changed.
+func rechartFrom(ctx context.Context, log logx.Logger, s *store.Store, fromUTS int64) error {
+	if err := s.RewindArtistRankHistory(ctx, fromUTS); err != nil {
+		return err
+	}
+	days, err := s.UpdateArtistRankHistory(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	log.Debugf("rank history: recharted %d days", days)
+	return nil
+}
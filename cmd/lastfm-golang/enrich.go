@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/musicbrainz"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// cmdEnrich looks up on MusicBrainz the artist and album MBIDs Last.fm gave
+// stored scrobbles that haven't been looked up yet, most played first:
+// artists' countries and albums' first release years, for the digest's
+// countries and decades sections, and whether an album is live, remixes or
+// demos, for --versions. It does at most --limit of each per run,
+// at MusicBrainz's one request a second, so a big library takes a few runs.
+// A failed lookup is logged and retried next run. A dry run lists what it
+// looked up and stores nothing.
+func cmdEnrich(ctx context.Context, log logx.Logger, c config.Config, s *store.Store) int {
+	if len(c.Args) > 0 {
+		fmt.Fprintln(os.Stderr, "error: usage: enrich [--limit n]")
+		return 2
+	}
+	if c.Limit <= 0 {
+		fmt.Fprintln(os.Stderr, "error: --limit must be positive")
+		return 2
+	}
+	opts := []musicbrainz.Option{}
+	if c.MusicBrainzURL != "" {
+		opts = append(opts, musicbrainz.WithBaseURL(c.MusicBrainzURL))
+	}
+	mb, err := musicbrainz.New(c.UserAgent, opts...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 2
+	}
+
+	artists, err := s.UnknownArtistMBIDs(ctx, c.Limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	releases, err := s.UnknownReleaseMBIDs(ctx, c.Limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	log.Infof("enrich: looking up %d artists and %d albums on MusicBrainz", len(artists), len(releases))
+
+	// An MBID MusicBrainz doesn't know is stored empty, so it isn't asked
+	// about again.
+	failed := 0
+	var gotArtists []store.MBArtist
+	var gotReleases []store.MBRelease
+	for _, mbid := range artists {
+		a, err := mb.Artist(ctx, mbid)
+		if err == nil || errors.Is(err, musicbrainz.ErrNotFound) {
+			got := store.MBArtist{MBID: mbid, Country: a.Country}
+			gotArtists = append(gotArtists, got)
+			err = s.PutMBArtist(ctx, got)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Infof("enrich: artist %s: %v", mbid, err)
+			failed++
+		}
+	}
+	for _, mbid := range releases {
+		if ctx.Err() != nil {
+			break
+		}
+		r, err := mb.Release(ctx, mbid)
+		if err == nil || errors.Is(err, musicbrainz.ErrNotFound) {
+			got := store.MBRelease{MBID: mbid, Year: r.Year(), Kind: releaseKind(r)}
+			gotReleases = append(gotReleases, got)
+			err = s.PutMBRelease(ctx, got)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Infof("enrich: album %s: %v", mbid, err)
+			failed++
+		}
+	}
+	if c.DryRun {
+		printLookups(os.Stdout, gotArtists, gotReleases)
+	}
+	if ctx.Err() != nil {
+		how, code := stopped(ctx)
+		log.Infof("enrich %s; rerun enrich to finish", how)
+		return code
+	}
+
+	if c.DryRun {
+		log.Infof("enrich dry run: looked up %d artists and %d albums (%d failed)", len(gotArtists), len(gotReleases), failed)
+		return 0
+	}
+	log.Infof("enrich: done (%d failed)", failed)
+	if len(artists) == c.Limit || len(releases) == c.Limit {
+		log.Infof("enrich: more left; run enrich again")
+	}
+	return 0
+}
+
+// releaseKind is the first of store.VersionKinds among the release group's
+// secondary types ("Live", "Remix", "Demo"), or "".
+func releaseKind(r musicbrainz.Release) string {
+	for _, t := range r.ReleaseGroup.SecondaryTypes {
+		if k := strings.ToLower(t); slices.Contains(store.VersionKinds, k) {
+			return k
+		}
+	}
+	return ""
+}
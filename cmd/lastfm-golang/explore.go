@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+const exploreTagUsage = `error: usage: explore-tag <tag> [artists|tracks] [--limit <n>]`
+
+// cmdExploreTag lists a tag's top artists or tracks with local play counts,
+// to see how much of a genre I already know.
+func cmdExploreTag(ctx context.Context, log logx.Logger, c config.Config, client *lastfm.Client, s *store.Store) int {
+	if len(c.Args) == 0 || c.Args[0] == "" {
+		fmt.Fprintln(os.Stderr, exploreTagUsage)
+		return 2
+	}
+	tag := c.Args[0]
+	kind, ok := chartKind(c.Args[1:])
+	if !ok {
+		fmt.Fprintln(os.Stderr, exploreTagUsage)
+		return 2
+	}
+	if code := checkChartFlags(c); code != 0 {
+		return code
+	}
+
+	out := chartsOut{Meta: chartsMeta{GeneratedAt: time.Now().UTC(), Chart: kind, Tag: tag}}
+	if kind == "artists" {
+		artists, err := client.GetTagTopArtists(ctx, tag, c.Limit)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		out.Entries = artistEntries(artists)
+	} else {
+		tracks, err := client.GetTagTopTracks(ctx, tag, c.Limit)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		out.Entries = trackEntries(tracks)
+	}
+	return writeChart(ctx, log, c, s, out)
+}
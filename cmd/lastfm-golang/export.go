@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+func cmdExport(ctx context.Context, log logx.Logger, c config.Config, s *store.Store) int {
+	format := c.Format
+	if format == "" {
+		format = "jsonl"
+	}
+	if format != "jsonl" && format != "tsv" && format != "ics" && format != "obsidian" {
+		fmt.Fprintln(os.Stderr, "error: invalid --format for export (expected jsonl|tsv|ics|obsidian)")
+		return 2
+	}
+	if format == "obsidian" {
+		return exportNotes(ctx, log, c, s)
+	}
+
+	var w io.Writer = os.Stdout
+	if c.Out != "" {
+		f, err := os.Create(c.Out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	ics := newICSWriter(bw, time.Now())
+
+	n := 0
+	// Export is the archive: ignored artists stay in, only redaction applies.
+	filter := c.Filter
+	filter.HideIgnored = false
+	err := s.EachScrobble(ctx, filter, func(sc store.Scrobble) error {
+		n++
+		if format == "ics" {
+			return ics.add(sc)
+		}
+		if format == "tsv" {
+			_, err := fmt.Fprintf(bw, "%s\t%s\t%s\t%s\n", time.Unix(sc.PlayedAtUTS, 0).UTC().Format(time.RFC3339), sc.Artist, sc.Track, sc.Album)
+			return err
+		}
+		b, err := json.Marshal(sc)
+		if err != nil {
+			return err
+		}
+		_, err = bw.Write(append(b, '\n'))
+		return err
+	})
+	if err == nil && format == "ics" {
+		err = ics.close()
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	log.Debugf("export: wrote %d scrobbles", n)
+	return 0
+}
+
+// exportNotes writes export --format obsidian: a Markdown note per day or
+// week into the --out directory.
+func exportNotes(ctx context.Context, log logx.Logger, c config.Config, s *store.Store) int {
+	if c.Out == "" {
+		fmt.Fprintln(os.Stderr, "error: export --format obsidian needs --out <dir>")
+		return 2
+	}
+	loc := c.Location
+	if loc == nil {
+		loc = s.Location()
+	}
+	notes, err := newNotesWriter(c.Out, c.Per, loc)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 2
+	}
+	filter := c.Filter
+	filter.HideIgnored = false
+	err = s.EachScrobble(ctx, filter, notes.add)
+	if err == nil {
+		err = notes.close()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	log.Infof("export: wrote %d notes to %s, %d unchanged", notes.wrote, c.Out, notes.unchanged)
+	return 0
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// friendsLimit caps how many Last.fm friends friends looks at, as recommend
+// --algo friends does.
+const friendsLimit = 50
+
+type friendsOut struct {
+	Meta    friendsMeta      `json:"meta"`
+	Friends []friendActivity `json:"friends"`
+}
+
+type friendsMeta struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	// Tracks is how many of each friend's latest tracks were read.
+	Tracks int `json:"tracks_per_friend"`
+}
+
+// friendActivity is what one friend has been playing lately, most recently
+// active friends first.
+type friendActivity struct {
+	User          string       `json:"user"`
+	NowPlaying    *friendTrack `json:"now_playing,omitempty"`
+	LastPlayedUTS int64        `json:"last_played_uts,omitempty"`
+	// Artists are the artists in their latest tracks, most played first,
+	// with my own plays of each.
+	Artists []friendArtist `json:"artists"`
+	// Error is why their tracks couldn't be read, e.g. a private profile.
+	Error string `json:"error,omitempty"`
+}
+
+type friendTrack struct {
+	Artist string `json:"artist"`
+	Track  string `json:"track"`
+	Album  string `json:"album,omitempty"`
+}
+
+type friendArtist struct {
+	Artist             string `json:"artist"`
+	Plays              int64  `json:"plays"`
+	LocalPlays         int64  `json:"local_plays"`
+	LocalLastPlayedUTS int64  `json:"local_last_played_uts"`
+}
+
+// cmdFriends summarizes what my Last.fm friends (or --friends) have been
+// playing lately, and whether I know each artist.
+func cmdFriends(ctx context.Context, log logx.Logger, c config.Config, client *lastfm.Client, s *store.Store) int {
+	if len(c.Args) > 0 {
+		fmt.Fprintln(os.Stderr, "error: usage: friends [--friends <a,b>] [--limit <n>] [--format json|text]")
+		return 2
+	}
+	if c.Limit <= 0 || c.Limit > 200 {
+		fmt.Fprintln(os.Stderr, "error: --limit must be 1-200")
+		return 2
+	}
+	if c.Format != "" && c.Format != "json" && c.Format != "text" {
+		fmt.Fprintln(os.Stderr, "error: invalid --format (expected json|text)")
+		return 2
+	}
+
+	names := c.Friends
+	if len(names) == 0 {
+		list, err := client.GetFriends(ctx, "", friendsLimit)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		for _, f := range list {
+			names = append(names, f.Name)
+		}
+	}
+
+	out := friendsOut{Meta: friendsMeta{GeneratedAt: time.Now().UTC(), Tracks: c.Limit}, Friends: []friendActivity{}}
+	for _, name := range names {
+		tracks, err := client.GetUserRecentTracks(ctx, name, c.Limit)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, lastfm.ErrAuth) {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return 1
+			}
+			log.Infof("friends: skipping %s: %v", name, err)
+			out.Friends = append(out.Friends, friendActivity{User: name, Artists: []friendArtist{}, Error: err.Error()})
+			continue
+		}
+		a, err := friendSummary(ctx, s, name, tracks)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		out.Friends = append(out.Friends, a)
+	}
+	sort.SliceStable(out.Friends, func(i, j int) bool {
+		a, b := out.Friends[i], out.Friends[j]
+		if (a.NowPlaying != nil) != (b.NowPlaying != nil) {
+			return a.NowPlaying != nil
+		}
+		return a.LastPlayedUTS > b.LastPlayedUTS
+	})
+	log.Debugf("friends: %d", len(out.Friends))
+
+	if c.Format == "text" {
+		return writeFriendsText(out, s.Location())
+	}
+	if err := writeJSON(os.Stdout, out, c.Pretty); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// friendSummary counts the artists in a friend's latest tracks, newest
+// first, and looks up my plays of each.
+func friendSummary(ctx context.Context, s *store.Store, name string, tracks []lastfm.Track) (friendActivity, error) {
+	a := friendActivity{User: name, Artists: []friendArtist{}}
+	seen := map[string]int{} // store.NormalizeArtist -> index in a.Artists
+	for _, t := range tracks {
+		if t.Attr.NowPlaying == "true" {
+			a.NowPlaying = &friendTrack{Artist: t.Artist.Text, Track: t.Name, Album: t.Album.Text}
+			continue
+		}
+		if a.LastPlayedUTS == 0 && t.Date != nil {
+			a.LastPlayedUTS, _ = parseI64(t.Date.UTS)
+		}
+		key := store.NormalizeArtist(t.Artist.Text)
+		if i, ok := seen[key]; ok {
+			a.Artists[i].Plays++
+			continue
+		}
+		seen[key] = len(a.Artists)
+		a.Artists = append(a.Artists, friendArtist{Artist: t.Artist.Text, Plays: 1})
+	}
+	sort.SliceStable(a.Artists, func(i, j int) bool { return a.Artists[i].Plays > a.Artists[j].Plays })
+	for i := range a.Artists {
+		e := &a.Artists[i]
+		var err error
+		if e.LocalPlays, e.LocalLastPlayedUTS, err = s.LocalPlays(ctx, e.Artist, ""); err != nil {
+			return friendActivity{}, err
+		}
+	}
+	return a, nil
+}
+
+// writeFriendsText prints a line per friend, then their artists indented,
+// marking the ones I have never played.
+func writeFriendsText(out friendsOut, loc *time.Location) int {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, f := range out.Friends {
+		switch {
+		case f.Error != "":
+			fmt.Fprintf(w, "%s\t(unavailable: %s)\n", f.User, f.Error)
+		case f.NowPlaying != nil:
+			fmt.Fprintf(w, "%s\tnow playing %s - %s\n", f.User, f.NowPlaying.Artist, f.NowPlaying.Track)
+		case f.LastPlayedUTS != 0:
+			fmt.Fprintf(w, "%s\tlast played %s\n", f.User, time.Unix(f.LastPlayedUTS, 0).In(loc).Format("2006-01-02 15:04 MST"))
+		default:
+			fmt.Fprintf(w, "%s\tnothing played\n", f.User)
+		}
+		for _, a := range f.Artists {
+			known := fmt.Sprintf("%d %s of mine", a.LocalPlays, plural(int(a.LocalPlays), "play", "plays"))
+			if a.LocalPlays == 0 {
+				known = "new to me"
+			}
+			fmt.Fprintf(w, "  %s\t%d\t%s\n", a.Artist, a.Plays, known)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
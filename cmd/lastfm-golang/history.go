@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// cmdHistory lists journaled runs, newest first: history [command].
+func cmdHistory(ctx context.Context, c config.Config, s *store.Store) int {
+	if len(c.Args) > 1 {
+		fmt.Fprintln(os.Stderr, "error: usage: history [command] [--limit <n>] [--format json|text]")
+		return 2
+	}
+	if c.Format != "" && c.Format != "json" && c.Format != "text" {
+		fmt.Fprintln(os.Stderr, "error: invalid --format (expected text|json)")
+		return 2
+	}
+	command := ""
+	if len(c.Args) == 1 {
+		command = c.Args[0]
+	}
+	runs, err := s.Runs(ctx, command, c.Limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	if c.Format == "json" {
+		if runs == nil {
+			runs = []store.Run{}
+		}
+		err = writeJSON(os.Stdout, runs, c.Pretty)
+	} else {
+		err = writeRuns(os.Stdout, runs)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// writeRuns prints a tab-separated line per run: start, duration, command,
+// exit code, inserted, ignored, arguments and error. A run that never
+// finished shows "-" for its duration and exit code.
+func writeRuns(w io.Writer, runs []store.Run) error {
+	for _, r := range runs {
+		took, code := "-", "-"
+		if r.Finished() {
+			took = (time.Duration(r.EndedAtUTS-r.StartedAtUTS) * time.Second).String()
+			code = fmt.Sprint(r.ExitCode)
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			time.Unix(r.StartedAtUTS, 0).UTC().Format(time.RFC3339), took, r.Command, code, r.Inserted, r.Ignored, r.Args, r.Error); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// journaled runs fn as cmd, recording the run in the store's journal with
+// its exit code and the last error it printed. fn gets log writing to the
+// same stream as the errors, so their order holds. A journal that can't be
+// written is logged and otherwise ignored.
+func journaled(ctx context.Context, cmd string, log logx.Logger, c config.Config, s *store.Store, fn func(logx.Logger) int) int {
+	id, err := s.StartRun(ctx, cmd, runArgs(c))
+	if err != nil {
+		log.Infof("run journal: %v", err)
+		return fn(log)
+	}
+
+	stderr := os.Stderr
+	r, w, err := os.Pipe()
+	if err != nil {
+		log.Infof("run journal: %v", err)
+		return fn(log)
+	}
+	tail := &errorTail{}
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(io.MultiWriter(stderr, tail), r)
+		close(copied)
+	}()
+	os.Stderr = w
+	if log.Out == io.Writer(stderr) {
+		log.Out = w
+	}
+
+	code := fn(log)
+
+	os.Stderr = stderr
+	w.Close()
+	<-copied
+	r.Close()
+	if err := s.FinishRun(context.WithoutCancel(ctx), id, code, tail.last); err != nil {
+		fmt.Fprintln(os.Stderr, "error: run journal:", err)
+	}
+	return code
+}
+
+// runArgs summarizes a command line for the journal: the positional
+// arguments and the names of the flags given. Flag values are left out,
+// as some are keys or passwords.
+func runArgs(c config.Config) string {
+	parts := append([]string(nil), c.Args...)
+	for _, f := range c.Flags {
+		parts = append(parts, "--"+f)
+	}
+	return strings.Join(parts, " ")
+}
+
+// errorTail keeps the message of the last "error: " line written to it.
+type errorTail struct {
+	line []byte
+	last string
+}
+
+func (t *errorTail) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b != '\n' {
+			t.line = append(t.line, b)
+			continue
+		}
+		if msg, ok := bytes.CutPrefix(t.line, []byte("error: ")); ok {
+			t.last = string(msg)
+		}
+		t.line = t.line[:0]
+	}
+	return len(p), nil
+}
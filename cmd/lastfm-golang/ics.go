@@ -0,0 +1,194 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// icsWriter turns scrobbles, fed oldest first, into an iCalendar feed: one
+// all-day event per UTC day with plays and the top artist, and a timed event
+// for every milestoneStep-th scrobble. UIDs are stable, so re-importing an
+// export updates events instead of duplicating them.
+type icsWriter struct {
+	w     io.Writer
+	stamp string
+
+	day     time.Time
+	plays   int
+	artists map[string]int
+	seen    int64
+	started bool
+}
+
+func newICSWriter(w io.Writer, now time.Time) *icsWriter {
+	return &icsWriter{w: w, stamp: now.UTC().Format("20060102T150405Z"), artists: map[string]int{}}
+}
+
+func (x *icsWriter) add(sc store.Scrobble) error {
+	if !x.started {
+		x.started = true
+		if err := x.lines("BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//lastfm-golang//listening//EN",
+			"CALSCALE:GREGORIAN", "X-WR-CALNAME:Listening"); err != nil {
+			return err
+		}
+	}
+
+	t := time.Unix(sc.PlayedAtUTS, 0).UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if !day.Equal(x.day) {
+		if err := x.flushDay(); err != nil {
+			return err
+		}
+		x.day = day
+	}
+	x.plays++
+	x.artists[sc.Artist]++
+
+	x.seen++
+	if x.seen%milestoneStep == 0 {
+		return x.event(
+			fmt.Sprintf("milestone-%d@lastfm-golang", x.seen),
+			"DTSTART:"+t.Format("20060102T150405Z"),
+			"DTEND:"+t.Add(time.Minute).Format("20060102T150405Z"),
+			fmt.Sprintf("%s scrobble", ordinal(x.seen)),
+			sc.Artist+" — "+sc.Track,
+		)
+	}
+	return nil
+}
+
+func (x *icsWriter) flushDay() error {
+	if x.plays == 0 {
+		return nil
+	}
+	type artistPlays struct {
+		name  string
+		plays int
+	}
+	var top []artistPlays
+	for name, n := range x.artists {
+		top = append(top, artistPlays{name, n})
+	}
+	slices.SortFunc(top, func(a, b artistPlays) int {
+		return cmp.Or(cmp.Compare(b.plays, a.plays), cmp.Compare(a.name, b.name))
+	})
+
+	var desc strings.Builder
+	for i, a := range top[:min(len(top), 5)] {
+		if i > 0 {
+			desc.WriteString("\n")
+		}
+		fmt.Fprintf(&desc, "%s: %d", a.name, a.plays)
+	}
+	err := x.event(
+		"day-"+x.day.Format("20060102")+"@lastfm-golang",
+		"DTSTART;VALUE=DATE:"+x.day.Format("20060102"),
+		"DTEND;VALUE=DATE:"+x.day.AddDate(0, 0, 1).Format("20060102"),
+		fmt.Sprintf("%d %s, top artist: %s", x.plays, plural(x.plays, "play", "plays"), top[0].name),
+		desc.String(),
+	)
+	x.plays = 0
+	clear(x.artists)
+	return err
+}
+
+// close flushes the last day and ends the calendar; an empty export is
+// still a valid calendar.
+func (x *icsWriter) close() error {
+	if !x.started {
+		return x.lines("BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//lastfm-golang//listening//EN", "END:VCALENDAR")
+	}
+	if err := x.flushDay(); err != nil {
+		return err
+	}
+	return x.lines("END:VCALENDAR")
+}
+
+func (x *icsWriter) event(uid, start, end, summary, desc string) error {
+	return x.lines(
+		"BEGIN:VEVENT",
+		"UID:"+uid,
+		"DTSTAMP:"+x.stamp,
+		start,
+		end,
+		"SUMMARY:"+icsEscape(summary),
+		"DESCRIPTION:"+icsEscape(desc),
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+	)
+}
+
+func (x *icsWriter) lines(ls ...string) error {
+	for _, l := range ls {
+		if _, err := io.WriteString(x.w, icsFold(l)+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// icsEscape escapes TEXT values per RFC 5545 §3.3.11.
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// icsFold splits content lines longer than 75 octets, without breaking a
+// UTF-8 sequence (RFC 5545 §3.1).
+func icsFold(l string) string {
+	if len(l) <= 75 {
+		return l
+	}
+	var b strings.Builder
+	limit := 75
+	for len(l) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(l[cut]) {
+			cut--
+		}
+		b.WriteString(l[:cut])
+		b.WriteString("\r\n ")
+		l = l[cut:]
+		limit = 74 // the leading space counts
+	}
+	b.WriteString(l)
+	return b.String()
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// ordinal formats n with thousands separators and an English suffix,
+// e.g. "100,000th".
+func ordinal(n int64) string {
+	s := fmt.Sprint(n)
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return b.String() + suffix
+}
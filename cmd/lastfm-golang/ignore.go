@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+const ignoreUsage = `error: usage: ignore artist <name> | ignore track <artist> <track> | ignore rm artist|track ... | ignore list`
+
+// cmdIgnore manages the ignore list: artists or tracks (podcasts, sleep noise)
+// left out of digests, charts and recommendation seeds but kept in the data.
+func cmdIgnore(ctx context.Context, log logx.Logger, c config.Config, s *store.Store) int {
+	args := c.Args
+	if len(args) == 0 || (len(args) == 1 && args[0] == "list") {
+		ignores, err := s.Ignores(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		for _, i := range ignores {
+			kind, name := "artist", i.Artist
+			if i.Track != "" {
+				kind, name = "track", i.Artist+"\t"+i.Track
+			}
+			fmt.Fprintf(os.Stdout, "%s\t%s\t%s\n", time.Unix(i.AddedAtUTS, 0).UTC().Format(time.DateOnly), kind, name)
+		}
+		return 0
+	}
+
+	remove := args[0] == "rm"
+	if remove {
+		args = args[1:]
+	}
+	var artist, track string
+	switch {
+	case len(args) == 2 && args[0] == "artist":
+		artist = args[1]
+	case len(args) == 3 && args[0] == "track":
+		artist, track = args[1], args[2]
+	default:
+		fmt.Fprintln(os.Stderr, ignoreUsage)
+		return 2
+	}
+	if artist == "" || (args[0] == "track" && track == "") {
+		fmt.Fprintln(os.Stderr, ignoreUsage)
+		return 2
+	}
+
+	what := artist
+	if track != "" {
+		what = artist + " - " + track
+	}
+	var changed bool
+	var err error
+	if remove {
+		changed, err = s.RemoveIgnore(ctx, artist, track)
+	} else {
+		changed, err = s.AddIgnore(ctx, artist, track)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	switch {
+	case !changed && remove:
+		log.Infof("ignore: %s was not on the ignore list", what)
+		return 0
+	case !changed:
+		log.Infof("ignore: %s is already ignored", what)
+		return 0
+	case remove:
+		log.Infof("ignore: no longer ignoring %s", what)
+	default:
+		log.Infof("ignore: ignoring %s", what)
+	}
+
+	// Stored charts were built with the old list; rebuild them all.
+	if err := rechartFrom(ctx, log, s, 0); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/joshp123/lastfm-golang/internal/applemusic"
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// cmdImport loads play history from other sources, or an archive prune
+// wrote: import <kind> <file>.
+func cmdImport(ctx context.Context, log logx.Logger, c config.Config, s *store.Store) int {
+	if len(c.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "error: usage: import apple-music <Library.xml|tracks.csv>, or import archive <archive.jsonl.gz>")
+		return 2
+	}
+	kind, path := c.Args[0], c.Args[1]
+
+	switch kind {
+	case "apple-music", "itunes":
+		tracks, err := applemusic.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		plays := make([]store.ExternalPlay, 0, len(tracks))
+		var total int64
+		for _, t := range tracks {
+			p := store.ExternalPlay{
+				Source: store.SourceAppleMusic,
+				Artist: t.Artist,
+				Track:  t.Name,
+				Album:  t.Album,
+				Plays:  t.Plays,
+			}
+			if !t.LastPlayed.IsZero() {
+				p.LastPlayedUTS = t.LastPlayed.Unix()
+			}
+			if !t.Added.IsZero() {
+				p.AddedUTS = t.Added.Unix()
+			}
+			plays = append(plays, p)
+			total += t.Plays
+		}
+		n, err := s.UpsertExternalPlays(ctx, plays)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		if c.DryRun {
+			printUpserts(os.Stdout, plays)
+			log.Infof("import dry run: would store %d tracks, %d plays from %s (source=%s)", n, total, path, store.SourceAppleMusic)
+			return 0
+		}
+		log.Infof("import: %d tracks, %d plays from %s (source=%s)", n, total, path, store.SourceAppleMusic)
+		return 0
+	case "archive":
+		return importArchive(ctx, log, c, s, path)
+	default:
+		fmt.Fprintln(os.Stderr, "error: unknown import kind:", kind, "(expected apple-music or archive)")
+		return 2
+	}
+}
+
+// importArchive loads scrobbles back from an archive prune (or export)
+// wrote, each under its own source. Ones already stored are skipped.
+func importArchive(ctx context.Context, log logx.Logger, c config.Config, s *store.Store, path string) int {
+	scrobbles, err := readArchive(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	bySource := map[string][]lastfm.Track{}
+	var sources []string
+	for _, sc := range scrobbles {
+		if bySource[sc.Source] == nil {
+			sources = append(sources, sc.Source)
+		}
+		bySource[sc.Source] = append(bySource[sc.Source], lastfm.Track{
+			Name:   sc.Track,
+			MBID:   sc.TrackMBID,
+			URL:    sc.URL,
+			Artist: lastfm.TextMBID{Text: sc.Artist, MBID: sc.ArtistMBID},
+			Album:  lastfm.TextMBID{Text: sc.Album, MBID: sc.AlbumMBID},
+			Date:   &lastfm.Date{UTS: strconv.FormatInt(sc.PlayedAtUTS, 10)},
+		})
+	}
+
+	var total store.InsertResult
+	var minPlayed int64
+	for _, src := range sources {
+		res, err := s.InsertFrom(context.WithoutCancel(ctx), src, bySource[src])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		total.Inserted += res.Inserted
+		total.Ignored += res.Ignored
+		total.New = append(total.New, res.New...)
+	}
+	for _, t := range total.New {
+		if uts, err := strconv.ParseInt(t.Date.UTS, 10, 64); err == nil && (minPlayed == 0 || uts < minPlayed) {
+			minPlayed = uts
+		}
+	}
+	if c.DryRun {
+		printInserts(os.Stdout, total.New)
+		log.Infof("import dry run: would insert=%d ignored=%d from %s", total.Inserted, total.Ignored, path)
+		return 0
+	}
+	log.Infof("import: inserted=%d ignored=%d from %s", total.Inserted, total.Ignored, path)
+	if total.Inserted > 0 {
+		if err := rechartFrom(ctx, log, s, minPlayed); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+	}
+	return 0
+}
@@ -3,17 +3,26 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/joshp123/lastfm-golang/digest"
 	"github.com/joshp123/lastfm-golang/internal/config"
-	"github.com/joshp123/lastfm-golang/internal/digest"
-	"github.com/joshp123/lastfm-golang/internal/lastfm"
 	"github.com/joshp123/lastfm-golang/internal/logx"
-	"github.com/joshp123/lastfm-golang/internal/recommend"
-	"github.com/joshp123/lastfm-golang/internal/store"
+	"github.com/joshp123/lastfm-golang/internal/notify"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/recommend"
+	"github.com/joshp123/lastfm-golang/store"
 )
 
 var version = "dev"
@@ -48,14 +57,30 @@ func run(args []string) int {
 
 	req := config.Requirements{}
 	switch cmd {
-	case "backfill", "sync":
+	case "backfill", "sync", "reconcile":
 		req.RequireAPIKey = true
 		req.RequireUsername = true
-	case "recommend":
+	case "charts", "explore-tag", "compat", "friends":
+		// friends needs --user only for your friends list
 		req.RequireAPIKey = true
-		// username not required for recommend
-	case "verify", "digest":
+	case "recommend", "auth":
+		// username not required; the block list, --offline and --algo
+		// resurface are local
+		req.RequireAPIKey = cmd == "auth" || !recommendIsLocal(subArgs)
+	case "verify":
+		// local unless --remote compares with Last.fm's own charts
+		req.RequireAPIKey = verifyIsRemote(subArgs)
+		req.RequireUsername = req.RequireAPIKey
+	case "digest", "export", "report", "import", "edit", "delete", "undelete", "ignore", "rollup", "stats", "history", "diary", "on-this-day", "discovered", "artist", "analyze", "top", "prune":
 		// local only
+	case "schema":
+		// describes the outputs; no store
+	case "install-service":
+		// writes unit files; the service itself loads --env-file
+	case "doctor", "tui", "add", "repair-dates":
+		// use the api key only if one is configured
+	case "enrich":
+		// MusicBrainz needs no key
 	default:
 		fmt.Fprintln(os.Stderr, "error: unknown command:", cmd)
 		usage(os.Stderr)
@@ -67,30 +92,139 @@ func run(args []string) int {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		return 2
 	}
+	if c.DryRun && !slices.Contains(config.DryRunCommands, cmd) {
+		fmt.Fprintln(os.Stderr, "error: --dry-run works with "+strings.Join(config.DryRunCommands, ", "))
+		return 2
+	}
 	log := logx.Logger{Out: os.Stderr, Verbose: c.Verbose}
+	if c.Quiet {
+		log.Out = io.Discard
+	}
+	if cmd == "tui" {
+		// The dashboard owns the terminal; log lines go to its status bar.
+		log.Out = new(statusWriter)
+	}
+
+	if cmd == "install-service" {
+		return cmdInstallService(c)
+	}
+	if cmd == "schema" {
+		return cmdSchema(c)
+	}
+
+	notifier, err := notify.New(c.Notify)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 2
+	}
+
+	var client *lastfm.Client
+	if c.APIKey != "" {
+		client, err = newClient(c, log)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 2
+		}
+		defer logTraffic(log, client)
+	}
 
-	ctx := context.Background()
-	s, err := store.Open(ctx, store.OpenOptions{DataDir: c.DataDir})
+	// Ctrl-C / SIGTERM cancel ctx; long commands finish the page in hand,
+	// checkpoint and exit cleanly.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	s, err := store.Open(ctx, store.OpenOptions{DataDir: c.DataDir, SkipRawTracks: c.Raw == "pages", Fsync: c.Fsync, Timezone: c.Timezone, MinSaneUTS: c.MinSaneUTS, User: c.Username, DryRun: c.DryRun})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		return 1
 	}
 	defer s.Close()
+	if s.TornBytes > 0 {
+		log.Infof("raw jsonl: cut a torn final line left by a crash (%d bytes, kept in %s%s)", s.TornBytes, store.RawJSONLFile, store.TornSuffix)
+	}
 
+	// A dry run writes nothing, and history would only list itself.
+	if c.DryRun || cmd == "history" {
+		return dispatch(ctx, cmd, log, c, client, s, notifier)
+	}
+	return journaled(ctx, cmd, log, c, s, func(log logx.Logger) int {
+		return dispatch(ctx, cmd, log, c, client, s, notifier)
+	})
+}
+
+// dispatch runs cmd against the opened store.
+func dispatch(ctx context.Context, cmd string, log logx.Logger, c config.Config, client *lastfm.Client, s *store.Store, notifier notify.Notifier) int {
 	switch cmd {
 	case "backfill":
-		client := lastfm.Client{APIKey: c.APIKey, Username: c.Username, UserAgent: c.UserAgent}
-		return cmdBackfill(ctx, log, client, s)
+		return cmdBackfill(ctx, log, c, client, s)
 	case "sync":
-		client := lastfm.Client{APIKey: c.APIKey, Username: c.Username, UserAgent: c.UserAgent}
-		return cmdSync(ctx, log, client, s)
+		return cmdSync(ctx, log, c, client, s, notifier)
+	case "reconcile":
+		return cmdReconcile(ctx, log, c, client, s)
 	case "verify":
-		return cmdVerify(ctx, log, s)
+		return cmdVerify(ctx, log, c, client, s)
+	case "stats":
+		return cmdStats(ctx, c, s)
 	case "digest":
-		return cmdDigest(ctx, log, c, s)
+		return cmdDigest(ctx, log, c, s, notifier)
+	case "export":
+		return cmdExport(ctx, log, c, s)
+	case "report":
+		return cmdReport(ctx, log, c, s)
+	case "import":
+		return cmdImport(ctx, log, c, s)
+	case "add":
+		return cmdAdd(ctx, log, c, client, s)
+	case "auth":
+		return cmdAuth(ctx, log, client)
+	case "edit":
+		return cmdEdit(ctx, log, c, s)
+	case "delete":
+		return cmdDelete(ctx, log, c, s)
+	case "undelete":
+		return cmdUndelete(ctx, log, c, s)
+	case "ignore":
+		return cmdIgnore(ctx, log, c, s)
+	case "doctor":
+		return cmdDoctor(ctx, log, client, s)
+	case "tui":
+		return cmdTUI(ctx, log, client, s)
 	case "recommend":
-		client := lastfm.Client{APIKey: c.APIKey, UserAgent: c.UserAgent}
 		return cmdRecommend(ctx, log, c, client, s)
+	case "charts":
+		return cmdCharts(ctx, log, c, client, s)
+	case "explore-tag":
+		return cmdExploreTag(ctx, log, c, client, s)
+	case "compat":
+		return cmdCompat(ctx, log, c, client, s)
+	case "friends":
+		return cmdFriends(ctx, log, c, client, s)
+	case "rollup":
+		return cmdRollup(ctx, log, s)
+	case "history":
+		return cmdHistory(ctx, c, s)
+	case "diary":
+		return cmdDiary(ctx, c, s)
+	case "on-this-day":
+		return cmdOnThisDay(ctx, c, s)
+	case "discovered":
+		return cmdDiscovered(ctx, c, s)
+	case "artist":
+		return cmdArtist(ctx, c, s)
+	case "analyze":
+		return cmdAnalyze(ctx, c, s)
+	case "top":
+		return cmdTop(ctx, c, s)
+	case "repair-dates":
+		return cmdRepairDates(ctx, log, c, client, s)
+	case "enrich":
+		return cmdEnrich(ctx, log, c, s)
+	case "prune":
+		return cmdPrune(ctx, log, c, s)
 	default:
 		fmt.Fprintln(os.Stderr, "error: unknown command:", cmd)
 		usage(os.Stderr)
@@ -107,131 +241,579 @@ Usage:
 Commands:
   backfill    Fetch all scrobbles and store (raw JSONL + SQLite)
   sync        Fetch new scrobbles since the last run
-  verify      Print basic DB stats
-  digest      Print an LLM-friendly JSON digest (recent + top + yearly)
-  recommend   Print LLM-friendly JSON track candidates for discovery
+  reconcile   Re-fetch the last --window of scrobbles and tombstone those deleted or edited on Last.fm
+  stats       Summarize the library: scrobbles, artists/tracks/albums, first/last play, busiest day, file sizes
+  verify      Print basic DB stats and the last sync on one line (--remote: compare with Last.fm's own top charts)
+  doctor      Check API key, DB integrity, schema, raw log, disk space and clock
+  diary       Scrobbles of the last --days local days (default 14), newest day first, with each day's
+              plays and top artist (--format text|markdown|json)
+  on-this-day What you played on today's date 1, 5 and 10 years ago: top artists and artists first
+              heard that day (--format text|markdown|json)
+  discovered  Artists (or albums) first played in a period: discovered [artists|albums] 2020-03
+              (YYYY, YYYY-MM or YYYY-MM-DD; --limit, --format text|json)
+  artist      An artist's plays since the first listen, with a monthly sparkline: artist "Four Tet";
+              --trajectory prints plays per month as a JSON array [{"month", "plays"}]
+  analyze     analyze retention: artists by the month first played, and the share of each month's
+              still played 3, 6 and 12 months later; analyze binges: the days (--per week: weeks) one
+              artist (--unit album: album) had over --min-share (default 0.5) of, most plays first;
+              analyze completion: tracks (--unit album: albums) by plays heard to the end, judged by
+              the gap to the next scrobble and the durations sync caches (--limit, --format text|json)
+  top         Your all-time top artists (or tracks): top [artists|tracks] [--by plays|affinity]; affinity
+              weighs recent plays over old, the years listened and loved tracks (--limit, --format text|json)
+  digest      Print an LLM-friendly JSON digest (recent + top + rise/fall + yearly)
+  recommend   Print LLM-friendly JSON track candidates for discovery; recommend block-artist <name> hides an artist
+  charts      Global or country top artists/tracks with your play counts: charts [artists|tracks] [--country <name>]
+  explore-tag A tag's top artists/tracks with your play counts: explore-tag "dungeon synth" [artists|tracks]
+  friends     What your Last.fm friends (or --friends) played lately, with your plays of each artist
+  compat      Taste compatibility with another Last.fm user: shared artists and a 0-100 score
+  export      Write stored scrobbles as JSONL, TSV, iCalendar (oldest first) or Markdown notes (--format obsidian)
+  add         Record plays that never reached Last.fm (vinyl, concerts); --submit also scrobbles them
+  edit        Correct artist/track/album on stored scrobbles (audited); "edit log" lists changes
+  delete      Tombstone stored scrobbles matching --uts/--artist/--track/--album (kept, but left out of
+              everything); "delete list" lists tombstones with why they were set
+  repair-dates Date scrobbles stored with Last.fm's placeholder dates (before --min-sane-date): from
+              Last.fm if it now has the play dated, else between the scrobbles stored either side;
+              recorded in "edit log" (--offline: interpolate only; --dry-run, --format text|json)
+  enrich      Look up the artist and album MBIDs of stored scrobbles on MusicBrainz: artists' countries
+              and albums' first release years, for the digest's countries and decades sections, and
+              whether an album is live, remixes or demos, for --versions (at most --limit of each per
+              run, one a second; run again for more)
+  undelete    Restore tombstoned scrobbles matching the same flags, or "undelete all"
+  prune       Drop scrobbles played --before a date (or from one --source) from the database for good,
+              archived first to --export-first <file.jsonl.gz>; "import archive <file>" loads them back
+  ignore      Leave an artist or track out of digests and charts: ignore artist <name>, ignore list
+  auth        Authorize scrobble submission and print a session key
+  import      Import play counts: import apple-music <Library.xml|tracks.csv>; or scrobbles prune or
+              export archived: import archive <file.jsonl[.gz]>
+  report      Write a self-contained HTML stats page to --out <dir>
+  install-service Write systemd user units that run sync every --interval (needs --env-file)
+  history     List past runs, newest first: history [command] (start, duration, command, exit code,
+              inserted, ignored, flags, error)
+  schema      Print the JSON Schema of the digest, comparison (digest --compare) or recommend output:
+              schema [digest|comparison|recommend]; all three keyed by name without one
+  rollup      Recount the daily play totals digests read (they are kept current on every write)
+  tui         Interactive dashboard: now playing, recent, top artists, sync
   version     Print version
 
 Flags (common):
   --env-file <path>         Load env vars from a file (or set LASTFM_ENV_FILE)
   --api-key <key>           Last.fm API key (or set LASTFM_API_KEY)
   --shared-secret <secret>  Last.fm shared secret (optional; or set LASTFM_SHARED_SECRET)
-  --user <username>         Last.fm username (or set LASTFM_USERNAME)
+  --session-key <key>       Last.fm session key for --submit (or set LASTFM_SESSION_KEY; see auth)
+  --user <username>         Last.fm username (or set LASTFM_USERNAME); in a data dir shared by several
+                            accounts, also whose scrobbles, state and lists every command uses
   --data-dir <path>         Data directory (default: XDG data dir)
-  --verbose                 Verbose logging (prints per-page progress)
+  --timezone <zone>         Home time zone whose days and years stats count in, e.g. Europe/Amsterdam
+                            (or set LASTFM_TIMEZONE; remembered by the store; default UTC)
+  --min-sane-date <day>     Scrobbles dated before this day (YYYY-MM-DD, UTC) are placeholders: suspect,
+                            and left out of stats (or set LASTFM_MIN_SANE_DATE; remembered by the store;
+                            default 2000-01-01)
+  --raw tracks|pages|both   Backfill/sync: what to archive verbatim (default tracks: one
+                            JSONL line per new scrobble; pages: each whole recent-tracks
+                            response, gzip'd in recenttracks.pages.jsonl.gz)
+  --page-size <n>           Backfill/sync: scrobbles per page, up to 1000 (default 200, the documented
+                            maximum); larger pages are halved after a failed page, or cut to what the
+                            API serves
+  --window <span>           Reconcile: how far back to compare with Last.fm, e.g. 7d or 8w (default 30d)
+  --fsync                   Backfill/sync: sync the raw archives to disk after every page
+                            (default: only at exit; slower, but survives power loss)
+  --http-cache              Cache slow-changing Last.fm responses on disk (artist/track data for days,
+                            charts for an hour; never recent tracks)
+  --record-http <dir>       Record Last.fm API traffic into a cassette directory (e.g. for a bug
+                            report; API keys and session keys are left out)
+  --replay-http <dir>       Answer Last.fm API calls from a recorded cassette, offline and without a key
+  --verbose                 Verbose logging (per-page progress, every Last.fm request with keys redacted,
+                            and the bytes downloaded)
+  --quiet                   No log lines, only errors
+  --dry-run                 Print each scrobble that would be inserted or changed (TSV, led by insert/
+                            upsert/edit/tombstone/restore/prune/enrich) and write nothing; works with
+                            `+strings.Join(config.DryRunCommands, ", ")+`
+  --summary-json            Sync: print one JSON line (status, inserted, ignored, duration_ms, errors) and
+                            exit 0 synced, 3 nothing new, 1 failed, 124 timed out
   --user-agent <ua>         HTTP User-Agent
-  --format <fmt>            Output format for digest/recommend (json|tsv)
+  --api-base-url <url>      Last.fm-compatible API root (or set LASTFM_API_BASE_URL)
+  --musicbrainz-url <url>   MusicBrainz API root for enrich (or set LASTFM_MUSICBRAINZ_URL)
+  --rate-limit <dur>        Minimum spacing between API requests (default 200ms)
+  --timeout <dur>           Give up after this long, e.g. 10m, so a cron backfill, sync or recommend can't
+                            hang on a wedged connection; exits 124 (a retry that can't finish in time
+                            isn't waited for)
+  --format <fmt>            Output format for digest/recommend/charts/export/stats (json|jsonl|tsv|ics|obsidian|text)
   --pretty                  Pretty-print JSON output
+  --out <path>              Output path for export (default: stdout) or report/obsidian directory
+  --per day|week            Export --format obsidian: one note per local day (2006-01-02.md, default) or
+                            ISO week (2006-W01.md)
+  --algo <name>             Recommend seeds: artists (similar artists' top tracks), tracks (similar tracks)
+                            friends (what friends play heavily that you don't), tag (a tag's top artists,
+                            see --tag) or resurface (your own old favorites, from local data only)
+  --unit <track|album>      Recommend tracks (default) or never-played albums by the candidate artists
+  --tag <name>              Seed recommend from a Last.fm tag's top artists instead of your history
+  --friends <a,b>           Users to mine for --algo friends (or set LASTFM_FRIENDS; default: your friends)
+  --weights <k=v,...>       Recommend score weights: similarity, tags, recency, novelty (default 0.6,0.2,0.1,0.1)
+                            and obscurity (default 0; favors artists with few Last.fm listeners)
+  --max-per-artist <n>      Most recommended tracks per artist (default 3; 0 for no cap)
+  --diversity <0-1>         Reorder recommendations for variety (maximal marginal relevance over artist tags)
+  --seed <n|day|random>     Shuffle near-equal recommendations; the same seed repeats a run (meta.seed)
+  --no-repeat <span>        Leave out tracks recommended within e.g. 30d or 2w (every run is saved)
+  --offline                 Recommend from cached Last.fm data only (no API key needed)
+
+Sync and install-service:
+  --healthcheck-url <url>   Ping after each sync, <url>/fail if it failed, e.g. a healthchecks.io check
+                            (or set LASTFM_HEALTHCHECK_URL)
+  --interval <span>         How often the installed timer runs sync (default 1h)
+  --out <dir>               Where install-service writes its units (default ~/.config/systemd/user)
+  --email                   Also install a timer mailing the digest every Monday at 08:00
+
+Verify:
+  --format json             One JSON object (counts, and remote checks with their diverging entries)
+  --remote                  Also compare all-time and 12-month top artists, tracks and albums with
+                            Last.fm's own counts; exits 1 if any differ by more than 2 plays (or 2%)
+  --limit <n>               Entries to check per chart (default 50)
+
+Charts and explore-tag:
+  --country <name>          Country chart (ISO 3166-1 name, e.g. netherlands; default: global)
+  --limit <n>               Entries to show (default 50)
+
+Friends:
+  --friends <a,b>           Users to look at instead of your Last.fm friends
+  --limit <n>               Latest tracks to read per friend (default 50, at most 200)
+  --format <json|text>      JSON (default) or a line per friend with their artists indented
+
+Compat:
+  --other-user <name>       Last.fm user to compare with (required)
+  --limit <n>               Their top artists to fetch, and mine to score against (default 50)
+  --format <json|markdown>  JSON report (default) or a Markdown one with tables
+
+Add:
+  --artist <name>           Artist (required)
+  --track <name>            Track (required)
+  --album <name>            Album
+  --at <time>               Local start time, "YYYY-MM-DD HH:MM" (default: now)
+  --count <n>               Back-to-back plays, spaced 4 minutes apart (default 1)
+  --submit                  Also scrobble to Last.fm (only plays from the last 14 days are accepted)
+
+Edit, delete and undelete:
+  --uts <n>                 Match one scrobble by played_at_uts
+  --artist/--track/--album  Match exact values (all given must match)
+  --glob                    Treat the match values as globs (* and ?, case-sensitive)
+  --set-artist <name>       Edit: new artist
+  --set-track <name>        Edit: new track
+  --set-album <name>        Edit: new album
+
+Prune:
+  --before <date>           Drop scrobbles played before a UTC date (YYYY-MM-DD); backfill and reconcile
+                            won't fetch them again
+  --source <name>           Drop only scrobbles from this source (lastfm_api, manual, import_csv, ...)
+  --export-first <file>     Archive them here first as export's JSONL, gzipped if it ends in .gz; the file
+                            must not exist (required unless --dry-run)
+
+Digest, report and diary:
+  --tz <zone>               Count "today" and the 30d/365d windows in this zone for this run, and give
+                            recent plays' times in it (default: the store's --timezone)
+  --days <n>                Diary: local days to cover, today included (default 14)
+  --users <a,b>             Digest: compare these users of the data dir over 365 days (shared artists,
+                            overlap_pct, artists only one of them plays)
+  --merged                  Digest --users as one household: everyone's plays in one digest
+  --albums-across-artists   Count digest albums by title across artists, so a compilation scrobbled under
+                            each track's artist charts once as "Various Artists" (album MBIDs keep
+                            same-titled albums apart)
+  --format <json|markdown|html>
+                            Digest as JSON (default), or its headline lists as Markdown or an HTML page
+  --email                   Mail the digest (HTML with a Markdown text part) using the LASTFM_SMTP_* and
+                            LASTFM_NOTIFY_EMAIL_* settings instead of printing it
+  --sections <a,b,...>      Build only these digest sections (top, recent, rise_and_fall, resurface, discoveries,
+                            yearly, signature, seasonal, on_this_day, obscurity, countries, decades, extensions);
+                            the rest aren't queried
+  --exclude <a,b,...>       Build every digest section but these
+  --encoding <json|columnar>
+                            Digest JSON with each list of objects as {"columns": [...], "rows": [[...]]},
+                            about half the size; missing fields are null
+  --max-bytes <n>           Trim the JSON digest to at most n bytes (about 4 per LLM token): lists are
+                            halved down to 5 entries, least important section first, then emptied;
+                            meta.trimmed names the sections cut
+  --priority <a,b,...>      Sections --max-bytes keeps longest, most important first (default
+                            top,recent,rise_and_fall,resurface,discoveries,yearly,signature,seasonal,on_this_day,
+                            obscurity,countries,decades,extensions)
+  --no-cache                Rebuild the digest even if no scrobbles, edits or ignores changed since the
+                            cached one (it is reused until then, or until the day ends)
+  --schema-version <n>      Write digest or recommend JSON in an older shape (meta.schema_version; default
+                            the current one)
+
+Versions (top, digest, recommend):
+  --versions <mode>         Live recordings, remixes and demos, told by their title, their album's or (after
+                            enrich) MusicBrainz's type: include (default), exclude, or fold into the studio
+                            track; for all kinds, or per kind: live=exclude,remix=fold
+
+Redaction (export, digest, report):
+  --redact-after <date>     Exclude scrobbles on or after a UTC date (YYYY-MM-DD)
+  --redact-before <date>    Exclude scrobbles before a UTC date
+  --redact-range <a..b>     Exclude a UTC date range, end exclusive (repeatable)
+  --redact-artist <name>    Exclude an artist (repeatable)
+  --notify <list>           Notify on sync failure, milestones, new artists, the daily top track and digests
+                            (stderr,desktop,webhook,email,mqtt,discord,telegram; LASTFM_NOTIFY_EVENTS picks events)
 
 Help:
   lastfm-golang --help
 `)
 }
 
-func cmdBackfill(ctx context.Context, log logx.Logger, client lastfm.Client, s *store.Store) int {
-	const limit = 200
-	page := 1
+// Checkpoints let an interrupted run pick up where it stopped.
+const (
+	backfillCheckpointKey = "backfill.before_uts"
+	syncCheckpointKey     = "sync.stop_at_uts"
+)
+
+// legacyBackfillCheckpointKey held the next page number, which shifted as
+// new scrobbles came in; a backfill left at one starts over.
+const legacyBackfillCheckpointKey = "backfill.next_page"
+
+// syncLastKey records when a sync last completed (RFC 3339).
+const syncLastKey = "sync.last_success_at"
+
+// dailyTopKey records the last local date (YYYY-MM-DD) whose top track was
+// announced.
+const dailyTopKey = "notify.daily_top_date"
+
+// httpCacheDir holds --http-cache entries, under the data dir.
+const httpCacheDir = "http-cache"
+
+// exitInterrupted is the conventional exit status after SIGINT.
+const exitInterrupted = 130
+
+// exitTimedOut is the exit status when --timeout ran out, as timeout(1)
+// uses.
+const exitTimedOut = 124
+
+// stopped describes how a cancelled ctx ended, for "<command> <how>" log
+// lines, and the status to exit with.
+func stopped(ctx context.Context) (string, int) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "timed out", exitTimedOut
+	}
+	return "interrupted", exitInterrupted
+}
+
+// exitNothingNew is sync --summary-json's status when it found no new
+// scrobbles; 0 then means some were stored.
+const exitNothingNew = 3
+
+func cmdBackfill(ctx context.Context, log logx.Logger, c config.Config, client *lastfm.Client, s *store.Store) int {
+	// Backfill walks back in time from the newest scrobble, or from the
+	// played-before cursor an interrupted run left, so scrobbles arriving
+	// meanwhile don't shift what is left to fetch.
+	var before int64
+	if v, err := s.GetState(ctx, backfillCheckpointKey); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	} else if v != "" {
+		if before, err = parseI64(v); err != nil {
+			fmt.Fprintln(os.Stderr, "error: bad backfill checkpoint:", err)
+			return 1
+		}
+		log.Infof("backfill: resuming before %s", time.Unix(before, 0).UTC().Format(time.RFC3339))
+	}
+	if v, err := s.GetState(ctx, legacyBackfillCheckpointKey); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	} else if v != "" {
+		log.Infof("backfill: checkpoint from an older version; starting over from the newest scrobble (stored ones are skipped)")
+		if err := s.DeleteState(ctx, legacyBackfillCheckpointKey); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+	}
+	// History prune dropped isn't fetched again.
+	pruned, err := s.PrunedBefore(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	size := c.PageSize
 	totalPages := -1
+	pages := 0
 	inserted := 0
 	ignored := 0
-	lastProgress := time.Now()
+	started := time.Now()
+	lastProgress := started
+
+	// On a terminal, show a live status line; otherwise (cron, pipes) fall
+	// back to periodic log lines.
+	var bar *logx.Progress
+	if !log.Verbose && logx.IsTerminal(log.Out) {
+		bar = logx.NewProgress(log.Out)
+		log.Out = bar
+		defer bar.Done()
+	}
 
-	for {
-		p, err := getPageWithRetry(ctx, log, client, page, limit)
+	for p, err := range client.RecentTrackPagesBefore(ctx, lastfm.RecentTracksOptions{Limit: size, KeepRaw: c.Raw != "tracks"}, before) {
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "error:", err)
+			if ctx.Err() != nil {
+				how, code := stopped(ctx)
+				log.Infof("backfill %s after %d pages (inserted=%d ignored=%d); rerun backfill to resume", how, pages, inserted, ignored)
+				return code
+			}
+			printLastfmError(err)
 			return 1
 		}
+		if p.PerPage != size {
+			log.Infof("backfill: page size %d -> %d", size, p.PerPage)
+			size, totalPages = p.PerPage, -1
+		}
 		if totalPages == -1 {
-			totalPages = p.TotalPages
-			if totalPages == 0 {
-				totalPages = 1
-			}
+			// Total counts the scrobbles before the cursor, so this is
+			// what is left from here on.
+			totalPages = pages + max(p.TotalPages, 1)
 			log.Infof("backfill: total scrobbles=%d totalPages=%d", p.Total, totalPages)
 		}
 
-		if len(p.Tracks) == 0 {
-			break
+		// A fetched page is always stored and checkpointed, even if we were
+		// interrupted meanwhile; the next fetch notices the cancellation.
+		wctx := context.WithoutCancel(ctx)
+		res, err := s.InsertPage(wctx, p.Tracks)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
 		}
-
-		for _, t := range p.Tracks {
-			res, err := s.InsertScrobble(ctx, t)
-			if err != nil {
+		if p.Raw != nil {
+			if err := s.AppendRawPage(p); err != nil {
 				fmt.Fprintln(os.Stderr, "error:", err)
 				return 1
 			}
-			if res.Inserted > 0 {
-				// Store raw once per unique scrobble; avoids ballooning JSONL on reruns.
-				if err := s.AppendRaw(t); err != nil {
-					fmt.Fprintln(os.Stderr, "error:", err)
-					return 1
-				}
-			}
-			inserted += res.Inserted
-			ignored += res.Ignored
 		}
-		if err := s.RawJSONLBuf.Flush(); err != nil {
+		if c.DryRun {
+			printInserts(os.Stdout, res.New)
+		}
+		inserted += res.Inserted
+		ignored += res.Ignored
+		pages++
+		totalPages = max(totalPages, pages)
+		if err := s.SetState(wctx, backfillCheckpointKey, strconv.FormatInt(p.Next, 10)); err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
 			return 1
 		}
 
-		log.Debugf("backfill: page %d/%d (inserted=%d ignored=%d)", page, totalPages, inserted, ignored)
-		if !log.Verbose && time.Since(lastProgress) > 15*time.Second {
-			log.Infof("backfill: page %d/%d (inserted=%d ignored=%d)", page, totalPages, inserted, ignored)
+		log.Debugf("backfill: page %d/%d (inserted=%d ignored=%d)", pages, totalPages, inserted, ignored)
+		if bar != nil {
+			elapsed := time.Since(started)
+			bar.Update("backfill %s %d/%d pages  %d scrobbles  %.0f/s  ETA %s",
+				logx.Bar(pages, totalPages, 24), pages, totalPages, inserted+ignored,
+				float64(inserted+ignored)/elapsed.Seconds(), logx.ETA(pages, totalPages, elapsed))
+		} else if !log.Verbose && time.Since(lastProgress) > 15*time.Second {
+			log.Infof("backfill: page %d/%d (inserted=%d ignored=%d)", pages, totalPages, inserted, ignored)
 			lastProgress = time.Now()
 		}
-
-		if totalPages != -1 && page >= totalPages {
+		if p.Next <= pruned {
 			break
 		}
-		page++
-		time.Sleep(250 * time.Millisecond)
 	}
 
+	if bar != nil {
+		bar.Done()
+	}
+	if c.DryRun {
+		log.Infof("backfill dry run: would insert=%d ignored=%d", inserted, ignored)
+		return 0
+	}
 	log.Infof("backfill done: inserted=%d ignored=%d", inserted, ignored)
+	if err := s.DeleteState(ctx, backfillCheckpointKey); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	// Backfill can land history before the rank-history cursor, so chart from scratch.
+	days, err := s.RebuildArtistRankHistory(ctx, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	log.Infof("rank history: charted %d days", days)
 	return 0
 }
 
-func cmdSync(ctx context.Context, log logx.Logger, client lastfm.Client, s *store.Store) int {
-	const limit = 200
-	maxSeen, err := s.MaxPlayedAtUTS(ctx)
+// syncSummary is the line sync --summary-json prints, whatever happened.
+type syncSummary struct {
+	Status     string   `json:"status"` // synced, nothing_new, failed or interrupted
+	Inserted   int      `json:"inserted"`
+	Ignored    int      `json:"ignored"`
+	DurationMS int64    `json:"duration_ms"`
+	Errors     []string `json:"errors"`
+}
+
+func cmdSync(ctx context.Context, log logx.Logger, c config.Config, client *lastfm.Client, s *store.Store, n notify.Notifier) int {
+	start := time.Now()
+	// A dry run lists what it would insert (unless stdout is the summary
+	// line's) and stops there: no pings, notifications or rank history.
+	var list io.Writer
+	if c.DryRun {
+		n = nil
+		if !c.SummaryJSON {
+			list = os.Stdout
+		}
+	}
+	sum := syncSummary{Errors: []string{}}
+	// done ends the sync with code, also printing the summary line when
+	// asked for. --summary-json tells a sync that found nothing new apart
+	// from one that stored scrobbles.
+	done := func(code int, err error) int {
+		if err != nil {
+			sum.Errors = append(sum.Errors, err.Error())
+		}
+		switch {
+		case code == exitInterrupted:
+			sum.Status = "interrupted"
+		case code == exitTimedOut:
+			sum.Status = "timed_out"
+		case code != 0:
+			sum.Status = "failed"
+		case sum.Inserted == 0:
+			sum.Status = "nothing_new"
+			if c.SummaryJSON {
+				code = exitNothingNew
+			}
+		default:
+			sum.Status = "synced"
+		}
+		sum.DurationMS = time.Since(start).Milliseconds()
+		if c.HealthcheckURL != "" && code != exitInterrupted && !c.DryRun {
+			body, _ := json.Marshal(sum)
+			ok := sum.Status == "synced" || sum.Status == "nothing_new"
+			if err := pingHealthcheck(ctx, c.HealthcheckURL, ok, body); err != nil {
+				log.Infof("%v", err)
+				sum.Errors = append(sum.Errors, err.Error())
+			}
+		}
+		if c.SummaryJSON {
+			if err := writeJSON(os.Stdout, sum, false); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+			}
+		}
+		return code
+	}
+
+	before, _, _, err := s.Stats(ctx)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
-		return 1
+		return done(1, err)
+	}
+	newSince, err := s.MaxPlayedAtUTS(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return done(1, err)
+	}
+
+	sum.Inserted, sum.Ignored, err = syncRecent(ctx, log, client, s, c.PageSize, c.Raw != "tracks", list)
+	if err != nil && ctx.Err() != nil {
+		how, code := stopped(ctx)
+		log.Infof("sync %s (inserted=%d ignored=%d); rerun sync to finish", how, sum.Inserted, sum.Ignored)
+		if code == exitTimedOut {
+			notifyEvent(context.WithoutCancel(ctx), log, n, notify.Event{Kind: notify.EventSyncFailed, Title: "sync timed out", Message: fmt.Sprintf("sync gave up after --timeout %s", c.Timeout)})
+		}
+		return done(code, err)
+	}
+	if err != nil {
+		printLastfmError(err)
+		notifyEvent(ctx, log, n, notify.Event{Kind: notify.EventSyncFailed, Title: "sync failed", Message: err.Error()})
+		return done(1, err)
+	}
+	if c.DryRun {
+		log.Infof("sync dry run: would insert=%d ignored=%d", sum.Inserted, sum.Ignored)
+		return done(0, nil)
+	}
+	log.Infof("sync done: inserted=%d ignored=%d", sum.Inserted, sum.Ignored)
+
+	days, err := s.UpdateArtistRankHistory(ctx, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return done(1, err)
+	}
+	log.Debugf("rank history: charted %d days", days)
+
+	// Listener counts for the digest's obscurity section; not worth
+	// failing a sync over.
+	if err := recommend.RefreshArtistInfo(ctx, s.DB, client, s.User(), 50); err != nil {
+		log.Infof("artist info: %v", err)
+		sum.Errors = append(sum.Errors, "artist info: "+err.Error())
+	}
+	// Track durations, for analyze completion.
+	if err := recommend.RefreshTrackInfo(ctx, s.DB, client, s.User(), 100); err != nil {
+		log.Infof("track info: %v", err)
+		sum.Errors = append(sum.Errors, "track info: "+err.Error())
+	}
+	// Loved tracks and affinity scores, for top and recommend --by affinity.
+	if err := syncAffinity(ctx, client, s); err != nil {
+		log.Infof("affinity: %v", err)
+		sum.Errors = append(sum.Errors, "affinity: "+err.Error())
+	}
+
+	after := before + int64(sum.Inserted)
+	if m := milestoneCrossed(before, after); m > 0 {
+		notifyEvent(ctx, log, n, notify.Event{
+			Kind:    notify.EventMilestone,
+			Title:   fmt.Sprintf("%d scrobbles", m),
+			Message: fmt.Sprintf("Your library passed %d scrobbles (now %d).", m, after),
+			Data:    map[string]any{"milestone": m, "scrobbles_total": after},
+		})
+	}
+	// A first sync makes every artist new; that's no discovery.
+	if n != nil && before > 0 && sum.Inserted > 0 {
+		if err := announceNewArtists(ctx, log, s, n, newSince+1); err != nil {
+			log.Infof("notify: %v", err)
+		}
+	}
+	if n != nil {
+		if err := announceDailyTop(ctx, log, s, n, time.Now()); err != nil {
+			log.Infof("notify: %v", err)
+		}
+	}
+	return done(0, nil)
+}
+
+// syncRecent fetches pages of pageSize scrobbles newest-first until it reaches scrobbles already
+// stored. The stop boundary is checkpointed until the sync completes: pages
+// are stored newest first, so after an interruption the newest stored
+// scrobble no longer marks where the gap ends. With rawPages, fetched pages
+// are archived whole too, and new scrobbles are listed to list if not nil.
+func syncRecent(ctx context.Context, log logx.Logger, client *lastfm.Client, s *store.Store, pageSize int, rawPages bool, list io.Writer) (inserted, ignored int, err error) {
+	var maxSeen int64
+	if v, err := s.GetState(ctx, syncCheckpointKey); err != nil {
+		return 0, 0, err
+	} else if v != "" {
+		maxSeen, _ = parseI64(v)
+		log.Infof("sync: resuming interrupted sync")
+	} else {
+		if maxSeen, err = s.MaxPlayedAtUTS(ctx); err != nil {
+			return 0, 0, err
+		}
+		if err := s.SetState(ctx, syncCheckpointKey, strconv.FormatInt(maxSeen, 10)); err != nil {
+			return 0, 0, err
+		}
 	}
 	log.Infof("sync: max_played_at_uts=%d", maxSeen)
 
-	page := 1
-	inserted := 0
-	ignored := 0
-	stop := false
 	lastProgress := time.Now()
 
-	for {
-		p, err := getPageWithRetry(ctx, log, client, page, limit)
+	for p, err := range client.RecentTrackPages(ctx, lastfm.RecentTracksOptions{Limit: pageSize, KeepRaw: rawPages}) {
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "error:", err)
-			return 1
-		}
-		if len(p.Tracks) == 0 {
-			break
+			return inserted, ignored, err
 		}
 
-		for _, t := range p.Tracks {
-			res, err := s.InsertScrobble(ctx, t)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, "error:", err)
-				return 1
-			}
-			if res.Inserted > 0 {
-				if err := s.AppendRaw(t); err != nil {
-					fmt.Fprintln(os.Stderr, "error:", err)
-					return 1
-				}
+		res, err := s.InsertPage(context.WithoutCancel(ctx), p.Tracks)
+		if err != nil {
+			return inserted, ignored, err
+		}
+		if p.Raw != nil {
+			if err := s.AppendRawPage(p); err != nil {
+				return inserted, ignored, err
 			}
-			inserted += res.Inserted
-			ignored += res.Ignored
+		}
+		if list != nil {
+			printInserts(list, res.New)
+		}
+		inserted += res.Inserted
+		ignored += res.Ignored
 
+		stop := false
+		for _, t := range p.Tracks {
 			if t.Date != nil && t.Date.UTS != "" {
 				uts, err := parseI64(t.Date.UTS)
 				if err == nil && maxSeen != 0 && uts <= maxSeen {
@@ -239,103 +821,422 @@ func cmdSync(ctx context.Context, log logx.Logger, client lastfm.Client, s *stor
 				}
 			}
 		}
-		if err := s.RawJSONLBuf.Flush(); err != nil {
-			fmt.Fprintln(os.Stderr, "error:", err)
-			return 1
-		}
 
-		log.Debugf("sync: page %d (inserted=%d ignored=%d)", page, inserted, ignored)
+		log.Debugf("sync: page %d (inserted=%d ignored=%d)", p.Page, inserted, ignored)
 		if !log.Verbose && time.Since(lastProgress) > 15*time.Second {
-			log.Infof("sync: page %d (inserted=%d ignored=%d)", page, inserted, ignored)
+			log.Infof("sync: page %d (inserted=%d ignored=%d)", p.Page, inserted, ignored)
 			lastProgress = time.Now()
 		}
 		if stop {
 			break
 		}
-		page++
-		time.Sleep(250 * time.Millisecond)
 	}
+	if err := s.SetState(ctx, syncLastKey, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return inserted, ignored, err
+	}
+	return inserted, ignored, s.DeleteState(ctx, syncCheckpointKey)
+}
+
+// printLastfmError prints err with a hint for the Last.fm failures a user
+// can do something about.
+func printLastfmError(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	var hint string
+	switch {
+	case errors.Is(err, lastfm.ErrAuth):
+		hint = "check the API key (--api-key or LASTFM_API_KEY); lastfm-golang doctor tests it"
+	case errors.Is(err, lastfm.ErrUserNotFound):
+		hint = "check the username (--user or LASTFM_USERNAME)"
+	case errors.Is(err, lastfm.ErrRateLimited), errors.Is(err, lastfm.ErrUnavailable):
+		hint = "Last.fm is busy or down; try again later (progress so far is kept)"
+	}
+	if hint != "" {
+		fmt.Fprintln(os.Stderr, "hint:", hint)
+	}
+}
+
+// milestoneStep is the scrobble count interval worth celebrating.
+const milestoneStep = 10000
 
-	log.Infof("sync done: inserted=%d ignored=%d", inserted, ignored)
+// milestoneCrossed returns the highest multiple of 10,000 scrobbles passed
+// going from before to after, or 0.
+func milestoneCrossed(before, after int64) int64 {
+	if after/milestoneStep > before/milestoneStep {
+		return after / milestoneStep * milestoneStep
+	}
 	return 0
 }
 
-func cmdVerify(ctx context.Context, log logx.Logger, s *store.Store) int {
-	_ = log // reserved for future diagnostics
+// announceNewArtists notifies of the artists first played at or after since.
+func announceNewArtists(ctx context.Context, log logx.Logger, s *store.Store, n notify.Notifier, since int64) error {
+	artists, err := s.NewArtists(ctx, store.Filter{HideIgnored: true}, since, 10)
+	if err != nil || len(artists) == 0 {
+		return err
+	}
+	names := make([]string, len(artists))
+	for i, a := range artists {
+		names[i] = a.Artist
+	}
+	notifyEvent(ctx, log, n, notify.Event{
+		Kind:    notify.EventNewArtists,
+		Title:   fmt.Sprintf("%d new %s", len(names), plural(len(names), "artist", "artists")),
+		Message: "First plays of " + strings.Join(names, ", ") + ".",
+		Data:    map[string]any{"artists": names},
+	})
+	return nil
+}
 
-	const minSaneUTS = 946684800 // 2000-01-01; Last.fm can return 1970 placeholders for unknown timestamps.
+// announceDailyTop notifies of the previous local day's most played track,
+// once per day.
+func announceDailyTop(ctx context.Context, log logx.Logger, s *store.Store, n notify.Notifier, now time.Time) error {
+	y, m, d := now.In(s.Location()).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, s.Location())
+	yesterday := today.AddDate(0, 0, -1)
+	day := yesterday.Format("2006-01-02")
+	if last, err := s.GetState(ctx, dailyTopKey); err != nil || last == day {
+		return err
+	}
+	top, err := s.TopTracks(ctx, store.Filter{HideIgnored: true}, store.TimeRange{From: yesterday.Unix(), To: today.Unix()}, 1)
+	if err != nil {
+		return err
+	}
+	if len(top) > 0 {
+		t := top[0]
+		notifyEvent(ctx, log, n, notify.Event{
+			Kind:    notify.EventDailyTop,
+			Title:   "top track of " + day,
+			Message: fmt.Sprintf("%s - %s (%d %s)", t.Artist, t.Track, t.Plays, plural(int(t.Plays), "play", "plays")),
+			Data:    map[string]any{"date": day, "artist": t.Artist, "track": t.Track, "plays": t.Plays},
+		})
+	}
+	return s.SetState(ctx, dailyTopKey, day)
+}
 
-	count, minUTS, maxUTS, err := s.Stats(ctx)
+func notifyEvent(ctx context.Context, log logx.Logger, n notify.Notifier, e notify.Event) {
+	if n == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	if err := n.Notify(ctx, e); err != nil {
+		log.Infof("notify: %v", err)
+	}
+}
+
+func cmdVerify(ctx context.Context, log logx.Logger, c config.Config, client *lastfm.Client, s *store.Store) int {
+	_ = log // reserved for future diagnostics
+	if c.Format != "" && c.Format != "json" && c.Format != "text" {
+		fmt.Fprintln(os.Stderr, "error: invalid --format (expected text|json)")
+		return 2
+	}
+
+	all, err := s.CountByRange(ctx, store.Filter{}, store.TimeRange{})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		return 1
 	}
-
-	var suspectCount int64
-	if err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM scrobbles WHERE played_at_uts < ?`, minSaneUTS).Scan(&suspectCount); err != nil {
+	suspect, err := s.SuspectCount(ctx, store.Filter{})
+	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		return 1
 	}
-
-	var datedCount int64
-	var datedMin sql.NullInt64
-	var datedMax sql.NullInt64
-	if err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*), MIN(played_at_uts), MAX(played_at_uts) FROM scrobbles WHERE played_at_uts >= ?`, minSaneUTS).Scan(&datedCount, &datedMin, &datedMax); err != nil {
+	// Last.fm can return 1970 placeholders for unknown timestamps.
+	dated, err := s.CountByRange(ctx, store.Filter{}, store.TimeRange{From: s.MinSaneUTS()})
+	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		return 1
 	}
+	out := verifyOut{
+		ScrobblesTotal:   all.Count,
+		ScrobblesDated:   dated.Count,
+		ScrobblesSuspect: suspect,
+		MinUTS:           all.MinUTS,
+		MaxUTS:           all.MaxUTS,
+		DatedMinUTS:      dated.MinUTS,
+		DatedMaxUTS:      dated.MaxUTS,
+	}
+	last, err := s.LastRun(ctx, "sync")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	lastOK, err := s.LastRun(ctx, "sync", 0, exitNothingNew)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	out.LastSyncUTS, out.LastSyncExit, out.LastSyncOKUTS = last.EndedAtUTS, last.ExitCode, lastOK.EndedAtUTS
+	if c.Remote {
+		if out.Remote, err = verifyRemote(ctx, c, client, s); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+	}
 
-	fmt.Fprintf(
-		os.Stdout,
-		"scrobbles_total=%d scrobbles_dated=%d scrobbles_suspect=%d min_uts=%d max_uts=%d dated_min_uts=%d dated_max_uts=%d\n",
-		count,
-		datedCount,
-		suspectCount,
-		minUTS,
-		maxUTS,
-		nullI64(datedMin),
-		nullI64(datedMax),
-	)
+	if c.Format == "json" {
+		err = writeJSON(os.Stdout, out, c.Pretty)
+	} else {
+		err = out.writeText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	for _, r := range out.Remote {
+		if len(r.Diverging) > 0 {
+			return 1
+		}
+	}
 	return 0
 }
 
-func cmdDigest(ctx context.Context, log logx.Logger, c config.Config, s *store.Store) int {
-	_ = log // reserved for future diagnostics
-
-	if c.Format != "" && c.Format != "json" {
-		fmt.Fprintln(os.Stderr, "error: digest only supports --format json")
+func cmdDigest(ctx context.Context, log logx.Logger, c config.Config, s *store.Store, n notify.Notifier) int {
+	switch c.Format {
+	case "", "json", "markdown", "html":
+	default:
+		fmt.Fprintln(os.Stderr, "error: invalid --format for digest (expected json|markdown|html)")
+		return 2
+	}
+	var mail notify.Email
+	if c.Email {
+		var err error
+		if mail, err = notify.NewEmail(c.Notify); err != nil {
+			fmt.Fprintln(os.Stderr, "error: digest --email:", err)
+			return 2
+		}
+		if c.Format != "" || (len(c.Users) > 0 && !c.Merged) {
+			fmt.Fprintln(os.Stderr, "error: digest --email sends Markdown and HTML; it can't be combined with --format or a --users comparison")
+			return 2
+		}
+	}
+	if c.Encoding != "json" && c.Encoding != "columnar" {
+		fmt.Fprintln(os.Stderr, "error: invalid --encoding (expected json|columnar)")
 		return 2
 	}
+	if c.Encoding == "columnar" && (c.Email || (c.Format != "" && c.Format != "json")) {
+		fmt.Fprintln(os.Stderr, "error: --encoding columnar is for the JSON digest")
+		return 2
+	}
+	if c.MaxBytes < 0 || (c.MaxBytes > 0 && (c.Email || (c.Format != "" && c.Format != "json") || (len(c.Users) > 0 && !c.Merged))) {
+		fmt.Fprintln(os.Stderr, "error: --max-bytes trims the JSON digest; it can't be combined with --email, another --format or a --users comparison")
+		return 2
+	}
+	for _, f := range []struct {
+		flag  string
+		names []string
+	}{{"--sections", c.Sections}, {"--exclude", c.Exclude}, {"--priority", c.Priority}} {
+		if err := digest.CheckSections(f.names); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %v\n", f.flag, err)
+			return 2
+		}
+	}
 
 	opt := digest.DefaultOptions()
-	out, err := digest.Build(ctx, s.DB, opt)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "error:", err)
-		return 1
+	opt.Filter = c.Filter
+	opt.Only, opt.Exclude = c.Sections, c.Exclude
+	opt.Location = c.Location
+	opt.SchemaVersion = c.SchemaVersion
+	opt.AlbumsAcrossArtists = c.AlbumsAcrossArtists
+	if c.Merged && len(c.Users) < 2 {
+		fmt.Fprintln(os.Stderr, "error: --merged needs --users with at least two users")
+		return 2
+	}
+	if len(c.Users) == 1 {
+		fmt.Fprintln(os.Stderr, "error: --users needs at least two users")
+		return 2
+	}
+	if len(c.Users) > 0 && !c.Merged {
+		if c.Format != "" && c.Format != "json" {
+			fmt.Fprintln(os.Stderr, "error: a --users comparison is JSON only; add --merged for one household digest")
+			return 2
+		}
+		cmp, err := digest.Compare(ctx, s, c.Users, opt)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		b, err := digestEncoder(c)(cmp)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		if _, err := os.Stdout.Write(append(b, '\n')); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		return 0
+	}
+	if c.Merged {
+		// The digest is built as the first user, with the rest merged in.
+		v, err := s.ForUser(ctx, c.Users[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		for _, u := range c.Users[1:] {
+			o, err := s.ForUser(ctx, u)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return 1
+			}
+			opt.Filter.AlsoUsers = append(opt.Filter.AlsoUsers, o.User())
+		}
+		s = v
+	}
+	var out digest.Digest
+	var err error
+	if c.NoCache {
+		out, err = digest.Build(ctx, s, opt)
+	} else {
+		var cached bool
+		out, cached, err = digest.BuildCached(ctx, s, opt)
+		log.Debugf("digest: cached=%v", cached)
 	}
-	b, err := digest.EncodeJSON(out, c.Pretty)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		return 1
 	}
-	if _, err := os.Stdout.Write(append(b, '\n')); err != nil {
+	if err := writeDigest(c, mail, out); err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		return 1
 	}
+	if c.Email {
+		log.Infof("digest: mailed to %s", strings.Join(mail.To, ", "))
+	}
+
+	msg := fmt.Sprintf("%d scrobbles", out.Meta.ScrobblesDated)
+	if len(out.Top.Artists30d) > 0 {
+		msg += fmt.Sprintf("; top artist (30d): %s", out.Top.Artists30d[0].Artist)
+	}
+	notifyEvent(ctx, log, n, notify.Event{Kind: notify.EventDigestReady, Title: "digest ready", Message: msg})
 	return 0
 }
 
-func cmdRecommend(ctx context.Context, log logx.Logger, c config.Config, client lastfm.Client, s *store.Store) int {
-	_ = log // reserved for future diagnostics
+// writeDigest prints the digest in --format, or with --email mails it as
+// HTML with the Markdown as its plain-text part.
+func writeDigest(c config.Config, mail notify.Email, out digest.Digest) error {
+	switch {
+	case c.Email:
+		html, err := digest.HTML(out)
+		if err != nil {
+			return err
+		}
+		return mail.SendHTML("lastfm-golang: listening digest", digest.Markdown(out), html)
+	case c.Format == "markdown":
+		_, err := io.WriteString(os.Stdout, digest.Markdown(out))
+		return err
+	case c.Format == "html":
+		html, err := digest.HTML(out)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(os.Stdout, html)
+		return err
+	}
+	encode := digestEncoder(c)
+	var b []byte
+	var err error
+	if c.MaxBytes > 0 {
+		b, err = digest.Fit(out, c.MaxBytes, c.Priority, encode)
+	} else {
+		b, err = encode(out)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append(b, '\n'))
+	return err
+}
+
+// digestEncoder returns how --encoding and --pretty want digest JSON.
+func digestEncoder(c config.Config) func(any) ([]byte, error) {
+	if c.Encoding == "columnar" {
+		return func(v any) ([]byte, error) { return digest.EncodeColumnar(v, c.Pretty) }
+	}
+	return func(v any) ([]byte, error) { return digest.EncodeJSON(v, c.Pretty) }
+}
+
+// recommendOptions applies the recommend flags to the defaults.
+func recommendOptions(c config.Config) (recommend.Options, error) {
+	opt := recommend.DefaultOptions()
+	opt.Filter = c.Filter
+	if c.Algo != "" {
+		opt.Algo = c.Algo
+	} else if c.Tag != "" {
+		opt.Algo = recommend.AlgoTag
+	}
+	opt.Tag = c.Tag
+	if c.By != "" {
+		opt.SeedBy = c.By
+	}
+	if c.Unit != "" {
+		opt.Unit = c.Unit
+	}
+	opt.Friends = c.Friends
+	if c.MaxPerArtist >= 0 {
+		opt.MaxPerArtist = c.MaxPerArtist
+	}
+	if c.Diversity < 0 || c.Diversity > 1 {
+		return opt, errors.New("--diversity must be between 0 and 1")
+	}
+	opt.Diversity = c.Diversity
+	seed, err := recommend.ParseSeed(c.Seed, time.Now())
+	if err != nil {
+		return opt, err
+	}
+	opt.Seed = seed
+	opt.NoRepeat = c.NoRepeat
+	opt.Offline = c.Offline
+	opt.User = c.Username
+	opt.SchemaVersion = c.SchemaVersion
+	if c.Weights != "" {
+		if opt.Weights, err = recommend.ParseWeights(c.Weights, opt.Weights); err != nil {
+			return opt, err
+		}
+	}
+	return opt, nil
+}
+
+func cmdRecommend(ctx context.Context, log logx.Logger, c config.Config, client *lastfm.Client, s *store.Store) int {
+	if len(c.Args) > 0 {
+		return cmdRecommendBlock(ctx, log, c, s)
+	}
 
 	format := c.Format
 	if format == "" {
 		format = "json"
 	}
 
-	opt := recommend.DefaultOptions()
+	opt, err := recommendOptions(c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 2
+	}
+	opt.Location = s.Location()
+	opt.MinSaneUTS = s.MinSaneUTS()
+	opt.Filter.User = s.User()
+	if opt.SeedBy == recommend.SeedByAffinity {
+		if err := freshAffinity(ctx, s); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+	}
 	out, err := recommend.Build(ctx, s.DB, client, opt)
 	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return exitTimedOut
+		}
+		return 1
+	}
+
+	recs := make([]store.Recommendation, 0, len(out.Tracks)+len(out.Albums))
+	for _, t := range out.Tracks {
+		recs = append(recs, store.Recommendation{Rank: t.Rank, Artist: t.Artist, Track: t.Track, Score: t.Score})
+	}
+	for _, a := range out.Albums {
+		recs = append(recs, store.Recommendation{Rank: a.Rank, Artist: a.Artist, Album: a.Album, Score: a.Score})
+	}
+	if out.Meta.RunID, err = s.SaveRecommendations(ctx, out.Meta.Algo, recs); err != nil {
 		fmt.Fprintln(os.Stderr, "error:", err)
 		return 1
 	}
@@ -357,6 +1258,9 @@ func cmdRecommend(ctx context.Context, log logx.Logger, c config.Config, client
 		for _, t := range out.Tracks {
 			fmt.Fprintf(os.Stdout, "%s\t%s\n", t.Artist, t.Track)
 		}
+		for _, a := range out.Albums {
+			fmt.Fprintf(os.Stdout, "%s\t%s\n", a.Artist, a.Album)
+		}
 		return 0
 	default:
 		fmt.Fprintln(os.Stderr, "error: invalid --format for recommend (expected json|tsv)")
@@ -364,27 +1268,51 @@ func cmdRecommend(ctx context.Context, log logx.Logger, c config.Config, client
 	}
 }
 
-func getPageWithRetry(ctx context.Context, log logx.Logger, client lastfm.Client, page, limit int) (lastfm.Page, error) {
-	const maxAttempts = 8
-	backoff := 1 * time.Second
-
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		p, err := client.GetRecentTracksPage(ctx, page, limit)
-		if err == nil {
-			return p, nil
-		}
-		if !lastfm.IsRetryable(err) || attempt == maxAttempts {
-			return lastfm.Page{}, err
-		}
-
-		log.Infof("retry: page %d attempt %d/%d: %v", page, attempt, maxAttempts, err)
-		time.Sleep(backoff)
-		if backoff < 30*time.Second {
-			backoff *= 2
-		}
+func newClient(c config.Config, log logx.Logger) (*lastfm.Client, error) {
+	retry := lastfm.DefaultRetryPolicy()
+	retry.OnRetry = func(attempt, maxAttempts int, err error) {
+		log.Infof("retry: attempt %d/%d: %v", attempt, maxAttempts, err)
+	}
+	opts := []lastfm.Option{
+		lastfm.WithUsername(c.Username),
+		lastfm.WithSharedSecret(c.SharedSecret),
+		lastfm.WithSessionKey(c.SessionKey),
+		lastfm.WithUserAgent(c.UserAgent),
+		lastfm.WithRetry(retry),
+		lastfm.WithRateLimit(c.RateLimit),
+	}
+	// Outermost first: cache hits are neither traced nor recorded, and the
+	// trace shows replayed calls too.
+	if c.HTTPCache {
+		opts = append(opts, lastfm.WithMiddleware(lastfm.Cache(lastfm.CacheOptions{
+			Dir: filepath.Join(c.DataDir, httpCacheDir),
+			TTL: lastfm.DefaultCacheTTLs(),
+		})))
+	}
+	if c.Verbose {
+		opts = append(opts, lastfm.WithMiddleware(lastfm.Trace(log.Debugf)))
+	}
+	if c.RecordHTTP != "" {
+		opts = append(opts, lastfm.WithMiddleware(lastfm.Record(c.RecordHTTP)))
 	}
+	if c.ReplayHTTP != "" {
+		opts = append(opts, lastfm.WithRateLimit(0), lastfm.WithMiddleware(lastfm.Replay(c.ReplayHTTP)))
+	}
+	if c.APIBaseURL != "" {
+		opts = append(opts, lastfm.WithBaseURL(c.APIBaseURL))
+	}
+	return lastfm.New(c.APIKey, opts...)
+}
 
-	return lastfm.Page{}, fmt.Errorf("unreachable")
+// logTraffic reports, with --verbose, how much the run downloaded from
+// Last.fm: gzipped on the wire and as JSON.
+func logTraffic(log logx.Logger, client *lastfm.Client) {
+	tr := client.Traffic()
+	if tr.Requests == 0 {
+		return
+	}
+	log.Debugf("http: %d %s, %s downloaded (%s uncompressed)", tr.Requests, plural(int(tr.Requests), "request", "requests"),
+		formatBytes(uint64(tr.WireBytes)), formatBytes(uint64(tr.Bytes)))
 }
 
 func nullI64(v sql.NullInt64) int64 {
@@ -0,0 +1,1892 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/digest"
+	"github.com/joshp123/lastfm-golang/internal/jsonschema"
+	"github.com/joshp123/lastfm-golang/internal/lastfmtest"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/recommend"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// runCLI runs the CLI in-process against the fake server, capturing stdout.
+func runCLI(t *testing.T, srv *lastfmtest.Server, dataDir string, args ...string) (string, int) {
+	t.Helper()
+	args = append(args,
+		"--api-key", "test-key",
+		"--user", "testuser",
+		"--api-base-url", srv.URL,
+		"--rate-limit", "0",
+		"--data-dir", dataDir,
+	)
+
+	dir := t.TempDir()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldOut, oldErr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = stdout, stderr
+	code := run(args)
+	os.Stdout, os.Stderr = oldOut, oldErr
+	_ = stdout.Close()
+	_ = stderr.Close()
+
+	out, _ := os.ReadFile(stdout.Name())
+	logs, _ := os.ReadFile(stderr.Name())
+	if len(logs) > 0 {
+		t.Logf("%s stderr:\n%s", args[0], logs)
+	}
+	return string(out), code
+}
+
+func scrobbleCount(t *testing.T, dataDir string) int64 {
+	t.Helper()
+	s, err := store.Open(context.Background(), store.OpenOptions{DataDir: dataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	n, _, _, err := s.Stats(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func rawLines(t *testing.T, dataDir string) int {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dataDir, "scrobbles.raw.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for sc.Scan() {
+		n++
+	}
+	return n
+}
+
+func TestBackfillPaginatesAndIsIdempotent(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	srv.Scrobble(lastfmtest.Tracks(450, "Four Tet", time.Now().Add(-10*time.Minute))...)
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	// 450 generated + 7 dated fixture scrobbles; the now-playing one is skipped.
+	if got := scrobbleCount(t, dataDir); got != 457 {
+		t.Fatalf("expected 457 scrobbles, got %d", got)
+	}
+	if got := srv.Calls("user.getrecenttracks"); got != 3 {
+		t.Fatalf("expected 3 pages fetched, got %d", got)
+	}
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("second backfill exit %d", code)
+	}
+	if got := scrobbleCount(t, dataDir); got != 457 {
+		t.Fatalf("expected rerun to insert nothing, got %d scrobbles", got)
+	}
+	if got := rawLines(t, dataDir); got != 457 {
+		t.Fatalf("expected one raw line per unique scrobble, got %d", got)
+	}
+}
+
+func TestBackfillPageSize(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		setup func(*lastfmtest.Server)
+		pages int
+	}{
+		{"large pages", func(*lastfmtest.Server) {}, 3},
+		// 1000, 500 and 250 fail; 200 works.
+		{"shrinks after failures", func(s *lastfmtest.Server) { s.FailLimitAbove(200) }, 3 + 13},
+		{"follows the API's cap", func(s *lastfmtest.Server) { s.CapLimit(200) }, 13},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := lastfmtest.NewServer()
+			defer srv.Close()
+			srv.Scrobble(lastfmtest.Tracks(2450, "Four Tet", time.Now().Add(-10*time.Minute))...)
+			tc.setup(srv)
+			dataDir := t.TempDir()
+
+			if _, code := runCLI(t, srv, dataDir, "backfill", "--page-size", "1000"); code != 0 {
+				t.Fatalf("backfill exit %d", code)
+			}
+			if got := scrobbleCount(t, dataDir); got != 2457 {
+				t.Fatalf("expected 2457 scrobbles, got %d", got)
+			}
+			if got := srv.Calls("user.getrecenttracks"); got != tc.pages {
+				t.Fatalf("expected %d page requests, got %d", tc.pages, got)
+			}
+		})
+	}
+}
+
+func TestTimeoutStopsBackfill(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	srv.Scrobble(lastfmtest.Tracks(450, "Four Tet", time.Now().Add(-10*time.Minute))...)
+	dataDir := t.TempDir()
+
+	// A wedged connection: the page after the first never answers until the
+	// client gives up.
+	var hang atomic.Bool
+	hang.Store(true)
+	target, _ := url.Parse(srv.URL)
+	upstream := httputil.NewSingleHostReverseProxy(target)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hang.Load() && r.URL.Query().Has("to") {
+			<-r.Context().Done()
+			return
+		}
+		upstream.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+	srv.URL = proxy.URL
+
+	if _, code := runCLI(t, srv, dataDir, "backfill", "--timeout", "500ms"); code != exitTimedOut {
+		t.Fatalf("backfill exit %d, want %d", code, exitTimedOut)
+	}
+	if got := scrobbleCount(t, dataDir); got != 200 {
+		t.Fatalf("expected the first page stored, got %d scrobbles", got)
+	}
+
+	hang.Store(false)
+	if _, code := runCLI(t, srv, dataDir, "backfill", "--timeout", "1m"); code != 0 {
+		t.Fatalf("resumed backfill exit %d", code)
+	}
+	if got := scrobbleCount(t, dataDir); got != 457 {
+		t.Fatalf("expected 457 scrobbles after resuming, got %d", got)
+	}
+}
+
+func TestSyncStopsAtKnownScrobbles(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	srv.Scrobble(lastfmtest.Tracks(450, "Four Tet", time.Now().Add(-10*time.Minute))...)
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	before := srv.Calls("user.getrecenttracks")
+
+	srv.Scrobble(lastfmtest.Tracks(3, "Burial", time.Now())...)
+	if _, code := runCLI(t, srv, dataDir, "sync"); code != 0 {
+		t.Fatalf("sync exit %d", code)
+	}
+	if got := scrobbleCount(t, dataDir); got != 460 {
+		t.Fatalf("expected 460 scrobbles after sync, got %d", got)
+	}
+	if got := srv.Calls("user.getrecenttracks") - before; got != 1 {
+		t.Fatalf("expected sync to stop after 1 page, fetched %d", got)
+	}
+}
+
+func TestSyncSummaryJSON(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+
+	check := func(wantCode int, wantStatus string, wantInserted int) {
+		t.Helper()
+		out, code := runCLI(t, srv, dataDir, "sync", "--quiet", "--summary-json")
+		var sum syncSummary
+		if err := json.Unmarshal([]byte(out), &sum); err != nil || strings.Count(out, "\n") != 1 {
+			t.Fatalf("want one JSON line, got %q (%v)", out, err)
+		}
+		if code != wantCode || sum.Status != wantStatus || sum.Inserted != wantInserted {
+			t.Fatalf("exit %d, summary %+v; want exit %d, %s, inserted %d", code, sum, wantCode, wantStatus, wantInserted)
+		}
+	}
+	check(exitNothingNew, "nothing_new", 0)
+	srv.Scrobble(lastfmtest.Tracks(3, "Burial", time.Now())...)
+	check(0, "synced", 3)
+	srv.Fail("user.getRecentTracks", "")
+	check(1, "failed", 0)
+}
+
+func TestSyncPostsNewArtistsToDiscord(t *testing.T) {
+	var mu sync.Mutex
+	var posts []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg struct{ Content string }
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		mu.Lock()
+		posts = append(posts, msg.Content)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer hook.Close()
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+	envFile := filepath.Join(t.TempDir(), "lastfm.env")
+	env := "LASTFM_DISCORD_WEBHOOK_URL=" + hook.URL + "\nLASTFM_NOTIFY_EVENTS=new_artists\n"
+	if err := os.WriteFile(envFile, []byte(env), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first sync's artists are all new; that's not announced.
+	if _, code := runCLI(t, srv, dataDir, "sync", "--notify", "discord", "--env-file", envFile); code != 0 {
+		t.Fatalf("sync exit %d", code)
+	}
+	srv.Scrobble(append(lastfmtest.Tracks(2, "Loraine James", time.Now()), lastfmtest.Tracks(1, "Boards of Canada", time.Now().Add(-time.Minute))...)...)
+	if _, code := runCLI(t, srv, dataDir, "sync", "--notify", "discord", "--env-file", envFile); code != 0 {
+		t.Fatalf("sync exit %d", code)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(posts) != 1 || posts[0] != "**1 new artist**\nFirst plays of Loraine James." {
+		t.Fatalf("discord posts = %q", posts)
+	}
+}
+
+func TestSyncPingsHealthcheck(t *testing.T) {
+	var mu sync.Mutex
+	var pings []string
+	hc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		pings = append(pings, r.URL.Path+" "+string(body))
+		mu.Unlock()
+	}))
+	defer hc.Close()
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "sync", "--healthcheck-url", hc.URL+"/check"); code != 0 {
+		t.Fatalf("sync exit %d", code)
+	}
+	srv.Fail("user.getRecentTracks", "")
+	if _, code := runCLI(t, srv, dataDir, "sync", "--healthcheck-url", hc.URL+"/check"); code != 1 {
+		t.Fatalf("failing sync exit %d, want 1", code)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(pings) != 2 || !strings.HasPrefix(pings[0], `/check {"status":"synced"`) || !strings.HasPrefix(pings[1], `/check/fail {"status":"failed"`) {
+		t.Fatalf("pings = %q", pings)
+	}
+}
+
+func TestReconcileTombstonesDeletedScrobbles(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	tracks := lastfmtest.Tracks(300, "Four Tet", time.Now().Add(-10*time.Minute))
+	srv.SetRecentTracks(tracks)
+	dataDir := t.TempDir()
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+
+	// Upstream, one play was deleted and one edited (a new scrobble).
+	upstream := slices.Clone(tracks)
+	upstream[3].Name = "Renamed"
+	upstream = slices.Delete(upstream, 10, 11)
+	srv.SetRecentTracks(upstream)
+
+	out, code := runCLI(t, srv, dataDir, "reconcile", "--window", "1d", "--dry-run")
+	if code != 0 || strings.Count(out, "tombstone\t") != 2 || strings.Count(out, "insert\t") != 1 {
+		t.Fatalf("reconcile --dry-run exit %d:\n%s", code, out)
+	}
+	if got := scrobbleCount(t, dataDir); got != 300 {
+		t.Fatalf("dry run tombstoned: %d scrobbles", got)
+	}
+
+	if _, code := runCLI(t, srv, dataDir, "reconcile", "--window", "1d"); code != 0 {
+		t.Fatalf("reconcile exit %d", code)
+	}
+	if got := scrobbleCount(t, dataDir); got != 299 {
+		t.Fatalf("after reconcile: %d scrobbles, want 299", got)
+	}
+	out, _ = runCLI(t, srv, dataDir, "delete", "list")
+	if strings.Count(out, "\treconcile\t") != 2 {
+		t.Fatalf("delete list:\n%s", out)
+	}
+
+	// Back upstream, it is restored; an empty answer tombstones nothing.
+	srv.SetRecentTracks(append(upstream, tracks[10]))
+	if _, code := runCLI(t, srv, dataDir, "reconcile", "--window", "1d"); code != 0 {
+		t.Fatalf("second reconcile exit %d", code)
+	}
+	if got := scrobbleCount(t, dataDir); got != 300 {
+		t.Fatalf("after restore: %d scrobbles, want 300", got)
+	}
+	srv.SetRecentTracks(nil)
+	if _, code := runCLI(t, srv, dataDir, "reconcile", "--window", "1d"); code != 1 {
+		t.Fatalf("reconcile of an empty history: exit %d, want 1", code)
+	}
+	if got := scrobbleCount(t, dataDir); got != 300 {
+		t.Fatalf("after an empty answer: %d scrobbles, want 300", got)
+	}
+}
+
+func TestDeleteAndUndelete(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	srv.SetRecentTracks(lastfmtest.Tracks(20, "Four Tet", time.Now().Add(-10*time.Minute)))
+	dataDir := t.TempDir()
+	if _, code := runCLI(t, srv, dataDir, "sync"); code != 0 {
+		t.Fatalf("sync exit %d", code)
+	}
+
+	if _, code := runCLI(t, srv, dataDir, "delete"); code != 2 {
+		t.Fatalf("delete without a match: exit %d, want 2", code)
+	}
+	if _, code := runCLI(t, srv, dataDir, "delete", "--track", "Track 1?", "--glob"); code != 0 {
+		t.Fatalf("delete exit %d", code)
+	}
+	if got := scrobbleCount(t, dataDir); got != 10 {
+		t.Fatalf("after delete: %d scrobbles, want 10", got)
+	}
+	out, code := runCLI(t, srv, dataDir, "digest", "--sections", "top")
+	if code != 0 || strings.Contains(out, "Track 12") || !strings.Contains(out, "Track 9") {
+		t.Fatalf("digest exit %d still lists a tombstoned track:\n%s", code, out)
+	}
+
+	// Still on Last.fm, but deleted by hand: reconcile leaves them.
+	if _, code := runCLI(t, srv, dataDir, "reconcile"); code != 0 {
+		t.Fatalf("reconcile exit %d", code)
+	}
+	if got := scrobbleCount(t, dataDir); got != 10 {
+		t.Fatalf("after reconcile: %d scrobbles, want 10", got)
+	}
+
+	out, code = runCLI(t, srv, dataDir, "undelete", "--track", "Track 12", "--dry-run")
+	if code != 0 || !strings.HasPrefix(out, "restore\t") || strings.Count(out, "\n") != 1 {
+		t.Fatalf("undelete --dry-run exit %d:\n%s", code, out)
+	}
+	if _, code := runCLI(t, srv, dataDir, "undelete", "all"); code != 0 {
+		t.Fatalf("undelete exit %d", code)
+	}
+	if got := scrobbleCount(t, dataDir); got != 20 {
+		t.Fatalf("after undelete: %d scrobbles, want 20", got)
+	}
+}
+
+func TestPruneArchivesAndImportRestores(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	old := lastfmtest.Tracks(10, "Aphex Twin", time.Date(2005, 6, 1, 12, 0, 0, 0, time.UTC))
+	srv.SetRecentTracks(append(lastfmtest.Tracks(20, "Four Tet", time.Now().Add(-10*time.Minute)), old...))
+	dataDir := t.TempDir()
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	archive := filepath.Join(t.TempDir(), "old.jsonl.gz")
+
+	if _, code := runCLI(t, srv, dataDir, "prune", "--before", "2008-01-01"); code != 2 {
+		t.Fatalf("prune without an archive: exit %d, want 2", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "prune", "--before", "2008-01-01", "--dry-run")
+	if code != 0 || strings.Count(out, "prune\t") != 10 || strings.Contains(out, "Four Tet") {
+		t.Fatalf("prune --dry-run exit %d:\n%s", code, out)
+	}
+	if got := scrobbleCount(t, dataDir); got != 30 {
+		t.Fatalf("after dry run: %d scrobbles, want 30", got)
+	}
+
+	if _, code := runCLI(t, srv, dataDir, "prune", "--before", "2008-01-01", "--export-first", archive); code != 0 {
+		t.Fatalf("prune exit %d", code)
+	}
+	if got := scrobbleCount(t, dataDir); got != 20 {
+		t.Fatalf("after prune: %d scrobbles, want 20", got)
+	}
+	// An archive is never overwritten.
+	if _, code := runCLI(t, srv, dataDir, "prune", "--before", "2008-01-01", "--export-first", archive); code != 1 {
+		t.Fatalf("prune into an existing archive: exit %d, want 1", code)
+	}
+
+	// Still on Last.fm, but pruned: backfill leaves them.
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	if got := scrobbleCount(t, dataDir); got != 20 {
+		t.Fatalf("after backfill: %d scrobbles, want 20", got)
+	}
+	// The raw log still has the pruned plays; doctor says why.
+	out, code = runCLI(t, srv, dataDir, "doctor")
+	if code != 0 || !strings.Contains(out, "info  raw jsonl  30 lines for 20 rows; the raw log keeps pruned scrobbles") {
+		t.Fatalf("doctor after prune exit %d:\n%s", code, out)
+	}
+
+	for range 2 {
+		if _, code := runCLI(t, srv, dataDir, "import", "archive", archive); code != 0 {
+			t.Fatalf("import archive exit %d", code)
+		}
+		if got := scrobbleCount(t, dataDir); got != 30 {
+			t.Fatalf("after import: %d scrobbles, want 30", got)
+		}
+	}
+	out, code = runCLI(t, srv, dataDir, "export", "--redact-after", "2008-01-01")
+	if code != 0 || strings.Count(out, `"source":"lastfm_api"`) != 10 || !strings.Contains(out, `"artist":"Aphex Twin"`) {
+		t.Fatalf("export after import exit %d:\n%s", code, out)
+	}
+}
+
+func TestDryRunWritesNothing(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "sync", "--dry-run"); code != 1 {
+		t.Fatalf("dry run without a database: exit %d, want 1", code)
+	}
+	if _, code := runCLI(t, srv, dataDir, "sync"); code != 0 {
+		t.Fatalf("sync exit %d", code)
+	}
+	before, raw := scrobbleCount(t, dataDir), rawLines(t, dataDir)
+
+	srv.Scrobble(lastfmtest.Tracks(3, "Burial", time.Now())...)
+	out, code := runCLI(t, srv, dataDir, "sync", "--dry-run")
+	if code != 0 || strings.Count(out, "\tBurial\t") != 3 || !strings.HasPrefix(out, "insert\t") {
+		t.Fatalf("sync --dry-run exit %d:\n%s", code, out)
+	}
+	out, code = runCLI(t, srv, dataDir, "edit", "--artist", "Burial", "--set-artist", "Kode9", "--dry-run")
+	if code != 0 || out != "" {
+		t.Fatalf("edit --dry-run of unsynced plays: exit %d:\n%s", code, out)
+	}
+	if n := scrobbleCount(t, dataDir); n != before || rawLines(t, dataDir) != raw {
+		t.Fatalf("dry run wrote: %d scrobbles (was %d), %d raw lines (was %d)", n, before, rawLines(t, dataDir), raw)
+	}
+
+	// The real sync still finds all three, and an edit dry run lists its changes.
+	if _, code := runCLI(t, srv, dataDir, "sync"); code != 0 {
+		t.Fatalf("sync exit %d", code)
+	}
+	out, code = runCLI(t, srv, dataDir, "edit", "--artist", "Burial", "--set-artist", "Kode9", "--dry-run")
+	if code != 0 || strings.Count(out, "\tartist_name\tBurial\tKode9\n") != 3 {
+		t.Fatalf("edit --dry-run exit %d:\n%s", code, out)
+	}
+	if audit, _ := runCLI(t, srv, dataDir, "edit", "log"); audit != "" {
+		t.Fatalf("dry run recorded edits:\n%s", audit)
+	}
+	if _, code := runCLI(t, srv, dataDir, "digest", "--dry-run"); code != 2 {
+		t.Fatalf("digest --dry-run exit %d, want 2", code)
+	}
+}
+
+func TestDigestMarkdownAndHTML(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "digest", "--format", "markdown")
+	if code != 0 || !strings.HasPrefix(out, "# Listening digest, ") || !strings.Contains(out, "## Top artists, 30 days") || !strings.Contains(out, "| The Chemical Brothers | 2 |") {
+		t.Fatalf("exit %d; markdown:\n%s", code, out)
+	}
+	out, code = runCLI(t, srv, dataDir, "digest", "--format", "html")
+	if code != 0 || !strings.Contains(out, "<h2>Top artists, 30 days</h2>") {
+		t.Fatalf("exit %d; html:\n%s", code, out)
+	}
+	if _, code := runCLI(t, srv, dataDir, "digest", "--email"); code != 2 {
+		t.Fatalf("--email without smtp settings: exit %d, want 2", code)
+	}
+}
+
+func TestInstallServiceWritesUnits(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := filepath.Join(t.TempDir(), "my data")
+	units := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "install-service", "--out", units); code != 2 {
+		t.Fatalf("without --env-file: exit %d, want 2", code)
+	}
+	envFile := filepath.Join(t.TempDir(), "lastfm.env")
+	if err := os.WriteFile(envFile, []byte("LASTFM_API_KEY=k\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, code := runCLI(t, srv, dataDir, "install-service", "--out", units, "--env-file", envFile, "--interval", "30m")
+	if code != 0 || !strings.Contains(out, "systemctl --user enable --now lastfm-golang-sync.timer") {
+		t.Fatalf("exit %d:\n%s", code, out)
+	}
+	service, _ := os.ReadFile(filepath.Join(units, "lastfm-golang-sync.service"))
+	if !strings.Contains(string(service), ` sync --quiet --env-file `+envFile+` --data-dir "`+dataDir+`"`) {
+		t.Fatalf("service:\n%s", service)
+	}
+	timer, _ := os.ReadFile(filepath.Join(units, "lastfm-golang-sync.timer"))
+	if !strings.Contains(string(timer), "OnUnitActiveSec=1800s") {
+		t.Fatalf("timer:\n%s", timer)
+	}
+
+	// --email needs the SMTP settings, then adds the weekly digest units.
+	if _, code := runCLI(t, srv, dataDir, "install-service", "--out", units, "--env-file", envFile, "--email"); code != 2 {
+		t.Fatalf("--email without smtp settings: exit %d, want 2", code)
+	}
+	smtp := "LASTFM_API_KEY=k\nLASTFM_SMTP_ADDR=localhost:25\nLASTFM_NOTIFY_EMAIL_FROM=me@example.com\nLASTFM_NOTIFY_EMAIL_TO=me@example.com\n"
+	if err := os.WriteFile(envFile, []byte(smtp), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, code = runCLI(t, srv, dataDir, "install-service", "--out", units, "--env-file", envFile, "--email")
+	if code != 0 || !strings.Contains(out, "enable --now lastfm-golang-sync.timer lastfm-golang-digest.timer") {
+		t.Fatalf("exit %d:\n%s", code, out)
+	}
+	service, _ = os.ReadFile(filepath.Join(units, "lastfm-golang-digest.service"))
+	if !strings.Contains(string(service), " digest --email --quiet --env-file ") {
+		t.Fatalf("digest service:\n%s", service)
+	}
+}
+
+func TestRecommendGolden(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "recommend")
+	if code != 0 {
+		t.Fatalf("recommend exit %d", code)
+	}
+	assertGolden(t, "recommend.golden.json", normalizeRecommend(t, out))
+}
+
+func TestRecommendTracksGolden(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "recommend", "--algo", "tracks")
+	if code != 0 {
+		t.Fatalf("recommend exit %d", code)
+	}
+	assertGolden(t, "recommend_tracks.golden.json", normalizeRecommend(t, out))
+}
+
+func TestRecommendFriendsGolden(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "recommend", "--algo", "friends")
+	if code != 0 {
+		t.Fatalf("recommend exit %d", code)
+	}
+	assertGolden(t, "recommend_friends.golden.json", normalizeRecommend(t, out))
+}
+
+func TestRecommendAlbumsGolden(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	// An old listen to Tycho's Dive: too old to seed, but the album counts
+	// as played and isn't suggested.
+	dive := lastfmtest.Tracks(1, "Tycho", time.Now().AddDate(0, 0, -200))
+	dive[0].Album.Text = "Dive"
+	srv.Scrobble(dive...)
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "recommend", "--unit", "album")
+	if code != 0 {
+		t.Fatalf("recommend exit %d", code)
+	}
+	if strings.Contains(out, `"album":"Dive"`) {
+		t.Fatalf("played album recommended:\n%s", out)
+	}
+	assertGolden(t, "recommend_albums.golden.json", normalizeRecommend(t, out))
+}
+
+// normalizeRecommend drops fields that depend on the clock.
+func normalizeRecommend(t *testing.T, out string) []byte {
+	t.Helper()
+	var v map[string]any
+	if err := json.Unmarshal([]byte(out), &v); err != nil {
+		t.Fatalf("recommend output is not JSON: %v\n%s", err, out)
+	}
+	delete(v["meta"].(map[string]any), "generated_at")
+	for _, tr := range v["tracks"].([]any) {
+		m := tr.(map[string]any)
+		if m["local_last_played_uts"].(float64) != 0 {
+			m["local_last_played_uts"] = "<played>"
+		}
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(b, '\n')
+}
+
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden (run with -update to create): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("output differs from %s (run with -update to accept):\n%s", path, got)
+	}
+}
+
+func TestDoctorHealthyAfterBackfill(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "doctor")
+	if code != 0 {
+		t.Fatalf("doctor exit %d:\n%s", code, out)
+	}
+	for _, want := range []string{"ok    api key", "ok    database", "ok    raw jsonl  7 lines match 7 rows", "ok    clock"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in doctor output:\n%s", want, out)
+		}
+	}
+}
+
+func TestStatsSummarizesLibrary(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	srv.Scrobble(lastfmtest.Tracks(20, "Four Tet", time.Now().Add(-10*time.Minute))...)
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "stats", "--format", "json")
+	if code != 0 {
+		t.Fatalf("stats exit %d:\n%s", code, out)
+	}
+	var got statsOut
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("stats output: %v\n%s", err, out)
+	}
+	if got.Scrobbles != 27 || got.Artists == 0 || got.Tracks == 0 || got.BusiestDayPlays == 0 || got.PerDay <= 0 {
+		t.Fatalf("stats = %+v", got)
+	}
+	if got.Files["lastfm.sqlite"] == 0 || got.Files["scrobbles.raw.jsonl"] == 0 {
+		t.Fatalf("file sizes = %v", got.Files)
+	}
+
+	text, code := runCLI(t, srv, dataDir, "stats")
+	if code != 0 || !strings.Contains(text, "busiest day") || !strings.Contains(text, "scrobbles") {
+		t.Fatalf("stats exit %d:\n%s", code, text)
+	}
+}
+
+func TestDiaryGroupsByDay(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	srv.Scrobble(lastfmtest.Tracks(20, "Four Tet", time.Now().Add(-10*time.Minute))...)
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "diary", "--days", "2", "--format", "json")
+	if code != 0 {
+		t.Fatalf("diary exit %d:\n%s", code, out)
+	}
+	var got diaryOut
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("diary output: %v\n%s", err, out)
+	}
+	plays, top := 0, false
+	for _, d := range got.Days {
+		plays += d.Plays
+		top = top || d.TopArtist == "Four Tet"
+		if len(d.Scrobbles) != d.Plays {
+			t.Fatalf("%s: %d plays, %d scrobbles", d.Date, d.Plays, len(d.Scrobbles))
+		}
+	}
+	if len(got.Days) != 2 || got.Days[0].Date <= got.Days[1].Date || plays < 20 || !top {
+		t.Fatalf("diary = %+v", got)
+	}
+
+	text, code := runCLI(t, srv, dataDir, "diary", "--days", "2")
+	if code != 0 || !strings.Contains(text, "Four Tet - Track 20") || !strings.Contains(text, "top: Four Tet") {
+		t.Fatalf("diary exit %d:\n%s", code, text)
+	}
+	md, code := runCLI(t, srv, dataDir, "diary", "--days", "2", "--format", "markdown")
+	if code != 0 || !strings.HasPrefix(md, "## ") || !strings.Contains(md, "(*Four Tet LP*)") {
+		t.Fatalf("diary markdown exit %d:\n%s", code, md)
+	}
+	if _, code := runCLI(t, srv, dataDir, "diary", "--days", "0"); code != 2 {
+		t.Fatalf("diary --days 0 exit %d, want 2", code)
+	}
+}
+
+func TestOnThisDay(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	srv.Scrobble(lastfmtest.Tracks(3, "Four Tet", time.Now().AddDate(-1, 0, 0))...)
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "on-this-day", "--format", "json")
+	if code != 0 {
+		t.Fatalf("on-this-day exit %d:\n%s", code, out)
+	}
+	var got digest.OnThisDay
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("on-this-day output: %v\n%s", err, out)
+	}
+	if len(got.Years) != 3 || got.Years[0].YearsAgo != 1 {
+		t.Fatalf("on-this-day = %+v", got)
+	}
+	text, code := runCLI(t, srv, dataDir, "on-this-day")
+	if code != 0 || !strings.HasPrefix(text, "1 year ago (") || !strings.Contains(text, "5 years ago (") {
+		t.Fatalf("on-this-day exit %d:\n%s", code, text)
+	}
+}
+
+func TestDiscovered(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	srv.Scrobble(lastfmtest.Tracks(3, "Four Tet", time.Date(2020, 3, 20, 12, 0, 0, 0, time.UTC))...)
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "discovered", "2020-03", "--tz", "UTC", "--format", "json")
+	if code != 0 {
+		t.Fatalf("discovered exit %d:\n%s", code, out)
+	}
+	var got struct {
+		Items []struct{ Artist, FirstPlayedAt string } `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("discovered output: %v\n%s", err, out)
+	}
+	if len(got.Items) != 1 || got.Items[0].Artist != "Four Tet" {
+		t.Fatalf("discovered = %+v", got)
+	}
+	text, code := runCLI(t, srv, dataDir, "discovered", "albums", "2021", "--tz", "UTC")
+	if code != 0 || text != "No albums first played in 2021.\n" {
+		t.Fatalf("discovered albums exit %d:\n%s", code, text)
+	}
+	if _, code := runCLI(t, srv, dataDir, "discovered", "March"); code != 2 {
+		t.Fatalf("bad period exit %d, want 2", code)
+	}
+}
+
+func TestArtistTrajectory(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	now := time.Now()
+	srv.Scrobble(lastfmtest.Tracks(4, "Four Tet", now.AddDate(0, -2, 0))...)
+	srv.Scrobble(lastfmtest.Tracks(2, "Four Tet", now)...)
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "artist", "four tet", "--trajectory")
+	if code != 0 {
+		t.Fatalf("artist exit %d:\n%s", code, out)
+	}
+	var got []store.MonthPlays
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("artist output: %v\n%s", err, out)
+	}
+	var plays int64
+	for _, m := range got {
+		plays += m.Plays
+	}
+	if len(got) < 3 || got[len(got)-1].Month != now.UTC().Format("2006-01") || plays != 6 {
+		t.Fatalf("trajectory = %+v", got)
+	}
+	text, code := runCLI(t, srv, dataDir, "artist", "Four Tet")
+	if code != 0 || !strings.HasPrefix(text, "Four Tet: 6 plays since ") {
+		t.Fatalf("artist exit %d:\n%s", code, text)
+	}
+	if _, code := runCLI(t, srv, dataDir, "artist", "Burial"); code != 1 {
+		t.Fatalf("unplayed artist exit %d, want 1", code)
+	}
+}
+
+func TestAnalyzeRetention(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	srv.Scrobble(lastfmtest.Tracks(5, "Four Tet", time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC))...)
+	srv.Scrobble(lastfmtest.Tracks(1, "Four Tet", time.Date(2020, 6, 10, 12, 0, 0, 0, time.UTC))...)
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "analyze", "retention", "--format", "json")
+	if code != 0 {
+		t.Fatalf("analyze exit %d:\n%s", code, out)
+	}
+	var got retentionOut
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("analyze output: %v\n%s", err, out)
+	}
+	var march *retentionCohort
+	for i, c := range got.Cohorts {
+		if c.Month == "2020-03" {
+			march = &got.Cohorts[i]
+		}
+	}
+	if march == nil || len(march.Retained) != 3 || march.Retained[0].Share != 1 || march.Retained[1].Share != 0 {
+		t.Fatalf("retention = %+v", got)
+	}
+	if len(got.Curve) != 3 {
+		t.Fatalf("curve = %+v", got.Curve)
+	}
+	binges, code := runCLI(t, srv, dataDir, "analyze", "binges", "--per", "week", "--min-share", "0.9")
+	if code != 0 || !strings.Contains(binges, "2020-W11  5 of 5  100%  Four Tet") {
+		t.Fatalf("analyze binges exit %d:\n%s", code, binges)
+	}
+	if _, code := runCLI(t, srv, dataDir, "analyze", "churn"); code != 2 {
+		t.Fatalf("unknown analysis exit %d, want 2", code)
+	}
+}
+
+func TestAnalyzeCompletion(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	// Tracks are 3 minutes apart: a 2-minute track is heard out, a
+	// 5-minute one cut short.
+	srv.Scrobble(lastfmtest.Tracks(4, "Four Tet", time.Now().Add(-5*time.Minute))...)
+	srv.SetTrackDuration("Four Tet", "Track 2", 2*time.Minute)
+	srv.SetTrackDuration("Four Tet", "Track 3", 5*time.Minute)
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "sync"); code != 0 {
+		t.Fatalf("sync exit %d", code)
+	}
+	if srv.Calls("track.getInfo") == 0 {
+		t.Fatal("sync cached no track durations")
+	}
+	out, code := runCLI(t, srv, dataDir, "analyze", "completion", "--format", "json")
+	if code != 0 {
+		t.Fatalf("analyze exit %d:\n%s", code, out)
+	}
+	var got completionOut
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("analyze output: %v\n%s", err, out)
+	}
+	rates := map[string]completionItem{}
+	for _, it := range got.Items {
+		rates[it.Artist+"|"+it.Track] = it
+	}
+	if r := rates["Four Tet|Track 2"]; r.Full != 1 || r.Rate != 1 || r.DurationS != 120 {
+		t.Errorf("Track 2 = %+v", r)
+	}
+	if r := rates["Four Tet|Track 3"]; r.Partial != 1 || r.Rate != 0 {
+		t.Errorf("Track 3 = %+v", r)
+	}
+	if _, code := runCLI(t, srv, dataDir, "analyze", "completion", "--unit", "artist"); code != 2 {
+		t.Fatalf("--unit artist exit %d, want 2", code)
+	}
+}
+
+func TestTopByAffinity(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	// As many plays each, but a loved track puts Grouper ahead.
+	srv.SetRecentTracks(append(lastfmtest.Tracks(3, "Burial", time.Now().Add(-5*time.Minute)),
+		lastfmtest.Tracks(3, "Grouper", time.Now().Add(-30*time.Minute))...))
+	srv.Love("Grouper", "Track 1")
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "sync"); code != 0 {
+		t.Fatalf("sync exit %d", code)
+	}
+	top := func(args ...string) topOut {
+		t.Helper()
+		out, code := runCLI(t, srv, dataDir, append([]string{"top", "--format", "json"}, args...)...)
+		if code != 0 {
+			t.Fatalf("top %v exit %d:\n%s", args, code, out)
+		}
+		var got topOut
+		if err := json.Unmarshal([]byte(out), &got); err != nil {
+			t.Fatalf("top output: %v\n%s", err, out)
+		}
+		return got
+	}
+	if got := top(); len(got.Items) != 2 || got.Items[0].Artist != "Burial" || got.Items[0].Plays != 3 {
+		t.Errorf("top by plays = %+v", got)
+	}
+	got := top("--by", "affinity")
+	if len(got.Items) != 2 || got.Items[0].Artist != "Grouper" || got.Items[0].Loved != 1 || got.Items[0].Affinity <= got.Items[1].Affinity {
+		t.Errorf("top by affinity = %+v", got)
+	}
+	got = top("tracks", "--by", "affinity", "--limit", "1")
+	if len(got.Items) != 1 || got.Items[0].Artist != "Grouper" || got.Items[0].Track != "Track 1" {
+		t.Errorf("top tracks by affinity = %+v", got)
+	}
+
+	out, code := runCLI(t, srv, dataDir, "recommend", "--by", "affinity", "--offline")
+	if code != 0 {
+		t.Fatalf("recommend exit %d:\n%s", code, out)
+	}
+	var rec struct {
+		Seeds []recommend.SeedArtist `json:"seeds"`
+	}
+	if err := json.Unmarshal([]byte(out), &rec); err != nil || len(rec.Seeds) != 2 || rec.Seeds[0].Artist != "Grouper" || rec.Seeds[0].Affinity == 0 {
+		t.Fatalf("recommend seeds = %+v, %v\n%s", rec.Seeds, err, out)
+	}
+	if _, code := runCLI(t, srv, dataDir, "top", "--by", "loved"); code != 2 {
+		t.Fatalf("--by loved exit %d, want 2", code)
+	}
+}
+
+func TestRepairDates(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	// Tracks 3 and 2 came back with placeholder dates, after Tracks 5 and 4
+	// and before Track 1 was fetched, so they are stored between them.
+	tracks := lastfmtest.Tracks(5, "Low", time.Now().Add(-10*time.Minute))
+	want := []string{tracks[2].Date.UTS, tracks[3].Date.UTS}
+	placeholders := slices.Clone(tracks)
+	placeholders[2].Date = &lastfm.Date{UTS: "1"}
+	placeholders[3].Date = &lastfm.Date{UTS: "0"}
+	dataDir := t.TempDir()
+	for _, n := range []int{2, 4, 5} {
+		srv.SetRecentTracks(placeholders[:n])
+		if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+			t.Fatalf("backfill exit %d", code)
+		}
+	}
+	out, code := runCLI(t, srv, dataDir, "stats", "--format", "json")
+	if code != 0 || !strings.Contains(out, `"scrobbles_suspect":2`) {
+		t.Fatalf("stats exit %d:\n%s", code, out)
+	}
+
+	// Last.fm has since found Track 3's date; Track 2's is interpolated.
+	srv.SetRecentTracks(append(slices.Clone(tracks[:3]), placeholders[3:]...))
+	repair := func(args ...string) repairDatesOut {
+		t.Helper()
+		out, code := runCLI(t, srv, dataDir, append([]string{"repair-dates", "--format", "json"}, args...)...)
+		if code != 0 {
+			t.Fatalf("repair-dates %v exit %d:\n%s", args, code, out)
+		}
+		var got repairDatesOut
+		if err := json.Unmarshal([]byte(out), &got); err != nil {
+			t.Fatalf("repair-dates output: %v\n%s", err, out)
+		}
+		return got
+	}
+	got := repair("--dry-run")
+	if got.Suspect != 2 || got.Refetched != 1 || got.Interpolated != 1 {
+		t.Fatalf("dry run = %+v", got)
+	}
+	got = repair()
+	if len(got.Repairs) != 2 || got.Repairs[0].How != "refetched" || got.Repairs[1].How != "interpolated" {
+		t.Fatalf("repairs = %+v", got)
+	}
+	for i, r := range got.Repairs {
+		if strconv.FormatInt(r.NewUTS, 10) != want[i] {
+			t.Errorf("%s dated %d, want %s", r.Track, r.NewUTS, want[i])
+		}
+	}
+	if got := repair(); got.Suspect != 0 {
+		t.Fatalf("after repair = %+v", got)
+	}
+	if out, _ := runCLI(t, srv, dataDir, "edit", "log"); strings.Count(out, "played_at_uts") != 2 {
+		t.Fatalf("edit log:\n%s", out)
+	}
+	// A backfill doesn't bring the placeholders back.
+	srv.SetRecentTracks(placeholders)
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	if out, _ := runCLI(t, srv, dataDir, "stats", "--format", "json"); !strings.Contains(out, `"scrobbles_suspect":0`) {
+		t.Fatalf("stats after backfill:\n%s", out)
+	}
+
+	// Moving the threshold makes more scrobbles suspect.
+	out, code = runCLI(t, srv, dataDir, "stats", "--format", "json", "--min-sane-date", "2100-01-01")
+	if code != 0 || !strings.Contains(out, `"scrobbles_suspect":5`) {
+		t.Fatalf("stats with --min-sane-date exit %d:\n%s", code, out)
+	}
+	if _, code := runCLI(t, srv, dataDir, "stats", "--min-sane-date", "2000"); code != 2 {
+		t.Fatalf("bad --min-sane-date exit %d, want 2", code)
+	}
+}
+
+func TestExportICS(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "export", "--format", "ics")
+	if code != 0 {
+		t.Fatalf("export exit %d", code)
+	}
+	if !strings.HasPrefix(out, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(out, "END:VCALENDAR\r\n") {
+		t.Fatalf("not a calendar:\n%s", out)
+	}
+	if !strings.Contains(out, "SUMMARY:") || !strings.Contains(out, `top artist:`) {
+		t.Fatalf("missing daily summary:\n%s", out)
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(l) > 75 {
+			t.Fatalf("unfolded line (%d octets): %q", len(l), l)
+		}
+	}
+
+	for n, want := range map[int64]string{10000: "10,000th", 100000: "100,000th", 1: "1st", 112: "112th", 1000002: "1,000,002nd"} {
+		if got := ordinal(n); got != want {
+			t.Errorf("ordinal(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestExportObsidianNotes(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+	vault := filepath.Join(t.TempDir(), "music")
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	if _, code := runCLI(t, srv, dataDir, "export", "--format", "obsidian"); code != 2 {
+		t.Fatalf("export without --out exit %d, want 2", code)
+	}
+	notes := func() map[string]os.FileInfo {
+		out := map[string]os.FileInfo{}
+		entries, err := os.ReadDir(vault)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			fi, err := e.Info()
+			if err != nil {
+				t.Fatal(err)
+			}
+			out[e.Name()] = fi
+		}
+		return out
+	}
+
+	if _, code := runCLI(t, srv, dataDir, "export", "--format", "obsidian", "--out", vault); code != 0 {
+		t.Fatalf("export exit %d", code)
+	}
+	first := notes()
+	if len(first) == 0 {
+		t.Fatal("no notes written")
+	}
+	for name := range first {
+		if ok, _ := filepath.Match("[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9].md", name); !ok {
+			t.Fatalf("unexpected note name %q", name)
+		}
+		b, err := os.ReadFile(filepath.Join(vault, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := string(b)
+		if !strings.HasPrefix(text, "---\ndate: "+strings.TrimSuffix(name, ".md")+"\n") || !strings.Contains(text, "## Top artists") || !strings.Contains(text, "| Time | Artist | Track | Album |") {
+			t.Fatalf("%s:\n%s", name, text)
+		}
+	}
+
+	// A rerun over the same scrobbles leaves every note untouched.
+	time.Sleep(10 * time.Millisecond)
+	if _, code := runCLI(t, srv, dataDir, "export", "--format", "obsidian", "--out", vault); code != 0 {
+		t.Fatalf("second export exit %d", code)
+	}
+	for name, fi := range notes() {
+		if !fi.ModTime().Equal(first[name].ModTime()) {
+			t.Fatalf("%s rewritten by an identical export", name)
+		}
+	}
+
+	if _, code := runCLI(t, srv, dataDir, "export", "--format", "obsidian", "--per", "week", "--out", vault); code != 0 {
+		t.Fatalf("weekly export exit %d", code)
+	}
+	weeks := 0
+	for name := range notes() {
+		if ok, _ := filepath.Match("[0-9][0-9][0-9][0-9]-W[0-9][0-9].md", name); ok {
+			weeks++
+		}
+	}
+	if weeks == 0 {
+		t.Fatal("no weekly notes written")
+	}
+}
+
+func TestHistoryJournalsRuns(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	if _, code := runCLI(t, srv, dataDir, "sync", "--verbose"); code != 0 {
+		t.Fatalf("sync exit %d", code)
+	}
+	if _, code := runCLI(t, srv, dataDir, "edit", "--set-artist", "x"); code != 2 {
+		t.Fatalf("edit without a match exit %d, want 2", code)
+	}
+
+	out, code := runCLI(t, srv, dataDir, "history", "--format", "json")
+	if code != 0 {
+		t.Fatalf("history exit %d", code)
+	}
+	var runs []store.Run
+	if err := json.Unmarshal([]byte(out), &runs); err != nil {
+		t.Fatalf("history json: %v\n%s", err, out)
+	}
+	if len(runs) != 3 {
+		t.Fatalf("runs = %+v, want edit, sync and backfill", runs)
+	}
+	edit, sync, backfill := runs[0], runs[1], runs[2]
+	if edit.Command != "edit" || edit.ExitCode != 2 || !strings.HasPrefix(edit.Error, "edit needs") || !edit.Finished() {
+		t.Fatalf("edit run = %+v", edit)
+	}
+	// Flag values stay out of the journal.
+	if sync.Command != "sync" || sync.ExitCode != 0 || sync.Error != "" || strings.Contains(sync.Args, "test-key") || !strings.Contains(sync.Args, "--verbose") {
+		t.Fatalf("sync run = %+v", sync)
+	}
+	if backfill.Command != "backfill" || backfill.Inserted != int(scrobbleCount(t, dataDir)) {
+		t.Fatalf("backfill run = %+v", backfill)
+	}
+
+	out, code = runCLI(t, srv, dataDir, "history", "sync")
+	if code != 0 || strings.Count(out, "\n") != 1 || !strings.Contains(out, "\tsync\t0\t") {
+		t.Fatalf("history sync exit %d:\n%s", code, out)
+	}
+	out, code = runCLI(t, srv, dataDir, "verify")
+	if code != 0 || !strings.Contains(out, fmt.Sprintf("last_sync_exit=0 last_sync_ok_uts=%d", sync.EndedAtUTS)) {
+		t.Fatalf("verify exit %d:\n%s", code, out)
+	}
+}
+
+func TestAddRecordsManualPlaysAndSubmits(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	at := time.Now().Add(-2 * time.Hour).Format("2006-01-02 15:04")
+	_, code := runCLI(t, srv, dataDir, "add",
+		"--artist", "Boards of Canada", "--track", "Roygbiv", "--album", "Music Has the Right to Children",
+		"--at", at, "--count", "3", "--submit",
+		"--shared-secret", lastfmtest.SharedSecret, "--session-key", lastfmtest.SessionKey)
+	if code != 0 {
+		t.Fatalf("add exit %d", code)
+	}
+	if n := scrobbleCount(t, dataDir); n != 3 {
+		t.Fatalf("stored %d scrobbles, want 3", n)
+	}
+	if got := srv.Submitted(); len(got) != 3 || got[0].Artist != "Boards of Canada" {
+		t.Fatalf("submitted %+v", got)
+	}
+
+	// Old plays are stored but not submitted; Last.fm would drop them.
+	if _, code := runCLI(t, srv, dataDir, "add", "--artist", "Low", "--track", "Words", "--at", "2001-05-01 21:00", "--submit",
+		"--shared-secret", lastfmtest.SharedSecret, "--session-key", lastfmtest.SessionKey); code != 0 {
+		t.Fatalf("add exit %d", code)
+	}
+	if n := len(srv.Submitted()); n != 3 {
+		t.Fatalf("submitted %d, want still 3", n)
+	}
+
+	out, code := runCLI(t, srv, dataDir, "export")
+	if code != 0 || strings.Count(out, `"source":"manual"`) != 4 {
+		t.Fatalf("export exit %d, want 4 manual rows:\n%s", code, out)
+	}
+
+	// A bad signature is rejected.
+	if _, code := runCLI(t, srv, dataDir, "add", "--artist", "Low", "--track", "Words", "--submit",
+		"--shared-secret", "wrong", "--session-key", lastfmtest.SessionKey); code != 1 {
+		t.Fatalf("add with a bad secret exit %d, want 1", code)
+	}
+}
+
+func TestEditRenamesAndAudits(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+	srv.SetRecentTracks(lastfmtest.Tracks(5, "Sigur Ros", time.Now().Add(-48*time.Hour)))
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	if _, code := runCLI(t, srv, dataDir, "edit", "--artist", "Sigur R*", "--glob", "--set-artist", "Sigur Rós"); code != 0 {
+		t.Fatalf("edit exit %d", code)
+	}
+	out, _ := runCLI(t, srv, dataDir, "export", "--format", "tsv")
+	if strings.Count(out, "\tSigur Rós\t") != 5 {
+		t.Fatalf("expected all rows renamed:\n%s", out)
+	}
+	audit, _ := runCLI(t, srv, dataDir, "edit", "log")
+	if strings.Count(audit, "\tartist_name\tSigur Ros\tSigur Rós\n") != 5 {
+		t.Fatalf("expected 5 audited changes:\n%s", audit)
+	}
+
+	// Re-fetching the original listens doesn't resurrect the old name.
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	if n := scrobbleCount(t, dataDir); n != 5 {
+		t.Fatalf("%d scrobbles after re-backfill, want 5", n)
+	}
+}
+
+func TestIgnoreHidesArtistFromDigestButNotExport(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+	now := time.Now().Add(-time.Hour)
+	srv.SetRecentTracks(append(lastfmtest.Tracks(3, "Rain Sounds", now), lastfmtest.Tracks(2, "Low", now.Add(-time.Hour))...))
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	if _, code := runCLI(t, srv, dataDir, "ignore", "artist", "rain sounds"); code != 0 {
+		t.Fatalf("ignore exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "digest")
+	if code != 0 {
+		t.Fatalf("digest exit %d", code)
+	}
+	if strings.Contains(out, "Rain Sounds") || !strings.Contains(out, `"Low"`) {
+		t.Fatalf("expected only Low in the digest:\n%s", out)
+	}
+	if out, _ := runCLI(t, srv, dataDir, "export"); strings.Count(out, `"artist":"Rain Sounds"`) != 3 {
+		t.Fatalf("expected ignored plays in export:\n%s", out)
+	}
+	if out, _ := runCLI(t, srv, dataDir, "ignore", "list"); !strings.Contains(out, "\tartist\train sounds\n") {
+		t.Fatalf("ignore list:\n%s", out)
+	}
+}
+
+func TestRecommendNoRepeat(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	first, code := runCLI(t, srv, dataDir, "recommend", "--max-per-artist", "1")
+	if code != 0 {
+		t.Fatalf("recommend exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "recommend", "--no-repeat", "30d")
+	if code != 0 {
+		t.Fatalf("recommend exit %d", code)
+	}
+	var a, b recommendOut
+	if err := json.Unmarshal([]byte(first), &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(out), &b); err != nil {
+		t.Fatal(err)
+	}
+	if a.Meta.RunID != 1 || b.Meta.RunID != 2 {
+		t.Fatalf("run ids %d, %d", a.Meta.RunID, b.Meta.RunID)
+	}
+	seen := map[string]bool{}
+	for _, t := range a.Tracks {
+		seen[t.Artist+"|"+t.Track] = true
+	}
+	if len(b.Tracks) == 0 {
+		t.Fatalf("expected the tracks not shown before:\n%s", out)
+	}
+	for _, tr := range b.Tracks {
+		if seen[tr.Artist+"|"+tr.Track] {
+			t.Fatalf("%s - %s repeated within --no-repeat", tr.Artist, tr.Track)
+		}
+	}
+}
+
+func TestRecommendOfflineFromCache(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	online, code := runCLI(t, srv, dataDir, "recommend")
+	if code != 0 {
+		t.Fatalf("recommend exit %d", code)
+	}
+	calls := srv.Calls("artist.getsimilar")
+
+	// A second online run within the TTL is served from the cache too.
+	if _, code := runCLI(t, srv, dataDir, "recommend"); code != 0 || srv.Calls("artist.getsimilar") != calls {
+		t.Fatalf("exit %d; similar-artist calls %d -> %d, want cached", code, calls, srv.Calls("artist.getsimilar"))
+	}
+
+	offline, code := runCLI(t, srv, dataDir, "recommend", "--offline")
+	if code != 0 {
+		t.Fatalf("recommend --offline exit %d", code)
+	}
+	var a, b recommendOut
+	if err := json.Unmarshal([]byte(online), &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(offline), &b); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Tracks) != len(a.Tracks) || b.Tracks[0] != a.Tracks[0] {
+		t.Fatalf("offline run differs:\n%s\nvs\n%s", offline, online)
+	}
+
+	// Uncached lookups are skipped, not fatal.
+	out, code := runCLI(t, srv, dataDir, "recommend", "--offline", "--algo", "friends")
+	if code != 0 || !strings.Contains(out, `"missing":["user.getFriends testuser"]`) {
+		t.Fatalf("exit %d:\n%s", code, out)
+	}
+}
+
+func TestRecommendSkipsFailedSeeds(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	srv.Fail("artist.getSimilar", "Boards of Canada")
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "recommend")
+	if code != 0 {
+		t.Fatalf("recommend exit %d", code)
+	}
+	if !strings.Contains(out, `"errors":["artist.getSimilar Boards of Canada: lastfm api error 8`) || !strings.Contains(out, `"Autechre"`) {
+		t.Fatalf("expected a partial result noting the failed seed:\n%s", out)
+	}
+}
+
+func TestRecommendResurface(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	// Both played three times, years ago; Portishead around this time of
+	// year, Massive Attack half a year off (and longer ago).
+	now := time.Now()
+	for _, years := range []int{2, 3, 4} {
+		srv.Scrobble(lastfmtest.Tracks(2, "Portishead", now.AddDate(-years, 0, 0))...)
+		srv.Scrobble(lastfmtest.Tracks(2, "Massive Attack", now.AddDate(-years, -6, 0))...)
+	}
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	if !recommendIsLocal([]string{"--algo", "resurface"}) {
+		t.Fatal("--algo resurface should not need an API key")
+	}
+	out, code := runCLI(t, srv, dataDir, "recommend", "--algo", "resurface")
+	if code != 0 {
+		t.Fatalf("recommend exit %d", code)
+	}
+	var got recommendOut
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatal(err)
+	}
+	// Recent fixture plays are too fresh to resurface.
+	if len(got.Tracks) != 4 || got.Tracks[0].Artist != "Portishead" || got.Tracks[3].Artist != "Massive Attack" {
+		t.Fatalf("unexpected resurfaced tracks:\n%s", out)
+	}
+	if n := srv.Calls("artist.getsimilar") + srv.Calls("artist.gettoptags"); n != 0 {
+		t.Fatalf("resurface made %d Last.fm calls", n)
+	}
+}
+
+func TestSyncCachesListenersForObscurity(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	if _, code := runCLI(t, srv, dataDir, "sync"); code != 0 {
+		t.Fatalf("sync exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "digest")
+	if code != 0 {
+		t.Fatalf("digest exit %d", code)
+	}
+	var d struct {
+		Obscurity struct {
+			Artists []struct {
+				Artist    string
+				Listeners int64
+			}
+			Mainstream []struct {
+				Period   string
+				Coverage float64
+			}
+		}
+	}
+	if err := json.Unmarshal([]byte(out), &d); err != nil {
+		t.Fatal(err)
+	}
+	if a := d.Obscurity.Artists; len(a) == 0 || a[0].Artist != "Boards of Canada" || a[0].Listeners != 1402211 {
+		t.Fatalf("obscurity artists = %+v", a)
+	}
+	if m := d.Obscurity.Mainstream; len(m) == 0 || m[0].Period != "30d" || m[0].Coverage != 1 {
+		t.Fatalf("mainstream = %+v", m)
+	}
+
+	// A second sync within the TTL doesn't look them up again.
+	calls := srv.Calls("artist.getinfo")
+	if _, code := runCLI(t, srv, dataDir, "sync"); code != 0 || srv.Calls("artist.getinfo") != calls {
+		t.Fatalf("exit %d; artist.getInfo calls %d -> %d", code, calls, srv.Calls("artist.getinfo"))
+	}
+
+	out, code = runCLI(t, srv, dataDir, "recommend", "--weights", "obscurity=0.5")
+	if code != 0 || !strings.Contains(out, `"obscurity":0.5`) || !strings.Contains(out, `"obscurity":0.1369}`) {
+		t.Fatalf("exit %d; expected obscurity weight and breakdown:\n%s", code, out)
+	}
+}
+
+func TestChartsAnnotatesLocalPlays(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "charts", "--limit", "2")
+	if code != 0 {
+		t.Fatalf("charts exit %d", code)
+	}
+	var got struct {
+		Entries []struct {
+			Rank       int
+			Artist     string
+			Listeners  int64
+			LocalPlays int64 `json:"local_plays"`
+		}
+	}
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatal(err)
+	}
+	e := got.Entries
+	if len(e) != 2 || e[0].Artist != "The Weeknd" || e[0].LocalPlays != 0 || e[0].Listeners != 4101334 || e[1].Artist != "The Chemical Brothers" || e[1].LocalPlays != 2 {
+		t.Fatalf("unexpected chart:\n%s", out)
+	}
+
+	out, code = runCLI(t, srv, dataDir, "charts", "tracks", "--country", "Netherlands", "--format", "tsv")
+	if code != 0 || out != "1\tBoards of Canada\tRoygbiv\t1\n" {
+		t.Fatalf("exit %d; country tracks:\n%q", code, out)
+	}
+	if _, code := runCLI(t, srv, dataDir, "charts", "--country", "Atlantis"); code != 1 {
+		t.Fatalf("unknown country: exit %d, want 1", code)
+	}
+}
+
+func TestFriendsAnnotatesLocalPlays(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "friends")
+	if code != 0 {
+		t.Fatalf("friends exit %d", code)
+	}
+	var got friendsOut
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatal(err)
+	}
+	f := got.Friends
+	if len(f) != 2 || f[0].User != "alice" || f[0].NowPlaying == nil || f[0].NowPlaying.Track != "Awake" || f[0].LastPlayedUTS != 1760000000 || f[1].User != "bob" {
+		t.Fatalf("unexpected friends:\n%s", out)
+	}
+	var artists []string
+	for _, a := range f[0].Artists {
+		artists = append(artists, fmt.Sprintf("%s:%d:%d", a.Artist, a.Plays, a.LocalPlays))
+	}
+	if strings.Join(artists, " ") != "Tycho:1:0 Boards of Canada:1:3" {
+		t.Fatalf("alice's artists = %v", artists)
+	}
+
+	out, code = runCLI(t, srv, dataDir, "friends", "--friends", "bob", "--format", "text")
+	if code != 0 || !strings.Contains(out, "Underworld  1  1 play of mine") || strings.Contains(out, "alice") {
+		t.Fatalf("exit %d; text:\n%s", code, out)
+	}
+}
+
+func TestCompatWithOtherUser(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "compat", "--other-user", "alice")
+	if code != 0 {
+		t.Fatalf("compat exit %d", code)
+	}
+	var got compatOut
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got.Shared) != "[{2 Boards of Canada 350 3}]" || len(got.Unplayed) != 2 || got.OverlapPct != 33.3 {
+		t.Fatalf("unexpected report:\n%s", out)
+	}
+	if got.Score <= 0 || got.Score >= 100 {
+		t.Fatalf("score = %v, want between 0 and 100", got.Score)
+	}
+
+	out, code = runCLI(t, srv, dataDir, "compat", "--other-user", "alice", "--format", "markdown")
+	if code != 0 || !strings.Contains(out, "| 2 | Boards of Canada | 350 | 3 |") || !strings.Contains(out, "## Artists only alice listens to") {
+		t.Fatalf("exit %d; markdown:\n%s", code, out)
+	}
+	if _, code := runCLI(t, srv, dataDir, "compat"); code != 2 {
+		t.Fatalf("no --other-user: exit %d, want 2", code)
+	}
+}
+
+func TestCompatMatchesSpellings(t *testing.T) {
+	mine := []store.ArtistCount{{Artist: "Beyoncé", Plays: 5}, {Artist: "Chemical Brothers", Plays: 3}}
+	theirs := []lastfm.UserTopArtist{{Name: "Beyonce", PlayCount: "10"}, {Name: "The Chemical Brothers", PlayCount: "4"}}
+	if got := fmt.Sprint(compatReport(mine, theirs, 10).Shared); got != "[{1 Beyonce 10 5} {2 The Chemical Brothers 4 3}]" {
+		t.Errorf("shared = %s", got)
+	}
+}
+
+func TestExploreTagAndRecommendFromTag(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "explore-tag", "dungeon synth", "tracks", "--format", "tsv")
+	if code != 0 || out != "1\tMortiis\tSpirit of the Forest\t0\n2\tBoards of Canada\tRoygbiv\t1\n" {
+		t.Fatalf("exit %d; tag tracks:\n%q", code, out)
+	}
+	if _, code := runCLI(t, srv, dataDir, "explore-tag"); code != 2 {
+		t.Fatalf("explore-tag without a tag: exit %d, want 2", code)
+	}
+
+	out, code = runCLI(t, srv, dataDir, "recommend", "--tag", "electronic")
+	if code != 0 {
+		t.Fatalf("recommend --tag exit %d", code)
+	}
+	var got struct {
+		Meta struct {
+			Algo string `json:"algo"`
+		} `json:"meta"`
+		Tag    string `json:"tag"`
+		Tracks []struct {
+			Artist string `json:"artist"`
+		} `json:"tracks"`
+	}
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Meta.Algo != "tag->top-artists->top-tracks" || got.Tag != "electronic" || len(got.Tracks) == 0 || got.Tracks[0].Artist != "The Prodigy" {
+		t.Fatalf("unexpected tag recommendations:\n%s", out)
+	}
+}
+
+func TestVerifyRemoteFlagsDivergence(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "verify", "--remote")
+	if code != 1 {
+		t.Fatalf("verify --remote exit %d, want 1:\n%s", code, out)
+	}
+	for _, want := range []string{
+		"remote period=overall kind=artists checked=3 diverging=1\n" +
+			`diverging period=overall kind=artists artist="The Chemical Brothers" local=2 remote=9 diff=-7` + "\n",
+		"remote period=overall kind=tracks checked=1 diverging=0\n",
+		"remote period=overall kind=albums checked=1 diverging=0\n",
+		"remote period=12month kind=artists checked=2 diverging=0\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in:\n%s", want, out)
+		}
+	}
+
+	out, code = runCLI(t, srv, dataDir, "verify", "--remote", "--format", "json")
+	if code != 1 {
+		t.Fatalf("verify --remote --format json exit %d, want 1:\n%s", code, out)
+	}
+	var got verifyOut
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	if got.ScrobblesTotal != 7 || len(got.Remote) != 6 || len(got.Remote[0].Diverging) != 1 || got.Remote[0].Diverging[0].Diff != -7 {
+		t.Fatalf("verify json = %+v", got)
+	}
+}
+
+func TestHTTPCacheSkipsRepeatCalls(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	for range 2 {
+		if _, code := runCLI(t, srv, dataDir, "charts", "--http-cache"); code != 0 {
+			t.Fatalf("charts exit %d", code)
+		}
+	}
+	if got := srv.Calls("chart.gettopartists"); got != 1 {
+		t.Fatalf("chart.getTopArtists calls = %d, want 1", got)
+	}
+}
+
+func TestRecordAndReplayHTTP(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	dataDir := t.TempDir()
+	cassette := t.TempDir()
+
+	recorded, code := runCLI(t, srv, dataDir, "charts", "tracks", "--format", "tsv", "--record-http", cassette)
+	if code != 0 {
+		t.Fatalf("record exit %d", code)
+	}
+	srv.Close()
+	replayed, code := runCLI(t, srv, dataDir, "charts", "tracks", "--format", "tsv", "--replay-http", cassette)
+	if code != 0 || replayed != recorded || !strings.Contains(replayed, "Blinding Lights") {
+		t.Fatalf("replay exit %d:\n%q\nrecorded:\n%q", code, replayed, recorded)
+	}
+}
+
+func TestBackfillArchivesRawPages(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	srv.Scrobble(lastfmtest.Tracks(450, "Four Tet", time.Now().Add(-10*time.Minute))...)
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill", "--raw", "pages"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	var pages []store.RawPage
+	for p, err := range store.RawPages(dataDir) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, p)
+	}
+	if len(pages) != 3 {
+		t.Fatalf("expected 3 archived pages, got %d", len(pages))
+	}
+	last := pages[2]
+	var page lastfm.RecentTracksResponse
+	if err := json.Unmarshal(last.Body, &page); err != nil || last.Params["to"] == "" || page.RecentTracks.Attr.TotalPages != "1" {
+		t.Fatalf("params %v (%v):\n%s", last.Params, err, last.Body)
+	}
+	if last.Params["method"] != "user.getrecenttracks" || last.Params["api_key"] != "" || last.FetchedAt.IsZero() {
+		t.Fatalf("params %v fetched %v", last.Params, last.FetchedAt)
+	}
+
+	// --raw pages replaces the per-track log rather than adding to it.
+	if b, err := os.ReadFile(filepath.Join(dataDir, store.RawJSONLFile)); err != nil || len(b) != 0 {
+		t.Fatalf("raw jsonl (%v): %d bytes", err, len(b))
+	}
+	if out, code := runCLI(t, srv, dataDir, "doctor"); !strings.Contains(out, store.RawPagesFile) {
+		t.Fatalf("doctor exit %d:\n%s", code, out)
+	}
+}
+
+type recommendOut struct {
+	Meta struct {
+		RunID int64 `json:"run_id"`
+	} `json:"meta"`
+	Tracks []struct {
+		Artist string `json:"artist"`
+		Track  string `json:"track"`
+	} `json:"tracks"`
+}
+
+func TestRecommendBlockArtist(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	if _, code := runCLI(t, srv, dataDir, "recommend", "block-artist", "tycho"); code != 0 {
+		t.Fatalf("block-artist exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "recommend")
+	if code != 0 {
+		t.Fatalf("recommend exit %d", code)
+	}
+	if strings.Contains(out, "Tycho") || !strings.Contains(out, "Autechre") {
+		t.Fatalf("expected Tycho blocked from recommendations:\n%s", out)
+	}
+}
+
+func TestSchemaMatchesDigest(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	dataDir := t.TempDir()
+
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+	out, code := runCLI(t, srv, dataDir, "digest")
+	if code != 0 {
+		t.Fatalf("digest exit %d", code)
+	}
+	var d map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(out), &d); err != nil {
+		t.Fatal(err)
+	}
+
+	out, code = runCLI(t, srv, dataDir, "schema", "digest")
+	if code != 0 {
+		t.Fatalf("schema exit %d", code)
+	}
+	var schema jsonschema.Schema
+	if err := json.Unmarshal([]byte(out), &schema); err != nil {
+		t.Fatalf("schema json: %v\n%s", err, out)
+	}
+	props := schema.Defs["Digest"].Properties
+	for key := range d {
+		if props[key] == nil {
+			t.Errorf("digest key %q is not in the schema", key)
+		}
+	}
+	for _, key := range schema.Defs["Digest"].Required {
+		if d[key] == nil {
+			t.Errorf("required key %q is missing from the digest", key)
+		}
+	}
+
+	if !strings.Contains(string(d["meta"]), `"schema_version":1`) {
+		t.Errorf("digest meta = %s, want schema_version 1", d["meta"])
+	}
+	if _, code := runCLI(t, srv, dataDir, "digest", "--schema-version", "2"); code != 1 {
+		t.Fatalf("digest --schema-version 2 exit %d, want 1", code)
+	}
+	if _, code := runCLI(t, srv, dataDir, "schema", "nope"); code != 2 {
+		t.Fatalf("schema nope exit %d, want 2", code)
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	srv := lastfmtest.NewServer()
+	defer srv.Close()
+	tracks := lastfmtest.Tracks(3, "Burial", time.Now().Add(-time.Hour))
+	for i := range tracks {
+		tracks[i].Artist.MBID, tracks[i].Album.MBID = "a-burial", "r-untrue"
+	}
+	tracks[2].Artist.MBID = "a-gone"
+	srv.SetRecentTracks(tracks)
+	dataDir := t.TempDir()
+	if _, code := runCLI(t, srv, dataDir, "backfill"); code != 0 {
+		t.Fatalf("backfill exit %d", code)
+	}
+
+	var lookups atomic.Int32
+	mb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		switch r.URL.Path {
+		case "/artist/a-burial":
+			w.Write([]byte(`{"id":"a-burial","name":"Burial","country":"GB"}`))
+		case "/release/r-untrue":
+			w.Write([]byte(`{"id":"r-untrue","date":"2007-11-05","release-group":{"first-release-date":"2007-11-05"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer mb.Close()
+	enrich := func() {
+		t.Helper()
+		if out, code := runCLI(t, srv, dataDir, "enrich", "--musicbrainz-url", mb.URL); code != 0 {
+			t.Fatalf("enrich exit %d:\n%s", code, out)
+		}
+	}
+	// A dry run lists what it learned and keeps none of it.
+	out, code := runCLI(t, srv, dataDir, "enrich", "--musicbrainz-url", mb.URL, "--dry-run")
+	want := "enrich\tartist\ta-burial\tGB\nenrich\tartist\ta-gone\t\nenrich\talbum\tr-untrue\t2007\t\n"
+	if code != 0 || out != want {
+		t.Fatalf("enrich --dry-run exit %d:\n%s", code, out)
+	}
+	lookups.Store(0)
+
+	enrich()
+	if n := lookups.Load(); n != 3 {
+		t.Fatalf("enrich made %d lookups, want 3", n)
+	}
+	// Everything is known now, a-gone as unknown.
+	enrich()
+	if n := lookups.Load(); n != 3 {
+		t.Fatalf("second enrich made %d more lookups", n-3)
+	}
+
+	out, code = runCLI(t, srv, dataDir, "digest", "--sections", "countries,decades")
+	if code != 0 {
+		t.Fatalf("digest exit %d:\n%s", code, out)
+	}
+	var d digest.Digest
+	if err := json.Unmarshal([]byte(out), &d); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(d.Countries, d.Decades); got != "{[{GB 2 1 1}] 0.667} {[{2000 3 1 1}] 1}" {
+		t.Errorf("countries, decades = %s", got)
+	}
+}
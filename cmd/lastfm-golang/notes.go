@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// notesTopN is how many artists and tracks a note lists.
+const notesTopN = 10
+
+// notesWriter turns scrobbles, fed oldest first, into Markdown notes for
+// Obsidian and other plain-text vaults: one file per local day
+// (2006-01-02.md) or ISO week (2006-W01.md). A note depends only on its
+// scrobbles, so a rerun rewrites nothing that didn't change; files it no
+// longer has scrobbles for are left alone.
+type notesWriter struct {
+	dir  string
+	loc  *time.Location
+	week bool
+
+	name  string
+	start time.Time
+	plays []store.Scrobble
+
+	wrote, unchanged int
+}
+
+func newNotesWriter(dir, per string, loc *time.Location) (*notesWriter, error) {
+	if per != "day" && per != "week" {
+		return nil, fmt.Errorf("invalid --per %q (expected day|week)", per)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &notesWriter{dir: dir, loc: loc, week: per == "week"}, nil
+}
+
+func (x *notesWriter) add(sc store.Scrobble) error {
+	t := time.Unix(sc.PlayedAtUTS, 0).In(x.loc)
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, x.loc)
+	name := start.Format("2006-01-02")
+	if x.week {
+		start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+		y, w := start.ISOWeek()
+		name = fmt.Sprintf("%d-W%02d", y, w)
+	}
+	if name != x.name {
+		if err := x.flush(); err != nil {
+			return err
+		}
+		x.name, x.start = name, start
+	}
+	x.plays = append(x.plays, sc)
+	return nil
+}
+
+// close writes the last note.
+func (x *notesWriter) close() error {
+	return x.flush()
+}
+
+func (x *notesWriter) flush() error {
+	if len(x.plays) == 0 {
+		return nil
+	}
+	b := x.render()
+	x.plays = x.plays[:0]
+
+	path := filepath.Join(x.dir, x.name+".md")
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, b) {
+		x.unchanged++
+		return nil
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return err
+	}
+	x.wrote++
+	return nil
+}
+
+func (x *notesWriter) render() []byte {
+	type count struct {
+		artist, track string
+		plays         int
+	}
+	top := func(key func(store.Scrobble) (string, string)) []count {
+		idx := map[[2]string]int{}
+		var out []count
+		for _, sc := range x.plays {
+			a, t := key(sc)
+			if i, ok := idx[[2]string{a, t}]; ok {
+				out[i].plays++
+				continue
+			}
+			idx[[2]string{a, t}] = len(out)
+			out = append(out, count{a, t, 1})
+		}
+		slices.SortStableFunc(out, func(a, b count) int { return cmp.Compare(b.plays, a.plays) })
+		return out
+	}
+	artists := top(func(sc store.Scrobble) (string, string) { return sc.Artist, "" })
+	tracks := top(func(sc store.Scrobble) (string, string) { return sc.Artist, sc.Track })
+
+	var b strings.Builder
+	title := x.start.Format("Monday 2 January 2006")
+	if x.week {
+		title = "Week of " + x.start.Format("2 January 2006")
+	}
+	fmt.Fprintf(&b, "---\ndate: %s\nplays: %d\nartists: %d\ntop_artist: %q\ntags: [music]\n---\n\n", x.start.Format("2006-01-02"), len(x.plays), len(artists), artists[0].artist)
+	fmt.Fprintf(&b, "# %s\n\n%d %s, %d %s.\n", title, len(x.plays), plural(len(x.plays), "play", "plays"), len(artists), plural(len(artists), "artist", "artists"))
+
+	b.WriteString("\n## Top artists\n\n")
+	for i, a := range artists[:min(len(artists), notesTopN)] {
+		fmt.Fprintf(&b, "%d. %s (%d)\n", i+1, a.artist, a.plays)
+	}
+	b.WriteString("\n## Top tracks\n\n")
+	for i, t := range tracks[:min(len(tracks), notesTopN)] {
+		fmt.Fprintf(&b, "%d. %s - %s (%d)\n", i+1, t.artist, t.track, t.plays)
+	}
+
+	stamp := "15:04"
+	if x.week {
+		stamp = "Mon 15:04"
+	}
+	b.WriteString("\n## Scrobbles\n\n| Time | Artist | Track | Album |\n|---|---|---|---|\n")
+	cell := strings.NewReplacer("|", `\|`, "\n", " ").Replace
+	for _, sc := range x.plays {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", time.Unix(sc.PlayedAtUTS, 0).In(x.loc).Format(stamp), cell(sc.Artist), cell(sc.Track), cell(sc.Album))
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/digest"
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// cmdOnThisDay prints what was played on today's date 1, 5 and 10 years
+// ago: the digest's on_this_day section, as text, Markdown or JSON.
+func cmdOnThisDay(ctx context.Context, c config.Config, s *store.Store) int {
+	if len(c.Args) > 0 {
+		fmt.Fprintln(os.Stderr, "error: usage: on-this-day [--format text|markdown|json]")
+		return 2
+	}
+	if c.Format != "" && c.Format != "text" && c.Format != "markdown" && c.Format != "json" {
+		fmt.Fprintln(os.Stderr, "error: invalid --format (expected text|markdown|json)")
+		return 2
+	}
+	opt := digest.DefaultOptions()
+	opt.Filter = c.Filter
+	opt.Location = c.Location
+	out, err := digest.BuildOnThisDay(ctx, s, opt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	switch c.Format {
+	case "json":
+		err = writeJSON(os.Stdout, out, c.Pretty)
+	case "markdown":
+		err = writeOnThisDayMarkdown(os.Stdout, out)
+	default:
+		err = writeOnThisDayText(os.Stdout, out)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// writeOnThisDayText prints a line per year back, then its top artists and
+// first listens indented below it.
+func writeOnThisDayText(w io.Writer, d digest.OnThisDay) error {
+	var b strings.Builder
+	for _, y := range d.Years {
+		fmt.Fprintf(&b, "%s (%s)  %d %s\n", yearsAgo(y.YearsAgo), onThisDayDate(y.Date, "Mon 2006-01-02"), y.Plays, plural(int(y.Plays), "play", "plays"))
+		for _, a := range y.TopArtists {
+			fmt.Fprintf(&b, "  %d. %s (%d)\n", a.Rank, a.Artist, a.Plays)
+		}
+		for _, f := range y.FirstListens {
+			fmt.Fprintf(&b, "  new: %s - %s (%d that day, %d since)\n", f.Artist, f.Track, f.Plays, f.PlaysSince)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeOnThisDayMarkdown prints a section per year back.
+func writeOnThisDayMarkdown(w io.Writer, d digest.OnThisDay) error {
+	var b strings.Builder
+	for i, y := range d.Years {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "## %s: %s\n\n", yearsAgo(y.YearsAgo), onThisDayDate(y.Date, "Monday 2 January 2006"))
+		if y.Plays == 0 {
+			b.WriteString("No plays.\n")
+			continue
+		}
+		fmt.Fprintf(&b, "%d %s.\n\n", y.Plays, plural(int(y.Plays), "play", "plays"))
+		for _, a := range y.TopArtists {
+			fmt.Fprintf(&b, "%d. %s (%d)\n", a.Rank, a.Artist, a.Plays)
+		}
+		if len(y.FirstListens) > 0 {
+			b.WriteString("\nFirst listens:\n\n")
+			for _, f := range y.FirstListens {
+				fmt.Fprintf(&b, "- %s, starting with %s (%d %s since)\n", f.Artist, f.Track, f.PlaysSince, plural(int(f.PlaysSince), "play", "plays"))
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func yearsAgo(n int) string {
+	return fmt.Sprintf("%d %s ago", n, plural(n, "year", "years"))
+}
+
+// onThisDayDate reformats a YYYY-MM-DD date with layout.
+func onThisDayDate(date, layout string) string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return t.Format(layout)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// cmdPrune drops old scrobbles (prune --before DATE), or those of one
+// source (--source), from the database for good, after writing them to
+// the --export-first archive: export's JSONL, which import archive loads
+// back. Tombstoned ones go too, unarchived. A dry run lists what would go
+// and writes no archive.
+func cmdPrune(ctx context.Context, log logx.Logger, c config.Config, s *store.Store) int {
+	p := c.Prune
+	if len(c.Args) > 0 || (p.Before == 0 && p.Source == "") {
+		fmt.Fprintln(os.Stderr, "error: usage: prune --before YYYY-MM-DD [--source name] --export-first <archive.jsonl.gz>, or prune --source name --export-first <archive.jsonl.gz>")
+		return 2
+	}
+	if p.Before == 0 && p.Source == store.SourceLastFMAPI {
+		// backfill would only fetch them all again.
+		fmt.Fprintln(os.Stderr, "error: prune --source "+store.SourceLastFMAPI+" needs --before")
+		return 2
+	}
+	if p.ExportFirst == "" && !c.DryRun {
+		fmt.Fprintln(os.Stderr, "error: prune needs --export-first <file> to archive what it drops")
+		return 2
+	}
+	m := store.PruneMatch{Before: p.Before, Source: p.Source}
+
+	if c.DryRun {
+		var list []store.Scrobble
+		err := s.EachPruned(ctx, m, func(sc store.Scrobble) error {
+			list = append(list, sc)
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		printTombstones(os.Stdout, "prune", list)
+	} else {
+		n, err := writeArchive(ctx, s, m, p.ExportFirst)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		log.Infof("prune: archived %d scrobbles to %s", n, p.ExportFirst)
+	}
+
+	res, err := s.PruneScrobbles(context.WithoutCancel(ctx), m)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	if c.DryRun {
+		log.Infof("prune dry run: would drop %d scrobbles and %d tombstones", res.Scrobbles, res.Tombstoned)
+		return 0
+	}
+	log.Infof("prune: dropped %d scrobbles and %d tombstones; import archive %s brings them back", res.Scrobbles, res.Tombstoned, p.ExportFirst)
+	if res.Scrobbles > 0 {
+		if err := rechartFrom(ctx, log, s, res.MinPlayed); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// writeArchive writes the live scrobbles m selects to path, which must not
+// exist yet, as export's JSONL, gzipped if path ends in .gz. The file is
+// synced before it returns; on error it is removed.
+func writeArchive(ctx context.Context, s *store.Store, m store.PruneMatch, path string) (n int, err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(path)
+		}
+	}()
+
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if strings.HasSuffix(path, ".gz") {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	bw := bufio.NewWriter(w)
+	err = s.EachPruned(ctx, m, func(sc store.Scrobble) error {
+		b, err := json.Marshal(sc)
+		if err != nil {
+			return err
+		}
+		n++
+		_, err = bw.Write(append(b, '\n'))
+		return err
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("archive %s: %w", path, err)
+	}
+	return n, nil
+}
+
+// readArchive reads export's JSONL, gzipped or not, from path.
+func readArchive(path string) ([]store.Scrobble, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var out []store.Scrobble
+	dec := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var sc store.Scrobble
+		if err := dec.Decode(&sc); err == io.EOF {
+			return out, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: scrobble %d: %w", path, line, err)
+		}
+		if sc.PlayedAtUTS == 0 && sc.Artist == "" && sc.Track == "" {
+			return nil, fmt.Errorf("%s: scrobble %d: not an export line", path, line)
+		}
+		if sc.Source == "" {
+			sc.Source = store.SourceLastFMAPI
+		}
+		out = append(out, sc)
+	}
+}
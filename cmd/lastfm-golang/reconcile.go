@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// cmdReconcile re-fetches the last --window of scrobbles and tombstones
+// synced ones Last.fm no longer has: deleted there, or edited, which
+// Last.fm keeps as a new scrobble (stored here like sync would). Sync only
+// ever adds, so without it such rows would count forever.
+func cmdReconcile(ctx context.Context, log logx.Logger, c config.Config, client *lastfm.Client, s *store.Store) int {
+	now := time.Now()
+	from := now.Add(-c.Window).Unix()
+
+	present := map[string]bool{}
+	inWindow, inserted := 0, 0
+	for p, err := range client.RecentTrackPagesBefore(ctx, lastfm.RecentTracksOptions{Limit: c.PageSize, KeepRaw: c.Raw != "tracks"}, 0) {
+		if err != nil {
+			if ctx.Err() != nil {
+				how, code := stopped(ctx)
+				log.Infof("reconcile %s; nothing tombstoned", how)
+				return code
+			}
+			printLastfmError(err)
+			return 1
+		}
+		for _, t := range p.Tracks {
+			if t.Date == nil {
+				continue
+			}
+			uts, err := strconv.ParseInt(t.Date.UTS, 10, 64)
+			if err != nil {
+				continue
+			}
+			present[store.StableSourceHash(uts, t.Artist.Text, t.Name, t.Album.Text)] = true
+			if uts >= from {
+				inWindow++
+			}
+		}
+
+		wctx := context.WithoutCancel(ctx)
+		res, err := s.InsertPage(wctx, p.Tracks)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		if p.Raw != nil {
+			if err := s.AppendRawPage(p); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return 1
+			}
+		}
+		if c.DryRun {
+			printInserts(os.Stdout, res.New)
+		}
+		inserted += res.Inserted
+		if p.Next <= from {
+			break
+		}
+	}
+
+	window := store.TimeRange{From: from}
+	if inWindow == 0 {
+		// An empty answer is more likely a Last.fm hiccup (or a private
+		// profile) than a wiped history; don't tombstone on its word.
+		local, err := s.CountByRange(ctx, store.Filter{}, window)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		if local.Count > 0 {
+			fmt.Fprintf(os.Stderr, "error: Last.fm listed no scrobbles since %s but %d are stored; not tombstoning them\n", time.Unix(from, 0).UTC().Format(time.RFC3339), local.Count)
+			return 1
+		}
+	}
+
+	res, err := s.ReconcileSynced(ctx, window, present, now)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	if c.DryRun {
+		printTombstones(os.Stdout, "tombstone", res.Tombstoned)
+		printTombstones(os.Stdout, "restore", res.Restored)
+		log.Infof("reconcile dry run: checked=%d would insert=%d tombstone=%d restore=%d", res.Checked, inserted, len(res.Tombstoned), len(res.Restored))
+		return 0
+	}
+	for _, sc := range res.Tombstoned {
+		log.Infof("reconcile: gone from Last.fm: %s %s - %s", time.Unix(sc.PlayedAtUTS, 0).UTC().Format(time.RFC3339), sc.Artist, sc.Track)
+	}
+	log.Infof("reconcile done: checked=%d inserted=%d tombstoned=%d restored=%d", res.Checked, inserted, len(res.Tombstoned), len(res.Restored))
+
+	if inserted > 0 || len(res.Tombstoned) > 0 || len(res.Restored) > 0 {
+		if err := rechartFrom(ctx, log, s, from); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// repairDatesOut is repair-dates' JSON output.
+type repairDatesOut struct {
+	Suspect      int          `json:"suspect"`
+	Refetched    int          `json:"refetched"`
+	Interpolated int          `json:"interpolated"`
+	Unresolved   int          `json:"unresolved"`
+	Repairs      []dateRepair `json:"repairs"`
+	Errors       []string     `json:"errors,omitempty"`
+}
+
+type dateRepair struct {
+	Artist string `json:"artist"`
+	Track  string `json:"track"`
+	OldUTS int64  `json:"old_uts"`
+	// NewUTS is 0 for a scrobble left alone.
+	NewUTS int64 `json:"new_uts,omitempty"`
+	// How is "refetched", "interpolated" or "unresolved".
+	How string `json:"how"`
+}
+
+// cmdRepairDates dates the scrobbles stored with placeholder dates (before
+// the minimum sane timestamp) where it can: from Last.fm, if it now lists
+// the play with a date between the scrobbles stored either side of it, else
+// by interpolating between those. Every change is recorded like an edit;
+// with --dry-run nothing is written.
+func cmdRepairDates(ctx context.Context, log logx.Logger, c config.Config, client *lastfm.Client, s *store.Store) int {
+	if len(c.Args) > 0 {
+		fmt.Fprintln(os.Stderr, "error: usage: repair-dates [--offline] [--dry-run] [--format text|json]")
+		return 2
+	}
+	if c.Format != "" && c.Format != "text" && c.Format != "json" {
+		fmt.Fprintln(os.Stderr, "error: invalid --format (expected text|json)")
+		return 2
+	}
+
+	plan, err := s.PlanDateRepairs(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	out := repairDatesOut{Suspect: len(plan), Repairs: []dateRepair{}}
+	if client != nil && client.Username() != "" && !c.Offline {
+		if err := refetchDates(ctx, client, s, plan); err != nil {
+			if ctx.Err() != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return 1
+			}
+			log.Infof("repair-dates: refetch: %v", err)
+			out.Errors = append(out.Errors, "refetch: "+err.Error())
+		}
+	}
+	res, err := s.ApplyDateRepairs(ctx, plan)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	for _, r := range plan {
+		how := "interpolated"
+		switch {
+		case r.NewUTS == 0:
+			how = "unresolved"
+			out.Unresolved++
+		case r.Refetched:
+			how = "refetched"
+			out.Refetched++
+		default:
+			out.Interpolated++
+		}
+		out.Repairs = append(out.Repairs, dateRepair{Artist: r.Artist, Track: r.Track, OldUTS: r.PlayedAtUTS, NewUTS: r.NewUTS, How: how})
+	}
+	if c.DryRun {
+		log.Infof("repair-dates dry run: would date %d of %d suspect scrobbles", res.Rows, out.Suspect)
+	} else {
+		log.Infof("repair-dates: dated %d of %d suspect scrobbles (recorded in edits)", res.Rows, out.Suspect)
+		// The repaired plays join charts already drawn.
+		if res.Rows > 0 {
+			if err := rechartFrom(ctx, log, s, res.MinPlayed); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return 1
+			}
+		}
+	}
+
+	if c.Format == "json" {
+		err = writeJSON(os.Stdout, out, c.Pretty)
+	} else {
+		err = writeRepairDatesText(os.Stdout, out, s.Location())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// refetchDates looks for each plan entry with neighbours in the page of
+// scrobbles Last.fm lists before the later one: a play of the same track
+// dated after the earlier one, and not stored already, gives its date.
+// Entries sharing neighbours share the page, and each play found is used
+// once.
+func refetchDates(ctx context.Context, client *lastfm.Client, s *store.Store, plan []store.DateRepair) error {
+	pages := map[int64][]lastfm.Track{}
+	used := map[string]bool{}
+	for i := range plan {
+		r := &plan[i]
+		if r.Before == 0 || r.After == 0 {
+			continue
+		}
+		from, to := min(r.Before, r.After), max(r.Before, r.After)
+		tracks, ok := pages[to]
+		if !ok {
+			for p, err := range client.RecentTrackPagesBefore(ctx, lastfm.RecentTracksOptions{}, to+1) {
+				if err != nil {
+					return err
+				}
+				tracks = p.Tracks
+				break
+			}
+			pages[to] = tracks
+		}
+		for _, t := range tracks {
+			if t.Date == nil || !strings.EqualFold(t.Artist.Text, r.Artist) || !strings.EqualFold(t.Name, r.Track) {
+				continue
+			}
+			uts, err := strconv.ParseInt(t.Date.UTS, 10, 64)
+			key := t.Date.UTS + "|" + t.Artist.Text + "|" + t.Name
+			if err != nil || uts <= from || uts >= to || used[key] {
+				continue
+			}
+			stored, err := s.HasScrobble(ctx, uts, t.Artist.Text, t.Name)
+			if err != nil {
+				return err
+			}
+			if stored {
+				continue
+			}
+			used[key] = true
+			r.NewUTS, r.Refetched = uts, true
+			break
+		}
+	}
+	return nil
+}
+
+// writeRepairDatesText prints a line per suspect scrobble, then the totals.
+func writeRepairDatesText(w io.Writer, out repairDatesOut, loc *time.Location) error {
+	var b strings.Builder
+	for _, r := range out.Repairs {
+		when := "-"
+		if r.NewUTS != 0 {
+			when = time.Unix(r.NewUTS, 0).In(loc).Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(&b, "%s  %-12s  %s - %s\n", when, r.How, r.Artist, r.Track)
+	}
+	fmt.Fprintf(&b, "%d suspect: %d refetched, %d interpolated, %d unresolved\n", out.Suspect, out.Refetched, out.Interpolated, out.Unresolved)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/report"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// cmdReport writes a self-contained index.html into the --out directory.
+func cmdReport(ctx context.Context, log logx.Logger, c config.Config, s *store.Store) int {
+	if c.Out == "" {
+		fmt.Fprintln(os.Stderr, "error: report needs --out <dir>")
+		return 2
+	}
+
+	opt := report.DefaultOptions()
+	opt.Digest.Filter = c.Filter
+	opt.Digest.Location = c.Location
+	if c.Username != "" {
+		opt.Title = c.Username + "'s listening stats"
+	}
+	r, err := report.Build(ctx, s, opt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	var buf bytes.Buffer
+	if err := report.Render(&buf, r); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	if err := os.MkdirAll(c.Out, 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	path := filepath.Join(c.Out, "index.html")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	log.Infof("report: wrote %s (%d bytes)", path, buf.Len())
+	return 0
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// cmdRollup rebuilds the daily rollups. Triggers keep them current, so this
+// is for repairing them, e.g. after editing the database by hand.
+func cmdRollup(ctx context.Context, log logx.Logger, s *store.Store) int {
+	start := time.Now()
+	if err := s.RebuildRollups(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	log.Infof("rollup: rebuilt daily play totals in %s", time.Since(start).Round(time.Millisecond))
+	return 0
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/joshp123/lastfm-golang/digest"
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/jsonschema"
+	"github.com/joshp123/lastfm-golang/recommend"
+)
+
+// schemaOutputs are the JSON outputs schema describes, by the name it
+// takes: digest, digest --compare and recommend.
+var schemaOutputs = map[string]any{
+	"digest":     digest.Digest{},
+	"comparison": digest.Comparison{},
+	"recommend":  recommend.Output{},
+}
+
+// cmdSchema prints the JSON Schema of one output, or of all of them keyed
+// by name: schema [digest|comparison|recommend]. It describes the default
+// --encoding json.
+func cmdSchema(c config.Config) int {
+	names := slices.Sorted(maps.Keys(schemaOutputs))
+	if len(c.Args) > 1 {
+		fmt.Fprintf(os.Stderr, "error: usage: schema [%s]\n", strings.Join(names, "|"))
+		return 2
+	}
+
+	var out any
+	if len(c.Args) == 1 {
+		v, ok := schemaOutputs[c.Args[0]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "error: unknown output %q (expected %s)\n", c.Args[0], strings.Join(names, ", "))
+			return 2
+		}
+		out = jsonschema.Generate(v, c.Args[0])
+	} else {
+		all := map[string]*jsonschema.Schema{}
+		for _, name := range names {
+			all[name] = jsonschema.Generate(schemaOutputs[name], name)
+		}
+		out = all
+	}
+	if err := writeJSON(os.Stdout, out, c.Pretty); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
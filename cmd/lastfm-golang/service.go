@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/internal/notify"
+	"github.com/joshp123/lastfm-golang/internal/xdg"
+)
+
+// serviceName and digestServiceName name the systemd units install-service
+// writes.
+const (
+	serviceName       = "lastfm-golang-sync"
+	digestServiceName = "lastfm-golang-digest"
+)
+
+// cmdInstallService writes a user-level systemd service running sync, and a
+// timer starting it every --interval, into --out or the user unit dir; with
+// --email, also a service mailing the digest and a weekly timer for it. It
+// doesn't enable them; it prints the commands that do.
+func cmdInstallService(c config.Config) int {
+	if c.EnvFile == "" {
+		fmt.Fprintln(os.Stderr, "error: install-service needs --env-file with LASTFM_API_KEY and LASTFM_USERNAME; the service won't see your shell's environment")
+		return 2
+	}
+	if c.Email {
+		if _, err := notify.NewEmail(c.Notify); err != nil {
+			fmt.Fprintln(os.Stderr, "error: install-service --email:", err)
+			return 2
+		}
+	}
+	if c.Interval < time.Minute {
+		fmt.Fprintln(os.Stderr, "error: --interval must be at least 1m")
+		return 2
+	}
+	dir := c.Out
+	if dir == "" {
+		h, err := xdg.ConfigHome()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: resolve XDG config home:", err)
+			return 1
+		}
+		dir = filepath.Join(h, "systemd", "user")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	envFile, err1 := filepath.Abs(c.EnvFile)
+	dataDir, err2 := filepath.Abs(c.DataDir)
+	if err := errors.Join(err1, err2); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	args := []string{exe, "sync", "--quiet", "--env-file", envFile, "--data-dir", dataDir}
+	if c.HealthcheckURL != "" {
+		args = append(args, "--healthcheck-url", c.HealthcheckURL)
+	}
+	execStart := func(args []string) string {
+		quoted := make([]string, len(args))
+		for i, a := range args {
+			quoted[i] = systemdQuote(a)
+		}
+		return strings.Join(quoted, " ")
+	}
+	units := []struct{ name, body string }{
+		{serviceName + ".service", `[Unit]
+Description=Sync Last.fm scrobbles (lastfm-golang)
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=` + execStart(args) + `
+`},
+		{serviceName + ".timer", fmt.Sprintf(`[Unit]
+Description=Sync Last.fm scrobbles every %s (lastfm-golang)
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec=%ds
+RandomizedDelaySec=1min
+
+[Install]
+WantedBy=timers.target
+`, c.Interval, int64(c.Interval/time.Second))},
+	}
+
+	timers := []string{serviceName + ".timer"}
+	if c.Email {
+		digest := []string{exe, "digest", "--email", "--quiet", "--env-file", envFile, "--data-dir", dataDir}
+		units = append(units, []struct{ name, body string }{
+			{digestServiceName + ".service", `[Unit]
+Description=Mail the Last.fm listening digest (lastfm-golang)
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=` + execStart(digest) + `
+`},
+			{digestServiceName + ".timer", `[Unit]
+Description=Mail the Last.fm listening digest weekly (lastfm-golang)
+
+[Timer]
+OnCalendar=Mon *-*-* 08:00:00
+Persistent=true
+RandomizedDelaySec=10min
+
+[Install]
+WantedBy=timers.target
+`},
+		}...)
+		timers = append(timers, digestServiceName+".timer")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	for _, u := range units {
+		path := filepath.Join(dir, u.name)
+		if err := os.WriteFile(path, []byte(u.body), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		fmt.Fprintln(os.Stdout, "wrote", path)
+	}
+	fmt.Fprintf(os.Stdout, "enable with: systemctl --user daemon-reload && systemctl --user enable --now %s\n", strings.Join(timers, " "))
+	return 0
+}
+
+// systemdQuote quotes an ExecStart argument if it needs it: systemd splits
+// on whitespace and expands % specifiers and $ variables.
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// pingHealthcheck reports a sync's outcome to a healthchecks.io-style URL:
+// the URL itself on success, url/fail on failure, with the summary line as
+// the body for the check's log.
+func pingHealthcheck(ctx context.Context, url string, ok bool, body []byte) error {
+	if !ok {
+		url = strings.TrimSuffix(url, "/") + "/fail"
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("healthcheck ping: http %d: %s", resp.StatusCode, b)
+	}
+	return nil
+}
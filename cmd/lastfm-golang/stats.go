@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// statsOut is stats' JSON output. Sizes are in bytes; a file that doesn't
+// exist has none.
+type statsOut struct {
+	Scrobbles       int64            `json:"scrobbles"`
+	Suspect         int64            `json:"scrobbles_suspect"`
+	Artists         int64            `json:"artists"`
+	Tracks          int64            `json:"tracks"`
+	Albums          int64            `json:"albums"`
+	FirstUTS        int64            `json:"first_uts,omitempty"`
+	LastUTS         int64            `json:"last_uts,omitempty"`
+	PerDay          float64          `json:"per_day"`
+	BusiestDay      string           `json:"busiest_day,omitempty"`
+	BusiestDayPlays int64            `json:"busiest_day_plays,omitempty"`
+	Timezone        string           `json:"timezone"`
+	Files           map[string]int64 `json:"files"`
+}
+
+// statsFiles are the data dir files whose sizes stats reports. The
+// database counts its WAL too.
+var statsFiles = []string{store.DBFile, store.RawJSONLFile, store.RawPagesFile}
+
+// cmdStats prints a summary of the library as aligned text or, with
+// --format json, one JSON object.
+func cmdStats(ctx context.Context, c config.Config, s *store.Store) int {
+	if c.Format != "" && c.Format != "json" && c.Format != "text" {
+		fmt.Fprintln(os.Stderr, "error: invalid --format (expected text|json)")
+		return 2
+	}
+	sum, err := s.Summary(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	out := statsOut{
+		Scrobbles:       sum.Scrobbles,
+		Suspect:         sum.Suspect,
+		Artists:         sum.Artists,
+		Tracks:          sum.Tracks,
+		Albums:          sum.Albums,
+		FirstUTS:        sum.FirstUTS,
+		LastUTS:         sum.LastUTS,
+		BusiestDay:      sum.BusiestDay,
+		BusiestDayPlays: sum.BusiestDayPlays,
+		Timezone:        s.Location().String(),
+		Files:           map[string]int64{},
+	}
+	if sum.Days > 0 {
+		out.PerDay = math.Round(float64(sum.Scrobbles-sum.Suspect)/float64(sum.Days)*10) / 10
+	}
+	// Sync first so the raw JSONL's size includes buffered records.
+	if err := s.Sync(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	for _, name := range statsFiles {
+		size, ok := fileSize(filepath.Join(c.DataDir, name))
+		if name == store.DBFile {
+			wal, _ := fileSize(filepath.Join(c.DataDir, name+"-wal"))
+			size += wal
+		}
+		if ok {
+			out.Files[name] = size
+		}
+	}
+
+	if c.Format == "json" {
+		if err := writeJSON(os.Stdout, out, c.Pretty); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	scrobbles := fmt.Sprint(out.Scrobbles)
+	if out.Suspect > 0 {
+		scrobbles += fmt.Sprintf(" (%d with placeholder dates)", out.Suspect)
+	}
+	fmt.Fprintf(w, "scrobbles\t%s\n", scrobbles)
+	fmt.Fprintf(w, "artists\t%d\n", out.Artists)
+	fmt.Fprintf(w, "tracks\t%d\n", out.Tracks)
+	fmt.Fprintf(w, "albums\t%d\n", out.Albums)
+	if out.FirstUTS != 0 {
+		at := func(uts int64) string { return time.Unix(uts, 0).In(s.Location()).Format("2006-01-02 15:04 MST") }
+		fmt.Fprintf(w, "first scrobble\t%s\n", at(out.FirstUTS))
+		fmt.Fprintf(w, "last scrobble\t%s\n", at(out.LastUTS))
+		fmt.Fprintf(w, "per day\t%.1f\n", out.PerDay)
+		fmt.Fprintf(w, "busiest day\t%s (%d plays)\n", out.BusiestDay, out.BusiestDayPlays)
+	}
+	for _, name := range statsFiles {
+		if size, ok := out.Files[name]; ok {
+			fmt.Fprintf(w, "%s\t%s\n", name, formatBytes(uint64(size)))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// writeJSON writes v to w as one line of JSON, or indented with pretty.
+func writeJSON(w io.Writer, v any, pretty bool) error {
+	var b []byte
+	var err error
+	if pretty {
+		b, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		b, err = json.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func fileSize(path string) (int64, bool) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	return fi.Size(), true
+}
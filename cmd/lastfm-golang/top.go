@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// affinityMaxAge is how old stored affinity scores can be before top or
+// recommend --by affinity recompute them; sync does so every run.
+const affinityMaxAge = 24 * time.Hour
+
+// topOut is top's JSON output.
+type topOut struct {
+	By    string    `json:"by"`
+	Unit  string    `json:"unit"`
+	Items []topItem `json:"items"`
+}
+
+type topItem struct {
+	Rank   int    `json:"rank"`
+	Artist string `json:"artist"`
+	Track  string `json:"track,omitempty"`
+	Plays  int64  `json:"plays"`
+	// The rest are for --by affinity only.
+	Affinity float64 `json:"affinity,omitempty"`
+	Years    int     `json:"years,omitempty"`
+	Loved    int     `json:"loved,omitempty"`
+}
+
+// cmdTop ranks every artist (or track) of the archive by plays or by
+// affinity: top [artists|tracks] [--by plays|affinity]. Ignored plays are
+// left out, like in the digest.
+func cmdTop(ctx context.Context, c config.Config, s *store.Store) int {
+	unit := "artists"
+	if len(c.Args) == 1 && (c.Args[0] == "artists" || c.Args[0] == "tracks") {
+		unit = c.Args[0]
+	} else if len(c.Args) > 0 {
+		fmt.Fprintln(os.Stderr, "error: usage: top [artists|tracks] [--by plays|affinity] [--limit <n>] [--format text|json]")
+		return 2
+	}
+	by := c.By
+	if by == "" {
+		by = "plays"
+	}
+	if by != "plays" && by != "affinity" {
+		fmt.Fprintln(os.Stderr, "error: invalid --by (expected plays|affinity)")
+		return 2
+	}
+	if c.Format != "" && c.Format != "text" && c.Format != "json" {
+		fmt.Fprintln(os.Stderr, "error: invalid --format (expected text|json)")
+		return 2
+	}
+
+	f := c.Filter
+	f.HideIgnored = true
+	out := topOut{By: by, Unit: unit, Items: []topItem{}}
+	var err error
+	switch {
+	case by == "affinity":
+		if err = freshAffinity(ctx, s); err != nil {
+			break
+		}
+		var top []store.Affinity
+		top, err = s.TopAffinity(ctx, f, unit == "tracks", c.Limit)
+		for i, a := range top {
+			out.Items = append(out.Items, topItem{Rank: i + 1, Artist: a.Artist, Track: a.Track, Plays: a.Plays, Affinity: math.Round(a.Score*1000) / 1000, Years: a.Years, Loved: a.Loved})
+		}
+	case unit == "tracks":
+		var top []store.TrackCount
+		top, err = s.TopTracks(ctx, f, store.TimeRange{}, c.Limit)
+		for i, t := range top {
+			out.Items = append(out.Items, topItem{Rank: i + 1, Artist: t.Artist, Track: t.Track, Plays: t.Plays})
+		}
+	default:
+		var top []store.ArtistCount
+		top, err = s.TopArtists(ctx, f, store.TimeRange{}, c.Limit)
+		for i, a := range top {
+			out.Items = append(out.Items, topItem{Rank: i + 1, Artist: a.Artist, Plays: a.Plays})
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	if c.Format == "json" {
+		err = writeJSON(os.Stdout, out, c.Pretty)
+	} else {
+		err = writeTopText(os.Stdout, out)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// writeTopText prints a line per rank: the name, plays and, by affinity,
+// the score with the years and loved tracks behind it.
+func writeTopText(w io.Writer, out topOut) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, it := range out.Items {
+		name := it.Artist
+		if it.Track != "" {
+			name += " - " + it.Track
+		}
+		fmt.Fprintf(tw, "%d.\t%s\t%d %s", it.Rank, name, it.Plays, plural(int(it.Plays), "play", "plays"))
+		if out.By == "affinity" {
+			fmt.Fprintf(tw, "\t%.2f\t%d %s", it.Affinity, it.Years, plural(it.Years, "year", "years"))
+			if it.Loved > 0 {
+				fmt.Fprintf(tw, ", %d loved", it.Loved)
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// freshAffinity recomputes the stored affinity scores if they are older
+// than affinityMaxAge.
+func freshAffinity(ctx context.Context, s *store.Store) error {
+	at, err := s.AffinityComputedAt(ctx)
+	if err != nil {
+		return err
+	}
+	if time.Since(at) < affinityMaxAge {
+		return nil
+	}
+	return s.RefreshAffinity(ctx, time.Now())
+}
+
+// syncAffinity replaces the stored loved tracks with Last.fm's, then
+// recomputes the affinity scores. Scores are recomputed even if the loved
+// tracks can't be fetched; the error is returned all the same.
+func syncAffinity(ctx context.Context, client *lastfm.Client, s *store.Store) error {
+	var loved []store.LovedTrack
+	var lovedErr error
+	for page, pages := 1, 1; page <= pages; page++ {
+		var tracks []lastfm.LovedTrack
+		tracks, pages, lovedErr = client.GetLovedTracks(ctx, s.User(), page, lastfm.MaxRecentTracksLimit)
+		if lovedErr != nil {
+			break
+		}
+		for _, t := range tracks {
+			var uts int64
+			if t.Date != nil {
+				uts, _ = strconv.ParseInt(t.Date.UTS, 10, 64)
+			}
+			loved = append(loved, store.LovedTrack{Artist: t.Artist.Name, Track: t.Name, LovedAtUTS: uts})
+		}
+	}
+	if lovedErr == nil {
+		lovedErr = s.SetLovedTracks(ctx, loved)
+	}
+	return errors.Join(lovedErr, s.RefreshAffinity(ctx, time.Now()))
+}
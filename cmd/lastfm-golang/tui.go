@@ -0,0 +1,523 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"github.com/joshp123/lastfm-golang/internal/logx"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// nowPlayingEvery is how often the dashboard polls Last.fm for the current track.
+const nowPlayingEvery = 30 * time.Second
+
+// statusWriter keeps the last line logged so the dashboard can show it in
+// its footer instead of scribbling over the screen.
+type statusWriter struct {
+	mu   sync.Mutex
+	line string
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if s := strings.TrimSpace(string(p)); s != "" {
+		if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+			s = s[i+1:]
+		}
+		w.mu.Lock()
+		w.line = s
+		w.mu.Unlock()
+	}
+	return len(p), nil
+}
+
+func (w *statusWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.line
+}
+
+type nameCount struct {
+	Name  string
+	Plays int64
+}
+
+type dashData struct {
+	Total    int64
+	Newest   int64
+	LastSync time.Time
+	Pending  string
+	Top      []nameCount
+	Recent   []store.Scrobble
+}
+
+type artistStats struct {
+	Name       string
+	Plays      int64
+	PlaysMonth int64
+	First      int64
+	Last       int64
+	Tracks     []nameCount
+	Years      []nameCount
+}
+
+type dashboard struct {
+	user       string
+	canSync    bool
+	data       dashData
+	nowPlaying string
+	syncing    bool
+	selected   int
+	artist     *artistStats
+	message    string
+}
+
+func cmdTUI(ctx context.Context, log logx.Logger, client *lastfm.Client, s *store.Store) int {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Fprintln(os.Stderr, "error: tui needs an interactive terminal")
+		return 2
+	}
+	status, _ := log.Out.(*statusWriter)
+	if status == nil {
+		status = new(statusWriter)
+		log.Out = status
+	}
+
+	d := &dashboard{canSync: client != nil && client.Username() != ""}
+	if d.canSync {
+		d.user = client.Username()
+	} else {
+		d.message = "read-only: set an api key and username to enable sync and now playing"
+	}
+	if err := d.reload(ctx, s); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	old, err := term.MakeRaw(fd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	defer term.Restore(fd, old)
+	fmt.Fprint(os.Stdout, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(os.Stdout, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+
+	type syncResult struct {
+		inserted int
+		err      error
+	}
+	syncDone := make(chan syncResult, 1)
+	nowPlaying := make(chan string, 1)
+	pollNowPlaying := func() {
+		if !d.canSync {
+			return
+		}
+		go func() {
+			nowPlaying <- fetchNowPlaying(ctx, client)
+		}()
+	}
+	pollNowPlaying()
+
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	lastPoll := time.Now()
+
+	for {
+		d.draw(os.Stdout, status.String())
+		select {
+		case <-ctx.Done():
+			return exitInterrupted
+		case <-tick.C:
+			if time.Since(lastPoll) >= nowPlayingEvery {
+				lastPoll = time.Now()
+				pollNowPlaying()
+			}
+		case np := <-nowPlaying:
+			d.nowPlaying = np
+		case r := <-syncDone:
+			d.syncing = false
+			if r.err != nil {
+				d.message = "sync failed: " + r.err.Error()
+			} else {
+				d.message = fmt.Sprintf("sync done: %d new scrobbles", r.inserted)
+			}
+			if err := d.reload(ctx, s); err != nil {
+				d.message = "error: " + err.Error()
+			}
+		case k := <-keys:
+			switch k {
+			case "q", "ctrl-c":
+				return 0
+			case "up", "k":
+				if d.artist == nil && d.selected > 0 {
+					d.selected--
+				}
+			case "down", "j":
+				if d.artist == nil && d.selected < len(d.data.Top)-1 {
+					d.selected++
+				}
+			case "enter", "l":
+				if d.artist == nil && d.selected < len(d.data.Top) {
+					a, err := loadArtistStats(ctx, s, d.data.Top[d.selected].Name, monthStart(time.Now()))
+					if err != nil {
+						d.message = "error: " + err.Error()
+						break
+					}
+					d.artist = &a
+				}
+			case "esc", "backspace", "h":
+				d.artist = nil
+			case "r":
+				if err := d.reload(ctx, s); err != nil {
+					d.message = "error: " + err.Error()
+				}
+				lastPoll = time.Now()
+				pollNowPlaying()
+			case "s":
+				if !d.canSync || d.syncing {
+					break
+				}
+				d.syncing = true
+				d.message = "syncing…"
+				go func() {
+					inserted, _, err := syncRecent(ctx, log, client, s, lastfm.DefaultRecentTracksLimit, false, nil)
+					if err == nil {
+						_, err = s.UpdateArtistRankHistory(ctx, time.Now())
+					}
+					syncDone <- syncResult{inserted, err}
+				}()
+			}
+		}
+	}
+}
+
+func (d *dashboard) reload(ctx context.Context, s *store.Store) error {
+	data, err := loadDashboard(ctx, s, monthStart(time.Now()), 50)
+	if err != nil {
+		return err
+	}
+	d.data = data
+	d.selected = min(d.selected, max(len(data.Top)-1, 0))
+	return nil
+}
+
+func monthStart(now time.Time) time.Time {
+	y, m, _ := now.Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+}
+
+func fetchNowPlaying(ctx context.Context, client *lastfm.Client) string {
+	p, err := client.GetRecentTracksPage(ctx, 1, 1)
+	if err != nil {
+		return "(unavailable: " + err.Error() + ")"
+	}
+	for _, t := range p.Tracks {
+		if t.Attr.NowPlaying == "true" {
+			return t.Artist.Text + " — " + t.Name
+		}
+	}
+	return ""
+}
+
+// readKeys decodes terminal input into key names. It runs until stdin is
+// closed; the process exits before that in practice.
+func readKeys(r io.Reader, out chan<- string) {
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		b := buf[:n]
+		for len(b) > 0 {
+			switch {
+			case len(b) >= 3 && b[0] == 0x1b && b[1] == '[':
+				switch b[2] {
+				case 'A':
+					out <- "up"
+				case 'B':
+					out <- "down"
+				case 'C':
+					out <- "enter"
+				case 'D':
+					out <- "esc"
+				}
+				b = b[3:]
+				continue
+			case b[0] == 0x1b:
+				out <- "esc"
+			case b[0] == 3:
+				out <- "ctrl-c"
+			case b[0] == '\r' || b[0] == '\n':
+				out <- "enter"
+			case b[0] == 127 || b[0] == 8:
+				out <- "backspace"
+			default:
+				out <- string(b[0])
+			}
+			b = b[1:]
+		}
+	}
+}
+
+func (d *dashboard) draw(w io.Writer, logLine string) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < 20 || height < 8 {
+		width, height = 80, 24
+	}
+
+	var lines []string
+	header := "lastfm-golang"
+	if d.user != "" {
+		header += " · " + d.user
+	}
+	header += fmt.Sprintf(" · %d scrobbles", d.data.Total)
+	lines = append(lines, "\x1b[1m"+fit(header, width)+"\x1b[0m")
+
+	np := d.nowPlaying
+	if np == "" {
+		np = "—"
+	}
+	lines = append(lines, fit("Now playing: "+np, width))
+
+	syncLine := "Sync: never"
+	if !d.data.LastSync.IsZero() {
+		syncLine = "Sync: last " + ago(time.Since(d.data.LastSync))
+	}
+	if d.data.Newest > 0 {
+		syncLine += " · newest scrobble " + time.Unix(d.data.Newest, 0).Local().Format("2006-01-02 15:04")
+	}
+	if d.syncing {
+		syncLine += " · syncing…"
+	}
+	if d.data.Pending != "" {
+		syncLine += " · " + d.data.Pending
+	}
+	lines = append(lines, fit(syncLine, width), "")
+
+	body := height - len(lines) - 2
+	if d.artist != nil {
+		lines = append(lines, d.artistLines(width, body)...)
+	} else {
+		lines = append(lines, d.mainLines(width, body)...)
+	}
+	for len(lines) < height-2 {
+		lines = append(lines, "")
+	}
+
+	msg := d.message
+	if logLine != "" && d.syncing {
+		msg = logLine
+	}
+	help := "↑↓ select  enter artist  s sync  r refresh  q quit"
+	if d.artist != nil {
+		help = "esc back  s sync  r refresh  q quit"
+	}
+	lines = append(lines, fit(msg, width), "\x1b[2m"+fit(help, width)+"\x1b[0m")
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, l := range lines[:height] {
+		b.WriteString(l)
+		b.WriteString("\x1b[K")
+		if i < height-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	io.WriteString(w, b.String())
+}
+
+func (d *dashboard) mainLines(width, rows int) []string {
+	left := width / 2
+	right := width - left - 3
+	title := "Top artists · " + time.Now().Format("January")
+	out := []string{"\x1b[1m" + pad(title, left) + "\x1b[0m │ \x1b[1m" + fit("Recent scrobbles", right) + "\x1b[0m"}
+
+	// Keep the selection on screen when the list is longer than the pane.
+	offset := 0
+	if d.selected >= rows-1 {
+		offset = d.selected - (rows - 2)
+	}
+	for i := 0; i < rows-1; i++ {
+		var l, r string
+		if j := offset + i; j < len(d.data.Top) {
+			a := d.data.Top[j]
+			l = pad(fmt.Sprintf("  %2d. %s", j+1, a.Name), left-7) + fmt.Sprintf("%7d", a.Plays)
+			if j == d.selected {
+				l = "\x1b[7m" + pad("> "+l[2:], left) + "\x1b[0m"
+			} else {
+				l = pad(l, left)
+			}
+		} else {
+			l = pad("", left)
+		}
+		if i < len(d.data.Recent) {
+			sc := d.data.Recent[i]
+			r = fit(time.Unix(sc.PlayedAtUTS, 0).Local().Format("01-02 15:04")+"  "+sc.Artist+" — "+sc.Track, right)
+		}
+		out = append(out, l+" │ "+r)
+	}
+	return out
+}
+
+func (d *dashboard) artistLines(width, rows int) []string {
+	a := d.artist
+	out := []string{
+		"\x1b[1m" + fit(a.Name, width) + "\x1b[0m",
+		fit(fmt.Sprintf("%d plays · %d this month · first %s · last %s", a.Plays, a.PlaysMonth,
+			time.Unix(a.First, 0).Local().Format("2006-01-02"), time.Unix(a.Last, 0).Local().Format("2006-01-02")), width),
+		"",
+	}
+
+	left := width / 2
+	right := width - left - 3
+	out = append(out, "\x1b[1m"+pad("Top tracks", left)+"\x1b[0m │ \x1b[1m"+fit("Plays by year", right)+"\x1b[0m")
+	var most int64
+	for _, y := range a.Years {
+		most = max(most, y.Plays)
+	}
+	n := rows - len(out)
+	for i := 0; i < n; i++ {
+		l, r := pad("", left), ""
+		if i < len(a.Tracks) {
+			t := a.Tracks[i]
+			l = pad(pad(fmt.Sprintf("%2d. %s", i+1, t.Name), left-7)+fmt.Sprintf("%7d", t.Plays), left)
+		}
+		if i < len(a.Years) {
+			y := a.Years[i]
+			r = fit(fmt.Sprintf("%s %s %d", y.Name, logx.Bar(int(y.Plays), int(most), 20), y.Plays), right)
+		}
+		out = append(out, l+" │ "+r)
+	}
+	return out
+}
+
+func loadDashboard(ctx context.Context, s *store.Store, since time.Time, n int) (dashData, error) {
+	var d dashData
+	var err error
+	if d.Total, _, d.Newest, err = s.Stats(ctx); err != nil {
+		return d, err
+	}
+	if v, err := s.GetState(ctx, syncLastKey); err != nil {
+		return d, err
+	} else if v != "" {
+		d.LastSync, _ = time.Parse(time.RFC3339, v)
+	}
+	if v, err := s.GetState(ctx, backfillCheckpointKey); err != nil {
+		return d, err
+	} else if before, err := parseI64(v); err == nil && v != "" {
+		d.Pending = "backfill interrupted at " + time.Unix(before, 0).Local().Format("2 Jan 2006")
+	} else if v, err := s.GetState(ctx, syncCheckpointKey); err != nil {
+		return d, err
+	} else if v != "" {
+		d.Pending = "sync interrupted"
+	}
+
+	top, err := s.TopArtists(ctx, store.Filter{HideIgnored: true}, store.TimeRange{From: since.Unix()}, n)
+	if err != nil {
+		return d, err
+	}
+	for _, a := range top {
+		d.Top = append(d.Top, nameCount{Name: a.Artist, Plays: a.Plays})
+	}
+	d.Recent, err = s.RecentScrobbles(ctx, store.Filter{}, n)
+	return d, err
+}
+
+func loadArtistStats(ctx context.Context, s *store.Store, artist string, since time.Time) (artistStats, error) {
+	a := artistStats{Name: artist}
+	var first, last sql.NullInt64
+	mine := store.Filter{User: s.User()}
+	q, args := mine.Scope(`
+SELECT COUNT(*), SUM(played_at_uts >= ?), MIN(played_at_uts), MAX(played_at_uts)
+FROM scrobbles
+WHERE artist_name = ?
+`, since.Unix(), artist)
+	if err := s.DB.QueryRowContext(ctx, q, args...).Scan(&a.Plays, &a.PlaysMonth, &first, &last); err != nil {
+		return a, err
+	}
+	a.First, a.Last = nullI64(first), nullI64(last)
+
+	var err error
+	if a.Tracks, err = queryCounts(ctx, s.DB, mine, `
+SELECT track_name, COUNT(*) AS plays
+FROM scrobbles
+WHERE artist_name = ?
+GROUP BY track_name
+ORDER BY plays DESC, track_name ASC
+LIMIT 50
+`, artist); err != nil {
+		return a, err
+	}
+	a.Years, err = queryCounts(ctx, s.DB, mine, `
+SELECT CAST(played_year_local AS TEXT) AS year, COUNT(*)
+FROM scrobbles
+WHERE artist_name = ?
+GROUP BY year
+ORDER BY year DESC
+`, artist)
+	return a, err
+}
+
+func queryCounts(ctx context.Context, db *sql.DB, f store.Filter, q string, args ...any) ([]nameCount, error) {
+	q, args = f.Scope(q, args...)
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []nameCount
+	for rows.Next() {
+		var c nameCount
+		if err := rows.Scan(&c.Name, &c.Plays); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func ago(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
+
+// fit truncates s to width runes.
+func fit(s string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:width-1]) + "…"
+}
+
+// pad truncates or right-pads s to exactly width runes.
+func pad(s string, width int) string {
+	s = fit(s, width)
+	return s + strings.Repeat(" ", max(width-utf8.RuneCountInString(s), 0))
+}
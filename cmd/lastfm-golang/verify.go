@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/internal/config"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// verifyRemoteMinDiff is how far local and Last.fm counts may drift before
+// an entry is flagged; Last.fm rebuilds its period charts with some lag, so
+// recent plays can be missing from either side.
+const verifyRemoteMinDiff = 2
+
+// remoteEntry is one row of a Last.fm user chart.
+type remoteEntry struct {
+	artist, track, album string
+	plays                int64
+}
+
+// verifyIsRemote reports whether verify will call Last.fm.
+func verifyIsRemote(args []string) bool {
+	for _, a := range args {
+		if a == "--remote" || a == "-remote" || a == "--remote=true" || a == "-remote=true" {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyOut is verify's result; --format json prints it as is.
+type verifyOut struct {
+	ScrobblesTotal   int64 `json:"scrobbles_total"`
+	ScrobblesDated   int64 `json:"scrobbles_dated"`
+	ScrobblesSuspect int64 `json:"scrobbles_suspect"`
+	MinUTS           int64 `json:"min_uts"`
+	MaxUTS           int64 `json:"max_uts"`
+	DatedMinUTS      int64 `json:"dated_min_uts"`
+	DatedMaxUTS      int64 `json:"dated_max_uts"`
+	// LastSyncUTS is when the latest journaled sync ended, with its exit
+	// code; LastSyncOKUTS when one last succeeded. 0 if none did.
+	LastSyncUTS   int64         `json:"last_sync_uts"`
+	LastSyncExit  int           `json:"last_sync_exit"`
+	LastSyncOKUTS int64         `json:"last_sync_ok_uts"`
+	Remote        []remoteCheck `json:"remote,omitempty"`
+}
+
+// remoteCheck is one Last.fm chart compared by verify --remote.
+type remoteCheck struct {
+	Period    string          `json:"period"`
+	Kind      string          `json:"kind"`
+	Checked   int             `json:"checked"`
+	Diverging []remoteDiverge `json:"diverging"`
+}
+
+type remoteDiverge struct {
+	Artist string `json:"artist"`
+	Track  string `json:"track,omitempty"`
+	Album  string `json:"album,omitempty"`
+	Local  int64  `json:"local"`
+	Remote int64  `json:"remote"`
+	Diff   int64  `json:"diff"`
+}
+
+// writeText prints v as verify always has: a key=value line of counts,
+// then per remote chart a summary line and a line per diverging entry.
+func (v verifyOut) writeText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w,
+		"scrobbles_total=%d scrobbles_dated=%d scrobbles_suspect=%d min_uts=%d max_uts=%d dated_min_uts=%d dated_max_uts=%d last_sync_uts=%d last_sync_exit=%d last_sync_ok_uts=%d\n",
+		v.ScrobblesTotal, v.ScrobblesDated, v.ScrobblesSuspect, v.MinUTS, v.MaxUTS, v.DatedMinUTS, v.DatedMaxUTS, v.LastSyncUTS, v.LastSyncExit, v.LastSyncOKUTS,
+	); err != nil {
+		return err
+	}
+	for _, r := range v.Remote {
+		if _, err := fmt.Fprintf(w, "remote period=%s kind=%s checked=%d diverging=%d\n", r.Period, r.Kind, r.Checked, len(r.Diverging)); err != nil {
+			return err
+		}
+		for _, d := range r.Diverging {
+			line := fmt.Sprintf("diverging period=%s kind=%s artist=%q", r.Period, r.Kind, d.Artist)
+			if d.Track != "" {
+				line += fmt.Sprintf(" track=%q", d.Track)
+			}
+			if d.Album != "" {
+				line += fmt.Sprintf(" album=%q", d.Album)
+			}
+			if _, err := fmt.Fprintf(w, "%s local=%d remote=%d diff=%d\n", line, d.Local, d.Remote, d.Diff); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// verifyRemote compares Last.fm's own all-time and 12-month top artists,
+// tracks and albums with counts from synced scrobbles. Local < remote
+// means plays are missing locally, local > remote usually duplicates.
+func verifyRemote(ctx context.Context, c config.Config, client *lastfm.Client, s *store.Store) ([]remoteCheck, error) {
+	now := time.Now().UTC()
+	periods := []struct {
+		name  string
+		since int64
+	}{
+		{lastfm.PeriodOverall, 0},
+		{lastfm.Period12Month, now.AddDate(-1, 0, 0).Unix()},
+	}
+
+	var out []remoteCheck
+	for _, p := range periods {
+		for _, kind := range []string{"artists", "tracks", "albums"} {
+			entries, err := remoteChart(ctx, client, kind, p.name, c.Limit)
+			if err != nil {
+				return nil, err
+			}
+			check := remoteCheck{Period: p.name, Kind: kind, Checked: len(entries), Diverging: []remoteDiverge{}}
+			for _, e := range entries {
+				local, err := s.SyncedPlays(ctx, e.artist, e.track, e.album, p.since)
+				if err != nil {
+					return nil, err
+				}
+				diff := local - e.plays
+				if max(diff, -diff) <= max(verifyRemoteMinDiff, e.plays/50) {
+					continue
+				}
+				check.Diverging = append(check.Diverging, remoteDiverge{Artist: e.artist, Track: e.track, Album: e.album, Local: local, Remote: e.plays, Diff: diff})
+			}
+			out = append(out, check)
+		}
+	}
+	return out, nil
+}
+
+// remoteChart fetches the configured user's top artists, tracks or albums
+// for period.
+func remoteChart(ctx context.Context, client *lastfm.Client, kind, period string, limit int) ([]remoteEntry, error) {
+	var out []remoteEntry
+	switch kind {
+	case "artists":
+		artists, err := client.GetUserTopArtists(ctx, "", period, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range artists {
+			out = append(out, remoteEntry{artist: a.Name, plays: chartCount(a.PlayCount)})
+		}
+	case "tracks":
+		tracks, err := client.GetUserTopTracks(ctx, "", period, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tracks {
+			out = append(out, remoteEntry{artist: t.Artist.Name, track: t.Name, plays: chartCount(t.PlayCount)})
+		}
+	case "albums":
+		albums, err := client.GetUserTopAlbums(ctx, "", period, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range albums {
+			out = append(out, remoteEntry{artist: a.Artist.Name, album: a.Name, plays: chartCount(a.PlayCount)})
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,86 @@
+package digest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// cacheVersion is part of every cache key. Bump it when Build computes
+// something different from the same data, so stale digests aren't reused.
+const cacheVersion = 6
+
+// cacheStatePrefix is the state key prefix of cached digests; the rest is
+// the hash of their options.
+const cacheStatePrefix = "digest.cache."
+
+// BuildCached is Build, reusing the digest an earlier call with the same
+// options stored in the store's state when nothing it reads has changed
+// (store.DataVersion) and it is still the same day where the windows are
+// counted. Only Meta.GeneratedAt is new on reuse. It reports whether the
+// digest came from the cache.
+func BuildCached(ctx context.Context, s *store.Store, opt Options) (Digest, bool, error) {
+	loc := opt.Location
+	if loc == nil {
+		loc = s.Location()
+	}
+	f := opt.Filter
+	f.User = s.User()
+	version, err := s.DataVersion(ctx, f)
+	if err != nil {
+		return Digest{}, false, err
+	}
+	key, err := cacheKey(opt, loc)
+	if err != nil {
+		return Digest{}, false, err
+	}
+	stamp := version + " " + time.Now().In(loc).Format("2006-01-02")
+
+	cached, err := s.GetState(ctx, key)
+	if err != nil {
+		return Digest{}, false, err
+	}
+	if head, body, ok := strings.Cut(cached, "\n"); ok && head == stamp {
+		var d Digest
+		if err := json.Unmarshal([]byte(body), &d); err == nil {
+			d.Meta.GeneratedAt = time.Now().UTC()
+			return d, true, nil
+		}
+	}
+
+	d, err := Build(ctx, s, opt)
+	if err != nil {
+		return Digest{}, false, err
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return Digest{}, false, err
+	}
+	return d, false, s.SetState(ctx, key, stamp+"\n"+string(b))
+}
+
+// cacheKey names the state entry for digests built with opt in loc.
+// Sections count by name.
+func cacheKey(opt Options, loc *time.Location) (string, error) {
+	var sections []string
+	for _, sec := range extensionSections(opt.Sections) {
+		sections = append(sections, sec.Name())
+	}
+	opt.Sections, opt.Location = nil, nil
+	b, err := json.Marshal(struct {
+		Version  int
+		Options  Options
+		Sections []string
+		Location string
+	}{cacheVersion, opt, sections, loc.String()})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return cacheStatePrefix + hex.EncodeToString(sum[:8]), nil
+}
@@ -0,0 +1,96 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+func TestBuildCachedReusesUntilDataChanges(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.Open(ctx, store.OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	uts := time.Now().Add(-48 * time.Hour).Unix()
+	play := func(artist string) {
+		t.Helper()
+		uts++
+		tr := lastfm.Track{Name: "t", Artist: lastfm.TextMBID{Text: artist}, Date: &lastfm.Date{UTS: strconv.FormatInt(uts, 10)}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	build := func(opt Options, wantCached bool, wantTop string) {
+		t.Helper()
+		d, cached, err := BuildCached(ctx, s, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cached != wantCached {
+			t.Fatalf("cached = %v, want %v", cached, wantCached)
+		}
+		if got := fmt.Sprint(d.Top.Artists30d); got != wantTop {
+			t.Fatalf("top artists = %s, want %s", got, wantTop)
+		}
+	}
+
+	play("Burial")
+	play("Kode9")
+	opt := DefaultOptions()
+	build(opt, false, "[{1 Burial 1} {2 Kode9 1}]")
+	build(opt, true, "[{1 Burial 1} {2 Kode9 1}]")
+
+	play("Burial")
+	build(opt, false, "[{1 Burial 2} {2 Kode9 1}]")
+
+	if _, err := s.AddIgnore(ctx, "Burial", ""); err != nil {
+		t.Fatal(err)
+	}
+	build(opt, false, "[{1 Kode9 1}]")
+
+	// Other options are cached apart.
+	opt.Filter.HideIgnored = false
+	build(opt, false, "[{1 Burial 2} {2 Kode9 1}]")
+	build(opt, true, "[{1 Burial 2} {2 Kode9 1}]")
+	build(DefaultOptions(), true, "[{1 Kode9 1}]")
+}
+
+func TestBuildCachedFollowsMinSaneDate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	now := time.Now()
+	build := func(minSane int64, wantCached bool, wantTop string) {
+		t.Helper()
+		s, err := store.Open(ctx, store.OpenOptions{DataDir: dir, MinSaneUTS: minSane})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		if minSane == 0 {
+			for i, artist := range []string{"Burial", "Kode9"} {
+				tr := lastfm.Track{Name: "t", Artist: lastfm.TextMBID{Text: artist}, Date: &lastfm.Date{UTS: strconv.FormatInt(now.Add(time.Duration(i-2)*24*time.Hour).Unix(), 10)}}
+				if _, err := s.InsertScrobble(ctx, tr); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		d, cached, err := BuildCached(ctx, s, DefaultOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(d.Top.Artists30d); cached != wantCached || got != wantTop {
+			t.Fatalf("cached = %v, top artists = %s; want %v, %s", cached, got, wantCached, wantTop)
+		}
+	}
+	build(0, false, "[{1 Kode9 1} {2 Burial 1}]")
+	// Burial's play, two days ago, is a placeholder now.
+	build(now.Add(-36*time.Hour).Unix(), false, "[{1 Kode9 1}]")
+	build(0, true, "[{1 Kode9 1}]")
+}
@@ -0,0 +1,182 @@
+package digest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// EncodeColumnar is EncodeJSON with every array of objects written as a
+// table, {"columns": [...], "rows": [[...], ...]}, so the keys appear once
+// instead of once per entry. Columns are the keys in the order first seen;
+// an entry without one (an omitted empty field) has null there. Key order
+// and everything else is as EncodeJSON writes it.
+func EncodeColumnar(v any, pretty bool) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	tree, err := readNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := writeNode(&out, tree); err != nil {
+		return nil, err
+	}
+	if !pretty {
+		return out.Bytes(), nil
+	}
+	var ind bytes.Buffer
+	err = json.Indent(&ind, out.Bytes(), "", "  ")
+	return ind.Bytes(), err
+}
+
+// node is a decoded JSON value that keeps its object keys in order: an
+// object, an array, or a scalar token.
+type node struct {
+	keys   []string
+	fields []*node
+	items  []*node
+	object bool
+	array  bool
+	scalar any
+}
+
+func readNode(dec *json.Decoder) (*node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		n := &node{object: true}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := readNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.keys = append(n.keys, key.(string))
+			n.fields = append(n.fields, v)
+		}
+		_, err = dec.Token()
+		return n, err
+	case json.Delim('['):
+		n := &node{array: true}
+		for dec.More() {
+			v, err := readNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, v)
+		}
+		_, err = dec.Token()
+		return n, err
+	}
+	return &node{scalar: tok}, nil
+}
+
+func writeNode(w *bytes.Buffer, n *node) error {
+	switch {
+	case n.object:
+		w.WriteByte('{')
+		for i, k := range n.keys {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := writeScalar(w, k); err != nil {
+				return err
+			}
+			w.WriteByte(':')
+			if err := writeNode(w, n.fields[i]); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('}')
+	case n.array && isTable(n):
+		return writeTable(w, n)
+	case n.array:
+		w.WriteByte('[')
+		for i, v := range n.items {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := writeNode(w, v); err != nil {
+				return err
+			}
+		}
+		w.WriteByte(']')
+	default:
+		return writeScalar(w, n.scalar)
+	}
+	return nil
+}
+
+// isTable reports whether n is a non-empty array of objects only.
+func isTable(n *node) bool {
+	for _, v := range n.items {
+		if !v.object {
+			return false
+		}
+	}
+	return len(n.items) > 0
+}
+
+func writeTable(w *bytes.Buffer, n *node) error {
+	var columns []string
+	index := map[string]int{}
+	for _, row := range n.items {
+		for _, k := range row.keys {
+			if _, ok := index[k]; !ok {
+				index[k] = len(columns)
+				columns = append(columns, k)
+			}
+		}
+	}
+	w.WriteString(`{"columns":`)
+	if err := writeScalar(w, columns); err != nil {
+		return err
+	}
+	w.WriteString(`,"rows":[`)
+	null := &node{}
+	for i, row := range n.items {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		cells := make([]*node, len(columns))
+		for j := range cells {
+			cells[j] = null
+		}
+		for j, k := range row.keys {
+			cells[index[k]] = row.fields[j]
+		}
+		w.WriteByte('[')
+		for j, c := range cells {
+			if j > 0 {
+				w.WriteByte(',')
+			}
+			if err := writeNode(w, c); err != nil {
+				return err
+			}
+		}
+		w.WriteByte(']')
+	}
+	w.WriteString("]}")
+	return nil
+}
+
+func writeScalar(w io.Writer, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("columnar: %w", err)
+	}
+	_, err = w.Write(b)
+	return err
+}
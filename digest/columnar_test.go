@@ -0,0 +1,43 @@
+package digest
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEncodeColumnar(t *testing.T) {
+	d := Digest{
+		Recent: []Scrobble{
+			{PlayedAtUTS: 2, Artist: "Burial", Track: "Archangel", Album: "Untrue"},
+			{PlayedAtUTS: 1, Artist: "Kode9", Track: "9 Samurai"},
+		},
+		RiseAndFall: RiseAndFall{Rising: []RankMove{{Artist: "Burial", Rank: 1, PrevRank: 4, Change: 3, Trajectory: []int{4, 1}}}, Falling: []RankMove{}},
+	}
+	b, err := EncodeColumnar(struct {
+		Recent      []Scrobble  `json:"recent"`
+		RiseAndFall RiseAndFall `json:"rise_and_fall"`
+	}{d.Recent, d.RiseAndFall}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"recent":{"columns":["played_at_uts","played_at","artist","track","album"],"rows":[[2,"","Burial","Archangel","Untrue"],[1,"","Kode9","9 Samurai",null]]},` +
+		`"rise_and_fall":{"rising":{"columns":["artist","rank","prev_rank","change","trajectory"],"rows":[["Burial",1,4,3,[4,1]]]},"falling":[]}}`
+	if string(b) != want {
+		t.Fatalf("columnar =\n%s\nwant\n%s", b, want)
+	}
+
+	for range 100 {
+		d.Recent = append(d.Recent, d.Recent[0])
+	}
+	full, err := EncodeJSON(d, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = EncodeColumnar(d, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !json.Valid(b) || len(b) > len(full)*2/3 {
+		t.Fatalf("columnar digest is invalid or not much smaller (%d vs %d bytes)", len(b), len(full))
+	}
+}
@@ -0,0 +1,166 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// compareWindowDays is the span Compare looks at, like Top.Artists365d.
+const compareWindowDays = 365
+
+// Comparison sets several users of one database side by side: who listens
+// to what, and how much of it they share.
+type Comparison struct {
+	Meta  CompareMeta   `json:"meta"`
+	Users []CompareUser `json:"users"`
+	// OverlapPct is the shared artists' share of every artist any of them
+	// played, in percent.
+	OverlapPct float64 `json:"overlap_pct"`
+	// Shared are the artists all of them played, most played in total first.
+	Shared []SharedArtist `json:"shared_artists"`
+}
+
+type CompareMeta struct {
+	SchemaVersion int       `json:"schema_version"`
+	GeneratedAt   time.Time `json:"generated_at"`
+	WindowDays    int       `json:"window_days"`
+	Timezone      string    `json:"timezone"`
+	Redacted      bool      `json:"redacted,omitempty"`
+}
+
+type CompareUser struct {
+	User      string `json:"user"`
+	Scrobbles int64  `json:"scrobbles"`
+	Artists   int    `json:"artists"`
+	// Only are the artists none of the others played.
+	Only []RankedArtist `json:"only_artists"`
+}
+
+type SharedArtist struct {
+	Rank   int    `json:"rank"`
+	Artist string `json:"artist"`
+	// Plays is each user's plays, by user.
+	Plays map[string]int64 `json:"plays"`
+}
+
+// Compare compares users, all held by s's database, over the last
+// compareWindowDays days as seen through opt.Filter. Artists match
+// case-insensitively; lists are cut at opt.TopArtistsLimit.
+func Compare(ctx context.Context, s *store.Store, users []string, opt Options) (Comparison, error) {
+	if len(users) < 2 {
+		return Comparison{}, fmt.Errorf("compare needs at least two users, got %d", len(users))
+	}
+	version, err := schemaVersion(opt.SchemaVersion)
+	if err != nil {
+		return Comparison{}, err
+	}
+	loc := opt.Location
+	if loc == nil {
+		loc = s.Location()
+	}
+	y, m, d := time.Now().In(loc).Date()
+	window := store.TimeRange{From: time.Date(y, m, d, 0, 0, 0, 0, loc).AddDate(0, 0, -compareWindowDays).Unix()}
+
+	out := Comparison{
+		Meta: CompareMeta{
+			SchemaVersion: version,
+			GeneratedAt:   time.Now().UTC(),
+			WindowDays:    compareWindowDays,
+			Timezone:      loc.String(),
+			Redacted:      opt.Filter.Redacts(),
+		},
+		Users:  []CompareUser{},
+		Shared: []SharedArtist{},
+	}
+	// plays[i] maps a folded artist name to user i's plays; names keeps
+	// the first spelling seen.
+	plays := make([]map[string]int64, len(users))
+	names := map[string]string{}
+	for i, name := range users {
+		v, err := s.ForUser(ctx, name)
+		if err != nil {
+			return Comparison{}, err
+		}
+		// A negative limit is no limit to SQLite.
+		artists, err := v.TopArtists(ctx, opt.Filter, window, -1)
+		if err != nil {
+			return Comparison{}, err
+		}
+		u := CompareUser{User: v.User()}
+		plays[i] = make(map[string]int64, len(artists))
+		for _, a := range artists {
+			key := store.NormalizeArtist(a.Artist)
+			plays[i][key] += a.Plays
+			if _, ok := names[key]; !ok {
+				names[key] = a.Artist
+			}
+			u.Scrobbles += a.Plays
+		}
+		u.Artists = len(plays[i])
+		out.Users = append(out.Users, u)
+	}
+
+	var shared []string
+	for key := range names {
+		in := 0
+		for _, p := range plays {
+			if p[key] > 0 {
+				in++
+			}
+		}
+		if in == len(plays) {
+			shared = append(shared, key)
+		}
+	}
+	if len(names) > 0 {
+		out.OverlapPct = float64(len(shared)) * 100 / float64(len(names))
+	}
+
+	total := func(key string) (n int64) {
+		for _, p := range plays {
+			n += p[key]
+		}
+		return n
+	}
+	sort.Slice(shared, func(i, j int) bool {
+		ti, tj := total(shared[i]), total(shared[j])
+		if ti != tj {
+			return ti > tj
+		}
+		return shared[i] < shared[j]
+	})
+	for i, key := range shared {
+		if i == opt.TopArtistsLimit {
+			break
+		}
+		a := SharedArtist{Rank: i + 1, Artist: names[key], Plays: map[string]int64{}}
+		for j, u := range out.Users {
+			a.Plays[u.User] = plays[j][key]
+		}
+		out.Shared = append(out.Shared, a)
+	}
+
+	for i := range out.Users {
+		var only []store.ArtistCount
+		for key, n := range plays[i] {
+			if total(key) == n {
+				only = append(only, store.ArtistCount{Artist: names[key], Plays: n})
+			}
+		}
+		sort.Slice(only, func(a, b int) bool {
+			if only[a].Plays != only[b].Plays {
+				return only[a].Plays > only[b].Plays
+			}
+			return only[a].Artist < only[b].Artist
+		})
+		if len(only) > opt.TopArtistsLimit {
+			only = only[:opt.TopArtistsLimit]
+		}
+		out.Users[i].Only = rankedArtists(only)
+	}
+	return out, nil
+}
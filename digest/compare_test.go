@@ -0,0 +1,71 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+func TestCompareAndMerge(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	uts := time.Now().Add(-48 * time.Hour).Unix()
+	for user, artists := range map[string][]string{
+		"alice": {"Burial", "Burial", "Kode9", "Boards of Canada"},
+		"bob":   {"burial", "Kode9", "Kode9", "Aphex Twin"},
+	} {
+		s, err := store.Open(ctx, store.OpenOptions{DataDir: dir, User: user})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range artists {
+			uts++
+			tr := lastfm.Track{Name: "t", Artist: lastfm.TextMBID{Text: a}, Date: &lastfm.Date{UTS: strconv.FormatInt(uts, 10)}}
+			if _, err := s.InsertScrobble(ctx, tr); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s.Close()
+	}
+
+	s, err := store.Open(ctx, store.OpenOptions{DataDir: dir, User: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	cmp, err := Compare(ctx, s, []string{"alice", "BOB"}, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(cmp.Shared); got != "[{1 Burial map[alice:2 bob:1]} {2 Kode9 map[alice:1 bob:2]}]" {
+		t.Fatalf("shared = %s", got)
+	}
+	if cmp.OverlapPct != 50 {
+		t.Fatalf("overlap = %v%%, want 50", cmp.OverlapPct)
+	}
+	if got := fmt.Sprint(cmp.Users); got != "[{alice 4 3 [{1 Boards of Canada 1}]} {bob 4 3 [{1 Aphex Twin 1}]}]" {
+		t.Fatalf("users = %s", got)
+	}
+	if _, err := Compare(ctx, s, []string{"alice", "carol"}, DefaultOptions()); err == nil {
+		t.Fatal("comparing with an unknown user succeeded")
+	}
+
+	opt := DefaultOptions()
+	opt.Filter.AlsoUsers = []string{"bob"}
+	out, err := Build(ctx, s, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Meta.ScrobblesTotal != 8 || fmt.Sprint(out.Meta.Users) != "[alice bob]" {
+		t.Fatalf("merged meta = %+v", out.Meta)
+	}
+	if got := fmt.Sprint(out.Top.Artists30d); got != "[{1 Burial 3} {2 Kode9 3} {3 Aphex Twin 1} {4 Boards of Canada 1}]" {
+		t.Fatalf("merged top artists = %s", got)
+	}
+}
@@ -0,0 +1,577 @@
+// Package digest summarizes a store's listening history as LLM-friendly JSON.
+package digest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// Digest is the whole summary. A section left out by Options.Only or
+// Options.Exclude is zero and missing from the JSON; a built one never is.
+type Digest struct {
+	Meta        Meta        `json:"meta"`
+	Recent      []Scrobble  `json:"recent,omitzero"`
+	Top         Top         `json:"top,omitzero"`
+	Resurface   Resurface   `json:"resurface,omitzero"`
+	Discoveries Discoveries `json:"discoveries,omitzero"`
+	RiseAndFall RiseAndFall `json:"rise_and_fall,omitzero"`
+	Yearly      Yearly      `json:"yearly,omitzero"`
+	Signature   Signature   `json:"signature,omitzero"`
+	Seasonal    Seasonal    `json:"seasonal,omitzero"`
+	Obscurity   Obscurity   `json:"obscurity,omitzero"`
+	OnThisDay   OnThisDay   `json:"on_this_day,omitzero"`
+	Countries   Countries   `json:"countries,omitzero"`
+	Decades     Decades     `json:"decades,omitzero"`
+
+	// Extensions holds custom sections (see Register and Options.Sections).
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+type Meta struct {
+	// SchemaVersion is the version of this JSON shape (see SchemaVersion).
+	SchemaVersion    int       `json:"schema_version"`
+	GeneratedAt      time.Time `json:"generated_at"`
+	ScrobblesTotal   int64     `json:"scrobbles_total"`
+	ScrobblesDated   int64     `json:"scrobbles_dated"`
+	ScrobblesSuspect int64     `json:"scrobbles_suspect"`
+	DatedMinUTS      int64     `json:"dated_min_uts"`
+	DatedMaxUTS      int64     `json:"dated_max_uts"`
+	Redacted         bool      `json:"redacted,omitempty"`
+	// Users lists whose plays a merged digest counts (Options.Filter.AlsoUsers).
+	Users []string `json:"users,omitempty"`
+	// Versions says which version kinds (live, remix, demo) were left out
+	// ("exclude") or counted as the studio track ("fold").
+	Versions map[string]string `json:"versions,omitempty"`
+	// Timezone is the zone the day windows start at midnight in; played_at
+	// times are given in it too.
+	Timezone string `json:"timezone"`
+
+	// Sources counts scrobbles by where they came from (lastfm_api, manual, ...).
+	Sources map[string]int64 `json:"sources"`
+	// Distribution is how the dated plays spread over artists.
+	Distribution Distribution `json:"distribution"`
+	// Trimmed lists the sections Fit shortened to fit a size budget.
+	Trimmed []string `json:"trimmed,omitempty"`
+}
+
+// Distribution describes how concentrated listening is: a Gini of 0 means
+// every artist was played as often, near 1 that a few took nearly all plays.
+type Distribution struct {
+	Artists              int64   `json:"artists"`
+	MedianPlaysPerArtist float64 `json:"median_plays_per_artist"`
+	Gini                 float64 `json:"gini"`
+	Top10Share           float64 `json:"top10_share"`
+	OnePlayArtists       int64   `json:"one_play_artists"`
+}
+
+type Scrobble struct {
+	PlayedAtUTS int64  `json:"played_at_uts"`
+	PlayedAt    string `json:"played_at"`
+	Artist      string `json:"artist"`
+	Track       string `json:"track"`
+	Album       string `json:"album,omitempty"`
+}
+
+type RankedArtist struct {
+	Rank   int    `json:"rank"`
+	Artist string `json:"artist"`
+	Plays  int64  `json:"plays"`
+}
+
+type RankedTrack struct {
+	Rank          int    `json:"rank"`
+	Artist        string `json:"artist"`
+	Track         string `json:"track"`
+	Plays         int64  `json:"plays"`
+	LastPlayedUTS int64  `json:"last_played_uts"`
+}
+
+type RankedAlbum struct {
+	Rank          int    `json:"rank"`
+	Artist        string `json:"artist"`
+	Album         string `json:"album"`
+	Plays         int64  `json:"plays"`
+	LastPlayedUTS int64  `json:"last_played_uts"`
+}
+
+type YearlyArtist struct {
+	Year   int    `json:"year"`
+	Rank   int    `json:"rank"`
+	Artist string `json:"artist"`
+	Plays  int64  `json:"plays"`
+}
+
+type SignatureArtist struct {
+	Rank            int    `json:"rank"`
+	Artist          string `json:"artist"`
+	YearsInTop      int64  `json:"years_in_top"`
+	FirstYear       int    `json:"first_year"`
+	LastYear        int    `json:"last_year"`
+	PlaysInTopYears int64  `json:"plays_in_top_years"`
+}
+
+type Top struct {
+	Artists30d  []RankedArtist `json:"artists_30d"`
+	Artists365d []RankedArtist `json:"artists_365d"`
+	Tracks30d   []RankedTrack  `json:"tracks_30d"`
+	Albums30d   []RankedAlbum  `json:"albums_30d"`
+}
+
+type Resurface struct {
+	Tracks180d []RankedTrack `json:"tracks_180d"`
+	Albums180d []RankedAlbum `json:"albums_180d"`
+}
+
+type Yearly struct {
+	TopArtists []YearlyArtist `json:"top_artists"`
+}
+
+type Signature struct {
+	Artists []SignatureArtist `json:"artists"`
+}
+
+type Options struct {
+	RecentLimit             int
+	TopArtistsLimit         int
+	TopTracksLimit          int
+	TopAlbumsLimit          int
+	YearlyTopArtistsPerYear int
+	SignatureLimit          int
+	SignatureMinYears       int
+	RiseAndFallLimit        int
+	RiseAndFallWindowDays   int
+	RiseAndFallWeeks        int
+	DiscoveriesLimit        int
+
+	SeasonalTopArtistsPerMonth int
+	SeasonalArtistsLimit       int
+	SeasonalMinPlays           int
+	SeasonalMinYears           int
+
+	// OnThisDayLimit caps each year's top artists and first listens.
+	OnThisDayLimit int
+
+	// AlbumsAcrossArtists groups the top and resurface albums by title
+	// across artists, so compilations chart as "Various Artists" (see
+	// store.Store.TopAlbumsAcrossArtists).
+	AlbumsAcrossArtists bool
+
+	// Filter redacts periods or artists, e.g. for a shareable digest.
+	Filter store.Filter
+
+	// Sections adds custom sections for this build on top of registered ones.
+	Sections []Section
+
+	// Only builds just these sections (see SectionNames) and Exclude all
+	// but these; the others are neither queried nor output. Meta always is.
+	Only    []string
+	Exclude []string
+
+	// Location is the zone "today" and the 30d/365d windows are counted
+	// in; nil means the store's home time zone. Windows that don't start
+	// at one of its midnights are counted from scrobbles, not the rollups.
+	Location *time.Location
+
+	// SchemaVersion asks for an older JSON shape (MinSchemaVersion to
+	// SchemaVersion); 0 means the current one.
+	SchemaVersion int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		RecentLimit:             150,
+		TopArtistsLimit:         25,
+		TopTracksLimit:          50,
+		TopAlbumsLimit:          40,
+		YearlyTopArtistsPerYear: 10,
+		SignatureLimit:          50,
+		SignatureMinYears:       5,
+		RiseAndFallLimit:        10,
+		RiseAndFallWindowDays:   90,
+		RiseAndFallWeeks:        13,
+		DiscoveriesLimit:        25,
+
+		SeasonalTopArtistsPerMonth: 5,
+		SeasonalArtistsLimit:       25,
+		SeasonalMinPlays:           20,
+		SeasonalMinYears:           2,
+
+		OnThisDayLimit: 5,
+
+		Filter: store.Filter{HideIgnored: true},
+	}
+}
+
+// Build computes the digest from s's scrobbles, as seen through opt.Filter;
+// they are always s's user's, plus those of opt.Filter.AlsoUsers for a
+// merged one.
+func Build(ctx context.Context, s *store.Store, opt Options) (Digest, error) {
+	if opt.RecentLimit <= 0 || opt.RecentLimit > 1000 {
+		return Digest{}, fmt.Errorf("invalid RecentLimit: %d", opt.RecentLimit)
+	}
+	if err := CheckSections(append(slices.Clone(opt.Only), opt.Exclude...)); err != nil {
+		return Digest{}, err
+	}
+	version, err := schemaVersion(opt.SchemaVersion)
+	if err != nil {
+		return Digest{}, err
+	}
+	want := func(section string) bool {
+		return (len(opt.Only) == 0 || slices.Contains(opt.Only, section)) && !slices.Contains(opt.Exclude, section)
+	}
+	opt.Filter.User = s.User()
+	f := opt.Filter
+	loc := opt.Location
+	if loc == nil {
+		loc = s.Location()
+	}
+	y, m, d := time.Now().In(loc).Date()
+
+	meta, err := computeMeta(ctx, s, f)
+	if err != nil {
+		return Digest{}, err
+	}
+	meta.SchemaVersion = version
+	meta.Timezone = loc.String()
+	if len(f.AlsoUsers) > 0 {
+		meta.Users = append([]string{f.User}, f.AlsoUsers...)
+	}
+
+	out := Digest{Meta: meta}
+	b := &builder{s: s, db: querier{db: s.DB, filter: f, minSane: s.MinSaneUTS()}, opt: opt, loc: loc, today: time.Date(y, m, d, 0, 0, 0, 0, loc)}
+	for _, sec := range builtins {
+		if want(sec.name) {
+			if err := sec.build(ctx, b, &out); err != nil {
+				return Digest{}, err
+			}
+		}
+	}
+	return out, nil
+}
+
+// builder is what the built-in sections share while a digest is built.
+type builder struct {
+	s     *store.Store
+	db    querier
+	opt   Options
+	loc   *time.Location
+	today time.Time
+
+	// top365d is read once, for both top and obscurity.
+	top365d []store.ArtistCount
+}
+
+// since is a window of today plus the days before it. Windows start at a
+// local midnight, so in the home time zone they read the store's daily
+// rollups.
+func (b *builder) since(days int) store.TimeRange {
+	return store.TimeRange{From: b.today.AddDate(0, 0, -days).Unix()}
+}
+
+// topArtists365d is the top artists of the past 365 days.
+func (b *builder) topArtists365d(ctx context.Context) ([]store.ArtistCount, error) {
+	if b.top365d != nil {
+		return b.top365d, nil
+	}
+	var err error
+	b.top365d, err = b.s.TopArtists(ctx, b.opt.Filter, b.since(365), b.opt.TopArtistsLimit)
+	return b.top365d, err
+}
+
+// builtin is one of the digest's own sections: its JSON key (as in
+// SectionNames) and how it fills in its field of the Digest, each with its
+// own queries. Fit trims it through trimmers.
+type builtin struct {
+	name  string
+	build func(ctx context.Context, b *builder, d *Digest) error
+}
+
+// builtins are the digest's sections, most important first; Build runs the
+// ones Options.Only and Options.Exclude keep.
+var builtins = []builtin{
+	{"top", func(ctx context.Context, b *builder, d *Digest) error {
+		s, f, opt := b.s, b.opt.Filter, b.opt
+		artists365d, err := b.topArtists365d(ctx)
+		if err != nil {
+			return err
+		}
+		artists30d, err := s.TopArtists(ctx, f, b.since(30), opt.TopArtistsLimit)
+		if err != nil {
+			return err
+		}
+		tracks30d, err := s.TopTracks(ctx, f, b.since(30), opt.TopTracksLimit)
+		if err != nil {
+			return err
+		}
+		topAlbums := s.TopAlbums
+		if opt.AlbumsAcrossArtists {
+			topAlbums = s.TopAlbumsAcrossArtists
+		}
+		albums30d, err := topAlbums(ctx, f, b.since(30), opt.TopAlbumsLimit)
+		if err != nil {
+			return err
+		}
+		d.Top = Top{
+			Artists30d:  rankedArtists(artists30d),
+			Artists365d: rankedArtists(artists365d),
+			Tracks30d:   rankedTracks(tracks30d),
+			Albums30d:   rankedAlbums(albums30d),
+		}
+		return nil
+	}},
+	{"recent", func(ctx context.Context, b *builder, d *Digest) error {
+		recent, err := b.s.RecentScrobbles(ctx, b.opt.Filter, b.opt.RecentLimit)
+		if err != nil {
+			return err
+		}
+		d.Recent = scrobbles(recent, b.loc)
+		return nil
+	}},
+	{"rise_and_fall", func(ctx context.Context, b *builder, d *Digest) error {
+		var err error
+		d.RiseAndFall, err = riseAndFall(ctx, b.db, b.opt.RiseAndFallWindowDays, b.opt.RiseAndFallWeeks, b.opt.RiseAndFallLimit)
+		return err
+	}},
+	{"resurface", func(ctx context.Context, b *builder, d *Digest) error {
+		s, f, opt := b.s, b.opt.Filter, b.opt
+		tracks, err := s.StaleTracks(ctx, f, b.since(180).From, opt.TopTracksLimit)
+		if err != nil {
+			return err
+		}
+		staleAlbums := s.StaleAlbums
+		if opt.AlbumsAcrossArtists {
+			staleAlbums = s.StaleAlbumsAcrossArtists
+		}
+		albums, err := staleAlbums(ctx, f, b.since(180).From, opt.TopAlbumsLimit)
+		if err != nil {
+			return err
+		}
+		d.Resurface = Resurface{Tracks180d: rankedTracks(tracks), Albums180d: rankedAlbums(albums)}
+		return nil
+	}},
+	{"discoveries", func(ctx context.Context, b *builder, d *Digest) error {
+		var err error
+		d.Discoveries, err = discoveries(ctx, b.s, b.opt.Filter, b.since(30), b.opt.DiscoveriesLimit, b.loc)
+		return err
+	}},
+	{"yearly", func(ctx context.Context, b *builder, d *Digest) error {
+		byYear, err := b.s.TopArtistsByYear(ctx, b.opt.Filter, b.opt.YearlyTopArtistsPerYear)
+		if err != nil {
+			return err
+		}
+		d.Yearly = Yearly{TopArtists: yearlyArtists(byYear)}
+		return nil
+	}},
+	{"signature", func(ctx context.Context, b *builder, d *Digest) error {
+		top20ByYear, err := b.s.TopArtistsByYear(ctx, b.opt.Filter, signatureTopN)
+		if err != nil {
+			return err
+		}
+		d.Signature = Signature{Artists: signatureArtists(top20ByYear, b.opt.SignatureMinYears, b.opt.SignatureLimit)}
+		return nil
+	}},
+	{"seasonal", func(ctx context.Context, b *builder, d *Digest) error {
+		var err error
+		d.Seasonal, err = seasonal(ctx, b.db, b.opt)
+		return err
+	}},
+	{"on_this_day", func(ctx context.Context, b *builder, d *Digest) error {
+		var err error
+		d.OnThisDay, err = onThisDay(ctx, b.db, b.today, b.opt.OnThisDayLimit)
+		return err
+	}},
+	{"obscurity", func(ctx context.Context, b *builder, d *Digest) error {
+		top365d, err := b.topArtists365d(ctx)
+		if err != nil {
+			return err
+		}
+		d.Obscurity, err = obscurity(ctx, b.db, rankedArtists(top365d))
+		return err
+	}},
+	{"countries", func(ctx context.Context, b *builder, d *Digest) error {
+		var err error
+		d.Countries, err = countries(ctx, b.db)
+		return err
+	}},
+	{"decades", func(ctx context.Context, b *builder, d *Digest) error {
+		var err error
+		d.Decades, err = decades(ctx, b.db)
+		return err
+	}},
+	{"extensions", func(ctx context.Context, b *builder, d *Digest) error {
+		var err error
+		d.Extensions, err = buildExtensions(ctx, b.db, b.opt)
+		return err
+	}},
+}
+
+func EncodeJSON(v any, pretty bool) ([]byte, error) {
+	if pretty {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+func computeMeta(ctx context.Context, s *store.Store, f store.Filter) (Meta, error) {
+	all, err := s.CountByRange(ctx, f, store.TimeRange{})
+	if err != nil {
+		return Meta{}, err
+	}
+	dated, err := s.CountByRange(ctx, f, store.TimeRange{From: s.MinSaneUTS()})
+	if err != nil {
+		return Meta{}, err
+	}
+	sources, err := s.SourceCounts(ctx, f)
+	if err != nil {
+		return Meta{}, err
+	}
+	dist, err := s.ArtistDistribution(ctx, f)
+	if err != nil {
+		return Meta{}, err
+	}
+
+	var versions map[string]string
+	for mode, kinds := range map[string][]string{"exclude": f.ExcludeVersions, "fold": f.FoldVersions} {
+		for _, k := range kinds {
+			if versions == nil {
+				versions = map[string]string{}
+			}
+			versions[k] = mode
+		}
+	}
+
+	return Meta{
+		GeneratedAt:      time.Now().UTC(),
+		Versions:         versions,
+		Sources:          sources,
+		Redacted:         f.Redacts(),
+		ScrobblesTotal:   all.Count,
+		ScrobblesDated:   dated.Count,
+		ScrobblesSuspect: all.Count - dated.Count,
+		DatedMinUTS:      dated.MinUTS,
+		DatedMaxUTS:      dated.MaxUTS,
+		Distribution: Distribution{
+			Artists:              dist.Artists,
+			MedianPlaysPerArtist: dist.MedianPlays,
+			Gini:                 round3(dist.Gini),
+			Top10Share:           round3(dist.Top10Share),
+			OnePlayArtists:       dist.OnePlay,
+		},
+	}, nil
+}
+
+func scrobbles(in []store.Scrobble, loc *time.Location) []Scrobble {
+	out := make([]Scrobble, 0, len(in))
+	for _, sc := range in {
+		out = append(out, Scrobble{
+			PlayedAtUTS: sc.PlayedAtUTS,
+			PlayedAt:    time.Unix(sc.PlayedAtUTS, 0).In(loc).Format(time.RFC3339),
+			Artist:      sc.Artist,
+			Track:       sc.Track,
+			Album:       sc.Album,
+		})
+	}
+	return out
+}
+
+func rankedArtists(in []store.ArtistCount) []RankedArtist {
+	out := make([]RankedArtist, 0, len(in))
+	for i, c := range in {
+		out = append(out, RankedArtist{Rank: i + 1, Artist: c.Artist, Plays: c.Plays})
+	}
+	return out
+}
+
+func rankedTracks(in []store.TrackCount) []RankedTrack {
+	out := make([]RankedTrack, 0, len(in))
+	for i, c := range in {
+		out = append(out, RankedTrack{Rank: i + 1, Artist: c.Artist, Track: c.Track, Plays: c.Plays, LastPlayedUTS: c.LastPlayedUTS})
+	}
+	return out
+}
+
+func rankedAlbums(in []store.AlbumCount) []RankedAlbum {
+	out := make([]RankedAlbum, 0, len(in))
+	for i, c := range in {
+		out = append(out, RankedAlbum{Rank: i + 1, Artist: c.Artist, Album: c.Album, Plays: c.Plays, LastPlayedUTS: c.LastPlayedUTS})
+	}
+	return out
+}
+
+func yearlyArtists(in []store.YearArtist) []YearlyArtist {
+	out := make([]YearlyArtist, 0, len(in))
+	for _, y := range in {
+		out = append(out, YearlyArtist{Year: y.Year, Rank: y.Rank, Artist: y.Artist, Plays: y.Plays})
+	}
+	return out
+}
+
+// signatureTopN is how high an artist must chart in a year for that year to
+// count towards their signature.
+const signatureTopN = 20
+
+// signatureArtists ranks artists by how many years they made the yearly top
+// signatureTopN, then by their plays in those years.
+func signatureArtists(byYear []store.YearArtist, minYears, limit int) []SignatureArtist {
+	agg := map[string]*SignatureArtist{}
+	for _, y := range byYear {
+		a := agg[y.Artist]
+		if a == nil {
+			a = &SignatureArtist{Artist: y.Artist, FirstYear: y.Year}
+			agg[y.Artist] = a
+		}
+		a.YearsInTop++
+		a.FirstYear = min(a.FirstYear, y.Year)
+		a.LastYear = max(a.LastYear, y.Year)
+		a.PlaysInTopYears += y.Plays
+	}
+
+	out := []SignatureArtist{}
+	for _, a := range agg {
+		if a.YearsInTop >= int64(minYears) {
+			out = append(out, *a)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].YearsInTop != out[j].YearsInTop {
+			return out[i].YearsInTop > out[j].YearsInTop
+		}
+		if out[i].PlaysInTopYears != out[j].PlaysInTopYears {
+			return out[i].PlaysInTopYears > out[j].PlaysInTopYears
+		}
+		return out[i].Artist < out[j].Artist
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	for i := range out {
+		out[i].Rank = i + 1
+	}
+	return out
+}
+
+// querier runs digest queries against the filtered view of scrobbles.
+type querier struct {
+	db     *sql.DB
+	filter store.Filter
+	// minSane is the store's minimum sane timestamp (see
+	// store.Store.MinSaneUTS).
+	minSane int64
+}
+
+func (q querier) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	query, args = q.filter.Scope(query, args...)
+	return q.db.QueryContext(ctx, query, args...)
+}
+
+func (q querier) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	query, args = q.filter.Scope(query, args...)
+	return q.db.QueryRowContext(ctx, query, args...)
+}
@@ -0,0 +1,137 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+func TestBuildWindowsInLocation(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.Open(ctx, store.OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, m, d := time.Now().In(tokyo).Date()
+	start := time.Date(y, m, d-30, 0, 0, 0, 0, tokyo).Unix()
+	// Just inside and just outside the 30 days, counted in Tokyo.
+	for artist, uts := range map[string]int64{"Boris": start, "Merzbow": start - 1} {
+		tr := lastfm.Track{Name: "t", Artist: lastfm.TextMBID{Text: artist}, Date: &lastfm.Date{UTS: strconv.FormatInt(uts, 10)}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opt := DefaultOptions()
+	opt.Location = tokyo
+	out, err := Build(ctx, s, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Meta.Timezone != "Asia/Tokyo" {
+		t.Fatalf("meta.timezone = %q", out.Meta.Timezone)
+	}
+	if len(out.Top.Artists30d) != 1 || out.Top.Artists30d[0].Artist != "Boris" {
+		t.Fatalf("top artists 30d = %+v, want just Boris", out.Top.Artists30d)
+	}
+	if len(out.Recent) == 0 || !strings.HasSuffix(out.Recent[0].PlayedAt, "+09:00") {
+		t.Fatalf("recent = %+v, want times in Tokyo", out.Recent)
+	}
+}
+
+func TestBuildOnlyChosenSections(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.Open(ctx, store.OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	keys := func(opt Options) string {
+		t.Helper()
+		d, err := Build(ctx, s, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := EncodeJSON(d, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(slices.Sorted(maps.Keys(m)), ",")
+	}
+
+	// Built sections show even when empty.
+	if got := keys(DefaultOptions()); got != "countries,decades,discoveries,meta,obscurity,on_this_day,recent,resurface,rise_and_fall,seasonal,signature,top,yearly" {
+		t.Fatalf("all sections = %s", got)
+	}
+	opt := DefaultOptions()
+	opt.Only = []string{"recent", "top", "yearly"}
+	opt.Exclude = []string{"top"}
+	if got := keys(opt); got != "meta,recent,yearly" {
+		t.Fatalf("only recent,top,yearly but top = %s", got)
+	}
+	opt.Only = []string{"recnt"}
+	if _, err := Build(ctx, s, opt); err == nil {
+		t.Fatal("an unknown section was accepted")
+	}
+}
+
+func TestEachSectionAlone(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.Open(ctx, store.OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tr := lastfm.Track{Name: "Archangel", Artist: lastfm.TextMBID{Text: "Burial"}, Album: lastfm.TextMBID{Text: "Untrue"}, Date: &lastfm.Date{UTS: strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)}}
+	if _, err := s.InsertScrobble(ctx, tr); err != nil {
+		t.Fatal(err)
+	}
+	opt := DefaultOptions()
+	opt.Sections = []Section{SectionFunc("plays", func(ctx context.Context, db Querier, opt Options) (any, error) {
+		var n int
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM scrobbles`).Scan(&n)
+		return n, err
+	})}
+
+	// Each section builds on its own, into its own key, and Fit can trim it.
+	for _, name := range SectionNames {
+		if _, ok := trimmers[name]; !ok {
+			t.Errorf("section %s has no trimmer", name)
+		}
+		opt.Only = []string{name}
+		d, err := Build(ctx, s, opt)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		b, err := EncodeJSON(d, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(slices.Sorted(maps.Keys(m)), ","); got != strings.Join(slices.Sorted(slices.Values([]string{"meta", name})), ",") {
+			t.Errorf("only %s = %s", name, got)
+		}
+	}
+}
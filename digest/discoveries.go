@@ -0,0 +1,54 @@
+package digest
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// Discoveries are the artists and albums first played in the last 30 days
+// (see store.Store.FirstPlays), newest first.
+type Discoveries struct {
+	Artists30d []Discovery `json:"artists_30d"`
+	Albums30d  []Discovery `json:"albums_30d"`
+}
+
+// Discovery is an artist's or album's first play. Track is what was heard
+// first.
+type Discovery struct {
+	Artist         string `json:"artist"`
+	Album          string `json:"album,omitempty"`
+	Track          string `json:"track"`
+	FirstPlayedUTS int64  `json:"first_played_uts"`
+	FirstPlayedAt  string `json:"first_played_at"`
+}
+
+func discoveries(ctx context.Context, s *store.Store, f store.Filter, r store.TimeRange, limit int, loc *time.Location) (Discoveries, error) {
+	var out Discoveries
+	for _, albums := range []bool{false, true} {
+		// Oldest first, so the newest are the last limit.
+		plays, err := s.FirstPlays(ctx, f, r, albums, -1)
+		if err != nil {
+			return Discoveries{}, err
+		}
+		plays = plays[max(len(plays)-limit, 0):]
+		list := make([]Discovery, 0, len(plays))
+		for _, p := range slices.Backward(plays) {
+			list = append(list, Discovery{
+				Artist:         p.Artist,
+				Album:          p.Album,
+				Track:          p.Track,
+				FirstPlayedUTS: p.FirstPlayedUTS,
+				FirstPlayedAt:  time.Unix(p.FirstPlayedUTS, 0).In(loc).Format(time.RFC3339),
+			})
+		}
+		if albums {
+			out.Albums30d = list
+		} else {
+			out.Artists30d = list
+		}
+	}
+	return out, nil
+}
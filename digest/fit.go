@@ -0,0 +1,209 @@
+package digest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// fitFloor is how short Fit makes a section's lists before it starts
+// dropping whole sections.
+const fitFloor = 5
+
+// SectionNames are the digest's sections (JSON keys), most important
+// first: the order Fit keeps them in by default.
+var SectionNames = func() []string {
+	names := make([]string, len(builtins))
+	for i, b := range builtins {
+		names[i] = b.name
+	}
+	return names
+}()
+
+// trimmer shortens one section: size is its longest list, cut caps every
+// list at n entries (or ranks, for per-year and per-month lists).
+type trimmer struct {
+	size func(d *Digest) int
+	cut  func(d *Digest, n int)
+}
+
+var trimmers = map[string]trimmer{
+	"top": {
+		size: func(d *Digest) int {
+			t := d.Top
+			return max(len(t.Artists30d), len(t.Artists365d), len(t.Tracks30d), len(t.Albums30d))
+		},
+		cut: func(d *Digest, n int) {
+			t := &d.Top
+			capList(&t.Artists30d, n)
+			capList(&t.Artists365d, n)
+			capList(&t.Tracks30d, n)
+			capList(&t.Albums30d, n)
+		},
+	},
+	"recent": {
+		size: func(d *Digest) int { return len(d.Recent) },
+		cut:  func(d *Digest, n int) { capList(&d.Recent, n) },
+	},
+	"rise_and_fall": {
+		size: func(d *Digest) int { return max(len(d.RiseAndFall.Rising), len(d.RiseAndFall.Falling)) },
+		cut: func(d *Digest, n int) {
+			capList(&d.RiseAndFall.Rising, n)
+			capList(&d.RiseAndFall.Falling, n)
+		},
+	},
+	"resurface": {
+		size: func(d *Digest) int { return max(len(d.Resurface.Tracks180d), len(d.Resurface.Albums180d)) },
+		cut: func(d *Digest, n int) {
+			capList(&d.Resurface.Tracks180d, n)
+			capList(&d.Resurface.Albums180d, n)
+		},
+	},
+	"discoveries": {
+		size: func(d *Digest) int { return max(len(d.Discoveries.Artists30d), len(d.Discoveries.Albums30d)) },
+		cut: func(d *Digest, n int) {
+			capList(&d.Discoveries.Artists30d, n)
+			capList(&d.Discoveries.Albums30d, n)
+		},
+	},
+	"yearly": {
+		size: func(d *Digest) int {
+			n := 0
+			for _, a := range d.Yearly.TopArtists {
+				n = max(n, a.Rank)
+			}
+			return n
+		},
+		cut: func(d *Digest, n int) {
+			d.Yearly.TopArtists = slices.DeleteFunc(slices.Clone(d.Yearly.TopArtists), func(a YearlyArtist) bool { return a.Rank > n })
+		},
+	},
+	"signature": {
+		size: func(d *Digest) int { return len(d.Signature.Artists) },
+		cut:  func(d *Digest, n int) { capList(&d.Signature.Artists, n) },
+	},
+	"seasonal": {
+		size: func(d *Digest) int {
+			n := len(d.Seasonal.Artists)
+			for _, m := range d.Seasonal.Months {
+				n = max(n, len(m.TopArtists))
+			}
+			return n
+		},
+		cut: func(d *Digest, n int) {
+			capList(&d.Seasonal.Artists, n)
+			d.Seasonal.Months = slices.Clone(d.Seasonal.Months)
+			for i := range d.Seasonal.Months {
+				capList(&d.Seasonal.Months[i].TopArtists, n)
+			}
+		},
+	},
+	"on_this_day": {
+		size: func(d *Digest) int {
+			n := 0
+			for _, y := range d.OnThisDay.Years {
+				n = max(n, len(y.TopArtists), len(y.FirstListens))
+			}
+			return n
+		},
+		cut: func(d *Digest, n int) {
+			d.OnThisDay.Years = slices.Clone(d.OnThisDay.Years)
+			for i := range d.OnThisDay.Years {
+				capList(&d.OnThisDay.Years[i].TopArtists, n)
+				capList(&d.OnThisDay.Years[i].FirstListens, n)
+			}
+		},
+	},
+	"obscurity": {
+		size: func(d *Digest) int { return max(len(d.Obscurity.Artists), len(d.Obscurity.Mainstream)) },
+		cut: func(d *Digest, n int) {
+			capList(&d.Obscurity.Artists, n)
+			capList(&d.Obscurity.Mainstream, n)
+		},
+	},
+	"countries": {
+		size: func(d *Digest) int { return len(d.Countries.Plays) },
+		cut:  func(d *Digest, n int) { capList(&d.Countries.Plays, n) },
+	},
+	"decades": {
+		size: func(d *Digest) int { return len(d.Decades.Plays) },
+		cut:  func(d *Digest, n int) { capList(&d.Decades.Plays, n) },
+	},
+	// Custom sections are opaque: kept whole or dropped.
+	"extensions": {
+		size: func(d *Digest) int { return min(len(d.Extensions), 1) },
+		cut: func(d *Digest, n int) {
+			if n == 0 {
+				d.Extensions = nil
+			}
+		},
+	},
+}
+
+// capList keeps the first n entries of *s; an emptied list stays non-nil,
+// so it still encodes as [].
+func capList[T any](s *[]T, n int) {
+	if len(*s) > n {
+		*s = (*s)[:n]
+	}
+}
+
+// CheckSections reports the first of names that isn't a section.
+func CheckSections(names []string) error {
+	for _, n := range names {
+		if _, ok := trimmers[n]; !ok {
+			return fmt.Errorf("unknown digest section %q (expected %s)", n, strings.Join(SectionNames, ", "))
+		}
+	}
+	return nil
+}
+
+// Fit trims d until its encoding by encode (e.g. EncodeJSON) is at most
+// maxBytes, returning that encoding. Sections go in reverse of priority, which names
+// sections most important first; the rest follow in SectionNames' order.
+// Lists are first halved down to fitFloor entries, least important section
+// first, then sections are emptied the same way. The names of the sections
+// trimmed are in Meta.Trimmed. It fails if even the bare meta is too big.
+func Fit(d Digest, maxBytes int, priority []string, encode func(any) ([]byte, error)) ([]byte, error) {
+	if err := CheckSections(priority); err != nil {
+		return nil, err
+	}
+	order := slices.Clone(priority)
+	for _, name := range SectionNames {
+		if !slices.Contains(order, name) {
+			order = append(order, name)
+		}
+	}
+
+	for {
+		b, err := encode(d)
+		if err != nil || len(b) <= maxBytes {
+			return b, err
+		}
+		name, n := fitStep(&d, order)
+		if name == "" {
+			return nil, fmt.Errorf("the digest doesn't fit in %d bytes even with every section empty (%d bytes)", maxBytes, len(b))
+		}
+		trimmers[name].cut(&d, n)
+		if !slices.Contains(d.Meta.Trimmed, name) {
+			d.Meta.Trimmed = append(d.Meta.Trimmed, name)
+		}
+	}
+}
+
+// fitStep picks the next section to trim and its new list length: the
+// least important one still above fitFloor, halved; or once all are at it,
+// the least important one left, emptied.
+func fitStep(d *Digest, order []string) (string, int) {
+	for i := len(order) - 1; i >= 0; i-- {
+		if n := trimmers[order[i]].size(d); n > fitFloor {
+			return order[i], max(n/2, fitFloor)
+		}
+	}
+	for i := len(order) - 1; i >= 0; i-- {
+		if trimmers[order[i]].size(d) > 0 {
+			return order[i], 0
+		}
+	}
+	return "", 0
+}
@@ -0,0 +1,55 @@
+package digest
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestFitTrimsLeastImportantFirst(t *testing.T) {
+	compact := func(v any) ([]byte, error) { return EncodeJSON(v, false) }
+	var d Digest
+	for i := range 100 {
+		d.Recent = append(d.Recent, Scrobble{PlayedAtUTS: int64(i), Artist: fmt.Sprint("Recent ", i), Track: "t"})
+		d.Top.Artists30d = append(d.Top.Artists30d, RankedArtist{Rank: i + 1, Artist: fmt.Sprint("Top ", i), Plays: 1})
+	}
+	full, err := EncodeJSON(d, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Fit(d, len(full)*3/4, nil, compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Digest
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(b) > len(full)*3/4 || len(got.Top.Artists30d) != 100 || len(got.Recent) >= 100 || fmt.Sprint(got.Meta.Trimmed) != "[recent]" {
+		t.Fatalf("fit to 3/4: %d bytes, %d top, %d recent, trimmed %v", len(b), len(got.Top.Artists30d), len(got.Recent), got.Meta.Trimmed)
+	}
+	if len(d.Recent) != 100 {
+		t.Fatal("Fit changed its argument")
+	}
+
+	// With recent put first, the top lists go instead.
+	b, err = Fit(d, len(full)*3/4, []string{"recent"}, compact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = Digest{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Recent) != 100 || fmt.Sprint(got.Meta.Trimmed) != "[top]" {
+		t.Fatalf("fit with recent first: %d recent, trimmed %v", len(got.Recent), got.Meta.Trimmed)
+	}
+
+	if _, err := Fit(d, 10, nil, compact); err == nil {
+		t.Fatal("fitting into 10 bytes succeeded")
+	}
+	if _, err := Fit(d, len(full), []string{"nope"}, compact); err == nil {
+		t.Fatal("an unknown section was accepted")
+	}
+}
@@ -0,0 +1,148 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// Obscurity rates listening by the artists' Last.fm listener counts, as
+// cached by sync (artist.getInfo in lastfm_cache). Artists without a cached
+// count are left out, so it's empty until a sync has run.
+type Obscurity struct {
+	// Artists are the top artists of the past 365 days, keeping their rank
+	// there, with lastfm.Obscurity of their listener count.
+	Artists []ObscureArtist `json:"artists"`
+	// Mainstream is per period (30d, 365d, then each year).
+	Mainstream []Mainstream `json:"mainstream"`
+}
+
+type ObscureArtist struct {
+	Rank      int     `json:"rank"`
+	Artist    string  `json:"artist"`
+	Plays     int64   `json:"plays"`
+	Listeners int64   `json:"listeners"`
+	Obscurity float64 `json:"obscurity"`
+}
+
+// Mainstream is 1 minus the play-weighted obscurity of a period's artists:
+// near 1 for chart listening, near 0 for the obscure. Coverage is the share
+// of the period's plays by artists with a known listener count.
+type Mainstream struct {
+	Period   string  `json:"period"`
+	Score    float64 `json:"score"`
+	Coverage float64 `json:"coverage"`
+}
+
+// obscurity scores top365d, the year's top artists, by listener count.
+func obscurity(ctx context.Context, db querier, top365d []RankedArtist) (Obscurity, error) {
+	out := Obscurity{Artists: []ObscureArtist{}, Mainstream: []Mainstream{}}
+	listeners, err := cachedListeners(ctx, db)
+	if err != nil || len(listeners) == 0 {
+		return out, err
+	}
+	known := func(artist string) (int64, bool) {
+		n, ok := listeners[store.NormalizeArtist(artist)]
+		return n, ok && n > 0
+	}
+
+	for _, a := range top365d {
+		if n, ok := known(a.Artist); ok {
+			out.Artists = append(out.Artists, ObscureArtist{Rank: a.Rank, Artist: a.Artist, Plays: a.Plays, Listeners: n, Obscurity: round3(lastfm.Obscurity(n))})
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, `
+SELECT
+  CASE WHEN played_at_uts >= strftime('%s','now','-30 days') THEN 1 ELSE 0 END AS in30,
+  CASE WHEN played_at_uts >= strftime('%s','now','-365 days') THEN 1 ELSE 0 END AS in365,
+  played_year_local AS year,
+  artist_name,
+  COUNT(*)
+FROM scrobbles
+WHERE played_at_uts >= ?
+GROUP BY in30, in365, year, artist_name
+ORDER BY year
+`, db.minSane)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+
+	type acc struct{ plays, known, weighted float64 }
+	periods := map[string]*acc{}
+	order := []string{"30d", "365d"}
+	add := func(period string, plays float64, n int64, ok bool) {
+		p := periods[period]
+		if p == nil {
+			p = &acc{}
+			periods[period] = p
+		}
+		p.plays += plays
+		if ok {
+			p.known += plays
+			p.weighted += plays * (1 - lastfm.Obscurity(n))
+		}
+	}
+	for rows.Next() {
+		var in30, in365 int
+		var year, artist string
+		var plays int64
+		if err := rows.Scan(&in30, &in365, &year, &artist, &plays); err != nil {
+			return out, err
+		}
+		n, ok := known(artist)
+		if in30 == 1 {
+			add("30d", float64(plays), n, ok)
+		}
+		if in365 == 1 {
+			add("365d", float64(plays), n, ok)
+		}
+		if periods[year] == nil {
+			order = append(order, year)
+		}
+		add(year, float64(plays), n, ok)
+	}
+	if err := rows.Err(); err != nil {
+		return out, err
+	}
+
+	for _, period := range order {
+		p := periods[period]
+		if p == nil || p.known == 0 {
+			continue
+		}
+		out.Mainstream = append(out.Mainstream, Mainstream{Period: period, Score: round3(p.weighted / p.known), Coverage: round3(p.known / p.plays)})
+	}
+	return out, nil
+}
+
+// cachedListeners reads listener counts from cached artist.getInfo
+// responses, keyed by store.NormalizeArtist.
+func cachedListeners(ctx context.Context, db querier) (map[string]int64, error) {
+	rows, err := db.QueryContext(ctx, `SELECT key, body FROM lastfm_cache WHERE method = 'artist.getInfo'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]int64{}
+	for rows.Next() {
+		var key, body string
+		if err := rows.Scan(&key, &body); err != nil {
+			return nil, err
+		}
+		var info lastfm.ArtistInfo
+		if json.Unmarshal([]byte(body), &info) == nil {
+			out[store.NormalizeArtist(key)] = info.Listeners()
+		}
+	}
+	return out, rows.Err()
+}
+
+func round3(x float64) float64 {
+	return math.Round(x*1000) / 1000
+}
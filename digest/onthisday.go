@@ -0,0 +1,132 @@
+package digest
+
+import (
+	"context"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// onThisDayYears are how many years back OnThisDay looks.
+var onThisDayYears = []int{1, 5, 10}
+
+// OnThisDay is what was played on today's date in earlier years.
+type OnThisDay struct {
+	// Years has an entry for 1, 5 and 10 years ago, played or not.
+	Years []OnThisDayYear `json:"years"`
+}
+
+type OnThisDayYear struct {
+	YearsAgo int `json:"years_ago"`
+	// Date is the day, local to meta.timezone (YYYY-MM-DD).
+	Date       string         `json:"date"`
+	Plays      int64          `json:"plays"`
+	TopArtists []RankedArtist `json:"top_artists"`
+	// FirstListens are the artists first played that day.
+	FirstListens []FirstListen `json:"first_listens"`
+}
+
+// FirstListen is an artist first heard on an OnThisDay date. Track is the
+// first of theirs played; PlaysSince counts every play of theirs from that
+// day on, and orders the list, so the ones that stuck come first.
+type FirstListen struct {
+	Artist     string `json:"artist"`
+	Track      string `json:"track"`
+	Plays      int64  `json:"plays"`
+	PlaysSince int64  `json:"plays_since"`
+}
+
+// BuildOnThisDay computes the on_this_day section alone for today's date in
+// opt.Location (nil for the store's home time zone), as seen through
+// opt.Filter.
+func BuildOnThisDay(ctx context.Context, s *store.Store, opt Options) (OnThisDay, error) {
+	opt.Filter.User = s.User()
+	loc := opt.Location
+	if loc == nil {
+		loc = s.Location()
+	}
+	y, m, d := time.Now().In(loc).Date()
+	return onThisDay(ctx, querier{db: s.DB, filter: opt.Filter, minSane: s.MinSaneUTS()}, time.Date(y, m, d, 0, 0, 0, 0, loc), opt.OnThisDayLimit)
+}
+
+// onThisDay looks back from today, a local midnight, listing limit top
+// artists and first listens per year.
+func onThisDay(ctx context.Context, db querier, today time.Time, limit int) (OnThisDay, error) {
+	out := OnThisDay{Years: []OnThisDayYear{}}
+	for _, n := range onThisDayYears {
+		day := today.AddDate(-n, 0, 0)
+		from, to := day.Unix(), day.AddDate(0, 0, 1).Unix()
+		y := OnThisDayYear{YearsAgo: n, Date: day.Format("2006-01-02"), TopArtists: []RankedArtist{}, FirstListens: []FirstListen{}}
+
+		rows, err := db.QueryContext(ctx, `
+SELECT artist_name, COUNT(*) AS plays, SUM(COUNT(*)) OVER () AS total
+FROM scrobbles
+WHERE played_at_uts >= ? AND played_at_uts < ?
+GROUP BY artist_name
+ORDER BY plays DESC, MAX(played_at_uts) DESC, artist_name ASC
+LIMIT ?
+`, max(from, db.minSane), to, limit)
+		if err != nil {
+			return OnThisDay{}, err
+		}
+		for rows.Next() {
+			var a RankedArtist
+			if err := rows.Scan(&a.Artist, &a.Plays, &y.Plays); err != nil {
+				rows.Close()
+				return OnThisDay{}, err
+			}
+			a.Rank = len(y.TopArtists) + 1
+			y.TopArtists = append(y.TopArtists, a)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return OnThisDay{}, err
+		}
+
+		if y.Plays > 0 {
+			if y.FirstListens, err = firstListens(ctx, db, from, to, limit); err != nil {
+				return OnThisDay{}, err
+			}
+		}
+		out.Years = append(out.Years, y)
+	}
+	return out, nil
+}
+
+// firstListens lists the artists played in [from, to) and never before,
+// most played since first.
+func firstListens(ctx context.Context, db querier, from, to int64, limit int) ([]FirstListen, error) {
+	rows, err := db.QueryContext(ctx, `
+WITH day AS (
+  SELECT artist_name, COUNT(*) AS plays, MIN(played_at_uts) AS first_uts
+  FROM scrobbles
+  WHERE played_at_uts >= ? AND played_at_uts < ?
+  GROUP BY artist_name
+)
+SELECT d.artist_name,
+  (SELECT f.track_name FROM scrobbles f WHERE f.artist_name = d.artist_name AND f.played_at_uts = d.first_uts ORDER BY f.track_name LIMIT 1),
+  d.plays,
+  (SELECT COUNT(*) FROM scrobbles a WHERE a.artist_name = d.artist_name AND a.played_at_uts >= d.first_uts) AS since
+FROM day d
+WHERE NOT EXISTS (
+  SELECT 1 FROM scrobbles e
+  WHERE e.artist_name = d.artist_name AND e.played_at_uts >= ? AND e.played_at_uts < d.first_uts
+)
+ORDER BY since DESC, d.artist_name ASC
+LIMIT ?
+`, max(from, db.minSane), to, db.minSane, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []FirstListen{}
+	for rows.Next() {
+		var f FirstListen
+		if err := rows.Scan(&f.Artist, &f.Track, &f.Plays, &f.PlaysSince); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,66 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+func TestOnThisDay(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.Open(ctx, store.OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	play := func(artist, track string, at time.Time) {
+		t.Helper()
+		tr := lastfm.Track{Name: track, Artist: lastfm.TextMBID{Text: artist}, Date: &lastfm.Date{UTS: strconv.FormatInt(at.Unix(), 10)}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	y, m, d := time.Now().UTC().Date()
+	yearAgo := time.Date(y-1, m, d, 9, 0, 0, 0, time.UTC)
+	// Low was already known; Grouper and Burial are first heard that day,
+	// and Grouper stuck.
+	play("Low", "Words", yearAgo.AddDate(0, -1, 0))
+	play("Low", "Words", yearAgo)
+	play("Low", "Lullaby", yearAgo.Add(time.Minute))
+	play("Low", "Sunflower", yearAgo.Add(2*time.Minute))
+	play("Burial", "Archangel", yearAgo.Add(time.Hour))
+	play("Grouper", "Heavy Water", yearAgo.Add(2*time.Hour))
+	play("Grouper", "Alien Observer", yearAgo.Add(3*time.Hour))
+	play("Grouper", "Heavy Water", yearAgo.AddDate(0, 1, 0))
+	play("Grouper", "Heavy Water", yearAgo.AddDate(0, 2, 0))
+	// The next day doesn't count.
+	play("Boris", "Farewell", yearAgo.AddDate(0, 0, 1))
+
+	opt := DefaultOptions()
+	opt.Only = []string{"on_this_day"}
+	out, err := Build(ctx, s, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	years := out.OnThisDay.Years
+	if len(years) != 3 || years[0].YearsAgo != 1 || years[2].YearsAgo != 10 || years[1].Plays != 0 || len(years[2].TopArtists) != 0 {
+		t.Fatalf("years = %+v", years)
+	}
+	got := years[0]
+	if got.Date != yearAgo.Format("2006-01-02") || got.Plays != 6 || fmt.Sprint(got.TopArtists) != "[{1 Low 3} {2 Grouper 2} {3 Burial 1}]" {
+		t.Fatalf("a year ago = %+v", got)
+	}
+	if fmt.Sprint(got.FirstListens) != "[{Grouper Heavy Water 2 4} {Burial Archangel 1 1}]" {
+		t.Fatalf("first listens = %+v", got.FirstListens)
+	}
+
+	alone, err := BuildOnThisDay(ctx, s, DefaultOptions())
+	if err != nil || fmt.Sprint(alone) != fmt.Sprint(out.OnThisDay) {
+		t.Fatalf("BuildOnThisDay = %+v, %v; want %+v", alone, err, out.OnThisDay)
+	}
+}
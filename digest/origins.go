@@ -0,0 +1,117 @@
+package digest
+
+import "context"
+
+// Countries is plays by the artist's country, as MusicBrainz has it for the
+// artist MBIDs Last.fm gave (looked up by enrich). Plays of artists without
+// a known country are left out; Coverage is the share of dated plays that
+// are counted, so it's empty until enrich has run.
+type Countries struct {
+	// Plays is most played first.
+	Plays    []CountryPlays `json:"plays"`
+	Coverage float64        `json:"coverage"`
+}
+
+// CountryPlays is a country's plays (an ISO 3166-1 code, e.g. "GB") and
+// their share of those counted; Artists counts its artists played.
+type CountryPlays struct {
+	Country string  `json:"country"`
+	Plays   int64   `json:"plays"`
+	Share   float64 `json:"share"`
+	Artists int64   `json:"artists"`
+}
+
+// Decades is Countries for the decade each album first came out, reissues
+// counting as the original.
+type Decades struct {
+	// Plays is oldest decade first.
+	Plays    []DecadePlays `json:"plays"`
+	Coverage float64       `json:"coverage"`
+}
+
+// DecadePlays is a decade's plays (1990 for the 1990s) and their share of
+// those counted; Albums counts its albums played.
+type DecadePlays struct {
+	Decade int     `json:"decade"`
+	Plays  int64   `json:"plays"`
+	Share  float64 `json:"share"`
+	Albums int64   `json:"albums"`
+}
+
+func countries(ctx context.Context, db querier) (Countries, error) {
+	out := Countries{Plays: []CountryPlays{}}
+	rows, err := db.QueryContext(ctx, `
+SELECT COALESCE(m.country, '') AS country, COUNT(*) AS plays, COUNT(DISTINCT s.artist_norm)
+FROM scrobbles s
+LEFT JOIN musicbrainz_artists m ON m.mbid = s.artist_mbid
+WHERE s.played_at_uts >= ?
+GROUP BY country
+ORDER BY plays DESC, country ASC
+`, db.minSane)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+
+	var all, known int64
+	for rows.Next() {
+		var c CountryPlays
+		if err := rows.Scan(&c.Country, &c.Plays, &c.Artists); err != nil {
+			return out, err
+		}
+		all += c.Plays
+		if c.Country != "" {
+			known += c.Plays
+			out.Plays = append(out.Plays, c)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return out, err
+	}
+	for i := range out.Plays {
+		out.Plays[i].Share = round3(float64(out.Plays[i].Plays) / float64(known))
+	}
+	if all > 0 {
+		out.Coverage = round3(float64(known) / float64(all))
+	}
+	return out, nil
+}
+
+func decades(ctx context.Context, db querier) (Decades, error) {
+	out := Decades{Plays: []DecadePlays{}}
+	rows, err := db.QueryContext(ctx, `
+SELECT COALESCE(m.year, 0) / 10 * 10 AS decade, COUNT(*), COUNT(DISTINCT s.artist_norm || char(31) || s.album_norm)
+FROM scrobbles s
+LEFT JOIN musicbrainz_releases m ON m.mbid = s.album_mbid
+WHERE s.played_at_uts >= ?
+GROUP BY decade
+ORDER BY decade ASC
+`, db.minSane)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+
+	var all, known int64
+	for rows.Next() {
+		var d DecadePlays
+		if err := rows.Scan(&d.Decade, &d.Plays, &d.Albums); err != nil {
+			return out, err
+		}
+		all += d.Plays
+		if d.Decade != 0 {
+			known += d.Plays
+			out.Plays = append(out.Plays, d)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return out, err
+	}
+	for i := range out.Plays {
+		out.Plays[i].Share = round3(float64(out.Plays[i].Plays) / float64(known))
+	}
+	if all > 0 {
+		out.Coverage = round3(float64(known) / float64(all))
+	}
+	return out, nil
+}
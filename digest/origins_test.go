@@ -0,0 +1,87 @@
+package digest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+func TestCountriesAndDecades(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.Open(ctx, store.OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now().Add(-time.Hour).Unix()
+	for i, p := range []struct {
+		artist, artistMBID, album, albumMBID string
+		uts                                  int64
+	}{
+		{"Burial", "a-burial", "Untrue", "r-untrue", now},
+		{"Burial", "a-burial", "Untrue", "r-untrue", now},
+		{"Burial", "a-burial", "Untrue", "r-untrue", now},
+		{"Burial", "a-burial", "Untrue", "r-untrue", 86400},
+		{"Low", "a-low", "I Could Live in Hope", "r-low", now},
+		{"Grouper", "", "Dragging a Dead Deer", "", now},
+		{"Nobody Knows", "a-unknown", "", "", now},
+	} {
+		tr := lastfm.Track{
+			Name:   "t" + strconv.Itoa(i),
+			Artist: lastfm.TextMBID{Text: p.artist, MBID: p.artistMBID},
+			Album:  lastfm.TextMBID{Text: p.album, MBID: p.albumMBID},
+			Date:   &lastfm.Date{UTS: strconv.FormatInt(p.uts-int64(i)*60, 10)},
+		}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing is known before enrich.
+	opt := DefaultOptions()
+	opt.Only = []string{"countries", "decades"}
+	d, err := Build(ctx, s, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Countries.Plays) != 0 || d.Countries.Coverage != 0 || len(d.Decades.Plays) != 0 {
+		t.Fatalf("before enrich: countries %+v, decades %+v", d.Countries, d.Decades)
+	}
+
+	artists, err := s.UnknownArtistMBIDs(ctx, 10)
+	if got := fmt.Sprint(artists); err != nil || got != "[a-burial a-low a-unknown]" {
+		t.Fatalf("unknown artists = %s, %v", got, err)
+	}
+	for _, a := range []store.MBArtist{{MBID: "a-burial", Country: "GB"}, {MBID: "a-low", Country: "US"}, {MBID: "a-unknown"}} {
+		if err := s.PutMBArtist(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, r := range []store.MBRelease{{MBID: "r-untrue", Year: 2007}, {MBID: "r-low", Year: 1994}} {
+		if err := s.PutMBRelease(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if left, err := s.UnknownArtistMBIDs(ctx, 10); err != nil || len(left) != 0 {
+		t.Fatalf("unknown artists after enrich = %v, %v", left, err)
+	}
+
+	// The placeholder-dated play (in 1970) doesn't count; Grouper and
+	// Nobody Knows aren't known.
+	d, err = Build(ctx, s, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(d.Countries); got != "{[{GB 3 0.75 1} {US 1 0.25 1}] 0.667}" {
+		t.Errorf("countries = %s", got)
+	}
+	if got := fmt.Sprint(d.Decades); got != "{[{1990 1 0.25 1} {2000 3 0.75 1}] 0.667}" {
+		t.Errorf("decades = %s", got)
+	}
+}
@@ -0,0 +1,152 @@
+package digest
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+)
+
+// renderTopN is how many entries each rendered list shows.
+const renderTopN = 10
+
+// table is one section of a rendered digest.
+type table struct {
+	Title string
+	Head  []string
+	Rows  [][]string
+}
+
+// Markdown renders the digest's headline sections as a short document for
+// reading, e.g. in an email; the JSON stays the complete form.
+func Markdown(d Digest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n%s\n", renderTitle(d), renderSummary(d))
+	for _, t := range renderTables(d) {
+		fmt.Fprintf(&b, "\n## %s\n\n| %s |\n|%s\n", t.Title, strings.Join(t.Head, " | "), strings.Repeat("---|", len(t.Head)))
+		for _, r := range t.Rows {
+			cells := make([]string, len(r))
+			for i, c := range r {
+				cells[i] = strings.ReplaceAll(c, "|", `\|`)
+			}
+			fmt.Fprintf(&b, "| %s |\n", strings.Join(cells, " | "))
+		}
+	}
+	return b.String()
+}
+
+var htmlTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body style="font-family: sans-serif; max-width: 40em">
+<h1>{{.Title}}</h1>
+<p>{{.Summary}}</p>
+{{range .Tables}}<h2>{{.Title}}</h2>
+<table cellpadding="4">
+<tr>{{range .Head}}<th align="left">{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}</body></html>
+`))
+
+// HTML renders the same sections as Markdown as a self-contained page.
+func HTML(d Digest) (string, error) {
+	var b bytes.Buffer
+	err := htmlTemplate.Execute(&b, struct {
+		Title, Summary string
+		Tables         []table
+	}{renderTitle(d), renderSummary(d), renderTables(d)})
+	return b.String(), err
+}
+
+func renderTitle(d Digest) string {
+	return "Listening digest, " + d.Meta.GeneratedAt.Format("2 January 2006")
+}
+
+func renderSummary(d Digest) string {
+	s := fmt.Sprintf("%d scrobbles", d.Meta.ScrobblesDated)
+	if d.Meta.DatedMinUTS != 0 {
+		s += " since " + time.Unix(d.Meta.DatedMinUTS, 0).UTC().Format("January 2006")
+	}
+	if len(d.Meta.Users) > 0 {
+		s += ", by " + strings.Join(d.Meta.Users, ", ")
+	}
+	if d.Meta.Redacted {
+		s += " (redacted)"
+	}
+	return s + "."
+}
+
+func renderTables(d Digest) []table {
+	var out []table
+	add := func(t table) {
+		if len(t.Rows) > renderTopN {
+			t.Rows = t.Rows[:renderTopN]
+		}
+		if len(t.Rows) > 0 {
+			out = append(out, t)
+		}
+	}
+	n := func(v int64) string { return fmt.Sprint(v) }
+	// Rank 0 is outside the chart.
+	rank := func(r int) string {
+		if r == 0 {
+			return "-"
+		}
+		return fmt.Sprint(r)
+	}
+
+	artists := table{Title: "Top artists, 30 days", Head: []string{"#", "Artist", "Plays"}}
+	for _, a := range d.Top.Artists30d {
+		artists.Rows = append(artists.Rows, []string{fmt.Sprint(a.Rank), a.Artist, n(a.Plays)})
+	}
+	add(artists)
+	tracks := table{Title: "Top tracks, 30 days", Head: []string{"#", "Artist", "Track", "Plays"}}
+	for _, t := range d.Top.Tracks30d {
+		tracks.Rows = append(tracks.Rows, []string{fmt.Sprint(t.Rank), t.Artist, t.Track, n(t.Plays)})
+	}
+	add(tracks)
+	albums := table{Title: "Top albums, 30 days", Head: []string{"#", "Artist", "Album", "Plays"}}
+	for _, a := range d.Top.Albums30d {
+		albums.Rows = append(albums.Rows, []string{fmt.Sprint(a.Rank), a.Artist, a.Album, n(a.Plays)})
+	}
+	add(albums)
+	moves := func(title string, ms []RankMove) {
+		t := table{Title: title, Head: []string{"Artist", "Rank", "Was"}}
+		for _, m := range ms {
+			t.Rows = append(t.Rows, []string{m.Artist, rank(m.Rank), rank(m.PrevRank)})
+		}
+		add(t)
+	}
+	if d.RiseAndFall.Note != "" {
+		add(table{Title: "Rising and falling", Head: []string{"Note"}, Rows: [][]string{{d.RiseAndFall.Note}}})
+	}
+	moves("Rising", d.RiseAndFall.Rising)
+	moves("Falling", d.RiseAndFall.Falling)
+	resurface := table{Title: "Worth a replay", Head: []string{"Artist", "Track", "Plays", "Last played"}}
+	for _, t := range d.Resurface.Tracks180d {
+		resurface.Rows = append(resurface.Rows, []string{t.Artist, t.Track, n(t.Plays), time.Unix(t.LastPlayedUTS, 0).UTC().Format("2006-01-02")})
+	}
+	add(resurface)
+	discoveries := table{Title: "New to you, 30 days", Head: []string{"Artist", "First track", "First played"}}
+	for _, a := range d.Discoveries.Artists30d {
+		discoveries.Rows = append(discoveries.Rows, []string{a.Artist, a.Track, a.FirstPlayedAt[:len("2006-01-02")]})
+	}
+	add(discoveries)
+	onThisDay := table{Title: "On this day", Head: []string{"Date", "Plays", "Top artists", "First listens"}}
+	for _, y := range d.OnThisDay.Years {
+		if y.Plays == 0 {
+			continue
+		}
+		var top, first []string
+		for _, a := range y.TopArtists {
+			top = append(top, a.Artist)
+		}
+		for _, f := range y.FirstListens {
+			first = append(first, f.Artist)
+		}
+		onThisDay.Rows = append(onThisDay.Rows, []string{y.Date, n(y.Plays), strings.Join(top, ", "), strings.Join(first, ", ")})
+	}
+	add(onThisDay)
+	return out
+}
@@ -0,0 +1,183 @@
+package digest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// RiseAndFall compares the latest rolling 30-day artist chart with the chart
+// from WindowDays earlier, or the last one before that. Ranks are 0 when the
+// artist was outside the chart. Note says why the lists are empty when the
+// charts don't go back that far.
+type RiseAndFall struct {
+	ChartDate  string     `json:"chart_date,omitempty"`
+	ComparedTo string     `json:"compared_to,omitempty"`
+	Note       string     `json:"note,omitempty"`
+	Rising     []RankMove `json:"rising"`
+	Falling    []RankMove `json:"falling"`
+}
+
+type RankMove struct {
+	Artist   string `json:"artist"`
+	Rank     int    `json:"rank"`
+	PrevRank int    `json:"prev_rank"`
+	Change   int    `json:"change"`
+	// Trajectory holds weekly chart ranks, oldest first, ending at ChartDate.
+	Trajectory []int `json:"trajectory"`
+}
+
+const chartDateLayout = "2006-01-02"
+
+func riseAndFall(ctx context.Context, db querier, windowDays, trajectoryWeeks, limit int) (RiseAndFall, error) {
+	out := RiseAndFall{Rising: []RankMove{}, Falling: []RankMove{}}
+	if len(db.filter.ExcludeRanges) > 0 {
+		// Charts are precomputed over every scrobble, so they can't honor
+		// redacted periods; leave the section empty rather than leak them.
+		return out, nil
+	}
+	if len(db.filter.AlsoUsers) > 0 {
+		// Each user has their own charts; a merged digest has none.
+		return out, nil
+	}
+
+	var latest sql.NullString
+	if err := db.QueryRowContext(ctx, `SELECT MAX(chart_date) FROM artist_rank_history WHERE user_name = ?`, db.filter.User).Scan(&latest); err != nil {
+		return out, err
+	}
+	if !latest.Valid {
+		return out, nil
+	}
+	end, err := time.Parse(chartDateLayout, latest.String)
+	if err != nil {
+		return out, err
+	}
+	out.ChartDate = latest.String
+	windowStart := end.AddDate(0, 0, -windowDays).Format(chartDateLayout)
+	var prevDate sql.NullString
+	if err := db.QueryRowContext(ctx, `SELECT MAX(chart_date) FROM artist_rank_history WHERE user_name = ? AND chart_date <= ?`, db.filter.User, windowStart).Scan(&prevDate); err != nil {
+		return out, err
+	}
+	if !prevDate.Valid {
+		// Everyone would look like they're rising from outside the chart.
+		out.Note = fmt.Sprintf("no chart from %s or before to compare with", windowStart)
+		return out, nil
+	}
+
+	cur, err := chartRanks(ctx, db, latest.String)
+	if err != nil {
+		return out, err
+	}
+	prev, err := chartRanks(ctx, db, prevDate.String)
+	if err != nil {
+		return out, err
+	}
+	out.ComparedTo = prevDate.String
+
+	// Artists outside a chart are treated as one place below its depth.
+	outside := store.ArtistChartDepth + 1
+	rankOr := func(m map[string]int, a string) int {
+		if r, ok := m[a]; ok {
+			return r
+		}
+		return outside
+	}
+
+	var moves []RankMove
+	seen := map[string]bool{}
+	for _, m := range []map[string]int{cur, prev} {
+		for a := range m {
+			if seen[a] || db.filter.ExcludesArtist(a) {
+				continue
+			}
+			seen[a] = true
+			change := rankOr(prev, a) - rankOr(cur, a)
+			if change == 0 {
+				continue
+			}
+			moves = append(moves, RankMove{Artist: a, Rank: cur[a], PrevRank: prev[a], Change: change})
+		}
+	}
+	sort.Slice(moves, func(i, j int) bool {
+		if moves[i].Change == moves[j].Change {
+			return moves[i].Artist < moves[j].Artist
+		}
+		return moves[i].Change > moves[j].Change
+	})
+
+	for i := 0; i < len(moves) && len(out.Rising) < limit && moves[i].Change > 0; i++ {
+		out.Rising = append(out.Rising, moves[i])
+	}
+	for i := len(moves) - 1; i >= 0 && len(out.Falling) < limit && moves[i].Change < 0; i-- {
+		out.Falling = append(out.Falling, moves[i])
+	}
+
+	for _, list := range [][]RankMove{out.Rising, out.Falling} {
+		for i := range list {
+			t, err := trajectory(ctx, db, list[i].Artist, end, trajectoryWeeks)
+			if err != nil {
+				return out, err
+			}
+			list[i].Trajectory = t
+		}
+	}
+	return out, nil
+}
+
+func chartRanks(ctx context.Context, db querier, chartDate string) (map[string]int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT artist_name, rank FROM artist_rank_history WHERE user_name = ? AND chart_date = ?`, db.filter.User, chartDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]int{}
+	for rows.Next() {
+		var artist string
+		var rank int
+		if err := rows.Scan(&artist, &rank); err != nil {
+			return nil, err
+		}
+		out[artist] = rank
+	}
+	return out, rows.Err()
+}
+
+func trajectory(ctx context.Context, db querier, artist string, end time.Time, weeks int) ([]int, error) {
+	start := end.AddDate(0, 0, -7*(weeks-1))
+	rows, err := db.QueryContext(ctx, `
+SELECT chart_date, rank
+FROM artist_rank_history
+WHERE user_name = ?
+  AND artist_name = ?
+  AND chart_date >= ?
+  AND chart_date <= ?
+`, db.filter.User, artist, start.Format(chartDateLayout), end.Format(chartDateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byDate := map[string]int{}
+	for rows.Next() {
+		var d string
+		var rank int
+		if err := rows.Scan(&d, &rank); err != nil {
+			return nil, err
+		}
+		byDate[d] = rank
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]int, 0, weeks)
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 7) {
+		out = append(out, byDate[d.Format(chartDateLayout)])
+	}
+	return out, nil
+}
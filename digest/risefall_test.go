@@ -0,0 +1,50 @@
+package digest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+func TestRiseAndFallNeedsAnEarlierChart(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.Open(ctx, store.OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	end := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	chart := func(daysBefore int, artists ...string) {
+		t.Helper()
+		for i, a := range artists {
+			if _, err := s.DB.ExecContext(ctx, `INSERT INTO artist_rank_history (chart_date, rank, artist_name, plays) VALUES (?, ?, ?, ?)`,
+				end.AddDate(0, 0, -daysBefore).Format(chartDateLayout), i+1, a, 10-i); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	db := querier{db: s.DB, minSane: s.MinSaneUTS()}
+
+	// Ten days of charts: nothing to say who's rising over 90.
+	chart(10, "Burial", "Kode9")
+	chart(0, "Kode9", "Burial")
+	rf, err := riseAndFall(ctx, db, 90, 13, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rf.Rising) != 0 || len(rf.Falling) != 0 || rf.ComparedTo != "" || rf.Note != "no chart from 2024-03-03 or before to compare with" {
+		t.Fatalf("short history: %+v", rf)
+	}
+
+	// With no chart exactly 90 days back, the one before it will do.
+	chart(95, "Burial")
+	rf, err = riseAndFall(ctx, db, 90, 13, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rf.ComparedTo != "2024-02-27" || rf.Note != "" || len(rf.Rising) != 1 || rf.Rising[0].Artist != "Kode9" || len(rf.Falling) != 1 || rf.Falling[0].Artist != "Burial" {
+		t.Fatalf("compared with an earlier chart: %+v", rf)
+	}
+}
@@ -0,0 +1,136 @@
+package digest
+
+import "context"
+
+// Seasonal aggregates plays by calendar month across all years (UTC), to
+// find what suits the time of year.
+type Seasonal struct {
+	// Months always has 12 entries, January first.
+	Months []MonthPlays `json:"months"`
+	// Artists are the most seasonal: those whose plays cluster in one month.
+	Artists []SeasonalArtist `json:"artists"`
+}
+
+type MonthPlays struct {
+	Month      int            `json:"month"`
+	Plays      int64          `json:"plays"`
+	TopArtists []RankedArtist `json:"top_artists"`
+}
+
+// SeasonalArtist is an artist's peak month. Share is the part of all the
+// artist's plays that fell in it (an even spread would be 1/12); Years
+// counts the years it was played in that month.
+type SeasonalArtist struct {
+	Rank         int     `json:"rank"`
+	Artist       string  `json:"artist"`
+	Month        int     `json:"month"`
+	PlaysInMonth int64   `json:"plays_in_month"`
+	Plays        int64   `json:"plays"`
+	Share        float64 `json:"share"`
+	Years        int64   `json:"years"`
+}
+
+func seasonal(ctx context.Context, db querier, opt Options) (Seasonal, error) {
+	months, err := monthlyPlays(ctx, db, opt.SeasonalTopArtistsPerMonth)
+	if err != nil {
+		return Seasonal{}, err
+	}
+	artists, err := seasonalArtists(ctx, db, opt.SeasonalMinPlays, opt.SeasonalMinYears, opt.SeasonalArtistsLimit)
+	if err != nil {
+		return Seasonal{}, err
+	}
+	return Seasonal{Months: months, Artists: artists}, nil
+}
+
+func monthlyPlays(ctx context.Context, db querier, perMonth int) ([]MonthPlays, error) {
+	rows, err := db.QueryContext(ctx, `
+WITH monthly AS (
+  SELECT
+    CAST(substr(played_date_local, 6, 2) AS INTEGER) AS month,
+    artist_name,
+    COUNT(*) AS plays,
+    MAX(played_at_uts) AS last_played
+  FROM scrobbles
+  WHERE played_at_uts >= ?
+  GROUP BY month, artist_name
+),
+ranked AS (
+  SELECT month, artist_name, plays,
+         SUM(plays) OVER (PARTITION BY month) AS total,
+         ROW_NUMBER() OVER (PARTITION BY month ORDER BY plays DESC, last_played DESC, artist_name) AS rnk
+  FROM monthly
+)
+SELECT month, total, rnk, artist_name, plays
+FROM ranked
+WHERE rnk <= ?
+ORDER BY month ASC, rnk ASC
+`, db.minSane, perMonth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]MonthPlays, 12)
+	for i := range out {
+		out[i] = MonthPlays{Month: i + 1, TopArtists: []RankedArtist{}}
+	}
+	for rows.Next() {
+		var month, rank int
+		var total, plays int64
+		var artist string
+		if err := rows.Scan(&month, &total, &rank, &artist, &plays); err != nil {
+			return nil, err
+		}
+		m := &out[month-1]
+		m.Plays = total
+		m.TopArtists = append(m.TopArtists, RankedArtist{Rank: rank, Artist: artist, Plays: plays})
+	}
+	return out, rows.Err()
+}
+
+// seasonalArtists ranks artists by the share of their plays in their peak
+// month. Only artists with minPlays overall, played in that month in at
+// least minYears years and at least twice as much as an even spread count,
+// so a single binge doesn't make a season.
+func seasonalArtists(ctx context.Context, db querier, minPlays, minYears, limit int) ([]SeasonalArtist, error) {
+	rows, err := db.QueryContext(ctx, `
+WITH monthly AS (
+  SELECT
+    artist_name,
+    CAST(substr(played_date_local, 6, 2) AS INTEGER) AS month,
+    COUNT(*) AS plays,
+    COUNT(DISTINCT played_year_local) AS years
+  FROM scrobbles
+  WHERE played_at_uts >= ?
+  GROUP BY artist_name, month
+),
+ranked AS (
+  SELECT artist_name, month, plays, years,
+         SUM(plays) OVER (PARTITION BY artist_name) AS total,
+         ROW_NUMBER() OVER (PARTITION BY artist_name ORDER BY plays DESC, month) AS rnk
+  FROM monthly
+)
+SELECT artist_name, month, plays, total, years
+FROM ranked
+WHERE rnk = 1 AND total >= ? AND years >= ? AND plays * 6 >= total
+ORDER BY CAST(plays AS REAL) / total DESC, total DESC, artist_name
+LIMIT ?
+`, db.minSane, minPlays, minYears, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []SeasonalArtist{}
+	rank := 1
+	for rows.Next() {
+		a := SeasonalArtist{Rank: rank}
+		if err := rows.Scan(&a.Artist, &a.Month, &a.PlaysInMonth, &a.Plays, &a.Years); err != nil {
+			return nil, err
+		}
+		a.Share = round3(float64(a.PlaysInMonth) / float64(a.Plays))
+		out = append(out, a)
+		rank++
+	}
+	return out, rows.Err()
+}
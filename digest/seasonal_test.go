@@ -0,0 +1,52 @@
+package digest
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+func TestSeasonalFindsDecemberArtist(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.Open(ctx, store.OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	play := func(artist string, at time.Time, n int) {
+		for i := 0; i < n; i++ {
+			uts := at.Add(time.Duration(i) * time.Hour).Unix()
+			tr := lastfm.Track{Name: "t" + strconv.Itoa(i), Artist: lastfm.TextMBID{Text: artist}, Date: &lastfm.Date{UTS: strconv.FormatInt(uts, 10)}}
+			if _, err := s.InsertScrobble(ctx, tr); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// Low every December; Burial all year round; Sufjan one December binge.
+	for year := 2019; year <= 2021; year++ {
+		play("Low", time.Date(year, 12, 10, 0, 0, 0, 0, time.UTC), 10)
+		for m := time.January; m <= time.December; m++ {
+			play("Burial", time.Date(year, m, 3, 0, 0, 0, 0, time.UTC), 2)
+		}
+	}
+	play("Sufjan Stevens", time.Date(2020, 12, 20, 0, 0, 0, 0, time.UTC), 35)
+
+	d, err := Build(ctx, s, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Seasonal.Artists; len(got) != 1 || got[0].Artist != "Low" || got[0].Month != 12 || got[0].Share != 1 || got[0].Years != 3 {
+		t.Fatalf("seasonal artists = %+v, want just Low in December", got)
+	}
+	dec := d.Seasonal.Months[11]
+	if dec.Month != 12 || dec.Plays != 30+35+6 || dec.TopArtists[0].Artist != "Sufjan Stevens" {
+		t.Fatalf("December = %+v", dec)
+	}
+	if len(d.Seasonal.Months) != 12 || d.Seasonal.Months[0].Plays != 6 {
+		t.Fatalf("months = %+v", d.Seasonal.Months)
+	}
+}
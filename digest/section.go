@@ -0,0 +1,101 @@
+package digest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Querier is the read access a Section gets: the store's database as seen
+// through Options.Filter, so custom sections honor redaction like built-ins.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Section is a custom digest section. Each section's result is serialized
+// under the digest's "extensions" object, keyed by Name.
+type Section interface {
+	Name() string
+	Build(ctx context.Context, db Querier, opt Options) (any, error)
+}
+
+// SectionFunc adapts a function to a Section.
+func SectionFunc(name string, fn func(ctx context.Context, db Querier, opt Options) (any, error)) Section {
+	return sectionFunc{name: name, fn: fn}
+}
+
+type sectionFunc struct {
+	name string
+	fn   func(ctx context.Context, db Querier, opt Options) (any, error)
+}
+
+func (s sectionFunc) Name() string { return s.name }
+
+func (s sectionFunc) Build(ctx context.Context, db Querier, opt Options) (any, error) {
+	return s.fn(ctx, db, opt)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Section{}
+)
+
+// Register makes a section part of every digest. It panics if the name is
+// empty or already registered, like database/sql.Register.
+func Register(s Section) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	name := s.Name()
+	if name == "" {
+		panic("digest: Register section with empty name")
+	}
+	if _, dup := registry[name]; dup {
+		panic("digest: Register called twice for section " + name)
+	}
+	registry[name] = s
+}
+
+// extensionSections returns registered sections (by name) followed by the
+// per-call ones; a per-call section replaces a registered one of that name.
+func extensionSections(extra []Section) []Section {
+	registryMu.RLock()
+	byName := make(map[string]Section, len(registry)+len(extra))
+	for name, s := range registry {
+		byName[name] = s
+	}
+	registryMu.RUnlock()
+	for _, s := range extra {
+		byName[s.Name()] = s
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]Section, 0, len(names))
+	for _, name := range names {
+		out = append(out, byName[name])
+	}
+	return out
+}
+
+func buildExtensions(ctx context.Context, db Querier, opt Options) (map[string]any, error) {
+	sections := extensionSections(opt.Sections)
+	if len(sections) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]any, len(sections))
+	for _, s := range sections {
+		v, err := s.Build(ctx, db, opt)
+		if err != nil {
+			return nil, fmt.Errorf("digest section %s: %w", s.Name(), err)
+		}
+		out[s.Name()] = v
+	}
+	return out, nil
+}
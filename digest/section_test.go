@@ -0,0 +1,47 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+func TestCustomSectionUnderExtensions(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.Open(ctx, store.OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for i, artist := range []string{"Low", "Burial", "Burial"} {
+		tr := lastfm.Track{Name: "t", Artist: lastfm.TextMBID{Text: artist}, Date: &lastfm.Date{UTS: []string{"1600000000", "1600000001", "1600000002"}[i]}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count := SectionFunc("artist_count", func(ctx context.Context, db Querier, _ Options) (any, error) {
+		var n int
+		err := db.QueryRowContext(ctx, `SELECT COUNT(DISTINCT artist_name) FROM scrobbles`).Scan(&n)
+		return n, err
+	})
+	opt := DefaultOptions()
+	opt.Sections = []Section{count}
+	opt.Filter = store.Filter{ExcludeArtists: []string{"low"}}
+
+	d, err := Build(ctx, s, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"extensions":{"artist_count":1}`) {
+		t.Fatalf("expected filtered custom section under extensions, got %s", b)
+	}
+}
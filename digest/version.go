@@ -0,0 +1,23 @@
+package digest
+
+import "fmt"
+
+// SchemaVersion is the version of the digest's JSON shape, written as
+// meta.schema_version. Adding a section or field keeps it; renaming,
+// removing or retyping one bumps it, and the shape before stays available
+// through Options.SchemaVersion back to MinSchemaVersion.
+const SchemaVersion = 1
+
+// MinSchemaVersion is the oldest shape Build still writes on request.
+const MinSchemaVersion = 1
+
+// schemaVersion is the version opt asks for: v, or the current one for 0.
+func schemaVersion(v int) (int, error) {
+	if v == 0 {
+		return SchemaVersion, nil
+	}
+	if v < MinSchemaVersion || v > SchemaVersion {
+		return 0, fmt.Errorf("unsupported digest schema version %d (supported: %d to %d)", v, MinSchemaVersion, SchemaVersion)
+	}
+	return v, nil
+}
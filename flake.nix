@@ -16,7 +16,7 @@
           version = "0.1.0";
           src = ./.;
           subPackages = [ "cmd/lastfm-golang" ];
-          vendorHash = "sha256-h6cHghxBPGqLh80r5q8zipjBOUZdtbPpGlVEH/AYvhI=";
+          vendorHash = "sha256-HdvDBynEqw3pJyQrFHE/fbi8BiHZF+8hYSi+AiBzsJw=";
         };
 
         apps.default = flake-utils.lib.mkApp {
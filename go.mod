@@ -2,7 +2,11 @@ module github.com/joshp123/lastfm-golang
 
 go 1.25.5
 
-require modernc.org/sqlite v1.45.0
+require (
+	golang.org/x/term v0.36.0
+	golang.org/x/text v0.30.0
+	modernc.org/sqlite v1.45.0
+)
 
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
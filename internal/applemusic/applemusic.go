@@ -0,0 +1,308 @@
+// Package applemusic reads play counts from Apple Music / iTunes library
+// exports: the "Library.xml" property list (File > Library > Export Library)
+// and CSV or tab-separated track lists.
+package applemusic
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Track is one library entry and its lifetime play count. Zero times are unknown.
+type Track struct {
+	Artist     string
+	Name       string
+	Album      string
+	Plays      int64
+	LastPlayed time.Time
+	Added      time.Time
+}
+
+// ReadFile reads a library export, picking the format from its content.
+func ReadFile(path string) ([]Track, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b = toUTF8(b)
+	if head := bytes.TrimSpace(b[:min(len(b), 512)]); bytes.HasPrefix(head, []byte("<?xml")) || bytes.HasPrefix(head, []byte("<plist")) {
+		return ReadLibraryXML(bytes.NewReader(b))
+	}
+	return ReadCSV(bytes.NewReader(b))
+}
+
+// ReadLibraryXML reads the Tracks dictionary of an iTunes/Music Library.xml.
+// Podcasts, films, TV shows and never-played tracks are skipped.
+func ReadLibraryXML(r io.Reader) ([]Track, error) {
+	d := xml.NewDecoder(r)
+	var root any
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local != "plist" {
+			if root, err = plistValue(d, se); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	lib, ok := root.(map[string]any)
+	if !ok {
+		return nil, errors.New("applemusic: not a library property list")
+	}
+	tracks, ok := lib["Tracks"].(map[string]any)
+	if !ok {
+		return nil, errors.New("applemusic: library has no Tracks")
+	}
+
+	var out []Track
+	for _, v := range tracks {
+		m, ok := v.(map[string]any)
+		if !ok || m["Podcast"] == true || m["Movie"] == true || m["TV Show"] == true {
+			continue
+		}
+		t := Track{
+			Name:   str(m["Name"]),
+			Artist: str(m["Artist"]),
+			Album:  str(m["Album"]),
+		}
+		if t.Artist == "" {
+			t.Artist = str(m["Album Artist"])
+		}
+		t.Plays, _ = m["Play Count"].(int64)
+		t.LastPlayed, _ = m["Play Date UTC"].(time.Time)
+		t.Added, _ = m["Date Added"].(time.Time)
+		if t.Plays > 0 && t.Artist != "" && t.Name != "" {
+			out = append(out, t)
+		}
+	}
+	slices.SortFunc(out, func(a, b Track) int {
+		return cmp.Or(cmp.Compare(a.Artist, b.Artist), cmp.Compare(a.Name, b.Name), cmp.Compare(a.Album, b.Album))
+	})
+	return out, nil
+}
+
+// plistValue decodes the element started by se into map[string]any,
+// []any, string, int64, float64, bool, time.Time or []byte.
+func plistValue(d *xml.Decoder, se xml.StartElement) (any, error) {
+	switch se.Name.Local {
+	case "dict":
+		m := map[string]any{}
+		var key string
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if err := d.DecodeElement(&key, &t); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				v, err := plistValue(d, t)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = v
+			case xml.EndElement:
+				return m, nil
+			}
+		}
+	case "array":
+		var a []any
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				v, err := plistValue(d, t)
+				if err != nil {
+					return nil, err
+				}
+				a = append(a, v)
+			case xml.EndElement:
+				return a, nil
+			}
+		}
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+		return se.Name.Local == "true", nil
+	}
+
+	var s string
+	if err := d.DecodeElement(&s, &se); err != nil {
+		return nil, err
+	}
+	switch se.Name.Local {
+	case "integer":
+		return strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	case "real":
+		return strconv.ParseFloat(strings.TrimSpace(s), 64)
+	case "date":
+		return time.Parse(time.RFC3339, strings.TrimSpace(s))
+	case "data":
+		return []byte(strings.TrimSpace(s)), nil
+	default:
+		return s, nil
+	}
+}
+
+// csvColumns maps the header names seen in Music exports, Apple's privacy
+// data export and hand-made sheets onto Track fields.
+var csvColumns = map[string]string{
+	"name": "name", "title": "name", "track": "name", "track name": "name", "song name": "name", "track description": "name",
+	"artist": "artist", "artist name": "artist", "album artist": "album artist",
+	"album": "album", "album name": "album", "container description": "album",
+	"plays": "plays", "play count": "plays", "track play count": "plays",
+	"last played": "last", "play date utc": "last", "last played date": "last",
+	"date added": "added", "date added to library": "added",
+}
+
+// ReadCSV reads a comma- or tab-separated track list with a header row.
+// Rows without a play count or artist are skipped.
+func ReadCSV(r io.Reader) ([]Track, error) {
+	br := bufio.NewReader(r)
+	first, err := br.Peek(4096)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, err
+	}
+	cr := csv.NewReader(br)
+	if line, _, _ := bytes.Cut(first, []byte("\n")); bytes.Count(line, []byte("\t")) > bytes.Count(line, []byte(",")) {
+		cr.Comma = '\t'
+		cr.LazyQuotes = true
+	}
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("applemusic: read header: %w", err)
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		if f, ok := csvColumns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))]; ok {
+			if _, dup := col[f]; !dup {
+				col[f] = i
+			}
+		}
+	}
+	if _, ok := col["plays"]; !ok {
+		return nil, errors.New("applemusic: no play count column (expected Plays or Play Count)")
+	}
+	if _, ok := col["name"]; !ok {
+		return nil, errors.New("applemusic: no track name column (expected Name or Title)")
+	}
+
+	field := func(rec []string, f string) string {
+		if i, ok := col[f]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var out []Track
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		t := Track{
+			Name:   field(rec, "name"),
+			Artist: field(rec, "artist"),
+			Album:  field(rec, "album"),
+		}
+		if t.Artist == "" {
+			t.Artist = field(rec, "album artist")
+		}
+		t.Plays, _ = strconv.ParseInt(strings.ReplaceAll(field(rec, "plays"), ",", ""), 10, 64)
+		t.LastPlayed = parseTime(field(rec, "last"))
+		t.Added = parseTime(field(rec, "added"))
+		if t.Plays > 0 && t.Artist != "" && t.Name != "" {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// Date formats vary by export and locale; unrecognized dates are left unknown.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"1/2/2006 3:04 PM",
+	"1/2/06 3:04 PM",
+	"1/2/2006, 3:04 PM",
+	"2/1/2006 15:04",
+	"02/01/2006, 15:04",
+}
+
+func parseTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil && ms > 1e11 {
+		return time.UnixMilli(ms).UTC()
+	}
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// toUTF8 converts UTF-16 input (as written by Music's text export) to UTF-8.
+func toUTF8(b []byte) []byte {
+	if len(b) < 2 {
+		return b
+	}
+	var big bool
+	switch {
+	case b[0] == 0xFF && b[1] == 0xFE:
+	case b[0] == 0xFE && b[1] == 0xFF:
+		big = true
+	default:
+		return bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	}
+	u := make([]uint16, 0, len(b)/2)
+	for i := 2; i+1 < len(b); i += 2 {
+		if big {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		} else {
+			u = append(u, uint16(b[i+1])<<8|uint16(b[i]))
+		}
+	}
+	return []byte(string(utf16.Decode(u)))
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,91 @@
+package applemusic
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const libraryXML = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple Computer//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Major Version</key><integer>1</integer>
+	<key>Tracks</key>
+	<dict>
+		<key>101</key>
+		<dict>
+			<key>Track ID</key><integer>101</integer>
+			<key>Name</key><string>Roygbiv</string>
+			<key>Artist</key><string>Boards of Canada</string>
+			<key>Album</key><string>Music Has the Right to Children</string>
+			<key>Date Added</key><date>2006-03-01T10:00:00Z</date>
+			<key>Play Count</key><integer>87</integer>
+			<key>Play Date UTC</key><date>2009-11-20T21:15:00Z</date>
+		</dict>
+		<key>102</key>
+		<dict>
+			<key>Name</key><string>Episode 12</string>
+			<key>Artist</key><string>Some Podcast</string>
+			<key>Play Count</key><integer>3</integer>
+			<key>Podcast</key><true/>
+		</dict>
+		<key>103</key>
+		<dict>
+			<key>Name</key><string>Never Played</string>
+			<key>Artist</key><string>Nobody</string>
+		</dict>
+	</dict>
+	<key>Playlists</key><array><dict><key>Name</key><string>Library</string></dict></array>
+</dict>
+</plist>`
+
+func TestReadLibraryXML(t *testing.T) {
+	got, err := ReadLibraryXML(strings.NewReader(libraryXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d tracks, want 1: %+v", len(got), got)
+	}
+	tr := got[0]
+	if tr.Artist != "Boards of Canada" || tr.Name != "Roygbiv" || tr.Plays != 87 {
+		t.Errorf("track = %+v", tr)
+	}
+	if want := time.Date(2009, 11, 20, 21, 15, 0, 0, time.UTC); !tr.LastPlayed.Equal(want) {
+		t.Errorf("last played = %v, want %v", tr.LastPlayed, want)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	for name, in := range map[string]string{
+		"comma": "Name,Artist,Album,Plays,Last Played\n" +
+			"Roygbiv,Boards of Canada,\"Music Has the Right to Children\",87,2009-11-20 21:15:00\n" +
+			"Unplayed,Nobody,,0,\n",
+		"tab": "Name\tArtist\tAlbum\tPlays\tLast Played\n" +
+			"Roygbiv\tBoards of Canada\tMusic Has the Right to Children\t87\t11/20/2009 9:15 PM\n",
+	} {
+		got, err := ReadCSV(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(got) != 1 || got[0].Plays != 87 || got[0].Album != "Music Has the Right to Children" {
+			t.Fatalf("%s: got %+v", name, got)
+		}
+		if got[0].LastPlayed.Year() != 2009 {
+			t.Errorf("%s: last played = %v", name, got[0].LastPlayed)
+		}
+	}
+
+	if _, err := ReadCSV(strings.NewReader("Name,Artist\nx,y\n")); err == nil {
+		t.Error("expected an error without a play count column")
+	}
+}
+
+func TestToUTF8(t *testing.T) {
+	// "Né" in UTF-16LE with a BOM.
+	in := []byte{0xFF, 0xFE, 'N', 0, 0xE9, 0}
+	if got := string(toUTF8(in)); got != "Né" {
+		t.Errorf("toUTF8 = %q", got)
+	}
+}
@@ -7,23 +7,165 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/joshp123/lastfm-golang/internal/notify"
 	"github.com/joshp123/lastfm-golang/internal/xdg"
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
 )
 
+// DryRunCommands are the commands --dry-run works with; the flag's help,
+// the usage text and the CLI's check all list them from here.
+var DryRunCommands = []string{"backfill", "sync", "import", "edit", "reconcile", "delete", "undelete", "repair-dates", "prune", "enrich"}
+
 type Config struct {
 	APIKey       string
 	SharedSecret string
+	SessionKey   string
 	Username     string
 
-	EnvFile   string
-	DataDir   string
-	Verbose   bool
-	UserAgent string
+	EnvFile    string
+	DataDir    string
+	Verbose    bool
+	Quiet      bool
+	UserAgent  string
+	APIBaseURL string
+	RateLimit  time.Duration
+	// MusicBrainzURL is the MusicBrainz API root enrich uses; empty is
+	// musicbrainz.org.
+	MusicBrainzURL string
+	HTTPCache      bool
+	// Timeout bounds the whole command, retries and waits included; 0 is
+	// no limit.
+	Timeout time.Duration
+	// PageSize is how many scrobbles backfill and sync ask for per page;
+	// above 200 they shrink it when the API balks.
+	PageSize int
+	// Raw is what backfill and sync archive verbatim: tracks, pages or both.
+	Raw   string
+	Fsync bool
+	// SummaryJSON makes sync print one JSON line and exit with a code
+	// that tells "nothing new" from "synced".
+	SummaryJSON bool
+	// DryRun makes the DryRunCommands report what they would change
+	// without writing the database or raw archives.
+	DryRun bool
+	// HealthcheckURL is pinged after every sync (url/fail on failure).
+	HealthcheckURL string
+	// Interval is how often install-service's timer runs sync.
+	Interval time.Duration
+	// Window is how far back reconcile re-fetches scrobbles.
+	Window time.Duration
+	// Timezone is the home time zone stats count days in; empty keeps the
+	// store's.
+	Timezone string
+	// MinSaneUTS is --min-sane-date as a UTC midnight: scrobbles dated
+	// before it are taken for Last.fm's placeholders. 0 keeps the store's.
+	MinSaneUTS int64
+	RecordHTTP string
+	ReplayHTTP string
+
+	Format  string
+	Pretty  bool
+	Out     string
+	Per     string
+	Algo    string
+	Unit    string
+	Country string
+	Limit   int
+	Days    int
+	Tag     string
+	Weights string
+
+	// Trajectory makes artist print plays per month as JSON.
+	Trajectory bool
+	// MinShare is the share of a period's plays analyze binges needs.
+	MinShare float64
+	// By is what top ranks by, and recommend seeds by (plays|affinity).
+	By string
+
+	// MaxPerArtist is -1 unless --max-per-artist was given.
+	MaxPerArtist int
+	Diversity    float64
+	Seed         string
+	NoRepeat     time.Duration
+	Offline      bool
+	Remote       bool
+
+	// Friends overrides the Last.fm friends recommend --algo friends mines
+	// and the friends command summarizes.
+	Friends []string
+	// Users are the database's users digest compares, or with Merged
+	// combines into one household digest.
+	Users  []string
+	Merged bool
+	// AlbumsAcrossArtists groups digest albums by title across artists.
+	AlbumsAcrossArtists bool
+	// Email mails the digest (LASTFM_SMTP_* settings) instead of printing
+	// it; for install-service, it adds a weekly timer that does.
+	Email bool
+	// NoCache makes digest rebuild instead of reusing its cached result.
+	NoCache bool
+	// MaxBytes caps the digest's JSON size, trimming sections in reverse
+	// of Priority (most important first); 0 is no cap.
+	MaxBytes int
+	Priority []string
+	// Encoding is how digest writes JSON: json, or columnar for lists as
+	// tables.
+	Encoding string
+	// Sections and Exclude pick the digest sections to build.
+	Sections []string
+	Exclude  []string
+	// SchemaVersion asks digest and recommend for an older JSON shape; 0 is
+	// the current one.
+	SchemaVersion int
+	// OtherUser is the Last.fm user compat compares me with.
+	OtherUser string
+
+	// Play describes a scrobble to add or selects scrobbles to edit.
+	Play PlayFlags
+	// Prune selects the scrobbles prune drops and names their archive.
+	Prune PruneFlags
 
-	Format string
-	Pretty bool
+	// Filter redacts periods/artists from export and digest output.
+	Filter store.Filter
+	// Location is --tz: the zone digest and report windows start in for
+	// this run; nil leaves it to the store's home time zone.
+	Location *time.Location
+
+	Notify notify.Config
+
+	// Args are the positional arguments; flags may come before or after them.
+	Args []string
+	// Flags names the flags given on the command line, without their values.
+	Flags []string
+}
+
+type PlayFlags struct {
+	Artist string
+	Track  string
+	Album  string
+	At     string
+	Count  int
+	Submit bool
+
+	// edit only
+	UTS       int64
+	Glob      bool
+	SetArtist string
+	SetTrack  string
+	SetAlbum  string
+}
+
+type PruneFlags struct {
+	// Before is --before as a UTC midnight, 0 if not given.
+	Before      int64
+	Source      string
+	ExportFirst string
 }
 
 type Requirements struct {
@@ -39,17 +181,153 @@ func FromFlags(args []string, req Requirements) (Config, error) {
 	fs.StringVar(&c.EnvFile, "env-file", os.Getenv("LASTFM_ENV_FILE"), "Load env vars from a file (KEY=VALUE lines)")
 	fs.StringVar(&c.APIKey, "api-key", os.Getenv("LASTFM_API_KEY"), "Last.fm API key (or set LASTFM_API_KEY)")
 	fs.StringVar(&c.SharedSecret, "shared-secret", os.Getenv("LASTFM_SHARED_SECRET"), "Last.fm shared secret (or set LASTFM_SHARED_SECRET)")
+	fs.StringVar(&c.SessionKey, "session-key", os.Getenv("LASTFM_SESSION_KEY"), "Last.fm session key for submitting scrobbles (or set LASTFM_SESSION_KEY; see the auth command)")
 	fs.StringVar(&c.Username, "user", os.Getenv("LASTFM_USERNAME"), "Last.fm username (or set LASTFM_USERNAME)")
 	fs.BoolVar(&c.Verbose, "verbose", false, "Verbose logging")
+	fs.BoolVar(&c.Quiet, "quiet", false, "No log lines; only errors go to stderr")
+	fs.BoolVar(&c.SummaryJSON, "summary-json", false, "Print one JSON summary line for sync and exit 0 synced, 3 nothing new, 1 failed")
+	fs.BoolVar(&c.DryRun, "dry-run", false, "Print what would change, write nothing ("+strings.Join(DryRunCommands, ", ")+")")
+	fs.StringVar(&c.Raw, "raw", "tracks", "What backfill/sync archive verbatim (tracks|pages|both)")
+	fs.BoolVar(&c.Fsync, "fsync", false, "Sync the raw archives to disk after every page, not just at exit")
+	fs.StringVar(&c.Timezone, "timezone", os.Getenv("LASTFM_TIMEZONE"), "Home time zone for daily and yearly stats, e.g. Europe/Amsterdam (or set LASTFM_TIMEZONE; default: as last used, else UTC)")
+	minSane := fs.String("min-sane-date", os.Getenv("LASTFM_MIN_SANE_DATE"), "Scrobbles dated before this day (YYYY-MM-DD, UTC) are placeholders, suspect and left out of stats (or set LASTFM_MIN_SANE_DATE; default: as last used, else 2000-01-01)")
+	fs.StringVar(&c.HealthcheckURL, "healthcheck-url", os.Getenv("LASTFM_HEALTHCHECK_URL"), "Ping this URL after each sync, url/fail if it failed (or set LASTFM_HEALTHCHECK_URL)")
+	c.Interval = time.Hour
+	fs.Var((*span)(&c.Interval), "interval", `How often install-service's timer syncs, e.g. "30m" or "6h" (default 1h)`)
+	c.Window = 30 * 24 * time.Hour
+	fs.Var((*span)(&c.Window), "window", `How far back reconcile checks scrobbles against Last.fm, e.g. "7d" or "8w" (default 30d)`)
+	fs.BoolVar(&c.HTTPCache, "http-cache", false, "Cache idempotent Last.fm GET responses under the data dir")
+	fs.StringVar(&c.RecordHTTP, "record-http", "", "Record Last.fm API traffic into this cassette directory")
+	fs.StringVar(&c.ReplayHTTP, "replay-http", "", "Answer Last.fm API calls from this cassette directory instead of the network")
 	fs.StringVar(&c.DataDir, "data-dir", "", "Data directory (default: XDG data dir)")
+	fs.StringVar(&c.APIBaseURL, "api-base-url", os.Getenv("LASTFM_API_BASE_URL"), "Last.fm-compatible API root (default https://ws.audioscrobbler.com/2.0/)")
+	fs.DurationVar(&c.RateLimit, "rate-limit", 200*time.Millisecond, "Minimum spacing between API requests")
+	fs.StringVar(&c.MusicBrainzURL, "musicbrainz-url", os.Getenv("LASTFM_MUSICBRAINZ_URL"), "MusicBrainz API root for enrich (default https://musicbrainz.org/ws/2/)")
+	fs.IntVar(&c.PageSize, "page-size", lastfm.DefaultRecentTracksLimit, "Scrobbles per page for backfill and sync, up to 1000 (fewer round trips; shrunk again on errors)")
+	fs.DurationVar(&c.Timeout, "timeout", 0, "Give up on the command after this long, e.g. 10m (default: no limit)")
 	fs.StringVar(&c.UserAgent, "user-agent", "lastfm-golang/0 (github.com/joshp123/lastfm-golang)", "HTTP User-Agent")
-	fs.StringVar(&c.Format, "format", "", "Output format for digest/recommend (json|tsv)")
+	fs.StringVar(&c.Format, "format", "", "Output format for digest/recommend/export (json|jsonl|tsv)")
 	fs.BoolVar(&c.Pretty, "pretty", false, "Pretty-print JSON output")
+	fs.StringVar(&c.Out, "out", "", "Output path for export (default: stdout)")
+	fs.StringVar(&c.Per, "per", "day", "One note per day or week for export --format obsidian, or binges per day or week for analyze binges (day|week)")
+	fs.StringVar(&c.Country, "country", "", "Country chart for charts, e.g. netherlands (default: global)")
+	fs.IntVar(&c.Limit, "limit", 50, "Entries to show for charts, explore-tag and discovered, or to check per chart for verify --remote")
+	fs.IntVar(&c.Days, "days", 14, "Local days for diary to cover, today included")
+	fs.Float64Var(&c.MinShare, "min-share", 0.5, "Share of a day's or week's plays, 0-1, one artist or album needs to count as a binge for analyze binges")
+	fs.StringVar(&c.By, "by", "", "Rank top, or pick recommend seeds, by plays or affinity (plays|affinity; default plays)")
+	fs.BoolVar(&c.Trajectory, "trajectory", false, "Print artist's plays per month since the first listen as a JSON array")
+	fs.BoolVar(&c.Remote, "remote", false, "Compare verify's local counts with Last.fm's top artists, tracks and albums")
+	fs.StringVar(&c.Algo, "algo", "", "Recommendation algorithm for recommend (artists|tracks|friends|tag|resurface)")
+	fs.StringVar(&c.Tag, "tag", "", "Tag to seed recommend from instead of your history (implies --algo tag)")
+	fs.StringVar(&c.Unit, "unit", "", "What recommend suggests (track|album), or what analyze binges (artist|album) or completion (track|album) counts")
+	fs.StringVar(&c.Weights, "weights", "", "Recommend score weights, e.g. similarity=0.6,tags=0.2,recency=0.1,novelty=0.1,obscurity=0.3")
+	fs.IntVar(&c.MaxPerArtist, "max-per-artist", -1, "Most recommended tracks per artist (0: no cap; default 3)")
+	fs.Float64Var(&c.Diversity, "diversity", 0, "Trade recommend score for variety, 0-1 (maximal marginal relevance over artist tags)")
+	fs.StringVar(&c.Seed, "seed", "", "Shuffle near-equal recommendations: a number (reproducible), day or random")
+	fs.Var((*span)(&c.NoRepeat), "no-repeat", `Leave out tracks recommended within this long, e.g. "30d" or "2w"`)
+	fs.BoolVar(&c.Offline, "offline", false, "Recommend from cached Last.fm responses only")
+	users := fs.String("users", "", "Comma-separated users in this database for digest to compare (or merge with --merged)")
+	fs.BoolVar(&c.Merged, "merged", false, "Digest --users as one household instead of comparing them")
+	fs.BoolVar(&c.AlbumsAcrossArtists, "albums-across-artists", false, "Group digest albums by title across artists, so compilations chart as Various Artists")
+	fs.BoolVar(&c.Email, "email", false, "Mail the digest as Markdown/HTML to LASTFM_NOTIFY_EMAIL_TO; with install-service, weekly")
+	fs.IntVar(&c.MaxBytes, "max-bytes", 0, "Trim digest sections until its JSON is at most this many bytes")
+	priority := fs.String("priority", "", "Digest sections most important first, kept longest by --max-bytes (e.g. recent,top)")
+	fs.StringVar(&c.Encoding, "encoding", "json", "Digest JSON encoding: json, or columnar (lists of objects as column names and rows)")
+	sections := fs.String("sections", "", "Build only these digest sections, e.g. recent,top,yearly")
+	exclude := fs.String("exclude", "", "Leave these digest sections out, e.g. resurface,seasonal")
+	fs.IntVar(&c.SchemaVersion, "schema-version", 0, "JSON shape version for digest and recommend to write (default: the current one)")
+	fs.BoolVar(&c.NoCache, "no-cache", false, "Rebuild the digest even if nothing changed since the cached one")
+	fs.StringVar(&c.OtherUser, "other-user", "", "Last.fm user for compat to compare your history with")
+	friends := fs.String("friends", os.Getenv("LASTFM_FRIENDS"), "Comma-separated users for recommend --algo friends and the friends command (default: your Last.fm friends)")
+	fs.StringVar(&c.Play.Artist, "artist", "", "Artist to add, or to match for edit, delete and undelete")
+	fs.StringVar(&c.Play.Track, "track", "", "Track to add, or to match for edit, delete and undelete")
+	fs.StringVar(&c.Play.Album, "album", "", "Album to add, or to match for edit, delete and undelete")
+	fs.StringVar(&c.Play.At, "at", "", `Local time the (first) play started for add, "YYYY-MM-DD HH:MM" (default: now)`)
+	fs.IntVar(&c.Play.Count, "count", 1, "Number of back-to-back plays for add")
+	fs.BoolVar(&c.Play.Submit, "submit", false, "Also submit added plays to Last.fm with track.scrobble")
+	fs.Int64Var(&c.Play.UTS, "uts", 0, "Match one scrobble by played_at_uts for edit, delete and undelete")
+	fs.BoolVar(&c.Play.Glob, "glob", false, "Treat edit's, delete's and undelete's --artist/--track/--album as globs (* and ?)")
+	fs.StringVar(&c.Play.SetArtist, "set-artist", "", "New artist for edit")
+	fs.StringVar(&c.Play.SetTrack, "set-track", "", "New track for edit")
+	fs.StringVar(&c.Play.SetAlbum, "set-album", "", "New album for edit")
+	pruneBefore := fs.String("before", "", "Prune scrobbles played before this UTC date (YYYY-MM-DD)")
+	fs.StringVar(&c.Prune.Source, "source", "", "Prune only scrobbles from this source (lastfm_api, manual, import_csv, ...)")
+	fs.StringVar(&c.Prune.ExportFirst, "export-first", "", "Archive what prune drops to this new JSONL file (gzipped if it ends in .gz) first")
+	redactAfter := fs.String("redact-after", "", "Exclude scrobbles on or after this UTC date (YYYY-MM-DD) from export/digest")
+	redactBefore := fs.String("redact-before", "", "Exclude scrobbles before this UTC date (YYYY-MM-DD) from export/digest")
+	var redactRanges, redactArtists stringList
+	fs.Var(&redactRanges, "redact-range", "Exclude a UTC date range FROM..TO (TO exclusive; repeatable)")
+	fs.Var(&redactArtists, "redact-artist", "Exclude an artist from export/digest (repeatable)")
+	versions := fs.String("versions", "", "Live recordings, remixes and demos: include, exclude or fold them into the studio track, for all (exclude) or per kind (live=exclude,remix=fold)")
+	tz := fs.String("tz", "", "Zone digest/report count today and their day windows in for this run, e.g. Europe/Amsterdam (default: --timezone)")
+	notifyKinds := fs.String("notify", os.Getenv("LASTFM_NOTIFY"), "Notifiers for sync/digest events (comma-separated: stderr,desktop,webhook,email,mqtt,discord,telegram)")
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			return Config{}, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		c.Args = append(c.Args, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	fs.Visit(func(f *flag.Flag) { c.Flags = append(c.Flags, f.Name) })
 
-	if err := fs.Parse(args); err != nil {
-		return Config{}, err
+	if *pruneBefore != "" {
+		before, err := parseDate(*pruneBefore)
+		if err != nil {
+			return Config{}, fmt.Errorf("--before: %w", err)
+		}
+		c.Prune.Before = before
+	}
+	if *redactAfter != "" {
+		from, err := parseDate(*redactAfter)
+		if err != nil {
+			return Config{}, fmt.Errorf("--redact-after: %w", err)
+		}
+		c.Filter.ExcludeRanges = append(c.Filter.ExcludeRanges, store.TimeRange{From: from})
 	}
+	if *redactBefore != "" {
+		to, err := parseDate(*redactBefore)
+		if err != nil {
+			return Config{}, fmt.Errorf("--redact-before: %w", err)
+		}
+		c.Filter.ExcludeRanges = append(c.Filter.ExcludeRanges, store.TimeRange{To: to})
+	}
+	for _, r := range redactRanges {
+		fromS, toS, ok := strings.Cut(r, "..")
+		if !ok {
+			return Config{}, fmt.Errorf("--redact-range: expected FROM..TO, got %q", r)
+		}
+		from, err := parseDate(fromS)
+		if err != nil {
+			return Config{}, fmt.Errorf("--redact-range: %w", err)
+		}
+		to, err := parseDate(toS)
+		if err != nil {
+			return Config{}, fmt.Errorf("--redact-range: %w", err)
+		}
+		if to <= from {
+			return Config{}, fmt.Errorf("--redact-range: empty range %q", r)
+		}
+		c.Filter.ExcludeRanges = append(c.Filter.ExcludeRanges, store.TimeRange{From: from, To: to})
+	}
+	c.Filter.ExcludeArtists = redactArtists
+	if err := parseVersions(*versions, &c.Filter); err != nil {
+		return Config{}, fmt.Errorf("--versions: %w", err)
+	}
+	if *tz != "" {
+		loc, err := time.LoadLocation(*tz)
+		if err != nil {
+			return Config{}, fmt.Errorf("--tz: %w", err)
+		}
+		c.Location = loc
+	}
+	// Aggregates skip the ignore list; export turns this off to dump everything.
+	c.Filter.HideIgnored = true
 
+	env := os.Getenv
 	if c.EnvFile != "" {
 		m, err := loadEnvFile(c.EnvFile)
 		if err != nil {
@@ -61,11 +339,77 @@ func FromFlags(args []string, req Requirements) (Config, error) {
 		if c.SharedSecret == "" {
 			c.SharedSecret = m["LASTFM_SHARED_SECRET"]
 		}
+		if c.SessionKey == "" {
+			c.SessionKey = m["LASTFM_SESSION_KEY"]
+		}
 		if c.Username == "" {
 			c.Username = m["LASTFM_USERNAME"]
 		}
+		if c.APIBaseURL == "" {
+			c.APIBaseURL = m["LASTFM_API_BASE_URL"]
+		}
+		if c.MusicBrainzURL == "" {
+			c.MusicBrainzURL = m["LASTFM_MUSICBRAINZ_URL"]
+		}
+		if *notifyKinds == "" {
+			*notifyKinds = m["LASTFM_NOTIFY"]
+		}
+		if *friends == "" {
+			*friends = m["LASTFM_FRIENDS"]
+		}
+		if c.Timezone == "" {
+			c.Timezone = m["LASTFM_TIMEZONE"]
+		}
+		if *minSane == "" {
+			*minSane = m["LASTFM_MIN_SANE_DATE"]
+		}
+		if c.HealthcheckURL == "" {
+			c.HealthcheckURL = m["LASTFM_HEALTHCHECK_URL"]
+		}
+		env = func(k string) string {
+			if v := os.Getenv(k); v != "" {
+				return v
+			}
+			return m[k]
+		}
 	}
+	c.Notify = notifyConfig(*notifyKinds, env)
+	c.Friends = splitList(*friends)
+	c.Users = splitList(*users)
+	c.Priority = splitList(*priority)
+	c.Sections = splitList(*sections)
+	c.Exclude = splitList(*exclude)
 
+	switch c.Raw {
+	case "tracks", "pages", "both":
+	default:
+		return Config{}, fmt.Errorf("--raw: expected tracks, pages or both, got %q", c.Raw)
+	}
+	if c.PageSize < 1 || c.PageSize > lastfm.MaxRecentTracksLimit {
+		return Config{}, fmt.Errorf("--page-size: expected 1 to %d, got %d", lastfm.MaxRecentTracksLimit, c.PageSize)
+	}
+	if c.Window <= 0 {
+		return Config{}, fmt.Errorf("--window: expected a positive span, got %s", c.Window)
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return Config{}, fmt.Errorf("--timezone: %w", err)
+		}
+	}
+	if *minSane != "" {
+		d, err := time.Parse("2006-01-02", *minSane)
+		if err != nil {
+			return Config{}, fmt.Errorf("--min-sane-date: expected YYYY-MM-DD, got %q", *minSane)
+		}
+		c.MinSaneUTS = d.Unix()
+	}
+	if c.RecordHTTP != "" && c.ReplayHTTP != "" {
+		return Config{}, errors.New("--record-http and --replay-http are mutually exclusive")
+	}
+	// A replayed cassette needs no real key.
+	if c.ReplayHTTP != "" && c.APIKey == "" {
+		c.APIKey = "replay"
+	}
 	if req.RequireAPIKey && c.APIKey == "" {
 		return Config{}, errors.New("missing api key: set LASTFM_API_KEY or pass --api-key (or use --env-file)")
 	}
@@ -84,6 +428,120 @@ func FromFlags(args []string, req Requirements) (Config, error) {
 	return c, nil
 }
 
+func notifyConfig(kinds string, env func(string) string) notify.Config {
+	return notify.Config{
+		Kinds:        splitList(kinds),
+		Events:       splitList(env("LASTFM_NOTIFY_EVENTS")),
+		WebhookURL:   env("LASTFM_NOTIFY_WEBHOOK_URL"),
+		SMTPAddr:     env("LASTFM_SMTP_ADDR"),
+		SMTPUsername: env("LASTFM_SMTP_USERNAME"),
+		SMTPPassword: env("LASTFM_SMTP_PASSWORD"),
+		EmailFrom:    env("LASTFM_NOTIFY_EMAIL_FROM"),
+		EmailTo:      splitList(env("LASTFM_NOTIFY_EMAIL_TO")),
+		MQTTBroker:   env("LASTFM_MQTT_BROKER"),
+		MQTTTopic:    env("LASTFM_MQTT_TOPIC"),
+		MQTTClientID: env("LASTFM_MQTT_CLIENT_ID"),
+		MQTTUsername: env("LASTFM_MQTT_USERNAME"),
+		MQTTPassword: env("LASTFM_MQTT_PASSWORD"),
+
+		DiscordWebhookURL: env("LASTFM_DISCORD_WEBHOOK_URL"),
+		TelegramToken:     env("LASTFM_TELEGRAM_BOT_TOKEN"),
+		TelegramChatID:    env("LASTFM_TELEGRAM_CHAT_ID"),
+	}
+}
+
+// parseVersions sets f's handling of live recordings, remixes and demos
+// from --versions: a mode (include, exclude or fold) for every kind, or
+// kind=mode pairs.
+func parseVersions(v string, f *store.Filter) error {
+	if v == "" {
+		return nil
+	}
+	modes := map[string]string{}
+	for _, part := range strings.Split(v, ",") {
+		kind, mode, ok := strings.Cut(strings.TrimSpace(part), "=")
+		kinds := []string{kind}
+		if !ok {
+			kinds, mode = store.VersionKinds, kind
+		} else if !slices.Contains(store.VersionKinds, kind) {
+			return fmt.Errorf("unknown kind %q (expected %s)", kind, strings.Join(store.VersionKinds, ", "))
+		}
+		for _, k := range kinds {
+			modes[k] = mode
+		}
+	}
+	for _, k := range store.VersionKinds {
+		switch modes[k] {
+		case "", "include":
+		case "exclude":
+			f.ExcludeVersions = append(f.ExcludeVersions, k)
+		case "fold":
+			f.FoldVersions = append(f.FoldVersions, k)
+		default:
+			return fmt.Errorf("unknown mode %q (expected include, exclude or fold)", modes[k])
+		}
+	}
+	return nil
+}
+
+// parseDate parses YYYY-MM-DD as UTC midnight in unix seconds.
+func parseDate(s string) (int64, error) {
+	t, err := time.Parse("2006-01-02", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid date %q (expected YYYY-MM-DD)", s)
+	}
+	return t.Unix(), nil
+}
+
+// span is a duration flag that also takes days ("30d") and weeks ("2w").
+type span time.Duration
+
+func (d *span) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *span) Set(v string) error {
+	v = strings.TrimSpace(v)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(v, suffix); ok {
+			f, err := strconv.ParseFloat(n, 64)
+			if err != nil || f < 0 {
+				return fmt.Errorf("invalid span %q", v)
+			}
+			*d = span(f * float64(unit))
+			return nil
+		}
+	}
+	t, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("invalid span %q (expected e.g. 30d, 2w or 12h)", v)
+	}
+	*d = span(t)
+	return nil
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 func loadEnvFile(path string) (map[string]string, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -0,0 +1,160 @@
+// Package jsonschema derives JSON Schema (draft 2020-12) documents from Go
+// types as encoding/json writes them, so schemas of the JSON outputs follow
+// the structs without being kept by hand.
+package jsonschema
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Draft is the $schema of the documents Generate returns.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is one JSON Schema node. The zero Schema accepts any value.
+// AdditionalProperties is false for structs and the value schema for maps.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Encoding             string             `json:"contentEncoding,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+var (
+	timeType      = reflect.TypeFor[time.Time]()
+	marshalerType = reflect.TypeFor[json.Marshaler]()
+)
+
+// Generate returns the schema of v's type, titled title. Named structs are
+// in $defs and referenced by name (package-qualified when two share one);
+// fields follow their json tags, and a field is required unless tagged
+// omitempty or omitzero. Types with their own MarshalJSON (other than
+// time.Time) and interfaces accept anything.
+func Generate(v any, title string) *Schema {
+	g := &generator{defs: map[string]*Schema{}, names: map[reflect.Type]string{}, taken: map[string]reflect.Type{}}
+	root := g.schema(reflect.TypeOf(v))
+	root.Schema = Draft
+	root.Title = title
+	if len(g.defs) > 0 {
+		root.Defs = g.defs
+	}
+	return root
+}
+
+type generator struct {
+	defs  map[string]*Schema
+	names map[reflect.Type]string
+	taken map[string]reflect.Type
+}
+
+func (g *generator) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType):
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return &Schema{Type: "string", Encoding: "base64"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return &Schema{Ref: "#/$defs/" + g.def(t)}
+	}
+	return &Schema{}
+}
+
+// def adds t's schema to $defs once and returns its name there.
+func (g *generator) def(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if other, ok := g.taken[name]; ok && other != t {
+		name = path.Base(t.PkgPath()) + "." + name
+	}
+	g.names[t] = name
+	g.taken[name] = t
+	// Registered before its fields, so a type can refer to itself.
+	g.defs[name] = nil
+	g.defs[name] = g.object(t)
+	return name
+}
+
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+	g.fields(s, t)
+	return s
+}
+
+// fields adds t's exported fields to s, those of untagged embedded structs
+// inline as encoding/json does.
+func (g *generator) fields(s *Schema, t reflect.Type) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.fields(s, ft)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.schema(f.Type)
+		if !hasOpt(opts, "omitempty") && !hasOpt(opts, "omitzero") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func hasOpt(opts, want string) bool {
+	for o := range strings.SplitSeq(opts, ",") {
+		if o == want {
+			return true
+		}
+	}
+	return false
+}
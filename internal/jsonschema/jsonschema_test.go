@@ -0,0 +1,60 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+type meta struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Note        string    `json:"note,omitempty"`
+}
+
+type entry struct {
+	Name  string  `json:"name"`
+	Score float64 `json:"score,omitzero"`
+	Next  *entry  `json:"next,omitempty"`
+}
+
+type output struct {
+	Meta    meta             `json:"meta"`
+	Entries []entry          `json:"entries"`
+	Counts  map[string]int64 `json:"counts"`
+	Extra   any              `json:"extra,omitempty"`
+	Skipped string           `json:"-"`
+	hidden  int
+	Plain   bool
+}
+
+func TestGenerate(t *testing.T) {
+	s := Generate(output{}, "out")
+	if s.Schema != Draft || s.Title != "out" || s.Ref != "#/$defs/output" {
+		t.Fatalf("root = %+v", s)
+	}
+	root := s.Defs["output"]
+	if want := []string{"meta", "entries", "counts", "Plain"}; !slices.Equal(root.Required, want) {
+		t.Fatalf("required = %v, want %v", root.Required, want)
+	}
+	if len(root.Properties) != 5 || root.AdditionalProperties != false {
+		t.Fatalf("output = %+v", root)
+	}
+	if e := root.Properties["entries"]; e.Type != "array" || e.Items.Ref != "#/$defs/entry" {
+		t.Fatalf("entries = %+v", e)
+	}
+	if c := root.Properties["counts"]; c.Type != "object" || c.AdditionalProperties.(*Schema).Type != "integer" {
+		t.Fatalf("counts = %+v", c)
+	}
+	if g := s.Defs["meta"].Properties["generated_at"]; g.Type != "string" || g.Format != "date-time" {
+		t.Fatalf("generated_at = %+v", g)
+	}
+	// A type refers to itself through $defs.
+	if n := s.Defs["entry"].Properties["next"]; n.Ref != "#/$defs/entry" {
+		t.Fatalf("next = %+v", n)
+	}
+	b, err := json.Marshal(root.Properties["extra"])
+	if err != nil || string(b) != "{}" {
+		t.Fatalf("extra = %s (%v), want {}", b, err)
+	}
+}
@@ -0,0 +1,521 @@
+// Package lastfmtest runs a fake Last.fm API server with canned fixtures for
+// tests. Point a client at Server.URL (lastfm.WithBaseURL or --api-base-url).
+package lastfmtest
+
+import (
+	"crypto/md5"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+//go:embed testdata/*.json
+var fixtures embed.FS
+
+// Shared credentials the server accepts for signed methods.
+const (
+	SharedSecret = "test-secret"
+	SessionKey   = "test-session"
+	AuthToken    = "test-token"
+)
+
+type Server struct {
+	// URL is the API root, e.g. http://127.0.0.1:1234/2.0/.
+	URL string
+
+	srv *httptest.Server
+
+	mu        sync.Mutex
+	recent    []lastfm.Track // newest first, like the API
+	similar   map[string]json.RawMessage
+	topTracks map[string]json.RawMessage
+	topAlbums map[string]json.RawMessage
+	info      map[string]json.RawMessage
+	charts    map[string]json.RawMessage // method, or method|country (geo.*) or method|tag (tag.*)
+	tags      map[string]json.RawMessage
+	simTracks map[string]json.RawMessage
+	durations map[string]time.Duration              // artist|track
+	loved     []lastfm.LovedTrack                   // newest first
+	users     map[string]map[string]json.RawMessage // user -> method result
+	calls     map[string]int
+	failing   map[string]bool // method|artist
+	submitted []lastfm.Scrobble
+	// Recent track page sizes: served at most limitCap, failing above
+	// failAbove (0: no limit).
+	limitCap  int
+	failAbove int
+}
+
+// NewServer starts a server loaded with the fixtures in testdata. The
+// fixture scrobbles are shifted so the newest one happened an hour ago,
+// keeping window-based queries ("last 90 days") meaningful.
+func NewServer() *Server {
+	s := &Server{calls: map[string]int{}, failing: map[string]bool{}, durations: map[string]time.Duration{}}
+	s.recent = loadRecentFixture()
+	must(loadFixture("testdata/similar.json", &s.similar))
+	must(loadFixture("testdata/toptracks.json", &s.topTracks))
+	must(loadFixture("testdata/topalbums.json", &s.topAlbums))
+	must(loadFixture("testdata/artistinfo.json", &s.info))
+	must(loadFixture("testdata/charts.json", &s.charts))
+	must(loadFixture("testdata/tags.json", &s.tags))
+	must(loadFixture("testdata/similartracks.json", &s.simTracks))
+	must(loadFixture("testdata/users.json", &s.users))
+
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.srv.URL + "/2.0/"
+	return s
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// SetRecentTracks replaces the user's scrobbles (newest first).
+func (s *Server) SetRecentTracks(tracks []lastfm.Track) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recent = append([]lastfm.Track(nil), tracks...)
+}
+
+// Scrobble records new listens as if they just happened, newest first.
+func (s *Server) Scrobble(tracks ...lastfm.Track) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recent = append(append([]lastfm.Track(nil), tracks...), s.recent...)
+}
+
+// Fail makes method calls for artist fail with Last.fm's "operation failed"
+// error (8), which isn't retried.
+func (s *Server) Fail(method, artist string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing[strings.ToLower(method+"|"+artist)] = true
+}
+
+// SetTrackDuration makes track.getInfo know artist's track, lasting d.
+// Other tracks aren't found.
+func (s *Server) SetTrackDuration(artist, track string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.durations[strings.ToLower(artist+"|"+track)] = d
+}
+
+// Love marks artist's track loved, just now.
+func (s *Server) Love(artist, track string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := lastfm.LovedTrack{Name: track, Date: &lastfm.Date{UTS: strconv.FormatInt(time.Now().Unix(), 10)}}
+	l.Artist.Name = artist
+	s.loved = append([]lastfm.LovedTrack{l}, s.loved...)
+}
+
+// CapLimit makes user.getRecentTracks pages hold at most n scrobbles,
+// whatever limit asks for, and report that as their perPage.
+func (s *Server) CapLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limitCap = n
+}
+
+// FailLimitAbove makes user.getRecentTracks pages of more than n scrobbles
+// fail with "operation failed" (8), as oversized pages can time out.
+func (s *Server) FailLimitAbove(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failAbove = n
+}
+
+// Calls returns how many requests were made for a method (case-insensitive).
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[strings.ToLower(method)]
+}
+
+// Submitted returns the scrobbles received through track.scrobble.
+func (s *Server) Submitted() []lastfm.Scrobble {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]lastfm.Scrobble(nil), s.submitted...)
+}
+
+// Tracks builds n dated scrobbles, newest first, one every 3 minutes ending
+// at newest; handy for exercising pagination.
+func Tracks(n int, artist string, newest time.Time) []lastfm.Track {
+	out := make([]lastfm.Track, 0, n)
+	for i := 0; i < n; i++ {
+		ts := newest.Add(-time.Duration(i) * 3 * time.Minute)
+		out = append(out, lastfm.Track{
+			Name:   fmt.Sprintf("Track %d", n-i),
+			Artist: lastfm.TextMBID{Text: artist},
+			Album:  lastfm.TextMBID{Text: artist + " LP"},
+			Date:   &lastfm.Date{UTS: strconv.FormatInt(ts.Unix(), 10), Text: ts.UTC().Format("02 Jan 2006, 15:04")},
+		})
+	}
+	return out
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	_ = r.ParseForm() // query string plus POST body
+	q := r.Form
+	method := strings.ToLower(q.Get("method"))
+
+	s.mu.Lock()
+	s.calls[method]++
+	failing := s.failing[strings.ToLower(method+"|"+q.Get("artist"))]
+	s.mu.Unlock()
+
+	if q.Get("api_key") == "" {
+		writeError(w, 10, "Invalid API key - You must be granted a valid key by last.fm")
+		return
+	}
+
+	if failing {
+		writeError(w, 8, "Operation failed - Most likely the backend service failed. Please try again.")
+		return
+	}
+
+	switch method {
+	case "user.getrecenttracks":
+		// Users with a recenttracks fixture (friends) get theirs; any
+		// other user is the one whose scrobbles the server keeps.
+		if _, ok := s.users[strings.ToLower(q.Get("user"))]["recenttracks"]; ok {
+			s.byUser(w, q, "recenttracks", "")
+			return
+		}
+		s.recentTracks(w, q)
+	case "artist.getsimilar":
+		s.byArtist(w, q, s.similar, `{"similarartists":{"artist":[]}}`)
+	case "artist.gettoptracks":
+		s.byArtist(w, q, s.topTracks, `{"toptracks":{"track":[]}}`)
+	case "artist.gettopalbums":
+		s.byArtist(w, q, s.topAlbums, `{"topalbums":{"album":[]}}`)
+	case "artist.getinfo":
+		s.byArtist(w, q, s.info, "")
+	case "artist.gettoptags":
+		s.byArtist(w, q, s.tags, `{"toptags":{"tag":[]}}`)
+	case "user.getfriends":
+		s.byUser(w, q, "friends", `{"friends":{"user":[]}}`)
+	case "user.gettopartists":
+		s.byUser(w, q, "topartists", `{"topartists":{"artist":[]}}`)
+	case "user.gettoptracks":
+		s.byUser(w, q, "toptracks", `{"toptracks":{"track":[]}}`)
+	case "user.gettopalbums":
+		s.byUser(w, q, "topalbums", `{"topalbums":{"album":[]}}`)
+	case "track.getsimilar":
+		s.byTrack(w, q, s.simTracks, `{"similartracks":{"track":[]}}`)
+	case "track.getinfo":
+		s.trackInfo(w, q)
+	case "user.getlovedtracks":
+		s.lovedTracks(w)
+	case "auth.gettoken", "auth.getsession", "track.scrobble":
+		s.signed(w, r, q, method)
+	case "chart.gettopartists", "chart.gettoptracks":
+		s.chart(w, method)
+	case "geo.gettopartists", "geo.gettoptracks":
+		if q.Get("country") == "" {
+			writeError(w, 6, "Invalid parameters - country is required")
+			return
+		}
+		s.chart(w, method+"|"+strings.ToLower(q.Get("country")))
+	case "tag.gettopartists":
+		s.tagChart(w, method+"|"+strings.ToLower(q.Get("tag")), `{"topartists":{"artist":[]}}`)
+	case "tag.gettoptracks":
+		s.tagChart(w, method+"|"+strings.ToLower(q.Get("tag")), `{"tracks":{"track":[]}}`)
+	default:
+		writeError(w, 3, "Invalid Method - No method with that name in this package")
+	}
+}
+
+// signed serves methods that need a valid api_sig (and, for writes, a
+// session key and POST).
+func (s *Server) signed(w http.ResponseWriter, r *http.Request, q url.Values, method string) {
+	if q.Get("api_sig") != sign(q, SharedSecret) {
+		writeError(w, 13, "Invalid method signature supplied")
+		return
+	}
+	switch method {
+	case "auth.gettoken":
+		writeJSON(w, map[string]string{"token": AuthToken})
+	case "auth.getsession":
+		if q.Get("token") != AuthToken {
+			writeError(w, 4, "Invalid authentication token supplied")
+			return
+		}
+		writeJSON(w, map[string]any{"session": map[string]any{"name": "testuser", "key": SessionKey, "subscriber": 0}})
+	case "track.scrobble":
+		if r.Method != http.MethodPost {
+			writeError(w, 3, "Invalid Method - track.scrobble requires POST")
+			return
+		}
+		if q.Get("sk") != SessionKey {
+			writeError(w, 9, "Invalid session key - Please re-authenticate")
+			return
+		}
+		accepted := 0
+		s.mu.Lock()
+		for i := 0; q.Get(fmt.Sprintf("artist[%d]", i)) != ""; i++ {
+			n := fmt.Sprintf("[%d]", i)
+			ts, _ := strconv.ParseInt(q.Get("timestamp"+n), 10, 64)
+			s.submitted = append(s.submitted, lastfm.Scrobble{
+				Artist: q.Get("artist" + n), Track: q.Get("track" + n), Album: q.Get("album" + n), Timestamp: time.Unix(ts, 0),
+			})
+			accepted++
+		}
+		s.mu.Unlock()
+		writeJSON(w, map[string]any{"scrobbles": map[string]any{"@attr": map[string]int{"accepted": accepted, "ignored": 0}}})
+	}
+}
+
+// sign mirrors Last.fm's api_sig: md5 of sorted name+value pairs (minus
+// format, callback and api_sig) followed by the secret.
+func sign(q url.Values, secret string) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		if k != "format" && k != "callback" && k != "api_sig" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + q.Get(k))
+	}
+	sum := md5.Sum([]byte(b.String() + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Server) recentTracks(w http.ResponseWriter, q url.Values) {
+	if q.Get("user") == "" {
+		writeError(w, 6, "Invalid parameters - user is required")
+		return
+	}
+	limit := atoiDefault(q.Get("limit"), 50)
+	page := atoiDefault(q.Get("page"), 1)
+
+	s.mu.Lock()
+	if s.failAbove > 0 && limit > s.failAbove {
+		s.mu.Unlock()
+		writeError(w, 8, "Operation failed - Most likely the backend service failed. Please try again.")
+		return
+	}
+	if s.limitCap > 0 {
+		limit = min(limit, s.limitCap)
+	}
+	// to keeps scrobbles played before it, from those played at or after
+	// it; either leaves out now playing.
+	from, _ := strconv.ParseInt(q.Get("from"), 10, 64)
+	to, _ := strconv.ParseInt(q.Get("to"), 10, 64)
+	var nowPlaying []lastfm.Track
+	var dated []lastfm.Track
+	for _, t := range s.recent {
+		switch {
+		case t.Date == nil:
+			if to == 0 && from == 0 {
+				nowPlaying = append(nowPlaying, t)
+			}
+		case (to == 0 || atoi64(t.Date.UTS) < to) && atoi64(t.Date.UTS) >= from:
+			dated = append(dated, t)
+		}
+	}
+	s.mu.Unlock()
+	// Newest first, as Last.fm orders them, however they were added.
+	sort.SliceStable(dated, func(i, j int) bool { return atoi64(dated[i].Date.UTS) > atoi64(dated[j].Date.UTS) })
+
+	total := len(dated)
+	totalPages := (total + limit - 1) / limit
+	var tracks []lastfm.Track
+	if page == 1 {
+		tracks = append(tracks, nowPlaying...)
+	}
+	if start := (page - 1) * limit; start < total {
+		tracks = append(tracks, dated[start:min(start+limit, total)]...)
+	}
+
+	var r lastfm.RecentTracksResponse
+	r.RecentTracks.Track = tracks
+	r.RecentTracks.Attr.Page = strconv.Itoa(page)
+	r.RecentTracks.Attr.PerPage = strconv.Itoa(limit)
+	r.RecentTracks.Attr.TotalPages = strconv.Itoa(totalPages)
+	r.RecentTracks.Attr.Total = strconv.Itoa(total)
+	writeJSON(w, r)
+}
+
+// byArtist serves fixtures keyed by artist, lowercased; an unknown artist
+// gets empty, or error 6 when empty is "".
+func (s *Server) byArtist(w http.ResponseWriter, q url.Values, m map[string]json.RawMessage, empty string) {
+	artist := q.Get("artist")
+	if artist == "" {
+		writeError(w, 6, "Invalid parameters - artist is required")
+		return
+	}
+	body, ok := m[strings.ToLower(artist)]
+	if !ok && empty == "" {
+		writeError(w, 6, "The artist you supplied could not be found")
+		return
+	}
+	if !ok {
+		body = json.RawMessage(empty)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// byUser serves the field of a user's fixture, e.g. "friends"; a
+// "field|period" entry, e.g. "topartists|12month", wins for that period.
+func (s *Server) byUser(w http.ResponseWriter, q url.Values, field, empty string) {
+	user := q.Get("user")
+	if user == "" {
+		writeError(w, 6, "Invalid parameters - user is required")
+		return
+	}
+	fields := s.users[strings.ToLower(user)]
+	body, ok := fields[field+"|"+q.Get("period")]
+	if !ok {
+		body, ok = fields[field]
+	}
+	if !ok {
+		writeJSON(w, json.RawMessage(empty))
+		return
+	}
+	writeJSON(w, map[string]json.RawMessage{field: body})
+}
+
+// byTrack serves fixtures keyed by "artist|track", lowercased.
+func (s *Server) trackInfo(w http.ResponseWriter, q url.Values) {
+	artist, track := q.Get("artist"), q.Get("track")
+	s.mu.Lock()
+	d, ok := s.durations[strings.ToLower(artist+"|"+track)]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, 6, "Track not found")
+		return
+	}
+	body, _ := json.Marshal(map[string]any{"track": map[string]any{
+		"name":     track,
+		"duration": strconv.FormatInt(d.Milliseconds(), 10),
+		"artist":   map[string]string{"name": artist},
+	}})
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// lovedTracks serves every loved track on one page.
+func (s *Server) lovedTracks(w http.ResponseWriter) {
+	s.mu.Lock()
+	var r lastfm.LovedTracksResponse
+	r.LovedTracks.Track = append(lastfm.List[lastfm.LovedTrack]{}, s.loved...)
+	s.mu.Unlock()
+	r.LovedTracks.Attr = lastfm.PageAttr{Page: "1", PerPage: "1000", TotalPages: "1", Total: strconv.Itoa(len(r.LovedTracks.Track))}
+	body, _ := json.Marshal(r)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+func (s *Server) byTrack(w http.ResponseWriter, q url.Values, m map[string]json.RawMessage, empty string) {
+	artist, track := q.Get("artist"), q.Get("track")
+	if artist == "" || track == "" {
+		writeError(w, 6, "Invalid parameters - artist and track are required")
+		return
+	}
+	body, ok := m[strings.ToLower(artist+"|"+track)]
+	if !ok {
+		body = json.RawMessage(empty)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// chart serves a chart fixture; Last.fm answers an unknown country with
+// error 6.
+func (s *Server) chart(w http.ResponseWriter, key string) {
+	body, ok := s.charts[key]
+	if !ok {
+		writeError(w, 6, "country param invalid")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// tagChart serves a tag chart fixture; Last.fm answers an unknown tag with
+// an empty chart.
+func (s *Server) tagChart(w http.ResponseWriter, key, empty string) {
+	body, ok := s.charts[key]
+	if !ok {
+		body = json.RawMessage(empty)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, map[string]any{"error": code, "message": msg})
+}
+
+func loadRecentFixture() []lastfm.Track {
+	var r lastfm.RecentTracksResponse
+	must(loadFixture("testdata/recenttracks.json", &r))
+	tracks := r.RecentTracks.Track
+
+	var newest int64
+	for _, t := range tracks {
+		if t.Date != nil {
+			uts, _ := strconv.ParseInt(t.Date.UTS, 10, 64)
+			newest = max(newest, uts)
+		}
+	}
+	shift := time.Now().Add(-time.Hour).Unix() - newest
+	for i, t := range tracks {
+		if t.Date == nil {
+			continue
+		}
+		uts, _ := strconv.ParseInt(t.Date.UTS, 10, 64)
+		d := *t.Date
+		d.UTS = strconv.FormatInt(uts+shift, 10)
+		tracks[i].Date = &d
+	}
+	return tracks
+}
+
+func loadFixture(name string, v any) error {
+	b, err := fixtures.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func atoiDefault(s string, def int) int {
+	if v, err := strconv.Atoi(s); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+func atoi64(s string) int64 {
+	v, _ := strconv.ParseInt(s, 10, 64)
+	return v
+}
+
+func must(err error) {
+	if err != nil {
+		panic("lastfmtest: " + err.Error())
+	}
+}
@@ -0,0 +1,82 @@
+package logx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IsTerminal reports whether w is an interactive terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Progress keeps a single status line at the bottom of a terminal. Use it as
+// a Logger's Out so log lines print above the status line instead of
+// through it.
+type Progress struct {
+	mu   sync.Mutex
+	out  io.Writer
+	line string
+}
+
+func NewProgress(out io.Writer) *Progress {
+	return &Progress{out: out}
+}
+
+func (p *Progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprint(p.out, "\r\x1b[K")
+	n, err := p.out.Write(b)
+	if p.line != "" {
+		fmt.Fprint(p.out, p.line)
+	}
+	return n, err
+}
+
+// Update replaces the status line.
+func (p *Progress) Update(format string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.line = fmt.Sprintf(format, args...)
+	fmt.Fprint(p.out, "\r\x1b[K"+p.line)
+}
+
+// Done clears the status line.
+func (p *Progress) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.line != "" {
+		fmt.Fprint(p.out, "\r\x1b[K")
+		p.line = ""
+	}
+}
+
+// Bar renders a fixed-width progress bar for done out of total.
+func Bar(done, total, width int) string {
+	filled := 0
+	if total > 0 {
+		filled = min(width, done*width/total)
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "]"
+}
+
+// ETA estimates the time left from the rate so far; 0 if unknown.
+func ETA(done, total int, elapsed time.Duration) time.Duration {
+	if done <= 0 || total <= done {
+		return 0
+	}
+	return (elapsed / time.Duration(done) * time.Duration(total-done)).Round(time.Second)
+}
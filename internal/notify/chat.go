@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Discord posts the event to a channel through an incoming webhook.
+type Discord struct {
+	WebhookURL string
+	HTTP       *http.Client
+}
+
+func (d Discord) Notify(ctx context.Context, e Event) error {
+	b, err := json.Marshal(map[string]string{"content": "**" + e.Title + "**\n" + e.Message})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, d.HTTP, d.WebhookURL, b)
+}
+
+// telegramAPI is the Telegram Bot API root.
+const telegramAPI = "https://api.telegram.org"
+
+// Telegram sends the event to a chat as a bot (sendMessage).
+type Telegram struct {
+	Token  string
+	ChatID string
+	// APIBase overrides telegramAPI, e.g. for a local Bot API server.
+	APIBase string
+	HTTP    *http.Client
+}
+
+func (t Telegram) Notify(ctx context.Context, e Event) error {
+	b, err := json.Marshal(map[string]string{"chat_id": t.ChatID, "text": e.Title + "\n" + e.Message})
+	if err != nil {
+		return err
+	}
+	base := t.APIBase
+	if base == "" {
+		base = telegramAPI
+	}
+	err = postJSON(ctx, t.HTTP, strings.TrimSuffix(base, "/")+"/bot"+t.Token+"/sendMessage", b)
+	// The token is part of the URL; keep it out of logs.
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		ue.URL = strings.ReplaceAll(ue.URL, t.Token, "<token>")
+	}
+	return err
+}
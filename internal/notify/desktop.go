@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// Desktop shows a native notification via notify-send (Linux/BSD) or
+// osascript (macOS).
+type Desktop struct{}
+
+func (Desktop) Notify(ctx context.Context, e Event) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(e.Message), strconv.Quote(e.Title))
+		cmd = exec.CommandContext(ctx, "osascript", "-e", script)
+	default:
+		cmd = exec.CommandContext(ctx, "notify-send", "--app-name=lastfm-golang", e.Title, e.Message)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("desktop notification: %w: %s", err, out)
+	}
+	return nil
+}
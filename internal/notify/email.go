@@ -0,0 +1,73 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Email sends a plain-text mail through an SMTP relay (STARTTLS when offered).
+type Email struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func (m Email) Notify(_ context.Context, e Event) error {
+	return m.Send("lastfm-golang: "+e.Title, e.Message)
+}
+
+func (m Email) Send(subject, body string) error {
+	var msg strings.Builder
+	m.header(&msg, subject)
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(crlf(body))
+	return m.send(msg.String())
+}
+
+// SendHTML sends a mail with an HTML body and a plain-text alternative for
+// clients that don't render HTML.
+func (m Email) SendHTML(subject, text, html string) error {
+	const boundary = "lastfm-golang-alternative"
+	var msg strings.Builder
+	m.header(&msg, subject)
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&msg, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", boundary, crlf(text))
+	fmt.Fprintf(&msg, "--%s\r\nContent-Type: text/html; charset=utf-8\r\n\r\n%s\r\n", boundary, crlf(html))
+	fmt.Fprintf(&msg, "--%s--\r\n", boundary)
+	return m.send(msg.String())
+}
+
+func (m Email) header(msg *strings.Builder, subject string) {
+	fmt.Fprintf(msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+}
+
+func (m Email) send(msg string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return fmt.Errorf("smtp addr: %w", err)
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	if err := smtp.SendMail(m.Addr, auth, m.From, m.To, []byte(msg)); err != nil {
+		return fmt.Errorf("send email: %w", err)
+	}
+	return nil
+}
+
+// crlf gives body the line endings SMTP expects.
+func crlf(body string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n")
+}
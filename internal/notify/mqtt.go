@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// MQTT publishes the event as JSON (QoS 0) using a minimal MQTT 3.1.1
+// connect/publish/disconnect exchange; enough for home-automation brokers.
+type MQTT struct {
+	Broker   string // host:port
+	Topic    string
+	ClientID string
+	Username string
+	Password string
+}
+
+func (m MQTT) Notify(ctx context.Context, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	d := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := d.DialContext(ctx, "tcp", m.Broker)
+	if err != nil {
+		return fmt.Errorf("mqtt dial: %w", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(15 * time.Second))
+
+	clientID := m.ClientID
+	if clientID == "" {
+		clientID = "lastfm-golang"
+	}
+
+	// CONNECT: protocol "MQTT" level 4, clean session, 60s keepalive.
+	var vh bytes.Buffer
+	writeMQTTString(&vh, "MQTT")
+	flags := byte(0x02)
+	if m.Username != "" {
+		flags |= 0x80
+	}
+	if m.Password != "" {
+		flags |= 0x40
+	}
+	vh.Write([]byte{0x04, flags, 0x00, 0x3c})
+	writeMQTTString(&vh, clientID)
+	if m.Username != "" {
+		writeMQTTString(&vh, m.Username)
+	}
+	if m.Password != "" {
+		writeMQTTString(&vh, m.Password)
+	}
+	if err := writeMQTTPacket(conn, 0x10, vh.Bytes()); err != nil {
+		return fmt.Errorf("mqtt connect: %w", err)
+	}
+
+	ack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, ack); err != nil {
+		return fmt.Errorf("mqtt connack: %w", err)
+	}
+	if ack[0] != 0x20 {
+		return errors.New("mqtt connack: unexpected packet")
+	}
+	if ack[3] != 0 {
+		return fmt.Errorf("mqtt connect refused: code %d", ack[3])
+	}
+
+	var pub bytes.Buffer
+	writeMQTTString(&pub, m.Topic)
+	pub.Write(payload)
+	if err := writeMQTTPacket(conn, 0x30, pub.Bytes()); err != nil {
+		return fmt.Errorf("mqtt publish: %w", err)
+	}
+	return writeMQTTPacket(conn, 0xe0, nil)
+}
+
+func writeMQTTString(b *bytes.Buffer, s string) {
+	b.WriteByte(byte(len(s) >> 8))
+	b.WriteByte(byte(len(s)))
+	b.WriteString(s)
+}
+
+func writeMQTTPacket(w io.Writer, header byte, body []byte) error {
+	pkt := []byte{header}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		pkt = append(pkt, digit)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(pkt, body...))
+	return err
+}
@@ -0,0 +1,170 @@
+// Package notify delivers event notifications (sync failures, milestones,
+// digests) through pluggable transports.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	EventSyncFailed  = "sync_failed"
+	EventMilestone   = "milestone"
+	EventDigestReady = "digest_ready"
+	// EventNewArtists lists artists a sync brought in for the first time.
+	EventNewArtists = "new_artists"
+	// EventDailyTop is yesterday's most played track, after the day's
+	// first sync.
+	EventDailyTop = "daily_top_track"
+)
+
+type Event struct {
+	Kind    string         `json:"kind"`
+	Title   string         `json:"title"`
+	Message string         `json:"message"`
+	Time    time.Time      `json:"time"`
+	Data    map[string]any `json:"data,omitempty"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// Multi fans an event out to every notifier and joins their errors.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, e Event) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Config selects and configures transports. Kinds lists the enabled
+// transports by name: stderr, desktop, webhook, email, mqtt, discord,
+// telegram ("stdout" is an old name for stderr). Events, if set, limits
+// which event kinds are delivered.
+type Config struct {
+	Kinds  []string
+	Events []string
+
+	WebhookURL string
+
+	DiscordWebhookURL string
+	TelegramToken     string
+	TelegramChatID    string
+
+	SMTPAddr     string // host:port
+	SMTPUsername string
+	SMTPPassword string
+	EmailFrom    string
+	EmailTo      []string
+
+	MQTTBroker   string // host:port
+	MQTTTopic    string
+	MQTTClientID string
+	MQTTUsername string
+	MQTTPassword string
+}
+
+// New builds a notifier for cfg. It returns nil when no transport is enabled.
+func New(cfg Config) (Notifier, error) {
+	var m Multi
+	for _, k := range cfg.Kinds {
+		switch strings.TrimSpace(k) {
+		case "":
+			continue
+		case "stderr", "stdout":
+			// Not stdout: it carries digest JSON and sync --summary-json.
+			// "stdout" is deprecated, kept so older configs still work.
+			m = append(m, Writer{W: os.Stderr})
+		case "desktop":
+			m = append(m, Desktop{})
+		case "webhook":
+			if cfg.WebhookURL == "" {
+				return nil, errors.New("notify webhook: missing url (set LASTFM_NOTIFY_WEBHOOK_URL)")
+			}
+			m = append(m, Webhook{URL: cfg.WebhookURL})
+		case "email":
+			e, err := NewEmail(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("notify %w", err)
+			}
+			m = append(m, e)
+		case "mqtt":
+			if cfg.MQTTBroker == "" || cfg.MQTTTopic == "" {
+				return nil, errors.New("notify mqtt: missing broker or topic (set LASTFM_MQTT_BROKER, LASTFM_MQTT_TOPIC)")
+			}
+			m = append(m, MQTT{Broker: cfg.MQTTBroker, Topic: cfg.MQTTTopic, ClientID: cfg.MQTTClientID, Username: cfg.MQTTUsername, Password: cfg.MQTTPassword})
+		case "discord":
+			if cfg.DiscordWebhookURL == "" {
+				return nil, errors.New("notify discord: missing webhook url (set LASTFM_DISCORD_WEBHOOK_URL)")
+			}
+			m = append(m, Discord{WebhookURL: cfg.DiscordWebhookURL})
+		case "telegram":
+			if cfg.TelegramToken == "" || cfg.TelegramChatID == "" {
+				return nil, errors.New("notify telegram: missing bot token or chat id (set LASTFM_TELEGRAM_BOT_TOKEN, LASTFM_TELEGRAM_CHAT_ID)")
+			}
+			m = append(m, Telegram{Token: cfg.TelegramToken, ChatID: cfg.TelegramChatID})
+		default:
+			return nil, fmt.Errorf("unknown notifier: %q (expected stderr|desktop|webhook|email|mqtt|discord|telegram)", k)
+		}
+	}
+	if len(m) == 0 {
+		return nil, nil
+	}
+	if len(cfg.Events) > 0 {
+		only := Only{Kinds: map[string]bool{}, Next: m}
+		for _, k := range cfg.Events {
+			switch k = strings.TrimSpace(k); k {
+			case EventSyncFailed, EventMilestone, EventDigestReady, EventNewArtists, EventDailyTop:
+				only.Kinds[k] = true
+			default:
+				return nil, fmt.Errorf("unknown notify event: %q (expected %s|%s|%s|%s|%s)", k, EventSyncFailed, EventMilestone, EventDigestReady, EventNewArtists, EventDailyTop)
+			}
+		}
+		return only, nil
+	}
+	return m, nil
+}
+
+// Only passes on the events of the listed kinds and drops the rest.
+type Only struct {
+	Kinds map[string]bool
+	Next  Notifier
+}
+
+func (o Only) Notify(ctx context.Context, e Event) error {
+	if !o.Kinds[e.Kind] {
+		return nil
+	}
+	return o.Next.Notify(ctx, e)
+}
+
+// NewEmail builds the email transport from cfg's SMTP settings, e.g. to
+// mail a digest directly.
+func NewEmail(cfg Config) (Email, error) {
+	if cfg.SMTPAddr == "" || cfg.EmailFrom == "" || len(cfg.EmailTo) == 0 {
+		return Email{}, errors.New("email: missing smtp address, from or to (set LASTFM_SMTP_ADDR, LASTFM_NOTIFY_EMAIL_FROM, LASTFM_NOTIFY_EMAIL_TO)")
+	}
+	return Email{Addr: cfg.SMTPAddr, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword, From: cfg.EmailFrom, To: cfg.EmailTo}, nil
+}
+
+// Writer prints one line per event; stderr in the CLI (the "stderr"
+// transport), so it never mixes into a command's output.
+type Writer struct {
+	W io.Writer
+}
+
+func (w Writer) Notify(_ context.Context, e Event) error {
+	_, err := fmt.Fprintf(w.W, "%s: %s: %s\n", e.Kind, e.Title, e.Message)
+	return err
+}
@@ -0,0 +1,241 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		cfg  Config
+		want string // error substring; "" for none
+	}{
+		{"none", Config{}, ""},
+		{"blank kinds", Config{Kinds: []string{"", " "}}, ""},
+		{"stderr", Config{Kinds: []string{"stderr"}}, ""},
+		{"stdout", Config{Kinds: []string{"stdout"}}, ""},
+		{"unknown kind", Config{Kinds: []string{"pager"}}, `unknown notifier: "pager"`},
+		{"unknown event", Config{Kinds: []string{"stderr"}, Events: []string{"milestone", "lunch"}}, `unknown notify event: "lunch"`},
+		{"webhook without url", Config{Kinds: []string{"webhook"}}, "notify webhook: missing url"},
+		{"email without smtp", Config{Kinds: []string{"email"}, EmailFrom: "me@example.com"}, "notify email: missing smtp address"},
+		{"mqtt without topic", Config{Kinds: []string{"mqtt"}, MQTTBroker: "localhost:1883"}, "notify mqtt: missing broker or topic"},
+		{"discord without url", Config{Kinds: []string{"discord"}}, "notify discord: missing webhook url"},
+		{"telegram without chat", Config{Kinds: []string{"telegram"}, TelegramToken: "t"}, "notify telegram: missing bot token or chat id"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			n, err := New(c.cfg)
+			if c.want == "" {
+				if err != nil {
+					t.Fatalf("New: %v", err)
+				}
+				if (n == nil) != (c.name == "none" || c.name == "blank kinds") {
+					t.Fatalf("New = %v", n)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("New error = %v, want %q", err, c.want)
+			}
+		})
+	}
+}
+
+// recorder keeps the kinds of the events it is given, failing with err.
+type recorder struct {
+	kinds []string
+	err   error
+}
+
+func (r *recorder) Notify(_ context.Context, e Event) error {
+	r.kinds = append(r.kinds, e.Kind)
+	return r.err
+}
+
+func TestOnly(t *testing.T) {
+	r := &recorder{}
+	o := Only{Kinds: map[string]bool{EventMilestone: true, EventDailyTop: true}, Next: r}
+	for _, k := range []string{EventSyncFailed, EventMilestone, EventDigestReady, EventDailyTop} {
+		if err := o.Notify(context.Background(), Event{Kind: k}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(r.kinds, ","); got != "milestone,daily_top_track" {
+		t.Errorf("passed on %s", got)
+	}
+}
+
+func TestMultiJoinsErrors(t *testing.T) {
+	errA, errB := errors.New("a down"), errors.New("b down")
+	a, ok, b := &recorder{err: errA}, &recorder{}, &recorder{err: errB}
+	err := Multi{a, ok, b}.Notify(context.Background(), Event{Kind: EventMilestone})
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Fatalf("error = %v, want both", err)
+	}
+	// A failing notifier doesn't stop the ones after it.
+	if len(a.kinds) != 1 || len(ok.kinds) != 1 || len(b.kinds) != 1 {
+		t.Errorf("delivered %v %v %v", a.kinds, ok.kinds, b.kinds)
+	}
+	if err := (Multi{ok}).Notify(context.Background(), Event{}); err != nil {
+		t.Errorf("no failures: %v", err)
+	}
+}
+
+var testEvent = Event{
+	Kind:    EventMilestone,
+	Title:   "10000 scrobbles",
+	Message: "You passed 10000 scrobbles",
+	Time:    time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	Data:    map[string]any{"count": float64(10000)},
+}
+
+// checkEvent decodes body as an Event and compares it with testEvent.
+func checkEvent(t *testing.T, body []byte) {
+	t.Helper()
+	var got Event
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("payload %q: %v", body, err)
+	}
+	if got.Kind != testEvent.Kind || got.Title != testEvent.Title || got.Message != testEvent.Message ||
+		!got.Time.Equal(testEvent.Time) || got.Data["count"] != testEvent.Data["count"] {
+		t.Errorf("payload = %+v, want %+v", got, testEvent)
+	}
+}
+
+func TestWebhookPostsEvent(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("%s with Content-Type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		b, _ := io.ReadAll(r.Body)
+		bodies <- b
+	}))
+	defer srv.Close()
+
+	if err := (Webhook{URL: srv.URL}).Notify(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+	checkEvent(t, <-bodies)
+
+	fail := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadGateway)
+	}))
+	defer fail.Close()
+	if err := (Webhook{URL: fail.URL}).Notify(context.Background(), testEvent); err == nil || !strings.Contains(err.Error(), "webhook http 502") {
+		t.Errorf("error = %v, want webhook http 502", err)
+	}
+}
+
+// readMQTTPacket reads one packet: its header byte and body.
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mult := 0, 1
+	for {
+		d, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(d&0x7f) * mult
+		if d&0x80 == 0 {
+			break
+		}
+		mult *= 128
+	}
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return header, body, err
+}
+
+// mqttString splits a length-prefixed string off b.
+func mqttString(b []byte) (string, []byte) {
+	n := int(b[0])<<8 | int(b[1])
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+func TestMQTTPublishesEvent(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	type publish struct {
+		user, pass, topic string
+		payload           []byte
+		err               error
+	}
+	got := make(chan publish, 1)
+	go func() {
+		var p publish
+		defer func() { got <- p }()
+		conn, err := ln.Accept()
+		if err != nil {
+			p.err = err
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+
+		header, body, err := readMQTTPacket(r)
+		if err != nil || header != 0x10 {
+			p.err = errors.New("no CONNECT")
+			return
+		}
+		proto, rest := mqttString(body)
+		flags := rest[1]
+		if proto != "MQTT" || rest[0] != 4 || flags&0xc0 != 0xc0 {
+			p.err = errors.New("bad CONNECT header")
+			return
+		}
+		_, rest = mqttString(rest[4:]) // client id
+		p.user, rest = mqttString(rest)
+		p.pass, _ = mqttString(rest)
+		conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+
+		header, body, err = readMQTTPacket(r)
+		if err != nil || header != 0x30 {
+			p.err = errors.New("no PUBLISH")
+			return
+		}
+		p.topic, p.payload = mqttString(body)
+		if header, _, err = readMQTTPacket(r); err != nil || header != 0xe0 {
+			p.err = errors.New("no DISCONNECT")
+		}
+	}()
+
+	m := MQTT{Broker: ln.Addr().String(), Topic: "home/lastfm", Username: "u", Password: "p"}
+	if err := m.Notify(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+	p := <-got
+	if p.err != nil {
+		t.Fatal(p.err)
+	}
+	if p.user != "u" || p.pass != "p" || p.topic != "home/lastfm" {
+		t.Errorf("user %q, password %q, topic %q", p.user, p.pass, p.topic)
+	}
+	checkEvent(t, p.payload)
+}
+
+func TestWriterLine(t *testing.T) {
+	var b strings.Builder
+	if err := (Writer{W: &b}).Notify(context.Background(), testEvent); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != "milestone: 10000 scrobbles: You passed 10000 scrobbles\n" {
+		t.Errorf("line = %q", got)
+	}
+}
@@ -19,3 +19,17 @@ func DataHome() (string, error) {
 	}
 	return filepath.Join(h, ".local", "share"), nil
 }
+
+func ConfigHome() (string, error) {
+	if v := os.Getenv("XDG_CONFIG_HOME"); v != "" {
+		return v, nil
+	}
+	h, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if h == "" {
+		return "", errors.New("empty home dir")
+	}
+	return filepath.Join(h, ".config"), nil
+}
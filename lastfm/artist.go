@@ -0,0 +1,123 @@
+package lastfm
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"strconv"
+)
+
+type SimilarArtistsResponse struct {
+	SimilarArtists struct {
+		Artist List[SimilarArtist] `json:"artist"`
+	} `json:"similarartists"`
+}
+
+type SimilarArtist struct {
+	Name  string `json:"name"`
+	Match string `json:"match"`
+	URL   string `json:"url"`
+	MBID  string `json:"mbid"`
+}
+
+type TopTracksResponse struct {
+	TopTracks struct {
+		Track List[TopTrack] `json:"track"`
+	} `json:"toptracks"`
+}
+
+type TopTrack struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	MBID string `json:"mbid"`
+}
+
+func (c *Client) GetSimilarArtists(ctx context.Context, artist string, limit int) ([]SimilarArtist, error) {
+	q := url.Values{}
+	q.Set("method", "artist.getSimilar")
+	q.Set("artist", artist)
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("autocorrect", "1")
+
+	var r SimilarArtistsResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.SimilarArtists.Artist, nil
+}
+
+func (c *Client) GetArtistTopTracks(ctx context.Context, artist string, limit int) ([]TopTrack, error) {
+	q := url.Values{}
+	q.Set("method", "artist.getTopTracks")
+	q.Set("artist", artist)
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("autocorrect", "1")
+
+	var r TopTracksResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.TopTracks.Track, nil
+}
+
+type TopAlbumsResponse struct {
+	TopAlbums struct {
+		Album List[TopAlbum] `json:"album"`
+	} `json:"topalbums"`
+}
+
+type TopAlbum struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	MBID string `json:"mbid"`
+}
+
+func (c *Client) GetArtistTopAlbums(ctx context.Context, artist string, limit int) ([]TopAlbum, error) {
+	q := url.Values{}
+	q.Set("method", "artist.getTopAlbums")
+	q.Set("artist", artist)
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("autocorrect", "1")
+
+	var r TopAlbumsResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.TopAlbums.Album, nil
+}
+
+type TopTagsResponse struct {
+	TopTags struct {
+		Tag List[Tag] `json:"tag"`
+	} `json:"toptags"`
+}
+
+// Tag is a folksonomy tag; Count is its weight for the artist, 0-100.
+type Tag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	URL   string `json:"url"`
+}
+
+func (c *Client) GetArtistTopTags(ctx context.Context, artist string) ([]Tag, error) {
+	q := url.Values{}
+	q.Set("method", "artist.getTopTags")
+	q.Set("artist", artist)
+	q.Set("autocorrect", "1")
+
+	var r TopTagsResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.TopTags.Tag, nil
+}
+
+// Obscurity maps a Last.fm listener count to 0-1 on a log scale: 0 at 10
+// million listeners or more (the biggest artists), about 0.57 at a thousand,
+// 1 at none.
+func Obscurity(listeners int64) float64 {
+	if listeners <= 0 {
+		return 1
+	}
+	return min(max(1-math.Log10(float64(listeners)+1)/7, 0), 1)
+}
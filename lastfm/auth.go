@@ -0,0 +1,60 @@
+package lastfm
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Session is an authorized user session for write methods.
+type Session struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// GetToken starts desktop authentication (auth.getToken). Send the user to
+// AuthURL(token), then exchange the token with GetSession.
+func (c *Client) GetToken(ctx context.Context) (string, error) {
+	var r struct {
+		Token string `json:"token"`
+	}
+	if err := c.doSigned(ctx, url.Values{"method": {"auth.getToken"}}, &r); err != nil {
+		return "", err
+	}
+	return r.Token, nil
+}
+
+// AuthURL is the page where the user grants this API account access.
+func (c *Client) AuthURL(token string) string {
+	q := url.Values{"api_key": {c.apiKey}, "token": {token}}
+	return "https://www.last.fm/api/auth/?" + q.Encode()
+}
+
+// GetSession exchanges an authorized token for a session (auth.getSession).
+// Session keys do not expire; store it and pass it to WithSessionKey.
+func (c *Client) GetSession(ctx context.Context, token string) (Session, error) {
+	var r struct {
+		Session Session `json:"session"`
+	}
+	if err := c.doSigned(ctx, url.Values{"method": {"auth.getSession"}, "token": {token}}, &r); err != nil {
+		return Session{}, err
+	}
+	return r.Session, nil
+}
+
+// doSigned makes a signed GET that needs no session (the auth.* methods).
+func (c *Client) doSigned(ctx context.Context, q url.Values, out any) error {
+	if c == nil || c.apiKey == "" {
+		return ErrMissingAPIKey
+	}
+	if c.secret == "" {
+		return ErrMissingSession
+	}
+	q.Set("api_key", c.apiKey)
+	q.Set("api_sig", c.sign(q))
+	u := c.endpoint(q)
+	_, err := retry(ctx, c.retry, func() (http.Header, error) {
+		return c.get(ctx, u, out)
+	})
+	return err
+}
@@ -0,0 +1,221 @@
+package lastfm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CacheOptions configures Cache.
+type CacheOptions struct {
+	// Dir holds one file per cached response; it is created on first use.
+	Dir string
+	// TTL is how long a response stays fresh, per API method as named in
+	// the method parameter (matched case-insensitively). Methods not
+	// listed use DefaultTTL; 0 means not cached.
+	TTL        map[string]time.Duration
+	DefaultTTL time.Duration
+}
+
+// DefaultCacheTTLs caches what changes slowly: artist, album, track and
+// tag data for days, charts and a user's top lists for an hour. Recent
+// tracks are never cached.
+func DefaultCacheTTLs() map[string]time.Duration {
+	const day = 24 * time.Hour
+	return map[string]time.Duration{
+		"artist.getInfo":      7 * day,
+		"artist.getSimilar":   7 * day,
+		"artist.getTopTracks": 7 * day,
+		"artist.getTopAlbums": 7 * day,
+		"artist.getTopTags":   7 * day,
+		"album.getInfo":       30 * day,
+		"track.getInfo":       30 * day,
+		"track.getSimilar":    7 * day,
+		"tag.getTopArtists":   day,
+		"tag.getTopTracks":    day,
+		"chart.getTopArtists": time.Hour,
+		"chart.getTopTracks":  time.Hour,
+		"geo.getTopArtists":   time.Hour,
+		"geo.getTopTracks":    time.Hour,
+		"user.getFriends":     day,
+		"user.getTopArtists":  time.Hour,
+		"user.getTopTracks":   time.Hour,
+		"user.getTopAlbums":   time.Hour,
+	}
+}
+
+// CacheHeader is set to "hit" on responses served from Cache, and to
+// "revalidated" on those confirmed fresh by a 304.
+const CacheHeader = "X-Lastfm-Cache"
+
+// cacheEntry is a cached response on disk.
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	Expires      time.Time `json:"expires"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Body         []byte    `json:"body"`
+}
+
+// Cache is Middleware that keeps successful GET responses on disk, keyed by
+// method and parameters, so repeated runs don't spend API quota. Signed
+// requests, Last.fm error bodies and responses marked Cache-Control:
+// no-store are never cached. A stale entry with an ETag or Last-Modified is
+// revalidated, and a 304 keeps it for another TTL. A request with
+// Cache-Control: no-cache skips fresh entries.
+func Cache(opt CacheOptions) Middleware {
+	ttls := make(map[string]time.Duration, len(opt.TTL))
+	for m, d := range opt.TTL {
+		ttls[strings.ToLower(m)] = d
+	}
+	ttlFor := func(method string) time.Duration {
+		if d, ok := ttls[strings.ToLower(method)]; ok {
+			return d
+		}
+		return opt.DefaultTTL
+	}
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			q := r.URL.Query()
+			ttl := ttlFor(q.Get("method"))
+			if r.Method != http.MethodGet || q.Get("method") == "" || q.Has("api_sig") || ttl <= 0 {
+				return next.RoundTrip(r)
+			}
+			path := filepath.Join(opt.Dir, requestKey(q)+".json")
+
+			e, _ := readCacheEntry(path)
+			if e != nil && time.Now().Before(e.Expires) && !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+				return cachedResponse(r, e, "hit"), nil
+			}
+			if e != nil && (e.ETag != "" || e.LastModified != "") {
+				r = r.Clone(r.Context())
+				if e.ETag != "" {
+					r.Header.Set("If-None-Match", e.ETag)
+				}
+				if e.LastModified != "" {
+					r.Header.Set("If-Modified-Since", e.LastModified)
+				}
+			}
+
+			resp, err := next.RoundTrip(r)
+			if err != nil {
+				return resp, err
+			}
+			if resp.StatusCode == http.StatusNotModified && e != nil {
+				resp.Body.Close()
+				e.Expires = time.Now().Add(ttl)
+				_ = writeJSONFile(path, e)
+				return cachedResponse(r, e, "revalidated"), nil
+			}
+			if resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+				return resp, nil
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			var env struct {
+				Error int `json:"error"`
+			}
+			if json.Unmarshal(body, &env) == nil && env.Error == 0 {
+				_ = writeJSONFile(path, &cacheEntry{
+					URL:          redactURL(r.URL),
+					Expires:      time.Now().Add(ttl),
+					ETag:         resp.Header.Get("ETag"),
+					LastModified: resp.Header.Get("Last-Modified"),
+					Body:         body,
+				})
+			}
+			return resp, nil
+		})
+	}
+}
+
+// requestKey hashes request parameters, minus credentials, in a stable
+// order; the method is one of them.
+func requestKey(q url.Values) string {
+	q = maps.Clone(q)
+	for _, k := range redactedParams {
+		q.Del(k)
+	}
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%q\n", k, q[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func readCacheEntry(path string) (*cacheEntry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// writeJSONFile replaces path with v atomically, so a concurrent reader
+// never sees half an entry.
+func writeJSONFile(path string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func cachedResponse(r *http.Request, e *cacheEntry, how string) *http.Response {
+	h := http.Header{}
+	h.Set("Content-Type", "application/json")
+	h.Set(CacheHeader, how)
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       r,
+	}
+}
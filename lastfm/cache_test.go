@@ -0,0 +1,74 @@
+package lastfm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheServesAndRevalidates(t *testing.T) {
+	calls := map[string]int{}
+	revalidated := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method := r.URL.Query().Get("method")
+		calls[method]++
+		switch method {
+		case "artist.getSimilar":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				revalidated++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			fmt.Fprint(w, `{"similarartists":{"artist":[{"name":"Tycho","match":"1"}]}}`)
+		case "artist.getTopTracks":
+			fmt.Fprint(w, `{"error":6,"message":"The artist you supplied could not be found"}`)
+		default:
+			fmt.Fprint(w, `{"artists":{"artist":[]}}`)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	ctx := context.Background()
+	newClient := func(ttl time.Duration) *Client {
+		c, err := New("key", WithBaseURL(srv.URL), WithRateLimit(0), WithRetry(RetryPolicy{MaxAttempts: 1}),
+			WithMiddleware(Cache(CacheOptions{Dir: dir, TTL: map[string]time.Duration{"artist.getSimilar": ttl, "chart.getTopArtists": 0}})))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	c := newClient(time.Hour)
+	for range 2 {
+		if sim, err := c.GetSimilarArtists(ctx, "Boards of Canada", 5); err != nil || len(sim) != 1 {
+			t.Fatalf("similar = %v, %v", sim, err)
+		}
+		// Errors and methods without a TTL go to the server every time.
+		if _, err := c.GetArtistTopTracks(ctx, "Nobody", 5); err == nil {
+			t.Fatal("expected an API error")
+		}
+		if _, err := c.GetChartTopArtists(ctx, 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls["artist.getSimilar"] != 1 || calls["artist.getTopTracks"] != 2 || calls["chart.getTopArtists"] != 2 {
+		t.Fatalf("calls = %v", calls)
+	}
+
+	// Once stale, an entry is revalidated with its ETag and served on 304.
+	c = newClient(time.Nanosecond)
+	for range 2 {
+		time.Sleep(time.Millisecond)
+		if sim, err := c.GetSimilarArtists(ctx, "Bibio", 5); err != nil || len(sim) != 1 || sim[0].Name != "Tycho" {
+			t.Fatalf("revalidated similar = %v, %v", sim, err)
+		}
+	}
+	if calls["artist.getSimilar"] != 3 || revalidated != 1 {
+		t.Fatalf("calls = %v, revalidated = %d", calls, revalidated)
+	}
+}
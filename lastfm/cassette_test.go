@@ -0,0 +1,63 @@
+package lastfm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordThenReplay(t *testing.T) {
+	page := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page++
+		fmt.Fprintf(w, `{"artists":{"artist":[{"name":"Artist %d"}]}}`, page)
+	}))
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	rec, err := New("secret-key", WithBaseURL(srv.URL), WithRateLimit(0), WithMiddleware(Record(dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if _, err := rec.GetChartTopArtists(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.Close()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("cassette = %v, %v", entries, err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	if err != nil || strings.Contains(string(b), "secret-key") {
+		t.Fatalf("cassette leaks the api key or is unreadable (%v):\n%s", err, b)
+	}
+
+	// Replay needs no server: responses come back in order, the last
+	// repeating, and unrecorded requests fail.
+	play, err := New("other-key", WithBaseURL(srv.URL), WithRateLimit(0), WithRetry(RetryPolicy{MaxAttempts: 1}), WithMiddleware(Replay(dir)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for range 3 {
+		a, err := play.GetChartTopArtists(ctx, 1)
+		if err != nil || len(a) != 1 {
+			t.Fatalf("replay = %v, %v", a, err)
+		}
+		got = append(got, a[0].Name)
+	}
+	if strings.Join(got, ",") != "Artist 1,Artist 2,Artist 2" {
+		t.Fatalf("replayed %v", got)
+	}
+	if _, err := play.GetChartTopArtists(ctx, 2); err == nil || !strings.Contains(err.Error(), "no recorded response") {
+		t.Fatalf("unrecorded request: err = %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package lastfm
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// ChartArtist is an entry in a global (chart.*) or country (geo.*) artist
+// chart. Country charts don't carry PlayCount.
+type ChartArtist struct {
+	Name      string `json:"name"`
+	PlayCount string `json:"playcount"`
+	Listeners string `json:"listeners"`
+	URL       string `json:"url"`
+	MBID      string `json:"mbid"`
+}
+
+type ChartTrack struct {
+	Name      string `json:"name"`
+	PlayCount string `json:"playcount"`
+	Listeners string `json:"listeners"`
+	URL       string `json:"url"`
+	MBID      string `json:"mbid"`
+	Artist    struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+		MBID string `json:"mbid"`
+	} `json:"artist"`
+}
+
+type ChartTopArtistsResponse struct {
+	Artists struct {
+		Artist List[ChartArtist] `json:"artist"`
+	} `json:"artists"`
+}
+
+type GeoTopArtistsResponse struct {
+	TopArtists struct {
+		Artist List[ChartArtist] `json:"artist"`
+	} `json:"topartists"`
+}
+
+// ChartTopTracksResponse is the shape of both chart.getTopTracks and
+// geo.getTopTracks.
+type ChartTopTracksResponse struct {
+	Tracks struct {
+		Track List[ChartTrack] `json:"track"`
+	} `json:"tracks"`
+}
+
+func (c *Client) GetChartTopArtists(ctx context.Context, limit int) ([]ChartArtist, error) {
+	q := url.Values{}
+	q.Set("method", "chart.getTopArtists")
+	q.Set("limit", strconv.Itoa(limit))
+
+	var r ChartTopArtistsResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.Artists.Artist, nil
+}
+
+func (c *Client) GetChartTopTracks(ctx context.Context, limit int) ([]ChartTrack, error) {
+	q := url.Values{}
+	q.Set("method", "chart.getTopTracks")
+	q.Set("limit", strconv.Itoa(limit))
+
+	var r ChartTopTracksResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.Tracks.Track, nil
+}
+
+// GetGeoTopArtists is a country's artist chart; country is an ISO 3166-1
+// country name, e.g. "netherlands".
+func (c *Client) GetGeoTopArtists(ctx context.Context, country string, limit int) ([]ChartArtist, error) {
+	q := url.Values{}
+	q.Set("method", "geo.getTopArtists")
+	q.Set("country", country)
+	q.Set("limit", strconv.Itoa(limit))
+
+	var r GeoTopArtistsResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.TopArtists.Artist, nil
+}
+
+// GetGeoTopTracks is a country's track chart (see GetGeoTopArtists).
+func (c *Client) GetGeoTopTracks(ctx context.Context, country string, limit int) ([]ChartTrack, error) {
+	q := url.Values{}
+	q.Set("method", "geo.getTopTracks")
+	q.Set("country", country)
+	q.Set("limit", strconv.Itoa(limit))
+
+	var r ChartTopTracksResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.Tracks.Track, nil
+}
+
+// TagTopArtistsResponse and TagTopTracksResponse reuse the chart entry
+// types; tag charts carry no counts, only their order.
+type TagTopArtistsResponse struct {
+	TopArtists struct {
+		Artist List[ChartArtist] `json:"artist"`
+	} `json:"topartists"`
+}
+
+type TagTopTracksResponse struct {
+	Tracks struct {
+		Track List[ChartTrack] `json:"track"`
+	} `json:"tracks"`
+}
+
+// GetTagTopArtists lists the artists most tagged with tag, e.g. "dungeon
+// synth".
+func (c *Client) GetTagTopArtists(ctx context.Context, tag string, limit int) ([]ChartArtist, error) {
+	q := url.Values{}
+	q.Set("method", "tag.getTopArtists")
+	q.Set("tag", tag)
+	q.Set("limit", strconv.Itoa(limit))
+
+	var r TagTopArtistsResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.TopArtists.Artist, nil
+}
+
+// GetTagTopTracks lists the tracks most tagged with tag.
+func (c *Client) GetTagTopTracks(ctx context.Context, tag string, limit int) ([]ChartTrack, error) {
+	q := url.Values{}
+	q.Set("method", "tag.getTopTracks")
+	q.Set("tag", tag)
+	q.Set("limit", strconv.Itoa(limit))
+
+	var r TagTopTracksResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.Tracks.Track, nil
+}
@@ -0,0 +1,267 @@
+// Package lastfm is a small client for the Last.fm web API methods used by
+// lastfm-golang: mostly reads, plus signed track.scrobble for manual plays.
+package lastfm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBaseURL   = "https://ws.audioscrobbler.com/2.0/"
+	DefaultRateLimit = 200 * time.Millisecond // Last.fm asks for at most ~5 requests/s
+)
+
+// Client calls the Last.fm API. Construct it with New; the zero value is not
+// usable. A Client is safe for concurrent use and spaces out requests
+// according to its rate limit.
+type Client struct {
+	apiKey     string
+	secret     string
+	sessionKey string
+	username   string
+	userAgent  string
+	baseURL    *url.URL
+	http       *http.Client
+	retry      RetryPolicy
+	interval   time.Duration
+	middleware []Middleware
+	meter      meter
+
+	mu       sync.Mutex
+	nextSlot time.Time
+}
+
+type Option func(*Client) error
+
+func New(apiKey string, opts ...Option) (*Client, error) {
+	if apiKey == "" {
+		return nil, ErrMissingAPIKey
+	}
+	base, _ := url.Parse(DefaultBaseURL)
+	c := &Client{
+		apiKey:   apiKey,
+		baseURL:  base,
+		http:     &http.Client{Timeout: 30 * time.Second},
+		retry:    DefaultRetryPolicy(),
+		interval: DefaultRateLimit,
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	c.wrapTransport()
+	return c, nil
+}
+
+// WithUsername sets the user whose data user.* methods read.
+func WithUsername(username string) Option {
+	return func(c *Client) error {
+		c.username = username
+		return nil
+	}
+}
+
+// WithSharedSecret sets the API account's shared secret, used to sign
+// auth.* and write requests.
+func WithSharedSecret(secret string) Option {
+	return func(c *Client) error {
+		c.secret = secret
+		return nil
+	}
+}
+
+// WithSessionKey sets the user session that write methods such as
+// track.scrobble act as (see GetSession).
+func WithSessionKey(sk string) Option {
+	return func(c *Client) error {
+		c.sessionKey = sk
+		return nil
+	}
+}
+
+func WithUserAgent(ua string) Option {
+	return func(c *Client) error {
+		c.userAgent = ua
+		return nil
+	}
+}
+
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) error {
+		if hc == nil {
+			return errors.New("lastfm: nil http client")
+		}
+		c.http = hc
+		return nil
+	}
+}
+
+// WithBaseURL points the client at another API root, e.g. a test server or
+// a Last.fm-compatible service.
+func WithBaseURL(raw string) Option {
+	return func(c *Client) error {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("lastfm: invalid base url: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("lastfm: invalid base url: %q", raw)
+		}
+		c.baseURL = u
+		return nil
+	}
+}
+
+// WithProxy routes requests through an HTTP(S) proxy. Without it the default
+// transport already honors HTTPS_PROXY/HTTP_PROXY/NO_PROXY. Apply it after
+// WithHTTPClient, whose client it modifies.
+func WithProxy(raw string) Option {
+	return func(c *Client) error {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("lastfm: invalid proxy url: %q", raw)
+		}
+		t := c.transport()
+		t.Proxy = http.ProxyURL(u)
+		c.setTransport(t)
+		return nil
+	}
+}
+
+// WithRateLimit sets the minimum spacing between requests (0 disables it).
+func WithRateLimit(every time.Duration) Option {
+	return func(c *Client) error {
+		if every < 0 {
+			return fmt.Errorf("lastfm: negative rate limit: %s", every)
+		}
+		c.interval = every
+		return nil
+	}
+}
+
+// WithRetry sets how retryable failures are retried; MaxAttempts of 1
+// disables retries. When it retries, the backoffs must be positive, the
+// initial one no longer than the maximum.
+func WithRetry(p RetryPolicy) Option {
+	return func(c *Client) error {
+		if p.MaxAttempts <= 0 {
+			return fmt.Errorf("lastfm: invalid retry max attempts: %d", p.MaxAttempts)
+		}
+		if p.MaxAttempts == 1 {
+			c.retry = p
+			return nil
+		}
+		if p.InitialBackoff <= 0 {
+			return fmt.Errorf("lastfm: invalid retry initial backoff: %s", p.InitialBackoff)
+		}
+		if p.MaxBackoff < p.InitialBackoff {
+			return fmt.Errorf("lastfm: retry max backoff %s is below initial backoff %s", p.MaxBackoff, p.InitialBackoff)
+		}
+		c.retry = p
+		return nil
+	}
+}
+
+// Username returns the user configured with WithUsername.
+func (c *Client) Username() string {
+	return c.username
+}
+
+type RecentTracksResponse struct {
+	RecentTracks struct {
+		Track List[Track] `json:"track"`
+		Attr  PageAttr    `json:"@attr"`
+	} `json:"recenttracks"`
+}
+
+type TextMBID struct {
+	Text string `json:"#text"`
+	MBID string `json:"mbid"`
+}
+
+type Date struct {
+	UTS  string `json:"uts"`
+	Text string `json:"#text"`
+}
+
+type Track struct {
+	Name   string   `json:"name"`
+	MBID   string   `json:"mbid"`
+	URL    string   `json:"url"`
+	Artist TextMBID `json:"artist"`
+	Album  TextMBID `json:"album"`
+	Date   *Date    `json:"date"`
+	Attr   struct {
+		NowPlaying string `json:"nowplaying"`
+	} `json:"@attr"`
+}
+
+type Page struct {
+	Tracks     []Track
+	Page       int
+	PerPage    int
+	TotalPages int
+	Total      int
+	// Next is where RecentTrackPagesBefore resumes after this page: its
+	// to for the next request.
+	Next int64
+	// Raw is the response body as received and Params the request's
+	// parameters, without credentials, when asked for with
+	// RecentTracksOptions.KeepRaw.
+	Raw    []byte
+	Params url.Values
+}
+
+func (c *Client) GetRecentTracksPage(ctx context.Context, page, limit int) (Page, error) {
+	return c.recentTracksPage(ctx, "", page, limit, 0, 0, false)
+}
+
+// recentTracksPage decodes the page as it streams in, one track at a time,
+// so large pages don't sit in memory twice. user "" means the configured
+// user; to, if not 0, keeps to scrobbles played before it, and from, if not
+// 0, to those played at or after it.
+func (c *Client) recentTracksPage(ctx context.Context, user string, page, limit int, from, to int64, keepRaw bool) (Page, error) {
+	user, err := c.user(user)
+	if err != nil {
+		return Page{}, err
+	}
+	q := url.Values{}
+	q.Set("method", "user.getrecenttracks")
+	q.Set("user", user)
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("page", strconv.Itoa(page))
+	if from != 0 {
+		q.Set("from", strconv.FormatInt(from, 10))
+	}
+	if to != 0 {
+		q.Set("to", strconv.FormatInt(to, 10))
+	}
+
+	var params url.Values
+	if keepRaw {
+		params = maps.Clone(q)
+		for _, k := range redactedParams {
+			params.Del(k)
+		}
+	}
+	r := recentTracksStream{keepRaw: keepRaw}
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return Page{}, err
+	}
+
+	p := Page{Tracks: r.tracks, Raw: r.raw, Params: params}
+	p.Page, _ = strconv.Atoi(r.attr.Page)
+	p.PerPage, _ = strconv.Atoi(r.attr.PerPage)
+	p.TotalPages, _ = strconv.Atoi(r.attr.TotalPages)
+	p.Total, _ = strconv.Atoi(r.attr.Total)
+	return p, nil
+}
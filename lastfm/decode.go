@@ -0,0 +1,293 @@
+package lastfm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Last.fm's JSON is generated from XML, so its shapes drift: a one-element
+// array comes as a lone object, an empty one as "", numbers and names that
+// look like numbers come unquoted, and a missing object can be "" or {}.
+// The decoders here accept all of these, so one odd entry doesn't fail a
+// whole page.
+
+// List is an array Last.fm sends as a lone object when it has one element,
+// and as "" when it has none.
+type List[T any] []T
+
+func (l *List[T]) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	switch {
+	case len(b) == 0 || b[0] == '"' || bytes.Equal(b, []byte("null")):
+		*l = nil
+		return nil
+	case b[0] == '{':
+		var v T
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		*l = List[T]{v}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]T)(l))
+}
+
+// flexString is a string field that may arrive as a number or boolean (a
+// track called 1979, a count of 12); null, objects and arrays decode as "".
+type flexString string
+
+func (s *flexString) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	switch {
+	case len(b) == 0:
+		*s = ""
+	case b[0] == '"':
+		var v string
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		*s = flexString(v)
+	case b[0] == '{' || b[0] == '[' || bytes.Equal(b, []byte("null")):
+		*s = ""
+	default:
+		*s = flexString(b)
+	}
+	return nil
+}
+
+// UnmarshalJSON accepts {"#text", "mbid"}, the extended form {"name",
+// "mbid", ...} and a bare string.
+func (t *TextMBID) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] != '{' {
+		var s flexString
+		if err := s.UnmarshalJSON(b); err != nil {
+			return err
+		}
+		*t = TextMBID{Text: string(s)}
+		return nil
+	}
+	var v struct {
+		Text flexString `json:"#text"`
+		Name flexString `json:"name"`
+		MBID flexString `json:"mbid"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*t = TextMBID{Text: string(v.Text), MBID: string(v.MBID)}
+	if t.Text == "" {
+		t.Text = string(v.Name)
+	}
+	return nil
+}
+
+// UnmarshalJSON accepts a numeric uts and an empty date ("" or {}).
+func (d *Date) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || b[0] != '{' {
+		*d = Date{}
+		return nil
+	}
+	var v struct {
+		UTS  flexString `json:"uts"`
+		Text flexString `json:"#text"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*d = Date{UTS: string(v.UTS), Text: string(v.Text)}
+	return nil
+}
+
+// UnmarshalJSON decodes a recent track, leaving Date nil when it is empty
+// (as for the track playing now) and accepting a boolean nowplaying.
+func (t *Track) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Name   flexString `json:"name"`
+		MBID   flexString `json:"mbid"`
+		URL    flexString `json:"url"`
+		Artist TextMBID   `json:"artist"`
+		Album  TextMBID   `json:"album"`
+		Date   *Date      `json:"date"`
+		Attr   struct {
+			NowPlaying flexString `json:"nowplaying"`
+		} `json:"@attr"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*t = Track{
+		Name:   string(v.Name),
+		MBID:   string(v.MBID),
+		URL:    string(v.URL),
+		Artist: v.Artist,
+		Album:  v.Album,
+		Date:   v.Date,
+	}
+	if t.Date != nil && t.Date.UTS == "" {
+		t.Date = nil
+	}
+	t.Attr.NowPlaying = string(v.Attr.NowPlaying)
+	return nil
+}
+
+// PageAttr is the paging "@attr" of a list response; Last.fm sends its
+// fields as strings or numbers.
+type PageAttr struct {
+	Page       string `json:"page"`
+	PerPage    string `json:"perPage"`
+	TotalPages string `json:"totalPages"`
+	Total      string `json:"total"`
+}
+
+func (a *PageAttr) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Page       flexString `json:"page"`
+		PerPage    flexString `json:"perPage"`
+		TotalPages flexString `json:"totalPages"`
+		Total      flexString `json:"total"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*a = PageAttr{Page: string(v.Page), PerPage: string(v.PerPage), TotalPages: string(v.TotalPages), Total: string(v.Total)}
+	return nil
+}
+
+// streamDecoder is an out value send decodes straight from a 200 response
+// body instead of buffering it. It reports Last.fm error bodies itself.
+type streamDecoder interface {
+	decodeStream(r io.Reader) error
+}
+
+// recentTracksStream decodes a user.getRecentTracks page track by track,
+// optionally keeping a copy of the body.
+type recentTracksStream struct {
+	keepRaw bool
+
+	tracks []Track
+	attr   PageAttr
+	raw    []byte
+}
+
+func (s *recentTracksStream) decodeStream(r io.Reader) error {
+	s.tracks, s.attr, s.raw = nil, PageAttr{}, nil
+	var buf *bytes.Buffer
+	if s.keepRaw {
+		buf = &bytes.Buffer{}
+		r = io.TeeReader(r, buf)
+	}
+
+	dec := json.NewDecoder(r)
+	var env struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	err := eachKey(dec, func(k string) error {
+		switch k {
+		case "error":
+			return dec.Decode(&env.Error)
+		case "message":
+			return dec.Decode(&env.Message)
+		case "recenttracks":
+			return eachKey(dec, func(k string) error {
+				switch k {
+				case "track":
+					return s.decodeTracks(dec)
+				case "@attr":
+					return dec.Decode(&s.attr)
+				}
+				return dec.Decode(new(json.RawMessage))
+			})
+		}
+		return dec.Decode(new(json.RawMessage))
+	})
+	if err != nil {
+		return fmt.Errorf("decode lastfm response: %w", err)
+	}
+	if env.Error != 0 {
+		return APIError{Code: env.Error, Message: env.Message}
+	}
+	if buf != nil {
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return err
+		}
+		s.raw = buf.Bytes()
+	}
+	return nil
+}
+
+// decodeTracks reads the "track" value: an array decoded one element at a
+// time, or (see List) a lone object or "".
+func (s *recentTracksStream) decodeTracks(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('['):
+		for dec.More() {
+			var t Track
+			if err := dec.Decode(&t); err != nil {
+				return err
+			}
+			s.tracks = append(s.tracks, t)
+		}
+		_, err := dec.Token()
+		return err
+	case json.Delim('{'):
+		// The opening brace is gone, so collect the fields and decode
+		// them as one object.
+		fields := map[string]json.RawMessage{}
+		if err := eachKeyOpen(dec, func(k string) error {
+			var v json.RawMessage
+			err := dec.Decode(&v)
+			fields[k] = v
+			return err
+		}); err != nil {
+			return err
+		}
+		b, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		var t Track
+		if err := json.Unmarshal(b, &t); err != nil {
+			return err
+		}
+		s.tracks = []Track{t}
+	}
+	return nil
+}
+
+// eachKey reads a JSON object from dec, calling fn for each key; fn must
+// consume the key's value.
+func eachKey(dec *json.Decoder, fn func(key string) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("expected an object, got %v", tok)
+	}
+	return eachKeyOpen(dec, fn)
+}
+
+// eachKeyOpen is eachKey after the opening brace has been read.
+func eachKeyOpen(dec *json.Decoder, fn func(key string) error) error {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		k, _ := tok.(string)
+		if err := fn(k); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
@@ -0,0 +1,214 @@
+package lastfm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func decodeFixture(t *testing.T, name string, v any) {
+	t.Helper()
+	b, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+}
+
+func TestDecodeRecentTracksQuirks(t *testing.T) {
+	// A user with a single scrobble gets the track as a lone object.
+	var single RecentTracksResponse
+	decodeFixture(t, "recenttracks_single.json", &single)
+	if tr := single.RecentTracks.Track; len(tr) != 1 || tr[0].Name != "Archangel" || tr[0].Date == nil || tr[0].Date.UTS != "1700003900" {
+		t.Fatalf("single = %+v", tr)
+	}
+
+	// Extended artists, a numeric track name and uts, a boolean nowplaying,
+	// empty dates and albums, a bare-string artist and numeric paging.
+	var r RecentTracksResponse
+	decodeFixture(t, "recenttracks_quirks.json", &r)
+	tr := r.RecentTracks.Track
+	if len(tr) != 3 {
+		t.Fatalf("tracks = %+v", tr)
+	}
+	if tr[0].Name != "1979" || tr[0].Artist.Text != "The Smashing Pumpkins" || tr[0].Artist.MBID == "" || tr[0].Attr.NowPlaying != "true" || tr[0].Date != nil {
+		t.Fatalf("now playing = %+v", tr[0])
+	}
+	if tr[1].Artist.Text != "blink-182" || tr[1].Date == nil || tr[1].Date.UTS != "1700003600" {
+		t.Fatalf("numeric uts = %+v", tr[1])
+	}
+	if tr[2].Artist.Text != "Aphex Twin" || tr[2].Album.Text != "" || tr[2].Date != nil {
+		t.Fatalf("bare artist = %+v", tr[2])
+	}
+	if a := r.RecentTracks.Attr; a.Page != "1" || a.TotalPages != "12" || a.Total != "2301" {
+		t.Fatalf("attr = %+v", a)
+	}
+
+	// What the raw archive writes reads back the same.
+	b, err := json.Marshal(tr[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again Track
+	if err := json.Unmarshal(b, &again); err != nil || again.Name != tr[1].Name || again.Date.UTS != tr[1].Date.UTS || again.Artist != tr[1].Artist {
+		t.Fatalf("round trip = %+v, %v", again, err)
+	}
+}
+
+func TestDecodeSingleSimilarArtist(t *testing.T) {
+	var r SimilarArtistsResponse
+	decodeFixture(t, "similar_single.json", &r)
+	if a := r.SimilarArtists.Artist; len(a) != 1 || a[0].Name != "Kode9" {
+		t.Fatalf("similar = %+v", a)
+	}
+}
+
+func TestRecentTracksPageStreamsAndKeepsRaw(t *testing.T) {
+	body, err := os.ReadFile("testdata/recenttracks_quirks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{"error":6,"message":"User not found"}`)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+	c, err := New("key", WithBaseURL(srv.URL), WithUsername("testuser"), WithRateLimit(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pages []Page
+	for p, err := range c.RecentTrackPages(context.Background(), RecentTracksOptions{KeepRaw: true}) {
+		if err != nil {
+			if !errors.Is(err, ErrUserNotFound) {
+				t.Fatalf("page 2: %v", err)
+			}
+			break
+		}
+		pages = append(pages, p)
+	}
+	if len(pages) != 1 || len(pages[0].Tracks) != 3 || pages[0].Tracks[0].Name != "1979" || pages[0].TotalPages != 12 || !bytes.Equal(pages[0].Raw, body) {
+		t.Fatalf("pages = %+v", pages)
+	}
+
+	// Without KeepRaw nothing is kept.
+	p, err := c.GetRecentTracksPage(context.Background(), 1, 200)
+	if err != nil || p.Raw != nil || len(p.Tracks) != 3 {
+		t.Fatalf("page = %+v, %v", p, err)
+	}
+}
+
+func TestRecentTrackPagesBeforeWalksBackInTime(t *testing.T) {
+	// Two scrobbles share second 99 across the first page boundary.
+	played := []int64{100, 99, 99, 98, 97, 96}
+	var tos []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		tos = append(tos, q.Get("to"))
+		to, _ := strconv.ParseInt(q.Get("to"), 10, 64)
+		var resp RecentTracksResponse
+		for i, uts := range played {
+			if (to == 0 || uts < to) && len(resp.RecentTracks.Track) < 3 {
+				resp.RecentTracks.Track = append(resp.RecentTracks.Track, Track{Name: strconv.Itoa(i), Date: &Date{UTS: strconv.FormatInt(uts, 10)}})
+			}
+		}
+		resp.RecentTracks.Attr.PerPage = "3"
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+	c, err := New("key", WithBaseURL(srv.URL), WithUsername("testuser"), WithRateLimit(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	var next []int64
+	for p, err := range c.RecentTrackPagesBefore(context.Background(), RecentTracksOptions{Limit: 3}, 0) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tr := range p.Tracks {
+			seen[tr.Name] = true
+		}
+		next = append(next, p.Next)
+	}
+	if len(seen) != len(played) {
+		t.Fatalf("saw %d of %d scrobbles", len(seen), len(played))
+	}
+	if !slices.Equal(tos, []string{"", "100", "99", "97"}) || !slices.Equal(next, []int64{100, 99, 97, 96}) {
+		t.Fatalf("to = %q, next = %v", tos, next)
+	}
+}
+
+func TestRecentTrackPagesBeforePagesThroughOneSecond(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		played []int64
+	}{
+		// Last.fm's placeholder date; to=0 would mean no to at all.
+		{"placeholder", slices.Repeat([]int64{0}, 450)},
+		{"busy second", slices.Concat([]int64{9, 9}, slices.Repeat([]int64{7}, 450), []int64{6, 6, 6, 0})},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			requests := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				q := r.URL.Query()
+				from, _ := strconv.ParseInt(q.Get("from"), 10, 64)
+				to, _ := strconv.ParseInt(q.Get("to"), 10, 64)
+				limit, _ := strconv.Atoi(q.Get("limit"))
+				page, _ := strconv.Atoi(q.Get("page"))
+				var match []Track
+				for i, uts := range c.played {
+					if (to == 0 || uts < to) && uts >= from {
+						match = append(match, Track{Name: strconv.Itoa(i), Date: &Date{UTS: strconv.FormatInt(uts, 10)}})
+					}
+				}
+				var resp RecentTracksResponse
+				if start := (page - 1) * limit; start < len(match) {
+					resp.RecentTracks.Track = match[start:min(start+limit, len(match))]
+				}
+				resp.RecentTracks.Attr.PerPage = strconv.Itoa(limit)
+				json.NewEncoder(w).Encode(resp)
+			}))
+			defer srv.Close()
+			client, err := New("key", WithBaseURL(srv.URL), WithUsername("testuser"), WithRateLimit(0))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			seen := map[string]bool{}
+			for p, err := range client.RecentTrackPagesBefore(context.Background(), RecentTracksOptions{Limit: 200}, 0) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.Next <= 0 {
+					t.Fatalf("next = %d", p.Next)
+				}
+				for _, tr := range p.Tracks {
+					seen[tr.Name] = true
+				}
+				if requests > 20 {
+					t.Fatal("walk doesn't end")
+				}
+			}
+			if len(seen) != len(c.played) {
+				t.Fatalf("saw %d of %d scrobbles", len(seen), len(c.played))
+			}
+		})
+	}
+}
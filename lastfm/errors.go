@@ -0,0 +1,113 @@
+package lastfm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrMissingAPIKey   = errors.New("lastfm: missing api key")
+	ErrMissingUsername = errors.New("lastfm: missing username")
+	ErrMissingSession  = errors.New("lastfm: missing shared secret or session key")
+)
+
+// Failure kinds. APIError and HTTPError match them with errors.Is, so callers
+// can branch on what went wrong without knowing Last.fm's error codes:
+//
+//	if errors.Is(err, lastfm.ErrUserNotFound) { ... }
+var (
+	// ErrAuth: the API key, session key, token or signature was rejected.
+	ErrAuth = errors.New("lastfm: authentication failed")
+	// ErrInvalidParams: a parameter was missing or wrong, including an
+	// unknown artist, track, country or user.
+	ErrInvalidParams = errors.New("lastfm: invalid parameters")
+	// ErrUserNotFound: the user doesn't exist. It is also an ErrInvalidParams,
+	// which is how Last.fm reports it.
+	ErrUserNotFound = errors.New("lastfm: user not found")
+	// ErrRateLimited: too many requests; retried with backoff.
+	ErrRateLimited = errors.New("lastfm: rate limited")
+	// ErrUnavailable: Last.fm is down or failed temporarily; retried with
+	// backoff.
+	ErrUnavailable = errors.New("lastfm: temporarily unavailable")
+)
+
+// Last.fm API error codes (https://www.last.fm/api/errorcodes).
+const (
+	CodeInvalidService    = 2
+	CodeInvalidMethod     = 3
+	CodeAuthFailed        = 4
+	CodeInvalidFormat     = 5
+	CodeInvalidParams     = 6
+	CodeInvalidResource   = 7
+	CodeOperationFailed   = 8
+	CodeInvalidSession    = 9
+	CodeInvalidAPIKey     = 10
+	CodeServiceOffline    = 11
+	CodeInvalidSignature  = 13
+	CodeUnauthorizedToken = 14
+	CodeTokenExpired      = 15
+	CodeTemporaryError    = 16
+	CodeLoginRequired     = 17
+	CodeSuspendedAPIKey   = 26
+	CodeRateLimited       = 29
+)
+
+// HTTPError is a non-2xx response without a Last.fm error body.
+type HTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e HTTPError) Error() string {
+	return fmt.Sprintf("lastfm http %d: %s", e.StatusCode, e.Body)
+}
+
+// Is matches the failure kinds by status code.
+func (e HTTPError) Is(target error) bool {
+	switch target {
+	case ErrAuth:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrInvalidParams:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnavailable:
+		return e.StatusCode >= 500
+	}
+	return false
+}
+
+// APIError is an error Last.fm reported in the response body.
+type APIError struct {
+	Code    int
+	Message string
+}
+
+func (e APIError) Error() string {
+	return fmt.Sprintf("lastfm api error %d: %s", e.Code, e.Message)
+}
+
+// Is matches the failure kinds by error code; user not found shares code 6
+// with other bad parameters, so it goes by the message.
+func (e APIError) Is(target error) bool {
+	switch target {
+	case ErrAuth:
+		switch e.Code {
+		case CodeAuthFailed, CodeInvalidSession, CodeInvalidAPIKey, CodeInvalidSignature,
+			CodeUnauthorizedToken, CodeTokenExpired, CodeLoginRequired, CodeSuspendedAPIKey:
+			return true
+		}
+	case ErrInvalidParams:
+		return e.Code == CodeInvalidParams || e.Code == CodeInvalidResource
+	case ErrUserNotFound:
+		msg := strings.ToLower(e.Message)
+		return e.Code == CodeInvalidParams && (strings.Contains(msg, "user not found") || strings.Contains(msg, "no user"))
+	case ErrRateLimited:
+		return e.Code == CodeRateLimited
+	case ErrUnavailable:
+		return e.Code == CodeServiceOffline || e.Code == CodeTemporaryError
+	}
+	return false
+}
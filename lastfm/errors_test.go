@@ -0,0 +1,105 @@
+package lastfm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestErrorKinds(t *testing.T) {
+	kinds := []error{ErrAuth, ErrInvalidParams, ErrUserNotFound, ErrRateLimited, ErrUnavailable}
+	cases := []struct {
+		err  error
+		want []error
+	}{
+		{APIError{Code: CodeInvalidAPIKey, Message: "Invalid API key"}, []error{ErrAuth}},
+		{APIError{Code: CodeInvalidParams, Message: "User not found"}, []error{ErrInvalidParams, ErrUserNotFound}},
+		{APIError{Code: CodeInvalidParams, Message: "The artist you supplied could not be found"}, []error{ErrInvalidParams}},
+		{APIError{Code: CodeRateLimited}, []error{ErrRateLimited}},
+		{APIError{Code: CodeTemporaryError}, []error{ErrUnavailable}},
+		{APIError{Code: CodeOperationFailed}, nil},
+		{HTTPError{StatusCode: http.StatusBadGateway}, []error{ErrUnavailable}},
+		{HTTPError{StatusCode: http.StatusTooManyRequests}, []error{ErrRateLimited}},
+		{fmt.Errorf("wrapped: %w", HTTPError{StatusCode: http.StatusForbidden}), []error{ErrAuth}},
+	}
+	for _, c := range cases {
+		for _, k := range kinds {
+			want := false
+			for _, w := range c.want {
+				want = want || w == k
+			}
+			if got := errors.Is(c.err, k); got != want {
+				t.Errorf("errors.Is(%v, %v) = %v, want %v", c.err, k, got, want)
+			}
+		}
+	}
+}
+
+func TestAPIErrorWithHTTPStatus(t *testing.T) {
+	// Last.fm sometimes sends its error body with a 4xx instead of a 200.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"error":10,"message":"Invalid API key - You must be granted a valid key by last.fm"}`)
+	}))
+	defer srv.Close()
+
+	c, err := New("bad-key", WithBaseURL(srv.URL), WithRateLimit(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Ping(context.Background())
+	var ae APIError
+	if !errors.As(err, &ae) || ae.Code != CodeInvalidAPIKey || !errors.Is(err, ErrAuth) || IsRetryable(err) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestRetryStopsAtDeadline(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprint(w, `{"error":29,"message":"Rate limit exceeded"}`)
+	}))
+	defer srv.Close()
+
+	c, err := New("key", WithBaseURL(srv.URL), WithRateLimit(0),
+		WithRetry(RetryPolicy{MaxAttempts: 8, InitialBackoff: 50 * time.Millisecond, MaxBackoff: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 600*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.GetChartTopArtists(ctx, 1)
+	// 50ms, 100ms and 200ms backoffs fit; the 400ms one would overrun.
+	if !errors.Is(err, ErrRateLimited) || calls != 4 {
+		t.Fatalf("err = %v after %d calls, want rate limited after 4", err, calls)
+	}
+	if took := time.Since(start); took > 550*time.Millisecond {
+		t.Fatalf("gave up after %s, want before the deadline", took)
+	}
+}
+
+func TestWithRetryRejectsBadPolicies(t *testing.T) {
+	for _, c := range []struct {
+		p    RetryPolicy
+		want string // error; "" for none
+	}{
+		{DefaultRetryPolicy(), ""},
+		{RetryPolicy{MaxAttempts: 1, InitialBackoff: time.Second, MaxBackoff: time.Second}, ""},
+		{RetryPolicy{MaxAttempts: 1}, ""},
+		{RetryPolicy{MaxAttempts: 0, InitialBackoff: time.Second, MaxBackoff: time.Second}, "lastfm: invalid retry max attempts: 0"},
+		{RetryPolicy{MaxAttempts: 3, MaxBackoff: time.Second}, "lastfm: invalid retry initial backoff: 0s"},
+		{RetryPolicy{MaxAttempts: 3, InitialBackoff: -time.Second, MaxBackoff: time.Second}, "lastfm: invalid retry initial backoff: -1s"},
+		{RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second}, "lastfm: retry max backoff 0s is below initial backoff 1s"},
+	} {
+		_, err := New("key", WithRetry(c.p))
+		if got := fmt.Sprint(err); (c.want == "" && err != nil) || (c.want != "" && got != c.want) {
+			t.Errorf("WithRetry(%+v) = %v, want %q", c.p, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package lastfm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Wiki is the bio (artists) or wiki (albums, tracks) text; Summary is the
+// first paragraph with a "Read more on Last.fm" link.
+type Wiki struct {
+	Published string `json:"published"`
+	Summary   string `json:"summary"`
+	Content   string `json:"content"`
+}
+
+// TagList is a "tags" or "toptags" object. Last.fm sends a lone tag as an
+// object instead of a one-element array, and no tags as "". A plain array,
+// as TagList marshals itself, is accepted too.
+type TagList []Tag
+
+func (l *TagList) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	switch {
+	case len(b) == 0 || b[0] == '"' || bytes.Equal(b, []byte("null")):
+		*l = nil
+		return nil
+	case b[0] == '[':
+		return json.Unmarshal(b, (*[]Tag)(l))
+	}
+	var v struct {
+		Tag List[Tag] `json:"tag"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*l = TagList(v.Tag)
+	return nil
+}
+
+type ArtistInfoResponse struct {
+	Artist ArtistInfo `json:"artist"`
+}
+
+type ArtistInfo struct {
+	Name  string `json:"name"`
+	MBID  string `json:"mbid"`
+	URL   string `json:"url"`
+	Stats struct {
+		Listeners string `json:"listeners"`
+		PlayCount string `json:"playcount"`
+	} `json:"stats"`
+	Similar struct {
+		Artist List[SimilarArtist] `json:"artist"`
+	} `json:"similar"`
+	Tags TagList `json:"tags"`
+	Bio  Wiki    `json:"bio"`
+}
+
+// Listeners is Stats.Listeners as a number, 0 if missing.
+func (a ArtistInfo) Listeners() int64 {
+	return atoi64(a.Stats.Listeners)
+}
+
+func (c *Client) GetArtistInfo(ctx context.Context, artist string) (ArtistInfo, error) {
+	q := url.Values{}
+	q.Set("method", "artist.getInfo")
+	q.Set("artist", artist)
+	q.Set("autocorrect", "1")
+
+	var r ArtistInfoResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return ArtistInfo{}, err
+	}
+	return r.Artist, nil
+}
+
+type AlbumInfoResponse struct {
+	Album AlbumInfo `json:"album"`
+}
+
+type AlbumInfo struct {
+	Name      string `json:"name"`
+	Artist    string `json:"artist"`
+	MBID      string `json:"mbid"`
+	URL       string `json:"url"`
+	Listeners string `json:"listeners"`
+	PlayCount string `json:"playcount"`
+	// ReleaseDate ("6 Apr 1999, 00:00") only comes with some older albums;
+	// Last.fm has dropped it from most responses.
+	ReleaseDate string `json:"releasedate"`
+	Tracks      struct {
+		Track List[AlbumTrack] `json:"track"`
+	} `json:"tracks"`
+	Tags TagList `json:"tags"`
+	Wiki Wiki    `json:"wiki"`
+}
+
+type AlbumTrack struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Duration is in seconds; null or 0 when unknown.
+	Duration json.Number `json:"duration"`
+	Attr     struct {
+		Rank json.Number `json:"rank"`
+	} `json:"@attr"`
+}
+
+// Length is the track's duration, 0 if unknown.
+func (t AlbumTrack) Length() time.Duration {
+	n, _ := t.Duration.Int64()
+	return time.Duration(n) * time.Second
+}
+
+func (c *Client) GetAlbumInfo(ctx context.Context, artist, album string) (AlbumInfo, error) {
+	q := url.Values{}
+	q.Set("method", "album.getInfo")
+	q.Set("artist", artist)
+	q.Set("album", album)
+	q.Set("autocorrect", "1")
+
+	var r AlbumInfoResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return AlbumInfo{}, err
+	}
+	return r.Album, nil
+}
+
+type TrackInfoResponse struct {
+	Track TrackInfo `json:"track"`
+}
+
+type TrackInfo struct {
+	Name string `json:"name"`
+	MBID string `json:"mbid"`
+	URL  string `json:"url"`
+	// Duration is in milliseconds (sent as a string); 0 when unknown.
+	Duration  json.Number `json:"duration"`
+	Listeners string      `json:"listeners"`
+	PlayCount string      `json:"playcount"`
+	Artist    struct {
+		Name string `json:"name"`
+		MBID string `json:"mbid"`
+		URL  string `json:"url"`
+	} `json:"artist"`
+	Album struct {
+		Artist string `json:"artist"`
+		Title  string `json:"title"`
+		MBID   string `json:"mbid"`
+		URL    string `json:"url"`
+	} `json:"album"`
+	TopTags TagList `json:"toptags"`
+	Wiki    Wiki    `json:"wiki"`
+}
+
+// Length is the track's duration, 0 if unknown.
+func (t TrackInfo) Length() time.Duration {
+	n, _ := t.Duration.Int64()
+	return time.Duration(n) * time.Millisecond
+}
+
+func (c *Client) GetTrackInfo(ctx context.Context, artist, track string) (TrackInfo, error) {
+	q := url.Values{}
+	q.Set("method", "track.getInfo")
+	q.Set("artist", artist)
+	q.Set("track", track)
+	q.Set("autocorrect", "1")
+
+	var r TrackInfoResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return TrackInfo{}, err
+	}
+	return r.Track, nil
+}
+
+func atoi64(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
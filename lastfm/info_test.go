@@ -0,0 +1,52 @@
+package lastfm
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestInfoDecodesLastfmQuirks(t *testing.T) {
+	// A one-track album: tracks and tags come as lone objects; the track
+	// duration is a number of seconds.
+	var album AlbumInfoResponse
+	if err := json.Unmarshal([]byte(`{"album":{"name":"Windowlicker","artist":"Aphex Twin","listeners":"301223","playcount":"2101334",
+		"tracks":{"track":{"name":"Windowlicker","duration":367,"@attr":{"rank":1}}},
+		"tags":{"tag":{"name":"idm","url":"https://www.last.fm/tag/idm"}},
+		"wiki":{"published":"01 Jan 2010, 00:00","summary":"A single.","content":"A single."}}}`), &album); err != nil {
+		t.Fatal(err)
+	}
+	a := album.Album
+	if len(a.Tracks.Track) != 1 || a.Tracks.Track[0].Length() != 367*time.Second || len(a.Tags) != 1 || a.Tags[0].Name != "idm" || a.Wiki.Summary != "A single." {
+		t.Fatalf("album = %+v", a)
+	}
+
+	// No tags is "", and the duration is a string of milliseconds.
+	var track TrackInfoResponse
+	if err := json.Unmarshal([]byte(`{"track":{"name":"Roygbiv","duration":"151000","listeners":"801334",
+		"artist":{"name":"Boards of Canada"},"album":{"artist":"Boards of Canada","title":"Music Has the Right to Children"},"toptags":""}}`), &track); err != nil {
+		t.Fatal(err)
+	}
+	if tr := track.Track; tr.Length() != 151*time.Second || tr.TopTags != nil || tr.Album.Title != "Music Has the Right to Children" {
+		t.Fatalf("track = %+v", tr)
+	}
+
+	// Info survives a round trip through JSON, as in the response cache.
+	var artist ArtistInfoResponse
+	if err := json.Unmarshal([]byte(`{"artist":{"name":"Burial","stats":{"listeners":"702334","playcount":"40100000"},
+		"similar":{"artist":[{"name":"Kode9","url":"https://www.last.fm/music/Kode9"}]},
+		"tags":{"tag":[{"name":"dubstep"},{"name":"electronic"}]},"bio":{"summary":"South London."}}}`), &artist); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(artist.Artist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again ArtistInfo
+	if err := json.Unmarshal(b, &again); err != nil {
+		t.Fatal(err)
+	}
+	if again.Listeners() != 702334 || len(again.Tags) != 2 || len(again.Similar.Artist) != 1 || again.Bio.Summary != "South London." {
+		t.Fatalf("artist after round trip = %+v", again)
+	}
+}
@@ -0,0 +1,78 @@
+package lastfm
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Middleware wraps the transport every request goes through, to add
+// logging, metrics, caching or recording without touching the client.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to http.RoundTripper, for writing
+// Middleware.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// WithMiddleware wraps the client's transport in mw, the first outermost.
+// It is applied after all other options, so it wraps the transport set by
+// WithHTTPClient or WithProxy whatever the order. Every attempt of a
+// retried call passes through it.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(c *Client) error {
+		c.middleware = append(c.middleware, mw...)
+		return nil
+	}
+}
+
+// wrapTransport installs the traffic meter and c.middleware around it on
+// a copy of c.http.
+func (c *Client) wrapTransport() {
+	rt := c.http.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	c.meter.next = rt
+	rt = &c.meter
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		rt = c.middleware[i](rt)
+	}
+	c.setTransport(rt)
+}
+
+// Trace logs each request's method, URL (credentials redacted), status and
+// duration through logf.
+func Trace(logf func(format string, args ...any)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(r)
+			took := time.Since(start).Round(time.Millisecond)
+			if err != nil {
+				logf("lastfm: %s %s: %v (%s)", r.Method, redactURL(r.URL), err, took)
+				return resp, err
+			}
+			logf("lastfm: %s %s: %d (%s)", r.Method, redactURL(r.URL), resp.StatusCode, took)
+			return resp, err
+		})
+	}
+}
+
+// redactedParams are query parameters Trace never prints.
+var redactedParams = []string{"api_key", "api_sig", "sk", "token"}
+
+func redactURL(u *url.URL) string {
+	q := u.Query()
+	for _, k := range redactedParams {
+		if q.Has(k) {
+			q.Set(k, "REDACTED")
+		}
+	}
+	v := *u
+	v.RawQuery = q.Encode()
+	return v.String()
+}
@@ -0,0 +1,46 @@
+package lastfm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareOrderAndTrace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"artists":{"artist":[]}}`)
+	}))
+	defer srv.Close()
+
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(r)
+			})
+		}
+	}
+	var traced []string
+	logf := func(format string, args ...any) { traced = append(traced, fmt.Sprintf(format, args...)) }
+
+	// WithHTTPClient after WithMiddleware still ends up wrapped.
+	c, err := New("secret-key", WithBaseURL(srv.URL), WithRateLimit(0),
+		WithMiddleware(mark("outer"), mark("inner")), WithMiddleware(Trace(logf)), WithHTTPClient(&http.Client{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetChartTopArtists(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(order, ",") != "outer,inner" {
+		t.Fatalf("order = %v", order)
+	}
+	if len(traced) != 1 || !strings.Contains(traced[0], "GET ") || !strings.Contains(traced[0], "method=chart.getTopArtists") ||
+		!strings.Contains(traced[0], "api_key=REDACTED") || strings.Contains(traced[0], "secret-key") || !strings.Contains(traced[0], ": 200 (") {
+		t.Fatalf("trace = %q", traced)
+	}
+}
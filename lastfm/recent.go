@@ -0,0 +1,224 @@
+package lastfm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"strconv"
+)
+
+const (
+	// DefaultRecentTracksLimit is Last.fm's documented maximum page size
+	// for user.getRecentTracks.
+	DefaultRecentTracksLimit = 200
+	// MaxRecentTracksLimit is the largest page size it accepts in practice.
+	MaxRecentTracksLimit = 1000
+)
+
+type RecentTracksOptions struct {
+	// Limit is the number of tracks per page (default
+	// DefaultRecentTracksLimit, at most MaxRecentTracksLimit). Above the
+	// default, RecentTrackPages shrinks pages as it goes: halving them
+	// after a failed page, or to the size the API capped them at.
+	Limit int
+	// StartPage is the first page to fetch, counted in pages of Limit
+	// tracks (default 1).
+	StartPage int
+	// KeepRaw sets Page.Raw, e.g. to archive pages verbatim.
+	KeepRaw bool
+}
+
+// RecentTrackPages walks the user's recent tracks page by page, newest first.
+// Requests go through the client's rate limit and retry policy. Iteration
+// ends after the last page, on the first error (yielded once), or when the
+// caller stops ranging. Each page's Page and PerPage say where it is, also
+// after the page size shrank.
+func (c *Client) RecentTrackPages(ctx context.Context, opt RecentTracksOptions) iter.Seq2[Page, error] {
+	limit := opt.Limit
+	if limit <= 0 {
+		limit = DefaultRecentTracksLimit
+	}
+	limit = min(limit, MaxRecentTracksLimit)
+	page := max(opt.StartPage, 1)
+
+	return func(yield func(Page, error) bool) {
+		for {
+			p, err := c.recentTracksPage(ctx, "", page, limit, 0, 0, opt.KeepRaw)
+			if err != nil {
+				if limit > DefaultRecentTracksLimit && shrinkOn(ctx, err) {
+					smaller := max(limit/2, DefaultRecentTracksLimit)
+					page, limit = RepaginateRecentTracks(page, limit, smaller), smaller
+					continue
+				}
+				yield(Page{}, fmt.Errorf("page %d: %w", page, err))
+				return
+			}
+			if p.PerPage <= 0 {
+				p.PerPage = limit
+			}
+			if p.PerPage < limit {
+				// The API capped the page size, so page numbers count its
+				// pages; past the first, this one isn't where we meant.
+				page, limit = RepaginateRecentTracks(page, limit, p.PerPage), p.PerPage
+				if page > 1 {
+					continue
+				}
+			}
+			p.Page = page
+			if len(p.Tracks) == 0 {
+				return
+			}
+			if !yield(p, nil) {
+				return
+			}
+			if p.TotalPages > 0 && page >= p.TotalPages {
+				return
+			}
+			page++
+		}
+	}
+}
+
+// RecentTrackPagesBefore walks the user's scrobbles played before to (0:
+// all of them), newest first, by time rather than page number: every
+// request is for the first page before the oldest scrobble so far, so
+// scrobbles arriving meanwhile can't shift pages under it. A page's Next
+// is the to to resume after it with, never 0. Pages overlap by the oldest
+// second of the one before; more than a page played in one second (such
+// as Last.fm's placeholder 0) is paged through by page number. opt.StartPage
+// is unused; Limit shrinks as in RecentTrackPages.
+func (c *Client) RecentTrackPagesBefore(ctx context.Context, opt RecentTracksOptions, to int64) iter.Seq2[Page, error] {
+	limit := opt.Limit
+	if limit <= 0 {
+		limit = DefaultRecentTracksLimit
+	}
+	limit = min(limit, MaxRecentTracksLimit)
+
+	return func(yield func(Page, error) bool) {
+		// Past page 1, the pages are those of the second to-1 only.
+		page := 1
+		for {
+			var from int64
+			if page > 1 {
+				from = to - 1
+			}
+			p, err := c.recentTracksPage(ctx, "", page, limit, from, to, opt.KeepRaw)
+			if err != nil {
+				if limit > DefaultRecentTracksLimit && shrinkOn(ctx, err) {
+					smaller := max(limit/2, DefaultRecentTracksLimit)
+					page, limit = RepaginateRecentTracks(page, limit, smaller), smaller
+					continue
+				}
+				yield(Page{}, fmt.Errorf("before %d: %w", to, err))
+				return
+			}
+			if p.PerPage > 0 && p.PerPage < limit {
+				page, limit = RepaginateRecentTracks(page, limit, p.PerPage), p.PerPage
+				if page > 1 {
+					continue
+				}
+			}
+			p.PerPage = limit
+
+			var oldest, newest int64
+			dated := 0
+			for _, t := range p.Tracks {
+				if t.Date == nil {
+					continue // now playing
+				}
+				uts, err := strconv.ParseInt(t.Date.UTS, 10, 64)
+				if err != nil {
+					continue
+				}
+				if dated == 0 || uts < oldest {
+					oldest = uts
+				}
+				if dated == 0 || uts > newest {
+					newest = uts
+				}
+				dated++
+			}
+
+			if page > 1 {
+				// Paging through the second to-1; once it's done, go on
+				// before it (unless it is 0: nothing is older).
+				second := to - 1
+				done := dated < limit
+				p.Next = to
+				if done && second > 0 {
+					p.Next = second
+				}
+				if dated > 0 && !yield(p, nil) {
+					return
+				}
+				if !done {
+					page++
+					continue
+				}
+				if second <= 0 {
+					return
+				}
+				page, to = 1, second
+				continue
+			}
+
+			if dated == 0 {
+				return
+			}
+			if dated >= limit && oldest == newest {
+				// A full page in one second: there may be more of it than
+				// to-(oldest+1) can reach, so page through it.
+				to = oldest + 1
+				p.Next = to
+				if !yield(p, nil) {
+					return
+				}
+				page = 2
+				continue
+			}
+			// to keeps scrobbles before it, so oldest+1 also gets those
+			// played in the same second that didn't fit on this page.
+			p.Next = oldest + 1
+			if to != 0 && p.Next >= to && oldest > 0 {
+				p.Next = oldest
+			}
+			if !yield(p, nil) {
+				return
+			}
+			if dated < limit {
+				return
+			}
+			to = p.Next
+		}
+	}
+}
+
+// RepaginateRecentTracks converts page, counted in pages of from tracks,
+// to the page of to tracks that holds its first track.
+func RepaginateRecentTracks(page, from, to int) int {
+	return (page-1)*from/to + 1
+}
+
+// shrinkOn reports whether a failed page is worth asking for again in a
+// smaller size: not if ctx is done or the request can't succeed anyway.
+func shrinkOn(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !errors.Is(err, ErrAuth) && !errors.Is(err, ErrUserNotFound)
+}
+
+// RecentTracks is RecentTrackPages flattened to individual tracks.
+func (c *Client) RecentTracks(ctx context.Context, opt RecentTracksOptions) iter.Seq2[Track, error] {
+	return func(yield func(Track, error) bool) {
+		for p, err := range c.RecentTrackPages(ctx, opt) {
+			if err != nil {
+				yield(Track{}, err)
+				return
+			}
+			for _, t := range p.Tracks {
+				if !yield(t, nil) {
+					return
+				}
+			}
+		}
+	}
+}
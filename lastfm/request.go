@@ -0,0 +1,174 @@
+package lastfm
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (c *Client) doGet(ctx context.Context, q url.Values, out any) error {
+	if c == nil || c.apiKey == "" {
+		return ErrMissingAPIKey
+	}
+	u := c.endpoint(q)
+	_, err := retry(ctx, c.retry, func() (http.Header, error) {
+		return c.get(ctx, u, out)
+	})
+	return err
+}
+
+func (c *Client) endpoint(q url.Values) string {
+	q.Set("api_key", c.apiKey)
+	q.Set("format", "json")
+	u := *c.baseURL
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// doPost makes a signed request on behalf of the session user.
+func (c *Client) doPost(ctx context.Context, q url.Values, out any) error {
+	if c == nil || c.apiKey == "" {
+		return ErrMissingAPIKey
+	}
+	if c.secret == "" || c.sessionKey == "" {
+		return ErrMissingSession
+	}
+	q.Set("api_key", c.apiKey)
+	q.Set("sk", c.sessionKey)
+	q.Set("api_sig", c.sign(q))
+	q.Set("format", "json")
+	body := q.Encode()
+	_, err := retry(ctx, c.retry, func() (http.Header, error) {
+		return c.send(ctx, out, func() (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL.String(), strings.NewReader(body))
+			if err == nil {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			return req, err
+		})
+	})
+	return err
+}
+
+// sign computes api_sig: the md5 of every parameter except format and
+// callback, as name+value sorted by name, followed by the shared secret.
+func (c *Client) sign(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		if k != "format" && k != "callback" && k != "api_sig" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	h := md5.New()
+	for _, k := range keys {
+		io.WriteString(h, k)
+		io.WriteString(h, q.Get(k))
+	}
+	io.WriteString(h, c.secret)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *Client) get(ctx context.Context, u string, out any) (http.Header, error) {
+	return c.send(ctx, out, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	})
+}
+
+// send makes one request built by newReq and decodes the response into out.
+func (c *Client) send(ctx context.Context, out any, newReq func() (*http.Request, error)) (http.Header, error) {
+	if err := c.throttle(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := newReq()
+	if err != nil {
+		return nil, err
+	}
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// A body read to the end lets the connection be reused; a streamed
+	// decode can stop short of it.
+	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+	}()
+
+	if sd, ok := out.(streamDecoder); ok && resp.StatusCode == http.StatusOK {
+		return resp.Header, sd.decodeStream(resp.Body)
+	}
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Last.fm reports API-level failures in the body, usually with a 200
+	// but sometimes with a 4xx; 5xx bodies are left to HTTPError so they
+	// are retried.
+	var env struct {
+		Error   int    `json:"error"`
+		Message string `json:"message"`
+	}
+	if resp.StatusCode < 500 && json.Unmarshal(b, &env) == nil && env.Error != 0 {
+		return resp.Header, APIError{Code: env.Error, Message: env.Message}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.Header, HTTPError{StatusCode: resp.StatusCode, Body: string(b)}
+	}
+
+	if err := json.Unmarshal(b, out); err != nil {
+		return resp.Header, fmt.Errorf("decode lastfm response: %w", err)
+	}
+	return resp.Header, nil
+}
+
+// Ping makes one cheap authenticated call (no retries) to check the API key
+// and returns the server's clock from the Date header (zero if absent).
+func (c *Client) Ping(ctx context.Context) (time.Time, error) {
+	if c == nil || c.apiKey == "" {
+		return time.Time{}, ErrMissingAPIKey
+	}
+	q := url.Values{}
+	q.Set("method", "chart.getTopArtists")
+	q.Set("limit", "1")
+
+	var discard json.RawMessage
+	h, err := c.get(ctx, c.endpoint(q), &discard)
+	if err != nil {
+		return time.Time{}, err
+	}
+	serverTime, _ := http.ParseTime(h.Get("Date"))
+	return serverTime, nil
+}
+
+// throttle reserves the next request slot and waits for it.
+func (c *Client) throttle(ctx context.Context) error {
+	if c.interval <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	now := time.Now()
+	slot := c.nextSlot
+	if slot.Before(now) {
+		slot = now
+	}
+	c.nextSlot = slot.Add(c.interval)
+	c.mu.Unlock()
+
+	return sleep(ctx, time.Until(slot))
+}
@@ -0,0 +1,76 @@
+package lastfm
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// IsRetryable reports whether err is worth retrying: rate limiting (API
+// error 29, sometimes HTTP 429) or a transient upstream failure.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUnavailable)
+}
+
+// RetryPolicy controls how retryable failures (see IsRetryable) are retried
+// with exponential backoff.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// OnRetry, if set, is called before sleeping ahead of the next attempt.
+	OnRetry func(attempt, maxAttempts int, err error)
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    8,
+		InitialBackoff: 1 * time.Second,
+		MaxBackoff:     32 * time.Second,
+	}
+}
+
+func retry[T any](ctx context.Context, p RetryPolicy, fn func() (T, error)) (T, error) {
+	backoff := p.InitialBackoff
+
+	var zero T
+	for attempt := 1; ; attempt++ {
+		v, err := fn()
+		if err == nil {
+			return v, nil
+		}
+		if !IsRetryable(err) || attempt >= p.MaxAttempts {
+			return zero, err
+		}
+		// A retry that can't start before ctx's deadline fails the same
+		// way; give up now with the error that would be retried.
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return zero, err
+		}
+
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, p.MaxAttempts, err)
+		}
+		if err := sleep(ctx, backoff); err != nil {
+			return zero, err
+		}
+		if backoff < p.MaxBackoff {
+			backoff = min(backoff*2, p.MaxBackoff)
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,63 @@
+package lastfm
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ScrobbleBatchSize is the most scrobbles track.scrobble takes per request.
+const ScrobbleBatchSize = 50
+
+// ScrobbleMaxAge is how far back Last.fm accepts scrobbles; older ones are
+// ignored by the server.
+const ScrobbleMaxAge = 14 * 24 * time.Hour
+
+// Scrobble is a play to submit with track.scrobble.
+type Scrobble struct {
+	Artist    string
+	Track     string
+	Album     string
+	Timestamp time.Time
+}
+
+// ScrobbleResult totals what Last.fm accepted and ignored (duplicates,
+// timestamps too old, filtered spam).
+type ScrobbleResult struct {
+	Accepted int
+	Ignored  int
+}
+
+// SubmitScrobbles sends plays for the session user (see WithSessionKey), in
+// batches of ScrobbleBatchSize.
+func (c *Client) SubmitScrobbles(ctx context.Context, plays []Scrobble) (ScrobbleResult, error) {
+	var total ScrobbleResult
+	for start := 0; start < len(plays); start += ScrobbleBatchSize {
+		batch := plays[start:min(start+ScrobbleBatchSize, len(plays))]
+		q := url.Values{"method": {"track.scrobble"}}
+		for i, p := range batch {
+			n := "[" + strconv.Itoa(i) + "]"
+			q.Set("artist"+n, p.Artist)
+			q.Set("track"+n, p.Track)
+			q.Set("timestamp"+n, strconv.FormatInt(p.Timestamp.Unix(), 10))
+			if p.Album != "" {
+				q.Set("album"+n, p.Album)
+			}
+		}
+		var r struct {
+			Scrobbles struct {
+				Attr struct {
+					Accepted int `json:"accepted"`
+					Ignored  int `json:"ignored"`
+				} `json:"@attr"`
+			} `json:"scrobbles"`
+		}
+		if err := c.doPost(ctx, q, &r); err != nil {
+			return total, err
+		}
+		total.Accepted += r.Scrobbles.Attr.Accepted
+		total.Ignored += r.Scrobbles.Attr.Ignored
+	}
+	return total, nil
+}
@@ -0,0 +1,42 @@
+package lastfm
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+)
+
+type SimilarTracksResponse struct {
+	SimilarTracks struct {
+		Track List[SimilarTrack] `json:"track"`
+	} `json:"similartracks"`
+}
+
+type SimilarTrack struct {
+	Name string `json:"name"`
+	// Match is a number here, unlike artist.getSimilar's string.
+	Match  json.Number `json:"match"`
+	URL    string      `json:"url"`
+	MBID   string      `json:"mbid"`
+	Artist struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+		MBID string `json:"mbid"`
+	} `json:"artist"`
+}
+
+func (c *Client) GetSimilarTracks(ctx context.Context, artist, track string, limit int) ([]SimilarTrack, error) {
+	q := url.Values{}
+	q.Set("method", "track.getSimilar")
+	q.Set("artist", artist)
+	q.Set("track", track)
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("autocorrect", "1")
+
+	var r SimilarTracksResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.SimilarTracks.Track, nil
+}
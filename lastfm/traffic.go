@@ -0,0 +1,94 @@
+package lastfm
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// Traffic counts what a Client downloaded: requests that went out to the
+// network (not those a Cache or Replay answered), the response bytes read
+// off the wire, and those bytes once gunzipped.
+type Traffic struct {
+	Requests  int64
+	WireBytes int64
+	Bytes     int64
+}
+
+// Traffic returns what c has downloaded so far.
+func (c *Client) Traffic() Traffic {
+	return Traffic{
+		Requests:  c.meter.requests.Load(),
+		WireBytes: c.meter.wire.Load(),
+		Bytes:     c.meter.decoded.Load(),
+	}
+}
+
+// meter is the innermost transport: it asks for gzip, counts responses
+// and decompresses them, so middleware sees plain bodies as it would with
+// net/http's own transparent gzip.
+type meter struct {
+	next     http.RoundTripper
+	requests atomic.Int64
+	wire     atomic.Int64
+	decoded  atomic.Int64
+}
+
+func (m *meter) RoundTrip(r *http.Request) (*http.Response, error) {
+	gz := r.Header.Get("Accept-Encoding") == "" && r.Header.Get("Range") == ""
+	if gz {
+		r = r.Clone(r.Context())
+		r.Header.Set("Accept-Encoding", "gzip")
+	}
+	resp, err := m.next.RoundTrip(r)
+	if err != nil {
+		return resp, err
+	}
+	m.requests.Add(1)
+	var body io.ReadCloser = &countedBody{ReadCloser: resp.Body, n: &m.wire}
+	if gz && strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		body = &gzipBody{body: body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	resp.Body = &countedBody{ReadCloser: body, n: &m.decoded}
+	return resp, nil
+}
+
+// countedBody adds the bytes read through it to n.
+type countedBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b *countedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// gzipBody gunzips body, starting on the first Read so an empty body
+// (e.g. a 304) isn't an error until it is read.
+type gzipBody struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+	err  error
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.zr == nil && b.err == nil {
+		b.zr, b.err = gzip.NewReader(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.zr.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,51 @@
+package lastfm
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipAndTraffic(t *testing.T) {
+	body := `{"artists":{"artist":[` + strings.Repeat(`{"name":"Burial","playcount":"1","listeners":"1"},`, 199) +
+		`{"name":"Burial","playcount":"1","listeners":"1"}]}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("Accept-Encoding = %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		fmt.Fprint(zw, body)
+		zw.Close()
+	}))
+	defer srv.Close()
+
+	// Middleware sees the body already gunzipped.
+	plain := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(r)
+			if err == nil && resp.Header.Get("Content-Encoding") != "" {
+				t.Errorf("middleware got Content-Encoding %q", resp.Header.Get("Content-Encoding"))
+			}
+			return resp, err
+		})
+	}
+	c, err := New("key", WithBaseURL(srv.URL), WithRateLimit(0), WithMiddleware(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		artists, err := c.GetChartTopArtists(context.Background(), 200)
+		if err != nil || len(artists) != 200 {
+			t.Fatalf("artists = %d, %v", len(artists), err)
+		}
+	}
+	tr := c.Traffic()
+	if tr.Requests != 2 || tr.Bytes != int64(2*len(body)) || tr.WireBytes <= 0 || tr.WireBytes >= tr.Bytes/10 {
+		t.Fatalf("traffic = %+v, body %d bytes", tr, len(body))
+	}
+}
@@ -0,0 +1,72 @@
+package lastfm
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportOptions tune the connections a Client makes. Zero fields keep
+// http.DefaultTransport's settings.
+type TransportOptions struct {
+	// MaxIdleConnsPerHost is how many keep-alive connections to the API
+	// are kept open between requests (net/http keeps 2).
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	DialTimeout         time.Duration
+	TLSHandshakeTimeout time.Duration
+	// TLSConfig replaces the default TLS settings, e.g. for a private CA.
+	TLSConfig *tls.Config
+	// DisableHTTP2 speaks HTTP/1.1 only, for proxies that mishandle h2.
+	DisableHTTP2 bool
+}
+
+// WithTransport tunes the client's transport. All requests of a Client
+// share it, and so its keep-alive connections. Like WithProxy, it modifies
+// the client set by WithHTTPClient, so apply it after that; it and
+// WithProxy combine in either order.
+func WithTransport(o TransportOptions) Option {
+	return func(c *Client) error {
+		t := c.transport()
+		if o.MaxIdleConnsPerHost > 0 {
+			t.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+			t.MaxIdleConns = max(t.MaxIdleConns, o.MaxIdleConnsPerHost)
+		}
+		if o.IdleConnTimeout > 0 {
+			t.IdleConnTimeout = o.IdleConnTimeout
+		}
+		if o.DialTimeout > 0 {
+			t.DialContext = (&net.Dialer{Timeout: o.DialTimeout, KeepAlive: 30 * time.Second}).DialContext
+		}
+		if o.TLSHandshakeTimeout > 0 {
+			t.TLSHandshakeTimeout = o.TLSHandshakeTimeout
+		}
+		if o.TLSConfig != nil {
+			t.TLSClientConfig = o.TLSConfig.Clone()
+		}
+		if o.DisableHTTP2 {
+			t.Protocols = new(http.Protocols)
+			t.Protocols.SetHTTP1(true)
+		}
+		c.setTransport(t)
+		return nil
+	}
+}
+
+// transport returns a copy of the client's *http.Transport to modify, or
+// of http.DefaultTransport if it uses another RoundTripper.
+func (c *Client) transport() *http.Transport {
+	if t, ok := c.http.Transport.(*http.Transport); ok {
+		return t.Clone()
+	}
+	return http.DefaultTransport.(*http.Transport).Clone()
+}
+
+// setTransport installs t on a copy of c.http, leaving a client passed to
+// WithHTTPClient as it was.
+func (c *Client) setTransport(t http.RoundTripper) {
+	hc := *c.http
+	hc.Transport = t
+	c.http = &hc
+}
@@ -0,0 +1,67 @@
+package lastfm
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestsReuseOneConnection(t *testing.T) {
+	body, err := os.ReadFile("testdata/recenttracks_quirks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Trailing bytes the streamed decode never reads.
+	body = append(body, bytes.Repeat([]byte(" "), 48<<10)...)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	var conns atomic.Int32
+	srv.Config.ConnState = func(_ net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	c, err := New("key", WithBaseURL(srv.URL), WithUsername("testuser"), WithRateLimit(0),
+		WithTransport(TransportOptions{MaxIdleConnsPerHost: 4, DialTimeout: 5 * time.Second}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if _, err := c.GetRecentTracksPage(context.Background(), 1, 200); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Fatalf("%d connections for 3 requests, want 1", n)
+	}
+}
+
+func TestTransportOptionsCombineWithProxy(t *testing.T) {
+	c, err := New("key",
+		WithTransport(TransportOptions{MaxIdleConnsPerHost: 8, IdleConnTimeout: time.Minute, DisableHTTP2: true}),
+		WithProxy("http://proxy.example:3128"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := c.meter.next.(*http.Transport)
+	if tr.MaxIdleConnsPerHost != 8 || tr.IdleConnTimeout != time.Minute || tr.Protocols.HTTP2() || !tr.Protocols.HTTP1() {
+		t.Fatalf("transport = %+v", tr)
+	}
+	req, _ := http.NewRequest(http.MethodGet, DefaultBaseURL, nil)
+	if u, err := tr.Proxy(req); err != nil || u.Host != "proxy.example:3128" {
+		t.Fatalf("proxy = %v, %v", u, err)
+	}
+	if http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost == 8 {
+		t.Fatal("http.DefaultTransport was modified")
+	}
+}
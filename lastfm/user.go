@@ -0,0 +1,217 @@
+package lastfm
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// Periods for the GetUserTop* methods.
+const (
+	PeriodOverall = "overall"
+	Period7Day    = "7day"
+	Period1Month  = "1month"
+	Period3Month  = "3month"
+	Period6Month  = "6month"
+	Period12Month = "12month"
+)
+
+type FriendsResponse struct {
+	Friends struct {
+		User List[Friend] `json:"user"`
+	} `json:"friends"`
+}
+
+type Friend struct {
+	Name     string `json:"name"`
+	RealName string `json:"realname"`
+	URL      string `json:"url"`
+}
+
+type UserTopArtistsResponse struct {
+	TopArtists struct {
+		Artist List[UserTopArtist] `json:"artist"`
+	} `json:"topartists"`
+}
+
+type UserTopArtist struct {
+	Name      string `json:"name"`
+	PlayCount string `json:"playcount"`
+	URL       string `json:"url"`
+	MBID      string `json:"mbid"`
+}
+
+type UserTopTracksResponse struct {
+	TopTracks struct {
+		Track List[UserTopTrack] `json:"track"`
+	} `json:"toptracks"`
+}
+
+type UserTopTrack struct {
+	Name      string `json:"name"`
+	PlayCount string `json:"playcount"`
+	URL       string `json:"url"`
+	MBID      string `json:"mbid"`
+	Artist    struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+		MBID string `json:"mbid"`
+	} `json:"artist"`
+}
+
+type UserTopAlbumsResponse struct {
+	TopAlbums struct {
+		Album List[UserTopAlbum] `json:"album"`
+	} `json:"topalbums"`
+}
+
+type UserTopAlbum struct {
+	Name      string `json:"name"`
+	PlayCount string `json:"playcount"`
+	URL       string `json:"url"`
+	MBID      string `json:"mbid"`
+	Artist    struct {
+		Name string `json:"name"`
+		URL  string `json:"url"`
+		MBID string `json:"mbid"`
+	} `json:"artist"`
+}
+
+type LovedTracksResponse struct {
+	LovedTracks struct {
+		Track List[LovedTrack] `json:"track"`
+		Attr  PageAttr         `json:"@attr"`
+	} `json:"lovedtracks"`
+}
+
+type LovedTrack struct {
+	Name   string `json:"name"`
+	MBID   string `json:"mbid"`
+	URL    string `json:"url"`
+	Date   *Date  `json:"date,omitempty"`
+	Artist struct {
+		Name string `json:"name"`
+		MBID string `json:"mbid"`
+		URL  string `json:"url"`
+	} `json:"artist"`
+}
+
+// GetFriends lists a user's friends; user "" means the configured user.
+func (c *Client) GetFriends(ctx context.Context, user string, limit int) ([]Friend, error) {
+	user, err := c.user(user)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	q.Set("method", "user.getFriends")
+	q.Set("user", user)
+	q.Set("limit", strconv.Itoa(limit))
+
+	var r FriendsResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.Friends.User, nil
+}
+
+// GetUserRecentTracks returns a user's latest limit tracks, newest first,
+// led by the one playing now if any; user "" means the configured user.
+// RecentTracks walks the configured user's whole history instead.
+func (c *Client) GetUserRecentTracks(ctx context.Context, user string, limit int) ([]Track, error) {
+	p, err := c.recentTracksPage(ctx, user, 1, limit, 0, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	return p.Tracks, nil
+}
+
+// GetUserTopArtists returns a user's most played artists over period
+// (one of the Period constants); user "" means the configured user.
+func (c *Client) GetUserTopArtists(ctx context.Context, user, period string, limit int) ([]UserTopArtist, error) {
+	user, err := c.user(user)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	q.Set("method", "user.getTopArtists")
+	q.Set("user", user)
+	q.Set("period", period)
+	q.Set("limit", strconv.Itoa(limit))
+
+	var r UserTopArtistsResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.TopArtists.Artist, nil
+}
+
+// GetUserTopTracks returns a user's most played tracks over period; user ""
+// means the configured user.
+func (c *Client) GetUserTopTracks(ctx context.Context, user, period string, limit int) ([]UserTopTrack, error) {
+	user, err := c.user(user)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	q.Set("method", "user.getTopTracks")
+	q.Set("user", user)
+	q.Set("period", period)
+	q.Set("limit", strconv.Itoa(limit))
+
+	var r UserTopTracksResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.TopTracks.Track, nil
+}
+
+// GetUserTopAlbums returns a user's most played albums over period; user ""
+// means the configured user.
+func (c *Client) GetUserTopAlbums(ctx context.Context, user, period string, limit int) ([]UserTopAlbum, error) {
+	user, err := c.user(user)
+	if err != nil {
+		return nil, err
+	}
+	q := url.Values{}
+	q.Set("method", "user.getTopAlbums")
+	q.Set("user", user)
+	q.Set("period", period)
+	q.Set("limit", strconv.Itoa(limit))
+
+	var r UserTopAlbumsResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, err
+	}
+	return r.TopAlbums.Album, nil
+}
+
+// GetLovedTracks returns a page (from 1) of a user's loved tracks, newest
+// first, and how many pages there are; user "" means the configured user.
+func (c *Client) GetLovedTracks(ctx context.Context, user string, page, limit int) ([]LovedTrack, int, error) {
+	user, err := c.user(user)
+	if err != nil {
+		return nil, 0, err
+	}
+	q := url.Values{}
+	q.Set("method", "user.getLovedTracks")
+	q.Set("user", user)
+	q.Set("page", strconv.Itoa(page))
+	q.Set("limit", strconv.Itoa(limit))
+
+	var r LovedTracksResponse
+	if err := c.doGet(ctx, q, &r); err != nil {
+		return nil, 0, err
+	}
+	pages, _ := strconv.Atoi(r.LovedTracks.Attr.TotalPages)
+	return r.LovedTracks.Track, pages, nil
+}
+
+func (c *Client) user(user string) (string, error) {
+	if user == "" {
+		user = c.username
+	}
+	if user == "" {
+		return "", ErrMissingUsername
+	}
+	return user, nil
+}
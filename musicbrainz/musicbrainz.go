@@ -0,0 +1,208 @@
+// Package musicbrainz is a small client for the MusicBrainz web service, used
+// to look up the artists and releases stored scrobbles name by MBID.
+package musicbrainz
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBaseURL   = "https://musicbrainz.org/ws/2/"
+	DefaultRateLimit = time.Second // MusicBrainz allows one request per second
+)
+
+// ErrNotFound is returned for an MBID MusicBrainz doesn't know (or no longer
+// does, after a merge).
+var ErrNotFound = errors.New("musicbrainz: not found")
+
+// Client calls the MusicBrainz API. Construct it with New; the zero value is
+// not usable. A Client is safe for concurrent use and spaces out requests
+// according to its rate limit.
+type Client struct {
+	userAgent string
+	baseURL   *url.URL
+	http      *http.Client
+	interval  time.Duration
+
+	mu       sync.Mutex
+	nextSlot time.Time
+}
+
+type Option func(*Client) error
+
+// New returns a client sending userAgent, which MusicBrainz requires to name
+// the application and a way to contact whoever runs it.
+func New(userAgent string, opts ...Option) (*Client, error) {
+	if userAgent == "" {
+		return nil, errors.New("musicbrainz: missing user agent")
+	}
+	base, _ := url.Parse(DefaultBaseURL)
+	c := &Client{
+		userAgent: userAgent,
+		baseURL:   base,
+		http:      &http.Client{Timeout: 30 * time.Second},
+		interval:  DefaultRateLimit,
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) error {
+		if hc == nil {
+			return errors.New("musicbrainz: nil http client")
+		}
+		c.http = hc
+		return nil
+	}
+}
+
+// WithBaseURL points the client at another API root, e.g. a test server or
+// a mirror.
+func WithBaseURL(raw string) Option {
+	return func(c *Client) error {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("musicbrainz: invalid base url: %w", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("musicbrainz: invalid base url: %q", raw)
+		}
+		c.baseURL = u
+		return nil
+	}
+}
+
+// WithRateLimit sets the minimum spacing between requests (0 disables it).
+func WithRateLimit(every time.Duration) Option {
+	return func(c *Client) error {
+		if every < 0 {
+			return fmt.Errorf("musicbrainz: negative rate limit: %s", every)
+		}
+		c.interval = every
+		return nil
+	}
+}
+
+type Artist struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Country is an ISO 3166-1 code, e.g. "GB"; "" if MusicBrainz has none.
+	Country string `json:"country"`
+}
+
+type Release struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Date is this edition's release date (YYYY, YYYY-MM or YYYY-MM-DD).
+	Date         string       `json:"date"`
+	ReleaseGroup ReleaseGroup `json:"release-group"`
+}
+
+// ReleaseGroup is every edition of an album, reissues included.
+type ReleaseGroup struct {
+	ID               string   `json:"id"`
+	FirstReleaseDate string   `json:"first-release-date"`
+	PrimaryType      string   `json:"primary-type"`
+	SecondaryTypes   []string `json:"secondary-types"`
+}
+
+// Year is when the release first came out: its release group's first date,
+// so a reissue counts as the original, else its own. 0 if neither is known.
+func (r Release) Year() int {
+	for _, d := range []string{r.ReleaseGroup.FirstReleaseDate, r.Date} {
+		if len(d) >= 4 {
+			if y, err := strconv.Atoi(d[:4]); err == nil && y > 0 {
+				return y
+			}
+		}
+	}
+	return 0
+}
+
+// Artist looks up an artist by MBID.
+func (c *Client) Artist(ctx context.Context, mbid string) (Artist, error) {
+	var a Artist
+	err := c.get(ctx, "artist/"+url.PathEscape(mbid), nil, &a)
+	return a, err
+}
+
+// Release looks up a release (an album edition, as Last.fm's album MBIDs
+// name) with its release group.
+func (c *Client) Release(ctx context.Context, mbid string) (Release, error) {
+	var r Release
+	err := c.get(ctx, "release/"+url.PathEscape(mbid), url.Values{"inc": {"release-groups"}}, &r)
+	return r, err
+}
+
+func (c *Client) get(ctx context.Context, path string, q url.Values, out any) error {
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+	if q == nil {
+		q = url.Values{}
+	}
+	q.Set("fmt", "json")
+	u := c.baseURL.JoinPath(path)
+	u.RawQuery = q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, path)
+	case resp.StatusCode != http.StatusOK:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("musicbrainz: %s: http %d: %s", path, resp.StatusCode, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("musicbrainz: %s: %w", path, err)
+	}
+	return nil
+}
+
+// wait blocks until the client's next request slot.
+func (c *Client) wait(ctx context.Context) error {
+	if c.interval <= 0 {
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	now := time.Now()
+	slot := c.nextSlot
+	if slot.Before(now) {
+		slot = now
+	}
+	c.nextSlot = slot.Add(c.interval)
+	c.mu.Unlock()
+
+	t := time.NewTimer(time.Until(slot))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
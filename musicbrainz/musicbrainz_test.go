@@ -0,0 +1,49 @@
+package musicbrainz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookups(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "test/1 (me@example.com)" || r.URL.Query().Get("fmt") != "json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/ws/2/artist/a1":
+			w.Write([]byte(`{"id":"a1","name":"Burial","country":"GB"}`))
+		case "/ws/2/release/r1":
+			if r.URL.Query().Get("inc") != "release-groups" {
+				http.Error(w, "no release group", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"id":"r1","title":"Untrue","date":"2017-11-03","release-group":{"id":"g1","first-release-date":"2007-11-05","primary-type":"Album","secondary-types":[]}}`))
+		default:
+			http.Error(w, `{"error":"Not Found"}`, http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New("test/1 (me@example.com)", WithBaseURL(srv.URL+"/ws/2/"), WithRateLimit(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	a, err := c.Artist(ctx, "a1")
+	if err != nil || a.Country != "GB" {
+		t.Errorf("artist = %+v, %v", a, err)
+	}
+	// The reissue counts as the original.
+	r, err := c.Release(ctx, "r1")
+	if err != nil || r.Year() != 2007 {
+		t.Errorf("release = %+v (year %d), %v", r, r.Year(), err)
+	}
+	if _, err := c.Artist(ctx, "gone"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown artist: err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,112 @@
+package recommend
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// AlbumCand is an album by a candidate artist that was never played. Its
+// breakdown is its artist's, so Novelty is always 1.
+type AlbumCand struct {
+	Rank   int     `json:"rank"`
+	Artist string  `json:"artist"`
+	Album  string  `json:"album"`
+	Score  float64 `json:"score"`
+
+	Breakdown Breakdown `json:"breakdown"`
+
+	// Repeated marks an album recommended within Options.NoRepeat.
+	Repeated bool `json:"repeated,omitempty"`
+}
+
+// expandTopAlbums turns candidate artists into their top albums, skipping
+// any album with a local play.
+func expandTopAlbums(ctx context.Context, env *Env, artistCands []ArtistCand) ([]AlbumCand, error) {
+	opt, sh := env.Options, env.sh
+	stmtPlays, err := env.DB.PrepareContext(ctx, `SELECT COUNT(*) FROM scrobbles WHERE user_name = ? AND deleted_at_uts IS NULL AND artist_norm = ? AND album_norm = ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmtPlays.Close()
+
+	albums := []AlbumCand{}
+	seen := map[string]bool{}
+	for _, a := range artistCands {
+		top, err := sh.lastfm.ArtistTopAlbums(ctx, a.Artist, opt.TopAlbumsPerArtist)
+		if err != nil {
+			if !sh.skip(ctx, "artist.getTopAlbums "+a.Artist, err) {
+				return nil, err
+			}
+			continue
+		}
+		for _, al := range top {
+			// Last.fm pads top albums with "(null)" for untitled releases.
+			name := strings.TrimSpace(al.Name)
+			if name == "" || name == "(null)" {
+				continue
+			}
+			key := store.NormalizeArtist(a.Artist) + "|" + store.NormalizeName(name)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			var plays int64
+			if err := stmtPlays.QueryRowContext(ctx, opt.Filter.User, store.NormalizeArtist(a.Artist), store.NormalizeName(name)).Scan(&plays); err != nil {
+				return nil, err
+			}
+			if plays > 0 {
+				continue
+			}
+			albums = append(albums, AlbumCand{Artist: a.Artist, Album: name,
+				Breakdown: Breakdown{Similarity: a.Score, Recency: a.recency}})
+		}
+	}
+	return albums, nil
+}
+
+// scoreAlbums is score for albums, which were never played: each gets its
+// artist's tag overlap and obscurity.
+func scoreAlbums(ctx context.Context, sh *shared, seeds []SeedArtist, albums []AlbumCand, w Weights) error {
+	profile, err := tagProfile(ctx, sh, seeds, w)
+	if err != nil {
+		return err
+	}
+	for i := range albums {
+		a := &albums[i]
+		if a.Breakdown.TagOverlap, err = tagOverlap(ctx, sh, profile, a.Artist); err != nil {
+			return err
+		}
+		if w.Obscurity > 0 {
+			if a.Breakdown.Obscurity, err = sh.obscurity(ctx, a.Artist); err != nil {
+				return err
+			}
+		}
+		a.Score = w.mix(&a.Breakdown, 0)
+	}
+	return nil
+}
+
+// rankAlbums orders albums by score (then name), keeps the best
+// CandidateAlbumsLimit and numbers them.
+func rankAlbums(albums []AlbumCand, opt Options) []AlbumCand {
+	sort.SliceStable(albums, func(i, j int) bool {
+		if albums[i].Score != albums[j].Score {
+			return albums[i].Score > albums[j].Score
+		}
+		if albums[i].Artist != albums[j].Artist {
+			return albums[i].Artist < albums[j].Artist
+		}
+		return albums[i].Album < albums[j].Album
+	})
+	if len(albums) > opt.CandidateAlbumsLimit {
+		albums = albums[:opt.CandidateAlbumsLimit]
+	}
+	for i := range albums {
+		albums[i].Rank = i + 1
+	}
+	return albums
+}
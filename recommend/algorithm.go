@@ -0,0 +1,175 @@
+package recommend
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// Algorithm is a recommendation strategy, chosen by name with Options.Algo
+// (see Register). Build runs its steps in order on one Output, each filling
+// in what the next needs, then does what every algorithm shares: holding
+// back repeats, sampling near-equal scores and diversifying.
+type Algorithm interface {
+	// Seeds picks what to start from (my top artists or tracks, friends, a
+	// tag) and sets Meta.Algo, plus the candidate artists they lead to if
+	// any.
+	Seeds(ctx context.Context, env *Env, out *Output) error
+	// Expand turns those into candidate tracks, or albums.
+	Expand(ctx context.Context, env *Env, out *Output) error
+	// Score sets each candidate's Score.
+	Score(ctx context.Context, env *Env, out *Output) error
+	// Rank orders the candidates, keeps the best and numbers them.
+	Rank(ctx context.Context, env *Env, out *Output) error
+}
+
+// Env is a run as its Algorithm sees it: the database, the options and
+// Last.fm, looked up through the run's cache.
+type Env struct {
+	DB      *sql.DB
+	Options Options
+
+	sh *shared
+}
+
+// Blocked reports whether artist (or an alias of it) is on the block list.
+func (e *Env) Blocked(artist string) bool {
+	return e.sh.blocked[store.NormalizeArtist(artist)]
+}
+
+// Skip records a failed lookup so the run can go on without it, listed in
+// Meta.Errors. It reports false when the run should stop instead and return
+// err: ctx is done, or the API key was rejected.
+func (e *Env) Skip(ctx context.Context, what string, err error) bool {
+	return e.sh.skip(ctx, what, err)
+}
+
+// SimilarArtists is artist.getSimilar.
+func (e *Env) SimilarArtists(ctx context.Context, artist string, limit int) ([]lastfm.SimilarArtist, error) {
+	return e.sh.lastfm.SimilarArtists(ctx, artist, limit)
+}
+
+// SimilarTracks is track.getSimilar.
+func (e *Env) SimilarTracks(ctx context.Context, artist, track string, limit int) ([]lastfm.SimilarTrack, error) {
+	return e.sh.lastfm.SimilarTracks(ctx, artist, track, limit)
+}
+
+// ArtistTopTracks is artist.getTopTracks.
+func (e *Env) ArtistTopTracks(ctx context.Context, artist string, limit int) ([]lastfm.TopTrack, error) {
+	return e.sh.lastfm.ArtistTopTracks(ctx, artist, limit)
+}
+
+// TagTopArtists is tag.getTopArtists.
+func (e *Env) TagTopArtists(ctx context.Context, tag string, limit int) ([]lastfm.ChartArtist, error) {
+	return e.sh.lastfm.TagTopArtists(ctx, tag, limit)
+}
+
+var (
+	algorithmsMu sync.RWMutex
+	algorithms   = map[string]func() Algorithm{}
+)
+
+// Register makes an algorithm selectable as Options.Algo name. Build calls
+// newAlgorithm once per run, so an Algorithm may keep state between its
+// steps. It panics if the name is empty or already registered, like
+// digest.Register.
+func Register(name string, newAlgorithm func() Algorithm) {
+	algorithmsMu.Lock()
+	defer algorithmsMu.Unlock()
+	if name == "" {
+		panic("recommend: Register algorithm with empty name")
+	}
+	if _, dup := algorithms[name]; dup {
+		panic("recommend: Register called twice for algorithm " + name)
+	}
+	algorithms[name] = newAlgorithm
+}
+
+// Algorithms lists the registered algorithm names, sorted.
+func Algorithms() []string {
+	algorithmsMu.RLock()
+	defer algorithmsMu.RUnlock()
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newAlgorithm returns a fresh algorithm of the given name ("" for
+// AlgoArtists).
+func newAlgorithm(name string) (Algorithm, error) {
+	if name == "" {
+		name = AlgoArtists
+	}
+	algorithmsMu.RLock()
+	fn := algorithms[name]
+	algorithmsMu.RUnlock()
+	if fn == nil {
+		return nil, fmt.Errorf("recommend: unknown algorithm %q (want %s)", name, strings.Join(Algorithms(), ", "))
+	}
+	return fn(), nil
+}
+
+func init() {
+	Register(AlgoArtists, func() Algorithm { return &artistPipeline{candidates: fromSeedArtists} })
+	Register(AlgoFriends, func() Algorithm { return &artistPipeline{candidates: fromFriends} })
+	Register(AlgoTag, func() Algorithm { return &artistPipeline{candidates: fromTag} })
+	Register(AlgoTracks, func() Algorithm { return &trackPipeline{} })
+	Register(AlgoResurface, func() Algorithm { return resurface{} })
+}
+
+// artistPipeline is AlgoArtists, AlgoFriends and AlgoTag: candidate artists,
+// found by candidates, expanded to their top tracks or albums and scored
+// against my own top artists (mine).
+type artistPipeline struct {
+	candidates func(ctx context.Context, env *Env, out *Output) (mine []SeedArtist, err error)
+	mine       []SeedArtist
+}
+
+func (p *artistPipeline) Seeds(ctx context.Context, env *Env, out *Output) error {
+	var err error
+	p.mine, err = p.candidates(ctx, env, out)
+	return err
+}
+
+func (p *artistPipeline) Expand(ctx context.Context, env *Env, out *Output) error {
+	var err error
+	if env.Options.Unit == UnitAlbum {
+		out.Albums, err = expandTopAlbums(ctx, env, out.Artists)
+		return err
+	}
+	out.Tracks, err = expandTopTracks(ctx, env, out.Artists)
+	return err
+}
+
+func (p *artistPipeline) Score(ctx context.Context, env *Env, out *Output) error {
+	if env.Options.Unit == UnitAlbum {
+		return scoreAlbums(ctx, env.sh, p.mine, out.Albums, env.Options.Weights)
+	}
+	return score(ctx, env.sh, p.mine, out.Tracks, env.Options.Weights)
+}
+
+func (p *artistPipeline) Rank(ctx context.Context, env *Env, out *Output) error {
+	if env.Options.Unit == UnitAlbum {
+		out.Albums = rankAlbums(out.Albums, env.Options)
+		return nil
+	}
+	out.Tracks = rankTracks(out.Tracks, env.Options)
+	return nil
+}
+
+// tracksOnly is the error of an algorithm that can't recommend albums.
+func tracksOnly(opt Options) error {
+	if opt.Unit == UnitAlbum {
+		return fmt.Errorf("recommend: albums need the %s, %s or %s algorithm", AlgoArtists, AlgoFriends, AlgoTag)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package recommend
+
+import (
+	"context"
+
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// diversify applies Options.MaxPerArtist and Options.Diversity to ranked
+// tracks and renumbers them. With PreferUnplayed, unplayed tracks stay ahead
+// of played ones.
+func diversify(ctx context.Context, sh *shared, tracks []TrackCand, opt Options) ([]TrackCand, error) {
+	if opt.MaxPerArtist > 0 {
+		perArtist := map[string]int{}
+		kept := tracks[:0]
+		for _, t := range tracks {
+			k := store.NormalizeArtist(t.Artist)
+			if perArtist[k] < opt.MaxPerArtist {
+				perArtist[k]++
+				kept = append(kept, t)
+			}
+		}
+		tracks = kept
+	}
+
+	if opt.Diversity > 0 {
+		split := len(tracks)
+		if opt.PreferUnplayed {
+			for i, t := range tracks {
+				if t.LocalPlays > 0 {
+					split = i
+					break
+				}
+			}
+		}
+		out := make([]TrackCand, 0, len(tracks))
+		for _, part := range [][]TrackCand{tracks[:split], tracks[split:]} {
+			picked, err := mmr(ctx, sh, part, opt.Diversity)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, picked...)
+		}
+		tracks = out
+	}
+
+	for i := range tracks {
+		tracks[i].Rank = i + 1
+	}
+	return tracks, nil
+}
+
+// mmr greedily picks the track with the best
+// (1-lambda)*score - lambda*(max similarity to any already picked), where
+// similarity is 1 for the same artist and the artists' tag cosine otherwise.
+func mmr(ctx context.Context, sh *shared, tracks []TrackCand, lambda float64) ([]TrackCand, error) {
+	vecs := make([]map[string]float64, len(tracks))
+	for i, t := range tracks {
+		v, err := sh.tags.get(ctx, sh, t.Artist)
+		if err != nil {
+			return nil, err
+		}
+		vecs[i] = v
+	}
+
+	// closest[i] is track i's highest similarity to the picked tracks.
+	closest := make([]float64, len(tracks))
+	picked := make([]bool, len(tracks))
+	out := make([]TrackCand, 0, len(tracks))
+	for range tracks {
+		best, bestVal := -1, 0.0
+		for i, t := range tracks {
+			if picked[i] {
+				continue
+			}
+			// Ties keep the incoming order.
+			if v := (1-lambda)*t.Score - lambda*closest[i]; best < 0 || v > bestVal {
+				best, bestVal = i, v
+			}
+		}
+		picked[best] = true
+		out = append(out, tracks[best])
+		for i := range tracks {
+			if picked[i] {
+				continue
+			}
+			sim := cosine(vecs[i], vecs[best])
+			if store.NormalizeArtist(tracks[i].Artist) == store.NormalizeArtist(tracks[best].Artist) {
+				sim = 1
+			}
+			closest[i] = max(closest[i], sim)
+		}
+	}
+	return out, nil
+}
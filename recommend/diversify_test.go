@@ -0,0 +1,82 @@
+package recommend
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDiversifyCapsAndSpreadsArtists(t *testing.T) {
+	tv := newTagVectors(nil)
+	tv.cache = map[string]map[string]float64{
+		"a": {"idm": 1},
+		"b": {"idm": 1},
+		"c": {"house": 1},
+	}
+	sh := &shared{tags: tv}
+	tracks := []TrackCand{
+		{Artist: "A", Track: "1", Score: 0.9},
+		{Artist: "A", Track: "2", Score: 0.89},
+		{Artist: "A", Track: "3", Score: 0.88},
+		{Artist: "B", Track: "1", Score: 0.87},
+		{Artist: "C", Track: "1", Score: 0.6},
+	}
+
+	opt := Options{MaxPerArtist: 2}
+	got, err := diversify(context.Background(), sh, append([]TrackCand(nil), tracks...), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order(got) != "A1 A2 B1 C1" {
+		t.Fatalf("capped order = %s", order(got))
+	}
+
+	opt.Diversity = 0.5
+	got, err = diversify(context.Background(), sh, append([]TrackCand(nil), tracks...), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// C is unlike A, so it moves up; B shares A's tags and gains nothing.
+	if order(got) != "A1 C1 A2 B1" || got[1].Rank != 2 {
+		t.Fatalf("diversified order = %s", order(got))
+	}
+}
+
+func order(tracks []TrackCand) string {
+	var s string
+	for i, t := range tracks {
+		if i > 0 {
+			s += " "
+		}
+		s += t.Artist + t.Track
+	}
+	return s
+}
+
+func TestSampleNearEqualIsSeeded(t *testing.T) {
+	tracks := []TrackCand{
+		{Artist: "A", Score: 0.9}, {Artist: "B", Score: 0.89}, {Artist: "C", Score: 0.88},
+		{Artist: "D", Score: 0.87}, {Artist: "E", Score: 0.5},
+	}
+	run := func(seed int64) string {
+		got := append([]TrackCand(nil), tracks...)
+		sampleNearEqual(got, Options{Seed: seed, SampleTolerance: 0.05})
+		return order(got)
+	}
+	if got := run(0); got != "A B C D E" {
+		t.Fatalf("seed 0 reordered: %s", got)
+	}
+	if run(7) != run(7) {
+		t.Fatalf("same seed, different order")
+	}
+	varied := false
+	for seed := int64(1); seed < 20; seed++ {
+		got := run(seed)
+		if got[len(got)-1] != 'E' {
+			t.Fatalf("seed %d moved a track across the tolerance: %s", seed, got)
+		}
+		varied = varied || got != run(1)
+	}
+	if !varied {
+		t.Fatalf("seeds never changed the order")
+	}
+}
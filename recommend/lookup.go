@@ -0,0 +1,176 @@
+package recommend
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// ArtistInfoTTL is how long RefreshArtistInfo keeps a cached listener count;
+// they change slowly.
+const ArtistInfoTTL = 30 * 24 * time.Hour
+
+// RefreshArtistInfo caches artist.getInfo (listener counts, for the digest's
+// obscurity section) for user's limit most played artists of the past year.
+// A failed lookup doesn't stop the rest; the failures are returned joined.
+func RefreshArtistInfo(ctx context.Context, db *sql.DB, client *lastfm.Client, user string, limit int) error {
+	top, err := seedArtists(ctx, db, store.Filter{User: user, HideIgnored: true}, "-365 days", limit)
+	if err != nil {
+		return err
+	}
+	l := &lookups{db: db, client: client, ttl: ArtistInfoTTL}
+	var errs []error
+	for _, a := range top {
+		if _, err := l.ArtistInfo(ctx, a.Artist); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			errs = append(errs, fmt.Errorf("artist.getInfo %s: %w", a.Artist, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TrackInfoTTL is how long RefreshTrackInfo keeps a cached track; its
+// duration hardly ever changes.
+const TrackInfoTTL = 180 * 24 * time.Hour
+
+// RefreshTrackInfo caches track.getInfo (durations, for analyze completion)
+// for user's limit most played tracks of the past year. Tracks Last.fm
+// doesn't know are cached empty, so they aren't asked about on every sync.
+// A failed lookup doesn't stop the rest; the failures are returned joined.
+func RefreshTrackInfo(ctx context.Context, db *sql.DB, client *lastfm.Client, user string, limit int) error {
+	top, err := seedTracks(ctx, db, store.Filter{User: user, HideIgnored: true}, "-365 days", limit)
+	if err != nil {
+		return err
+	}
+	l := &lookups{db: db, client: client, ttl: TrackInfoTTL}
+	var errs []error
+	for _, t := range top {
+		if _, err := l.TrackInfo(ctx, t.Artist, t.Track); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			errs = append(errs, fmt.Errorf("track.getInfo %s - %s: %w", t.Artist, t.Track, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// lookups makes recommend's Last.fm calls through the lastfm_cache table.
+// Online, cached responses younger than ttl are reused and the rest are
+// fetched and stored; offline only the cache is read, and each miss is noted
+// and treated as an empty response. Limits aren't part of the cache key: a
+// response cached with a smaller limit is reused as is.
+type lookups struct {
+	db      *sql.DB
+	client  *lastfm.Client
+	offline bool
+	ttl     time.Duration
+	misses  []string
+}
+
+func cachedCall[T any](ctx context.Context, l *lookups, method, key string, fetch func() (T, error)) (T, error) {
+	var v T
+	key = strings.ToLower(strings.TrimSpace(key))
+
+	var body string
+	var fetchedAt int64
+	err := l.db.QueryRowContext(ctx, `SELECT body, fetched_at_uts FROM lastfm_cache WHERE method = ? AND key = ?`, method, key).Scan(&body, &fetchedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return v, err
+	}
+	fresh := err == nil && (l.offline || time.Since(time.Unix(fetchedAt, 0)) < l.ttl)
+	if fresh {
+		if err := json.Unmarshal([]byte(body), &v); err == nil {
+			return v, nil
+		}
+	}
+	if l.offline {
+		l.misses = append(l.misses, method+" "+key)
+		return v, nil
+	}
+
+	v, err = fetch()
+	if err != nil {
+		return v, err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v, err
+	}
+	_, err = l.db.ExecContext(ctx, `INSERT OR REPLACE INTO lastfm_cache (method, key, body, fetched_at_uts) VALUES (?, ?, ?, ?)`,
+		method, key, string(b), time.Now().Unix())
+	return v, err
+}
+
+func (l *lookups) SimilarArtists(ctx context.Context, artist string, limit int) ([]lastfm.SimilarArtist, error) {
+	return cachedCall(ctx, l, "artist.getSimilar", artist, func() ([]lastfm.SimilarArtist, error) {
+		return l.client.GetSimilarArtists(ctx, artist, limit)
+	})
+}
+
+func (l *lookups) ArtistTopTracks(ctx context.Context, artist string, limit int) ([]lastfm.TopTrack, error) {
+	return cachedCall(ctx, l, "artist.getTopTracks", artist, func() ([]lastfm.TopTrack, error) {
+		return l.client.GetArtistTopTracks(ctx, artist, limit)
+	})
+}
+
+func (l *lookups) ArtistTopAlbums(ctx context.Context, artist string, limit int) ([]lastfm.TopAlbum, error) {
+	return cachedCall(ctx, l, "artist.getTopAlbums", artist, func() ([]lastfm.TopAlbum, error) {
+		return l.client.GetArtistTopAlbums(ctx, artist, limit)
+	})
+}
+
+func (l *lookups) ArtistInfo(ctx context.Context, artist string) (lastfm.ArtistInfo, error) {
+	return cachedCall(ctx, l, "artist.getInfo", artist, func() (lastfm.ArtistInfo, error) {
+		return l.client.GetArtistInfo(ctx, artist)
+	})
+}
+
+func (l *lookups) TrackInfo(ctx context.Context, artist, track string) (lastfm.TrackInfo, error) {
+	return cachedCall(ctx, l, "track.getInfo", artist+"|"+track, func() (lastfm.TrackInfo, error) {
+		info, err := l.client.GetTrackInfo(ctx, artist, track)
+		if errors.Is(err, lastfm.ErrInvalidParams) {
+			return lastfm.TrackInfo{}, nil // not found
+		}
+		return info, err
+	})
+}
+
+func (l *lookups) ArtistTopTags(ctx context.Context, artist string) ([]lastfm.Tag, error) {
+	return cachedCall(ctx, l, "artist.getTopTags", artist, func() ([]lastfm.Tag, error) {
+		return l.client.GetArtistTopTags(ctx, artist)
+	})
+}
+
+func (l *lookups) SimilarTracks(ctx context.Context, artist, track string, limit int) ([]lastfm.SimilarTrack, error) {
+	return cachedCall(ctx, l, "track.getSimilar", artist+"|"+track, func() ([]lastfm.SimilarTrack, error) {
+		return l.client.GetSimilarTracks(ctx, artist, track, limit)
+	})
+}
+
+func (l *lookups) TagTopArtists(ctx context.Context, tag string, limit int) ([]lastfm.ChartArtist, error) {
+	return cachedCall(ctx, l, "tag.getTopArtists", tag, func() ([]lastfm.ChartArtist, error) {
+		return l.client.GetTagTopArtists(ctx, tag, limit)
+	})
+}
+
+func (l *lookups) Friends(ctx context.Context, user string, limit int) ([]lastfm.Friend, error) {
+	return cachedCall(ctx, l, "user.getFriends", user, func() ([]lastfm.Friend, error) {
+		return l.client.GetFriends(ctx, user, limit)
+	})
+}
+
+func (l *lookups) UserTopArtists(ctx context.Context, user, period string, limit int) ([]lastfm.UserTopArtist, error) {
+	return cachedCall(ctx, l, "user.getTopArtists", user+"|"+period, func() ([]lastfm.UserTopArtist, error) {
+		return l.client.GetUserTopArtists(ctx, user, period, limit)
+	})
+}
@@ -0,0 +1,1045 @@
+// Package recommend builds discovery candidates from local listening history
+// and Last.fm similarity data.
+package recommend
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// Algorithms for Options.Algo.
+const (
+	// AlgoArtists expands the most played artists to similar artists and
+	// then to their top tracks.
+	AlgoArtists = "artists"
+	// AlgoTracks goes from the most played tracks straight to similar
+	// tracks, which is more specific where an artist spans many styles
+	// (compilations, classical).
+	AlgoTracks = "tracks"
+	// AlgoFriends takes what friends (or Options.Friends) play heavily and
+	// I don't, then their top tracks.
+	AlgoFriends = "friends"
+	// AlgoTag starts from the top artists for Options.Tag instead of my
+	// history, then their top tracks.
+	AlgoTag = "tag"
+	// AlgoResurface needs no Last.fm data: it ranks my own tracks by plays,
+	// time since last played and how much they were played at this time of
+	// year.
+	AlgoResurface = "resurface"
+)
+
+// Seed choices for Options.SeedBy.
+const (
+	SeedByPlays = "plays"
+	// SeedByAffinity seeds from the stored affinity scores (see
+	// store.Affinity), whatever the SeedWindow.
+	SeedByAffinity = "affinity"
+)
+
+// Units for Options.Unit.
+const (
+	UnitTrack = "track"
+	// UnitAlbum recommends never-played albums by the candidate artists,
+	// for listening to whole records.
+	UnitAlbum = "album"
+)
+
+type Options struct {
+	Algo string
+	// Unit is what to recommend: tracks (the default) or, with AlgoArtists
+	// or AlgoFriends, albums. MaxPerArtist, Diversity and Seed only apply
+	// to tracks.
+	Unit string
+
+	// SeedBy is how seeds are picked: most played within SeedWindow
+	// (SeedByPlays, the default) or highest affinity (SeedByAffinity).
+	SeedBy               string
+	SeedArtistsLimit     int
+	SeedWindow           string
+	SimilarPerSeedArtist int
+	SimilarArtistsLimit  int
+	TopTracksPerArtist   int
+	CandidateTracksLimit int
+	ExcludeSeedArtists   bool
+	IncludePlayedTracks  bool
+	PreferUnplayed       bool
+
+	// AlgoResurface only: tracks played within MinLastPlayedWindow, or
+	// fewer than ResurfaceMinPlays times, aren't resurfaced.
+	MinLastPlayedWindow string
+	ResurfaceMinPlays   int64
+
+	// UnitAlbum only.
+	TopAlbumsPerArtist   int
+	CandidateAlbumsLimit int
+
+	// AlgoTracks only; ExcludeSeedArtists doesn't apply there.
+	SeedTracksLimit     int
+	SimilarPerSeedTrack int
+
+	// AlgoFriends only. Friends defaults to the Last.fm friends of User
+	// (default: the client's user).
+	User                 string
+	Friends              []string
+	FriendsLimit         int
+	FriendsPeriod        string
+	FriendTopArtists     int
+	FriendsMaxLocalPlays int64
+
+	// AlgoTag only: the tag to explore, e.g. "dungeon synth".
+	Tag string
+
+	// MaxPerArtist caps tracks per artist (0: no cap). Diversity, 0-1, then
+	// reorders by maximal marginal relevance: how much a track's score is
+	// traded for being unlike (by artist tags) the tracks above it.
+	MaxPerArtist int
+	Diversity    float64
+
+	// Seed, when not 0, shuffles near-equal tracks (scores within
+	// SampleTolerance) so runs can vary; the same seed gives the same list.
+	Seed            int64
+	SampleTolerance float64
+
+	// NoRepeat, when set, holds back tracks recommended within that long:
+	// their score is cut by RepeatPenalty (1 drops them).
+	NoRepeat      time.Duration
+	RepeatPenalty float64
+
+	// Offline builds from cached Last.fm responses only (also implied by a
+	// nil client). Online, cached responses younger than CacheTTL are reused.
+	Offline  bool
+	CacheTTL time.Duration
+
+	// Weights mix the parts of each track's score (see Breakdown).
+	Weights Weights
+
+	// Filter scopes which listening picks the seed artists; by default the
+	// ignore list is left out. Its User is whose library and lists all of
+	// recommend reads (see store.Store.User).
+	Filter store.Filter
+
+	// Location is the home time zone, whose month resurface favours; nil
+	// means UTC.
+	Location *time.Location
+
+	// MinSaneUTS is the store's minimum sane timestamp (see
+	// store.Store.MinSaneUTS); plays before it don't count. 0 means
+	// store.MinSaneUTS.
+	MinSaneUTS int64
+
+	// SchemaVersion asks for an older JSON shape (MinSchemaVersion to
+	// SchemaVersion); 0 means the current one.
+	SchemaVersion int
+}
+
+// minSane is opt.MinSaneUTS or its default.
+func (opt Options) minSane() int64 {
+	if opt.MinSaneUTS == 0 {
+		return store.MinSaneUTS
+	}
+	return opt.MinSaneUTS
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Algo:                 AlgoArtists,
+		Unit:                 UnitTrack,
+		SeedArtistsLimit:     8,
+		SeedWindow:           "-90 days",
+		SimilarPerSeedArtist: 15,
+		SimilarArtistsLimit:  25,
+		TopTracksPerArtist:   6,
+		CandidateTracksLimit: 120,
+		ExcludeSeedArtists:   true,
+		IncludePlayedTracks:  true,
+		PreferUnplayed:       true,
+		MinLastPlayedWindow:  "-365 days",
+		ResurfaceMinPlays:    3,
+		TopAlbumsPerArtist:   3,
+		CandidateAlbumsLimit: 30,
+		SeedTracksLimit:      10,
+		SimilarPerSeedTrack:  20,
+		FriendsLimit:         50,
+		FriendsPeriod:        lastfm.Period3Month,
+		FriendTopArtists:     50,
+		FriendsMaxLocalPlays: 5,
+		MaxPerArtist:         3,
+		SampleTolerance:      0.05,
+		RepeatPenalty:        1,
+		CacheTTL:             7 * 24 * time.Hour,
+		Weights:              DefaultWeights(),
+		Filter:               store.Filter{HideIgnored: true},
+	}
+}
+
+type Output struct {
+	Meta       Meta         `json:"meta"`
+	Seeds      []SeedArtist `json:"seeds"`
+	SeedTracks []SeedTrack  `json:"seed_tracks,omitempty"`
+	Friends    []string     `json:"friends,omitempty"`
+	Tag        string       `json:"tag,omitempty"`
+	Artists    []ArtistCand `json:"artists"`
+	Tracks     []TrackCand  `json:"tracks"`
+	Albums     []AlbumCand  `json:"albums,omitempty"`
+}
+
+type Meta struct {
+	// SchemaVersion is the version of this JSON shape (see SchemaVersion).
+	SchemaVersion int       `json:"schema_version"`
+	GeneratedAt   time.Time `json:"generated_at"`
+	Algo          string    `json:"algo"`
+	Weights       Weights   `json:"weights,omitzero"`
+	Seed          int64     `json:"seed,omitempty"`
+	// Offline runs use only cached Last.fm data; Missing lists the lookups
+	// that weren't cached (and so added nothing).
+	Offline bool     `json:"offline,omitempty"`
+	Missing []string `json:"missing,omitempty"`
+	// Errors lists lookups that failed; the run went on without them.
+	Errors []string `json:"errors,omitempty"`
+	// RunID is set by the caller once the run is saved.
+	RunID int64 `json:"run_id,omitempty"`
+}
+
+type SeedArtist struct {
+	Artist string `json:"artist"`
+	Plays  int64  `json:"plays"`
+	// Affinity is set for SeedByAffinity, and weighs the seed instead of
+	// Plays.
+	Affinity float64 `json:"affinity,omitempty"`
+
+	lastPlayed int64
+}
+
+type SeedTrack struct {
+	Artist   string  `json:"artist"`
+	Track    string  `json:"track"`
+	Plays    int64   `json:"plays"`
+	Affinity float64 `json:"affinity,omitempty"`
+
+	lastPlayed int64
+}
+
+// seedWeight is how much a seed counts among the others: its affinity if
+// picked by affinity, else its plays.
+func seedWeight(plays int64, affinity float64) float64 {
+	if affinity > 0 {
+		return affinity
+	}
+	return float64(plays)
+}
+
+// ArtistCand's Score is its similarity to the seeds (see Breakdown).
+type ArtistCand struct {
+	Rank            int      `json:"rank"`
+	Artist          string   `json:"artist"`
+	Score           float64  `json:"score"`
+	FromSeedArtists []string `json:"from_seed_artists"`
+
+	recency float64
+
+	// AlgoFriends only: the friends who play this artist.
+	FromFriends []string `json:"from_friends,omitempty"`
+}
+
+type TrackCand struct {
+	Rank   int     `json:"rank"`
+	Artist string  `json:"artist"`
+	Track  string  `json:"track"`
+	Score  float64 `json:"score"`
+
+	LocalPlays         int64     `json:"local_plays"`
+	LocalLastPlayedUTS int64     `json:"local_last_played_uts"`
+	Breakdown          Breakdown `json:"breakdown,omitzero"`
+
+	// AlgoResurface only, in place of Breakdown.
+	Resurface Resurfacing `json:"resurface,omitzero"`
+
+	// AlgoTracks only: the seed tracks ("Artist - Track") it was similar to.
+	FromSeedTracks []string `json:"from_seed_tracks,omitempty"`
+
+	// Repeated marks a track recommended within Options.NoRepeat.
+	Repeated bool `json:"repeated,omitempty"`
+}
+
+// localStatsQuery gives the local play count and last play of each track
+// in the JSON array of [artist key, track key] pairs bound to ?1, reading
+// only idx_scrobbles_live_track. Names match by key (see
+// store.NormalizeName), so any spelling counts.
+const localStatsQuery = `
+WITH cands AS (
+  SELECT DISTINCT json_extract(value, '$[0]') AS artist_norm, json_extract(value, '$[1]') AS track_norm
+  FROM json_each(?1)
+)
+SELECT c.artist_norm, c.track_norm, COUNT(s.played_at_uts), COALESCE(MAX(s.played_at_uts), 0)
+FROM cands c
+LEFT JOIN scrobbles s ON s.user_name = ?2 AND s.artist_norm = c.artist_norm AND s.track_norm = c.track_norm
+  AND s.deleted_at_uts IS NULL AND s.played_at_uts >= ?3
+GROUP BY c.artist_norm, c.track_norm
+`
+
+// localStats sets the local plays and last play of every track in one
+// query, rather than one per candidate.
+func localStats(ctx context.Context, db *sql.DB, opt Options, tracks []TrackCand) error {
+	if len(tracks) == 0 {
+		return nil
+	}
+	keys := make([][2]string, len(tracks))
+	for i, t := range tracks {
+		keys[i] = [2]string{store.NormalizeArtist(t.Artist), store.NormalizeName(t.Track)}
+	}
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	rows, err := db.QueryContext(ctx, localStatsQuery, string(b), opt.Filter.User, opt.minSane())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	stats := map[[2]string][2]int64{}
+	for rows.Next() {
+		var k [2]string
+		var plays, last int64
+		if err := rows.Scan(&k[0], &k[1], &plays, &last); err != nil {
+			return err
+		}
+		stats[k] = [2]int64{plays, last}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i, k := range keys {
+		tracks[i].LocalPlays, tracks[i].LocalLastPlayedUTS = stats[k][0], stats[k][1]
+	}
+	return nil
+}
+
+// shared is per-Build state the algorithms share.
+type shared struct {
+	blocked map[string]bool
+	lastfm  *lookups
+	tags    *tagVectors
+	obscure map[string]float64 // store.NormalizeArtist -> Breakdown.Obscurity
+	errors  []string
+}
+
+// skip records a failed lookup so the run can go on without it. It reports
+// false when the run should stop instead: ctx is done, or the API key was
+// rejected and every other lookup would fail too.
+func (sh *shared) skip(ctx context.Context, what string, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, lastfm.ErrAuth) {
+		return false
+	}
+	sh.errors = append(sh.errors, what+": "+err.Error())
+	return true
+}
+
+// allFailed is the error for a run whose every seed lookup failed.
+func allFailed(n int, err error) error {
+	return fmt.Errorf("recommend: all %d seed lookups failed, last: %w", n, err)
+}
+
+// Build runs the algorithm Options.Algo names (see Algorithm).
+func Build(ctx context.Context, db *sql.DB, client *lastfm.Client, opt Options) (Output, error) {
+	version, err := schemaVersion(opt.SchemaVersion)
+	if err != nil {
+		return Output{}, err
+	}
+	switch opt.SeedBy {
+	case SeedByPlays, SeedByAffinity, "":
+	default:
+		return Output{}, fmt.Errorf("recommend: unknown seed choice %q (want %s or %s)", opt.SeedBy, SeedByPlays, SeedByAffinity)
+	}
+	switch opt.Unit {
+	case UnitTrack, "", UnitAlbum:
+	default:
+		return Output{}, fmt.Errorf("recommend: unknown unit %q (want %s or %s)", opt.Unit, UnitTrack, UnitAlbum)
+	}
+	alg, err := newAlgorithm(opt.Algo)
+	if err != nil {
+		return Output{}, err
+	}
+	blocked, err := blockedArtists(ctx, db, opt.Filter.User)
+	if err != nil {
+		return Output{}, err
+	}
+	// Resurfacing never calls Last.fm; only --diversity reads (cached) tags.
+	offline := opt.Offline || client == nil || opt.Algo == AlgoResurface
+	lf := &lookups{db: db, client: client, offline: offline, ttl: opt.CacheTTL}
+	sh := &shared{blocked: blocked, lastfm: lf, tags: newTagVectors(lf)}
+	env := &Env{DB: db, Options: opt, sh: sh}
+
+	out := Output{Seeds: []SeedArtist{}, Artists: []ArtistCand{}, Tracks: []TrackCand{}}
+	for _, step := range []func(context.Context, *Env, *Output) error{alg.Seeds, alg.Expand, keepVersions, alg.Score, alg.Rank} {
+		if err := step(ctx, env, &out); err != nil {
+			return Output{}, err
+		}
+	}
+	out.Meta.GeneratedAt = time.Now().UTC()
+	if opt.NoRepeat > 0 {
+		if err := holdBackRepeats(ctx, db, &out, opt); err != nil {
+			return Output{}, err
+		}
+	}
+	sampleNearEqual(out.Tracks, opt)
+	if out.Tracks, err = diversify(ctx, sh, out.Tracks, opt); err != nil {
+		return Output{}, err
+	}
+	out.Meta.SchemaVersion = version
+	out.Meta.Seed = opt.Seed
+	out.Meta.Offline = lf.offline
+	out.Meta.Missing = lf.misses
+	out.Meta.Errors = sh.errors
+	return out, nil
+}
+
+// fromSeedArtists finds the artists similar to my top artists, which are
+// also what the candidates are scored against.
+func fromSeedArtists(ctx context.Context, env *Env, out *Output) ([]SeedArtist, error) {
+	opt, sh := env.Options, env.sh
+	seeds, err := pickSeedArtists(ctx, env.DB, opt)
+	if err != nil {
+		return nil, err
+	}
+	resolver := newArtistResolver()
+	seedSet := map[string]bool{}
+	names, weights, last := make([]string, len(seeds)), make([]float64, len(seeds)), make([]int64, len(seeds))
+	for i, s := range seeds {
+		seedSet[store.NormalizeArtist(s.Artist)] = true
+		names[i], weights[i], last[i] = s.Artist, seedWeight(s.Plays, s.Affinity), s.lastPlayed
+	}
+	sources := seedSources(names, weights, last, time.Now())
+
+	// Per-seed match for each resolved candidate. Aliases returned for the
+	// same seed keep the stronger match rather than adding up, so a
+	// duplicated artist doesn't outscore a genuinely broader one.
+	fromSeeds := map[string]map[string]float64{}
+
+	var failed int
+	for _, seed := range seeds {
+		sim, err := sh.lastfm.SimilarArtists(ctx, seed.Artist, opt.SimilarPerSeedArtist)
+		if err != nil {
+			if !sh.skip(ctx, "artist.getSimilar "+seed.Artist, err) {
+				return nil, err
+			}
+			if failed++; failed == len(seeds) {
+				return nil, allFailed(failed, err)
+			}
+			continue
+		}
+		matches := make([]float64, len(sim))
+		for i, a := range sim {
+			matches[i], _ = strconv.ParseFloat(a.Match, 64)
+		}
+		scaleToBest(matches)
+		for i, a := range sim {
+			name := strings.TrimSpace(a.Name)
+			if name == "" {
+				continue
+			}
+			m := matches[i]
+			k := resolver.Resolve(name, m)
+			if (opt.ExcludeSeedArtists && seedSet[k]) || sh.blocked[k] {
+				continue
+			}
+			from := fromSeeds[k]
+			if from == nil {
+				from = map[string]float64{}
+				fromSeeds[k] = from
+			}
+			if cur, ok := from[seed.Artist]; !ok || m > cur {
+				from[seed.Artist] = m
+			}
+		}
+	}
+
+	out.Meta.Algo, out.Meta.Weights = "seed-artists->similar-artists->top-"+unitPlural(opt), opt.Weights
+	out.Seeds = seeds
+	out.Artists = artistCandidates(fromSeeds, sources, resolver, opt.SimilarArtistsLimit)
+	return seeds, nil
+}
+
+// fromFriends finds the artists friends (or Options.Friends) play heavily
+// and I don't.
+func fromFriends(ctx context.Context, env *Env, out *Output) ([]SeedArtist, error) {
+	opt, sh := env.Options, env.sh
+	friends := opt.Friends
+	if len(friends) == 0 {
+		user := opt.User
+		if user == "" && sh.lastfm.client != nil {
+			user = sh.lastfm.client.Username()
+		}
+		if user == "" {
+			return nil, lastfm.ErrMissingUsername
+		}
+		list, err := sh.lastfm.Friends(ctx, user, opt.FriendsLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range list {
+			friends = append(friends, f.Name)
+		}
+	}
+
+	// Each friend's plays are scaled to their own top artist, so one heavy
+	// listener doesn't drown out the rest. Their charts are recent by
+	// construction (FriendsPeriod), so recency is 1.
+	resolver := newArtistResolver()
+	sources := map[string]source{}
+	for _, f := range friends {
+		sources[f] = source{weight: 1 / float64(len(friends)), recency: 1}
+	}
+	fromFriends := map[string]map[string]float64{}
+	var failed int
+	for _, friend := range friends {
+		top, err := sh.lastfm.UserTopArtists(ctx, friend, opt.FriendsPeriod, opt.FriendTopArtists)
+		if err != nil {
+			if !sh.skip(ctx, "user.getTopArtists "+friend, err) {
+				return nil, err
+			}
+			if failed++; failed == len(friends) {
+				return nil, allFailed(failed, err)
+			}
+			continue
+		}
+		var most float64
+		plays := make([]float64, len(top))
+		for i, a := range top {
+			plays[i], _ = strconv.ParseFloat(a.PlayCount, 64)
+			most = max(most, plays[i])
+		}
+		for i, a := range top {
+			name := strings.TrimSpace(a.Name)
+			if name == "" || most == 0 {
+				continue
+			}
+			m := plays[i] / most
+			k := resolver.Resolve(name, m)
+			if sh.blocked[k] {
+				continue
+			}
+			from := fromFriends[k]
+			if from == nil {
+				from = map[string]float64{}
+				fromFriends[k] = from
+			}
+			if cur, ok := from[friend]; !ok || m > cur {
+				from[friend] = m
+			}
+		}
+	}
+
+	// Only what I don't already play much.
+	stmtPlays, err := env.DB.PrepareContext(ctx, `SELECT COUNT(*) FROM scrobbles WHERE user_name = ? AND deleted_at_uts IS NULL AND played_at_uts >= ? AND artist_norm = ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmtPlays.Close()
+	for k := range fromFriends {
+		var n int64
+		if err := stmtPlays.QueryRowContext(ctx, opt.Filter.User, opt.minSane(), k).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n > opt.FriendsMaxLocalPlays {
+			delete(fromFriends, k)
+		}
+	}
+
+	artistCands := artistCandidates(fromFriends, sources, resolver, opt.SimilarArtistsLimit)
+	for i := range artistCands {
+		artistCands[i].FromFriends, artistCands[i].FromSeedArtists = artistCands[i].FromSeedArtists, []string{}
+	}
+	sort.Strings(friends)
+	out.Meta.Algo, out.Meta.Weights = "friends->top-artists->top-"+unitPlural(opt), opt.Weights
+	out.Friends = friends
+	out.Artists = artistCands
+	return pickSeedArtists(ctx, env.DB, opt)
+}
+
+// fromTag takes the top artists for Options.Tag.
+func fromTag(ctx context.Context, env *Env, out *Output) ([]SeedArtist, error) {
+	opt, sh := env.Options, env.sh
+	tag := strings.TrimSpace(opt.Tag)
+	if tag == "" {
+		return nil, fmt.Errorf("recommend: the %s algorithm needs a tag", AlgoTag)
+	}
+	top, err := sh.lastfm.TagTopArtists(ctx, tag, opt.SimilarArtistsLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tag charts only give an order, so match falls linearly with rank.
+	resolver := newArtistResolver()
+	sources := map[string]source{tag: {weight: 1, recency: 1}}
+	fromTag := map[string]map[string]float64{}
+	for i, a := range top {
+		name := strings.TrimSpace(a.Name)
+		if name == "" {
+			continue
+		}
+		m := float64(len(top)-i) / float64(len(top))
+		k := resolver.Resolve(name, m)
+		if sh.blocked[k] || fromTag[k] != nil {
+			continue
+		}
+		fromTag[k] = map[string]float64{tag: m}
+	}
+
+	artistCands := artistCandidates(fromTag, sources, resolver, opt.SimilarArtistsLimit)
+	for i := range artistCands {
+		artistCands[i].FromSeedArtists = []string{}
+	}
+	out.Meta.Algo, out.Meta.Weights = "tag->top-artists->top-"+unitPlural(opt), opt.Weights
+	out.Tag = tag
+	out.Artists = artistCands
+	return pickSeedArtists(ctx, env.DB, opt)
+}
+
+// artistCandidates blends each candidate's per-source matches and returns
+// the best limit, with the sources in FromSeedArtists.
+func artistCandidates(fromSources map[string]map[string]float64, sources map[string]source, resolver *artistResolver, limit int) []ArtistCand {
+	artistCands := make([]ArtistCand, 0, len(fromSources))
+	for k, v := range fromSources {
+		from := make([]string, 0, len(v))
+		for s := range v {
+			from = append(from, s)
+		}
+		sort.Strings(from)
+		sim, rec := blend(v, sources)
+		artistCands = append(artistCands, ArtistCand{Artist: resolver.Name(k), Score: round(sim), FromSeedArtists: from, recency: rec})
+	}
+	sort.SliceStable(artistCands, func(i, j int) bool {
+		if artistCands[i].Score == artistCands[j].Score {
+			return artistCands[i].Artist < artistCands[j].Artist
+		}
+		return artistCands[i].Score > artistCands[j].Score
+	})
+	if len(artistCands) > limit {
+		artistCands = artistCands[:limit]
+	}
+	for i := range artistCands {
+		artistCands[i].Rank = i + 1
+	}
+	return artistCands
+}
+
+// expandTopTracks turns candidate artists into their top tracks, each as
+// similar and recent as its artist.
+func expandTopTracks(ctx context.Context, env *Env, artistCands []ArtistCand) ([]TrackCand, error) {
+	opt, sh := env.Options, env.sh
+	tracks := []TrackCand{}
+	seenTracks := map[string]bool{}
+	for _, a := range artistCands {
+		artistName := a.Artist
+		top, err := sh.lastfm.ArtistTopTracks(ctx, artistName, opt.TopTracksPerArtist)
+		if err != nil {
+			if !sh.skip(ctx, "artist.getTopTracks "+artistName, err) {
+				return nil, err
+			}
+			continue
+		}
+		for _, t := range top {
+			track := strings.TrimSpace(t.Name)
+			if track == "" {
+				continue
+			}
+			key := store.NormalizeArtist(artistName) + "|" + store.NormalizeName(track)
+			if seenTracks[key] {
+				continue
+			}
+			seenTracks[key] = true
+
+			cand := TrackCand{Artist: artistName, Track: track,
+				Breakdown: Breakdown{Similarity: a.Score, Recency: a.recency}}
+
+			tracks = append(tracks, cand)
+			if len(tracks) >= opt.CandidateTracksLimit {
+				break
+			}
+		}
+		if len(tracks) >= opt.CandidateTracksLimit {
+			break
+		}
+	}
+
+	return tracks, localStats(ctx, env.DB, opt, tracks)
+}
+
+// trackPipeline is AlgoTracks: my top tracks expanded straight to similar
+// tracks, scored against my top artists.
+type trackPipeline struct {
+	sources map[string]source
+}
+
+func (p *trackPipeline) Seeds(ctx context.Context, env *Env, out *Output) error {
+	if err := tracksOnly(env.Options); err != nil {
+		return err
+	}
+	seeds, err := pickSeedTracks(ctx, env.DB, env.Options)
+	if err != nil {
+		return err
+	}
+	names, weights, last := make([]string, len(seeds)), make([]float64, len(seeds)), make([]int64, len(seeds))
+	for i, s := range seeds {
+		names[i], weights[i], last[i] = s.Artist+" - "+s.Track, seedWeight(s.Plays, s.Affinity), s.lastPlayed
+	}
+	p.sources = seedSources(names, weights, last, time.Now())
+	out.Meta.Algo, out.Meta.Weights = "seed-tracks->similar-tracks", env.Options.Weights
+	out.SeedTracks = seeds
+	return nil
+}
+
+// Expand keeps the CandidateTracksLimit tracks most similar to the seeds.
+func (p *trackPipeline) Expand(ctx context.Context, env *Env, out *Output) error {
+	opt, sh, seeds := env.Options, env.sh, out.SeedTracks
+	seedSet := map[string]bool{}
+	for _, s := range seeds {
+		seedSet[store.NormalizeArtist(s.Artist)+"|"+store.NormalizeName(s.Track)] = true
+	}
+
+	// As with artists, a candidate keeps its best match per seed.
+	resolver := newArtistResolver()
+	type cand struct {
+		artistKey string
+		track     string
+		from      map[string]float64
+	}
+	cands := map[string]*cand{}
+	var failed int
+	for _, seed := range seeds {
+		label := seed.Artist + " - " + seed.Track
+		sim, err := sh.lastfm.SimilarTracks(ctx, seed.Artist, seed.Track, opt.SimilarPerSeedTrack)
+		if err != nil {
+			if !sh.skip(ctx, "track.getSimilar "+label, err) {
+				return err
+			}
+			if failed++; failed == len(seeds) {
+				return allFailed(failed, err)
+			}
+			continue
+		}
+		matches := make([]float64, len(sim))
+		for i, t := range sim {
+			matches[i], _ = t.Match.Float64()
+		}
+		scaleToBest(matches)
+		for i, t := range sim {
+			artist, track := strings.TrimSpace(t.Artist.Name), strings.TrimSpace(t.Name)
+			if artist == "" || track == "" {
+				continue
+			}
+			m := matches[i]
+			ak := resolver.Resolve(artist, m)
+			key := ak + "|" + store.NormalizeName(track)
+			if seedSet[key] || sh.blocked[ak] {
+				continue
+			}
+			c := cands[key]
+			if c == nil {
+				c = &cand{artistKey: ak, track: track, from: map[string]float64{}}
+				cands[key] = c
+			}
+			if cur, ok := c.from[label]; !ok || m > cur {
+				c.from[label] = m
+			}
+		}
+	}
+
+	tracks := make([]TrackCand, 0, len(cands))
+	for _, c := range cands {
+		t := TrackCand{Artist: resolver.Name(c.artistKey), Track: c.track}
+		for label := range c.from {
+			t.FromSeedTracks = append(t.FromSeedTracks, label)
+		}
+		sort.Strings(t.FromSeedTracks)
+		t.Breakdown.Similarity, t.Breakdown.Recency = blend(c.from, p.sources)
+		tracks = append(tracks, t)
+	}
+	// Keep the most similar; map order is random, so settle ties by name.
+	sort.Slice(tracks, func(i, j int) bool {
+		if si, sj := tracks[i].Breakdown.Similarity, tracks[j].Breakdown.Similarity; si != sj {
+			return si > sj
+		}
+		if tracks[i].Artist != tracks[j].Artist {
+			return tracks[i].Artist < tracks[j].Artist
+		}
+		return tracks[i].Track < tracks[j].Track
+	})
+	if len(tracks) > opt.CandidateTracksLimit {
+		tracks = tracks[:opt.CandidateTracksLimit]
+	}
+	out.Tracks = tracks
+	return localStats(ctx, env.DB, opt, tracks)
+}
+
+func (p *trackPipeline) Score(ctx context.Context, env *Env, out *Output) error {
+	mine, err := pickSeedArtists(ctx, env.DB, env.Options)
+	if err != nil {
+		return err
+	}
+	return score(ctx, env.sh, mine, out.Tracks, env.Options.Weights)
+}
+
+func (p *trackPipeline) Rank(ctx context.Context, env *Env, out *Output) error {
+	out.Tracks = rankTracks(out.Tracks, env.Options)
+	return nil
+}
+
+func unitPlural(opt Options) string {
+	if opt.Unit == UnitAlbum {
+		return "albums"
+	}
+	return "tracks"
+}
+
+// rankTracks orders candidates (unplayed first if preferred, then score,
+// then least recently played, then name), drops played ones if asked, and
+// numbers them.
+func rankTracks(tracks []TrackCand, opt Options) []TrackCand {
+	sort.SliceStable(tracks, func(i, j int) bool {
+		if opt.PreferUnplayed {
+			iUn := tracks[i].LocalPlays == 0
+			jUn := tracks[j].LocalPlays == 0
+			if iUn != jUn {
+				return iUn
+			}
+		}
+		if tracks[i].Score != tracks[j].Score {
+			return tracks[i].Score > tracks[j].Score
+		}
+		if tracks[i].LocalLastPlayedUTS != tracks[j].LocalLastPlayedUTS {
+			return tracks[i].LocalLastPlayedUTS < tracks[j].LocalLastPlayedUTS
+		}
+		if tracks[i].Artist != tracks[j].Artist {
+			return tracks[i].Artist < tracks[j].Artist
+		}
+		return tracks[i].Track < tracks[j].Track
+	})
+
+	if !opt.IncludePlayedTracks {
+		filtered := tracks[:0]
+		for _, t := range tracks {
+			if t.LocalPlays == 0 {
+				filtered = append(filtered, t)
+			}
+		}
+		tracks = filtered
+	}
+
+	for i := range tracks {
+		tracks[i].Rank = i + 1
+	}
+	return tracks
+}
+
+// pickSeedArtists picks the seed artists as opt.SeedBy asks.
+func pickSeedArtists(ctx context.Context, db *sql.DB, opt Options) ([]SeedArtist, error) {
+	if opt.SeedBy == SeedByAffinity {
+		return affinitySeedArtists(ctx, db, opt.Filter, opt.SeedArtistsLimit)
+	}
+	return seedArtists(ctx, db, opt.Filter, opt.SeedWindow, opt.SeedArtistsLimit)
+}
+
+// pickSeedTracks picks the seed tracks as opt.SeedBy asks.
+func pickSeedTracks(ctx context.Context, db *sql.DB, opt Options) ([]SeedTrack, error) {
+	if opt.SeedBy == SeedByAffinity {
+		return affinitySeedTracks(ctx, db, opt.Filter, opt.SeedTracksLimit)
+	}
+	return seedTracks(ctx, db, opt.Filter, opt.SeedWindow, opt.SeedTracksLimit)
+}
+
+func seedArtists(ctx context.Context, db *sql.DB, f store.Filter, window string, limit int) ([]SeedArtist, error) {
+	q, args := f.Scope(`
+SELECT artist_name, COUNT(*) AS plays, MAX(played_at_uts)
+FROM scrobbles
+WHERE played_at_uts >= ?
+  AND played_at_uts >= strftime('%s','now', ?)
+GROUP BY artist_name
+ORDER BY plays DESC, MAX(played_at_uts) DESC, artist_name
+LIMIT ?
+`, store.MinSaneUTS, window, limit)
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []SeedArtist{}
+	for rows.Next() {
+		var a SeedArtist
+		if err := rows.Scan(&a.Artist, &a.Plays, &a.lastPlayed); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+func seedTracks(ctx context.Context, db *sql.DB, f store.Filter, window string, limit int) ([]SeedTrack, error) {
+	q, args := f.Scope(`
+SELECT artist_name, track_name, COUNT(*) AS plays, MAX(played_at_uts)
+FROM scrobbles
+WHERE played_at_uts >= ?
+  AND played_at_uts >= strftime('%s','now', ?)
+GROUP BY artist_name, track_name
+ORDER BY plays DESC, MAX(played_at_uts) DESC, artist_name, track_name
+LIMIT ?
+`, store.MinSaneUTS, window, limit)
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []SeedTrack{}
+	for rows.Next() {
+		var t SeedTrack
+		if err := rows.Scan(&t.Artist, &t.Track, &t.Plays, &t.lastPlayed); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// affinitySeedArtists reads the highest stored artist affinities, leaving
+// out artists the filter hides entirely. Until sync (or top --by affinity)
+// has computed them there are none.
+func affinitySeedArtists(ctx context.Context, db *sql.DB, f store.Filter, limit int) ([]SeedArtist, error) {
+	q, args := f.Scope(`
+SELECT a.artist_name, a.plays, a.last_played_uts, a.score
+FROM main.artist_affinity a
+WHERE a.user_name = ? AND EXISTS (SELECT 1 FROM scrobbles s WHERE s.artist_norm = a.artist_norm)
+ORDER BY a.score DESC, a.plays DESC, a.last_played_uts DESC, a.artist_name
+LIMIT ?
+`, f.User, limit)
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []SeedArtist{}
+	for rows.Next() {
+		var a SeedArtist
+		if err := rows.Scan(&a.Artist, &a.Plays, &a.lastPlayed, &a.Affinity); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// affinitySeedTracks is affinitySeedArtists for tracks.
+func affinitySeedTracks(ctx context.Context, db *sql.DB, f store.Filter, limit int) ([]SeedTrack, error) {
+	q, args := f.Scope(`
+SELECT a.artist_name, a.track_name, a.plays, a.last_played_uts, a.score
+FROM main.track_affinity a
+WHERE a.user_name = ? AND EXISTS (SELECT 1 FROM scrobbles s WHERE s.artist_norm = a.artist_norm AND s.track_norm = a.track_norm)
+ORDER BY a.score DESC, a.plays DESC, a.last_played_uts DESC, a.artist_name, a.track_name
+LIMIT ?
+`, f.User, limit)
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []SeedTrack{}
+	for rows.Next() {
+		var t SeedTrack
+		if err := rows.Scan(&t.Artist, &t.Track, &t.Plays, &t.lastPlayed, &t.Affinity); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// holdBackRepeats penalizes (or drops) tracks and albums recommended within
+// opt.NoRepeat and re-ranks the rest.
+func holdBackRepeats(ctx context.Context, db *sql.DB, out *Output, opt Options) error {
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT artist_name, track_name, album_name FROM recommendations WHERE user_name = ? AND recommended_at_uts >= ?`,
+		opt.Filter.User, time.Now().Add(-opt.NoRepeat).Unix())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	recent := map[string]bool{}
+	for rows.Next() {
+		var artist, track, album string
+		if err := rows.Scan(&artist, &track, &album); err != nil {
+			return err
+		}
+		recent[repeatKey(artist, track, album)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// held reports whether to drop an item, or else cuts its score.
+	held := func(key string, score *float64, repeated *bool) bool {
+		if !recent[key] {
+			return false
+		}
+		if opt.RepeatPenalty >= 1 {
+			return true
+		}
+		*repeated = true
+		*score = round(*score * (1 - opt.RepeatPenalty))
+		return false
+	}
+	tracks := out.Tracks[:0]
+	for _, t := range out.Tracks {
+		if !held(repeatKey(t.Artist, t.Track, ""), &t.Score, &t.Repeated) {
+			tracks = append(tracks, t)
+		}
+	}
+	out.Tracks = rankTracks(tracks, opt)
+	if out.Albums != nil {
+		albums := out.Albums[:0]
+		for _, a := range out.Albums {
+			if !held(repeatKey(a.Artist, "", a.Album), &a.Score, &a.Repeated) {
+				albums = append(albums, a)
+			}
+		}
+		out.Albums = rankAlbums(albums, opt)
+	}
+	return nil
+}
+
+// repeatKey identifies a recommended track (album "") or album (track "").
+func repeatKey(artist, track, album string) string {
+	return store.NormalizeArtist(artist) + "|" + store.NormalizeName(track) + "|" + store.NormalizeName(album)
+}
+
+// blockedArtists reads the recommendation block list, keyed like the
+// resolver so aliases of a blocked artist are dropped too.
+func blockedArtists(ctx context.Context, db *sql.DB, user string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, `SELECT artist_name FROM recommend_blocks WHERE user_name = ?`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]bool{}
+	for rows.Next() {
+		var artist string
+		if err := rows.Scan(&artist); err != nil {
+			return nil, err
+		}
+		out[store.NormalizeArtist(artist)] = true
+	}
+	return out, rows.Err()
+}
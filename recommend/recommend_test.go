@@ -0,0 +1,106 @@
+package recommend
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+func TestLocalStats(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.Open(ctx, store.OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now().Unix()
+	for i, p := range []struct{ artist, track string }{
+		{"Beyoncé", "Halo"},
+		{"Beyonce", "halo"},
+		{"Low", "Words"},
+		{"Low", "Words"},
+	} {
+		tr := lastfm.Track{Name: p.track, Artist: lastfm.TextMBID{Text: p.artist}, Date: &lastfm.Date{UTS: strconv.FormatInt(now-int64(100*i), 10)}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.TombstoneScrobbles(ctx, store.EditMatch{PlayedAtUTS: now - 300}, store.TombstoneManual); err != nil {
+		t.Fatal(err)
+	}
+
+	// Any spelling counts, tombstones don't, and repeats are looked up once.
+	tracks := []TrackCand{{Artist: "BEYONCE", Track: "Halo"}, {Artist: "Low", Track: "Words"}, {Artist: "Grouper", Track: "Heavy Water"}, {Artist: "Beyoncé", Track: "Halo"}}
+	if err := localStats(ctx, s.DB, Options{Filter: store.Filter{User: s.User()}}, tracks); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range [][2]int64{{2, now}, {1, now - 200}, {0, 0}, {2, now}} {
+		if got := [2]int64{tracks[i].LocalPlays, tracks[i].LocalLastPlayedUTS}; got != want {
+			t.Errorf("%s - %s = %v, want %v", tracks[i].Artist, tracks[i].Track, got, want)
+		}
+	}
+}
+
+// constant recommends the same tracks every time.
+type constant struct{}
+
+func (constant) Seeds(ctx context.Context, env *Env, out *Output) error {
+	out.Meta.Algo = "constant"
+	return nil
+}
+
+func (constant) Expand(ctx context.Context, env *Env, out *Output) error {
+	for _, a := range []string{"Low", "Burial", "Grouper"} {
+		if !env.Blocked(a) {
+			out.Tracks = append(out.Tracks, TrackCand{Artist: a, Track: "Track"})
+		}
+	}
+	return nil
+}
+
+func (constant) Score(ctx context.Context, env *Env, out *Output) error {
+	for i := range out.Tracks {
+		out.Tracks[i].Score = float64(len(out.Tracks[i].Artist))
+	}
+	return nil
+}
+
+func (constant) Rank(ctx context.Context, env *Env, out *Output) error {
+	out.Tracks = rankTracks(out.Tracks, env.Options)
+	return nil
+}
+
+func TestRegisterAlgorithm(t *testing.T) {
+	ctx := context.Background()
+	s, err := store.Open(ctx, store.OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.BlockArtist(ctx, "Grouper"); err != nil {
+		t.Fatal(err)
+	}
+
+	Register("constant", func() Algorithm { return constant{} })
+	opt := DefaultOptions()
+	opt.Algo = "constant"
+	opt.Filter.User = s.User()
+	out, err := Build(ctx, s.DB, nil, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Meta.Algo != "constant" || len(out.Tracks) != 2 || out.Tracks[0].Artist != "Burial" || out.Tracks[1].Rank != 2 {
+		t.Fatalf("output = %+v", out)
+	}
+
+	opt.Algo = "nope"
+	if _, err := Build(ctx, s.DB, nil, opt); err == nil || !strings.Contains(err.Error(), "artists, constant, friends, resurface, tag, tracks") {
+		t.Fatalf("unknown algorithm error = %v", err)
+	}
+}
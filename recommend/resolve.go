@@ -0,0 +1,31 @@
+package recommend
+
+import "github.com/joshp123/lastfm-golang/store"
+
+// artistResolver maps artist keys (store.NormalizeArtist, which folds the
+// cosmetic differences Last.fm lets through between aliases of one artist)
+// to a single display name, preferring the spelling that came with the
+// strongest match (Last.fm's autocorrected form usually ranks highest).
+type artistResolver struct {
+	names map[string]string
+	best  map[string]float64
+}
+
+func newArtistResolver() *artistResolver {
+	return &artistResolver{names: map[string]string{}, best: map[string]float64{}}
+}
+
+// Resolve records name as a spelling of its key and returns the key.
+func (r *artistResolver) Resolve(name string, match float64) string {
+	k := store.NormalizeArtist(name)
+	if cur, ok := r.names[k]; !ok || match > r.best[k] || (match == r.best[k] && name < cur) {
+		r.names[k] = name
+		r.best[k] = match
+	}
+	return k
+}
+
+// Name returns the display name chosen for key.
+func (r *artistResolver) Name(key string) string {
+	return r.names[key]
+}
@@ -0,0 +1,99 @@
+package recommend
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+const resurfaceHalfLifeDays = 365
+
+// Resurfacing is what an AlgoResurface track's score is made of, each part
+// 0-1; the score is their product.
+type Resurfacing struct {
+	// Plays is the track's plays scaled to the most played candidate.
+	Plays float64 `json:"plays"`
+	// Staleness grows towards 1 with time since the last play, reaching
+	// 0.5 after a year.
+	Staleness float64 `json:"staleness"`
+	// Season is 1 when every play fell within a month of today's month (in
+	// any year) and 0.5 when none did.
+	Season float64 `json:"season"`
+}
+
+// resurface is AlgoResurface: my own tracks that were played a lot but not
+// within MinLastPlayedWindow. It reads only the database.
+type resurface struct{}
+
+func (resurface) Seeds(ctx context.Context, env *Env, out *Output) error {
+	out.Meta.Algo = "local-history->resurface"
+	return tracksOnly(env.Options)
+}
+
+// Expand lists the candidates with their staleness and season.
+func (resurface) Expand(ctx context.Context, env *Env, out *Output) error {
+	opt := env.Options
+	now := time.Now()
+	loc := opt.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	month := int(now.In(loc).Month())
+	// Plays in the current month or its neighbours, in any year.
+	q, args := opt.Filter.Scope(`
+SELECT artist_name, track_name, COUNT(*) AS plays, MAX(played_at_uts) AS last_played,
+  SUM(CASE WHEN (CAST(substr(played_date_local, 6, 2) AS INTEGER) - ? + 12) % 12 IN (0, 1, 11) THEN 1 ELSE 0 END)
+FROM scrobbles
+WHERE played_at_uts >= ?
+GROUP BY artist_name, track_name
+HAVING plays >= ? AND last_played < strftime('%s','now', ?)
+ORDER BY plays DESC, last_played DESC, artist_name, track_name
+`, month, opt.minSane(), opt.ResurfaceMinPlays, opt.MinLastPlayedWindow)
+	rows, err := env.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tracks := []TrackCand{}
+	for rows.Next() {
+		var t TrackCand
+		var inSeason int64
+		if err := rows.Scan(&t.Artist, &t.Track, &t.LocalPlays, &t.LocalLastPlayedUTS, &inSeason); err != nil {
+			return err
+		}
+		if env.Blocked(t.Artist) {
+			continue
+		}
+		days := math.Floor(now.Sub(time.Unix(t.LocalLastPlayedUTS, 0)).Hours() / 24)
+		t.Resurface = Resurfacing{
+			Staleness: round(1 - math.Pow(0.5, max(days, 0)/resurfaceHalfLifeDays)),
+			Season:    round(0.5 + 0.5*float64(inSeason)/float64(t.LocalPlays)),
+		}
+		tracks = append(tracks, t)
+	}
+	out.Tracks = tracks
+	return rows.Err()
+}
+
+// Score weighs plays against the most played candidate's.
+func (resurface) Score(ctx context.Context, env *Env, out *Output) error {
+	var most float64
+	for _, t := range out.Tracks {
+		most = max(most, float64(t.LocalPlays))
+	}
+	for i := range out.Tracks {
+		r := &out.Tracks[i].Resurface
+		r.Plays = round(float64(out.Tracks[i].LocalPlays) / most)
+		out.Tracks[i].Score = round(r.Plays * r.Staleness * r.Season)
+	}
+	return nil
+}
+
+func (resurface) Rank(ctx context.Context, env *Env, out *Output) error {
+	out.Tracks = rankTracks(out.Tracks, env.Options)
+	if len(out.Tracks) > env.Options.CandidateTracksLimit {
+		out.Tracks = out.Tracks[:env.Options.CandidateTracksLimit]
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package recommend
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ParseSeed reads --seed: a number for a reproducible run, "day" for an
+// order that changes daily but holds within a day, or "random".
+func ParseSeed(s string, now time.Time) (int64, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "day":
+		y, m, d := now.Date()
+		return int64(y*10000 + int(m)*100 + d), nil
+	case "random":
+		return now.UnixNano(), nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("recommend: bad seed %q (want a number, day or random)", s)
+	}
+	return n, nil
+}
+
+// sampleNearEqual reorders runs of ranked tracks whose scores are within
+// Options.SampleTolerance of the run's best, by weighted sampling without
+// replacement (higher scores still tend to come first). Seed 0 leaves the
+// order alone.
+func sampleNearEqual(tracks []TrackCand, opt Options) {
+	if opt.Seed == 0 {
+		return
+	}
+	rng := rand.New(rand.NewPCG(uint64(opt.Seed), 0))
+	sameRun := func(first, t TrackCand) bool {
+		if opt.PreferUnplayed && (first.LocalPlays == 0) != (t.LocalPlays == 0) {
+			return false
+		}
+		return first.Score-t.Score <= opt.SampleTolerance
+	}
+
+	keys := make([]float64, len(tracks))
+	for i, t := range tracks {
+		// Efraimidis-Spirakis: sorting by u^(1/w) samples in proportion to w.
+		keys[i] = math.Log(1-rng.Float64()) / max(t.Score, 1e-6)
+	}
+	for start := 0; start < len(tracks); {
+		end := start + 1
+		for end < len(tracks) && sameRun(tracks[start], tracks[end]) {
+			end++
+		}
+		sort.Stable(byKey{tracks[start:end], keys[start:end]})
+		start = end
+	}
+}
+
+type byKey struct {
+	tracks []TrackCand
+	keys   []float64
+}
+
+func (b byKey) Len() int           { return len(b.tracks) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] > b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.tracks[i], b.tracks[j] = b.tracks[j], b.tracks[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
@@ -0,0 +1,279 @@
+package recommend
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// Weights mix the score components; they needn't sum to 1.
+type Weights struct {
+	Similarity float64 `json:"similarity"`
+	Tags       float64 `json:"tags"`
+	Recency    float64 `json:"recency"`
+	Novelty    float64 `json:"novelty"`
+	// Obscurity biases towards artists with few Last.fm listeners; off by
+	// default, as it costs an artist.getInfo lookup per candidate artist.
+	Obscurity float64 `json:"obscurity,omitempty"`
+}
+
+func DefaultWeights() Weights {
+	return Weights{Similarity: 0.6, Tags: 0.2, Recency: 0.1, Novelty: 0.1}
+}
+
+// ParseWeights reads "similarity=0.5,tags=0.3" on top of base.
+func ParseWeights(s string, base Weights) (Weights, error) {
+	w := base
+	for _, kv := range strings.Split(s, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if !ok || err != nil || f < 0 {
+			return Weights{}, fmt.Errorf("recommend: bad weight %q (want name=number)", kv)
+		}
+		switch strings.TrimSpace(k) {
+		case "similarity":
+			w.Similarity = f
+		case "tags":
+			w.Tags = f
+		case "recency":
+			w.Recency = f
+		case "novelty":
+			w.Novelty = f
+		case "obscurity":
+			w.Obscurity = f
+		default:
+			return Weights{}, fmt.Errorf("recommend: unknown weight %q (want similarity, tags, recency, novelty or obscurity)", k)
+		}
+	}
+	if w.sum() == 0 {
+		return Weights{}, fmt.Errorf("recommend: all weights are zero")
+	}
+	return w, nil
+}
+
+// Breakdown is what a track's score is made of, each part 0-1.
+type Breakdown struct {
+	// Similarity to the seeds: each seed's matches are scaled so its best
+	// is 1, then seeds count by their share of plays.
+	Similarity float64 `json:"similarity"`
+	// TagOverlap is the cosine between the artist's tags and the seed
+	// artists' tags.
+	TagOverlap float64 `json:"tag_overlap"`
+	// Recency of the seeds behind it, halving every 30 days since they were
+	// last played.
+	Recency float64 `json:"recency"`
+	// Novelty is 1 for a track never played, 1/(1+plays) otherwise.
+	Novelty float64 `json:"novelty"`
+	// Obscurity of the artist by Last.fm listeners (see lastfm.Obscurity);
+	// only looked up when weighted, and 0 when unknown.
+	Obscurity float64 `json:"obscurity,omitempty"`
+}
+
+const recencyHalfLifeDays = 30
+
+// source is a seed (artist, track or friend) candidates were found from.
+type source struct {
+	weight  float64 // share of all seeds, summing to 1
+	recency float64
+}
+
+// seedSources weighs seeds by weights (plays or affinity) and dates them by
+// their last play, counted in whole days so a run's results don't drift by
+// the second.
+func seedSources(names []string, weights []float64, lastPlayed []int64, now time.Time) map[string]source {
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	out := make(map[string]source, len(names))
+	for i, n := range names {
+		days := math.Floor(now.Sub(time.Unix(lastPlayed[i], 0)).Hours() / 24)
+		out[n] = source{
+			weight:  weights[i] / total,
+			recency: math.Pow(0.5, max(days, 0)/recencyHalfLifeDays),
+		}
+	}
+	return out
+}
+
+// scaleToBest divides matches by the largest, so every seed's best match
+// counts as 1 however generous Last.fm is for that seed.
+func scaleToBest(m []float64) {
+	var best float64
+	for _, v := range m {
+		best = max(best, v)
+	}
+	if best == 0 {
+		return
+	}
+	for i := range m {
+		m[i] /= best
+	}
+}
+
+// blend combines a candidate's per-source matches into similarity and the
+// match-weighted recency of its sources.
+func blend(from map[string]float64, sources map[string]source) (sim, rec float64) {
+	for s, m := range from {
+		src := sources[s]
+		sim += src.weight * m
+		rec += src.weight * m * src.recency
+	}
+	if sim > 0 {
+		rec /= sim
+	}
+	return sim, rec
+}
+
+// tagVectors fetches and caches top tags per artist as name -> count/100.
+type tagVectors struct {
+	lastfm *lookups
+	cache  map[string]map[string]float64
+}
+
+func newTagVectors(lf *lookups) *tagVectors {
+	return &tagVectors{lastfm: lf, cache: map[string]map[string]float64{}}
+}
+
+// get returns artist's tag vector; a failed lookup is recorded with
+// sh.skip and counts as no tags.
+func (v *tagVectors) get(ctx context.Context, sh *shared, artist string) (map[string]float64, error) {
+	k := store.NormalizeArtist(artist)
+	if vec, ok := v.cache[k]; ok {
+		return vec, nil
+	}
+	tags, err := v.lastfm.ArtistTopTags(ctx, artist)
+	if err != nil {
+		if !sh.skip(ctx, "artist.getTopTags "+artist, err) {
+			return nil, err
+		}
+		tags = nil
+	}
+	vec := map[string]float64{}
+	for _, t := range tags {
+		vec[strings.ToLower(strings.TrimSpace(t.Name))] += float64(t.Count) / 100
+	}
+	v.cache[k] = vec
+	return vec, nil
+}
+
+func cosine(a, b map[string]float64) float64 {
+	var dot, na, nb float64
+	for k, x := range a {
+		dot += x * b[k]
+		na += x * x
+	}
+	for _, y := range b {
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// score fills in tag overlap (when weighted) and novelty, then sets each
+// track's score to the weighted mean of its breakdown.
+func score(ctx context.Context, sh *shared, seeds []SeedArtist, tracks []TrackCand, w Weights) error {
+	profile, err := tagProfile(ctx, sh, seeds, w)
+	if err != nil {
+		return err
+	}
+	for i := range tracks {
+		t := &tracks[i]
+		if t.Breakdown.TagOverlap, err = tagOverlap(ctx, sh, profile, t.Artist); err != nil {
+			return err
+		}
+		if w.Obscurity > 0 {
+			if t.Breakdown.Obscurity, err = sh.obscurity(ctx, t.Artist); err != nil {
+				return err
+			}
+		}
+		t.Score = w.mix(&t.Breakdown, t.LocalPlays)
+	}
+	return nil
+}
+
+// obscurity looks up artist's listener count (once per run); a failed or
+// missing lookup counts as 0.
+func (sh *shared) obscurity(ctx context.Context, artist string) (float64, error) {
+	k := store.NormalizeArtist(artist)
+	if v, ok := sh.obscure[k]; ok {
+		return v, nil
+	}
+	info, err := sh.lastfm.ArtistInfo(ctx, artist)
+	if err != nil && !sh.skip(ctx, "artist.getInfo "+artist, err) {
+		return 0, err
+	}
+	var v float64
+	if n := info.Listeners(); n > 0 {
+		v = round(lastfm.Obscurity(n))
+	}
+	if sh.obscure == nil {
+		sh.obscure = map[string]float64{}
+	}
+	sh.obscure[k] = v
+	return v, nil
+}
+
+// tagProfile is the seed artists' tags weighted by their plays, or nil when
+// tags aren't weighted.
+func tagProfile(ctx context.Context, sh *shared, seeds []SeedArtist, w Weights) (map[string]float64, error) {
+	if w.Tags == 0 {
+		return nil, nil
+	}
+	profile := map[string]float64{}
+	var total float64
+	for _, s := range seeds {
+		total += float64(s.Plays)
+	}
+	for _, s := range seeds {
+		vec, err := sh.tags.get(ctx, sh, s.Artist)
+		if err != nil {
+			return nil, err
+		}
+		for t, x := range vec {
+			profile[t] += x * float64(s.Plays) / total
+		}
+	}
+	return profile, nil
+}
+
+// tagOverlap is the cosine between artist's tags and profile; 0 without a
+// profile.
+func tagOverlap(ctx context.Context, sh *shared, profile map[string]float64, artist string) (float64, error) {
+	if profile == nil {
+		return 0, nil
+	}
+	vec, err := sh.tags.get(ctx, sh, artist)
+	if err != nil {
+		return 0, err
+	}
+	return round(cosine(vec, profile)), nil
+}
+
+// mix rounds b, sets its novelty from local plays and returns the weighted
+// mean of its parts.
+func (w Weights) mix(b *Breakdown, plays int64) float64 {
+	b.Similarity, b.Recency = round(b.Similarity), round(b.Recency)
+	b.Novelty = round(1 / float64(1+plays))
+	return round((w.Similarity*b.Similarity + w.Tags*b.TagOverlap + w.Recency*b.Recency + w.Novelty*b.Novelty + w.Obscurity*b.Obscurity) / w.sum())
+}
+
+func (w Weights) sum() float64 {
+	return w.Similarity + w.Tags + w.Recency + w.Novelty + w.Obscurity
+}
+
+// round keeps scores readable and stable in JSON.
+func round(x float64) float64 {
+	return math.Round(x*1e4) / 1e4
+}
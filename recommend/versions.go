@@ -0,0 +1,53 @@
+package recommend
+
+import (
+	"context"
+	"slices"
+
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+// keepVersions applies Options.Filter's version choices to the candidates,
+// which the filter can't reach since they come from Last.fm: a live
+// recording, remix or demo of a kind in ExcludeVersions is dropped, and one
+// in FoldVersions becomes its studio track, merged with that track if it is
+// a candidate too. Kinds are told by title alone (see store.ClassifyTrack).
+func keepVersions(ctx context.Context, env *Env, out *Output) error {
+	f := env.Options.Filter
+	if len(f.ExcludeVersions) == 0 && len(f.FoldVersions) == 0 {
+		return nil
+	}
+	out.Albums = slices.DeleteFunc(out.Albums, func(a AlbumCand) bool {
+		return slices.Contains(f.ExcludeVersions, store.ClassifyAlbum(a.Album))
+	})
+
+	tracks := make([]TrackCand, 0, len(out.Tracks))
+	at := map[string]int{}
+	folded := false
+	for _, t := range out.Tracks {
+		kind, base := store.ClassifyTrack(t.Track, "")
+		switch {
+		case slices.Contains(f.ExcludeVersions, kind):
+			continue
+		case slices.Contains(f.FoldVersions, kind):
+			t.Track, folded = base, true
+		}
+		key := store.NormalizeArtist(t.Artist) + "|" + store.NormalizeName(t.Track)
+		if i, ok := at[key]; ok {
+			for _, s := range t.FromSeedTracks {
+				if !slices.Contains(tracks[i].FromSeedTracks, s) {
+					tracks[i].FromSeedTracks = append(tracks[i].FromSeedTracks, s)
+				}
+			}
+			continue
+		}
+		at[key] = len(tracks)
+		tracks = append(tracks, t)
+	}
+	out.Tracks = tracks
+	if !folded {
+		return nil
+	}
+	// A folded track's plays are its studio track's.
+	return localStats(ctx, env.DB, env.Options, out.Tracks)
+}
@@ -0,0 +1,158 @@
+// Package report renders a digest as a self-contained static HTML page:
+// data, styles and charts are inlined, so the page makes no external calls.
+package report
+
+import (
+	"context"
+	_ "embed"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/digest"
+	"github.com/joshp123/lastfm-golang/store"
+)
+
+//go:embed report.html.tmpl
+var pageTemplate string
+
+var page = template.Must(template.New("report").Parse(pageTemplate))
+
+// Day is the play count for one UTC day.
+type Day struct {
+	Day   string `json:"day"`
+	Plays int64  `json:"plays"`
+}
+
+// Streak is a run of consecutive UTC days with at least one scrobble.
+type Streak struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Days  int    `json:"days"`
+	Plays int64  `json:"plays"`
+}
+
+type Streaks struct {
+	Longest []Streak `json:"longest"`
+	Current Streak   `json:"current"`
+}
+
+// Options configures Build.
+type Options struct {
+	Title  string
+	Digest digest.Options
+
+	// StreaksLimit is how many of the longest streaks to list.
+	StreaksLimit int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Title:        "Listening stats",
+		Digest:       digest.DefaultOptions(),
+		StreaksLimit: 10,
+	}
+}
+
+// Report is the data behind the page.
+type Report struct {
+	Title  string        `json:"title"`
+	Digest digest.Digest `json:"digest"`
+}
+
+// Build computes the digest plus the "daily" and "streaks" sections the
+// heatmap and streak panels need.
+func Build(ctx context.Context, s *store.Store, opt Options) (Report, error) {
+	dopt := opt.Digest
+	dopt.Sections = append(dopt.Sections[:len(dopt.Sections):len(dopt.Sections)],
+		digest.SectionFunc("daily", func(ctx context.Context, db digest.Querier, _ digest.Options) (any, error) {
+			return dailyPlays(ctx, db, s.MinSaneUTS())
+		}),
+		digest.SectionFunc("streaks", func(ctx context.Context, db digest.Querier, _ digest.Options) (any, error) {
+			days, err := dailyPlays(ctx, db, s.MinSaneUTS())
+			if err != nil {
+				return nil, err
+			}
+			loc := dopt.Location
+			if loc == nil {
+				loc = s.Location()
+			}
+			return streaks(days, time.Now().In(loc), opt.StreaksLimit), nil
+		}),
+	)
+	d, err := digest.Build(ctx, s, dopt)
+	if err != nil {
+		return Report{}, err
+	}
+	return Report{Title: opt.Title, Digest: d}, nil
+}
+
+// Render writes r as a single HTML document.
+func Render(w io.Writer, r Report) error {
+	return page.Execute(w, r)
+}
+
+// dailyPlays counts the plays of each local day, from minSane on.
+func dailyPlays(ctx context.Context, db digest.Querier, minSane int64) ([]Day, error) {
+	rows, err := db.QueryContext(ctx, `
+SELECT played_date_local AS day, COUNT(*)
+FROM scrobbles
+WHERE played_at_uts >= ?
+GROUP BY day
+ORDER BY day ASC
+`, minSane)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Day
+	for rows.Next() {
+		var d Day
+		if err := rows.Scan(&d.Day, &d.Plays); err != nil {
+			return nil, err
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// streaks finds runs of consecutive days in days (ascending). The current
+// streak is the one ending today or yesterday, so it isn't broken before
+// today's first play.
+func streaks(days []Day, now time.Time, limit int) Streaks {
+	var all []Streak
+	var prev time.Time
+	for _, d := range days {
+		t, err := time.Parse(time.DateOnly, d.Day)
+		if err != nil {
+			continue
+		}
+		if n := len(all); n > 0 && t.Sub(prev) == 24*time.Hour {
+			all[n-1].End = d.Day
+			all[n-1].Days++
+			all[n-1].Plays += d.Plays
+		} else {
+			all = append(all, Streak{Start: d.Day, End: d.Day, Days: 1, Plays: d.Plays})
+		}
+		prev = t
+	}
+
+	var out Streaks
+	today := now.Format(time.DateOnly)
+	yesterday := now.AddDate(0, 0, -1).Format(time.DateOnly)
+	if n := len(all); n > 0 && (all[n-1].End == today || all[n-1].End == yesterday) {
+		out.Current = all[n-1]
+	}
+
+	// Longest first; earlier streaks win ties.
+	sorted := make([]Streak, len(all))
+	copy(sorted, all)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Days > sorted[j].Days })
+	if len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+	out.Longest = sorted
+	return out
+}
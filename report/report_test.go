@@ -0,0 +1,35 @@
+package report
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreaks(t *testing.T) {
+	days := []Day{
+		{"2024-01-01", 3}, {"2024-01-02", 1},
+		{"2024-01-05", 2}, {"2024-01-06", 2}, {"2024-01-07", 1},
+		{"2024-01-09", 4}, {"2024-01-10", 5},
+	}
+	now := time.Date(2024, 1, 11, 12, 0, 0, 0, time.UTC)
+
+	got := streaks(days, now, 2)
+	if len(got.Longest) != 2 {
+		t.Fatalf("longest: got %d streaks, want 2", len(got.Longest))
+	}
+	if l := got.Longest[0]; l.Start != "2024-01-05" || l.End != "2024-01-07" || l.Days != 3 || l.Plays != 5 {
+		t.Errorf("longest[0] = %+v", l)
+	}
+	// Ties keep chronological order.
+	if l := got.Longest[1]; l.Start != "2024-01-01" || l.Days != 2 {
+		t.Errorf("longest[1] = %+v", l)
+	}
+	// The streak ending yesterday is still current.
+	if c := got.Current; c.Start != "2024-01-09" || c.Days != 2 || c.Plays != 9 {
+		t.Errorf("current = %+v", c)
+	}
+
+	if got := streaks(days, now.AddDate(0, 0, 2), 10); got.Current.Days != 0 {
+		t.Errorf("current after a gap = %+v, want none", got.Current)
+	}
+}
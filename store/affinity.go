@@ -0,0 +1,258 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Affinity weighs how attached the listener is to an artist or track,
+// beyond raw play counts: plays decayed by age (halving every
+// AffinityHalfLife), times 1 + ln(years)/2 for the calendar years they span,
+// times a boost for loved tracks (AffinityLovedBoost for a loved track;
+// AffinityLovedArtistBoost per loved track of an artist's, up to
+// AffinityLovedArtistMax of them). Sync stores each artist's and track's in
+// artist_affinity and track_affinity, as of then.
+const (
+	AffinityHalfLife         = 365 * 24 * time.Hour
+	AffinityLovedBoost       = 0.5
+	AffinityLovedArtistBoost = 0.1
+	AffinityLovedArtistMax   = 5
+)
+
+// affinityStateKey records when the affinity tables were last computed.
+const affinityStateKey = "affinity_computed_uts"
+
+var affinityTables = `
+CREATE TABLE IF NOT EXISTS loved_tracks (
+  user_name TEXT NOT NULL,
+  artist_norm TEXT NOT NULL,
+  track_norm TEXT NOT NULL,
+  artist_name TEXT NOT NULL,
+  track_name TEXT NOT NULL,
+  loved_at_uts INTEGER NOT NULL,
+
+  PRIMARY KEY (user_name, artist_norm, track_norm)
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS artist_affinity (
+  user_name TEXT NOT NULL,
+  artist_norm TEXT NOT NULL,
+  artist_name TEXT NOT NULL,
+  plays INTEGER NOT NULL,
+  years INTEGER NOT NULL,
+  loved INTEGER NOT NULL,
+  last_played_uts INTEGER NOT NULL,
+  score REAL NOT NULL,
+
+  PRIMARY KEY (user_name, artist_norm)
+) WITHOUT ROWID;
+CREATE INDEX IF NOT EXISTS idx_artist_affinity_score ON artist_affinity(user_name, score);
+
+CREATE TABLE IF NOT EXISTS track_affinity (
+  user_name TEXT NOT NULL,
+  artist_norm TEXT NOT NULL,
+  track_norm TEXT NOT NULL,
+  artist_name TEXT NOT NULL,
+  track_name TEXT NOT NULL,
+  plays INTEGER NOT NULL,
+  years INTEGER NOT NULL,
+  loved INTEGER NOT NULL,
+  last_played_uts INTEGER NOT NULL,
+  score REAL NOT NULL,
+
+  PRIMARY KEY (user_name, artist_norm, track_norm)
+) WITHOUT ROWID;
+CREATE INDEX IF NOT EXISTS idx_track_affinity_score ON track_affinity(user_name, score);
+`
+
+// LovedTrack is a track the listener loved on Last.fm.
+type LovedTrack struct {
+	Artist     string
+	Track      string
+	LovedAtUTS int64
+}
+
+// SetLovedTracks replaces the user's loved tracks.
+func (s *Store) SetLovedTracks(ctx context.Context, loved []LovedTrack) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM loved_tracks WHERE user_name = ?`, s.user); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO loved_tracks(user_name, artist_norm, track_norm, artist_name, track_name, loved_at_uts)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT DO UPDATE SET loved_at_uts = MAX(loved_at_uts, excluded.loved_at_uts)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, l := range loved {
+		if _, err := stmt.ExecContext(ctx, s.user, NormalizeArtist(l.Artist), NormalizeName(l.Track), l.Artist, l.Track, l.LovedAtUTS); err != nil {
+			return err
+		}
+	}
+	return s.commit(tx)
+}
+
+// Affinity is an artist's or track's affinity score (see AffinityHalfLife)
+// with what went into it. Loved is 0 or 1 for a track, and how many of the
+// artist's tracks are loved for an artist.
+type Affinity struct {
+	Artist string
+	// Track is "" for an artist.
+	Track         string
+	Plays         int64
+	Years         int
+	Loved         int
+	LastPlayedUTS int64
+	Score         float64
+}
+
+// affinityQuery scores the artists (or with tracks, tracks) in scrobbles
+// (see affinityArgs for its arguments), with loved tracks those of the
+// users lovedUser matches (over alias l), whose arguments follow. Its
+// columns are those of the affinity tables after user_name.
+func affinityQuery(tracks bool, lovedUser string) string {
+	key, names := "artist_norm", "MIN(artist_name) AS artist_name"
+	loved := "(SELECT COUNT(DISTINCT l.track_norm) FROM main.loved_tracks l WHERE " + lovedUser + " AND l.artist_norm = b.artist_norm)"
+	boost := "min(loved, " + strconv.Itoa(AffinityLovedArtistMax) + ") * " + strconv.FormatFloat(AffinityLovedArtistBoost, 'f', -1, 64)
+	if tracks {
+		key, names = "artist_norm, track_norm", "MIN(artist_name) AS artist_name, MIN(track_name) AS track_name"
+		loved = "EXISTS (SELECT 1 FROM main.loved_tracks l WHERE " + lovedUser + " AND l.artist_norm = b.artist_norm AND l.track_norm = b.track_norm)"
+		boost = "loved * " + strconv.FormatFloat(AffinityLovedBoost, 'f', -1, 64)
+	}
+	return `
+WITH affinity_base AS (
+  SELECT ` + key + `, ` + names + `, COUNT(*) AS plays, COUNT(DISTINCT played_year_local) AS years,
+    MAX(played_at_uts) AS last_played_uts, SUM(pow(0.5, max(? - played_at_uts, 0) / ?)) AS decayed
+  FROM scrobbles
+  WHERE played_at_uts >= ?
+  GROUP BY ` + key + `
+),
+affinity_loved AS (
+  SELECT b.*, ` + loved + ` AS loved FROM affinity_base b
+)
+SELECT ` + key + `, ` + trackNames(tracks) + `, plays, years, loved, last_played_uts,
+  decayed * (1 + ln(years) / 2) * (1 + ` + boost + `) AS score
+FROM affinity_loved`
+}
+
+func trackNames(tracks bool) string {
+	if tracks {
+		return "artist_name, track_name"
+	}
+	return "artist_name"
+}
+
+// affinityArgs are affinityQuery's arguments as of now, for plays from
+// minSane on.
+func affinityArgs(now time.Time, minSane int64) []any {
+	return []any{now.Unix(), AffinityHalfLife.Seconds(), minSane}
+}
+
+// RefreshAffinity recomputes the user's artist_affinity and track_affinity
+// as of now.
+func (s *Store) RefreshAffinity(ctx context.Context, now time.Time) error {
+	f := Filter{User: s.user}
+	lovedUser, largs := f.userIn("l.user_name")
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, tracks := range []bool{false, true} {
+		table, cols := "artist_affinity", "artist_norm, artist_name"
+		if tracks {
+			table, cols = "track_affinity", "artist_norm, track_norm, artist_name, track_name"
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_name = ?`, s.user); err != nil {
+			return err
+		}
+		q, args := f.Scope(affinityQuery(tracks, lovedUser), append(affinityArgs(now, s.minSane), largs...)...)
+		q = `INSERT INTO ` + table + `(user_name, ` + cols + `, plays, years, loved, last_played_uts, score)
+SELECT ?, * FROM (` + q + `)`
+		if _, err := tx.ExecContext(ctx, q, append([]any{s.user}, args...)...); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, setStateSQL, s.user, affinityStateKey, strconv.FormatInt(now.Unix(), 10)); err != nil {
+		return err
+	}
+	return s.commit(tx)
+}
+
+// AffinityComputedAt is when RefreshAffinity last ran for the user; zero if
+// never.
+func (s *Store) AffinityComputedAt(ctx context.Context) (time.Time, error) {
+	v, err := s.GetState(ctx, affinityStateKey)
+	if err != nil || v == "" {
+		return time.Time{}, err
+	}
+	uts, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(uts, 0), nil
+}
+
+// TopAffinity returns the limit artists (or with tracks, tracks) the filter
+// keeps with the highest affinity. It reads the stored scores, leaving out
+// the names the filter hides entirely; a filter that cuts out periods or
+// versions, merges users, (for artists) hides single tracks or (for
+// tracks) folds versions changes the scores themselves, so they are
+// computed afresh, as of now.
+func (s *Store) TopAffinity(ctx context.Context, f Filter, tracks bool, limit int) ([]Affinity, error) {
+	f.User = s.user
+	table, key, names, order := "artist_affinity", "a.artist_norm = s.artist_norm", "a.artist_name, ''", "a.score DESC, a.plays DESC, a.last_played_uts DESC, a.artist_name ASC"
+	if tracks {
+		table, key, names = "track_affinity", "a.artist_norm = s.artist_norm AND a.track_norm = s.track_norm", "a.artist_name, a.track_name"
+		order += ", a.track_name ASC"
+	}
+	live := len(f.ExcludeRanges) > 0 || len(f.AlsoUsers) > 0 || len(f.ExcludeVersions) > 0 || (tracks && len(f.FoldVersions) > 0)
+	if f.HideIgnored && !tracks && !live {
+		ucond, uargs := f.userIn("user_name")
+		if err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM ignores WHERE `+ucond+` AND track_name != '')`, uargs...).Scan(&live); err != nil {
+			return nil, err
+		}
+	}
+
+	var q string
+	var args []any
+	if live {
+		lovedUser, largs := f.userIn("l.user_name")
+		q, args = f.Scope(affinityQuery(tracks, lovedUser), append(affinityArgs(time.Now(), s.minSane), largs...)...)
+		q = `SELECT ` + names + `, a.plays, a.years, a.loved, a.last_played_uts, a.score
+FROM (` + q + `) a
+ORDER BY ` + order + `
+LIMIT ?`
+		args = append(args, limit)
+	} else {
+		q, args = f.Scope(`
+SELECT `+names+`, a.plays, a.years, a.loved, a.last_played_uts, a.score
+FROM main.`+table+` a
+WHERE a.user_name = ? AND EXISTS (SELECT 1 FROM scrobbles s WHERE `+key+`)
+ORDER BY `+order+`
+LIMIT ?
+`, s.user, limit)
+	}
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Affinity{}
+	for rows.Next() {
+		var a Affinity
+		if err := rows.Scan(&a.Artist, &a.Track, &a.Plays, &a.Years, &a.Loved, &a.LastPlayedUTS, &a.Score); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
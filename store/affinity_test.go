@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+func TestAffinity(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	play := func(artist, track string, at time.Time) {
+		t.Helper()
+		tr := lastfm.Track{Name: track, Artist: lastfm.TextMBID{Text: artist}, Date: &lastfm.Date{UTS: strconv.FormatInt(at.Unix(), 10)}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Low: one play a year for five years; Burial: five yesterday;
+	// Grouper: two a year ago, loved.
+	for y := 1; y <= 5; y++ {
+		play("Low", "Words", now.AddDate(-y, 0, 0))
+	}
+	for i := range 5 {
+		play("Burial", "Archangel", now.AddDate(0, 0, -1).Add(time.Duration(i)*time.Minute))
+	}
+	play("Grouper", "Heavy Water", now.AddDate(-1, 0, 0))
+	play("Grouper", "Heavy Water", now.AddDate(-1, 0, 0).Add(time.Minute))
+	if err := s.SetLovedTracks(ctx, []LovedTrack{{Artist: "grouper", Track: "HEAVY WATER", LovedAtUTS: now.Unix()}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RefreshAffinity(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if at, err := s.AffinityComputedAt(ctx); err != nil || at.Unix() != now.Unix() {
+		t.Fatalf("computed at %v, %v", at, err)
+	}
+
+	show := func(as []Affinity) string {
+		var out string
+		for _, a := range as {
+			out += fmt.Sprintf("%s/%s %d plays %d years %d loved %.2f; ", a.Artist, a.Track, a.Plays, a.Years, a.Loved, a.Score)
+		}
+		return out
+	}
+	// Cutting out a period nowhere near computes them afresh.
+	live := Filter{ExcludeRanges: []TimeRange{{From: 1, To: 2}}}
+	for _, f := range []Filter{{}, live} {
+		artists, err := s.TopAffinity(ctx, f, false, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(artists) != 3 || artists[0].Artist != "Burial" || artists[1].Artist != "Low" || artists[1].Years < 5 || artists[2].Loved != 1 {
+			t.Errorf("artists (live %v) = %s", f.Redacts(), show(artists))
+		}
+		tracks, err := s.TopAffinity(ctx, f, true, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The loved track gains half again.
+		if len(tracks) != 3 || tracks[2].Track != "Heavy Water" || tracks[2].Loved != 1 || math.Abs(tracks[2].Score-1.5) > 0.01 {
+			t.Errorf("tracks (live %v) = %s", f.Redacts(), show(tracks))
+		}
+	}
+
+	// Names the filter hides drop out of the stored scores.
+	artists, err := s.TopAffinity(ctx, Filter{ExcludeArtists: []string{"burial"}}, false, 10)
+	if err != nil || len(artists) != 2 || artists[0].Artist != "Low" {
+		t.Errorf("artists without Burial = %s, %v", show(artists), err)
+	}
+}
@@ -0,0 +1,77 @@
+package store
+
+import "context"
+
+// BingeMinPlays is the fewest plays a binge can have, so a day of two plays
+// of one artist doesn't count.
+const BingeMinPlays = 5
+
+// Binge is a local day, or week, that one artist or album had more than a
+// given share of.
+type Binge struct {
+	// Start is the day, or the Monday the week starts on (YYYY-MM-DD, in the
+	// home time zone).
+	Start  string
+	Artist string
+	// Album is "" for an artist's binge.
+	Album string
+	Plays int64
+	// Total counts every play in the period.
+	Total int64
+}
+
+// Binges lists the days (or with week, Monday-to-Sunday weeks) in which one
+// artist (or with albums, one album) had more than minShare of the plays the
+// filter keeps, and at least BingeMinPlays: the limit biggest, most plays
+// first.
+func (s *Store) Binges(ctx context.Context, f Filter, week, albums bool, minShare float64, limit int) ([]Binge, error) {
+	f.User = s.user
+	period := "played_date_local"
+	if week {
+		period = "date(played_date_local, '-' || ((CAST(strftime('%w', played_date_local) AS INTEGER) + 6) % 7) || ' days')"
+	}
+	key, albumCond := "artist_norm", ""
+	if albums {
+		key, albumCond = "artist_norm, album_norm", "WHERE album_norm != ''"
+	}
+	q, args := f.Scope(`
+WITH p AS (
+  SELECT `+period+` AS start, artist_norm, album_norm, artist_name, album_name
+  FROM scrobbles
+  WHERE played_at_uts >= ?
+),
+totals AS (
+  SELECT start, COUNT(*) AS total FROM p GROUP BY start
+),
+counts AS (
+  SELECT start, MIN(artist_name) AS artist, COALESCE(MIN(album_name), '') AS album, COUNT(*) AS plays
+  FROM p
+  `+albumCond+`
+  GROUP BY start, `+key+`
+)
+SELECT c.start, c.artist, c.album, c.plays, t.total
+FROM counts c
+JOIN totals t ON t.start = c.start
+WHERE c.plays >= ? AND c.plays > ? * t.total
+ORDER BY c.plays DESC, c.start ASC, c.artist ASC, c.album ASC
+LIMIT ?
+`, s.minSane, BingeMinPlays, minShare, limit)
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Binge{}
+	for rows.Next() {
+		var b Binge
+		if err := rows.Scan(&b.Start, &b.Artist, &b.Album, &b.Plays, &b.Total); err != nil {
+			return nil, err
+		}
+		if !albums {
+			b.Album = ""
+		}
+		out = append(out, b)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// BlockArtist keeps an artist out of recommendations. It reports false if the
+// artist was already blocked.
+func (s *Store) BlockArtist(ctx context.Context, artist string) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `INSERT OR IGNORE INTO recommend_blocks (user_name, artist_name, added_at_uts) VALUES (?, ?, ?)`,
+		s.user, artist, time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// UnblockArtist lets an artist be recommended again, reporting whether it was blocked.
+func (s *Store) UnblockArtist(ctx context.Context, artist string) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM recommend_blocks WHERE user_name = ? AND artist_name = ?`, s.user, artist)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// BlockedArtists lists the recommendation block list by name.
+func (s *Store) BlockedArtists(ctx context.Context) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT artist_name FROM recommend_blocks WHERE user_name = ? ORDER BY artist_name`, s.user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var a string
+		if err := rows.Scan(&a); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+// A play is judged by the gap to the next scrobble, as Last.fm dates a
+// scrobble when the track started. Knowing the track's duration (cached by
+// sync from track.getInfo), a gap under FullShare of it means the track
+// was cut short, anything longer a full listen. Without a duration only a
+// gap under ShortGap tells: a partial listen. The rest, and the last play,
+// stay unknown.
+const (
+	FullShare = 0.85
+	ShortGap  = 30 * time.Second
+)
+
+// Completion estimates how often a track, or album, was listened to the
+// end. Full and Partial count the plays judged so; Rate is Full out of both
+// (0 if none were).
+type Completion struct {
+	Artist string
+	// Album is "" for a track.
+	Album string
+	// Track is "" for an album.
+	Track string
+	// Duration is the track's length, 0 if unknown or for an album.
+	Duration time.Duration
+	Plays    int64
+	Full     int64
+	Partial  int64
+	Rate     float64
+}
+
+// CompletionRates estimates the completion of the tracks (or with albums,
+// albums) the filter keeps played within r, from the gaps between
+// consecutive scrobbles. It lists the limit with the most full listens
+// first: a top list that discounts skipped plays.
+func (s *Store) CompletionRates(ctx context.Context, f Filter, r TimeRange, albums bool, limit int) ([]Completion, error) {
+	f.User = s.user
+	durations, err := s.trackDurations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	where, wargs := r.where()
+	q, args := f.Scope(`
+SELECT artist_name, track_name, COALESCE(album_name, ''), artist_norm, track_norm, album_norm,
+  LEAD(played_at_uts) OVER (PARTITION BY user_name ORDER BY played_at_uts) - played_at_uts
+FROM scrobbles
+WHERE played_at_uts >= ? AND `+where, append([]any{s.minSane}, wargs...)...)
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byKey := map[string]*Completion{}
+	for rows.Next() {
+		var artist, track, album, artistNorm, trackNorm, albumNorm string
+		var gap *int64
+		if err := rows.Scan(&artist, &track, &album, &artistNorm, &trackNorm, &albumNorm, &gap); err != nil {
+			return nil, err
+		}
+		if albums && album == "" {
+			continue
+		}
+		key := artistNorm + "\x00" + trackNorm
+		if albums {
+			key = artistNorm + "\x00" + albumNorm
+		}
+		c := byKey[key]
+		if c == nil {
+			c = &Completion{Artist: artist}
+			if albums {
+				c.Album = album
+			} else {
+				c.Track = track
+			}
+			byKey[key] = c
+		}
+		d := durations[strings.ToLower(strings.TrimSpace(artist+"|"+track))]
+		if !albums {
+			c.Duration = d
+		}
+		c.Plays++
+		if gap == nil {
+			continue
+		}
+		switch g := time.Duration(*gap) * time.Second; {
+		case d > 0 && g >= time.Duration(float64(d)*FullShare):
+			c.Full++
+		case d > 0 || g < ShortGap:
+			c.Partial++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]Completion, 0, len(byKey))
+	for _, c := range byKey {
+		if judged := c.Full + c.Partial; judged > 0 {
+			c.Rate = math.Round(float64(c.Full)/float64(judged)*1000) / 1000
+		}
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.Full != b.Full {
+			return a.Full > b.Full
+		}
+		if a.Plays != b.Plays {
+			return a.Plays > b.Plays
+		}
+		if a.Artist != b.Artist {
+			return a.Artist < b.Artist
+		}
+		return a.Album+"\x00"+a.Track < b.Album+"\x00"+b.Track
+	})
+	if limit >= 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// trackDurations reads the durations sync cached from track.getInfo, keyed
+// like the cache: "artist|track", lowercased. Tracks Last.fm didn't know,
+// or gave no duration for, are left out.
+func (s *Store) trackDurations(ctx context.Context) (map[string]time.Duration, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT key, body FROM lastfm_cache WHERE method = 'track.getInfo'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]time.Duration{}
+	for rows.Next() {
+		var key, body string
+		if err := rows.Scan(&key, &body); err != nil {
+			return nil, err
+		}
+		var info lastfm.TrackInfo
+		if json.Unmarshal([]byte(body), &info) != nil {
+			continue
+		}
+		if d := info.Length(); d > 0 {
+			out[key] = d
+		}
+	}
+	return out, rows.Err()
+}
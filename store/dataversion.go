@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// DataVersion returns a token that changes whenever the data a digest of f
+// reads does: the users' scrobbles (count and newest play), their edits and
+// tombstones, ignore lists and rank history, the cached Last.fm listener
+// counts and what MusicBrainz said of their MBIDs, and the store's minimum
+// sane timestamp. It is for caching results derived from them, not for
+// display.
+func (s *Store) DataVersion(ctx context.Context, f Filter) (string, error) {
+	if f.User == "" {
+		f.User = s.user
+	}
+	ucond, uargs := f.userIn("user_name")
+	var args []any
+	for range 9 {
+		args = append(args, uargs...)
+	}
+	var scrobbles, maxPlayed, maxEdit, deleted, maxDeleted, ignores, maxIgnored, charts, infos, maxFetched, mbids, maxMBFetched int64
+	var lastChart string
+	err := s.DB.QueryRowContext(ctx, `
+SELECT
+  (SELECT COUNT(*) FROM scrobbles WHERE `+ucond+` AND deleted_at_uts IS NULL),
+  (SELECT COALESCE(MAX(played_at_uts), 0) FROM scrobbles WHERE `+ucond+` AND deleted_at_uts IS NULL),
+  (SELECT COALESCE(MAX(id), 0) FROM edits WHERE `+ucond+`),
+  (SELECT COUNT(*) FROM scrobbles WHERE `+ucond+` AND deleted_at_uts IS NOT NULL),
+  (SELECT COALESCE(MAX(deleted_at_uts), 0) FROM scrobbles WHERE `+ucond+` AND deleted_at_uts IS NOT NULL),
+  (SELECT COUNT(*) FROM ignores WHERE `+ucond+`),
+  (SELECT COALESCE(MAX(added_at_uts), 0) FROM ignores WHERE `+ucond+`),
+  (SELECT COUNT(*) FROM artist_rank_history WHERE `+ucond+`),
+  (SELECT COALESCE(MAX(chart_date), '') FROM artist_rank_history WHERE `+ucond+`),
+  (SELECT COUNT(*) FROM lastfm_cache WHERE method = 'artist.getInfo'),
+  (SELECT COALESCE(MAX(fetched_at_uts), 0) FROM lastfm_cache WHERE method = 'artist.getInfo'),
+  (SELECT COUNT(*) FROM musicbrainz_artists) + (SELECT COUNT(*) FROM musicbrainz_releases),
+  MAX((SELECT COALESCE(MAX(fetched_at_uts), 0) FROM musicbrainz_artists), (SELECT COALESCE(MAX(fetched_at_uts), 0) FROM musicbrainz_releases))
+`, args...).Scan(&scrobbles, &maxPlayed, &maxEdit, &deleted, &maxDeleted, &ignores, &maxIgnored, &charts, &lastChart, &infos, &maxFetched, &mbids, &maxMBFetched)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%d.%d.%d.%d.%d.%d.%d.%s.%d.%d.%d.%d.%d", scrobbles, maxPlayed, maxEdit, deleted, maxDeleted, ignores, maxIgnored, charts, lastChart, infos, maxFetched, mbids, maxMBFetched, s.minSane), nil
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// minSaneStateKey records the user's minimum sane timestamp; none means
+// MinSaneUTS.
+const minSaneStateKey = "min_sane_uts"
+
+// DateRepairMaxGap is how far apart the scrobbles stored either side of a
+// placeholder-dated one may be for RepairDates to date it between them;
+// further apart, they weren't fetched in one go.
+const DateRepairMaxGap = 6 * time.Hour
+
+// userMinSane is the minimum sane timestamp of the user named in column
+// user, for the first-played SQL since schema 14.
+func userMinSane(user string) string {
+	return `COALESCE((SELECT CAST(value AS INTEGER) FROM state WHERE user_name = ` + user + ` AND key = '` + minSaneStateKey + `'), ` + strconv.Itoa(MinSaneUTS) + `)`
+}
+
+// MinSaneUTS is the store's minimum sane timestamp: scrobbles dated before
+// it are placeholders, counted as suspect and left out of everything dated.
+func (s *Store) MinSaneUTS() int64 {
+	return s.minSane
+}
+
+// useMinSane loads the minimum sane timestamp: uts if not 0, else the one
+// last used (MinSaneUTS at first). A new one recounts the first plays, once.
+func (s *Store) useMinSane(ctx context.Context, uts int64) error {
+	stored := int64(MinSaneUTS)
+	v, err := s.GetState(ctx, minSaneStateKey)
+	if err != nil {
+		return err
+	}
+	if v != "" {
+		if stored, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return fmt.Errorf("stored minimum sane timestamp %q: %w", v, err)
+		}
+	}
+	if uts == 0 {
+		uts = stored
+	}
+	s.minSane = uts
+	if uts == stored {
+		return nil
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, setStateSQL, s.user, minSaneStateKey, strconv.FormatInt(uts, 10)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, firstPlayedRebuild(userMinSane)); err != nil {
+		return err
+	}
+	return s.commit(tx)
+}
+
+// DateRepair is a placeholder-dated scrobble and the date RepairDates can
+// give it. Before and After are when the scrobbles stored either side of it
+// (from the same source) were played, so it was played between them.
+type DateRepair struct {
+	Hash          string
+	Artist        string
+	Track         string
+	PlayedAtUTS   int64
+	Before, After int64
+	// NewUTS is the date to set; 0 if there is none to go by (no stored
+	// neighbour, or they are over DateRepairMaxGap apart).
+	NewUTS int64
+	// Refetched is set when Last.fm had the play dated; otherwise NewUTS is
+	// interpolated, spreading a run of placeholders evenly between their
+	// neighbours.
+	Refetched bool
+}
+
+// PlanDateRepairs lists the user's live scrobbles dated before MinSaneUTS,
+// in the order they were stored, each dated by interpolation if it can be.
+// That takes a placeholder stored between two dated scrobbles, as when one
+// run fetched the plays before it and a later one those after; Last.fm lists
+// placeholders after everything dated, so those a single backfill stores
+// last have nothing after them and stay undated.
+func (s *Store) PlanDateRepairs(ctx context.Context) ([]DateRepair, error) {
+	neighbour := func(cmp, order string) string {
+		return `(SELECT n.played_at_uts FROM scrobbles n
+    WHERE n.user_name = s.user_name AND n.source = s.source AND n.rowid ` + cmp + ` s.rowid
+      AND n.deleted_at_uts IS NULL AND n.played_at_uts >= ?
+    ORDER BY n.rowid ` + order + ` LIMIT 1)`
+	}
+	rows, err := s.DB.QueryContext(ctx, `
+SELECT s.source_hash, s.artist_name, s.track_name, s.played_at_uts,
+  COALESCE(`+neighbour("<", "DESC")+`, 0),
+  COALESCE(`+neighbour(">", "ASC")+`, 0)
+FROM scrobbles s
+WHERE s.user_name = ? AND s.deleted_at_uts IS NULL AND s.played_at_uts < ?
+ORDER BY s.rowid
+`, s.minSane, s.minSane, s.user, s.minSane)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []DateRepair{}
+	for rows.Next() {
+		var r DateRepair
+		if err := rows.Scan(&r.Hash, &r.Artist, &r.Track, &r.PlayedAtUTS, &r.Before, &r.After); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Placeholders stored in a row share their neighbours.
+	for i := 0; i < len(out); {
+		j := i + 1
+		for j < len(out) && out[j].Before == out[i].Before && out[j].After == out[i].After {
+			j++
+		}
+		a, b := out[i].Before, out[i].After
+		if a != 0 && b != 0 && time.Duration(max(a-b, b-a))*time.Second <= DateRepairMaxGap {
+			n := int64(j - i + 1)
+			for k := i; k < j; k++ {
+				out[k].NewUTS = a + (b-a)*int64(k-i+1)/n
+			}
+		}
+		i = j
+	}
+	return out, nil
+}
+
+// ApplyDateRepairs sets the new dates of repairs (those with a NewUTS) in
+// one transaction, recording each in the edits table as a played_at_uts
+// change. source_hash is kept, so the placeholder still dedupes if Last.fm
+// returns it again. It returns the result as EditScrobbles would.
+func (s *Store) ApplyDateRepairs(ctx context.Context, repairs []DateRepair) (EditResult, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return EditResult{}, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	var res EditResult
+	for _, r := range repairs {
+		if r.NewUTS == 0 {
+			continue
+		}
+		date, year := localDate(r.NewUTS, s.loc)
+		u, err := tx.ExecContext(ctx, `
+UPDATE scrobbles SET played_at_uts = ?, played_date_local = ?, played_year_local = ?
+WHERE user_name = ? AND source_hash = ? AND played_at_uts = ?
+`, r.NewUTS, date, year, s.user, r.Hash, r.PlayedAtUTS)
+		if err != nil {
+			return EditResult{}, err
+		}
+		if n, _ := u.RowsAffected(); n == 0 {
+			continue
+		}
+		oldV, newV := strconv.FormatInt(r.PlayedAtUTS, 10), strconv.FormatInt(r.NewUTS, 10)
+		if _, err := tx.ExecContext(ctx, `
+INSERT INTO edits (user_name, edited_at_uts, scrobble_hash, played_at_uts, field, old_value, new_value)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+`, s.user, now, r.Hash, r.PlayedAtUTS, "played_at_uts", oldV, newV); err != nil {
+			return EditResult{}, err
+		}
+		res.Changes = append(res.Changes, Edit{EditedAtUTS: now, ScrobbleHash: r.Hash, PlayedAtUTS: r.PlayedAtUTS, Field: "played_at_uts", OldValue: oldV, NewValue: newV})
+		res.Rows++
+		res.Fields++
+		if res.MinPlayed == 0 || r.NewUTS < res.MinPlayed {
+			res.MinPlayed = r.NewUTS
+		}
+	}
+	return res, s.commit(tx)
+}
+
+// HasScrobble reports whether a live scrobble of artist's track (however
+// spelled) is stored as played at uts.
+func (s *Store) HasScrobble(ctx context.Context, uts int64, artist, track string) (bool, error) {
+	var ok bool
+	err := s.DB.QueryRowContext(ctx, `
+SELECT EXISTS (SELECT 1 FROM scrobbles WHERE user_name = ? AND played_at_uts = ? AND artist_norm = ? AND track_norm = ? AND deleted_at_uts IS NULL)
+`, s.user, uts, NormalizeArtist(artist), NormalizeName(track)).Scan(&ok)
+	return ok, err
+}
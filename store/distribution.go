@@ -0,0 +1,85 @@
+package store
+
+import (
+	"context"
+	"sort"
+)
+
+// Distribution is how dated plays spread over artists.
+type Distribution struct {
+	Artists int64
+	// MedianPlays is the middle artist's plays (the mean of the middle two
+	// for an even count).
+	MedianPlays float64
+	// Gini is the Gini coefficient of plays per artist: 0 when every artist
+	// was played as often, towards 1 when a few take nearly all plays.
+	Gini float64
+	// Top10Share is the share of plays going to the 10 most played artists.
+	Top10Share float64
+	// OnePlay counts the artists played just once.
+	OnePlay int64
+}
+
+// ArtistDistribution summarises how the dated plays the filter keeps spread
+// over artists. Like TopArtists, it reads the daily rollups when it can.
+func (s *Store) ArtistDistribution(ctx context.Context, f Filter) (Distribution, error) {
+	f.User = s.user
+	var q string
+	var args []any
+	if cond, cargs, ok, err := s.rollupWhere(ctx, f, TimeRange{}, true); err != nil {
+		return Distribution{}, err
+	} else if ok {
+		q, args = `SELECT SUM(r.plays) FROM daily_artist_plays r WHERE `+cond+` GROUP BY r.artist_name`, cargs
+	} else {
+		q, args = f.Scope(`SELECT COUNT(*) FROM scrobbles WHERE played_at_uts >= ? GROUP BY artist_name`, s.minSane)
+	}
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return Distribution{}, err
+	}
+	defer rows.Close()
+
+	var plays []int64
+	for rows.Next() {
+		var n int64
+		if err := rows.Scan(&n); err != nil {
+			return Distribution{}, err
+		}
+		plays = append(plays, n)
+	}
+	if err := rows.Err(); err != nil {
+		return Distribution{}, err
+	}
+	return distribution(plays), nil
+}
+
+// distribution summarises plays per artist, in any order.
+func distribution(plays []int64) Distribution {
+	d := Distribution{Artists: int64(len(plays))}
+	if len(plays) == 0 {
+		return d
+	}
+	sort.Slice(plays, func(i, j int) bool { return plays[i] < plays[j] })
+	n := len(plays)
+	if n%2 == 1 {
+		d.MedianPlays = float64(plays[n/2])
+	} else {
+		d.MedianPlays = float64(plays[n/2-1]+plays[n/2]) / 2
+	}
+
+	// With plays ascending, G = 2·Σ i·x_i / (n·Σ x) − (n+1)/n, i from 1.
+	var total, weighted, top10 float64
+	for i, x := range plays {
+		total += float64(x)
+		weighted += float64(i+1) * float64(x)
+		if i >= n-10 {
+			top10 += float64(x)
+		}
+		if x == 1 {
+			d.OnePlay++
+		}
+	}
+	d.Gini = 2*weighted/(float64(n)*total) - float64(n+1)/float64(n)
+	d.Top10Share = top10 / total
+	return d
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// EditMatch selects scrobbles to edit or tombstone. Empty fields match
+// anything; with Glob, Artist/Track/Album are SQLite GLOB patterns
+// (case-sensitive * and ?).
+type EditMatch struct {
+	PlayedAtUTS int64
+	Artist      string
+	Track       string
+	Album       string
+	Glob        bool
+}
+
+// where returns m's conditions over scrobbles columns; none if m is empty.
+func (m EditMatch) where() ([]string, []any) {
+	var conds []string
+	var args []any
+	if m.PlayedAtUTS != 0 {
+		conds = append(conds, "played_at_uts = ?")
+		args = append(args, m.PlayedAtUTS)
+	}
+	op := "="
+	if m.Glob {
+		op = "GLOB"
+	}
+	for _, f := range []struct{ col, v string }{{"artist_name", m.Artist}, {"track_name", m.Track}, {"COALESCE(album_name, '')", m.Album}} {
+		if f.v != "" {
+			conds = append(conds, f.col+" "+op+" ?")
+			args = append(args, f.v)
+		}
+	}
+	return conds, args
+}
+
+// EditSet holds the new values; empty fields are left unchanged.
+type EditSet struct {
+	Artist string
+	Track  string
+	Album  string
+}
+
+// EditResult reports what EditScrobbles changed.
+type EditResult struct {
+	Rows      int   // scrobbles updated
+	Fields    int   // field changes recorded in edits
+	MinPlayed int64 // earliest played_at_uts touched, 0 if none
+	Changes   []Edit
+}
+
+var errEmptyEdit = errors.New("store: edit needs at least one match and one new value")
+
+// EditScrobbles rewrites metadata on matching scrobbles in one transaction,
+// recording every replaced value in the edits table. source_hash is kept,
+// so the original listen still dedupes if Last.fm returns it again.
+func (s *Store) EditScrobbles(ctx context.Context, m EditMatch, set EditSet) (EditResult, error) {
+	if set == (EditSet{}) {
+		return EditResult{}, errEmptyEdit
+	}
+	conds, args := m.where()
+	if len(conds) == 0 {
+		return EditResult{}, errEmptyEdit
+	}
+	conds = append(conds, "user_name = ?", "deleted_at_uts IS NULL")
+	args = append(args, s.user)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return EditResult{}, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+SELECT rowid, source_hash, played_at_uts, artist_name, track_name, COALESCE(album_name, '')
+FROM scrobbles
+WHERE `+strings.Join(conds, " AND "), args...)
+	if err != nil {
+		return EditResult{}, err
+	}
+	type row struct {
+		id                   int64
+		hash                 string
+		played               int64
+		artist, track, album string
+	}
+	var matched []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.hash, &r.played, &r.artist, &r.track, &r.album); err != nil {
+			rows.Close()
+			return EditResult{}, err
+		}
+		matched = append(matched, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return EditResult{}, err
+	}
+
+	now := time.Now().Unix()
+	var res EditResult
+	var artists []string
+	for _, r := range matched {
+		changed := 0
+		for _, f := range []struct {
+			col, old, new string
+			norm          string
+			normalize     func(string) string
+		}{
+			{"artist_name", r.artist, set.Artist, "artist_norm", NormalizeArtist},
+			{"track_name", r.track, set.Track, "track_norm", NormalizeName},
+			{"album_name", r.album, set.Album, "album_norm", NormalizeName},
+		} {
+			if f.new == "" || f.new == f.old {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `
+INSERT INTO edits (user_name, edited_at_uts, scrobble_hash, played_at_uts, field, old_value, new_value)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+`, s.user, now, r.hash, r.played, f.col, nullIfEmpty(f.old), f.new); err != nil {
+				return EditResult{}, err
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE scrobbles SET `+f.col+` = ?, `+f.norm+` = ? WHERE rowid = ?`, f.new, f.normalize(f.new), r.id); err != nil {
+				return EditResult{}, err
+			}
+			res.Changes = append(res.Changes, Edit{EditedAtUTS: now, ScrobbleHash: r.hash, PlayedAtUTS: r.played, Field: f.col, OldValue: f.old, NewValue: f.new})
+			changed++
+		}
+		if changed > 0 {
+			artists = append(artists, r.artist, cmp.Or(set.Artist, r.artist))
+			res.Rows++
+			res.Fields += changed
+			if res.MinPlayed == 0 || r.played < res.MinPlayed {
+				res.MinPlayed = r.played
+			}
+		}
+	}
+	if err := refreshCanonical(ctx, tx, artists); err != nil {
+		return EditResult{}, err
+	}
+	return res, s.commit(tx)
+}
+
+// Edit is one recorded field change.
+type Edit struct {
+	EditedAtUTS  int64
+	ScrobbleHash string
+	PlayedAtUTS  int64
+	Field        string
+	OldValue     string
+	NewValue     string
+}
+
+// Edits returns the audit trail, newest first.
+func (s *Store) Edits(ctx context.Context, limit int) ([]Edit, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+SELECT edited_at_uts, scrobble_hash, played_at_uts, field, old_value, new_value
+FROM edits
+WHERE user_name = ?
+ORDER BY id DESC
+LIMIT ?
+`, s.user, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Edit
+	for rows.Next() {
+		var e Edit
+		var old, nw sql.NullString
+		if err := rows.Scan(&e.EditedAtUTS, &e.ScrobbleHash, &e.PlayedAtUTS, &e.Field, &old, &nw); err != nil {
+			return nil, err
+		}
+		e.OldValue, e.NewValue = old.String, nw.String
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Scrobble is one stored row.
+type Scrobble struct {
+	PlayedAtUTS int64  `json:"played_at_uts"`
+	Artist      string `json:"artist"`
+	Track       string `json:"track"`
+	Album       string `json:"album,omitempty"`
+	TrackMBID   string `json:"track_mbid,omitempty"`
+	ArtistMBID  string `json:"artist_mbid,omitempty"`
+	AlbumMBID   string `json:"album_mbid,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Source      string `json:"source"`
+}
+
+// EachScrobble calls fn for every scrobble the filter keeps, oldest first,
+// with its names as stored rather than canonical.
+func (s *Store) EachScrobble(ctx context.Context, f Filter, fn func(Scrobble) error) error {
+	f.User = s.user
+	q, args := f.Scope(`
+SELECT played_at_uts, stored_artist_name, stored_track_name, stored_album_name, track_mbid, artist_mbid, album_mbid, lastfm_url, source
+FROM scrobbles
+ORDER BY played_at_uts ASC, rowid ASC
+`)
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	return scanScrobbles(rows, fn)
+}
+
+// scanScrobbles calls fn for each of rows, which select a Scrobble's
+// columns in order, and closes them.
+func scanScrobbles(rows *sql.Rows, fn func(Scrobble) error) error {
+	defer rows.Close()
+	for rows.Next() {
+		var sc Scrobble
+		var album, trackMBID, artistMBID, albumMBID, u sql.NullString
+		if err := rows.Scan(&sc.PlayedAtUTS, &sc.Artist, &sc.Track, &album, &trackMBID, &artistMBID, &albumMBID, &u, &sc.Source); err != nil {
+			return err
+		}
+		sc.Album, sc.TrackMBID, sc.ArtistMBID, sc.AlbumMBID, sc.URL = album.String, trackMBID.String, artistMBID.String, albumMBID.String, u.String
+		if err := fn(sc); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// ExternalPlay is a lifetime play count for one track in another player's
+// library. Times are unix seconds; 0 means unknown.
+type ExternalPlay struct {
+	Source        string
+	Artist        string
+	Track         string
+	Album         string
+	Plays         int64
+	LastPlayedUTS int64
+	AddedUTS      int64
+}
+
+// UpsertExternalPlays stores plays in one transaction, replacing the counts
+// from any earlier import of the same source and track.
+func (s *Store) UpsertExternalPlays(ctx context.Context, plays []ExternalPlay) (int, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+INSERT INTO external_plays (user_name, source, artist_name, track_name, album_name, play_count, last_played_uts, added_uts, imported_at_uts)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (user_name, source, artist_name, track_name, album_name) DO UPDATE SET
+  play_count = excluded.play_count,
+  last_played_uts = excluded.last_played_uts,
+  added_uts = excluded.added_uts,
+  imported_at_uts = excluded.imported_at_uts
+`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	now := time.Now().Unix()
+	n := 0
+	for _, p := range plays {
+		if _, err := stmt.ExecContext(ctx, s.user, p.Source, p.Artist, p.Track, p.Album, p.Plays, nullIfZero(p.LastPlayedUTS), nullIfZero(p.AddedUTS), now); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, s.commit(tx)
+}
+
+// ExternalPlayTotals returns the summed play counts per source.
+func (s *Store) ExternalPlayTotals(ctx context.Context) (map[string]int64, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT source, SUM(play_count) FROM external_plays WHERE user_name = ? GROUP BY source`, s.user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int64{}
+	for rows.Next() {
+		var src string
+		var n int64
+		if err := rows.Scan(&src, &n); err != nil {
+			return nil, err
+		}
+		out[src] = n
+	}
+	return out, rows.Err()
+}
+
+func nullIfZero(v int64) any {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"strings"
+)
+
+// TimeRange is a half-open [From, To) span of unix seconds; a zero bound is
+// unbounded on that side.
+type TimeRange struct {
+	From int64
+	To   int64
+}
+
+func (r TimeRange) Contains(uts int64) bool {
+	return (r.From == 0 || uts >= r.From) && (r.To == 0 || uts < r.To)
+}
+
+// Filter narrows which scrobbles a query sees, e.g. to keep sensitive periods
+// or artists out of a shared report while the archive stays intact. The zero
+// value matches all of the unnamed user's scrobbles (see User). Tombstoned
+// scrobbles never match (see tombstone.go).
+type Filter struct {
+	// User is whose scrobbles these are (see OpenOptions.User). Store
+	// methods set it to the store's user; set it from Store.User when
+	// scoping a query on Store.DB directly.
+	User string
+	// AlsoUsers merges other users' scrobbles into User's, for one
+	// household's combined view. Each play still answers to its own
+	// user's ignore list.
+	AlsoUsers []string
+
+	ExcludeRanges  []TimeRange
+	ExcludeArtists []string // matched by NormalizeArtist
+
+	// HideIgnored drops scrobbles on the ignore list (see AddIgnore). The
+	// list lives in the database, so Excludes doesn't consult it.
+	HideIgnored bool
+
+	// ExcludeVersions drops plays of live recordings, remixes or demos
+	// (VersionKinds): those ClassifyTrack finds by title, and those on
+	// albums MusicBrainz lists as one (see enrich). FoldVersions counts
+	// the ones found by title as plays of the studio track instead, by its
+	// base title. Neither is consulted by Excludes.
+	ExcludeVersions []string
+	FoldVersions    []string
+}
+
+func (f Filter) IsZero() bool {
+	return !f.Redacts() && !f.HideIgnored && len(f.ExcludeVersions) == 0 && len(f.FoldVersions) == 0
+}
+
+// Redacts reports whether the filter removes periods or artists on request,
+// as opposed to only hiding the standing ignore list.
+func (f Filter) Redacts() bool {
+	return len(f.ExcludeRanges) > 0 || len(f.ExcludeArtists) > 0
+}
+
+// Excludes reports whether a scrobble would be filtered out.
+func (f Filter) Excludes(uts int64, artist string) bool {
+	for _, r := range f.ExcludeRanges {
+		if r.Contains(uts) {
+			return true
+		}
+	}
+	return f.ExcludesArtist(artist)
+}
+
+func (f Filter) ExcludesArtist(artist string) bool {
+	key := NormalizeArtist(artist)
+	for _, a := range f.ExcludeArtists {
+		if NormalizeArtist(a) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// where returns a predicate over scrobbles columns (table alias s).
+func (f Filter) where() (string, []any) {
+	cond, args := f.userIn("user_name")
+	conds := []string{cond, "deleted_at_uts IS NULL"}
+	for _, r := range f.ExcludeRanges {
+		switch {
+		case r.From != 0 && r.To != 0:
+			conds = append(conds, "NOT (played_at_uts >= ? AND played_at_uts < ?)")
+			args = append(args, r.From, r.To)
+		case r.From != 0:
+			conds = append(conds, "played_at_uts < ?")
+			args = append(args, r.From)
+		case r.To != 0:
+			conds = append(conds, "played_at_uts >= ?")
+			args = append(args, r.To)
+		}
+	}
+	if len(f.ExcludeArtists) > 0 {
+		conds = append(conds, "artist_norm NOT IN ("+placeholders(len(f.ExcludeArtists))+")")
+		for _, a := range f.ExcludeArtists {
+			args = append(args, NormalizeArtist(a))
+		}
+	}
+	if f.HideIgnored {
+		// The first test is evaluated once per query, sparing the
+		// per-row lookup when nothing is ignored.
+		conds = append(conds, `(NOT EXISTS (SELECT 1 FROM main.ignores) OR NOT EXISTS (SELECT 1 FROM main.ignores i WHERE i.user_name = s.user_name AND i.artist_norm = s.artist_norm AND i.track_norm IN ('', s.track_norm)))`)
+	}
+	if kinds := versionKinds(f.ExcludeVersions); kinds != "" {
+		conds = append(conds, "track_version(track_canonical, COALESCE(album_canonical, '')) NOT IN ("+kinds+")",
+			"NOT EXISTS (SELECT 1 FROM main.musicbrainz_releases m WHERE m.mbid = s.album_mbid AND m.kind IN ("+kinds+"))")
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// columns are the columns Scope's CTE passes on: scopedColumns, with the
+// titles of folded versions replaced by their base titles.
+func (f Filter) columns() string {
+	kinds := versionKinds(f.FoldVersions)
+	if kinds == "" {
+		return scopedColumns
+	}
+	title := "CASE WHEN track_version(track_canonical, '') IN (" + kinds + ") THEN track_base(track_canonical) ELSE track_canonical END"
+	return strings.NewReplacer(
+		"track_canonical AS track_name", title+" AS track_name",
+		"track_norm,", "CASE WHEN track_version(track_canonical, '') IN ("+kinds+") THEN normalize_name(track_base(track_canonical)) ELSE track_norm END AS track_norm,",
+		" track_canonical,", " "+title+" AS track_canonical,",
+	).Replace(scopedColumns)
+}
+
+// userIn returns a predicate matching col to the filter's users.
+func (f Filter) userIn(col string) (string, []any) {
+	if len(f.AlsoUsers) == 0 {
+		return col + " = ?", []any{f.User}
+	}
+	args := []any{f.User}
+	for _, u := range f.AlsoUsers {
+		args = append(args, u)
+	}
+	return col + " IN (" + placeholders(len(args)) + ")", args
+}
+
+// Scope rewrites a query over the scrobbles table so it only sees rows the
+// filter keeps. It shadows the table with a same-named CTE, so queries need
+// no changes and the filter's args go first. Names in it are canonical (see
+// names.go), so grouping by them merges spellings.
+func (f Filter) Scope(query string, args ...any) (string, []any) {
+	cond, cargs := f.where()
+	cte := "scrobbles AS (SELECT " + f.columns() + " FROM main.scrobbles AS s WHERE " + cond + ")"
+
+	q := strings.TrimLeft(query, " \t\r\n")
+	if len(q) > 4 && strings.EqualFold(q[:4], "WITH") && strings.ContainsAny(q[4:5], " \t\r\n") {
+		q = "WITH " + cte + ",\n" + q[5:]
+	} else {
+		q = "WITH " + cte + "\n" + q
+	}
+	return q, append(cargs, args...)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
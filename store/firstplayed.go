@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// first_played_artists and first_played_albums hold when each artist (by
+// artist_norm) and album (by artist_norm and album_norm) was first played,
+// per user, leaving out tombstones and undated plays (before the user's
+// minimum sane timestamp, see Store.MinSaneUTS). Triggers keep them current
+// like the rollups, and RebuildRollups recounts them too. Indexed by first
+// play, they answer "what did I discover in March 2020" (FirstPlays)
+// without reading every scrobble. When the first play of a name goes
+// (deleted, tombstoned, edited), the next one is found through the partial
+// indexes on live scrobbles.
+var firstPlayedTables = `
+CREATE TABLE IF NOT EXISTS first_played_artists (
+  user_name TEXT NOT NULL,
+  artist_norm TEXT NOT NULL,
+  first_played_uts INTEGER NOT NULL,
+
+  PRIMARY KEY (user_name, artist_norm)
+) WITHOUT ROWID;
+CREATE INDEX IF NOT EXISTS idx_first_played_artists ON first_played_artists(user_name, first_played_uts);
+
+CREATE TABLE IF NOT EXISTS first_played_albums (
+  user_name TEXT NOT NULL,
+  artist_norm TEXT NOT NULL,
+  album_norm TEXT NOT NULL,
+  first_played_uts INTEGER NOT NULL,
+
+  PRIMARY KEY (user_name, artist_norm, album_norm)
+) WITHOUT ROWID;
+CREATE INDEX IF NOT EXISTS idx_first_played_albums ON first_played_albums(user_name, first_played_uts);
+
+CREATE INDEX IF NOT EXISTS idx_scrobbles_live_artist ON scrobbles(user_name, artist_norm, played_at_uts) WHERE deleted_at_uts IS NULL;
+CREATE INDEX IF NOT EXISTS idx_scrobbles_live_album ON scrobbles(user_name, artist_norm, album_norm, played_at_uts) WHERE deleted_at_uts IS NULL;
+` + firstPlayedTriggers(fixedMinSane) + firstPlayedRebuild(fixedMinSane)
+
+// fixedMinSane is MinSaneUTS for the first-played SQL of schema 12, before
+// the threshold could be set per user.
+func fixedMinSane(string) string {
+	return strconv.Itoa(MinSaneUTS)
+}
+
+// firstPlayedTriggers keep the tables in step with scrobbles, with minSane
+// giving the threshold for a user column. The update trigger doesn't watch
+// user_name: only claimUnowned sets it, and it moves the tables along.
+func firstPlayedTriggers(minSane func(user string) string) string {
+	return `
+CREATE TRIGGER IF NOT EXISTS scrobbles_first_played_insert AFTER INSERT ON scrobbles BEGIN` + firstPlayedAddNew(minSane) + `
+END;
+
+CREATE TRIGGER IF NOT EXISTS scrobbles_first_played_delete AFTER DELETE ON scrobbles BEGIN` + firstPlayedRemoveOld(minSane) + `
+END;
+
+CREATE TRIGGER IF NOT EXISTS scrobbles_first_played_update
+AFTER UPDATE OF played_at_uts, artist_norm, album_norm, deleted_at_uts ON scrobbles BEGIN` + firstPlayedRemoveOld(minSane) + firstPlayedAddNew(minSane) + `
+END;
+`
+}
+
+// firstPlayedAddNew counts NEW's play, if it is live and dated, as a first
+// play unless an earlier one is known.
+func firstPlayedAddNew(minSane func(user string) string) string {
+	sane := minSane("NEW.user_name")
+	return `
+  INSERT INTO first_played_artists(user_name, artist_norm, first_played_uts)
+  SELECT NEW.user_name, NEW.artist_norm, NEW.played_at_uts
+  WHERE NEW.deleted_at_uts IS NULL AND NEW.played_at_uts >= ` + sane + `
+  ON CONFLICT DO UPDATE SET first_played_uts = MIN(first_played_uts, excluded.first_played_uts);
+  INSERT INTO first_played_albums(user_name, artist_norm, album_norm, first_played_uts)
+  SELECT NEW.user_name, NEW.artist_norm, NEW.album_norm, NEW.played_at_uts
+  WHERE NEW.deleted_at_uts IS NULL AND NEW.played_at_uts >= ` + sane + ` AND NEW.album_norm != ''
+  ON CONFLICT DO UPDATE SET first_played_uts = MIN(first_played_uts, excluded.first_played_uts);`
+}
+
+// firstPlayedRemoveOld drops the first plays OLD was, then looks up the
+// next live one of each name it dropped.
+func firstPlayedRemoveOld(minSane func(user string) string) string {
+	sane := minSane("OLD.user_name")
+	return `
+  DELETE FROM first_played_artists
+  WHERE user_name = OLD.user_name AND artist_norm = OLD.artist_norm AND first_played_uts = OLD.played_at_uts;
+  INSERT INTO first_played_artists(user_name, artist_norm, first_played_uts)
+  SELECT user_name, artist_norm, MIN(played_at_uts) FROM scrobbles
+  WHERE user_name = OLD.user_name AND artist_norm = OLD.artist_norm
+    AND deleted_at_uts IS NULL AND played_at_uts >= ` + sane + `
+    AND NOT EXISTS (SELECT 1 FROM first_played_artists WHERE user_name = OLD.user_name AND artist_norm = OLD.artist_norm)
+  GROUP BY user_name, artist_norm;
+  DELETE FROM first_played_albums
+  WHERE user_name = OLD.user_name AND artist_norm = OLD.artist_norm AND album_norm = OLD.album_norm AND first_played_uts = OLD.played_at_uts;
+  INSERT INTO first_played_albums(user_name, artist_norm, album_norm, first_played_uts)
+  SELECT user_name, artist_norm, album_norm, MIN(played_at_uts) FROM scrobbles
+  WHERE user_name = OLD.user_name AND artist_norm = OLD.artist_norm AND album_norm = OLD.album_norm AND album_norm != ''
+    AND deleted_at_uts IS NULL AND played_at_uts >= ` + sane + `
+    AND NOT EXISTS (SELECT 1 FROM first_played_albums WHERE user_name = OLD.user_name AND artist_norm = OLD.artist_norm AND album_norm = OLD.album_norm)
+  GROUP BY user_name, artist_norm, album_norm;`
+}
+
+// firstPlayedRebuild refills both tables from scrobbles.
+func firstPlayedRebuild(minSane func(user string) string) string {
+	sane := minSane("scrobbles.user_name")
+	return `
+DELETE FROM first_played_artists;
+DELETE FROM first_played_albums;
+INSERT INTO first_played_artists(user_name, artist_norm, first_played_uts)
+SELECT user_name, artist_norm, MIN(played_at_uts) FROM scrobbles
+WHERE deleted_at_uts IS NULL AND played_at_uts >= ` + sane + `
+GROUP BY user_name, artist_norm;
+INSERT INTO first_played_albums(user_name, artist_norm, album_norm, first_played_uts)
+SELECT user_name, artist_norm, album_norm, MIN(played_at_uts) FROM scrobbles
+WHERE deleted_at_uts IS NULL AND played_at_uts >= ` + sane + ` AND album_norm != ''
+GROUP BY user_name, artist_norm, album_norm;
+`
+}
+
+// FirstPlay is when an artist, or one of their albums, was first played.
+type FirstPlay struct {
+	Artist string
+	// Album is "" for an artist.
+	Album string
+	// Track is the first track played.
+	Track          string
+	FirstPlayedUTS int64
+}
+
+// FirstPlays lists the artists the filter keeps that were first played
+// within r, or with albums their albums, oldest first: what was discovered
+// then. A name whose first play the filter hides doesn't count. It reads
+// the first-play tables unless the filter cuts out periods, single tracks
+// or versions, which only a scan can see past.
+func (s *Store) FirstPlays(ctx context.Context, f Filter, r TimeRange, albums bool, limit int) ([]FirstPlay, error) {
+	f.User = s.user
+	table, key, join := "first_played_artists", "artist_norm", "s.artist_norm = fp.artist_norm"
+	if albums {
+		table, key, join = "first_played_albums", "artist_norm, album_norm", join+" AND s.album_norm = fp.album_norm"
+	}
+	scan := len(f.ExcludeRanges) > 0 || len(f.ExcludeVersions) > 0
+	if f.HideIgnored && !scan {
+		ucond, uargs := f.userIn("user_name")
+		if err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM ignores WHERE `+ucond+` AND track_name != '')`, uargs...).Scan(&scan); err != nil {
+			return nil, err
+		}
+	}
+
+	var q string
+	var args []any
+	if !scan {
+		// A merged view's first play is the earliest of any user's.
+		user, uargs := f.userIn("r.user_name")
+		other, oargs := f.userIn("o.user_name")
+		conds := []string{user, "r.first_played_uts >= ?"}
+		args = append(append([]any{}, uargs...), max(r.From, s.minSane))
+		if r.To != 0 {
+			conds = append(conds, "r.first_played_uts < ?")
+			args = append(args, r.To)
+		}
+		same := "o.artist_norm = r.artist_norm"
+		if albums {
+			same += " AND o.album_norm = r.album_norm"
+		}
+		conds = append(conds, "NOT EXISTS (SELECT 1 FROM main."+table+" o WHERE "+other+" AND "+same+" AND o.first_played_uts < r.first_played_uts)")
+		args = append(args, oargs...)
+		q, args = f.Scope(`
+SELECT MIN(s.artist_name) AS artist, COALESCE(MIN(s.album_name), '') AS album, MIN(s.track_name), fp.first_played_uts
+FROM (
+  SELECT `+key+`, MIN(r.first_played_uts) AS first_played_uts
+  FROM main.`+table+` r
+  WHERE `+strings.Join(conds, " AND ")+`
+  GROUP BY `+key+`
+) fp
+JOIN scrobbles s ON `+join+` AND s.played_at_uts = fp.first_played_uts
+GROUP BY `+strings.ReplaceAll("fp."+key, ", ", ", fp.")+`
+ORDER BY fp.first_played_uts ASC, artist ASC, album ASC
+LIMIT ?
+`, append(args, limit)...)
+	} else {
+		albumCond := ""
+		if albums {
+			albumCond = " AND album_norm != ''"
+		}
+		where, wargs := r.where()
+		q, args = f.Scope(`
+SELECT artist_name, album_name, track_name, played_at_uts
+FROM (
+  SELECT artist_name, COALESCE(album_name, '') AS album_name, track_name, played_at_uts,
+    ROW_NUMBER() OVER (PARTITION BY `+key+` ORDER BY played_at_uts ASC, track_name ASC) AS n
+  FROM scrobbles
+  WHERE played_at_uts >= ?`+albumCond+`
+)
+WHERE n = 1 AND `+where+`
+ORDER BY played_at_uts ASC, artist_name ASC, album_name ASC
+LIMIT ?
+`, append(append([]any{s.minSane}, wargs...), limit)...)
+	}
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []FirstPlay{}
+	for rows.Next() {
+		var p FirstPlay
+		if err := rows.Scan(&p.Artist, &p.Album, &p.Track, &p.FirstPlayedUTS); err != nil {
+			return nil, err
+		}
+		if !albums {
+			p.Album = ""
+		}
+		out = append(out, p)
+	}
+	return out, rows.Err()
+}
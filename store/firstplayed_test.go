@@ -0,0 +1,139 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+func TestFirstPlays(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	at := func(date string) int64 {
+		d, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d.Unix()
+	}
+	for _, p := range []struct{ date, artist, track, album string }{
+		{"1970-01-01", "Placeholder", "Lost", ""},
+		{"2019-01-05", "Low", "Words", "I Could Live in Hope"},
+		{"2019-03-10", "Low", "Sunflower", "Things We Lost in the Fire"},
+		{"2020-03-02", "Burial", "Archangel", "Untrue"},
+		{"2020-03-20", "Burial", "Near Dark", "Untrue"},
+		{"2020-03-15", "Grouper", "Heavy Water", "Dragging a Dead Deer Up a Hill"},
+		{"2020-04-01", "Grouper", "Alien Observer", "A I A"},
+		{"2020-03-25", "Low", "Lullaby", "I Could Live in Hope"},
+	} {
+		tr := lastfm.Track{Name: p.track, Artist: lastfm.TextMBID{Text: p.artist}, Album: lastfm.TextMBID{Text: p.album}, Date: &lastfm.Date{UTS: strconv.FormatInt(at(p.date), 10)}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	march := TimeRange{From: at("2020-03-01"), To: at("2020-04-01")}
+	// Cutting out a period nowhere near forces a scan.
+	scan := Filter{ExcludeRanges: []TimeRange{{From: 1, To: 2}}}
+	check := func(wantArtists, wantAlbums string) {
+		t.Helper()
+		for _, f := range []Filter{{}, scan} {
+			for albums, want := range map[bool]string{false: wantArtists, true: wantAlbums} {
+				got, err := s.FirstPlays(ctx, f, march, albums, 10)
+				var ps []string
+				for _, p := range got {
+					ps = append(ps, fmt.Sprintf("%s/%s/%s %s", p.Artist, p.Album, p.Track, time.Unix(p.FirstPlayedUTS, 0).UTC().Format("01-02")))
+				}
+				if s := strings.Join(ps, ", "); err != nil || s != want {
+					t.Errorf("first plays (albums %v, scan %v) = %s, %v; want %s", albums, f.Redacts(), s, err, want)
+				}
+			}
+		}
+	}
+	check("Burial//Archangel 03-02, Grouper//Heavy Water 03-15",
+		"Burial/Untrue/Archangel 03-02, Grouper/Dragging a Dead Deer Up a Hill/Heavy Water 03-15")
+
+	// Tombstoning a first play moves it to the next one.
+	if _, err := s.TombstoneScrobbles(ctx, EditMatch{PlayedAtUTS: at("2020-03-02")}, TombstoneManual); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.TombstoneScrobbles(ctx, EditMatch{PlayedAtUTS: at("2020-03-15")}, TombstoneManual); err != nil {
+		t.Fatal(err)
+	}
+	check("Burial//Near Dark 03-20", "Burial/Untrue/Near Dark 03-20")
+	if _, err := s.UndeleteScrobbles(ctx, EditMatch{}); err != nil {
+		t.Fatal(err)
+	}
+	check("Burial//Archangel 03-02, Grouper//Heavy Water 03-15",
+		"Burial/Untrue/Archangel 03-02, Grouper/Dragging a Dead Deer Up a Hill/Heavy Water 03-15")
+
+	// So does an edit, in both directions.
+	if _, err := s.EditScrobbles(ctx, EditMatch{PlayedAtUTS: at("2019-03-10")}, EditSet{Album: "I Could Live in Hope"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.EditScrobbles(ctx, EditMatch{PlayedAtUTS: at("2019-01-05")}, EditSet{Album: "Drums and Guns"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.EditScrobbles(ctx, EditMatch{PlayedAtUTS: at("2020-03-25")}, EditSet{Artist: "Grouper"}); err != nil {
+		t.Fatal(err)
+	}
+	check("Burial//Archangel 03-02, Grouper//Heavy Water 03-15",
+		"Burial/Untrue/Archangel 03-02, Grouper/Dragging a Dead Deer Up a Hill/Heavy Water 03-15, Grouper/I Could Live in Hope/Lullaby 03-25")
+	got, err := s.FirstPlays(ctx, Filter{}, TimeRange{}, true, 10)
+	if err != nil || len(got) != 6 || got[0].Album != "Drums and Guns" || got[1].Album != "I Could Live in Hope" || got[1].Track != "Sunflower" {
+		t.Fatalf("all first albums = %+v, %v", got, err)
+	}
+
+	// The filter hides names whose first play it hides.
+	for _, f := range []Filter{{ExcludeArtists: []string{"burial"}}, {ExcludeArtists: []string{"burial"}, ExcludeRanges: scan.ExcludeRanges}} {
+		got, err := s.FirstPlays(ctx, f, march, false, 10)
+		if err != nil || len(got) != 1 || got[0].Artist != "Grouper" {
+			t.Errorf("first plays without Burial (scan %v) = %+v, %v", f.Redacts(), got, err)
+		}
+	}
+
+	// The tables match a rebuild from scratch.
+	dump := func() string {
+		t.Helper()
+		var b strings.Builder
+		for _, q := range []string{
+			`SELECT user_name, artist_norm, '', first_played_uts FROM first_played_artists ORDER BY 1, 2`,
+			`SELECT user_name, artist_norm, album_norm, first_played_uts FROM first_played_albums ORDER BY 1, 2, 3`,
+		} {
+			rows, err := s.DB.QueryContext(ctx, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for rows.Next() {
+				var u, a, al string
+				var uts int64
+				if err := rows.Scan(&u, &a, &al, &uts); err != nil {
+					t.Fatal(err)
+				}
+				fmt.Fprintf(&b, "%s/%s/%s %d\n", u, a, al, uts)
+			}
+			rows.Close()
+		}
+		return b.String()
+	}
+	before := dump()
+	if err := s.RebuildRollups(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if after := dump(); after != before {
+		t.Fatalf("kept:\n%s\nrebuilt:\n%s", before, after)
+	}
+	if strings.Contains(before, "placeholder") {
+		t.Fatalf("undated play counted:\n%s", before)
+	}
+}
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Ignore is an ignore-list entry; an empty Track ignores the whole artist.
+type Ignore struct {
+	Artist     string
+	Track      string
+	AddedAtUTS int64
+}
+
+// AddIgnore puts an artist (track "") or a single track on the ignore list.
+// It hides every spelling of the name (see NormalizeName). It reports false
+// if the entry was already there.
+func (s *Store) AddIgnore(ctx context.Context, artist, track string) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `INSERT OR IGNORE INTO ignores (user_name, artist_name, track_name, added_at_uts, artist_norm, track_norm) VALUES (?, ?, ?, ?, ?, ?)`,
+		s.user, artist, track, time.Now().Unix(), NormalizeArtist(artist), NormalizeName(track))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RemoveIgnore takes an entry off the ignore list, reporting whether it was there.
+func (s *Store) RemoveIgnore(ctx context.Context, artist, track string) (bool, error) {
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM ignores WHERE user_name = ? AND artist_name = ? AND track_name = ?`, s.user, artist, track)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Ignores lists the ignore list by artist, then track.
+func (s *Store) Ignores(ctx context.Context) ([]Ignore, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT artist_name, track_name, added_at_uts FROM ignores WHERE user_name = ? ORDER BY artist_name, track_name`, s.user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Ignore
+	for rows.Next() {
+		var i Ignore
+		if err := rows.Scan(&i.Artist, &i.Track, &i.AddedAtUTS); err != nil {
+			return nil, err
+		}
+		out = append(out, i)
+	}
+	return out, rows.Err()
+}
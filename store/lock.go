@@ -0,0 +1,69 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LockFile in the data dir is held by the process that has the store open.
+const LockFile = "lock"
+
+// ErrLocked means another process has the data dir open, e.g. a cron sync
+// overlapping a manual backfill.
+var ErrLocked = errors.New("data dir is in use by another lastfm-golang process")
+
+// dirLock is an advisory lock on a data dir, released when its file is
+// closed, including when the process dies.
+type dirLock struct {
+	f *os.File
+}
+
+// lockDataDir takes the data dir's lock without waiting, and records who
+// holds it so the next process can say.
+func lockDataDir(dir string) (*dirLock, error) {
+	path := filepath.Join(dir, LockFile)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := tryLock(f); err != nil {
+		_ = f.Close()
+		if !errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		if holder, _ := os.ReadFile(path); len(holder) > 0 {
+			return nil, fmt.Errorf("%w (%s): %s", ErrLocked, strings.TrimSpace(string(holder)), dir)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrLocked, dir)
+	}
+	holder := fmt.Sprintf("pid %d, %s, since %s\n", os.Getpid(), command(os.Args), time.Now().Format(time.RFC3339))
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(holder), 0)
+	}
+	return &dirLock{f: f}, nil
+}
+
+// command names the binary and subcommand of args, leaving out the flags:
+// the lock file is world-readable and they can hold API keys and secrets.
+func command(args []string) string {
+	if len(args) == 0 {
+		return "?"
+	}
+	name := filepath.Base(args[0])
+	if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+		name += " " + args[1]
+	}
+	return name
+}
+
+func (l *dirLock) release() {
+	if l == nil {
+		return
+	}
+	_ = l.f.Truncate(0)
+	_ = l.f.Close()
+}
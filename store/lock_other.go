@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package store
+
+import "os"
+
+// tryLock doesn't lock on this platform; concurrent runs aren't detected.
+func tryLock(*os.File) error {
+	return nil
+}
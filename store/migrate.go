@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// migrations upgrade an existing database one schema version at a time:
+// migrations[i] takes it from version i+1 to i+2. schema.sql is the version
+// 1 baseline (plus tables that can be created idempotently); column changes
+// to existing tables go here. Append only: never edit a step that shipped.
+var migrations = []string{
+	// 2: where each scrobble came from. Everything stored before sources
+	// existed was fetched from the Last.fm API.
+	`ALTER TABLE scrobbles ADD COLUMN source TEXT NOT NULL DEFAULT 'lastfm_api';
+CREATE INDEX IF NOT EXISTS idx_scrobbles_source ON scrobbles(source);`,
+	// 3: recommend can suggest albums; their rows leave track_name empty.
+	`ALTER TABLE recommendations ADD COLUMN album_name TEXT NOT NULL DEFAULT '';`,
+	// 4: indexes for the digest's aggregates, so they read an index instead
+	// of scanning the table (see BenchmarkDigestQueries). played_year is
+	// virtual: computed on read, stored only in its index.
+	`ALTER TABLE scrobbles ADD COLUMN played_year INTEGER
+  GENERATED ALWAYS AS (CAST(strftime('%Y', played_at_uts, 'unixepoch') AS INTEGER)) VIRTUAL;
+CREATE INDEX IF NOT EXISTS idx_scrobbles_played_cover ON scrobbles(played_at_uts, artist_name, track_name, album_name);
+CREATE INDEX IF NOT EXISTS idx_scrobbles_artist_track ON scrobbles(artist_name, track_name, played_at_uts);
+CREATE INDEX IF NOT EXISTS idx_scrobbles_artist_album ON scrobbles(artist_name, album_name, played_at_uts);
+CREATE INDEX IF NOT EXISTS idx_scrobbles_year_artist ON scrobbles(played_year, artist_name, played_at_uts, track_name);`,
+	// 5: per-UTC-day play counts, kept in step with scrobbles by triggers,
+	// so top lists read a day's worth of rows per artist instead of every
+	// play (see rollup.go).
+	rollupTables + rollupTriggers(rollupSchema{day: utcDaySQL}) + rollupRebuild(rollupSchema{day: utcDaySQL}),
+	// 6: each play's date and year in the home time zone (see
+	// useTimezone), set on insert; until one is chosen that is UTC. They
+	// replace played_year, and the rollups count local days.
+	`ALTER TABLE scrobbles ADD COLUMN played_date_local TEXT;
+ALTER TABLE scrobbles ADD COLUMN played_year_local INTEGER;
+UPDATE scrobbles SET
+  played_date_local = date(played_at_uts, 'unixepoch'),
+  played_year_local = CAST(strftime('%Y', played_at_uts, 'unixepoch') AS INTEGER);
+DROP INDEX IF EXISTS idx_scrobbles_year_artist;
+ALTER TABLE scrobbles DROP COLUMN played_year;
+CREATE INDEX IF NOT EXISTS idx_scrobbles_year_local_artist ON scrobbles(played_year_local, artist_name, played_at_uts, track_name);
+DROP TRIGGER IF EXISTS scrobbles_rollup_insert;
+DROP TRIGGER IF EXISTS scrobbles_rollup_delete;
+DROP TRIGGER IF EXISTS scrobbles_rollup_update;` + rollupTriggers(rollupSchema{day: localDaySQL}) + rollupRebuild(rollupSchema{day: localDaySQL}),
+	// 7: several users per database (see profile.go).
+	profileTables + rollupTriggers(rollupSchema{day: localDaySQL, perUser: true}) + rollupRebuild(rollupSchema{day: localDaySQL, perUser: true}),
+	// 8: a journal of command runs (see runs.go).
+	runsTable,
+	// 9: tombstones for scrobbles deleted upstream (see tombstone.go). The
+	// rollups leave them out.
+	`ALTER TABLE scrobbles ADD COLUMN deleted_at_uts INTEGER;
+DROP TRIGGER IF EXISTS scrobbles_rollup_insert;
+DROP TRIGGER IF EXISTS scrobbles_rollup_delete;
+DROP TRIGGER IF EXISTS scrobbles_rollup_update;` + rollupTriggers(rollupSchema{day: localDaySQL, perUser: true, live: true}),
+	// 10: why each tombstone was set (see tombstone.go).
+	tombstonesTable,
+	// 11: normalized names and their canonical spellings, which the
+	// rollups and the digest's indexes follow (see names.go).
+	canonicalNames + strings.Join(canonicalRefresh(false), "\n") + rollupTriggers(rollupCurrent) + rollupRebuild(rollupCurrent),
+	// 12: when each artist and album was first played (see
+	// firstplayed.go).
+	firstPlayedTables,
+	// 13: loved tracks and affinity scores (see affinity.go).
+	affinityTables,
+	// 14: a minimum sane timestamp per user (see dates.go), which the
+	// first-played triggers look up.
+	`DROP TRIGGER IF EXISTS scrobbles_first_played_insert;
+DROP TRIGGER IF EXISTS scrobbles_first_played_delete;
+DROP TRIGGER IF EXISTS scrobbles_first_played_update;` + firstPlayedTriggers(userMinSane),
+	// 15: recommend's local play counts of candidate tracks, by key, from
+	// the index alone.
+	`CREATE INDEX IF NOT EXISTS idx_scrobbles_live_track ON scrobbles(user_name, artist_norm, track_norm, played_at_uts) WHERE deleted_at_uts IS NULL;`,
+	// 16: what MusicBrainz says of the artist and album MBIDs scrobbles
+	// carry (see Store.PutMBArtist). Like lastfm_cache, shared by every
+	// user; an MBID MusicBrainz didn't know is stored empty, so it isn't
+	// asked about again.
+	`CREATE TABLE IF NOT EXISTS musicbrainz_artists (
+  mbid TEXT PRIMARY KEY,
+  country TEXT NOT NULL,
+  fetched_at_uts INTEGER NOT NULL
+) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS musicbrainz_releases (
+  mbid TEXT PRIMARY KEY,
+  year INTEGER NOT NULL,
+  fetched_at_uts INTEGER NOT NULL
+) WITHOUT ROWID;`,
+	// 17: whether MusicBrainz lists a release as live, a remix or a demo
+	// (see Filter.ExcludeVersions). Releases looked up before are
+	// forgotten, so the next enrich asks again for their type.
+	`ALTER TABLE musicbrainz_releases ADD COLUMN kind TEXT NOT NULL DEFAULT '';
+DELETE FROM musicbrainz_releases;`,
+	// 18: name keys again, now that NormalizeName case-folds NFKC and
+	// leaves the marks of non-Latin scripts alone, and NormalizeArtist
+	// folds "&" and punctuation (see rekeyNames).
+	rekeyNames,
+}
+
+// migrate brings db up to SchemaVersion, each step in its own transaction.
+// A database newer than this binary is left alone.
+func migrate(ctx context.Context, db *sql.DB) error {
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version == 0 {
+		version = 1 // fresh database: schema.sql just created the baseline
+	}
+	for ; version < SchemaVersion; version++ {
+		if err := migrateStep(ctx, db, version+1, migrations[version-1]); err != nil {
+			return fmt.Errorf("migrate schema to version %d: %w", version+1, err)
+		}
+	}
+	if version == 1 {
+		_, err := db.ExecContext(ctx, `PRAGMA user_version = 1`)
+		return err
+	}
+	return nil
+}
+
+func migrateStep(ctx context.Context, db *sql.DB, to int, stmt string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, stmt); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, to)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+func TestMigrationsMatchSchemaVersion(t *testing.T) {
+	if SchemaVersion != len(migrations)+1 {
+		t.Fatalf("SchemaVersion = %d but there are %d migrations; bump one with the other", SchemaVersion, len(migrations))
+	}
+}
+
+func TestOpenMigratesVersion1(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// A database as written by schema version 1.
+	db, err := sql.Open("sqlite", filepath.Join(dir, DBFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		`CREATE TABLE scrobbles (played_at_uts INTEGER NOT NULL, track_name TEXT NOT NULL, artist_name TEXT NOT NULL, album_name TEXT,
+  track_mbid TEXT, artist_mbid TEXT, album_mbid TEXT, lastfm_url TEXT, source_hash TEXT NOT NULL UNIQUE)`,
+		`INSERT INTO scrobbles (played_at_uts, track_name, artist_name, source_hash) VALUES (1700000000, 'Roygbiv', 'Boards of Canada', 'h1')`,
+		`INSERT INTO scrobbles (played_at_uts, track_name, artist_name, source_hash) VALUES (1700000100, 'Roygbiv', 'Boards of Canada', 'h2')`,
+		`INSERT INTO scrobbles (played_at_uts, track_name, artist_name, source_hash) VALUES (1700000200, 'roygbiv', 'boards of canada', 'h3')`,
+		`PRAGMA user_version = 1`,
+	} {
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	s, err := Open(ctx, OpenOptions{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Version(ctx); err != nil || v != SchemaVersion {
+		t.Fatalf("version = %d, %v; want %d", v, err, SchemaVersion)
+	}
+	counts, err := s.SourceCounts(ctx, Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[SourceLastFMAPI] != 3 {
+		t.Fatalf("source counts = %v, want the existing rows attributed to %s", counts, SourceLastFMAPI)
+	}
+	// Spellings stored before names were normalized are merged.
+	top, err := s.TopTracks(ctx, Filter{}, TimeRange{}, 10)
+	if err != nil || len(top) != 1 || top[0].Artist != "Boards of Canada" || top[0].Track != "Roygbiv" || top[0].Plays != 3 {
+		t.Fatalf("top tracks = %+v, %v", top, err)
+	}
+
+	s.Close()
+
+	// Reopening is a no-op.
+	s2, err := Open(ctx, OpenOptions{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2.Close()
+}
+
+func TestOpenRekeysNamesOfVersion17(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := Open(ctx, OpenOptions{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"ガ", "ガ"} {
+		tr := lastfm.Track{Name: "Track", Artist: lastfm.TextMBID{Text: name}, Date: &lastfm.Date{UTS: strconv.Itoa(1700000000 + i)}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Schema 17 stripped the mark from the NFD spelling, keying it as カ.
+	for _, q := range []string{
+		`UPDATE scrobbles SET artist_norm = 'カ', artist_canonical = artist_name WHERE artist_name = '` + "ガ" + `'`,
+		`PRAGMA user_version = 17`,
+	} {
+		if _, err := s.DB.ExecContext(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.RebuildRollups(ctx); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = Open(ctx, OpenOptions{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	top, err := s.TopArtists(ctx, Filter{}, TimeRange{}, 10)
+	if err != nil || len(top) != 1 || top[0].Plays != 2 {
+		t.Fatalf("top artists = %+v, %v; want one with 2 plays", top, err)
+	}
+}
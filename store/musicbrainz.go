@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// MBArtist is what MusicBrainz says of an artist MBID: its country, an ISO
+// 3166-1 code such as "GB" ("" if unknown).
+type MBArtist struct {
+	MBID    string
+	Country string
+}
+
+// MBRelease is what MusicBrainz says of a release (album) MBID: the year it
+// first came out, reissues counting as the original (0 if unknown), and
+// which of VersionKinds it is ("" for none).
+type MBRelease struct {
+	MBID string
+	Year int
+	Kind string
+}
+
+// UnknownArtistMBIDs lists up to limit artist MBIDs of the user's live
+// scrobbles that haven't been looked up on MusicBrainz, most played first.
+func (s *Store) UnknownArtistMBIDs(ctx context.Context, limit int) ([]string, error) {
+	return s.unknownMBIDs(ctx, "artist_mbid", "musicbrainz_artists", limit)
+}
+
+// UnknownReleaseMBIDs is UnknownArtistMBIDs for album MBIDs, which name
+// releases.
+func (s *Store) UnknownReleaseMBIDs(ctx context.Context, limit int) ([]string, error) {
+	return s.unknownMBIDs(ctx, "album_mbid", "musicbrainz_releases", limit)
+}
+
+func (s *Store) unknownMBIDs(ctx context.Context, col, table string, limit int) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+SELECT `+col+` FROM scrobbles
+WHERE user_name = ? AND deleted_at_uts IS NULL AND `+col+` != ''
+  AND NOT EXISTS (SELECT 1 FROM `+table+` m WHERE m.mbid = `+col+`)
+GROUP BY `+col+`
+ORDER BY COUNT(*) DESC, `+col+` ASC
+LIMIT ?
+`, s.user, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var mbid string
+		if err := rows.Scan(&mbid); err != nil {
+			return nil, err
+		}
+		out = append(out, mbid)
+	}
+	return out, rows.Err()
+}
+
+// PutMBArtist stores (or replaces) what MusicBrainz said of an artist; a
+// dry run stores nothing.
+func (s *Store) PutMBArtist(ctx context.Context, a MBArtist) error {
+	if s.dryRun {
+		return nil
+	}
+	_, err := s.DB.ExecContext(ctx, `INSERT OR REPLACE INTO musicbrainz_artists (mbid, country, fetched_at_uts) VALUES (?, ?, ?)`,
+		a.MBID, a.Country, time.Now().Unix())
+	return err
+}
+
+// PutMBRelease is PutMBArtist for a release.
+func (s *Store) PutMBRelease(ctx context.Context, r MBRelease) error {
+	if s.dryRun {
+		return nil
+	}
+	_, err := s.DB.ExecContext(ctx, `INSERT OR REPLACE INTO musicbrainz_releases (mbid, year, kind, fetched_at_uts) VALUES (?, ?, ?, ?)`,
+		r.MBID, r.Year, r.Kind, time.Now().Unix())
+	return err
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Names are grouped by their normalized key (see NormalizeName), so
+// "Beyoncé" and "Beyonce" are one artist in every top list. Each scrobble
+// keeps the names it was stored with, their keys in artist_norm
+// (NormalizeArtist), track_norm and album_norm, and the canonical spelling
+// of each in artist_canonical, track_canonical and album_canonical. A
+// track's or album's key is its artist's key plus its own.
+//
+// The canonical spelling of a key is the one with the most live plays,
+// ties going to the first in byte order, counted across all users so a
+// merged household view agrees. Queries scoped by a Filter see it as the
+// name (see scopedColumns), and the rollups count by it; the ignore list and
+// Filter.ExcludeArtists match keys. Writes keep it current for the artists
+// they touch (refreshCanonical).
+const canonicalNames = `
+DROP TRIGGER IF EXISTS scrobbles_rollup_insert;
+DROP TRIGGER IF EXISTS scrobbles_rollup_delete;
+DROP TRIGGER IF EXISTS scrobbles_rollup_update;
+ALTER TABLE scrobbles ADD COLUMN artist_norm TEXT NOT NULL DEFAULT '';
+ALTER TABLE scrobbles ADD COLUMN track_norm TEXT NOT NULL DEFAULT '';
+ALTER TABLE scrobbles ADD COLUMN album_norm TEXT NOT NULL DEFAULT '';
+ALTER TABLE scrobbles ADD COLUMN artist_canonical TEXT NOT NULL DEFAULT '';
+ALTER TABLE scrobbles ADD COLUMN track_canonical TEXT NOT NULL DEFAULT '';
+ALTER TABLE scrobbles ADD COLUMN album_canonical TEXT;
+UPDATE scrobbles SET
+  artist_norm = normalize_artist(artist_name),
+  track_norm = normalize_name(track_name),
+  album_norm = normalize_name(COALESCE(album_name, '')),
+  artist_canonical = artist_name,
+  track_canonical = track_name,
+  album_canonical = album_name;
+CREATE INDEX IF NOT EXISTS idx_scrobbles_norm_track ON scrobbles(artist_norm, track_norm);
+CREATE INDEX IF NOT EXISTS idx_scrobbles_norm_album ON scrobbles(artist_norm, album_norm);
+-- The digest's indexes (see migration 4) follow the names it groups by.
+DROP INDEX IF EXISTS idx_scrobbles_played_cover;
+DROP INDEX IF EXISTS idx_scrobbles_artist_track;
+DROP INDEX IF EXISTS idx_scrobbles_artist_album;
+DROP INDEX IF EXISTS idx_scrobbles_year_local_artist;
+CREATE INDEX idx_scrobbles_played_cover ON scrobbles(user_name, played_at_uts, artist_canonical, track_canonical, album_canonical);
+CREATE INDEX idx_scrobbles_artist_track ON scrobbles(user_name, artist_canonical, track_canonical, played_at_uts);
+CREATE INDEX idx_scrobbles_artist_album ON scrobbles(user_name, artist_canonical, album_canonical, played_at_uts);
+CREATE INDEX idx_scrobbles_year_local_artist ON scrobbles(user_name, played_year_local, artist_canonical, played_at_uts, track_canonical);
+
+ALTER TABLE daily_artist_plays ADD COLUMN artist_norm TEXT NOT NULL DEFAULT '';
+ALTER TABLE daily_track_plays ADD COLUMN artist_norm TEXT NOT NULL DEFAULT '';
+ALTER TABLE daily_track_plays ADD COLUMN track_norm TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE ignores ADD COLUMN artist_norm TEXT NOT NULL DEFAULT '';
+ALTER TABLE ignores ADD COLUMN track_norm TEXT NOT NULL DEFAULT '';
+UPDATE ignores SET artist_norm = normalize_artist(artist_name), track_norm = normalize_name(track_name);
+CREATE INDEX IF NOT EXISTS idx_ignores_norm ON ignores(user_name, artist_norm, track_norm);
+`
+
+// rekeyNames recomputes every stored name key after NormalizeName changed
+// (schema 18). The triggers that follow the keys are off meanwhile, and the
+// canonical names, rollups and first plays are recounted after. Loved
+// tracks and affinity rows whose keys now coincide keep one of them until
+// the next sync replaces them.
+var rekeyNames = `
+DROP TRIGGER IF EXISTS scrobbles_rollup_insert;
+DROP TRIGGER IF EXISTS scrobbles_rollup_delete;
+DROP TRIGGER IF EXISTS scrobbles_rollup_update;
+DROP TRIGGER IF EXISTS scrobbles_first_played_insert;
+DROP TRIGGER IF EXISTS scrobbles_first_played_delete;
+DROP TRIGGER IF EXISTS scrobbles_first_played_update;
+UPDATE scrobbles SET
+  artist_norm = normalize_artist(artist_name),
+  track_norm = normalize_name(track_name),
+  album_norm = normalize_name(COALESCE(album_name, ''));
+UPDATE ignores SET artist_norm = normalize_artist(artist_name), track_norm = normalize_name(track_name);
+UPDATE OR REPLACE loved_tracks SET artist_norm = normalize_artist(artist_name), track_norm = normalize_name(track_name);
+UPDATE OR REPLACE artist_affinity SET artist_norm = normalize_artist(artist_name);
+UPDATE OR REPLACE track_affinity SET artist_norm = normalize_artist(artist_name), track_norm = normalize_name(track_name);
+` + strings.Join(canonicalRefresh(false), "\n") +
+	rollupTriggers(rollupCurrent) + rollupRebuild(rollupCurrent) +
+	firstPlayedTriggers(userMinSane) + firstPlayedRebuild(userMinSane)
+
+// scopedColumns are the scrobbles columns Filter.Scope's CTE passes on,
+// with the canonical names in place of the stored ones, which follow as
+// stored_track_name, stored_artist_name and stored_album_name.
+// TestScopedColumns keeps it in step with the table.
+const scopedColumns = `rowid, user_name, played_at_uts,
+  track_canonical AS track_name, artist_canonical AS artist_name, album_canonical AS album_name,
+  track_mbid, artist_mbid, album_mbid, lastfm_url, source_hash, source,
+  played_date_local, played_year_local, deleted_at_uts, deleted_reason,
+  artist_norm, track_norm, album_norm, artist_canonical, track_canonical, album_canonical,
+  s.track_name AS stored_track_name, s.artist_name AS stored_artist_name, s.album_name AS stored_album_name`
+
+// canonicalRefresh sets the canonical names of every artist, their tracks
+// and albums, or with touched those of the artist keys in the JSON array
+// bound to ?1.
+func canonicalRefresh(touched bool) []string {
+	in := "1"
+	if touched {
+		in = "artist_norm IN (SELECT value FROM json_each(?1))"
+	}
+	// sub is the name's own key column ("" for the artist), name the
+	// stored name and set the canonical column.
+	refresh := func(sub, name, set string) string {
+		key, join := "artist_norm", "scrobbles.artist_norm = canon.artist_norm"
+		if sub != "" {
+			key += ", " + sub
+			join += " AND scrobbles." + sub + " = canon." + sub
+		}
+		return `
+WITH spellings AS (
+  SELECT ` + key + `, ` + name + `, SUM(deleted_at_uts IS NULL) AS plays
+  FROM scrobbles
+  WHERE ` + in + ` AND ` + name + ` IS NOT NULL
+  GROUP BY ` + key + `, ` + name + `
+),
+canon AS (
+  SELECT DISTINCT ` + key + `,
+    FIRST_VALUE(` + name + `) OVER (PARTITION BY ` + key + ` ORDER BY plays DESC, ` + name + ` ASC) AS name
+  FROM spellings
+)
+UPDATE scrobbles SET ` + set + ` = canon.name
+FROM canon
+WHERE ` + join + ` AND scrobbles.` + set + ` IS NOT canon.name;`
+	}
+	return []string{
+		refresh("", "artist_name", "artist_canonical"),
+		refresh("track_norm", "track_name", "track_canonical"),
+		refresh("album_norm", "album_name", "album_canonical"),
+	}
+}
+
+// refreshCanonical recounts the canonical names of the given artists (as
+// stored, old or new), their tracks and their albums.
+func refreshCanonical(ctx context.Context, tx *sql.Tx, artists []string) error {
+	norms := map[string]bool{}
+	for _, a := range artists {
+		norms[NormalizeArtist(a)] = true
+	}
+	if len(norms) == 0 {
+		return nil
+	}
+	keys, err := json.Marshal(slices.Sorted(maps.Keys(norms)))
+	if err != nil {
+		return err
+	}
+	for _, stmt := range canonicalRefresh(true) {
+		if _, err := tx.ExecContext(ctx, stmt, string(keys)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canonicalFor returns the canonical names stored plays already give the
+// keys of artist, track and album, or the names themselves for keys not
+// seen before. album "" stays "".
+func canonicalFor(ctx context.Context, tx *sql.Tx, artist, track, album string) (string, string, string, error) {
+	var a, t, al sql.NullString
+	err := tx.QueryRowContext(ctx, `
+SELECT
+  (SELECT artist_canonical FROM scrobbles WHERE artist_norm = ?1 LIMIT 1),
+  (SELECT track_canonical FROM scrobbles WHERE artist_norm = ?1 AND track_norm = ?2 LIMIT 1),
+  (SELECT album_canonical FROM scrobbles WHERE artist_norm = ?1 AND album_norm = ?3 AND album_canonical IS NOT NULL LIMIT 1)
+`, NormalizeArtist(artist), NormalizeName(track), NormalizeName(album)).Scan(&a, &t, &al)
+	if err != nil {
+		return "", "", "", err
+	}
+	if album == "" {
+		al.String = ""
+	} else if !al.Valid {
+		al.String = album
+	}
+	if !a.Valid {
+		a.String = artist
+	}
+	if !t.Valid {
+		t.String = track
+	}
+	return a.String, t.String, al.String, nil
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+func TestNormalizeName(t *testing.T) {
+	for in, want := range map[string]string{
+		"Beyoncé":              "beyonce",
+		"Beyonce\u0301":        "beyonce", // NFD
+		"  BEYONCÉ  ":          "beyonce",
+		"Múm":                  "mum",
+		"Sigur  Rós":           "sigur ros",
+		"Don’t Stop Me Now":    "don't stop me now",
+		"Straße":               "strasse",
+		"Motörhead":            "motorhead",
+		"Кино":                 "кино",
+		"":                     "",
+		"Glósóli\t(Live)\n":    "glosoli (live)",
+		"Sœur — Two Versions":  "soeur - two versions",
+		"Ænima":                "aenima",
+		"I Am... Sasha Fierce": "i am... sasha fierce",
+		"I Am… Sasha Fierce":   "i am... sasha fierce",
+		"ﬁre":                  "fire",
+		"ＡＢＢＡ":                 "abba",
+		"İstanbul":             "istanbul",
+		// Other scripts keep their marks, whichever form they come in.
+		"ガ":            "ガ",
+		"\u30ab\u3099": "ガ", // NFD
+		"カ":            "カ",
+		"हिंदी":        "हिंदी",
+		"Ελλάδα":       "ελλάδα",
+	} {
+		if got := NormalizeName(in); got != want {
+			t.Errorf("NormalizeName(%q) = %q, want %q", in, got, want)
+		}
+	}
+	for in, want := range map[string]string{
+		"The Beatles":  "beatles",
+		"the  beatles": "beatles",
+		"The The":      "the",
+		"The":          "the",
+		"Theatre":      "theatre",
+		// Aliases Last.fm lets through.
+		"Simon & Garfunkel":    "simon and garfunkel",
+		"Earth, Wind & Fire":   "earth wind and fire",
+		"Mr. Oizo":             "mr oizo",
+		"  Boards  of Canada ": "boards of canada",
+	} {
+		if got := NormalizeArtist(in); got != want {
+			t.Errorf("NormalizeArtist(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestScopedColumns keeps Filter.Scope's column list in step with the
+// scrobbles table.
+func TestScopedColumns(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	rows, err := s.DB.QueryContext(ctx, `SELECT name FROM pragma_table_info('scrobbles')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	want := []string{"rowid"}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, name)
+	}
+	want = append(want, "stored_track_name", "stored_artist_name", "stored_album_name")
+	q, args := Filter{}.Scope(`SELECT * FROM scrobbles LIMIT 0`)
+	got, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	cols, err := got.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cols, want) {
+		t.Fatalf("scoped columns = %v, want %v", cols, want)
+	}
+}
+
+func TestNameVariantsGroup(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	uts := time.Now().Add(-48 * time.Hour).Unix()
+	insert := func(artist, track, album string) {
+		t.Helper()
+		uts++
+		tr := lastfm.Track{Name: track, Artist: lastfm.TextMBID{Text: artist}, Album: lastfm.TextMBID{Text: album}, Date: &lastfm.Date{UTS: strconv.FormatInt(uts, 10)}}
+		if _, err := s.InsertPage(ctx, []lastfm.Track{tr}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert("Beyoncé", "Halo", "I Am... Sasha Fierce")
+	insert("Beyoncé", "Halo", "I Am... Sasha Fierce")
+	insert("Beyonce", "halo", "I am... Sasha Fierce")
+	insert("The Beatles", "Let It Be", "")
+	insert("Beatles", "Let it be", "")
+	insert("Múm", "Green Grass of Tunnel", "")
+
+	// All time reads the rollups; a range cutting through a day scans.
+	scan := Filter{ExcludeRanges: []TimeRange{{From: 1, To: 2}}}
+	check := func(wantArtists, wantTracks, wantAlbums string) {
+		t.Helper()
+		for _, f := range []Filter{{}, scan} {
+			artists, err := s.TopArtists(ctx, f, TimeRange{}, 10)
+			if got := fmt.Sprint(artists); err != nil || got != wantArtists {
+				t.Errorf("top artists (%v) = %s, %v; want %s", f.Redacts(), got, err, wantArtists)
+			}
+			tracks, err := s.TopTracks(ctx, f, TimeRange{}, 10)
+			var ts []string
+			for _, c := range tracks {
+				ts = append(ts, fmt.Sprintf("%s/%s %d", c.Artist, c.Track, c.Plays))
+			}
+			if got := strings.Join(ts, ", "); err != nil || got != wantTracks {
+				t.Errorf("top tracks (%v) = %s, %v; want %s", f.Redacts(), got, err, wantTracks)
+			}
+			albums, err := s.TopAlbums(ctx, f, TimeRange{}, 10)
+			var as []string
+			for _, c := range albums {
+				as = append(as, fmt.Sprintf("%s/%s %d", c.Artist, c.Album, c.Plays))
+			}
+			if got := strings.Join(as, ", "); err != nil || got != wantAlbums {
+				t.Errorf("top albums (%v) = %s, %v; want %s", f.Redacts(), got, err, wantAlbums)
+			}
+		}
+	}
+	check("[{Beyoncé 3} {Beatles 2} {Múm 1}]",
+		"Beyoncé/Halo 3, Beatles/Let It Be 2, Múm/Green Grass of Tunnel 1",
+		"Beyoncé/I Am... Sasha Fierce 3")
+
+	// Exclusions and the ignore list match every spelling.
+	if _, err := s.AddIgnore(ctx, "beyonce", ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []Filter{
+		{ExcludeArtists: []string{"BEYONCE"}},
+		{ExcludeArtists: []string{"BEYONCE"}, ExcludeRanges: scan.ExcludeRanges},
+		{HideIgnored: true},
+		{HideIgnored: true, ExcludeRanges: scan.ExcludeRanges},
+	} {
+		artists, err := s.TopArtists(ctx, f, TimeRange{}, 10)
+		if got := fmt.Sprint(artists); err != nil || got != "[{Beatles 2} {Múm 1}]" {
+			t.Errorf("top artists %+v = %s, %v", f, got, err)
+		}
+	}
+	if !(Filter{ExcludeArtists: []string{"beyonce"}}).ExcludesArtist("Beyoncé") {
+		t.Error("ExcludesArtist missed another spelling")
+	}
+	if _, err := s.RemoveIgnore(ctx, "beyonce", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The most played spelling wins, so edits and deletes can change it.
+	if _, err := s.TombstoneScrobbles(ctx, EditMatch{Artist: "Beyoncé"}, TombstoneManual); err != nil {
+		t.Fatal(err)
+	}
+	check("[{Beatles 2} {Beyonce 1} {Múm 1}]",
+		"Beatles/Let It Be 2, Múm/Green Grass of Tunnel 1, Beyonce/halo 1",
+		"Beyonce/I am... Sasha Fierce 1")
+	if _, err := s.EditScrobbles(ctx, EditMatch{Artist: "Beatles"}, EditSet{Artist: "The Beatles"}); err != nil {
+		t.Fatal(err)
+	}
+	check("[{The Beatles 2} {Beyonce 1} {Múm 1}]",
+		"The Beatles/Let It Be 2, Múm/Green Grass of Tunnel 1, Beyonce/halo 1",
+		"Beyonce/I am... Sasha Fierce 1")
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"database/sql/driver"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	"modernc.org/sqlite"
+)
+
+// NormalizeName folds a track, album or artist name to the key that decides
+// whether two spellings are the same name: NFKC-normalized and case-folded,
+// trimmed, with runs of whitespace as one space, accents stripped from Latin
+// letters and typographic quotes and dashes made plain. Other scripts keep
+// their marks, so "ガ" stays apart from "カ". Precomposed and combining
+// spellings (NFC and NFD) share a key, as do "Beyoncé" and "BEYONCE", "múm"
+// and "Múm", "ﬁre" and "fire".
+func NormalizeName(s string) string {
+	s = cases.Fold().String(norm.NFKC.String(s))
+	var b strings.Builder
+	b.Grow(len(s))
+	space, latin := false, false
+	for _, r := range norm.NFD.String(s) {
+		if unicode.IsSpace(r) {
+			space, latin = b.Len() > 0, false
+			continue
+		}
+		if unicode.Is(unicode.Mn, r) {
+			if !latin {
+				b.WriteRune(r)
+			}
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		latin = unicode.Is(unicode.Latin, r)
+		if f, ok := plainFolds[r]; ok {
+			b.WriteString(f)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return norm.NFC.String(b.String())
+}
+
+// NormalizeArtist is NormalizeName for artists, which also folds what
+// differs between aliases of one band: a leading "The " ("The Beatles" and
+// "Beatles"), "&" for "and" ("Simon & Garfunkel"), and commas and periods
+// ("Earth, Wind & Fire", "Mr. Oizo"). "The The" keeps its second word.
+func NormalizeArtist(s string) string {
+	n := strings.ReplaceAll(NormalizeName(s), "&", " and ")
+	fields := strings.FieldsFunc(n, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '.'
+	})
+	if len(fields) == 0 {
+		return NormalizeName(s) // all punctuation, like "..."
+	}
+	if len(fields) > 1 && fields[0] == "the" {
+		fields = fields[1:]
+	}
+	return strings.Join(fields, " ")
+}
+
+// plainFolds maps case-folded letters that don't decompose into a base
+// letter and accents, and typographic punctuation, to what NormalizeName
+// writes instead.
+var plainFolds = map[rune]string{
+	'æ': "ae", 'œ': "oe", 'þ': "th", 'ð': "d", 'đ': "d", 'ħ': "h",
+	'ı': "i", 'ł': "l", 'ø': "o", 'ŧ': "t",
+	'‘': "'", '’': "'", '‚': "'", '′': "'",
+	'“': `"`, '”': `"`, '„': `"`,
+	'‐': "-", '‑': "-", '‒': "-", '–': "-", '—': "-", '―': "-",
+}
+
+// The migration that adds the norm columns fills them in SQL, so it needs
+// the Go functions (see nameFormsTable).
+func init() {
+	for name, fn := range map[string]func(string) string{
+		"normalize_name":   NormalizeName,
+		"normalize_artist": NormalizeArtist,
+	} {
+		err := sqlite.RegisterDeterministicScalarFunction(name, 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+			switch v := args[0].(type) {
+			case string:
+				return fn(v), nil
+			case []byte:
+				return fn(string(v)), nil
+			}
+			return "", nil
+		})
+		if err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Since schema version 7 one database can hold several Last.fm accounts.
+// Every row about a listener's history carries its user_name; the Store
+// opened for a user (OpenOptions.User) reads and writes only that user's
+// rows. lastfm_cache and the musicbrainz tables hold Last.fm's and
+// MusicBrainz's own data and stay shared.
+//
+// Rows stored before users existed, or without one, have an empty user_name.
+// The first named user to open the database claims them (claimUnowned), so
+// a single-user archive becomes that user's without a rewrite by hand.
+const profileTables = `
+CREATE TABLE users (
+  name TEXT PRIMARY KEY COLLATE NOCASE,
+  added_at_uts INTEGER NOT NULL
+);
+
+CREATE TABLE scrobbles_v7 (
+  user_name TEXT NOT NULL DEFAULT '',
+  played_at_uts INTEGER NOT NULL,
+  track_name TEXT NOT NULL,
+  artist_name TEXT NOT NULL,
+  album_name TEXT,
+
+  track_mbid TEXT,
+  artist_mbid TEXT,
+  album_mbid TEXT,
+
+  lastfm_url TEXT,
+
+  source_hash TEXT NOT NULL,
+  source TEXT NOT NULL DEFAULT 'lastfm_api',
+  played_date_local TEXT,
+  played_year_local INTEGER,
+
+  UNIQUE (user_name, source_hash)
+);
+INSERT INTO scrobbles_v7 (rowid, played_at_uts, track_name, artist_name, album_name,
+  track_mbid, artist_mbid, album_mbid, lastfm_url, source_hash, source, played_date_local, played_year_local)
+SELECT rowid, played_at_uts, track_name, artist_name, album_name,
+  track_mbid, artist_mbid, album_mbid, lastfm_url, source_hash, source, played_date_local, played_year_local
+FROM scrobbles;
+DROP TABLE scrobbles;
+ALTER TABLE scrobbles_v7 RENAME TO scrobbles;
+-- The old index names, now led by user_name, so schema.sql finds them.
+CREATE INDEX idx_scrobbles_played_at_uts ON scrobbles(user_name, played_at_uts);
+CREATE INDEX idx_scrobbles_source ON scrobbles(user_name, source);
+CREATE INDEX idx_scrobbles_played_cover ON scrobbles(user_name, played_at_uts, artist_name, track_name, album_name);
+CREATE INDEX idx_scrobbles_artist_track ON scrobbles(user_name, artist_name, track_name, played_at_uts);
+CREATE INDEX idx_scrobbles_artist_album ON scrobbles(user_name, artist_name, album_name, played_at_uts);
+CREATE INDEX idx_scrobbles_year_local_artist ON scrobbles(user_name, played_year_local, artist_name, played_at_uts, track_name);
+
+CREATE TABLE state_v7 (
+  user_name TEXT NOT NULL DEFAULT '',
+  key TEXT NOT NULL,
+  value TEXT NOT NULL,
+
+  PRIMARY KEY (user_name, key)
+);
+INSERT INTO state_v7 (key, value) SELECT key, value FROM state;
+DROP TABLE state;
+ALTER TABLE state_v7 RENAME TO state;
+
+CREATE TABLE artist_rank_history_v7 (
+  user_name TEXT NOT NULL DEFAULT '',
+  chart_date TEXT NOT NULL,
+  rank INTEGER NOT NULL,
+  artist_name TEXT NOT NULL,
+  plays INTEGER NOT NULL,
+
+  PRIMARY KEY (user_name, chart_date, artist_name)
+);
+INSERT INTO artist_rank_history_v7 (chart_date, rank, artist_name, plays)
+SELECT chart_date, rank, artist_name, plays FROM artist_rank_history;
+DROP TABLE artist_rank_history;
+ALTER TABLE artist_rank_history_v7 RENAME TO artist_rank_history;
+CREATE INDEX idx_artist_rank_history_artist ON artist_rank_history(user_name, artist_name, chart_date);
+
+CREATE TABLE external_plays_v7 (
+  user_name TEXT NOT NULL DEFAULT '',
+  source TEXT NOT NULL,
+  artist_name TEXT NOT NULL,
+  track_name TEXT NOT NULL,
+  album_name TEXT NOT NULL DEFAULT '',
+  play_count INTEGER NOT NULL,
+  last_played_uts INTEGER,
+  added_uts INTEGER,
+  imported_at_uts INTEGER NOT NULL,
+
+  PRIMARY KEY (user_name, source, artist_name, track_name, album_name)
+);
+INSERT INTO external_plays_v7 (source, artist_name, track_name, album_name, play_count, last_played_uts, added_uts, imported_at_uts)
+SELECT source, artist_name, track_name, album_name, play_count, last_played_uts, added_uts, imported_at_uts FROM external_plays;
+DROP TABLE external_plays;
+ALTER TABLE external_plays_v7 RENAME TO external_plays;
+
+CREATE TABLE ignores_v7 (
+  user_name TEXT NOT NULL DEFAULT '',
+  artist_name TEXT NOT NULL COLLATE NOCASE,
+  track_name TEXT NOT NULL DEFAULT '' COLLATE NOCASE,
+  added_at_uts INTEGER NOT NULL,
+
+  PRIMARY KEY (user_name, artist_name, track_name)
+);
+INSERT INTO ignores_v7 (artist_name, track_name, added_at_uts) SELECT artist_name, track_name, added_at_uts FROM ignores;
+DROP TABLE ignores;
+ALTER TABLE ignores_v7 RENAME TO ignores;
+
+CREATE TABLE recommend_blocks_v7 (
+  user_name TEXT NOT NULL DEFAULT '',
+  artist_name TEXT NOT NULL COLLATE NOCASE,
+  added_at_uts INTEGER NOT NULL,
+
+  PRIMARY KEY (user_name, artist_name)
+);
+INSERT INTO recommend_blocks_v7 (artist_name, added_at_uts) SELECT artist_name, added_at_uts FROM recommend_blocks;
+DROP TABLE recommend_blocks;
+ALTER TABLE recommend_blocks_v7 RENAME TO recommend_blocks;
+
+ALTER TABLE recommendations ADD COLUMN user_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE edits ADD COLUMN user_name TEXT NOT NULL DEFAULT '';
+
+DROP TABLE daily_artist_plays;
+DROP TABLE daily_track_plays;
+CREATE TABLE daily_artist_plays (
+  user_name TEXT NOT NULL,
+  day INTEGER NOT NULL,
+  artist_name TEXT NOT NULL,
+  plays INTEGER NOT NULL,
+
+  PRIMARY KEY (user_name, day, artist_name)
+) WITHOUT ROWID;
+CREATE TABLE daily_track_plays (
+  user_name TEXT NOT NULL,
+  day INTEGER NOT NULL,
+  artist_name TEXT NOT NULL,
+  track_name TEXT NOT NULL,
+  album_name TEXT NOT NULL,
+  plays INTEGER NOT NULL,
+  last_played_uts INTEGER NOT NULL,
+
+  PRIMARY KEY (user_name, day, artist_name, track_name, album_name)
+) WITHOUT ROWID;
+`
+
+// profileScoped are the tables whose rows belong to a user.
+var profileScoped = []string{
+	"scrobbles", "state", "artist_rank_history", "external_plays", "ignores",
+	"recommend_blocks", "recommendations", "edits", "daily_artist_plays", "daily_track_plays", "runs",
+	"first_played_artists", "first_played_albums", "loved_tracks", "artist_affinity", "track_affinity",
+}
+
+// User is the Last.fm user whose rows the store reads and writes; "" for a
+// database that has never been opened with one.
+func (s *Store) User() string {
+	return s.user
+}
+
+// Users lists the users the database holds, by name.
+func (s *Store) Users(ctx context.Context) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT name FROM users ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		out = append(out, name)
+	}
+	return out, rows.Err()
+}
+
+// ForUser returns a view of the database as name, one of its users, to read
+// another household member's history. The view shares s's connection and
+// lock: close s, not it.
+func (s *Store) ForUser(ctx context.Context, name string) (*Store, error) {
+	users, err := s.Users(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if strings.EqualFold(u, name) {
+			v := *s
+			v.user = u
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("the database holds no user %q", name)
+}
+
+// useProfile picks the user the store works for: name if given (added, and
+// claiming unowned rows, if new), else the database's only user. A database
+// holding several needs a name.
+func (s *Store) useProfile(ctx context.Context, name string) error {
+	users, err := s.Users(ctx)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		switch len(users) {
+		case 0:
+		case 1:
+			s.user = users[0]
+		default:
+			return fmt.Errorf("the database holds several users (%s); pick one with --user", strings.Join(users, ", "))
+		}
+		return nil
+	}
+	for _, u := range users {
+		if strings.EqualFold(u, name) {
+			s.user = u
+			return nil
+		}
+	}
+	s.user = name
+	if s.dryRun {
+		return nil
+	}
+	return s.addUser(ctx, name, len(users) == 0)
+}
+
+// addUser records a new user, first claiming unowned rows if claim is set.
+func (s *Store) addUser(ctx context.Context, name string, claim bool) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `INSERT INTO users (name, added_at_uts) VALUES (?, ?)`, name, time.Now().Unix()); err != nil {
+		return err
+	}
+	if claim {
+		if err := claimUnowned(ctx, tx, name); err != nil {
+			return err
+		}
+	}
+	return s.commit(tx)
+}
+
+// claimUnowned gives the rows without a user to name.
+func claimUnowned(ctx context.Context, db execer, name string) error {
+	for _, table := range profileScoped {
+		if _, err := db.ExecContext(ctx, `UPDATE `+table+` SET user_name = ? WHERE user_name = ''`, name); err != nil {
+			return fmt.Errorf("claim %s: %w", table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+func TestUsersShareADatabase(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	play := func(s *Store, artist string, uts int64) {
+		t.Helper()
+		tr := lastfm.Track{Name: "Track", Artist: lastfm.TextMBID{Text: artist}, Date: &lastfm.Date{UTS: strconv.FormatInt(uts, 10)}}
+		if _, err := s.InsertPage(ctx, []lastfm.Track{tr}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	open := func(user string) *Store {
+		t.Helper()
+		s, err := Open(ctx, OpenOptions{DataDir: dir, User: user})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	top := func(s *Store) string {
+		t.Helper()
+		as, err := s.TopArtists(ctx, Filter{}, TimeRange{}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(as)
+	}
+
+	// Plays stored before there were users go to the first one named.
+	s := open("")
+	play(s, "Burial", 1700000000)
+	if err := s.SetState(ctx, "k", "legacy"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = open("Alice")
+	play(s, "Burial", 1700000300)
+	if got := top(s); got != "[{Burial 2}]" {
+		t.Fatalf("alice's top = %s", got)
+	}
+	if v, _ := s.GetState(ctx, "k"); v != "legacy" {
+		t.Fatalf("alice's state k = %q, want the unowned value", v)
+	}
+	if _, err := s.AddIgnore(ctx, "Burial", ""); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// The same listen is a new scrobble for someone else.
+	s = open("bob")
+	play(s, "Burial", 1700000000)
+	play(s, "Kode9", 1700000600)
+	if got := top(s); got != "[{Burial 1} {Kode9 1}]" {
+		t.Fatalf("bob's top = %s", got)
+	}
+	if got, _ := s.TopArtists(ctx, Filter{HideIgnored: true}, TimeRange{}, 10); fmt.Sprint(got) != "[{Burial 1} {Kode9 1}]" {
+		t.Fatalf("alice's ignore list hid bob's plays: %v", got)
+	}
+	if v, _ := s.GetState(ctx, "k"); v != "" {
+		t.Fatalf("bob's state k = %q, want unset", v)
+	}
+	s.Close()
+
+	// Names match case-insensitively; with several users one must be named.
+	s = open("ALICE")
+	if s.User() != "Alice" || top(s) != "[{Burial 2}]" {
+		t.Fatalf("user %q, top %s", s.User(), top(s))
+	}
+	s.Close()
+	if _, err := Open(ctx, OpenOptions{DataDir: dir}); err == nil {
+		t.Fatal("opening a two-user database without a user succeeded")
+	}
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+// PrunedBeforeKey is the state key holding the played_at_uts before which
+// PruneScrobbles dropped the user's Last.fm scrobbles. InsertPage skips
+// older tracks, so backfill and reconcile don't fetch them back.
+const PrunedBeforeKey = "prune.before_uts"
+
+// PruneMatch selects the scrobbles PruneScrobbles drops: those played
+// before Before, from Source, or both. The zero match selects nothing.
+type PruneMatch struct {
+	Before int64
+	Source string
+}
+
+func (m PruneMatch) where() (string, []any) {
+	conds, args := []string{"user_name = ?"}, []any{}
+	if m.Before != 0 {
+		conds = append(conds, "played_at_uts < ?")
+		args = append(args, m.Before)
+	}
+	if m.Source != "" {
+		conds = append(conds, "source = ?")
+		args = append(args, m.Source)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// PruneResult reports what PruneScrobbles dropped.
+type PruneResult struct {
+	Scrobbles  int64 // live ones, which EachPruned passed on
+	Tombstoned int64
+	MinPlayed  int64 // earliest played_at_uts dropped, 0 if none
+}
+
+// EachPruned calls fn for every live scrobble m selects, oldest first, as
+// EachScrobble does: what PruneScrobbles would drop, to archive first.
+func (s *Store) EachPruned(ctx context.Context, m PruneMatch, fn func(Scrobble) error) error {
+	if m == (PruneMatch{}) {
+		return errEmptyMatch
+	}
+	cond, args := m.where()
+	rows, err := s.DB.QueryContext(ctx, `
+SELECT played_at_uts, artist_name, track_name, album_name, track_mbid, artist_mbid, album_mbid, lastfm_url, source
+FROM scrobbles
+WHERE `+cond+` AND deleted_at_uts IS NULL
+ORDER BY played_at_uts ASC, rowid ASC
+`, append([]any{s.user}, args...)...)
+	if err != nil {
+		return err
+	}
+	return scanScrobbles(rows, fn)
+}
+
+// PruneScrobbles removes the scrobbles m selects, tombstoned ones too, from
+// the database for good: unlike TombstoneScrobbles nothing is kept, so
+// archive them first (see EachPruned). Dropping Last.fm scrobbles by date
+// records m.Before under PrunedBeforeKey, so they aren't fetched again.
+func (s *Store) PruneScrobbles(ctx context.Context, m PruneMatch) (PruneResult, error) {
+	if m == (PruneMatch{}) {
+		return PruneResult{}, errEmptyMatch
+	}
+	cond, args := m.where()
+	args = append([]any{s.user}, args...)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return PruneResult{}, err
+	}
+	defer tx.Rollback()
+
+	var res PruneResult
+	err = tx.QueryRowContext(ctx, `
+SELECT COUNT(*) FILTER (WHERE deleted_at_uts IS NULL), COUNT(*) FILTER (WHERE deleted_at_uts IS NOT NULL), COALESCE(MIN(played_at_uts), 0)
+FROM scrobbles WHERE `+cond, args...).Scan(&res.Scrobbles, &res.Tombstoned, &res.MinPlayed)
+	if err != nil {
+		return PruneResult{}, err
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT DISTINCT artist_name FROM scrobbles WHERE `+cond, args...)
+	if err != nil {
+		return PruneResult{}, err
+	}
+	var artists []string
+	for rows.Next() {
+		var a string
+		if err := rows.Scan(&a); err != nil {
+			rows.Close()
+			return PruneResult{}, err
+		}
+		artists = append(artists, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return PruneResult{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM scrobbles WHERE `+cond, args...); err != nil {
+		return PruneResult{}, err
+	}
+	if err := refreshCanonical(ctx, tx, artists); err != nil {
+		return PruneResult{}, err
+	}
+	if m.Before != 0 && (m.Source == "" || m.Source == SourceLastFMAPI) {
+		// Keep the later of two prunes' dates.
+		if _, err := tx.ExecContext(ctx, setStateSQL+` WHERE CAST(excluded.value AS INTEGER) > CAST(value AS INTEGER)`,
+			s.user, PrunedBeforeKey, strconv.FormatInt(m.Before, 10)); err != nil {
+			return PruneResult{}, err
+		}
+	}
+	return res, s.commit(tx)
+}
+
+// PrunedBefore returns the date under PrunedBeforeKey, 0 if nothing was
+// pruned by date.
+func (s *Store) PrunedBefore(ctx context.Context) (int64, error) {
+	v, err := s.GetState(ctx, PrunedBeforeKey)
+	if err != nil || v == "" {
+		return 0, err
+	}
+	return parseI64(v)
+}
+
+// afterPrune drops the dated tracks played before PrunedBefore.
+func (s *Store) afterPrune(ctx context.Context, tracks []lastfm.Track) ([]lastfm.Track, int, error) {
+	before, err := s.PrunedBefore(ctx)
+	if err != nil || before == 0 {
+		return tracks, 0, err
+	}
+	kept := make([]lastfm.Track, 0, len(tracks))
+	for _, t := range tracks {
+		if t.Date != nil && t.Date.UTS != "" {
+			if uts, err := parseI64(t.Date.UTS); err == nil && uts < before {
+				continue
+			}
+		}
+		kept = append(kept, t)
+	}
+	return kept, len(tracks) - len(kept), nil
+}
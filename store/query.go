@@ -0,0 +1,579 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// MinSaneUTS is 2000-01-01, the default minimum sane timestamp. Last.fm
+// returns 1970 placeholders for plays it lost the time of; scrobbles before
+// the store's threshold (see Store.MinSaneUTS) are counted as suspect and
+// left out of rankings.
+const MinSaneUTS = 946684800
+
+// RangeCount summarizes the scrobbles in a TimeRange.
+type RangeCount struct {
+	Count  int64
+	MinUTS int64
+	MaxUTS int64
+}
+
+// ArtistCount is an artist's play count in a ranking.
+type ArtistCount struct {
+	Artist string
+	Plays  int64
+}
+
+// TrackCount is a track's play count in a ranking.
+type TrackCount struct {
+	Artist        string
+	Track         string
+	Plays         int64
+	LastPlayedUTS int64
+}
+
+// AlbumCount is an album's play count in a ranking.
+type AlbumCount struct {
+	Artist        string
+	Album         string
+	Plays         int64
+	LastPlayedUTS int64
+}
+
+// YearArtist is an artist's place in one calendar year, in the home time
+// zone.
+type YearArtist struct {
+	Year   int
+	Rank   int
+	Artist string
+	Plays  int64
+}
+
+// MonthPlays is an artist's plays in one calendar month (YYYY-MM), in the
+// home time zone.
+type MonthPlays struct {
+	Month string `json:"month"`
+	Plays int64  `json:"plays"`
+}
+
+// CountByRange counts the scrobbles the filter keeps within r.
+func (s *Store) CountByRange(ctx context.Context, f Filter, r TimeRange) (RangeCount, error) {
+	f.User = s.user
+	where, args := r.where()
+	q, args := f.Scope(`SELECT COUNT(*), MIN(played_at_uts), MAX(played_at_uts) FROM scrobbles WHERE `+where, args...)
+	var c RangeCount
+	var minUTS, maxUTS sql.NullInt64
+	if err := s.DB.QueryRowContext(ctx, q, args...).Scan(&c.Count, &minUTS, &maxUTS); err != nil {
+		return RangeCount{}, err
+	}
+	c.MinUTS, c.MaxUTS = minUTS.Int64, maxUTS.Int64
+	return c, nil
+}
+
+// SuspectCount counts the scrobbles the filter keeps that are dated before
+// MinSaneUTS.
+func (s *Store) SuspectCount(ctx context.Context, f Filter) (int64, error) {
+	c, err := s.CountByRange(ctx, f, TimeRange{To: s.minSane})
+	return c.Count, err
+}
+
+// RecentScrobbles returns the latest dated scrobbles the filter keeps,
+// newest first. Only the play time, artist, track and album are set.
+func (s *Store) RecentScrobbles(ctx context.Context, f Filter, limit int) ([]Scrobble, error) {
+	f.User = s.user
+	q, args := f.Scope(`
+SELECT played_at_uts, artist_name, track_name, COALESCE(album_name, '')
+FROM scrobbles
+WHERE played_at_uts >= ?
+ORDER BY played_at_uts DESC, rowid DESC
+LIMIT ?
+`, s.minSane, limit)
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Scrobble{}
+	for rows.Next() {
+		var sc Scrobble
+		if err := rows.Scan(&sc.PlayedAtUTS, &sc.Artist, &sc.Track, &sc.Album); err != nil {
+			return nil, err
+		}
+		out = append(out, sc)
+	}
+	return out, rows.Err()
+}
+
+// ScrobblesIn returns the scrobbles the filter keeps within r, oldest
+// first.
+func (s *Store) ScrobblesIn(ctx context.Context, f Filter, r TimeRange) ([]Scrobble, error) {
+	f.User = s.user
+	where, wargs := r.where()
+	q, args := f.Scope(`
+SELECT played_at_uts, artist_name, track_name, COALESCE(album_name, ''), source
+FROM scrobbles
+WHERE played_at_uts >= ? AND `+where+`
+ORDER BY played_at_uts ASC, rowid ASC
+`, append([]any{s.minSane}, wargs...)...)
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Scrobble{}
+	for rows.Next() {
+		var sc Scrobble
+		if err := rows.Scan(&sc.PlayedAtUTS, &sc.Artist, &sc.Track, &sc.Album, &sc.Source); err != nil {
+			return nil, err
+		}
+		out = append(out, sc)
+	}
+	return out, rows.Err()
+}
+
+// Summary describes the whole library, ignores and all.
+type Summary struct {
+	Scrobbles int64
+	// Suspect scrobbles are dated before MinSaneUTS; the dates and per-day
+	// figures below leave them out.
+	Suspect  int64
+	Artists  int64
+	Tracks   int64
+	Albums   int64
+	FirstUTS int64
+	LastUTS  int64
+	// Days spans the first to the last play's date, inclusive, in the home
+	// time zone.
+	Days int64
+	// BusiestDay is the local date (YYYY-MM-DD) with the most plays; the
+	// earliest wins a tie.
+	BusiestDay      string
+	BusiestDayPlays int64
+}
+
+// Summary counts scrobbles and distinct artists, tracks (artist and title)
+// and albums (artist and album name), and finds the busiest day.
+func (s *Store) Summary(ctx context.Context) (Summary, error) {
+	var sum Summary
+	all := Filter{User: s.user}
+	q, args := all.Scope(`SELECT COUNT(*), COUNT(DISTINCT artist_name) FROM scrobbles`)
+	if err := s.DB.QueryRowContext(ctx, q, args...).Scan(&sum.Scrobbles, &sum.Artists); err != nil {
+		return Summary{}, err
+	}
+	q, args = all.Scope(`SELECT COUNT(*) FROM (SELECT 1 FROM scrobbles GROUP BY artist_name, track_name)`)
+	if err := s.DB.QueryRowContext(ctx, q, args...).Scan(&sum.Tracks); err != nil {
+		return Summary{}, err
+	}
+	q, args = all.Scope(`SELECT COUNT(*) FROM (SELECT 1 FROM scrobbles WHERE album_name != '' GROUP BY artist_name, album_name)`)
+	if err := s.DB.QueryRowContext(ctx, q, args...).Scan(&sum.Albums); err != nil {
+		return Summary{}, err
+	}
+	dated, err := s.CountByRange(ctx, all, TimeRange{From: s.minSane})
+	if err != nil {
+		return Summary{}, err
+	}
+	sum.Suspect = sum.Scrobbles - dated.Count
+	if dated.Count == 0 {
+		return sum, nil
+	}
+	sum.FirstUTS, sum.LastUTS = dated.MinUTS, dated.MaxUTS
+	first, _ := localDate(dated.MinUTS, s.loc)
+	last, _ := localDate(dated.MaxUTS, s.loc)
+	f, _ := time.Parse(time.DateOnly, first)
+	l, _ := time.Parse(time.DateOnly, last)
+	sum.Days = int64(l.Sub(f)/(24*time.Hour)) + 1
+
+	// The rollups hold a row per artist per day: far fewer than plays.
+	var day int64
+	err = s.DB.QueryRowContext(ctx, `
+SELECT day, SUM(plays) AS plays
+FROM daily_artist_plays
+WHERE user_name = ? AND day >= ?
+GROUP BY day
+ORDER BY plays DESC, day ASC
+LIMIT 1
+`, s.user, s.minSane).Scan(&day, &sum.BusiestDayPlays)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Summary{}, err
+	}
+	if err == nil {
+		sum.BusiestDay = time.Unix(day, 0).UTC().Format(time.DateOnly)
+	}
+	return sum, nil
+}
+
+// TopArtists ranks artists by plays within r, most played first; ties go to
+// the artist played on a later day (all the rollups know), then by name, so
+// the order is the same on every run. It reads the daily rollups when r and
+// the filter keep to whole local days.
+func (s *Store) TopArtists(ctx context.Context, f Filter, r TimeRange, limit int) ([]ArtistCount, error) {
+	f.User = s.user
+	var q string
+	var args []any
+	if cond, cargs, ok, err := s.rollupWhere(ctx, f, r, true); err != nil {
+		return nil, err
+	} else if ok {
+		q, args = `
+SELECT r.artist_name, SUM(r.plays) AS plays
+FROM daily_artist_plays r
+WHERE `+cond+`
+GROUP BY r.artist_name
+ORDER BY plays DESC, MAX(r.day) DESC, r.artist_name ASC
+LIMIT ?
+`, append(cargs, limit)
+	} else {
+		where, wargs := r.where()
+		q, args = f.Scope(`
+SELECT artist_name, COUNT(*) AS plays
+FROM scrobbles
+WHERE played_at_uts >= ? AND `+where+`
+GROUP BY artist_name
+ORDER BY plays DESC, MAX(played_date_local) DESC, artist_name ASC
+LIMIT ?
+`, append(append([]any{s.minSane}, wargs...), limit)...)
+	}
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ArtistCount{}
+	for rows.Next() {
+		var c ArtistCount
+		if err := rows.Scan(&c.Artist, &c.Plays); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// NewArtists ranks the artists the filter keeps whose first dated play is at
+// or after since, most played first: discoveries since then.
+func (s *Store) NewArtists(ctx context.Context, f Filter, since int64, limit int) ([]ArtistCount, error) {
+	f.User = s.user
+	q, args := f.Scope(`
+SELECT artist_name, COUNT(*) AS plays
+FROM scrobbles
+WHERE played_at_uts >= ?
+GROUP BY artist_name
+HAVING MIN(played_at_uts) >= ?
+ORDER BY plays DESC, MAX(played_at_uts) DESC, artist_name ASC
+LIMIT ?
+`, s.minSane, since, limit)
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []ArtistCount{}
+	for rows.Next() {
+		var c ArtistCount
+		if err := rows.Scan(&c.Artist, &c.Plays); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// TopTracks ranks tracks by plays within r, most played first, then the
+// last played, then by name. Like TopArtists, it reads the rollups when it
+// can.
+func (s *Store) TopTracks(ctx context.Context, f Filter, r TimeRange, limit int) ([]TrackCount, error) {
+	return s.trackCounts(ctx, f, r, "", nil, limit, true)
+}
+
+// StaleTracks ranks tracks by all-time plays among those not played since
+// before, most played first: favourites that dropped out of rotation.
+// Tracks seldom repeat within a day, so this reads scrobbles, whose
+// (artist, track) index already groups them.
+func (s *Store) StaleTracks(ctx context.Context, f Filter, before int64, limit int) ([]TrackCount, error) {
+	return s.trackCounts(ctx, f, TimeRange{}, "HAVING last_played < ?", []any{before}, limit, false)
+}
+
+func (s *Store) trackCounts(ctx context.Context, f Filter, r TimeRange, having string, hargs []any, limit int, useRollup bool) ([]TrackCount, error) {
+	f.User = s.user
+	var q string
+	var args []any
+	if cond, cargs, ok, err := s.rollupWhere(ctx, f, r, false); err != nil {
+		return nil, err
+	} else if ok && useRollup {
+		q, args = `
+SELECT r.artist_name, r.track_name, SUM(r.plays) AS plays, MAX(r.last_played_uts) AS last_played
+FROM daily_track_plays r
+WHERE `+cond+`
+GROUP BY r.artist_name, r.track_name
+`+having+`
+ORDER BY plays DESC, last_played DESC, r.artist_name ASC, r.track_name ASC
+LIMIT ?
+`, append(append(cargs, hargs...), limit)
+	} else {
+		where, wargs := r.where()
+		q, args = f.Scope(`
+SELECT artist_name, track_name, COUNT(*) AS plays, MAX(played_at_uts) AS last_played
+FROM scrobbles
+WHERE played_at_uts >= ? AND `+where+`
+GROUP BY artist_name, track_name
+`+having+`
+ORDER BY plays DESC, last_played DESC, artist_name ASC, track_name ASC
+LIMIT ?
+`, append(append(append([]any{s.minSane}, wargs...), hargs...), limit)...)
+	}
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []TrackCount{}
+	for rows.Next() {
+		var c TrackCount
+		if err := rows.Scan(&c.Artist, &c.Track, &c.Plays, &c.LastPlayedUTS); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// VariousArtists is the artist TopAlbumsAcrossArtists and
+// StaleAlbumsAcrossArtists give an album played under more than one.
+const VariousArtists = "Various Artists"
+
+// TopAlbums ranks albums by plays within r, most played first, breaking
+// ties like TopTracks. Scrobbles without an album don't count.
+func (s *Store) TopAlbums(ctx context.Context, f Filter, r TimeRange, limit int) ([]AlbumCount, error) {
+	return s.albumCounts(ctx, f, r, "", nil, limit, true, false)
+}
+
+// StaleAlbums is StaleTracks for albums.
+func (s *Store) StaleAlbums(ctx context.Context, f Filter, before int64, limit int) ([]AlbumCount, error) {
+	return s.albumCounts(ctx, f, TimeRange{}, "HAVING last_played < ?", []any{before}, limit, false, false)
+}
+
+// TopAlbumsAcrossArtists is TopAlbums with albums grouped by title alone,
+// so a compilation, whose tracks are scrobbled under each track's artist,
+// counts as one album credited to VariousArtists. Where one title covers
+// several album MBIDs (two artists' "Greatest Hits"), plays with an MBID
+// are grouped by it instead. It always reads scrobbles.
+func (s *Store) TopAlbumsAcrossArtists(ctx context.Context, f Filter, r TimeRange, limit int) ([]AlbumCount, error) {
+	return s.albumCounts(ctx, f, r, "", nil, limit, false, true)
+}
+
+// StaleAlbumsAcrossArtists is StaleAlbums grouped like
+// TopAlbumsAcrossArtists.
+func (s *Store) StaleAlbumsAcrossArtists(ctx context.Context, f Filter, before int64, limit int) ([]AlbumCount, error) {
+	return s.albumCounts(ctx, f, TimeRange{}, "HAVING last_played < ?", []any{before}, limit, false, true)
+}
+
+func (s *Store) albumCounts(ctx context.Context, f Filter, r TimeRange, having string, hargs []any, limit int, useRollup, acrossArtists bool) ([]AlbumCount, error) {
+	f.User = s.user
+	var q string
+	var args []any
+	if cond, cargs, ok, err := s.rollupWhere(ctx, f, r, false); err != nil {
+		return nil, err
+	} else if ok && useRollup {
+		q, args = `
+SELECT r.artist_name, r.album_name, SUM(r.plays) AS plays, MAX(r.last_played_uts) AS last_played
+FROM daily_track_plays r
+WHERE `+cond+`
+  AND r.album_name != ''
+GROUP BY r.artist_name, r.album_name
+`+having+`
+ORDER BY plays DESC, last_played DESC, r.artist_name ASC, r.album_name ASC
+LIMIT ?
+`, append(append(cargs, hargs...), limit)
+	} else if acrossArtists {
+		where, wargs := r.where()
+		rargs := append([]any{s.minSane}, wargs...)
+		// titles counts the releases (album MBIDs) each title covers.
+		q, args = f.Scope(`
+WITH titles AS (
+  SELECT album_norm, COUNT(DISTINCT NULLIF(album_mbid, '')) AS releases
+  FROM scrobbles
+  WHERE played_at_uts >= ? AND `+where+`
+    AND album_norm != ''
+  GROUP BY album_norm
+)
+SELECT CASE WHEN COUNT(DISTINCT s.artist_norm) > 1 THEN ? ELSE MIN(s.artist_name) END AS artist,
+  MIN(s.album_name) AS album, COUNT(*) AS plays, MAX(s.played_at_uts) AS last_played
+FROM scrobbles s
+JOIN titles t USING (album_norm)
+WHERE played_at_uts >= ? AND `+where+`
+  AND s.album_name IS NOT NULL
+  AND s.album_name != ''
+GROUP BY s.album_norm, CASE WHEN t.releases > 1 THEN COALESCE(s.album_mbid, '') ELSE '' END
+`+having+`
+ORDER BY plays DESC, last_played DESC, artist ASC, album ASC
+LIMIT ?
+`, append(append(append(append(rargs, VariousArtists), rargs...), hargs...), limit)...)
+	} else {
+		where, wargs := r.where()
+		q, args = f.Scope(`
+SELECT artist_name, album_name, COUNT(*) AS plays, MAX(played_at_uts) AS last_played
+FROM scrobbles
+WHERE played_at_uts >= ? AND `+where+`
+  AND album_name IS NOT NULL
+  AND album_name != ''
+GROUP BY artist_name, album_name
+`+having+`
+ORDER BY plays DESC, last_played DESC, artist_name ASC, album_name ASC
+LIMIT ?
+`, append(append(append([]any{s.minSane}, wargs...), hargs...), limit)...)
+	}
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []AlbumCount{}
+	for rows.Next() {
+		var c AlbumCount
+		if err := rows.Scan(&c.Artist, &c.Album, &c.Plays, &c.LastPlayedUTS); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// TopArtistsByYear returns each year's perYear most played artists, oldest
+// year first.
+func (s *Store) TopArtistsByYear(ctx context.Context, f Filter, perYear int) ([]YearArtist, error) {
+	f.User = s.user
+	var yearly string
+	var args []any
+	cond, cargs, rollup, err := s.rollupWhere(ctx, f, TimeRange{}, true)
+	if err != nil {
+		return nil, err
+	}
+	if rollup {
+		yearly, args = `
+  SELECT CAST(strftime('%Y', r.day, 'unixepoch') AS INTEGER) AS year, r.artist_name, SUM(r.plays) AS plays, MAX(r.day) AS last_day
+  FROM daily_artist_plays r
+  WHERE `+cond+`
+  GROUP BY year, r.artist_name`, cargs
+	} else {
+		yearly, args = `
+  SELECT played_year_local AS year, artist_name, COUNT(*) AS plays, MAX(played_date_local) AS last_day
+  FROM scrobbles
+  WHERE played_at_uts >= ?
+  GROUP BY played_year_local, artist_name`, []any{s.minSane}
+	}
+	q := `
+WITH yearly AS (` + yearly + `
+),
+ranked AS (
+  SELECT year, artist_name, plays,
+         ROW_NUMBER() OVER (PARTITION BY year ORDER BY plays DESC, last_day DESC, artist_name ASC) AS rnk
+  FROM yearly
+)
+SELECT year, rnk, artist_name, plays
+FROM ranked
+WHERE rnk <= ?
+ORDER BY year ASC, rnk ASC
+`
+	args = append(args, perYear)
+	if !rollup {
+		q, args = f.Scope(q, args...)
+	}
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []YearArtist{}
+	for rows.Next() {
+		var y YearArtist
+		if err := rows.Scan(&y.Year, &y.Rank, &y.Artist, &y.Plays); err != nil {
+			return nil, err
+		}
+		out = append(out, y)
+	}
+	return out, rows.Err()
+}
+
+// ArtistMonthlyPlays returns the plays of artist (matched by NormalizeArtist,
+// so any spelling) per month, oldest first, and its canonical name. Months
+// without plays are left out; name is "" if the filter keeps none.
+func (s *Store) ArtistMonthlyPlays(ctx context.Context, f Filter, artist string) (name string, months []MonthPlays, err error) {
+	f.User = s.user
+	norm := NormalizeArtist(artist)
+	q, args := f.Scope(`
+SELECT artist_name FROM scrobbles
+WHERE artist_norm = ? AND played_at_uts >= ?
+GROUP BY artist_name
+ORDER BY COUNT(*) DESC, artist_name ASC
+LIMIT 1
+`, norm, s.minSane)
+	if err := s.DB.QueryRowContext(ctx, q, args...).Scan(&name); errors.Is(err, sql.ErrNoRows) {
+		return "", []MonthPlays{}, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+
+	cond, cargs, rollup, err := s.rollupWhere(ctx, f, TimeRange{}, true)
+	if err != nil {
+		return "", nil, err
+	}
+	if rollup {
+		q, args = `
+SELECT strftime('%Y-%m', r.day, 'unixepoch') AS month, SUM(r.plays)
+FROM daily_artist_plays r
+WHERE `+cond+` AND r.artist_norm = ?
+GROUP BY month
+ORDER BY month ASC
+`, append(cargs, norm)
+	} else {
+		q, args = f.Scope(`
+SELECT substr(played_date_local, 1, 7) AS month, COUNT(*)
+FROM scrobbles
+WHERE artist_norm = ? AND played_at_uts >= ?
+GROUP BY month
+ORDER BY month ASC
+`, norm, s.minSane)
+	}
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	months = []MonthPlays{}
+	for rows.Next() {
+		var m MonthPlays
+		if err := rows.Scan(&m.Month, &m.Plays); err != nil {
+			return "", nil, err
+		}
+		months = append(months, m)
+	}
+	return name, months, rows.Err()
+}
+
+// where returns a predicate for r over played_at_uts; "1" if unbounded.
+func (r TimeRange) where() (string, []any) {
+	var conds []string
+	var args []any
+	if r.From != 0 {
+		conds = append(conds, "played_at_uts >= ?")
+		args = append(args, r.From)
+	}
+	if r.To != 0 {
+		conds = append(conds, "played_at_uts < ?")
+		args = append(args, r.To)
+	}
+	if len(conds) == 0 {
+		return "1", nil
+	}
+	return strings.Join(conds, " AND "), args
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// benchRows is about a decade of heavy listening.
+const benchRows = 1_000_000
+
+// benchStore fills a store with n synthetic scrobbles spread over ten
+// years, listened to an album at a time: runs of 12 tracks by one of 3000
+// artists, the popular ones coming round more often.
+func benchStore(b *testing.B, n int) *Store {
+	b.Helper()
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: b.TempDir()})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { s.Close() })
+
+	end := time.Now().Unix()
+	step := int64(10*365*24*3600) / int64(n)
+	// The names are ASCII, so lower() is their key; each has one spelling.
+	if _, err := s.DB.ExecContext(ctx, `
+WITH RECURSIVE seq(i) AS (SELECT 0 UNION ALL SELECT i + 1 FROM seq WHERE i + 1 < ?),
+plays AS (
+  SELECT
+    i,
+    ? - i * ? AS uts,
+    'Artist ' || ((i / 12) * 7919 % (1 + (i / 12) % 3000)) AS artist,
+    'Track ' || (i % 12) AS track,
+    CASE WHEN i % 10 = 0 THEN NULL ELSE 'Album ' || (i / 12 % 3) END AS album
+  FROM seq
+),
+named AS (SELECT i, uts, artist, track, artist || ' - ' || album AS album FROM plays)
+INSERT INTO scrobbles (played_at_uts, artist_name, track_name, album_name, source_hash, played_date_local, played_year_local,
+  artist_norm, track_norm, album_norm, artist_canonical, track_canonical, album_canonical)
+SELECT
+  uts, artist, track, album,
+  'bench-' || i,
+  date(uts, 'unixepoch'),
+  CAST(strftime('%Y', uts, 'unixepoch') AS INTEGER),
+  lower(artist), lower(track), COALESCE(lower(album), ''), artist, track, album
+FROM named
+`, n, end, step); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := s.DB.ExecContext(ctx, `ANALYZE`); err != nil {
+		b.Fatal(err)
+	}
+	return s
+}
+
+// BenchmarkDigestQueries times the reads digest.Build makes. Run with
+// -bench DigestQueries -benchtime 5x; building the store takes a while.
+func BenchmarkDigestQueries(b *testing.B) {
+	s := benchStore(b, benchRows)
+	ctx := context.Background()
+	f := Filter{HideIgnored: true}
+	// Day-aligned windows, as digest uses, read the daily rollups.
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	month := TimeRange{From: today.AddDate(0, 0, -30).Unix()}
+	year := TimeRange{From: today.AddDate(-1, 0, 0).Unix()}
+	halfYearAgo := today.AddDate(0, 0, -180).Unix()
+
+	queries := []struct {
+		name string
+		run  func() error
+	}{
+		{"CountByRange", func() error { _, err := s.CountByRange(ctx, f, TimeRange{From: MinSaneUTS}); return err }},
+		{"SourceCounts", func() error { _, err := s.SourceCounts(ctx, f); return err }},
+		{"RecentScrobbles", func() error { _, err := s.RecentScrobbles(ctx, f, 150); return err }},
+		{"TopArtists30d", func() error { _, err := s.TopArtists(ctx, f, month, 25); return err }},
+		{"TopArtists365d", func() error { _, err := s.TopArtists(ctx, f, year, 25); return err }},
+		{"TopTracks30d", func() error { _, err := s.TopTracks(ctx, f, month, 50); return err }},
+		{"TopAlbums30d", func() error { _, err := s.TopAlbums(ctx, f, month, 40); return err }},
+		{"StaleTracks", func() error { _, err := s.StaleTracks(ctx, f, halfYearAgo, 50); return err }},
+		{"StaleAlbums", func() error { _, err := s.StaleAlbums(ctx, f, halfYearAgo, 40); return err }},
+		{"TopArtistsByYear", func() error { _, err := s.TopArtistsByYear(ctx, f, 20); return err }},
+	}
+	for _, q := range queries {
+		b.Run(q.name, func(b *testing.B) {
+			for b.Loop() {
+				if err := q.run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
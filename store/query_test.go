@@ -0,0 +1,477 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+func TestReadAPI(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	day := func(n int) int64 { return now.AddDate(0, 0, -n).Unix() }
+	plays := []struct {
+		uts                  int64
+		artist, track, album string
+	}{
+		{0, "Unknown", "Placeholder", ""},
+		{day(400), "Low", "Words", "I Could Live in Hope"},
+		{day(400) + 1, "Low", "Words", "I Could Live in Hope"},
+		{day(399), "Low", "Lullaby", "I Could Live in Hope"},
+		{day(10), "Burial", "Archangel", "Untrue"},
+		{day(9), "Burial", "Archangel", "Untrue"},
+		{day(8), "Low", "Sunflower", "Things We Lost in the Fire"},
+		{day(1), "Burial", "Near Dark", "Untrue"},
+	}
+	for _, p := range plays {
+		tr := lastfm.Track{Name: p.track, Artist: lastfm.TextMBID{Text: p.artist}, Album: lastfm.TextMBID{Text: p.album}, Date: &lastfm.Date{UTS: strconv.FormatInt(p.uts, 10)}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := s.CountByRange(ctx, Filter{}, TimeRange{})
+	if err != nil || all.Count != 8 || all.MinUTS != 0 || all.MaxUTS != day(1) {
+		t.Fatalf("all = %+v, %v", all, err)
+	}
+	if n, err := s.SuspectCount(ctx, Filter{}); err != nil || n != 1 {
+		t.Fatalf("suspect = %d, %v", n, err)
+	}
+
+	month := TimeRange{From: day(30)}
+	artists, err := s.TopArtists(ctx, Filter{}, month, 10)
+	if err != nil || len(artists) != 2 || artists[0] != (ArtistCount{"Burial", 3}) || artists[1] != (ArtistCount{"Low", 1}) {
+		t.Fatalf("top artists = %+v, %v", artists, err)
+	}
+	artists, err = s.TopArtists(ctx, Filter{ExcludeArtists: []string{"burial"}}, month, 10)
+	if err != nil || len(artists) != 1 || artists[0].Artist != "Low" {
+		t.Fatalf("filtered top artists = %+v, %v", artists, err)
+	}
+	albums, err := s.TopAlbums(ctx, Filter{}, month, 10)
+	if err != nil || len(albums) != 2 || albums[0].Album != "Untrue" || albums[0].Plays != 3 || albums[0].LastPlayedUTS != day(1) {
+		t.Fatalf("top albums = %+v, %v", albums, err)
+	}
+
+	stale, err := s.StaleTracks(ctx, Filter{}, day(180), 10)
+	if err != nil || len(stale) != 2 || stale[0].Track != "Words" || stale[0].Plays != 2 || stale[1].Track != "Lullaby" {
+		t.Fatalf("stale tracks = %+v, %v", stale, err)
+	}
+
+	recent, err := s.RecentScrobbles(ctx, Filter{}, 2)
+	if err != nil || len(recent) != 2 || recent[0].Track != "Near Dark" || recent[1].Track != "Sunflower" {
+		t.Fatalf("recent = %+v, %v", recent, err)
+	}
+
+	byYear, err := s.TopArtistsByYear(ctx, Filter{}, 1)
+	if err != nil || len(byYear) == 0 || byYear[len(byYear)-1].Rank != 1 {
+		t.Fatalf("by year = %+v, %v", byYear, err)
+	}
+	for _, y := range byYear {
+		if y.Artist == "Unknown" {
+			t.Fatalf("undated scrobble ranked: %+v", byYear)
+		}
+	}
+}
+
+func TestRollupsMatchScrobbles(t *testing.T) {
+	ctx := context.Background()
+	// Days are local, so rollups and scans must agree on where they start.
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir(), Timezone: "America/New_York"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	y, m, d := time.Now().In(s.Location()).Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, s.Location())
+	today := midnight.Unix()
+	artists := []string{"Low", "Burial", "Grouper", "Low"}
+	for i := range 200 {
+		uts := today - int64(i)*7919 // a few plays a day, some on the same day
+		a := artists[i%len(artists)]
+		tr := lastfm.Track{
+			Name:   "Track " + strconv.Itoa(i%7),
+			Artist: lastfm.TextMBID{Text: a},
+			Album:  lastfm.TextMBID{Text: []string{"", a + " LP"}[i%2]},
+			Date:   &lastfm.Date{UTS: strconv.FormatInt(uts, 10)},
+		}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Edits and deletes go through the triggers too.
+	if _, err := s.EditScrobbles(ctx, EditMatch{Artist: "Grouper", Track: "Track 3"}, EditSet{Artist: "Liz Harris"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM scrobbles WHERE track_name = 'Track 5' AND artist_name = 'Low'`); err != nil {
+		t.Fatal(err)
+	}
+	// So do tombstones: set, cleared, and deleted while set.
+	for _, q := range []string{
+		`UPDATE scrobbles SET deleted_at_uts = 1 WHERE track_name = 'Track 1'`,
+		`UPDATE scrobbles SET deleted_at_uts = NULL WHERE track_name = 'Track 1' AND artist_name = 'Low'`,
+		`DELETE FROM scrobbles WHERE track_name = 'Track 1' AND artist_name = 'Burial'`,
+	} {
+		if _, err := s.DB.ExecContext(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.AddIgnore(ctx, "burial", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// A range that cuts through a day forces a scan of scrobbles.
+	scan := func(f Filter) Filter {
+		f.ExcludeRanges = append(f.ExcludeRanges, TimeRange{From: 1, To: 2})
+		return f
+	}
+	week := TimeRange{From: midnight.AddDate(0, 0, -7).Unix()}
+	for _, f := range []Filter{{}, {HideIgnored: true}, {ExcludeArtists: []string{"LOW"}}, {ExcludeRanges: []TimeRange{{From: midnight.AddDate(0, 0, -3).Unix(), To: today}}}} {
+		same := func(name string, roll, scanned any) {
+			t.Helper()
+			if fmt.Sprint(roll) != fmt.Sprint(scanned) {
+				t.Errorf("%s %+v:\nrollup %v\nscan   %v", name, f, roll, scanned)
+			}
+		}
+		a1, err1 := s.TopArtists(ctx, f, week, 10)
+		a2, err2 := s.TopArtists(ctx, scan(f), week, 10)
+		same("TopArtists", a1, a2)
+		t1, err3 := s.TopTracks(ctx, f, week, 10)
+		t2, err4 := s.TopTracks(ctx, scan(f), week, 10)
+		same("TopTracks", t1, t2)
+		al1, err5 := s.TopAlbums(ctx, f, week, 10)
+		al2, err6 := s.TopAlbums(ctx, scan(f), week, 10)
+		same("TopAlbums", al1, al2)
+		y1, err7 := s.TopArtistsByYear(ctx, f, 3)
+		y2, err8 := s.TopArtistsByYear(ctx, scan(f), 3)
+		same("TopArtistsByYear", y1, y2)
+		if err := errors.Join(err1, err2, err3, err4, err5, err6, err7, err8); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.RebuildRollups(ctx); err != nil {
+		t.Fatal(err)
+	}
+	a1, _ := s.TopArtists(ctx, Filter{}, TimeRange{}, 10)
+	a2, _ := s.TopArtists(ctx, scan(Filter{}), TimeRange{}, 10)
+	if fmt.Sprint(a1) != fmt.Sprint(a2) {
+		t.Fatalf("after rebuild:\nrollup %v\nscan   %v", a1, a2)
+	}
+}
+
+func TestAlbumsAcrossArtists(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	plays := []struct {
+		artist, album, mbid string
+	}{
+		{"Aphex Twin", "Warp10+1", ""},
+		{"Boards of Canada", "Warp10+1", ""},
+		{"Autechre", "warp10+1", ""},
+		{"Queen", "Greatest Hits", "queen-gh"},
+		{"Queen", "Greatest Hits", "queen-gh"},
+		{"ABBA", "Greatest Hits", "abba-gh"},
+		{"Low", "Untrue", ""},
+		{"Burial", "Untrue", ""},
+		{"Burial", "Untrue", ""},
+		{"Burial", "Untrue", ""},
+		{"Burial", "Untrue", ""},
+	}
+	for i, p := range plays {
+		tr := lastfm.Track{Name: fmt.Sprint("Track ", i), Artist: lastfm.TextMBID{Text: p.artist}, Album: lastfm.TextMBID{Text: p.album, MBID: p.mbid}, Date: &lastfm.Date{UTS: strconv.FormatInt(now.Add(time.Duration(i-len(plays))*time.Hour).Unix(), 10)}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	albums, err := s.TopAlbumsAcrossArtists(ctx, Filter{}, TimeRange{From: now.AddDate(0, 0, -1).Unix()}, 10)
+	var got []string
+	for _, a := range albums {
+		got = append(got, fmt.Sprintf("%s/%s %d", a.Artist, a.Album, a.Plays))
+	}
+	want := "[Various Artists/Untrue 5 Various Artists/Warp10+1 3 Queen/Greatest Hits 2 ABBA/Greatest Hits 1]"
+	if err != nil || fmt.Sprint(got) != want {
+		t.Fatalf("top albums across artists = %v, %v; want %s", got, err, want)
+	}
+	albums, err = s.TopAlbums(ctx, Filter{}, TimeRange{}, 1)
+	if err != nil || len(albums) != 1 || albums[0].Artist != "Burial" || albums[0].Plays != 4 {
+		t.Fatalf("top albums = %+v, %v", albums, err)
+	}
+	albums, err = s.StaleAlbumsAcrossArtists(ctx, Filter{ExcludeArtists: []string{"Low"}}, now.Unix(), 1)
+	if err != nil || len(albums) != 1 || albums[0] != (AlbumCount{"Burial", "Untrue", 4, albums[0].LastPlayedUTS}) {
+		t.Fatalf("stale albums across artists = %+v, %v", albums, err)
+	}
+}
+
+func TestTopTies(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Every artist and track has two plays; ties go to the later played,
+	// then the name.
+	now := time.Now()
+	day := func(n int) int64 { return now.AddDate(0, 0, -n).Unix() }
+	for _, p := range []struct {
+		uts           int64
+		artist, track string
+	}{
+		{day(5), "Burial", "Archangel"},
+		{day(4), "Burial", "Archangel"},
+		{day(5), "Low", "Words"},
+		{day(2), "Low", "Words"},
+		{day(5), "Grouper", "Heavy Water"},
+		{day(2) + 1, "Grouper", "Heavy Water"},
+		{day(5), "Autechre", "Gantz Graf"},
+		{day(4), "Autechre", "Gantz Graf"},
+	} {
+		tr := lastfm.Track{Name: p.track, Artist: lastfm.TextMBID{Text: p.artist}, Album: lastfm.TextMBID{Text: p.track}, Date: &lastfm.Date{UTS: strconv.FormatInt(p.uts, 10)}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := Filter{ExcludeRanges: []TimeRange{{From: 1, To: 2}}}
+	for _, f := range []Filter{{}, scan} {
+		// The rollups know only the day, so Low and Grouper tie on it.
+		artists, err := s.TopArtists(ctx, f, TimeRange{}, 10)
+		if got := fmt.Sprint(artists); err != nil || got != "[{Grouper 2} {Low 2} {Autechre 2} {Burial 2}]" {
+			t.Errorf("top artists (scan %v) = %s, %v", f.Redacts(), got, err)
+		}
+		tracks, err := s.TopTracks(ctx, f, TimeRange{}, 10)
+		var ts []string
+		for _, c := range tracks {
+			ts = append(ts, c.Artist)
+		}
+		if got := strings.Join(ts, ", "); err != nil || got != "Grouper, Low, Autechre, Burial" {
+			t.Errorf("top tracks (scan %v) = %s, %v", f.Redacts(), got, err)
+		}
+		albums, err := s.TopAlbums(ctx, f, TimeRange{}, 2)
+		if err != nil || len(albums) != 2 || albums[0].Artist != "Grouper" || albums[1].Artist != "Low" {
+			t.Errorf("top albums (scan %v) = %+v, %v", f.Redacts(), albums, err)
+		}
+	}
+}
+
+func TestArtistMonthlyPlays(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir(), Timezone: "Europe/Amsterdam"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, p := range []struct{ at, artist string }{
+		{"2020-01-31T23:30:00Z", "Low"}, // February in Amsterdam
+		{"2020-02-10T12:00:00Z", "low"},
+		{"2020-04-01T12:00:00Z", "Low"},
+		{"2020-04-02T12:00:00Z", "Burial"},
+	} {
+		at, _ := time.Parse(time.RFC3339, p.at)
+		tr := lastfm.Track{Name: "Words", Artist: lastfm.TextMBID{Text: p.artist}, Date: &lastfm.Date{UTS: strconv.FormatInt(at.Unix(), 10)}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Cutting through a day forces a scan.
+	scan := Filter{ExcludeRanges: []TimeRange{{From: 1, To: 2}}}
+	for _, f := range []Filter{{}, scan} {
+		name, months, err := s.ArtistMonthlyPlays(ctx, f, "LOW")
+		if got := fmt.Sprint(name, months); err != nil || got != "Low[{2020-02 2} {2020-04 1}]" {
+			t.Errorf("monthly plays (scan %v) = %s, %v", f.Redacts(), got, err)
+		}
+	}
+	if name, months, err := s.ArtistMonthlyPlays(ctx, Filter{}, "Grouper"); err != nil || name != "" || len(months) != 0 {
+		t.Errorf("unplayed artist = %q %v, %v", name, months, err)
+	}
+}
+
+func TestArtistRetention(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, p := range []struct{ date, artist string }{
+		{"2020-01-05", "Low"},
+		{"2020-01-20", "Burial"},
+		{"2020-04-02", "Low"},    // 3 months on
+		{"2020-07-30", "Low"},    // 6
+		{"2020-07-01", "Burial"}, // 6
+		{"2020-03-01", "Grouper"},
+		{"2020-05-01", "Grouper"}, // 2: not counted
+	} {
+		at, _ := time.Parse("2006-01-02", p.date)
+		tr := lastfm.Track{Name: "Words", Artist: lastfm.TextMBID{Text: p.artist}, Date: &lastfm.Date{UTS: strconv.FormatInt(at.Unix(), 10)}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := Filter{ExcludeRanges: []TimeRange{{From: 1, To: 2}}}
+	for _, f := range []Filter{{}, scan} {
+		got, err := s.ArtistRetention(ctx, f, []int{3, 6, 12})
+		if s := fmt.Sprint(got); err != nil || s != "[{2020-01 2 [1 2 0]} {2020-03 1 [0 0 0]}]" {
+			t.Errorf("retention (scan %v) = %s, %v", f.Redacts(), s, err)
+		}
+	}
+}
+
+func TestBinges(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var n int
+	play := func(date string, count int, artist, album string) {
+		t.Helper()
+		at, _ := time.Parse("2006-01-02", date)
+		for range count {
+			n++
+			at := at.Add(time.Duration(n) * time.Minute)
+			tr := lastfm.Track{Name: fmt.Sprint("Track ", n), Artist: lastfm.TextMBID{Text: artist}, Album: lastfm.TextMBID{Text: album}, Date: &lastfm.Date{UTS: strconv.FormatInt(at.Unix(), 10)}}
+			if _, err := s.InsertScrobble(ctx, tr); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	play("2020-03-14", 8, "Burial", "Untrue") // Saturday
+	play("2020-03-14", 2, "Low", "")
+	play("2020-03-15", 4, "Burial", "Kindred")
+	play("2020-03-16", 6, "Low", "Double Negative")
+	play("2020-03-16", 6, "Grouper", "")
+	play("2020-03-17", 3, "Grouper", "") // too few
+
+	got := func(week, albums bool, minShare float64) string {
+		t.Helper()
+		bs, err := s.Binges(ctx, Filter{}, week, albums, minShare, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, b := range bs {
+			out = append(out, fmt.Sprintf("%s %s/%s %d/%d", b.Start, b.Artist, b.Album, b.Plays, b.Total))
+		}
+		return strings.Join(out, ", ")
+	}
+	if g := got(false, false, 0.5); g != "2020-03-14 Burial/ 8/10" {
+		t.Errorf("daily artist binges = %s", g)
+	}
+	if g := got(false, false, 0.4); g != "2020-03-14 Burial/ 8/10, 2020-03-16 Grouper/ 6/12, 2020-03-16 Low/ 6/12" {
+		t.Errorf("daily artist binges over 40%% = %s", g)
+	}
+	if g := got(true, false, 0.5); g != "2020-03-09 Burial/ 12/14, 2020-03-16 Grouper/ 9/15" {
+		t.Errorf("weekly artist binges = %s", g)
+	}
+	if g := got(true, true, 0.3); g != "2020-03-09 Burial/Untrue 8/14, 2020-03-16 Low/Double Negative 6/15" {
+		t.Errorf("weekly album binges = %s", g)
+	}
+}
+
+func TestCompletionRates(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Words lasts 4 minutes; Sunflower's length is unknown.
+	if _, err := s.DB.ExecContext(ctx, `INSERT INTO lastfm_cache (method, key, body, fetched_at_uts) VALUES
+  ('track.getInfo', 'low|words', '{"name":"Words","duration":"240000"}', 1),
+  ('track.getInfo', 'low|sunflower', '{"name":"Sunflower","duration":0}', 1)`); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, p := range []struct {
+		track string
+		gap   time.Duration // to the next play
+	}{
+		{"Words", 4 * time.Minute},      // full
+		{"Words", time.Minute},          // partial
+		{"Sunflower", 10 * time.Second}, // partial, by the short gap
+		{"Sunflower", 5 * time.Minute},  // unknown
+		{"Words", time.Hour},            // full, then a break
+		{"Words", 0},                    // last: unknown
+	} {
+		tr := lastfm.Track{Name: p.track, Artist: lastfm.TextMBID{Text: "Low"}, Album: lastfm.TextMBID{Text: "Things We Lost in the Fire"}, Date: &lastfm.Date{UTS: strconv.FormatInt(at.Unix(), 10)}}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+		at = at.Add(p.gap)
+	}
+
+	tracks, err := s.CompletionRates(ctx, Filter{}, TimeRange{}, false, -1)
+	if got := fmt.Sprintf("%+v", tracks); err != nil || got != "[{Artist:Low Album: Track:Words Duration:4m0s Plays:4 Full:2 Partial:1 Rate:0.667} {Artist:Low Album: Track:Sunflower Duration:0s Plays:2 Full:0 Partial:1 Rate:0}]" {
+		t.Errorf("track completion = %s, %v", got, err)
+	}
+	albums, err := s.CompletionRates(ctx, Filter{}, TimeRange{}, true, 1)
+	if got := fmt.Sprintf("%+v", albums); err != nil || got != "[{Artist:Low Album:Things We Lost in the Fire Track: Duration:0s Plays:6 Full:2 Partial:2 Rate:0.5}]" {
+		t.Errorf("album completion = %s, %v", got, err)
+	}
+}
+
+func TestArtistDistribution(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Plays per artist 4, 2, 1, 1; the placeholder-dated play doesn't count.
+	now := time.Now().Unix()
+	plays := map[string]int{"Burial": 4, "Low": 2, "Grouper": 1, "Autechre": 1}
+	for artist, n := range plays {
+		for i := range n {
+			tr := lastfm.Track{Name: "x", Artist: lastfm.TextMBID{Text: artist}, Date: &lastfm.Date{UTS: strconv.FormatInt(now-int64(i)*3600, 10)}}
+			if _, err := s.InsertScrobble(ctx, tr); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tr := lastfm.Track{Name: "x", Artist: lastfm.TextMBID{Text: "Eno"}, Date: &lastfm.Date{UTS: "0"}}
+	if _, err := s.InsertScrobble(ctx, tr); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Distribution{Artists: 4, MedianPlays: 1.5, Gini: 0.3125, Top10Share: 1, OnePlay: 2}
+	scan := Filter{ExcludeRanges: []TimeRange{{From: 1, To: 2}}}
+	for _, f := range []Filter{{}, scan} {
+		d, err := s.ArtistDistribution(ctx, f)
+		if err != nil || d != want {
+			t.Errorf("distribution (scan %v) = %+v, %v, want %+v", len(f.ExcludeRanges) > 0, d, err, want)
+		}
+	}
+	if d, err := s.ArtistDistribution(ctx, Filter{ExcludeArtists: []string{"Burial", "Low", "Grouper", "Autechre"}}); err != nil || d != (Distribution{}) {
+		t.Errorf("distribution of nothing = %+v, %v", d, err)
+	}
+}
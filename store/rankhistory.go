@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+const (
+	// ArtistChartDepth is how many artists each daily chart snapshot keeps.
+	ArtistChartDepth = 50
+	// ArtistChartDays is the rolling window each snapshot covers.
+	ArtistChartDays = 30
+
+	rankHistoryCursorKey = "artist_rank_history.charted_through"
+	chartDateLayout      = "2006-01-02"
+)
+
+// UpdateArtistRankHistory charts every complete UTC day since the last run
+// (or since the first dated scrobble) and returns how many days it charted.
+// It charts the last ArtistChartDays again too: Last.fm takes scrobbles up
+// to two weeks late, and they count toward the days already charted.
+func (s *Store) UpdateArtistRankHistory(ctx context.Context, now time.Time) (int, error) {
+	var start time.Time
+	cursor, err := s.GetState(ctx, rankHistoryCursorKey)
+	if err != nil {
+		return 0, err
+	}
+	if cursor != "" {
+		last, err := time.Parse(chartDateLayout, cursor)
+		if err != nil {
+			return 0, err
+		}
+		start = last.AddDate(0, 0, 1)
+		if recent := utcDay(now).AddDate(0, 0, -ArtistChartDays); recent.Before(start) {
+			start = recent
+		}
+	} else {
+		var first sql.NullInt64
+		if err := s.DB.QueryRowContext(ctx, `SELECT MIN(played_at_uts) FROM scrobbles WHERE user_name = ? AND deleted_at_uts IS NULL AND played_at_uts >= ?`, s.user, s.minSane).Scan(&first); err != nil {
+			return 0, err
+		}
+		if !first.Valid {
+			return 0, nil
+		}
+		start = utcDay(time.Unix(first.Int64, 0))
+	}
+	end := utcDay(now).AddDate(0, 0, -1)
+	if start.After(end) {
+		return 0, nil
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// A day charted again may have lost artists from its top.
+	if _, err := tx.ExecContext(ctx, `DELETE FROM artist_rank_history WHERE user_name = ? AND chart_date >= ?`, s.user, start.Format(chartDateLayout)); err != nil {
+		return 0, err
+	}
+
+	// Charts leave out the ignore list, like the digest's top lists.
+	q, uargs := Filter{User: s.user, HideIgnored: true}.Scope(`
+INSERT OR REPLACE INTO artist_rank_history(user_name, chart_date, rank, artist_name, plays)
+SELECT ?, ?, ROW_NUMBER() OVER (ORDER BY COUNT(*) DESC, artist_name ASC), artist_name, COUNT(*)
+FROM scrobbles
+WHERE played_at_uts >= ?
+  AND played_at_uts < ?
+GROUP BY artist_name
+ORDER BY COUNT(*) DESC, artist_name ASC
+LIMIT ?
+`)
+	stmt, err := tx.PrepareContext(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	days := 0
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		from := d.AddDate(0, 0, -(ArtistChartDays - 1)).Unix()
+		to := d.AddDate(0, 0, 1).Unix()
+		if _, err := stmt.ExecContext(ctx, append(uargs, s.user, d.Format(chartDateLayout), max(from, s.minSane), to, ArtistChartDepth)...); err != nil {
+			return 0, err
+		}
+		days++
+	}
+	if _, err := tx.ExecContext(ctx, setStateSQL, s.user, rankHistoryCursorKey, end.Format(chartDateLayout)); err != nil {
+		return 0, err
+	}
+	if err := s.commit(tx); err != nil {
+		return 0, err
+	}
+	return days, nil
+}
+
+// RebuildArtistRankHistory discards all snapshots and charts from scratch;
+// needed after history older than the cursor was inserted (e.g. backfill).
+func (s *Store) RebuildArtistRankHistory(ctx context.Context, now time.Time) (int, error) {
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM artist_rank_history WHERE user_name = ?`, s.user); err != nil {
+		return 0, err
+	}
+	if _, err := s.DB.ExecContext(ctx, `DELETE FROM state WHERE user_name = ? AND key = ?`, s.user, rankHistoryCursorKey); err != nil {
+		return 0, err
+	}
+	return s.UpdateArtistRankHistory(ctx, now)
+}
+
+func utcDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// RewindArtistRankHistory drops snapshots from the day of fromUTS on, so the
+// next UpdateArtistRankHistory recharts them. Call it after inserting or
+// editing scrobbles in the past.
+func (s *Store) RewindArtistRankHistory(ctx context.Context, fromUTS int64) error {
+	day := utcDay(time.Unix(max(fromUTS, s.minSane), 0))
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM artist_rank_history WHERE user_name = ? AND chart_date >= ?`, s.user, day.Format(chartDateLayout)); err != nil {
+		return err
+	}
+	// Only move the cursor back; with no cursor the next update starts from
+	// the first scrobble anyway.
+	if _, err := tx.ExecContext(ctx, `UPDATE state SET value = ? WHERE user_name = ? AND key = ? AND value >= ?`,
+		day.AddDate(0, 0, -1).Format(chartDateLayout), s.user, rankHistoryCursorKey, day.Format(chartDateLayout)); err != nil {
+		return err
+	}
+	return s.commit(tx)
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+func TestUpdateArtistRankHistoryChartsLateScrobbles(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	scrobble := func(artist string, daysAgo, plays int) {
+		t.Helper()
+		for i := range plays {
+			at := now.AddDate(0, 0, -daysAgo).Add(-time.Duration(i) * time.Minute)
+			tr := lastfm.Track{Name: "Track", Artist: lastfm.TextMBID{Text: artist}, Date: &lastfm.Date{UTS: strconv.FormatInt(at.Unix(), 10)}}
+			if _, err := s.InsertScrobble(ctx, tr); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	top := func() string {
+		t.Helper()
+		var artist string
+		yesterday := utcDay(now).AddDate(0, 0, -1).Format(chartDateLayout)
+		if err := s.DB.QueryRowContext(ctx, `SELECT artist_name FROM artist_rank_history WHERE chart_date = ? AND rank = 1`, yesterday).Scan(&artist); err != nil {
+			t.Fatal(err)
+		}
+		return artist
+	}
+
+	scrobble("Burial", 20, 3)
+	if _, err := s.UpdateArtistRankHistory(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if got := top(); got != "Burial" {
+		t.Fatalf("top artist = %q, want Burial", got)
+	}
+
+	// Synced after the days they count toward were charted.
+	scrobble("Four Tet", 10, 5)
+	if _, err := s.UpdateArtistRankHistory(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if got := top(); got != "Four Tet" {
+		t.Errorf("top artist after late scrobbles = %q, want Four Tet", got)
+	}
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// TornSuffix names where a torn final raw JSONL line is moved, kept for
+// inspection rather than deleted.
+const TornSuffix = ".torn"
+
+// repairTornTail truncates path after its last newline, so a line cut short
+// by a crash mid-write doesn't corrupt the line appended after it. The cut
+// bytes are appended to path+TornSuffix; it returns how many there were.
+func repairTornTail(path string) (int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := st.Size()
+
+	// Scan back from the end for the last newline.
+	keep := int64(0)
+	buf := make([]byte, 64*1024)
+	for end := size; end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		if end == size && chunk[len(chunk)-1] == '\n' {
+			return 0, nil
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			keep = start + int64(i) + 1
+			break
+		}
+		end = start
+	}
+	if keep == size {
+		return 0, nil
+	}
+
+	tail := make([]byte, size-keep)
+	if _, err := f.ReadAt(tail, keep); err != nil && err != io.EOF {
+		return 0, err
+	}
+	torn, err := os.OpenFile(path+TornSuffix, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := torn.Write(append(tail, '\n')); err != nil {
+		torn.Close()
+		return 0, err
+	}
+	if err := torn.Sync(); err != nil {
+		torn.Close()
+		return 0, err
+	}
+	if err := torn.Close(); err != nil {
+		return 0, err
+	}
+	if err := f.Truncate(keep); err != nil {
+		return 0, err
+	}
+	return size - keep, f.Sync()
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+// RawPagesFile archives whole recent-tracks responses, for re-parsing
+// history if a decoding bug ever drops or mangles fields. Each page is its
+// own gzip member holding one JSON line, so appending never rewrites the
+// file and a torn last write only loses that page.
+const RawPagesFile = "recenttracks.pages.jsonl.gz"
+
+// RawPage is one archived response.
+type RawPage struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	// Params are the request parameters, without credentials.
+	Params map[string]string `json:"params"`
+	Body   json.RawMessage   `json:"body"`
+}
+
+// AppendRawPage archives p's body as Last.fm sent it, with its request
+// parameters (see lastfm.RecentTracksOptions.KeepRaw). A dry run archives
+// nothing.
+func (s *Store) AppendRawPage(p lastfm.Page) error {
+	if s.dryRun {
+		return nil
+	}
+	var body bytes.Buffer
+	if err := json.Compact(&body, p.Raw); err != nil {
+		return fmt.Errorf("raw page %d: %w", p.Page, err)
+	}
+	params := map[string]string{}
+	for k := range p.Params {
+		params[k] = p.Params.Get(k)
+	}
+	b, err := json.Marshal(RawPage{FetchedAt: time.Now().UTC(), Params: params, Body: body.Bytes()})
+	if err != nil {
+		return err
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(s.DataDir, RawPagesFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(gz.Bytes()); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if s.fsync {
+		if err := f.Sync(); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// RawPages reads the pages archived in dataDir, oldest first. A missing
+// archive yields nothing.
+func RawPages(dataDir string) iter.Seq2[RawPage, error] {
+	return func(yield func(RawPage, error) bool) {
+		f, err := os.Open(filepath.Join(dataDir, RawPagesFile))
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		if err != nil {
+			yield(RawPage{}, err)
+			return
+		}
+		defer f.Close()
+		zr, err := gzip.NewReader(f)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			yield(RawPage{}, err)
+			return
+		}
+		sc := bufio.NewScanner(zr)
+		sc.Buffer(make([]byte, 0, 1<<20), 64<<20)
+		for sc.Scan() {
+			var p RawPage
+			if err := json.Unmarshal(sc.Bytes(), &p); err != nil {
+				yield(RawPage{}, err)
+				return
+			}
+			if !yield(p, nil) {
+				return
+			}
+		}
+		if err := sc.Err(); err != nil {
+			yield(RawPage{}, err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Recommendation is one suggested track, or album (Track empty), in a
+// recommend run.
+type Recommendation struct {
+	Rank   int
+	Artist string
+	Track  string
+	Album  string
+	Score  float64
+}
+
+// SaveRecommendations records a recommend run and returns its run id.
+// An empty run isn't recorded and gets id 0.
+func (s *Store) SaveRecommendations(ctx context.Context, algo string, recs []Recommendation) (int64, error) {
+	if len(recs) == 0 {
+		return 0, nil
+	}
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var runID int64
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(run_id), 0) + 1 FROM recommendations`).Scan(&runID); err != nil {
+		return 0, err
+	}
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO recommendations (user_name, run_id, recommended_at_uts, algo, rank, artist_name, track_name, album_name, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	now := time.Now().Unix()
+	for _, r := range recs {
+		if _, err := stmt.ExecContext(ctx, s.user, runID, now, algo, r.Rank, r.Artist, r.Track, r.Album, r.Score); err != nil {
+			return 0, err
+		}
+	}
+	return runID, s.commit(tx)
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"strings"
+)
+
+// Cohort is the artists first played in one calendar month (YYYY-MM, in
+// the home time zone) and how many of them were played again some months
+// on.
+type Cohort struct {
+	Month   string
+	Artists int64
+	// Retained counts, for each of ArtistRetention's offsets, the cohort's
+	// artists played in the month that many months after Month.
+	Retained []int64
+}
+
+// ArtistRetention buckets the artists the filter keeps by the month of
+// their first play and counts, per offset in months, those played again in
+// the month that far on; oldest cohort first. Offsets reaching past the
+// current month count nothing yet.
+func (s *Store) ArtistRetention(ctx context.Context, f Filter, offsets []int) ([]Cohort, error) {
+	f.User = s.user
+	var months string
+	var args []any
+	cond, cargs, rollup, err := s.rollupWhere(ctx, f, TimeRange{}, true)
+	if err != nil {
+		return nil, err
+	}
+	if rollup {
+		months, args = `
+  SELECT DISTINCT r.artist_norm, strftime('%Y-%m', r.day, 'unixepoch') AS month
+  FROM daily_artist_plays r
+  WHERE `+cond, cargs
+	} else {
+		months, args = `
+  SELECT DISTINCT artist_norm, substr(played_date_local, 1, 7) AS month
+  FROM scrobbles
+  WHERE played_at_uts >= ?`, []any{s.minSane}
+	}
+	var cols strings.Builder
+	for _, n := range offsets {
+		cols.WriteString(",\n  COUNT(CASE WHEN m.month = strftime('%Y-%m', c.month || '-01', '+' || ? || ' months') THEN 1 END)")
+		args = append(args, n)
+	}
+	q := `
+WITH months AS (` + months + `
+),
+cohorts AS (
+  SELECT artist_norm, MIN(month) AS month FROM months GROUP BY artist_norm
+)
+SELECT c.month, COUNT(DISTINCT c.artist_norm)` + cols.String() + `
+FROM cohorts c
+JOIN months m ON m.artist_norm = c.artist_norm
+GROUP BY c.month
+ORDER BY c.month ASC
+`
+	if !rollup {
+		q, args = f.Scope(q, args...)
+	}
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Cohort{}
+	for rows.Next() {
+		c := Cohort{Retained: make([]int64, len(offsets))}
+		dest := []any{&c.Month, &c.Artists}
+		for i := range c.Retained {
+			dest = append(dest, &c.Retained[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,288 @@
+package store
+
+import (
+	"context"
+	"strings"
+)
+
+// The daily rollups count plays per day (day is that date's midnight in
+// UTC, as unix time): daily_artist_plays per artist, daily_track_plays per
+// track and album. Triggers keep them in step with every insert, edit and
+// delete on scrobbles, so they never need a separate pass; RebuildRollups
+// recounts them from scratch should they drift.
+//
+// Schema version 5 counted UTC days (utcDaySQL); since version 6 a day is
+// the scrobble's played_date_local (localDaySQL), the listener's day. Since
+// version 7 every rollup row belongs to a user, like the scrobbles it
+// counts (see profileTables). Since version 9 they leave out tombstoned
+// scrobbles (see tombstone.go). Since version 11 they count by canonical
+// name, so spellings of one name share a row, and carry the names' keys
+// for the ignore list to match (see names.go).
+const rollupTables = `
+CREATE TABLE IF NOT EXISTS daily_artist_plays (
+  day INTEGER NOT NULL,
+  artist_name TEXT NOT NULL,
+  plays INTEGER NOT NULL,
+
+  PRIMARY KEY (day, artist_name)
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS daily_track_plays (
+  day INTEGER NOT NULL,
+  artist_name TEXT NOT NULL,
+  track_name TEXT NOT NULL,
+  album_name TEXT NOT NULL,
+  plays INTEGER NOT NULL,
+  last_played_uts INTEGER NOT NULL,
+
+  PRIMARY KEY (day, artist_name, track_name, album_name)
+) WITHOUT ROWID;
+`
+
+// utcDaySQL and localDaySQL are a scrobbles row's rollup day; row is "NEW.",
+// "OLD." or "" for the row in scope.
+func utcDaySQL(row string) string {
+	return row + "played_at_uts - " + row + "played_at_uts % 86400"
+}
+
+func localDaySQL(row string) string {
+	return "CAST(strftime('%s', " + row + "played_date_local) AS INTEGER)"
+}
+
+// rollupSchema is how a schema version's rollups are kept: the day of a
+// row, whether they are per user (version 7 on), whether tombstones count
+// (not from version 9) and whether they are keyed by canonical names and
+// carry their keys (version 11 on, see names.go).
+type rollupSchema struct {
+	day     func(row string) string
+	perUser bool
+	live    bool
+	names   bool
+}
+
+// rollupCurrent is the rollups at SchemaVersion.
+var rollupCurrent = rollupSchema{day: localDaySQL, perUser: true, live: true, names: true}
+
+// user is the leading user column for perUser rollups, as row's value or,
+// with row "", the column name.
+func (v rollupSchema) user(row string) string {
+	if !v.perUser {
+		return ""
+	}
+	return row + "user_name, "
+}
+
+// sameUser restricts a statement to row's user for perUser rollups.
+func (v rollupSchema) sameUser(row string) string {
+	if !v.perUser {
+		return ""
+	}
+	return "user_name = " + row + "user_name AND "
+}
+
+// cols are the scrobbles columns the rollups count by, as row's values.
+func (v rollupSchema) cols(row string) (artist, track, album string) {
+	if v.names {
+		return row + "artist_canonical", row + "track_canonical", row + "album_canonical"
+	}
+	return row + "artist_name", row + "track_name", row + "album_name"
+}
+
+// carried are the key columns the rollups carry along with names, and
+// row's values of them.
+func (v rollupSchema) carried(row string, track bool) (cols, vals string) {
+	if !v.names {
+		return "", ""
+	}
+	if track {
+		return ", artist_norm, track_norm", ", " + row + "artist_norm, " + row + "track_norm"
+	}
+	return ", artist_norm", ", " + row + "artist_norm"
+}
+
+// rollupTriggers keeps the rollups counting by day. The update trigger
+// doesn't watch played_date_local: only relocalize sets it alone, and it
+// rebuilds the rollups after. Nor user_name: only claimUnowned sets it, and
+// it moves the rollups along. With live, a tombstoned row doesn't count,
+// and tombstoning or restoring one takes it out or puts it back. With
+// names, it watches the canonical names rather than the stored ones.
+func rollupTriggers(v rollupSchema) string {
+	// VALUES becomes a SELECT to add the condition; its WHERE also keeps
+	// ON CONFLICT from parsing as a join constraint.
+	values, newLive := "VALUES (", ")"
+	watch := ""
+	if v.live {
+		values, newLive = "SELECT ", " WHERE NEW.deleted_at_uts IS NULL"
+		watch = ", deleted_at_uts"
+	}
+	artist, track, album := v.cols("NEW.")
+	artistCols, artistVals := v.carried("NEW.", false)
+	trackCols, trackVals := v.carried("NEW.", true)
+	addNew := `
+  INSERT INTO daily_artist_plays(` + v.user("") + `day, artist_name, plays` + artistCols + `)
+  ` + values + v.user("NEW.") + v.day("NEW.") + `, ` + artist + `, 1` + artistVals + newLive + `
+  ON CONFLICT DO UPDATE SET plays = plays + 1;
+  INSERT INTO daily_track_plays(` + v.user("") + `day, artist_name, track_name, album_name, plays, last_played_uts` + trackCols + `)
+  ` + values + v.user("NEW.") + v.day("NEW.") + `, ` + artist + `, ` + track + `, COALESCE(` + album + `, ''), 1, NEW.played_at_uts` + trackVals + newLive + `
+  ON CONFLICT DO UPDATE SET plays = plays + 1, last_played_uts = MAX(last_played_uts, excluded.last_played_uts);`
+	artistCol, trackCol, albumCol := v.cols("")
+	return `
+CREATE TRIGGER IF NOT EXISTS scrobbles_rollup_insert AFTER INSERT ON scrobbles BEGIN` + addNew + `
+END;
+
+CREATE TRIGGER IF NOT EXISTS scrobbles_rollup_delete AFTER DELETE ON scrobbles BEGIN` + rollupRemoveOld(v) + `
+END;
+
+CREATE TRIGGER IF NOT EXISTS scrobbles_rollup_update
+AFTER UPDATE OF played_at_uts, ` + artistCol + `, ` + trackCol + `, ` + albumCol + watch + ` ON scrobbles BEGIN` + rollupRemoveOld(v) + addNew + `
+END;
+`
+}
+
+// rollupRemoveOld takes OLD's play back out of the rollups. A track row's
+// last play is looked up again, since OLD may have been it.
+func rollupRemoveOld(v rollupSchema) string {
+	old := v.day("OLD.")
+	same := v.sameUser("OLD.")
+	alive := ""
+	if v.live {
+		same = "OLD.deleted_at_uts IS NULL AND " + same
+		alive = " AND deleted_at_uts IS NULL"
+	}
+	artist, track, album := v.cols("OLD.")
+	artistCol, trackCol, albumCol := v.cols("")
+	return `
+  UPDATE daily_artist_plays SET plays = plays - 1
+  WHERE ` + same + `day = ` + old + ` AND artist_name = ` + artist + `;
+  DELETE FROM daily_artist_plays
+  WHERE ` + same + `day = ` + old + ` AND artist_name = ` + artist + ` AND plays <= 0;
+  UPDATE daily_track_plays SET
+    plays = plays - 1,
+    last_played_uts = COALESCE((
+      SELECT MAX(played_at_uts) FROM scrobbles
+      WHERE ` + v.sameUser("OLD.") + artistCol + ` = ` + artist + ` AND ` + trackCol + ` = ` + track + ` AND COALESCE(` + albumCol + `, '') = COALESCE(` + album + `, '')
+        AND ` + v.day("") + ` = daily_track_plays.day` + alive + `
+    ), 0)
+  WHERE ` + same + `day = ` + old + ` AND artist_name = ` + artist + `
+    AND track_name = ` + track + ` AND album_name = COALESCE(` + album + `, '');
+  DELETE FROM daily_track_plays
+  WHERE ` + same + `day = ` + old + ` AND artist_name = ` + artist + `
+    AND track_name = ` + track + ` AND album_name = COALESCE(` + album + `, '') AND plays <= 0;`
+}
+
+// rollupRebuild recounts both rollups from scrobbles.
+func rollupRebuild(v rollupSchema) string {
+	u := v.user("")
+	where := ""
+	if v.live {
+		where = "\nWHERE deleted_at_uts IS NULL"
+	}
+	artist, track, album := v.cols("")
+	artistCols, _ := v.carried("", false)
+	trackCols, _ := v.carried("", true)
+	artistVals, trackVals := "", ""
+	if v.names {
+		artistVals, trackVals = ", MAX(artist_norm)", ", MAX(artist_norm), MAX(track_norm)"
+	}
+	return `
+DELETE FROM daily_artist_plays;
+DELETE FROM daily_track_plays;
+INSERT INTO daily_artist_plays(` + u + `day, artist_name, plays` + artistCols + `)
+SELECT ` + u + v.day("") + ` AS day, ` + artist + `, COUNT(*)` + artistVals + `
+FROM scrobbles` + where + `
+GROUP BY ` + u + `day, ` + artist + `;
+INSERT INTO daily_track_plays(` + u + `day, artist_name, track_name, album_name, plays, last_played_uts` + trackCols + `)
+SELECT ` + u + v.day("") + ` AS day, ` + artist + `, ` + track + `, COALESCE(` + album + `, ''), COUNT(*), MAX(played_at_uts)` + trackVals + `
+FROM scrobbles` + where + `
+GROUP BY ` + u + `day, ` + artist + `, ` + track + `, COALESCE(` + album + `, '');
+`
+}
+
+// RebuildRollups recounts the daily rollups and the first plays (see
+// firstplayed.go) from the scrobbles table.
+func (s *Store) RebuildRollups(ctx context.Context) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, rollupRebuild(rollupCurrent)+firstPlayedRebuild(userMinSane)); err != nil {
+		return err
+	}
+	return s.commit(tx)
+}
+
+// rollupWhere returns a predicate for the filter and r over a rollup table
+// (alias r), or ok false if they cut through a local day, which only a
+// scan of scrobbles can answer. byArtist is for daily_artist_plays, which can't
+// leave out single ignored tracks; it is also false if any exist. The
+// rollups don't tell versions apart, so it is false if the filter excludes
+// them, or for tracks folds them.
+func (s *Store) rollupWhere(ctx context.Context, f Filter, r TimeRange, byArtist bool) (cond string, args []any, ok bool, err error) {
+	if len(f.ExcludeVersions) > 0 || (len(f.FoldVersions) > 0 && !byArtist) {
+		return "", nil, false, nil
+	}
+	// Bounds become day labels; 0 (unbounded) stays 0.
+	label := func(uts int64) (int64, bool) {
+		if uts == 0 {
+			return 0, true
+		}
+		return localDayLabel(uts, s.loc)
+	}
+	from, okFrom := label(r.From)
+	to, okTo := label(r.To)
+	if !okFrom || !okTo {
+		return "", nil, false, nil
+	}
+	user, args := f.userIn("r.user_name")
+	conds := []string{user, "r.day >= ?"}
+	args = append(args, s.minSane)
+	if from != 0 {
+		conds = append(conds, "r.day >= ?")
+		args = append(args, from)
+	}
+	if to != 0 {
+		conds = append(conds, "r.day < ?")
+		args = append(args, to)
+	}
+	for _, x := range f.ExcludeRanges {
+		xFrom, okFrom := label(x.From)
+		xTo, okTo := label(x.To)
+		if !okFrom || !okTo {
+			return "", nil, false, nil
+		}
+		switch {
+		case xFrom != 0 && xTo != 0:
+			conds = append(conds, "NOT (r.day >= ? AND r.day < ?)")
+			args = append(args, xFrom, xTo)
+		case xFrom != 0:
+			conds = append(conds, "r.day < ?")
+			args = append(args, xFrom)
+		case xTo != 0:
+			conds = append(conds, "r.day >= ?")
+			args = append(args, xTo)
+		}
+	}
+	if len(f.ExcludeArtists) > 0 {
+		conds = append(conds, "r.artist_norm NOT IN ("+placeholders(len(f.ExcludeArtists))+")")
+		for _, a := range f.ExcludeArtists {
+			args = append(args, NormalizeArtist(a))
+		}
+	}
+	if f.HideIgnored {
+		if byArtist {
+			var tracks bool
+			ucond, uargs := f.userIn("user_name")
+			if err := s.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM ignores WHERE `+ucond+` AND track_name != '')`, uargs...).Scan(&tracks); err != nil {
+				return "", nil, false, err
+			}
+			if tracks {
+				return "", nil, false, nil
+			}
+			conds = append(conds, `(NOT EXISTS (SELECT 1 FROM main.ignores) OR NOT EXISTS (SELECT 1 FROM main.ignores i WHERE i.user_name = r.user_name AND i.artist_norm = r.artist_norm AND i.track_norm = ''))`)
+		} else {
+			conds = append(conds, `(NOT EXISTS (SELECT 1 FROM main.ignores) OR NOT EXISTS (SELECT 1 FROM main.ignores i WHERE i.user_name = r.user_name AND i.artist_norm = r.artist_norm AND i.track_norm IN ('', r.track_norm)))`)
+		}
+	}
+	return strings.Join(conds, " AND "), args, true, nil
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// runsTable journals command runs, one row each, so "when did sync last
+// work?" has an answer without keeping log files. A run that never
+// finished (killed, crashed) keeps a NULL ended_at_uts and exit_code.
+const runsTable = `
+CREATE TABLE runs (
+  id INTEGER PRIMARY KEY,
+  user_name TEXT NOT NULL DEFAULT '',
+  command TEXT NOT NULL,
+  args TEXT NOT NULL,
+  started_at_uts INTEGER NOT NULL,
+  ended_at_uts INTEGER,
+  exit_code INTEGER,
+  inserted INTEGER NOT NULL DEFAULT 0,
+  ignored INTEGER NOT NULL DEFAULT 0,
+  error TEXT
+);
+
+CREATE INDEX idx_runs_user_command ON runs(user_name, command, id);
+`
+
+// Run is one journaled command run.
+type Run struct {
+	ID           int64  `json:"id"`
+	Command      string `json:"command"`
+	Args         string `json:"args,omitempty"`
+	StartedAtUTS int64  `json:"started_at_uts"`
+	// EndedAtUTS is 0 for a run still going or one that never finished.
+	EndedAtUTS int64  `json:"ended_at_uts,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	Inserted   int    `json:"inserted"`
+	Ignored    int    `json:"ignored"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Finished reports whether the run recorded its end.
+func (r Run) Finished() bool {
+	return r.EndedAtUTS != 0
+}
+
+// StartRun journals the start of command, returning the run's id for
+// FinishRun. args should leave out anything secret.
+func (s *Store) StartRun(ctx context.Context, command, args string) (int64, error) {
+	res, err := s.DB.ExecContext(ctx, `
+INSERT INTO runs (user_name, command, args, started_at_uts) VALUES (?, ?, ?, ?)
+`, s.user, command, args, time.Now().Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// FinishRun records how run id ended, with the scrobbles this Store
+// inserted and ignored since it was opened.
+func (s *Store) FinishRun(ctx context.Context, id int64, exitCode int, errText string) error {
+	_, err := s.DB.ExecContext(ctx, `
+UPDATE runs SET ended_at_uts = ?, exit_code = ?, inserted = ?, ignored = ?, error = ?
+WHERE id = ?
+`, time.Now().Unix(), exitCode, s.inserted, s.ignored, nullIfEmpty(errText), id)
+	return err
+}
+
+// Runs returns the user's journaled runs of command ("" for any), newest
+// first.
+func (s *Store) Runs(ctx context.Context, command string, limit int) ([]Run, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+SELECT id, command, args, started_at_uts, ended_at_uts, exit_code, inserted, ignored, error
+FROM runs
+WHERE user_name = ? AND (? = '' OR command = ?)
+ORDER BY id DESC
+LIMIT ?
+`, s.user, command, command, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Run
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// LastRun returns the latest finished run of command that exited with one
+// of codes (any code if none are given); a zero Run if there is none.
+func (s *Store) LastRun(ctx context.Context, command string, codes ...int) (Run, error) {
+	q := `
+SELECT id, command, args, started_at_uts, ended_at_uts, exit_code, inserted, ignored, error
+FROM runs
+WHERE user_name = ? AND command = ? AND ended_at_uts IS NOT NULL`
+	args := []any{s.user, command}
+	if len(codes) > 0 {
+		q += ` AND exit_code IN (` + placeholders(len(codes)) + `)`
+		for _, c := range codes {
+			args = append(args, c)
+		}
+	}
+	r, err := scanRun(s.DB.QueryRowContext(ctx, q+`
+ORDER BY id DESC
+LIMIT 1`, args...))
+	if err == sql.ErrNoRows {
+		return Run{}, nil
+	}
+	return r, err
+}
+
+func scanRun(row interface{ Scan(...any) error }) (Run, error) {
+	var r Run
+	var ended, code sql.NullInt64
+	var errText sql.NullString
+	if err := row.Scan(&r.ID, &r.Command, &r.Args, &r.StartedAtUTS, &ended, &code, &r.Inserted, &r.Ignored, &errText); err != nil {
+		return Run{}, err
+	}
+	r.EndedAtUTS, r.ExitCode, r.Error = ended.Int64, int(code.Int64), errText.String
+	return r, nil
+}
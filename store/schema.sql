@@ -0,0 +1,116 @@
+-- scrobbles schema v1 baseline; later column changes live in migrate.go
+
+PRAGMA journal_mode=WAL;
+
+CREATE TABLE IF NOT EXISTS scrobbles (
+  played_at_uts INTEGER NOT NULL,
+  track_name TEXT NOT NULL,
+  artist_name TEXT NOT NULL,
+  album_name TEXT,
+
+  track_mbid TEXT,
+  artist_mbid TEXT,
+  album_mbid TEXT,
+
+  lastfm_url TEXT,
+
+  source_hash TEXT NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS idx_scrobbles_played_at_uts ON scrobbles(played_at_uts);
+
+-- Small key/value table for cursors and bookkeeping between runs.
+CREATE TABLE IF NOT EXISTS state (
+  key TEXT PRIMARY KEY,
+  value TEXT NOT NULL
+);
+
+-- Rolling 30-day artist chart, one snapshot per UTC day (chart_date is the
+-- last day of the window). Maintained incrementally on sync.
+CREATE TABLE IF NOT EXISTS artist_rank_history (
+  chart_date TEXT NOT NULL,
+  rank INTEGER NOT NULL,
+  artist_name TEXT NOT NULL,
+  plays INTEGER NOT NULL,
+
+  PRIMARY KEY (chart_date, artist_name)
+);
+
+CREATE INDEX IF NOT EXISTS idx_artist_rank_history_artist ON artist_rank_history(artist_name, chart_date);
+
+-- Lifetime play counts imported from other players' libraries (e.g. Apple
+-- Music). They carry no per-listen timestamps, so they live apart from
+-- scrobbles instead of being faked into them. Re-imports replace counts.
+CREATE TABLE IF NOT EXISTS external_plays (
+  source TEXT NOT NULL,
+  artist_name TEXT NOT NULL,
+  track_name TEXT NOT NULL,
+  album_name TEXT NOT NULL DEFAULT '',
+  play_count INTEGER NOT NULL,
+  last_played_uts INTEGER,
+  added_uts INTEGER,
+  imported_at_uts INTEGER NOT NULL,
+
+  PRIMARY KEY (source, artist_name, track_name, album_name)
+);
+
+-- Audit trail for the edit command: one row per changed field, holding the
+-- value it replaced. scrobble_hash is the edited row's source_hash, which
+-- edits never change, so a re-fetch of the original listen still dedupes.
+CREATE TABLE IF NOT EXISTS edits (
+  id INTEGER PRIMARY KEY,
+  edited_at_uts INTEGER NOT NULL,
+  scrobble_hash TEXT NOT NULL,
+  played_at_uts INTEGER NOT NULL,
+  field TEXT NOT NULL,
+  old_value TEXT,
+  new_value TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_edits_scrobble ON edits(scrobble_hash);
+
+-- Artists (track_name '') or single tracks kept out of digests, charts and
+-- recommendation seeds: sleep noise, podcasts, kids' music. The scrobbles
+-- themselves stay in the archive. Matching is case-insensitive.
+CREATE TABLE IF NOT EXISTS ignores (
+  artist_name TEXT NOT NULL COLLATE NOCASE,
+  track_name TEXT NOT NULL DEFAULT '' COLLATE NOCASE,
+  added_at_uts INTEGER NOT NULL,
+
+  PRIMARY KEY (artist_name, track_name)
+);
+
+-- Artists never to suggest in recommendations, whatever the listening says.
+-- Separate from ignores: a blocked artist still counts in the stats.
+CREATE TABLE IF NOT EXISTS recommend_blocks (
+  artist_name TEXT PRIMARY KEY COLLATE NOCASE,
+  added_at_uts INTEGER NOT NULL
+);
+
+-- Every track (or album) recommend has suggested, one row per suggestion per
+-- run, so later runs can avoid repeating themselves.
+CREATE TABLE IF NOT EXISTS recommendations (
+  run_id INTEGER NOT NULL,
+  recommended_at_uts INTEGER NOT NULL,
+  algo TEXT NOT NULL,
+  rank INTEGER NOT NULL,
+  artist_name TEXT NOT NULL,
+  track_name TEXT NOT NULL,
+  score REAL NOT NULL,
+
+  PRIMARY KEY (run_id, rank)
+);
+
+CREATE INDEX IF NOT EXISTS idx_recommendations_at ON recommendations(recommended_at_uts);
+
+-- Last.fm responses recommend has fetched (similar artists, top tracks,
+-- tags...), keyed by method and lowercased arguments, so it can reuse them
+-- and run offline.
+CREATE TABLE IF NOT EXISTS lastfm_cache (
+  method TEXT NOT NULL,
+  key TEXT NOT NULL,
+  body TEXT NOT NULL,
+  fetched_at_uts INTEGER NOT NULL,
+
+  PRIMARY KEY (method, key)
+);
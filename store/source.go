@@ -0,0 +1,48 @@
+package store
+
+import "context"
+
+// Scrobble sources, recorded in scrobbles.source.
+const (
+	SourceLastFMAPI     = "lastfm_api"
+	SourceImportCSV     = "import_csv"
+	SourceSpotifyExport = "spotify_export"
+	SourceListenBrainz  = "listenbrainz"
+	SourceManual        = "manual"
+)
+
+// SourceAppleMusic tags plays imported from an Apple Music / iTunes library
+// (see ExternalPlay).
+const SourceAppleMusic = "apple_music"
+
+// SourceCounts returns the number of scrobbles the filter keeps per source.
+func (s *Store) SourceCounts(ctx context.Context, f Filter) (map[string]int64, error) {
+	f.User = s.user
+	q, args := f.Scope(`SELECT source, COUNT(*) FROM scrobbles GROUP BY source`)
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]int64{}
+	for rows.Next() {
+		var src string
+		var n int64
+		if err := rows.Scan(&src, &n); err != nil {
+			return nil, err
+		}
+		out[src] = n
+	}
+	return out, rows.Err()
+}
+
+// RawRowCount returns the number of rows the raw JSONL log mirrors: the
+// Last.fm API scrobbles of every user, tombstoned or not. pruned reports
+// whether any user pruned them by date, which leaves their raw lines behind.
+func (s *Store) RawRowCount(ctx context.Context) (rows int64, pruned bool, err error) {
+	err = s.DB.QueryRowContext(ctx, `SELECT
+		(SELECT COUNT(*) FROM scrobbles WHERE source = ?),
+		EXISTS (SELECT 1 FROM state WHERE key = ?)`,
+		SourceLastFMAPI, PrunedBeforeKey).Scan(&rows, &pruned)
+	return rows, pruned, err
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+const setStateSQL = `INSERT INTO state(user_name, key, value) VALUES(?, ?, ?) ON CONFLICT(user_name, key) DO UPDATE SET value = excluded.value`
+
+// GetState returns the value stored under key, or "" if unset.
+func (s *Store) GetState(ctx context.Context, key string) (string, error) {
+	var v string
+	err := s.DB.QueryRowContext(ctx, `SELECT value FROM state WHERE user_name = ? AND key = ?`, s.user, key).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return v, err
+}
+
+// SetState stores value under key; a dry run keeps the old value.
+func (s *Store) SetState(ctx context.Context, key, value string) error {
+	if s.dryRun {
+		return nil
+	}
+	_, err := s.DB.ExecContext(ctx, setStateSQL, s.user, key, value)
+	return err
+}
+
+// DeleteState removes key; a dry run keeps it.
+func (s *Store) DeleteState(ctx context.Context, key string) error {
+	if s.dryRun {
+		return nil
+	}
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM state WHERE user_name = ? AND key = ?`, s.user, key)
+	return err
+}
@@ -0,0 +1,511 @@
+// Package store keeps a local scrobble archive: a SQLite database for queries
+// plus an append-only raw JSONL log of every scrobble as Last.fm returned it.
+package store
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+//go:embed schema.sql
+var schemaFS embed.FS
+
+// SchemaVersion is recorded in the database's PRAGMA user_version. Bump it
+// together with a new entry in migrations.
+const SchemaVersion = 18
+
+const (
+	DBFile       = "lastfm.sqlite"
+	RawJSONLFile = "scrobbles.raw.jsonl"
+)
+
+type Store struct {
+	DataDir     string
+	DB          *sql.DB
+	RawJSONL    *os.File
+	RawJSONLBuf *bufio.Writer
+	// TornBytes is how much of a torn final raw JSONL line Open cut off
+	// (see TornSuffix); 0 normally.
+	TornBytes int64
+
+	skipRawTracks bool
+	fsync         bool
+	dryRun        bool
+	lock          *dirLock
+	loc           *time.Location
+	user          string
+	minSane       int64
+
+	// inserted and ignored count the scrobbles this Store has inserted
+	// and skipped since Open, for the run journal (see FinishRun).
+	inserted, ignored int
+}
+
+type OpenOptions struct {
+	DataDir string
+	// SkipRawTracks leaves new API scrobbles out of the raw JSONL, for
+	// when whole pages are archived instead (see AppendRawPage).
+	SkipRawTracks bool
+	// Fsync syncs the raw archives to disk after every page, not just at
+	// Close, so a power loss can't take flushed records with it.
+	Fsync bool
+	// Timezone is the IANA name of the listener's home zone, whose
+	// calendar days and years the stats count in. Empty keeps the one
+	// last used (UTC at first); a new one recomputes every play's date.
+	Timezone string
+	// User is the Last.fm user whose scrobbles, state and lists the store
+	// works with, as one database can hold several (see profile.go). Empty
+	// means the only user there is.
+	User string
+	// MinSaneUTS is the minimum sane timestamp: scrobbles dated before it
+	// are taken for Last.fm's placeholders. 0 keeps the one last used
+	// (MinSaneUTS at first); a new one recounts the first plays.
+	MinSaneUTS int64
+	// DryRun rolls back every transaction instead of committing it and
+	// leaves the state table and raw archives alone, so a command can show
+	// what it would change. The database must exist at SchemaVersion.
+	DryRun bool
+}
+
+// Open opens (creating and migrating as needed) the store in opt.DataDir and
+// holds the data dir's lock until Close; it fails fast with ErrLocked if
+// another process has it open.
+func Open(ctx context.Context, opt OpenOptions) (*Store, error) {
+	if err := os.MkdirAll(opt.DataDir, 0o755); err != nil {
+		return nil, err
+	}
+	lock, err := lockDataDir(opt.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	s, err := open(ctx, opt)
+	if err != nil {
+		lock.release()
+		return nil, err
+	}
+	s.lock = lock
+	return s, nil
+}
+
+func open(ctx context.Context, opt OpenOptions) (*Store, error) {
+	dbPath := filepath.Join(opt.DataDir, DBFile)
+	if opt.DryRun {
+		if _, err := os.Stat(dbPath); err != nil {
+			return nil, fmt.Errorf("dry run needs an existing database: %w", err)
+		}
+	}
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if opt.DryRun {
+		return openDryRun(ctx, db, opt)
+	}
+
+	schemaBytes, err := schemaFS.ReadFile("schema.sql")
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, string(schemaBytes)); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("apply schema: %w", err)
+	}
+	if err := migrate(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	rawPath := filepath.Join(opt.DataDir, RawJSONLFile)
+	torn, err := repairTornTail(rawPath)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("repair %s: %w", RawJSONLFile, err)
+	}
+	rawF, err := os.OpenFile(rawPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	s := &Store{
+		DataDir:       opt.DataDir,
+		DB:            db,
+		RawJSONL:      rawF,
+		RawJSONLBuf:   bufio.NewWriterSize(rawF, 1024*1024),
+		TornBytes:     torn,
+		skipRawTracks: opt.SkipRawTracks,
+		fsync:         opt.Fsync,
+	}
+	if err := s.useProfile(ctx, opt.User); err != nil {
+		_ = rawF.Close()
+		_ = db.Close()
+		return nil, err
+	}
+	if err := s.useTimezone(ctx, opt.Timezone); err != nil {
+		_ = rawF.Close()
+		_ = db.Close()
+		return nil, err
+	}
+	if err := s.useMinSane(ctx, opt.MinSaneUTS); err != nil {
+		_ = rawF.Close()
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// openDryRun finishes open for OpenOptions.DryRun: no schema changes, no
+// torn-tail repair, and raw JSONL writes go nowhere.
+func openDryRun(ctx context.Context, db *sql.DB, opt OpenOptions) (*Store, error) {
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if version != SchemaVersion {
+		_ = db.Close()
+		return nil, fmt.Errorf("dry run: database is at schema version %d, want %d; run once without --dry-run to migrate it", version, SchemaVersion)
+	}
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	s := &Store{
+		DataDir:       opt.DataDir,
+		DB:            db,
+		RawJSONL:      devNull,
+		RawJSONLBuf:   bufio.NewWriter(devNull),
+		skipRawTracks: opt.SkipRawTracks,
+		dryRun:        true,
+	}
+	if err := s.useProfile(ctx, opt.User); err != nil {
+		_ = devNull.Close()
+		_ = db.Close()
+		return nil, err
+	}
+	if err := s.useTimezone(ctx, opt.Timezone); err != nil {
+		_ = devNull.Close()
+		_ = db.Close()
+		return nil, err
+	}
+	if err := s.useMinSane(ctx, opt.MinSaneUTS); err != nil {
+		_ = devNull.Close()
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// DryRun reports whether the store was opened with OpenOptions.DryRun.
+func (s *Store) DryRun() bool {
+	return s.dryRun
+}
+
+// commit commits tx, or rolls it back in a dry run.
+func (s *Store) commit(tx *sql.Tx) error {
+	if s.dryRun {
+		return tx.Rollback()
+	}
+	return tx.Commit()
+}
+
+// Version returns the schema version recorded in the database.
+func (s *Store) Version(ctx context.Context) (int, error) {
+	var v int
+	err := s.DB.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&v)
+	return v, err
+}
+
+// Sync flushes the raw JSONL and syncs it to disk.
+func (s *Store) Sync() error {
+	if err := s.RawJSONLBuf.Flush(); err != nil || s.dryRun {
+		return err
+	}
+	return s.RawJSONL.Sync()
+}
+
+// Close syncs the raw JSONL, then closes everything and releases the data
+// dir. It reports the first error but always closes.
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	var err error
+	if s.RawJSONL != nil {
+		err = s.Sync()
+		if cerr := s.RawJSONL.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if s.DB != nil {
+		if cerr := s.DB.Close(); err == nil {
+			err = cerr
+		}
+	}
+	s.lock.release()
+	return err
+}
+
+// flushRaw ends a page's raw JSONL writes: flushed always, synced with
+// OpenOptions.Fsync.
+func (s *Store) flushRaw() error {
+	if s.fsync {
+		return s.Sync()
+	}
+	return s.RawJSONLBuf.Flush()
+}
+
+// RawEnvelope is one line of the raw JSONL, which all the users of a data
+// dir share. User is empty in lines written before it was recorded.
+type RawEnvelope struct {
+	FetchedAt time.Time    `json:"fetched_at"`
+	User      string       `json:"user"`
+	Track     lastfm.Track `json:"track"`
+}
+
+func (s *Store) AppendRaw(track lastfm.Track) error {
+	e := RawEnvelope{FetchedAt: time.Now().UTC(), User: s.user, Track: track}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.RawJSONLBuf.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+// StableSourceHash is the dedupe key for a scrobble.
+func StableSourceHash(playedAtUTS int64, artist, track, album string) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%d|%s|%s|%s", playedAtUTS, artist, track, album)))
+	return hex.EncodeToString(h[:])
+}
+
+type InsertResult struct {
+	Inserted int
+	Ignored  int
+	// New holds the inserted tracks, in order (InsertPage and InsertFrom).
+	New []lastfm.Track
+}
+
+func (s *Store) InsertScrobble(ctx context.Context, t lastfm.Track) (InsertResult, error) {
+	return s.insertTracks(ctx, SourceLastFMAPI, []lastfm.Track{t})
+}
+
+// InsertPage stores a page of tracks fetched from the Last.fm API in one
+// transaction, then appends the newly inserted ones to the raw JSONL
+// (flushed, and synced with Fsync) unless opened with SkipRawTracks. Either
+// the whole page lands or none of it does. Tracks played before PrunedBefore
+// are skipped, as ignored.
+func (s *Store) InsertPage(ctx context.Context, tracks []lastfm.Track) (InsertResult, error) {
+	tracks, pruned, err := s.afterPrune(ctx, tracks)
+	if err != nil {
+		return InsertResult{}, err
+	}
+	total, err := s.insertTracks(ctx, SourceLastFMAPI, tracks)
+	if err != nil {
+		return InsertResult{}, err
+	}
+	total.Ignored += pruned
+
+	// Store raw once per unique scrobble; avoids ballooning JSONL on reruns.
+	fresh := total.New
+	if s.skipRawTracks {
+		fresh = nil
+	}
+	for _, t := range fresh {
+		if err := s.AppendRaw(t); err != nil {
+			return total, err
+		}
+	}
+	return total, s.flushRaw()
+}
+
+// InsertFrom stores tracks that did not come from the Last.fm API (imports,
+// manual entries) in one transaction, tagged with source. The raw JSONL only
+// mirrors API responses, so these are not appended to it.
+func (s *Store) InsertFrom(ctx context.Context, source string, tracks []lastfm.Track) (InsertResult, error) {
+	return s.insertTracks(ctx, source, tracks)
+}
+
+func (s *Store) insertTracks(ctx context.Context, source string, tracks []lastfm.Track) (InsertResult, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return InsertResult{}, err
+	}
+	defer tx.Rollback()
+
+	var total InsertResult
+	var variants []string
+	for _, t := range tracks {
+		res, variant, err := insertScrobble(ctx, tx, s.user, t, source, s.loc)
+		if err != nil {
+			return InsertResult{}, err
+		}
+		if res.Inserted > 0 {
+			total.New = append(total.New, t)
+		}
+		if variant {
+			variants = append(variants, t.Artist.Text)
+		}
+		total.Inserted += res.Inserted
+		total.Ignored += res.Ignored
+	}
+	if err := refreshCanonical(ctx, tx, variants); err != nil {
+		return InsertResult{}, err
+	}
+	if err := s.commit(tx); err != nil {
+		return InsertResult{}, err
+	}
+	s.tally(total)
+	return total, nil
+}
+
+func (s *Store) tally(res InsertResult) {
+	s.inserted += res.Inserted
+	s.ignored += res.Ignored
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// insertScrobble stores t under the canonical names stored plays already
+// give it. variant reports a new spelling of a known name, which may now
+// have the most plays (see refreshCanonical).
+func insertScrobble(ctx context.Context, tx *sql.Tx, user string, t lastfm.Track, source string, loc *time.Location) (res InsertResult, variant bool, err error) {
+	if t.Date == nil || t.Date.UTS == "" {
+		return InsertResult{Ignored: 1}, false, nil
+	}
+	playedAt, err := parseI64(t.Date.UTS)
+	if err != nil {
+		return InsertResult{}, false, err
+	}
+
+	artist := t.Artist.Text
+	track := t.Name
+	album := t.Album.Text
+	hash := StableSourceHash(playedAt, artist, track, album)
+	date, year := localDate(playedAt, loc)
+	canonArtist, canonTrack, canonAlbum, err := canonicalFor(ctx, tx, artist, track, album)
+	if err != nil {
+		return InsertResult{}, false, err
+	}
+
+	r, err := tx.ExecContext(ctx, `
+INSERT OR IGNORE INTO scrobbles(
+  user_name,
+  played_at_uts, track_name, artist_name, album_name,
+  track_mbid, artist_mbid, album_mbid,
+  lastfm_url,
+  source_hash, source,
+  played_date_local, played_year_local,
+  artist_norm, track_norm, album_norm,
+  artist_canonical, track_canonical, album_canonical
+) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+`,
+		user,
+		playedAt, track, artist, nullIfEmpty(album),
+		nullIfEmpty(t.MBID), nullIfEmpty(t.Artist.MBID), nullIfEmpty(t.Album.MBID),
+		nullIfEmpty(t.URL),
+		hash, source,
+		date, year,
+		NormalizeArtist(artist), NormalizeName(track), NormalizeName(album),
+		canonArtist, canonTrack, nullIfEmpty(canonAlbum),
+	)
+	if err != nil {
+		return InsertResult{}, false, err
+	}
+	n, _ := r.RowsAffected()
+	if n == 0 {
+		return InsertResult{Ignored: 1}, false, nil
+	}
+	variant = canonArtist != artist || canonTrack != track || canonAlbum != album
+	return InsertResult{Inserted: 1}, variant, nil
+}
+
+// MaxPlayedAtUTS returns the newest stored play, tombstoned or not: where
+// sync stops.
+func (s *Store) MaxPlayedAtUTS(ctx context.Context) (int64, error) {
+	var v sql.NullInt64
+	if err := s.DB.QueryRowContext(ctx, `SELECT MAX(played_at_uts) FROM scrobbles WHERE user_name = ?`, s.user).Scan(&v); err != nil {
+		return 0, err
+	}
+	if !v.Valid {
+		return 0, nil
+	}
+	return v.Int64, nil
+}
+
+func (s *Store) Stats(ctx context.Context) (count int64, minUTS int64, maxUTS int64, err error) {
+	var c sql.NullInt64
+	var min sql.NullInt64
+	var max sql.NullInt64
+	if err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*), MIN(played_at_uts), MAX(played_at_uts) FROM scrobbles WHERE user_name = ? AND deleted_at_uts IS NULL`, s.user).Scan(&c, &min, &max); err != nil {
+		return 0, 0, 0, err
+	}
+	return c.Int64, min.Int64, max.Int64, nil
+}
+
+// LocalPlays counts stored plays of an artist, or of one of its tracks when
+// track isn't empty, matching names by key (see NormalizeName).
+func (s *Store) LocalPlays(ctx context.Context, artist, track string) (plays int64, lastPlayedUTS int64, err error) {
+	q := `SELECT COUNT(*), COALESCE(MAX(played_at_uts), 0) FROM scrobbles WHERE user_name = ? AND deleted_at_uts IS NULL AND artist_norm = ?`
+	args := []any{s.user, NormalizeArtist(artist)}
+	if track != "" {
+		q += ` AND track_norm = ?`
+		args = append(args, NormalizeName(track))
+	}
+	err = s.DB.QueryRowContext(ctx, q, args...).Scan(&plays, &lastPlayedUTS)
+	return plays, lastPlayedUTS, err
+}
+
+// SyncedPlays counts plays fetched from Last.fm (not imported or added)
+// since sinceUTS, of an artist or, when set, one of its tracks or albums;
+// names match case-insensitively. It is the local side of verify --remote.
+func (s *Store) SyncedPlays(ctx context.Context, artist, track, album string, sinceUTS int64) (int64, error) {
+	q := `SELECT COUNT(*) FROM scrobbles WHERE user_name = ? AND deleted_at_uts IS NULL AND source = ? AND played_at_uts >= ? AND artist_name = ? COLLATE NOCASE`
+	args := []any{s.user, SourceLastFMAPI, sinceUTS, artist}
+	if track != "" {
+		q += ` AND track_name = ? COLLATE NOCASE`
+		args = append(args, track)
+	}
+	if album != "" {
+		q += ` AND album_name = ? COLLATE NOCASE`
+		args = append(args, album)
+	}
+	var n int64
+	err := s.DB.QueryRowContext(ctx, q, args...).Scan(&n)
+	return n, err
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func parseI64(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
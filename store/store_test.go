@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+func TestStableSourceHashDeterministic(t *testing.T) {
+	h1 := StableSourceHash(123, "artist", "track", "album")
+	h2 := StableSourceHash(123, "artist", "track", "album")
+	if h1 != h2 {
+		t.Fatalf("expected deterministic hash: %q != %q", h1, h2)
+	}
+}
+
+func TestOpenLocksDataDir(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := Open(ctx, OpenOptions{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(ctx, OpenOptions{DataDir: dir}); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second open: err = %v, want ErrLocked", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open(ctx, OpenOptions{DataDir: dir})
+	if err != nil {
+		t.Fatalf("reopen after close: %v", err)
+	}
+	_ = s.Close()
+}
+
+func TestLockCommandLeavesOutFlags(t *testing.T) {
+	for _, c := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"/usr/bin/lastfm-golang", "sync", "--api-key", "k", "--shared-secret", "s"}, "lastfm-golang sync"},
+		{[]string{"lastfm-golang", "--session-key=k"}, "lastfm-golang"},
+		{nil, "?"},
+	} {
+		if got := command(c.args); got != c.want {
+			t.Errorf("command(%q) = %q, want %q", c.args, got, c.want)
+		}
+	}
+}
+
+func TestInsertPageRecordsUserInRawLine(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, user := range []string{"alice", "bob"} {
+		s, err := Open(ctx, OpenOptions{DataDir: dir, User: user})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := lastfm.Track{Name: "Archangel", Artist: lastfm.TextMBID{Text: "Burial"}, Date: &lastfm.Date{UTS: "1700000000"}}
+		if _, err := s.InsertPage(ctx, []lastfm.Track{tr}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(filepath.Join(dir, RawJSONLFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var users []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var e RawEnvelope
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, e.User)
+	}
+	if got := strings.Join(users, ","); got != "alice,bob" {
+		t.Errorf("raw lines are for %s, want alice,bob", got)
+	}
+}
+
+func TestOpenRepairsTornRawLine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, RawJSONLFile)
+	if err := os.WriteFile(path, []byte("{\"a\":1}\n{\"a\":2}\n{\"a\":"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(context.Background(), OpenOptions{DataDir: dir, Fsync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.TornBytes != 5 {
+		t.Fatalf("TornBytes = %d, want 5", s.TornBytes)
+	}
+	if err := s.AppendRaw(lastfm.Track{Name: "Roygbiv"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[2], "Roygbiv") {
+		t.Fatalf("raw jsonl after repair:\n%s", b)
+	}
+	if torn, _ := os.ReadFile(path + TornSuffix); string(torn) != "{\"a\":\n" {
+		t.Fatalf("torn tail = %q", torn)
+	}
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// timezoneStateKey records the zone played_date_local and played_year_local
+// were computed in; none means UTC.
+const timezoneStateKey = "home_timezone"
+
+// Location is the home time zone the store's local dates are in.
+func (s *Store) Location() *time.Location {
+	return s.loc
+}
+
+// useTimezone loads the home time zone: name if given, else the one last
+// used. Switching zones recomputes every scrobble's local date, once.
+func (s *Store) useTimezone(ctx context.Context, name string) error {
+	stored, err := s.GetState(ctx, timezoneStateKey)
+	if err != nil {
+		return err
+	}
+	if stored == "" {
+		stored = "UTC"
+	}
+	if name == "" {
+		name = stored
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("timezone %q: %w", name, err)
+	}
+	s.loc = loc
+	if name == stored {
+		return nil
+	}
+	return s.relocalize(ctx, loc)
+}
+
+// relocalize recomputes the local date columns in loc, one UPDATE per
+// stretch of time with a fixed UTC offset, then recounts the rollups,
+// whose days are local days.
+func (s *Store) relocalize(ctx context.Context, loc *time.Location) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var minUTS, maxUTS sql.NullInt64
+	if err := tx.QueryRowContext(ctx, `SELECT MIN(played_at_uts), MAX(played_at_uts) FROM scrobbles WHERE user_name = ?`, s.user).Scan(&minUTS, &maxUTS); err != nil {
+		return err
+	}
+	if minUTS.Valid {
+		for from := minUTS.Int64; from <= maxUTS.Int64; {
+			t := time.Unix(from, 0).In(loc)
+			_, offset := t.Zone()
+			to := maxUTS.Int64 + 1
+			if _, end := t.ZoneBounds(); !end.IsZero() {
+				to = min(to, end.Unix())
+			}
+			if _, err := tx.ExecContext(ctx, `
+UPDATE scrobbles SET
+  played_date_local = date(played_at_uts + ?, 'unixepoch'),
+  played_year_local = CAST(strftime('%Y', played_at_uts + ?, 'unixepoch') AS INTEGER)
+WHERE user_name = ? AND played_at_uts >= ? AND played_at_uts < ?
+`, offset, offset, s.user, from, to); err != nil {
+				return err
+			}
+			from = to
+		}
+	}
+	if _, err := tx.ExecContext(ctx, rollupRebuild(rollupCurrent)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, setStateSQL, s.user, timezoneStateKey, loc.String()); err != nil {
+		return err
+	}
+	return s.commit(tx)
+}
+
+// localDate is a play's calendar date and year in loc.
+func localDate(uts int64, loc *time.Location) (string, int) {
+	t := time.Unix(uts, 0).In(loc)
+	return t.Format("2006-01-02"), t.Year()
+}
+
+// localDayLabel maps a local midnight to the rollups' day for that date
+// (the date's UTC midnight); ok is false for any other time.
+func localDayLabel(uts int64, loc *time.Location) (int64, bool) {
+	t := time.Unix(uts, 0).In(loc)
+	if t.Hour() != 0 || t.Minute() != 0 || t.Second() != 0 {
+		return 0, false
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix(), true
+}
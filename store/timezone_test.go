@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+func TestTimezoneLocalDates(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := Open(ctx, OpenOptions{DataDir: dir, Timezone: "America/Los_Angeles"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// New Year's Eve in Los Angeles, already 2024 in UTC and Tokyo.
+	nye := time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC).Unix()
+	tr := lastfm.Track{Name: "Roygbiv", Artist: lastfm.TextMBID{Text: "Boards of Canada"}, Date: &lastfm.Date{UTS: strconv.FormatInt(nye, 10)}}
+	if _, err := s.InsertScrobble(ctx, tr); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(s *Store, wantDate string, wantYear int) {
+		t.Helper()
+		var date string
+		var year int
+		if err := s.DB.QueryRowContext(ctx, `SELECT played_date_local, played_year_local FROM scrobbles`).Scan(&date, &year); err != nil {
+			t.Fatal(err)
+		}
+		if date != wantDate || year != wantYear {
+			t.Fatalf("local date = %s, year %d; want %s, %d", date, year, wantDate, wantYear)
+		}
+		ys, err := s.TopArtistsByYear(ctx, Filter{}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(ys); got != fmt.Sprintf("[{%d 1 Boards of Canada 1}]", wantYear) {
+			t.Fatalf("TopArtistsByYear = %s, want year %d", got, wantYear)
+		}
+	}
+	check(s, "2023-12-31", 2023)
+	s.Close()
+
+	// Reopening without a zone keeps the last one.
+	s, err = Open(ctx, OpenOptions{DataDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Location().String(); got != "America/Los_Angeles" {
+		t.Fatalf("Location = %s, want America/Los_Angeles", got)
+	}
+	check(s, "2023-12-31", 2023)
+	s.Close()
+
+	// A new zone recomputes stored dates and the rollups.
+	s, err = Open(ctx, OpenOptions{DataDir: dir, Timezone: "Asia/Tokyo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	check(s, "2024-01-01", 2024)
+
+	if _, err := Open(ctx, OpenOptions{DataDir: t.TempDir(), Timezone: "Mars/Olympus_Mons"}); err == nil {
+		t.Fatal("unknown zone: want an error")
+	}
+}
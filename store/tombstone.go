@@ -0,0 +1,230 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A tombstoned scrobble is deleted without being removed: deleted_at_uts
+// says when, deleted_reason who by (TombstoneReconcile, TombstoneManual, or
+// another caller's name, e.g. a dedupe pass). It stays in the table, so
+// re-fetching the listen still dedupes and UndeleteScrobbles can bring it
+// back, but queries scoped by a Filter, the rollups and the Store's counts
+// leave it out. Only PruneScrobbles removes scrobbles for good.
+
+// Tombstone reasons recorded in scrobbles.deleted_reason.
+const (
+	// TombstoneReconcile marks scrobbles Last.fm no longer lists (see
+	// ReconcileSynced).
+	TombstoneReconcile = "reconcile"
+	// TombstoneManual marks scrobbles deleted by hand.
+	TombstoneManual = "manual"
+)
+
+// tombstonesTable adds deleted_reason (schema version 10); tombstones from
+// before it came from reconcile, the only thing that made them.
+const tombstonesTable = `
+ALTER TABLE scrobbles ADD COLUMN deleted_reason TEXT;
+UPDATE scrobbles SET deleted_reason = '` + TombstoneReconcile + `' WHERE deleted_at_uts IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_scrobbles_deleted ON scrobbles(user_name, deleted_at_uts) WHERE deleted_at_uts IS NOT NULL;
+`
+
+var errEmptyMatch = errors.New("store: tombstoning needs at least one match")
+
+// Tombstone is a deleted scrobble.
+type Tombstone struct {
+	Scrobble
+	DeletedAtUTS int64
+	Reason       string
+}
+
+// TombstoneResult reports what TombstoneScrobbles or UndeleteScrobbles
+// changed.
+type TombstoneResult struct {
+	Scrobbles []Scrobble
+	MinPlayed int64 // earliest played_at_uts touched, 0 if none
+}
+
+// TombstoneScrobbles tombstones the live scrobbles m matches, giving
+// reason, in one transaction. An empty m is an error rather than all of
+// them.
+func (s *Store) TombstoneScrobbles(ctx context.Context, m EditMatch, reason string) (TombstoneResult, error) {
+	conds, args := m.where()
+	if len(conds) == 0 {
+		return TombstoneResult{}, errEmptyMatch
+	}
+	conds = append(conds, "deleted_at_uts IS NULL")
+	return s.setTombstones(ctx, conds, args, reason)
+}
+
+// UndeleteScrobbles restores the tombstoned scrobbles m matches, all of
+// them if m is empty.
+func (s *Store) UndeleteScrobbles(ctx context.Context, m EditMatch) (TombstoneResult, error) {
+	conds, args := m.where()
+	conds = append(conds, "deleted_at_uts IS NOT NULL")
+	return s.setTombstones(ctx, conds, args, "")
+}
+
+// setTombstones tombstones the user's scrobbles matching conds with
+// reason, or with reason "" restores them.
+func (s *Store) setTombstones(ctx context.Context, conds []string, args []any, reason string) (TombstoneResult, error) {
+	conds = append(conds, "user_name = ?")
+	args = append(args, s.user)
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return TombstoneResult{}, err
+	}
+	defer tx.Rollback()
+
+	matched, err := tombstoneRows(ctx, tx, strings.Join(conds, " AND "), args)
+	if err != nil {
+		return TombstoneResult{}, err
+	}
+	var res TombstoneResult
+	var artists []string
+	for _, r := range matched {
+		if err := setTombstone(ctx, tx, r.rowid, reason, time.Now()); err != nil {
+			return TombstoneResult{}, err
+		}
+		res.add(r.Scrobble)
+		artists = append(artists, r.Artist)
+	}
+	if err := refreshCanonical(ctx, tx, artists); err != nil {
+		return TombstoneResult{}, err
+	}
+	return res, s.commit(tx)
+}
+
+func (r *TombstoneResult) add(sc Scrobble) {
+	r.Scrobbles = append(r.Scrobbles, sc)
+	if r.MinPlayed == 0 || sc.PlayedAtUTS < r.MinPlayed {
+		r.MinPlayed = sc.PlayedAtUTS
+	}
+}
+
+// tombstoneRow is a scrobbles row setTombstones or ReconcileSynced may
+// change.
+type tombstoneRow struct {
+	Tombstone
+	rowid int64
+	hash  string
+}
+
+func tombstoneRows(ctx context.Context, tx *sql.Tx, cond string, args []any) ([]tombstoneRow, error) {
+	rows, err := tx.QueryContext(ctx, `
+SELECT rowid, source_hash, COALESCE(deleted_at_uts, 0), COALESCE(deleted_reason, ''),
+  played_at_uts, artist_name, track_name, COALESCE(album_name, ''), source
+FROM scrobbles
+WHERE `+cond+`
+ORDER BY played_at_uts ASC, rowid ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []tombstoneRow
+	for rows.Next() {
+		var r tombstoneRow
+		if err := rows.Scan(&r.rowid, &r.hash, &r.DeletedAtUTS, &r.Reason, &r.PlayedAtUTS, &r.Artist, &r.Track, &r.Album, &r.Source); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// setTombstone tombstones one row with reason, or restores it if reason is
+// "". The rollup triggers follow.
+func setTombstone(ctx context.Context, tx *sql.Tx, rowid int64, reason string, now time.Time) error {
+	var err error
+	if reason == "" {
+		_, err = tx.ExecContext(ctx, `UPDATE scrobbles SET deleted_at_uts = NULL, deleted_reason = NULL WHERE rowid = ?`, rowid)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE scrobbles SET deleted_at_uts = ?, deleted_reason = ? WHERE rowid = ?`, now.Unix(), reason, rowid)
+	}
+	return err
+}
+
+// Tombstones returns the user's tombstoned scrobbles, most recently
+// deleted first.
+func (s *Store) Tombstones(ctx context.Context, limit int) ([]Tombstone, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+SELECT deleted_at_uts, COALESCE(deleted_reason, ''), played_at_uts, artist_name, track_name, COALESCE(album_name, ''), source
+FROM scrobbles
+WHERE user_name = ? AND deleted_at_uts IS NOT NULL
+ORDER BY deleted_at_uts DESC, played_at_uts DESC
+LIMIT ?
+`, s.user, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Tombstone
+	for rows.Next() {
+		var t Tombstone
+		if err := rows.Scan(&t.DeletedAtUTS, &t.Reason, &t.PlayedAtUTS, &t.Artist, &t.Track, &t.Album, &t.Source); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// ReconcileResult reports what ReconcileSynced changed.
+type ReconcileResult struct {
+	// Checked is how many synced scrobbles it compared.
+	Checked    int
+	Tombstoned []Scrobble
+	// Restored were tombstoned by an earlier reconcile but are on Last.fm
+	// again.
+	Restored []Scrobble
+}
+
+// ReconcileSynced compares the scrobbles fetched from Last.fm and played in
+// r with present, the source hashes (see StableSourceHash) of what Last.fm
+// now lists for r. Live ones missing from it are tombstoned
+// (TombstoneReconcile); ones an earlier reconcile tombstoned that are in it
+// are restored. Scrobbles deleted for another reason stay deleted, and
+// imported and added ones aren't on Last.fm to compare with, so it leaves
+// them alone. It all happens in one transaction.
+func (s *Store) ReconcileSynced(ctx context.Context, r TimeRange, present map[string]bool, now time.Time) (ReconcileResult, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return ReconcileResult{}, err
+	}
+	defer tx.Rollback()
+
+	rcond, rargs := r.where()
+	matched, err := tombstoneRows(ctx, tx, `user_name = ? AND source = ? AND `+rcond, append([]any{s.user, SourceLastFMAPI}, rargs...))
+	if err != nil {
+		return ReconcileResult{}, err
+	}
+	var res ReconcileResult
+	for _, row := range matched {
+		res.Checked++
+		switch {
+		case row.DeletedAtUTS == 0 && !present[row.hash]:
+			if err := setTombstone(ctx, tx, row.rowid, TombstoneReconcile, now); err != nil {
+				return ReconcileResult{}, err
+			}
+			res.Tombstoned = append(res.Tombstoned, row.Scrobble)
+		case row.Reason == TombstoneReconcile && present[row.hash]:
+			if err := setTombstone(ctx, tx, row.rowid, "", now); err != nil {
+				return ReconcileResult{}, err
+			}
+			res.Restored = append(res.Restored, row.Scrobble)
+		}
+	}
+	var artists []string
+	for _, sc := range slices.Concat(res.Tombstoned, res.Restored) {
+		artists = append(artists, sc.Artist)
+	}
+	if err := refreshCanonical(ctx, tx, artists); err != nil {
+		return ReconcileResult{}, err
+	}
+	return res, s.commit(tx)
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"slices"
+	"strings"
+
+	"modernc.org/sqlite"
+)
+
+// Version kinds: a play of a live recording, a remix or a demo rather than
+// the studio track (see ClassifyTrack and Filter.ExcludeVersions).
+const (
+	VersionLive  = "live"
+	VersionRemix = "remix"
+	VersionDemo  = "demo"
+)
+
+// VersionKinds are the kinds ClassifyTrack tells apart.
+var VersionKinds = []string{VersionLive, VersionRemix, VersionDemo}
+
+var (
+	// versionTag is a title's last bracketed part or " - " suffix, which
+	// is where Last.fm titles say which version they are: "Song (Live at
+	// Leeds)", "Song [Burial Remix]", "Song - 2003 Demo".
+	versionTag = regexp.MustCompile(`\s*(?:\(([^()]*)\)|\[([^\[\]]*)\]|\s[-–—]\s+([^-–—]+))\s*$`)
+
+	// The words that make a tag, or an album title, a kind.
+	tagKinds = []struct {
+		kind string
+		re   *regexp.Regexp
+	}{
+		{VersionLive, regexp.MustCompile(`(?i)\blive\b|\bunplugged\b|\bin concert\b`)},
+		{VersionRemix, regexp.MustCompile(`(?i)\bre-?mix(es|ed)?\b|\brmx\b`)},
+		{VersionDemo, regexp.MustCompile(`(?i)\bdemos?\b`)},
+	}
+	albumKinds = []struct {
+		kind string
+		re   *regexp.Regexp
+	}{
+		{VersionLive, regexp.MustCompile(`(?i)\blive (at|in|from|on)\b|\bunplugged\b|\bin concert\b|[(\[]live[)\]]`)},
+		{VersionRemix, regexp.MustCompile(`(?i)\bremix(es|ed)\b`)},
+		{VersionDemo, regexp.MustCompile(`(?i)\bdemos\b`)},
+	}
+)
+
+// ClassifyTrack guesses from a track's title, then its album's, whether it
+// is a live recording, a remix or a demo: the kind, or "" for anything else.
+// base is the title without the tag that told, "Song" for "Song (Live at
+// Leeds)", so the play can be counted as the studio track's; it is track
+// itself when the album told or nothing did.
+func ClassifyTrack(track, album string) (kind, base string) {
+	rest := track
+	// A version tag may come before another, "Song (Live) [Remastered]".
+	for range 3 {
+		m := versionTag.FindStringSubmatchIndex(rest)
+		if m == nil || m[0] == 0 {
+			break
+		}
+		tag := ""
+		for i := 2; i < len(m); i += 2 {
+			if m[i] >= 0 {
+				tag = rest[m[i]:m[i+1]]
+			}
+		}
+		for _, k := range tagKinds {
+			if k.re.MatchString(tag) {
+				return k.kind, rest[:m[0]]
+			}
+		}
+		rest = rest[:m[0]]
+	}
+	return ClassifyAlbum(album), track
+}
+
+// ClassifyAlbum is ClassifyTrack for a whole album, by its title: "Live at
+// Leeds", "Untrue (Remixes)", "Demos".
+func ClassifyAlbum(album string) string {
+	for _, k := range albumKinds {
+		if k.re.MatchString(album) {
+			return k.kind
+		}
+	}
+	return ""
+}
+
+// versionKinds returns the known kinds among kinds as an SQL list of string
+// literals, e.g. 'live','demo', or "" if there are none.
+func versionKinds(kinds []string) string {
+	var known []string
+	for _, k := range VersionKinds {
+		if slices.Contains(kinds, k) {
+			known = append(known, "'"+k+"'")
+		}
+	}
+	return strings.Join(known, ",")
+}
+
+// track_version(track, album) and track_base(track) are ClassifyTrack's
+// kind and base title in SQL, for filters that exclude or fold versions.
+func init() {
+	text := func(v driver.Value) string {
+		switch v := v.(type) {
+		case string:
+			return v
+		case []byte:
+			return string(v)
+		}
+		return ""
+	}
+	err := sqlite.RegisterDeterministicScalarFunction("track_version", 2, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		kind, _ := ClassifyTrack(text(args[0]), text(args[1]))
+		return kind, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = sqlite.RegisterDeterministicScalarFunction("track_base", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		_, base := ClassifyTrack(text(args[0]), "")
+		return base, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
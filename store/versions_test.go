@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/joshp123/lastfm-golang/lastfm"
+)
+
+func TestClassifyTrack(t *testing.T) {
+	for _, c := range []struct {
+		track, album string
+		kind, base   string
+	}{
+		{"Archangel", "Untrue", "", "Archangel"},
+		{"Archangel (Live at Fabric)", "", VersionLive, "Archangel"},
+		{"Archangel - Live", "", VersionLive, "Archangel"},
+		{"Archangel (Live) [2017 Remaster]", "", VersionLive, "Archangel"},
+		{"Ghost Hardware [Burial Remix]", "", VersionRemix, "Ghost Hardware"},
+		{"Ghost Hardware (Burial Rmx)", "", VersionRemix, "Ghost Hardware"},
+		{"Ghost Hardware (Remixed by Burial)", "", VersionRemix, "Ghost Hardware"},
+		{"Lithium - 1990 Demo", "", VersionDemo, "Lithium"},
+		{"Near Dark", "Live at Leeds", VersionLive, "Near Dark"},
+		{"Near Dark", "Untrue (Remixes)", VersionRemix, "Near Dark"},
+		// Only a tag tells, not a word in the title itself.
+		{"Live Forever", "Definitely Maybe", "", "Live Forever"},
+		{"(Live)", "", "", "(Live)"},
+	} {
+		kind, base := ClassifyTrack(c.track, c.album)
+		if kind != c.kind || base != c.base {
+			t.Errorf("ClassifyTrack(%q, %q) = %q, %q, want %q, %q", c.track, c.album, kind, base, c.kind, c.base)
+		}
+	}
+}
+
+func TestFilterVersions(t *testing.T) {
+	ctx := context.Background()
+	s, err := Open(ctx, OpenOptions{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now().Unix()
+	for i, p := range []struct{ track, album, albumMBID string }{
+		{"Archangel", "Untrue", ""},
+		{"Archangel", "Untrue", ""},
+		{"Archangel (Live)", "Untrue", ""},
+		{"Near Dark", "Live at Fabric", ""},
+		{"Ghost Hardware [Four Tet Remix]", "", ""},
+		{"Etched Headplate", "Rival Dealer", "r-demos"},
+	} {
+		tr := lastfm.Track{
+			Name:   p.track,
+			Artist: lastfm.TextMBID{Text: "Burial"},
+			Album:  lastfm.TextMBID{Text: p.album, MBID: p.albumMBID},
+			Date:   &lastfm.Date{UTS: strconv.FormatInt(now-int64(i)*60, 10)},
+		}
+		if _, err := s.InsertScrobble(ctx, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// MusicBrainz, not the title, says this one is a demo.
+	if err := s.PutMBRelease(ctx, MBRelease{MBID: "r-demos", Kind: VersionDemo}); err != nil {
+		t.Fatal(err)
+	}
+
+	tracks := func(f Filter) string {
+		top, err := s.TopTracks(ctx, f, TimeRange{}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plays := map[string]int64{}
+		for _, tc := range top {
+			plays[tc.Track] = tc.Plays
+		}
+		return fmt.Sprint(plays)
+	}
+	scan := []TimeRange{{From: 1, To: 2}}
+	for _, c := range []struct {
+		f    Filter
+		want string
+	}{
+		{Filter{}, "map[Archangel:2 Archangel (Live):1 Etched Headplate:1 Ghost Hardware [Four Tet Remix]:1 Near Dark:1]"},
+		{Filter{ExcludeVersions: VersionKinds}, "map[Archangel:2]"},
+		{Filter{ExcludeVersions: []string{VersionDemo}}, "map[Archangel:2 Archangel (Live):1 Ghost Hardware [Four Tet Remix]:1 Near Dark:1]"},
+		{Filter{FoldVersions: VersionKinds}, "map[Archangel:3 Etched Headplate:1 Ghost Hardware:1 Near Dark:1]"},
+		{Filter{ExcludeVersions: []string{VersionRemix}, FoldVersions: []string{VersionLive}}, "map[Archangel:3 Etched Headplate:1 Near Dark:1]"},
+	} {
+		for _, f := range []Filter{c.f, {ExcludeVersions: c.f.ExcludeVersions, FoldVersions: c.f.FoldVersions, ExcludeRanges: scan}} {
+			if got := tracks(f); got != c.want {
+				t.Errorf("top tracks (exclude %v, fold %v, scan %v) = %s, want %s", f.ExcludeVersions, f.FoldVersions, f.ExcludeRanges != nil, got, c.want)
+			}
+		}
+	}
+
+	// Excluded plays don't count toward the artist either.
+	artists, err := s.TopArtists(ctx, Filter{ExcludeVersions: VersionKinds}, TimeRange{}, 10)
+	if err != nil || len(artists) != 1 || artists[0].Plays != 2 {
+		t.Errorf("top artists without versions = %+v, %v", artists, err)
+	}
+}